@@ -1 +1,7 @@
 # Include custome targets and environment variables here
+
+# The write key and data plane of the telemetry, sent only when the admins opt
+# in. Without a write key, the plugin sends no telemetry.
+ifneq ($(MM_RUDDER_WRITE_KEY),)
+GO_BUILD_FLAGS += -ldflags '-X "github.com/mattermost/mattermost-plugin-autolink/server/autolinkplugin.rudderWriteKey=$(MM_RUDDER_WRITE_KEY)"'
+endif
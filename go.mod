@@ -3,6 +3,7 @@ module github.com/mattermost/mattermost-plugin-autolink
 go 1.12
 
 require (
+	github.com/dlclark/regexp2 v1.4.0
 	github.com/gorilla/mux v1.8.0
 	github.com/mattermost/mattermost-server/v6 v6.0.3
 	github.com/mholt/archiver/v3 v3.5.0
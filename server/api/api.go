@@ -1,13 +1,21 @@
 package api
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/mattermost/mattermost-server/v6/model"
 	"github.com/pkg/errors"
 
 	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+	"github.com/mattermost/mattermost-plugin-autolink/server/importer"
 )
 
 type Store interface {
@@ -15,26 +23,195 @@ type Store interface {
 	SaveLinks([]autolink.Autolink) error
 }
 
+// Linter checks links for likely configuration mistakes. Stores implementing it
+// are used by the lint endpoint, autolink.Lint otherwise.
+type Linter interface {
+	LintLinks([]autolink.Autolink) []autolink.LintIssue
+}
+
+// StatusReporter reports the health of the links. Stores implementing it are
+// used by the status endpoint, which otherwise only reports compile errors.
+type StatusReporter interface {
+	Status() Status
+}
+
+// Status is the health of the plugin and of each link, in the order of the
+// links returned by the store.
+type Status struct {
+	ConfigError        string       `json:"config_error,omitempty"`
+	ScopeFailures      int          `json:"scope_failures"`
+	LastScopeFailure   string       `json:"last_scope_failure,omitempty"`
+	LastScopeFailureAt *time.Time   `json:"last_scope_failure_at,omitempty"`
+	PausedUntil        *time.Time   `json:"paused_until,omitempty"`
+	UnresolvedAdmins   []string     `json:"unresolved_admins,omitempty"`
+	UnresolvedViewers  []string     `json:"unresolved_viewers,omitempty"`
+	Links              []LinkStatus `json:"links"`
+}
+
+// LinkStatus is the health of a single link.
+type LinkStatus struct {
+	Name         string     `json:"name"`
+	Disabled     bool       `json:"disabled"`
+	CompileError string     `json:"compile_error,omitempty"`
+	LastFiredAt  *time.Time `json:"last_fired_at,omitempty"`
+}
+
+// Reloader reads the configuration and the links again and compiles all the
+// links. Stores implementing it are used by the reload endpoint, which
+// otherwise responds with 501.
+type Reloader interface {
+	Reload() (Status, error)
+}
+
+// GitLabImporter converts the issue and merge request references of a GitLab
+// group or project into links. Stores implementing it are used by the GitLab
+// import endpoint, which otherwise responds with 501.
+type GitLabImporter interface {
+	ImportGitLab(target string) ([]autolink.Autolink, error)
+}
+
+// Tester applies the links to text as if it was posted in a channel. Stores
+// implementing it are used by the test endpoint, which otherwise applies the
+// enabled links in their order, ignoring their scopes.
+type Tester interface {
+	TestText(userID, channelID, text string) TestResult
+}
+
+// ChannelReader is implemented by the stores checking the permissions of the
+// users on the channels. The test endpoint then only applies the links in the
+// channels the user can read, since the links may reveal the names of the
+// channel and team.
+type ChannelReader interface {
+	CanReadChannel(userID, channelID string) bool
+}
+
+// TestResult is the text rewritten by the links, and the matches of each link
+// that changed it, in the order the links were applied. Rejection is the
+// explanation of the rejection of the text by a reject link, if any, the text
+// being left as is.
+type TestResult struct {
+	Text      string      `json:"text"`
+	Rejection string      `json:"rejection,omitempty"`
+	Links     []LinkMatch `json:"links"`
+}
+
+// LinkMatch is the text matched by a link.
+type LinkMatch struct {
+	Link    autolink.Autolink `json:"-"`
+	Name    string            `json:"name"`
+	Matches []string          `json:"matches"`
+}
+
+// Actions handles the buttons of the interactive messages and the interactive
+// dialogs of the plugin. Stores implementing it have the button actions served
+// at /api/v1/actions/{action}, and the dialogs submitted at
+// /api/v1/dialogs/{dialog}. They authorize the users themselves.
+type Actions interface {
+	HandleAction(userID, action string, request *model.PostActionIntegrationRequest) *model.PostActionIntegrationResponse
+	HandleDialog(userID, dialog string, request *model.SubmitDialogRequest) *model.SubmitDialogResponse
+}
+
+// MatchMiddlewares registers the match middlewares of other plugins, called
+// for each match of the links before it is replaced. Stores implementing it
+// serve /api/v1/middleware to the plugins.
+type MatchMiddlewares interface {
+	RegisterMatchMiddleware(pluginID, path string) error
+	UnregisterMatchMiddleware(pluginID string) error
+}
+
 type Authorization interface {
 	IsAuthorizedAdmin(userID string) (bool, error)
+	// IsAuthorizedTeamAdmin reports whether the user may manage links scoped
+	// to the given teams by virtue of being their team admin.
+	IsAuthorizedTeamAdmin(userID string, teamNames []string) (bool, error)
+}
+
+// ViewerAuthorization is implemented by the Authorization of the plugins with
+// plugin viewers, who may use the read-only endpoints with all the links, but
+// not change them.
+type ViewerAuthorization interface {
+	IsAuthorizedViewer(userID string) (bool, error)
+}
+
+// readOnlyPosts are the POST endpoints that do not change the links, which
+// plugin viewers may use in addition to the GET endpoints.
+var readOnlyPosts = map[string]bool{
+	"/api/v1/links/validate": true,
+	"/api/v1/simulate":       true,
+	"/api/v1/test":           true,
+}
+
+// Preferences are the per-user settings of the plugin.
+type Preferences interface {
+	IsUserOptedOut(userID string) (bool, error)
+	SetUserOptedOut(userID string, optOut bool) error
 }
 
+type contextKey string
+
+// teamAdminUserIDKey holds the ID of a user that is not a plugin admin, and
+// may only manage links scoped to the teams they administer.
+const teamAdminUserIDKey contextKey = "teamAdminUserID"
+
+// viewerUserIDKey holds the ID of a plugin viewer, who may see all the links
+// but not change them.
+const viewerUserIDKey contextKey = "viewerUserID"
+
 type Handler struct {
 	root          *mux.Router
 	store         Store
 	authorization Authorization
+	preferences   Preferences
+	limiter       *rateLimiter
 }
 
-func NewHandler(store Store, authorization Authorization) *Handler {
+func NewHandler(store Store, authorization Authorization, preferences Preferences) *Handler {
 	h := &Handler{
 		store:         store,
 		authorization: authorization,
+		preferences:   preferences,
+		limiter:       newRateLimiter(),
 	}
 
 	root := mux.NewRouter()
+	root.Use(h.rateLimited)
+
+	// Registered first, the admin routes below catch everything else
+	user := root.PathPrefix("/api/v1/user").Subrouter()
+	user.Use(h.userRequired)
+	user.HandleFunc("/optout", h.getOptOut).Methods("GET")
+	user.HandleFunc("/optout", h.setOptOut).Methods("PUT")
+
+	actions := root.PathPrefix("/api/v1").Subrouter()
+	actions.Use(h.userRequired)
+	actions.HandleFunc("/actions/{action}", h.action).Methods("POST")
+	actions.HandleFunc("/dialogs/{dialog}", h.dialog).Methods("POST")
+
+	ci := root.PathPrefix("/api/v1/ci").Subrouter()
+	ci.Use(h.ciTokenRequired)
+	ci.HandleFunc("/links", h.getCILinks).Methods("GET")
+	ci.HandleFunc("/links", h.publishCILinks).Methods("POST")
+	ci.HandleFunc("/links/{name:.+}", h.deleteCILink).Methods("DELETE")
+
 	api := root.PathPrefix("/api/v1").Subrouter()
 	api.Use(h.adminOrPluginRequired)
 	api.HandleFunc("/link", h.setLink).Methods("POST")
+	api.HandleFunc("/links", h.getLinks).Methods("GET")
+	api.HandleFunc("/links", h.replaceLinks).Methods("PUT")
+	api.HandleFunc("/links/import", h.importLinks).Methods("POST")
+	api.HandleFunc("/links/import/gitlab", h.importGitLab).Methods("POST")
+	api.HandleFunc("/links/validate", h.validateLinks).Methods("POST")
+	api.HandleFunc("/links/{name}", h.getLink).Methods("GET")
+	api.HandleFunc("/links/{name}", h.patchLink).Methods("PATCH")
+	api.HandleFunc("/links/{name}", h.deleteLink).Methods("DELETE")
+	api.HandleFunc("/lint", h.lint).Methods("GET")
+	api.HandleFunc("/middleware", h.registerMiddleware).Methods("PUT")
+	api.HandleFunc("/middleware", h.unregisterMiddleware).Methods("DELETE")
+	api.HandleFunc("/reload", h.reload).Methods("POST")
+	api.HandleFunc("/simulate", h.simulate).Methods("POST")
+	api.HandleFunc("/stats", h.stats).Methods("GET")
+	api.HandleFunc("/status", h.status).Methods("GET")
+	api.HandleFunc("/test", h.test).Methods("POST")
 
 	api.Handle("{anything:.*}", http.NotFoundHandler())
 
@@ -56,6 +233,46 @@ func (h *Handler) handleError(w http.ResponseWriter, err error) {
 	_, _ = w.Write(b)
 }
 
+func (h *Handler) handleErrorWithCode(w http.ResponseWriter, code int, errTitle string, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	b, _ := json.Marshal(struct {
+		Error   string `json:"error"`
+		Details string `json:"details"`
+	}{
+		Error:   errTitle,
+		Details: err.Error(),
+	})
+	_, _ = w.Write(b)
+}
+
+// handleSaveError responds with the structured errors of the links if they
+// are invalid, and as handleError otherwise.
+func (h *Handler) handleSaveError(w http.ResponseWriter, err error) {
+	errs, ok := errors.Cause(err).(autolink.ValidationErrors)
+	if !ok {
+		h.handleError(w, errors.Wrap(err, "unable to save links"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	b, _ := json.Marshal(validationResult{
+		Error:   "Invalid links",
+		Details: errs.Error(),
+		Errors:  errs,
+	})
+	_, _ = w.Write(b)
+}
+
+// validationResult is the response of the validate endpoint, and of the
+// endpoints saving links when they are invalid.
+type validationResult struct {
+	Error   string                    `json:"error,omitempty"`
+	Details string                    `json:"details,omitempty"`
+	Errors  autolink.ValidationErrors `json:"errors"`
+}
+
 func (h *Handler) adminOrPluginRequired(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var err error
@@ -73,6 +290,25 @@ func (h *Handler) adminOrPluginRequired(next http.Handler) http.Handler {
 				http.Error(w, "Not authorized", http.StatusUnauthorized)
 				return
 			}
+			if !authorized && h.isViewer(r, userID) {
+				// Viewers see all the links, and only reach the read-only
+				// endpoints
+				authorized = true
+				r = r.WithContext(context.WithValue(r.Context(), viewerUserIDKey, userID))
+			} else if !authorized {
+				// Team admins are authorized per link, by the link's scope
+				authorized = true
+				r = r.WithContext(context.WithValue(r.Context(), teamAdminUserIDKey, userID))
+			}
+		}
+
+		// Automation without a Mattermost session uses API keys
+		if !authorized && userID == "" && r.Header.Get("Authorization") != "" {
+			keyRequest, ok := h.authenticateAPIKey(w, r)
+			if !ok {
+				return
+			}
+			r, authorized = keyRequest, true
 		}
 
 		if !authorized {
@@ -83,10 +319,87 @@ func (h *Handler) adminOrPluginRequired(next http.Handler) http.Handler {
 	})
 }
 
+// isViewer reports whether the request does not change the links and is made
+// by a plugin viewer.
+func (h *Handler) isViewer(r *http.Request, userID string) bool {
+	viewers, ok := h.authorization.(ViewerAuthorization)
+	if !ok || (r.Method != http.MethodGet && !(r.Method == http.MethodPost && readOnlyPosts[r.URL.Path])) {
+		return false
+	}
+	viewer, err := viewers.IsAuthorizedViewer(userID)
+	return err == nil && viewer
+}
+
+func (h *Handler) userRequired(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Mattermost-User-ID") == "" {
+			http.Error(w, "Not authorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.root.ServeHTTP(w, r)
 }
 
+// canManage reports whether the caller may modify the link. Plugins may only
+// modify links they own, or links that no plugin owns. Team admins may only
+// modify links no plugin owns scoped to the teams they administer, API keys
+// the links no plugin owns of their group if they have one, and plugin admins
+// may modify any link.
+func (h *Handler) canManage(r *http.Request, link autolink.Autolink) (bool, error) {
+	if userID, ok := r.Context().Value(teamAdminUserIDKey).(string); ok {
+		if link.PluginID != "" {
+			return false, nil
+		}
+		return h.authorization.IsAuthorizedTeamAdmin(userID, link.ScopeTeams())
+	}
+	if scope, ok := r.Context().Value(apiKeyScopeKey).(APIKeyScope); ok {
+		return link.PluginID == "" && (scope.Group == "" || link.Group == scope.Group), nil
+	}
+
+	pluginID := r.Header.Get("Mattermost-Plugin-ID")
+	if pluginID == "" {
+		return true, nil
+	}
+	return link.PluginID == "" || link.PluginID == pluginID, nil
+}
+
+// hidesWebhooks reports whether the WebhookURL of the links is hidden from
+// the caller, for only the plugin admins and plugins to know where the events
+// of the links are sent.
+func hidesWebhooks(r *http.Request) bool {
+	_, viewer := r.Context().Value(viewerUserIDKey).(string)
+	_, ci := r.Context().Value(ciNamespaceKey).(string)
+	return viewer || ci || isLimited(r)
+}
+
+// keepWebhookURL checks that a caller the webhooks are hidden from does not
+// change the WebhookURL of the link, previously old. Since they do not see
+// it, an empty WebhookURL keeps the old one.
+func keepWebhookURL(r *http.Request, link *autolink.Autolink, old string) error {
+	if !hidesWebhooks(r) {
+		return nil
+	}
+	if link.WebhookURL == "" {
+		link.WebhookURL = old
+	}
+	if link.WebhookURL != old {
+		return errors.Errorf("only plugin admins may set the WebhookURL of link %q", link.DisplayName())
+	}
+	return nil
+}
+
+func (h *Handler) handleNotAuthorized(w http.ResponseWriter, link autolink.Autolink) {
+	err := errors.Errorf("not authorized to manage link %q", link.DisplayName())
+	if link.PluginID != "" {
+		err = errors.Errorf("link %q is owned by plugin %q", link.DisplayName(), link.PluginID)
+	}
+	h.handleErrorWithCode(w, http.StatusForbidden, "Not authorized", err)
+}
+
 func (h *Handler) setLink(w http.ResponseWriter, r *http.Request) {
 	var newLink autolink.Autolink
 	if err := json.NewDecoder(r.Body).Decode(&newLink); err != nil {
@@ -94,11 +407,34 @@ func (h *Handler) setLink(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	pluginID := r.Header.Get("Mattermost-Plugin-ID")
+	if pluginID != "" {
+		newLink.PluginID = pluginID
+	}
+
+	if ok, err := h.canManage(r, newLink); err != nil || !ok {
+		h.handleErrorWithCode(w, http.StatusForbidden, "Not authorized",
+			errors.Errorf("not authorized to manage link %q", newLink.DisplayName()))
+		return
+	}
+	if errs := autolink.Validate([]autolink.Autolink{newLink}); len(errs) > 0 {
+		h.handleSaveError(w, errs)
+		return
+	}
+
 	links := h.store.GetLinks()
 	found := false
 	changed := false
 	for i := range links {
 		if links[i].Name == newLink.Name || links[i].Pattern == newLink.Pattern {
+			if ok, err := h.canManage(r, links[i]); err != nil || !ok {
+				h.handleNotAuthorized(w, links[i])
+				return
+			}
+			if err := keepWebhookURL(r, &newLink, links[i].WebhookURL); err != nil {
+				h.handleErrorWithCode(w, http.StatusForbidden, "Not authorized", err)
+				return
+			}
 			if !links[i].Equals(newLink) {
 				links[i] = newLink
 				changed = true
@@ -108,13 +444,17 @@ func (h *Handler) setLink(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	if !found {
+		if err := keepWebhookURL(r, &newLink, ""); err != nil {
+			h.handleErrorWithCode(w, http.StatusForbidden, "Not authorized", err)
+			return
+		}
 		links = append(h.store.GetLinks(), newLink)
 		changed = true
 	}
 	status := http.StatusNotModified
 	if changed {
 		if err := h.store.SaveLinks(links); err != nil {
-			h.handleError(w, errors.Wrap(err, "unable to save link"))
+			h.handleSaveError(w, err)
 			return
 		}
 		status = http.StatusOK
@@ -124,3 +464,743 @@ func (h *Handler) setLink(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(status)
 	_, _ = w.Write([]byte(`{"status": "OK"}`))
 }
+
+func (h *Handler) getLinks(w http.ResponseWriter, r *http.Request) {
+	pluginID := r.Header.Get("Mattermost-Plugin-ID")
+
+	// Links can be searched with the q query parameter, as a regular
+	// expression if regex=true
+	var match func(autolink.Autolink) bool
+	if q := r.URL.Query().Get("q"); q != "" {
+		var err error
+		match, err = autolink.SearchFilter(q, r.URL.Query().Get("regex") == "true")
+		if err != nil {
+			h.handleErrorWithCode(w, http.StatusBadRequest, "Invalid search", err)
+			return
+		}
+	}
+	// They can also be filtered, sorted and listed page by page, see
+	// listOptions
+	opts, err := parseListOptions(r.URL.Query())
+	if err != nil {
+		h.handleErrorWithCode(w, http.StatusBadRequest, "Invalid list options", err)
+		return
+	}
+
+	all := h.store.GetLinks()
+	var allLastFired []*time.Time
+	if opts.sort == sortLastHit {
+		allLastFired = h.lastFired(all)
+	}
+	links := []autolink.Autolink{}
+	lastFired := []*time.Time{}
+	for i, link := range all {
+		if pluginID != "" && link.PluginID != pluginID {
+			continue
+		}
+		if match != nil && !match(link) {
+			continue
+		}
+		if !opts.matches(link) {
+			continue
+		}
+		if ok, err := h.canManage(r, link); err != nil || !ok {
+			continue
+		}
+		links = append(links, link)
+		if allLastFired != nil {
+			lastFired = append(lastFired, allLastFired[i])
+		}
+	}
+	opts.sortLinks(links, lastFired)
+	total := len(links)
+	links = opts.paginate(links)
+	if hidesWebhooks(r) {
+		links = autolink.WithoutWebhooks(links)
+	}
+
+	var listed interface{} = links
+	if opts.stats {
+		reporter, ok := h.store.(ActivityReporter)
+		if !ok {
+			h.handleErrorWithCode(w, http.StatusNotImplemented, "Stats not available",
+				errors.New("the usage of the links is not recorded"))
+			return
+		}
+		activity, err := reporter.LinkActivity(links)
+		if err != nil {
+			h.handleError(w, errors.Wrap(err, "unable to get the activity of the links"))
+			return
+		}
+		annotated := make([]linkWithActivity, 0, len(links))
+		for i, link := range links {
+			annotated = append(annotated, linkWithActivity{Autolink: link, Activity: activity[i]})
+		}
+		listed = annotated
+	}
+
+	b, err := json.Marshal(listed)
+	if err != nil {
+		h.handleError(w, errors.Wrap(err, "unable to marshal links"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	_, _ = w.Write(b)
+}
+
+// importLinks adds or updates the links of the CSV body, see
+// importer.ParseCSV for its format.
+func (h *Handler) importLinks(w http.ResponseWriter, r *http.Request) {
+	imported, err := importer.ParseCSV(r.Body)
+	if err != nil {
+		h.handleErrorWithCode(w, http.StatusBadRequest, "Invalid CSV", err)
+		return
+	}
+	if errs := autolink.Validate(imported); len(errs) > 0 {
+		h.handleSaveError(w, errs)
+		return
+	}
+
+	pluginID := r.Header.Get("Mattermost-Plugin-ID")
+	links := h.store.GetLinks()
+	for i := range imported {
+		if pluginID != "" {
+			imported[i].PluginID = pluginID
+		}
+		if ok, err := h.canManage(r, imported[i]); err != nil || !ok {
+			h.handleNotAuthorized(w, imported[i])
+			return
+		}
+		for _, link := range links {
+			if imported[i].Name == "" || link.Name != imported[i].Name {
+				continue
+			}
+			if ok, err := h.canManage(r, link); err != nil || !ok {
+				h.handleNotAuthorized(w, link)
+				return
+			}
+		}
+	}
+
+	links, added, updated := importer.Merge(links, imported)
+	if len(imported) > 0 {
+		if err = h.store.SaveLinks(links); err != nil {
+			h.handleSaveError(w, err)
+			return
+		}
+	}
+
+	b, err := json.Marshal(importResult{Added: added, Updated: updated})
+	if err != nil {
+		h.handleError(w, errors.Wrap(err, "unable to marshal the import result"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
+
+// importGitLab adds or updates the links of the references of the GitLab group
+// or project of the target query parameter. Only plugin admins may import
+// them, as the links are not scoped.
+func (h *Handler) importGitLab(w http.ResponseWriter, r *http.Request) {
+	if isLimited(r) {
+		h.handleErrorWithCode(w, http.StatusForbidden, "Not authorized",
+			errors.New("only plugin admins may import links from GitLab"))
+		return
+	}
+	gitlab, ok := h.store.(GitLabImporter)
+	if !ok {
+		h.handleErrorWithCode(w, http.StatusNotImplemented, "GitLab import not available",
+			errors.New("the links can not be imported from GitLab"))
+		return
+	}
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		h.handleErrorWithCode(w, http.StatusBadRequest, "Invalid GitLab import",
+			errors.New("a GitLab group or project is required as target"))
+		return
+	}
+
+	imported, err := gitlab.ImportGitLab(target)
+	if err != nil {
+		h.handleError(w, errors.Wrap(err, "unable to import from GitLab"))
+		return
+	}
+
+	links, added, updated := importer.Merge(h.store.GetLinks(), imported)
+	if len(imported) > 0 {
+		if err = h.store.SaveLinks(links); err != nil {
+			h.handleSaveError(w, err)
+			return
+		}
+	}
+
+	b, err := json.Marshal(importResult{Added: added, Updated: updated})
+	if err != nil {
+		h.handleError(w, errors.Wrap(err, "unable to marshal the import result"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
+
+type importResult struct {
+	Added   []string `json:"added"`
+	Updated []string `json:"updated"`
+}
+
+// replaceLinks replaces the links that are not owned by a plugin with the
+// links of the JSON body, e.g. to sync the links of another server. Only
+// plugin admins may replace all the links.
+func (h *Handler) replaceLinks(w http.ResponseWriter, r *http.Request) {
+	if isLimited(r) || r.Header.Get("Mattermost-Plugin-ID") != "" {
+		h.handleErrorWithCode(w, http.StatusForbidden, "Not authorized",
+			errors.New("only plugin admins may replace all the links"))
+		return
+	}
+
+	var synced []autolink.Autolink
+	if err := json.NewDecoder(r.Body).Decode(&synced); err != nil {
+		h.handleErrorWithCode(w, http.StatusBadRequest, "Invalid links", errors.Wrap(err, "unable to decode body"))
+		return
+	}
+	if errs := autolink.Validate(synced); len(errs) > 0 {
+		h.handleSaveError(w, errs)
+		return
+	}
+
+	links := h.store.GetLinks()
+	replaced, added, updated, removed := importer.Replace(links, synced)
+	if !importer.Equal(links, replaced) {
+		if err := h.store.SaveLinks(replaced); err != nil {
+			h.handleSaveError(w, err)
+			return
+		}
+	}
+
+	b, err := json.Marshal(replaceResult{Added: added, Updated: updated, Removed: removed})
+	if err != nil {
+		h.handleError(w, errors.Wrap(err, "unable to marshal the replace result"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
+
+type replaceResult struct {
+	Added   []string `json:"added"`
+	Updated []string `json:"updated"`
+	Removed []string `json:"removed"`
+}
+
+// middlewares returns the store of the match middlewares and the ID of the
+// calling plugin, or responds with an error if the caller is not a plugin.
+func (h *Handler) middlewares(w http.ResponseWriter, r *http.Request) (MatchMiddlewares, string, bool) {
+	pluginID := r.Header.Get("Mattermost-Plugin-ID")
+	if pluginID == "" {
+		h.handleErrorWithCode(w, http.StatusForbidden, "Not authorized",
+			errors.New("only plugins may register a match middleware"))
+		return nil, "", false
+	}
+	middlewares, ok := h.store.(MatchMiddlewares)
+	if !ok {
+		http.NotFound(w, r)
+		return nil, "", false
+	}
+	return middlewares, pluginID, true
+}
+
+func (h *Handler) registerMiddleware(w http.ResponseWriter, r *http.Request) {
+	middlewares, pluginID, ok := h.middlewares(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Path string `json:"path"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		h.handleErrorWithCode(w, http.StatusBadRequest, "Invalid middleware", errors.Wrap(err, "unable to decode body"))
+		return
+	}
+	if !strings.HasPrefix(body.Path, "/") {
+		h.handleErrorWithCode(w, http.StatusBadRequest, "Invalid middleware",
+			errors.Errorf("invalid path %q, must start with /", body.Path))
+		return
+	}
+
+	if err := middlewares.RegisterMatchMiddleware(pluginID, body.Path); err != nil {
+		h.handleError(w, errors.Wrap(err, "unable to register the match middleware"))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) unregisterMiddleware(w http.ResponseWriter, r *http.Request) {
+	middlewares, pluginID, ok := h.middlewares(w, r)
+	if !ok {
+		return
+	}
+
+	if err := middlewares.UnregisterMatchMiddleware(pluginID); err != nil {
+		h.handleError(w, errors.Wrap(err, "unable to unregister the match middleware"))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// validateLinks validates the links of the JSON body without saving them, and
+// returns their errors, an empty list if they are all valid.
+func (h *Handler) validateLinks(w http.ResponseWriter, r *http.Request) {
+	var links []autolink.Autolink
+	if err := json.NewDecoder(r.Body).Decode(&links); err != nil {
+		h.handleErrorWithCode(w, http.StatusBadRequest, "Invalid links", errors.Wrap(err, "unable to decode body"))
+		return
+	}
+
+	result := validationResult{Errors: autolink.Validate(links)}
+	if result.Errors == nil {
+		result.Errors = autolink.ValidationErrors{}
+	}
+	b, err := json.Marshal(result)
+	if err != nil {
+		h.handleError(w, errors.Wrap(err, "unable to marshal validation errors"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
+
+func (h *Handler) deleteLink(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	links := h.store.GetLinks()
+	for i := range links {
+		if links[i].Name != name {
+			continue
+		}
+		if ok, err := h.canManage(r, links[i]); err != nil || !ok {
+			h.handleNotAuthorized(w, links[i])
+			return
+		}
+
+		newLinks := append([]autolink.Autolink{}, links[:i]...)
+		newLinks = append(newLinks, links[i+1:]...)
+		if err := h.store.SaveLinks(newLinks); err != nil {
+			h.handleError(w, errors.Wrap(err, "unable to save links"))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status": "OK"}`))
+		return
+	}
+
+	h.handleErrorWithCode(w, http.StatusNotFound, "Not found", errors.Errorf("link %q not found", name))
+}
+
+// linkETag is the entity tag of the current version of a link, for its
+// conditional updates.
+func linkETag(link autolink.Autolink) string {
+	b, _ := json.Marshal(link)
+	sum := sha256.Sum256(b)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// matchesETag reports whether the If-Match header of a request, if any, matches
+// the entity tag of a link.
+func matchesETag(r *http.Request, etag string) bool {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		return true
+	}
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// findLink returns the index of the link named as the request's name
+// variable, responding with an error if it doesn't exist or the caller may
+// not manage it.
+func (h *Handler) findLink(w http.ResponseWriter, r *http.Request, links []autolink.Autolink) (int, bool) {
+	name := mux.Vars(r)["name"]
+	for i := range links {
+		if links[i].Name != name {
+			continue
+		}
+		if ok, err := h.canManage(r, links[i]); err != nil || !ok {
+			h.handleNotAuthorized(w, links[i])
+			return 0, false
+		}
+		return i, true
+	}
+	h.handleErrorWithCode(w, http.StatusNotFound, "Not found", errors.Errorf("link %q not found", name))
+	return 0, false
+}
+
+// writeLink responds with the link and its entity tag.
+func (h *Handler) writeLink(w http.ResponseWriter, r *http.Request, link autolink.Autolink) {
+	etag := linkETag(link)
+	if hidesWebhooks(r) {
+		link.WebhookURL = ""
+	}
+	b, err := json.Marshal(link)
+	if err != nil {
+		h.handleError(w, errors.Wrap(err, "unable to marshal link"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag)
+	_, _ = w.Write(b)
+}
+
+func (h *Handler) getLink(w http.ResponseWriter, r *http.Request) {
+	links := h.store.GetLinks()
+	i, ok := h.findLink(w, r, links)
+	if !ok {
+		return
+	}
+	h.writeLink(w, r, links[i])
+}
+
+// patchLink updates the fields of a link that are in the body, a JSON merge
+// patch, leaving the others as they are. With an If-Match header, the link is
+// only updated if it did not change since its entity tag was read, for
+// concurrent updates not to overwrite each other.
+func (h *Handler) patchLink(w http.ResponseWriter, r *http.Request) {
+	links := h.store.GetLinks()
+	i, ok := h.findLink(w, r, links)
+	if !ok {
+		return
+	}
+	link := links[i]
+	if !matchesETag(r, linkETag(link)) {
+		h.handleErrorWithCode(w, http.StatusPreconditionFailed, "Link changed",
+			errors.Errorf("link %q was changed since it was read", link.DisplayName()))
+		return
+	}
+
+	// The link is copied through JSON for the patch not to modify the fields
+	// it shares with the stored link, e.g. its Attachment
+	var patched autolink.Autolink
+	b, err := json.Marshal(link)
+	if err == nil {
+		err = json.Unmarshal(b, &patched)
+	}
+	if err != nil {
+		h.handleError(w, errors.Wrap(err, "unable to copy link"))
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&patched); err != nil {
+		h.handleErrorWithCode(w, http.StatusBadRequest, "Invalid patch", err)
+		return
+	}
+	patched.PluginID = link.PluginID
+	if err = keepWebhookURL(r, &patched, link.WebhookURL); err != nil {
+		h.handleErrorWithCode(w, http.StatusForbidden, "Not authorized", err)
+		return
+	}
+
+	if ok, err := h.canManage(r, patched); err != nil || !ok {
+		h.handleErrorWithCode(w, http.StatusForbidden, "Not authorized",
+			errors.Errorf("not authorized to manage link %q", patched.DisplayName()))
+		return
+	}
+	if patched.Name != link.Name {
+		for j := range links {
+			if links[j].Name == patched.Name {
+				h.handleErrorWithCode(w, http.StatusConflict, "Name taken",
+					errors.Errorf("link %q already exists", patched.Name))
+				return
+			}
+		}
+	}
+	if errs := autolink.Validate([]autolink.Autolink{patched}); len(errs) > 0 {
+		h.handleSaveError(w, errs)
+		return
+	}
+
+	if !patched.Equals(link) {
+		newLinks := append([]autolink.Autolink{}, links...)
+		newLinks[i] = patched
+		if err := h.store.SaveLinks(newLinks); err != nil {
+			h.handleSaveError(w, err)
+			return
+		}
+	}
+	h.writeLink(w, r, patched)
+}
+
+func (h *Handler) lint(w http.ResponseWriter, r *http.Request) {
+	links := []autolink.Autolink{}
+	for _, link := range h.store.GetLinks() {
+		if ok, err := h.canManage(r, link); err != nil || !ok {
+			continue
+		}
+		links = append(links, link)
+	}
+
+	var issues []autolink.LintIssue
+	if linter, ok := h.store.(Linter); ok {
+		issues = linter.LintLinks(links)
+	} else {
+		issues = autolink.Lint(links)
+	}
+
+	b, err := json.Marshal(issues)
+	if err != nil {
+		h.handleError(w, errors.Wrap(err, "unable to marshal lint issues"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
+
+// reload reads the configuration and the links again and compiles all the
+// links, on every server, and responds with the status of the links. Only
+// plugin admins may reload the configuration of everyone.
+func (h *Handler) reload(w http.ResponseWriter, r *http.Request) {
+	if isLimited(r) {
+		h.handleErrorWithCode(w, http.StatusForbidden, "Not authorized",
+			errors.New("only plugin admins may reload the configuration"))
+		return
+	}
+	reloader, ok := h.store.(Reloader)
+	if !ok {
+		h.handleErrorWithCode(w, http.StatusNotImplemented, "Reload not available",
+			errors.New("the configuration can not be reloaded"))
+		return
+	}
+
+	status, err := reloader.Reload()
+	if err != nil {
+		h.handleError(w, errors.Wrap(err, "unable to reload the configuration"))
+		return
+	}
+	if status.Links == nil {
+		status.Links = []LinkStatus{}
+	}
+
+	b, err := json.Marshal(status)
+	if err != nil {
+		h.handleError(w, errors.Wrap(err, "unable to marshal status"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
+
+func (h *Handler) status(w http.ResponseWriter, r *http.Request) {
+	var status Status
+	if reporter, ok := h.store.(StatusReporter); ok {
+		status = reporter.Status()
+	} else {
+		for _, link := range h.store.GetLinks() {
+			linkStatus := LinkStatus{Name: link.DisplayName(), Disabled: link.Disabled}
+			if err := link.Compile(); err != nil {
+				linkStatus.CompileError = err.Error()
+			}
+			status.Links = append(status.Links, linkStatus)
+		}
+	}
+
+	// Team admins and API keys only see the links they manage, and not the
+	// plugin health. The links can also be filtered by tag.
+	limited := isLimited(r)
+	tag := r.URL.Query().Get("tag")
+	if limited || tag != "" {
+		links := h.store.GetLinks()
+		kept := []LinkStatus{}
+		for i, linkStatus := range status.Links {
+			if i >= len(links) {
+				break
+			}
+			if tag != "" && !links[i].HasTag(tag) {
+				continue
+			}
+			if ok, err := h.canManage(r, links[i]); err != nil || !ok {
+				continue
+			}
+			kept = append(kept, linkStatus)
+		}
+		status.Links = kept
+		if limited {
+			status = Status{Links: kept}
+		}
+	}
+	if status.Links == nil {
+		status.Links = []LinkStatus{}
+	}
+
+	b, err := json.Marshal(status)
+	if err != nil {
+		h.handleError(w, errors.Wrap(err, "unable to marshal status"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
+
+// test applies the links to the text of the JSON body, as if it was posted in
+// its channel, and returns the text rewritten with the matches of each link.
+// Team admins and API keys only see the matches of the links they manage.
+func (h *Handler) test(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Text      string `json:"text"`
+		ChannelID string `json:"channel_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		h.handleErrorWithCode(w, http.StatusBadRequest, "Invalid text", errors.Wrap(err, "unable to decode body"))
+		return
+	}
+	if body.ChannelID == "" {
+		h.handleErrorWithCode(w, http.StatusBadRequest, "Invalid text", errors.New("channel_id is required"))
+		return
+	}
+	userID := r.Header.Get("Mattermost-User-ID")
+	if reader, ok := h.store.(ChannelReader); ok && userID != "" && !reader.CanReadChannel(userID, body.ChannelID) {
+		h.handleErrorWithCode(w, http.StatusForbidden, "Not authorized",
+			errors.Errorf("not authorized to read channel %q", body.ChannelID))
+		return
+	}
+
+	var result TestResult
+	if tester, ok := h.store.(Tester); ok {
+		result = tester.TestText(userID, body.ChannelID, body.Text)
+	} else {
+		result.Text = body.Text
+		for _, link := range h.store.GetLinks() {
+			if link.Disabled || link.Compile() != nil {
+				continue
+			}
+			if matches := link.Matches(result.Text); len(matches) > 0 {
+				result.Text = link.Replace(result.Text)
+				result.Links = append(result.Links, LinkMatch{Link: link, Name: link.DisplayName(), Matches: matches})
+			}
+		}
+	}
+
+	links := []LinkMatch{}
+	for _, match := range result.Links {
+		if isLimited(r) {
+			if ok, err := h.canManage(r, match.Link); err != nil || !ok {
+				continue
+			}
+		}
+		links = append(links, match)
+	}
+	result.Links = links
+
+	b, err := json.Marshal(result)
+	if err != nil {
+		h.handleError(w, errors.Wrap(err, "unable to marshal test result"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
+
+type optOut struct {
+	OptOut bool `json:"optout"`
+}
+
+func (h *Handler) getOptOut(w http.ResponseWriter, r *http.Request) {
+	optedOut, err := h.preferences.IsUserOptedOut(r.Header.Get("Mattermost-User-ID"))
+	if err != nil {
+		h.handleError(w, errors.Wrap(err, "unable to get opt-out preference"))
+		return
+	}
+
+	b, err := json.Marshal(optOut{OptOut: optedOut})
+	if err != nil {
+		h.handleError(w, errors.Wrap(err, "unable to marshal opt-out preference"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
+
+func (h *Handler) setOptOut(w http.ResponseWriter, r *http.Request) {
+	var pref optOut
+	if err := json.NewDecoder(r.Body).Decode(&pref); err != nil {
+		h.handleErrorWithCode(w, http.StatusBadRequest, "Invalid request", errors.Wrap(err, "unable to decode body"))
+		return
+	}
+
+	if err := h.preferences.SetUserOptedOut(r.Header.Get("Mattermost-User-ID"), pref.OptOut); err != nil {
+		h.handleError(w, errors.Wrap(err, "unable to save opt-out preference"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(`{"status": "OK"}`))
+}
+
+func (h *Handler) action(w http.ResponseWriter, r *http.Request) {
+	actions, ok := h.store.(Actions)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	var request model.PostActionIntegrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		h.handleErrorWithCode(w, http.StatusBadRequest, "Invalid request", errors.Wrap(err, "unable to decode body"))
+		return
+	}
+
+	response := actions.HandleAction(r.Header.Get("Mattermost-User-ID"), mux.Vars(r)["action"], &request)
+	if response == nil {
+		response = &model.PostActionIntegrationResponse{}
+	}
+	b, err := json.Marshal(response)
+	if err != nil {
+		h.handleError(w, errors.Wrap(err, "unable to marshal the action response"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
+
+func (h *Handler) dialog(w http.ResponseWriter, r *http.Request) {
+	actions, ok := h.store.(Actions)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	var request model.SubmitDialogRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		h.handleErrorWithCode(w, http.StatusBadRequest, "Invalid request", errors.Wrap(err, "unable to decode body"))
+		return
+	}
+
+	// An empty response closes the dialog
+	response := actions.HandleDialog(r.Header.Get("Mattermost-User-ID"), mux.Vars(r)["dialog"], &request)
+	if response == nil {
+		return
+	}
+	b, err := json.Marshal(response)
+	if err != nil {
+		h.handleError(w, errors.Wrap(err, "unable to marshal the dialog response"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
@@ -3,10 +3,15 @@ package api
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
 
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 
 	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
@@ -18,6 +23,40 @@ func (authorizeAll) IsAuthorizedAdmin(string) (bool, error) {
 	return true, nil
 }
 
+func (authorizeAll) IsAuthorizedTeamAdmin(string, []string) (bool, error) {
+	return true, nil
+}
+
+// authorizeTeamAdmin authorizes a user that is not a plugin admin, but is a
+// team admin of the listed teams.
+type authorizeTeamAdmin map[string]bool
+
+func (authorizeTeamAdmin) IsAuthorizedAdmin(string) (bool, error) {
+	return false, nil
+}
+
+func (a authorizeTeamAdmin) IsAuthorizedTeamAdmin(_ string, teamNames []string) (bool, error) {
+	if len(teamNames) == 0 {
+		return false, nil
+	}
+	for _, team := range teamNames {
+		if !a[team] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// authorizeViewer authorizes a plugin viewer that is neither a plugin admin nor
+// a team admin.
+type authorizeViewer struct {
+	authorizeTeamAdmin
+}
+
+func (authorizeViewer) IsAuthorizedViewer(string) (bool, error) {
+	return true, nil
+}
+
 type linkStore struct {
 	prev       []autolink.Autolink
 	saveCalled *bool
@@ -34,6 +73,18 @@ func (s *linkStore) SaveLinks(links []autolink.Autolink) error {
 	return nil
 }
 
+// optOuts are the users who opted out, by ID
+type optOuts map[string]bool
+
+func (o optOuts) IsUserOptedOut(userID string) (bool, error) {
+	return o[userID], nil
+}
+
+func (o optOuts) SetUserOptedOut(userID string, optOut bool) error {
+	o[userID] = optOut
+	return nil
+}
+
 func TestSetLink(t *testing.T) {
 	for _, tc := range []struct {
 		name             string
@@ -52,7 +103,8 @@ func TestSetLink(t *testing.T) {
 			expectStatus:     http.StatusOK,
 			expectSaveCalled: true,
 			expectSaved: []autolink.Autolink{{
-				Name: "test",
+				Name:     "test",
+				PluginID: "testfrom",
 			}},
 		},
 		{
@@ -77,6 +129,7 @@ func TestSetLink(t *testing.T) {
 				Name:     "test1",
 				Pattern:  ".*1",
 				Template: "test1",
+				PluginID: "testfrom",
 			}},
 		}, {
 			name: "replace link",
@@ -108,6 +161,7 @@ func TestSetLink(t *testing.T) {
 				Name:     "test2",
 				Pattern:  ".*2",
 				Template: "new template",
+				PluginID: "testfrom",
 			}, {
 				Name:     "test3",
 				Pattern:  ".*3",
@@ -129,10 +183,27 @@ func TestSetLink(t *testing.T) {
 				Name:     "test2",
 				Pattern:  ".*2",
 				Template: "test2",
+				PluginID: "testfrom",
 			}},
 			expectStatus:     http.StatusNotModified,
 			expectSaveCalled: false,
 		},
+		{
+			name: "link owned by another plugin",
+			link: autolink.Autolink{
+				Name:     "test1",
+				Pattern:  ".*1",
+				Template: "new template",
+			},
+			prevLinks: []autolink.Autolink{{
+				Name:     "test1",
+				Pattern:  ".*1",
+				Template: "test1",
+				PluginID: "otherplugin",
+			}},
+			expectStatus:     http.StatusForbidden,
+			expectSaveCalled: false,
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			var saved []autolink.Autolink
@@ -145,6 +216,7 @@ func TestSetLink(t *testing.T) {
 					saved:      &saved,
 				},
 				authorizeAll{},
+				nil,
 			)
 
 			body, err := json.Marshal(tc.link)
@@ -168,3 +240,1723 @@ func TestSetLink(t *testing.T) {
 		})
 	}
 }
+
+func TestDeleteLink(t *testing.T) {
+	prevLinks := []autolink.Autolink{{
+		Name:     "own",
+		PluginID: "testfrom",
+	}, {
+		Name:     "other",
+		PluginID: "otherplugin",
+	}, {
+		Name: "unowned",
+	}}
+
+	for _, tc := range []struct {
+		name             string
+		linkName         string
+		pluginID         string
+		expectStatus     int
+		expectSaveCalled bool
+		expectSaved      []autolink.Autolink
+	}{
+		{
+			name:             "own link",
+			linkName:         "own",
+			pluginID:         "testfrom",
+			expectStatus:     http.StatusOK,
+			expectSaveCalled: true,
+			expectSaved:      prevLinks[1:],
+		},
+		{
+			name:         "link owned by another plugin",
+			linkName:     "other",
+			pluginID:     "testfrom",
+			expectStatus: http.StatusForbidden,
+		},
+		{
+			name:             "admin can delete any link",
+			linkName:         "other",
+			expectStatus:     http.StatusOK,
+			expectSaveCalled: true,
+			expectSaved:      []autolink.Autolink{prevLinks[0], prevLinks[2]},
+		},
+		{
+			name:         "not found",
+			linkName:     "missing",
+			pluginID:     "testfrom",
+			expectStatus: http.StatusNotFound,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var saved []autolink.Autolink
+			var saveCalled bool
+
+			h := NewHandler(
+				&linkStore{
+					prev:       prevLinks,
+					saveCalled: &saveCalled,
+					saved:      &saved,
+				},
+				authorizeAll{},
+				nil,
+			)
+
+			w := httptest.NewRecorder()
+			r, err := http.NewRequest("DELETE", "/api/v1/links/"+tc.linkName, nil)
+			require.NoError(t, err)
+			if tc.pluginID != "" {
+				r.Header.Set("Mattermost-Plugin-ID", tc.pluginID)
+			}
+			r.Header.Set("Mattermost-User-ID", "testuser")
+
+			h.ServeHTTP(w, r)
+			require.Equal(t, tc.expectStatus, w.Code)
+			require.Equal(t, tc.expectSaveCalled, saveCalled)
+			require.Equal(t, tc.expectSaved, saved)
+		})
+	}
+}
+
+func TestPatchLink(t *testing.T) {
+	prevLinks := []autolink.Autolink{{
+		Name:     "own",
+		Pattern:  "a",
+		Template: "b",
+		PluginID: "testfrom",
+	}, {
+		Name:     "other",
+		Pattern:  "c",
+		Template: "d",
+		PluginID: "otherplugin",
+	}}
+	etag := linkETag(prevLinks[0])
+
+	for _, tc := range []struct {
+		name         string
+		linkName     string
+		pluginID     string
+		ifMatch      string
+		body         string
+		expectStatus int
+		expectSaved  []autolink.Autolink
+	}{
+		{
+			name:         "single field",
+			linkName:     "own",
+			pluginID:     "testfrom",
+			body:         `{"Template": "e"}`,
+			expectStatus: http.StatusOK,
+			expectSaved: []autolink.Autolink{
+				{Name: "own", Pattern: "a", Template: "e", PluginID: "testfrom"},
+				prevLinks[1],
+			},
+		},
+		{
+			name:         "matching entity tag",
+			linkName:     "own",
+			ifMatch:      etag,
+			body:         `{"Disabled": true}`,
+			expectStatus: http.StatusOK,
+			expectSaved: []autolink.Autolink{
+				{Name: "own", Disabled: true, Pattern: "a", Template: "b", PluginID: "testfrom"},
+				prevLinks[1],
+			},
+		},
+		{
+			name:         "changed since read",
+			linkName:     "own",
+			ifMatch:      `"stale"`,
+			body:         `{"Disabled": true}`,
+			expectStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name:         "owner is kept",
+			linkName:     "own",
+			body:         `{"PluginID": "otherplugin"}`,
+			expectStatus: http.StatusOK,
+		},
+		{
+			name:         "unknown field",
+			linkName:     "own",
+			body:         `{"Templat": "e"}`,
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			name:         "invalid link",
+			linkName:     "own",
+			body:         `{"Pattern": "("}`,
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			name:         "name taken",
+			linkName:     "own",
+			body:         `{"Name": "other"}`,
+			expectStatus: http.StatusConflict,
+		},
+		{
+			name:         "link owned by another plugin",
+			linkName:     "other",
+			pluginID:     "testfrom",
+			body:         `{"Disabled": true}`,
+			expectStatus: http.StatusForbidden,
+		},
+		{
+			name:         "not found",
+			linkName:     "missing",
+			body:         `{"Disabled": true}`,
+			expectStatus: http.StatusNotFound,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var saved []autolink.Autolink
+			var saveCalled bool
+
+			h := NewHandler(
+				&linkStore{
+					prev:       prevLinks,
+					saveCalled: &saveCalled,
+					saved:      &saved,
+				},
+				authorizeAll{},
+				nil,
+			)
+
+			w := httptest.NewRecorder()
+			r, err := http.NewRequest("PATCH", "/api/v1/links/"+tc.linkName, bytes.NewBufferString(tc.body))
+			require.NoError(t, err)
+			if tc.pluginID != "" {
+				r.Header.Set("Mattermost-Plugin-ID", tc.pluginID)
+			}
+			if tc.ifMatch != "" {
+				r.Header.Set("If-Match", tc.ifMatch)
+			}
+			r.Header.Set("Mattermost-User-ID", "testuser")
+
+			h.ServeHTTP(w, r)
+			require.Equal(t, tc.expectStatus, w.Code, w.Body.String())
+			require.Equal(t, tc.expectSaved, saved)
+			if w.Code == http.StatusOK {
+				var link autolink.Autolink
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &link))
+				require.Equal(t, "testfrom", link.PluginID)
+				require.Equal(t, linkETag(link), w.Header().Get("ETag"))
+			}
+		})
+	}
+
+	t.Run("get", func(t *testing.T) {
+		h := NewHandler(&linkStore{prev: prevLinks}, authorizeAll{}, nil)
+
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest("GET", "/api/v1/links/own", nil)
+		require.NoError(t, err)
+		r.Header.Set("Mattermost-User-ID", "testuser")
+
+		h.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, etag, w.Header().Get("ETag"))
+	})
+}
+
+func TestGetLinks(t *testing.T) {
+	h := NewHandler(
+		&linkStore{
+			prev: []autolink.Autolink{{
+				Name:     "own",
+				PluginID: "testfrom",
+			}, {
+				Name: "unowned",
+			}},
+		},
+		authorizeAll{},
+		nil,
+	)
+
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/api/v1/links", nil)
+	require.NoError(t, err)
+	r.Header.Set("Mattermost-Plugin-ID", "testfrom")
+
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var links []autolink.Autolink
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&links))
+	require.Equal(t, []autolink.Autolink{{Name: "own", PluginID: "testfrom"}}, links)
+}
+
+func TestSearchLinks(t *testing.T) {
+	h := NewHandler(
+		&linkStore{
+			prev: []autolink.Autolink{{
+				Name:     "jira",
+				Pattern:  `MM-\d+`,
+				Template: "https://jira.example.com/browse/$0",
+			}, {
+				Name:        "github",
+				Pattern:     `#\d+`,
+				Template:    "https://github.com/mattermost/mattermost-server/issues/$0",
+				Scope:       []string{"dev"},
+				Description: "Server issues",
+				Owner:       "@platform-team",
+			}},
+		},
+		authorizeAll{},
+		nil,
+	)
+
+	for _, tc := range []struct {
+		query        string
+		expectedCode int
+		expected     []string
+	}{
+		{query: "q=JIRA", expectedCode: http.StatusOK, expected: []string{"jira"}},
+		{query: "q=dev", expectedCode: http.StatusOK, expected: []string{"github"}},
+		{query: "q=example", expectedCode: http.StatusOK, expected: []string{"jira"}},
+		{query: "q=platform", expectedCode: http.StatusOK, expected: []string{"github"}},
+		{query: "q=server+issues", expectedCode: http.StatusOK, expected: []string{"github"}},
+		{query: "q=" + url.QueryEscape(`^#`) + "&regex=true", expectedCode: http.StatusOK, expected: []string{"github"}},
+		{query: "q=" + url.QueryEscape(`^#`), expectedCode: http.StatusOK, expected: []string{}},
+		{query: "q=" + url.QueryEscape(`(`) + "&regex=true", expectedCode: http.StatusBadRequest},
+	} {
+		t.Run(tc.query, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r, err := http.NewRequest("GET", "/api/v1/links?"+tc.query, nil)
+			require.NoError(t, err)
+			r.Header.Set("Mattermost-User-ID", "admin")
+
+			h.ServeHTTP(w, r)
+			require.Equal(t, tc.expectedCode, w.Code)
+			if tc.expectedCode != http.StatusOK {
+				return
+			}
+
+			var links []autolink.Autolink
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&links))
+			names := []string{}
+			for _, link := range links {
+				names = append(names, link.Name)
+			}
+			require.Equal(t, tc.expected, names)
+		})
+	}
+}
+
+// statusStore reports when its links last matched.
+type statusStore struct {
+	linkStore
+	lastFired map[string]time.Time
+}
+
+func (s *statusStore) Status() Status {
+	status := Status{}
+	for _, link := range s.prev {
+		linkStatus := LinkStatus{Name: link.DisplayName()}
+		if at, ok := s.lastFired[link.Name]; ok {
+			linkStatus.LastFiredAt = &at
+		}
+		status.Links = append(status.Links, linkStatus)
+	}
+	return status
+}
+
+func TestListLinks(t *testing.T) {
+	now := time.Now()
+	h := NewHandler(
+		&statusStore{
+			linkStore: linkStore{
+				prev: []autolink.Autolink{
+					{Name: "jira", Group: "tickets", Scope: []string{"dev/town-square"}},
+					{Name: "Github", Scope: []string{"dev"}, Tags: []string{"code"}},
+					{Name: "zendesk", Group: "tickets", Disabled: true, Tags: []string{"code", "deprecated"}},
+					{Name: "docs", Scope: []string{"support/help"}},
+				},
+			},
+			lastFired: map[string]time.Time{
+				"jira":    now.Add(-time.Hour),
+				"zendesk": now,
+			},
+		},
+		authorizeAll{},
+		nil,
+	)
+
+	for _, tc := range []struct {
+		query         string
+		expectedCode  int
+		expected      []string
+		expectedTotal string
+	}{
+		{query: "", expectedCode: http.StatusOK, expected: []string{"jira", "Github", "zendesk", "docs"}, expectedTotal: "4"},
+		{query: "sort=name", expectedCode: http.StatusOK, expected: []string{"docs", "Github", "jira", "zendesk"}, expectedTotal: "4"},
+		{query: "sort=last-hit", expectedCode: http.StatusOK, expected: []string{"zendesk", "jira", "Github", "docs"}, expectedTotal: "4"},
+		{query: "sort=created&per_page=3", expectedCode: http.StatusOK, expected: []string{"jira", "Github", "zendesk"}, expectedTotal: "4"},
+		{query: "page=1&per_page=3", expectedCode: http.StatusOK, expected: []string{"docs"}, expectedTotal: "4"},
+		{query: "page=2&per_page=3", expectedCode: http.StatusOK, expected: []string{}, expectedTotal: "4"},
+		{query: "page=153722867280912931&per_page=60", expectedCode: http.StatusOK, expected: []string{}, expectedTotal: "4"},
+		{query: "enabled=false", expectedCode: http.StatusOK, expected: []string{"zendesk"}, expectedTotal: "1"},
+		{query: "enabled=true&group=tickets", expectedCode: http.StatusOK, expected: []string{"jira"}, expectedTotal: "1"},
+		{query: "tag=code", expectedCode: http.StatusOK, expected: []string{"Github", "zendesk"}, expectedTotal: "2"},
+		{query: "tag=deprecated&group=tickets", expectedCode: http.StatusOK, expected: []string{"zendesk"}, expectedTotal: "1"},
+		{query: "scope=dev", expectedCode: http.StatusOK, expected: []string{"jira", "Github"}, expectedTotal: "2"},
+		{query: "scope=support/help&q=docs", expectedCode: http.StatusOK, expected: []string{"docs"}, expectedTotal: "1"},
+		{query: "sort=size", expectedCode: http.StatusBadRequest},
+		{query: "page=-1", expectedCode: http.StatusBadRequest},
+		{query: "per_page=0", expectedCode: http.StatusBadRequest},
+		{query: "enabled=maybe", expectedCode: http.StatusBadRequest},
+	} {
+		t.Run(tc.query, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r, err := http.NewRequest("GET", "/api/v1/links?"+tc.query, nil)
+			require.NoError(t, err)
+			r.Header.Set("Mattermost-User-ID", "admin")
+
+			h.ServeHTTP(w, r)
+			require.Equal(t, tc.expectedCode, w.Code)
+			if tc.expectedCode != http.StatusOK {
+				return
+			}
+
+			var links []autolink.Autolink
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&links))
+			names := []string{}
+			for _, link := range links {
+				names = append(names, link.Name)
+			}
+			require.Equal(t, tc.expected, names)
+			require.Equal(t, tc.expectedTotal, w.Header().Get("X-Total-Count"))
+		})
+	}
+}
+
+func TestTeamAdminAuthorization(t *testing.T) {
+	prevLinks := []autolink.Autolink{{
+		Name:    "team1",
+		Pattern: "team1",
+		Scope:   []string{"team1/town-square"},
+	}, {
+		Name:    "team2",
+		Pattern: "team2",
+		Scope:   []string{"team1", "team2"},
+	}, {
+		Name:    "global",
+		Pattern: "global",
+	}, {
+		Name:     "plugin",
+		Pattern:  "plugin",
+		Scope:    []string{"team1"},
+		PluginID: "other",
+	}}
+
+	newHandler := func(saved *[]autolink.Autolink, saveCalled *bool) *Handler {
+		return NewHandler(
+			&linkStore{
+				prev:       append([]autolink.Autolink{}, prevLinks...),
+				saveCalled: saveCalled,
+				saved:      saved,
+			},
+			authorizeTeamAdmin{"team1": true},
+			nil,
+		)
+	}
+
+	t.Run("list only links scoped to administered teams", func(t *testing.T) {
+		h := newHandler(nil, nil)
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest("GET", "/api/v1/links", nil)
+		require.NoError(t, err)
+		r.Header.Set("Mattermost-User-ID", "teamadmin")
+
+		h.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var links []autolink.Autolink
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&links))
+		require.Equal(t, prevLinks[:1], links)
+	})
+
+	for _, tc := range []struct {
+		name         string
+		link         autolink.Autolink
+		expectStatus int
+	}{
+		{
+			name:         "update link scoped to team",
+			link:         autolink.Autolink{Name: "team1", Pattern: "team1", Template: "new", Scope: []string{"team1"}},
+			expectStatus: http.StatusOK,
+		},
+		{
+			name:         "add link scoped to team",
+			link:         autolink.Autolink{Name: "new", Pattern: "new", Scope: []string{"team1/off-topic"}},
+			expectStatus: http.StatusOK,
+		},
+		{
+			name:         "rescope link to another team",
+			link:         autolink.Autolink{Name: "team1", Pattern: "team1", Scope: []string{"team2"}},
+			expectStatus: http.StatusForbidden,
+		},
+		{
+			name:         "update link scoped to other teams too",
+			link:         autolink.Autolink{Name: "team2", Pattern: "team2", Scope: []string{"team1"}},
+			expectStatus: http.StatusForbidden,
+		},
+		{
+			name:         "add global link",
+			link:         autolink.Autolink{Name: "new", Pattern: "new"},
+			expectStatus: http.StatusForbidden,
+		},
+		{
+			name:         "update link owned by a plugin",
+			link:         autolink.Autolink{Name: "plugin", Pattern: "plugin", Template: "new", Scope: []string{"team1"}},
+			expectStatus: http.StatusForbidden,
+		},
+		{
+			name:         "add link owned by a plugin",
+			link:         autolink.Autolink{Name: "new", Pattern: "new", Scope: []string{"team1"}, PluginID: "other"},
+			expectStatus: http.StatusForbidden,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var saved []autolink.Autolink
+			var saveCalled bool
+			h := newHandler(&saved, &saveCalled)
+
+			body, err := json.Marshal(tc.link)
+			require.NoError(t, err)
+			w := httptest.NewRecorder()
+			r, err := http.NewRequest("POST", "/api/v1/link", bytes.NewReader(body))
+			require.NoError(t, err)
+			r.Header.Set("Mattermost-User-ID", "teamadmin")
+
+			h.ServeHTTP(w, r)
+			require.Equal(t, tc.expectStatus, w.Code)
+			require.Equal(t, tc.expectStatus == http.StatusOK, saveCalled)
+		})
+	}
+
+	t.Run("delete link scoped to other teams too", func(t *testing.T) {
+		var saveCalled bool
+		h := newHandler(nil, &saveCalled)
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest("DELETE", "/api/v1/links/team2", nil)
+		require.NoError(t, err)
+		r.Header.Set("Mattermost-User-ID", "teamadmin")
+
+		h.ServeHTTP(w, r)
+		require.Equal(t, http.StatusForbidden, w.Code)
+		require.False(t, saveCalled)
+	})
+
+	t.Run("delete link owned by a plugin", func(t *testing.T) {
+		var saveCalled bool
+		h := newHandler(nil, &saveCalled)
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest("DELETE", "/api/v1/links/plugin", nil)
+		require.NoError(t, err)
+		r.Header.Set("Mattermost-User-ID", "teamadmin")
+
+		h.ServeHTTP(w, r)
+		require.Equal(t, http.StatusForbidden, w.Code)
+		require.False(t, saveCalled)
+	})
+}
+
+func TestTeamAdminWebhooks(t *testing.T) {
+	prevLinks := []autolink.Autolink{{
+		Name:       "team1",
+		Pattern:    "team1",
+		Scope:      []string{"team1"},
+		WebhookURL: "https://hooks.example.com/secret",
+	}}
+
+	var saved []autolink.Autolink
+	var saveCalled bool
+	h := NewHandler(
+		&linkStore{
+			prev:       prevLinks,
+			saveCalled: &saveCalled,
+			saved:      &saved,
+		},
+		authorizeTeamAdmin{"team1": true},
+		nil,
+	)
+	request := func(method, url, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest(method, url, bytes.NewReader([]byte(body)))
+		require.NoError(t, err)
+		r.Header.Set("Mattermost-User-ID", "teamadmin")
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := request("GET", "/api/v1/links", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NotContains(t, w.Body.String(), "secret")
+	w = request("GET", "/api/v1/links/team1", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NotContains(t, w.Body.String(), "secret")
+
+	w = request("POST", "/api/v1/link", `{"Name":"team1","Pattern":"team1","Scope":["team1"],"WebhookURL":"https://attacker.example.net/collect"}`)
+	require.Equal(t, http.StatusForbidden, w.Code)
+	w = request("PATCH", "/api/v1/links/team1", `{"WebhookURL":"https://attacker.example.net/collect"}`)
+	require.Equal(t, http.StatusForbidden, w.Code)
+	w = request("POST", "/api/v1/link", `{"Name":"new","Pattern":"new","Scope":["team1"],"WebhookURL":"https://attacker.example.net/collect"}`)
+	require.Equal(t, http.StatusForbidden, w.Code)
+	require.False(t, saveCalled)
+
+	w = request("POST", "/api/v1/link", `{"Name":"team1","Pattern":"team1","Template":"new","Scope":["team1"]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.True(t, saveCalled)
+	require.Equal(t, "https://hooks.example.com/secret", saved[0].WebhookURL, "the hidden webhook is kept")
+}
+
+func TestViewerAuthorization(t *testing.T) {
+	prevLinks := []autolink.Autolink{{
+		Name:    "team1",
+		Pattern: "team1",
+		Scope:   []string{"team1"},
+	}, {
+		Name:    "global",
+		Pattern: "global",
+	}}
+
+	var saved []autolink.Autolink
+	var saveCalled bool
+	h := NewHandler(
+		&linkStore{
+			prev:       prevLinks,
+			saveCalled: &saveCalled,
+			saved:      &saved,
+		},
+		authorizeViewer{},
+		nil,
+	)
+
+	t.Run("list all links", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest("GET", "/api/v1/links", nil)
+		require.NoError(t, err)
+		r.Header.Set("Mattermost-User-ID", "viewer")
+
+		h.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var links []autolink.Autolink
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&links))
+		require.Equal(t, prevLinks, links)
+	})
+
+	t.Run("validate links", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest("POST", "/api/v1/links/validate", bytes.NewReader([]byte(`[{"Name":"new","Pattern":"new"}]`)))
+		require.NoError(t, err)
+		r.Header.Set("Mattermost-User-ID", "viewer")
+
+		h.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("add link", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest("POST", "/api/v1/link", bytes.NewReader([]byte(`{"Name":"new","Pattern":"new","Scope":["team1"]}`)))
+		require.NoError(t, err)
+		r.Header.Set("Mattermost-User-ID", "viewer")
+
+		h.ServeHTTP(w, r)
+		require.Equal(t, http.StatusForbidden, w.Code)
+		require.False(t, saveCalled)
+	})
+
+	t.Run("delete link", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest("DELETE", "/api/v1/links/global", nil)
+		require.NoError(t, err)
+		r.Header.Set("Mattermost-User-ID", "viewer")
+
+		h.ServeHTTP(w, r)
+		require.Equal(t, http.StatusForbidden, w.Code)
+		require.False(t, saveCalled)
+	})
+}
+
+func TestOptOut(t *testing.T) {
+	prefs := optOuts{}
+	h := NewHandler(&linkStore{}, authorizeTeamAdmin{}, prefs)
+
+	getOptOut := func(t *testing.T) bool {
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest("GET", "/api/v1/user/optout", nil)
+		require.NoError(t, err)
+		r.Header.Set("Mattermost-User-ID", "user1")
+		h.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var body struct {
+			OptOut bool `json:"optout"`
+		}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+		return body.OptOut
+	}
+
+	require.False(t, getOptOut(t))
+
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("PUT", "/api/v1/user/optout", bytes.NewBufferString(`{"optout": true}`))
+	require.NoError(t, err)
+	r.Header.Set("Mattermost-User-ID", "user1")
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, optOuts{"user1": true}, prefs)
+	require.True(t, getOptOut(t))
+
+	t.Run("requires a user", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest("GET", "/api/v1/user/optout", nil)
+		require.NoError(t, err)
+		r.Header.Set("Mattermost-Plugin-ID", "testfrom")
+		h.ServeHTTP(w, r)
+		require.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
+
+func TestLint(t *testing.T) {
+	h := NewHandler(
+		&linkStore{
+			prev: []autolink.Autolink{{
+				Name:     "any",
+				Pattern:  `[A-Z]+-\d+`,
+				Template: "x",
+			}, {
+				Name:     "exact",
+				Pattern:  "MM-1",
+				Template: "y",
+			}},
+		},
+		authorizeAll{},
+		nil,
+	)
+
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/api/v1/lint", nil)
+	require.NoError(t, err)
+	r.Header.Set("Mattermost-User-ID", "admin")
+
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var issues []autolink.LintIssue
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&issues))
+	require.Equal(t, []autolink.LintIssue{{
+		Link:    "exact",
+		Kind:    autolink.LintShadowed,
+		Message: `"MM-1" is matched by "any" first`,
+	}}, issues)
+}
+
+func TestStatus(t *testing.T) {
+	store := &linkStore{
+		prev: []autolink.Autolink{{
+			Name:     "valid",
+			Pattern:  `MM-\d+`,
+			Template: "x",
+			Scope:    []string{"team1"},
+		}, {
+			Name:     "invalid",
+			Pattern:  `(`,
+			Template: "y",
+			Scope:    []string{"team2"},
+			Tags:     []string{"jira", "deprecated"},
+		}},
+	}
+
+	for _, tc := range []struct {
+		name          string
+		authorization Authorization
+		query         string
+		expected      []LinkStatus
+	}{
+		{
+			name:          "admin",
+			authorization: authorizeAll{},
+			expected: []LinkStatus{
+				{Name: "valid"},
+				{Name: "invalid", CompileError: "error parsing regexp: missing closing ): `(`"},
+			},
+		},
+		{
+			name:          "team admin",
+			authorization: authorizeTeamAdmin{"team1": true},
+			expected:      []LinkStatus{{Name: "valid"}},
+		},
+		{
+			name:          "tag",
+			authorization: authorizeAll{},
+			query:         "?tag=Deprecated",
+			expected: []LinkStatus{
+				{Name: "invalid", CompileError: "error parsing regexp: missing closing ): `(`"},
+			},
+		},
+		{
+			name:          "team admin and tag",
+			authorization: authorizeTeamAdmin{"team1": true},
+			query:         "?tag=deprecated",
+			expected:      []LinkStatus{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := NewHandler(store, tc.authorization, nil)
+
+			w := httptest.NewRecorder()
+			r, err := http.NewRequest("GET", "/api/v1/status"+tc.query, nil)
+			require.NoError(t, err)
+			r.Header.Set("Mattermost-User-ID", "admin")
+
+			h.ServeHTTP(w, r)
+			require.Equal(t, http.StatusOK, w.Code)
+
+			var status Status
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&status))
+			require.Equal(t, tc.expected, status.Links)
+		})
+	}
+}
+
+type usageStore struct {
+	linkStore
+	from, to time.Time
+}
+
+func (s *usageStore) UsageStats(from, to time.Time) ([]UsageStat, error) {
+	s.from, s.to = from, to
+	return []UsageStat{
+		{Date: "2026-10-01", Link: "jira", ChannelID: "channel1", ChannelName: "town-square", TeamName: "team1", Posts: 3},
+		{Date: "2026-10-02", Link: "docs, wiki", ChannelID: "channel2", Posts: 1},
+	}, nil
+}
+
+func (s *usageStore) LinkActivity(links []autolink.Autolink) ([]LinkActivity, error) {
+	activity := make([]LinkActivity, 0, len(links))
+	for _, link := range links {
+		if link.Name == "jira" {
+			activity = append(activity, LinkActivity{Posts7Days: 1, Posts30Days: 3})
+		} else {
+			activity = append(activity, LinkActivity{})
+		}
+	}
+	return activity, nil
+}
+
+func TestStats(t *testing.T) {
+	store := &usageStore{linkStore: linkStore{
+		prev: []autolink.Autolink{{
+			Name:     "jira",
+			Pattern:  `MM-\d+`,
+			Template: "jira",
+			Scope:    []string{"team1"},
+		}, {
+			Name:     "docs, wiki",
+			Pattern:  "docs",
+			Template: "docs",
+			Scope:    []string{"team2"},
+		}},
+	}}
+
+	get := func(authorization Authorization, query string) *httptest.ResponseRecorder {
+		h := NewHandler(store, authorization, nil)
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest("GET", "/api/v1/stats"+query, nil)
+		require.NoError(t, err)
+		r.Header.Set("Mattermost-User-ID", "admin")
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get(authorizeAll{}, "?from=2026-10-01&to=2026-10-02")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var stats []UsageStat
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&stats))
+	require.Len(t, stats, 2)
+	require.Equal(t, time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), store.from)
+	require.Equal(t, time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC), store.to)
+
+	w = get(authorizeAll{}, "?from=2026-10-01&to=2026-10-02&format=csv")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	require.Equal(t, `attachment; filename="autolink-stats-2026-10-01-2026-10-02.csv"`, w.Header().Get("Content-Disposition"))
+	require.Equal(t, "date,link,channel_id,channel_name,team_name,posts\n"+
+		"2026-10-01,jira,channel1,town-square,team1,3\n"+
+		"2026-10-02,\"docs, wiki\",channel2,,,1\n", w.Body.String())
+
+	w = get(authorizeAll{}, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, time.Now().UTC().Truncate(24*time.Hour), store.to)
+	require.Equal(t, store.to.AddDate(0, 0, 1-defaultStatsDays), store.from)
+
+	w = get(authorizeTeamAdmin{"team1": true}, "?format=json")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&stats))
+	require.Len(t, stats, 1)
+	require.Equal(t, "jira", stats[0].Link)
+
+	for _, query := range []string{
+		"?format=xml",
+		"?from=yesterday",
+		"?from=2026-10-02&to=2026-10-01",
+		"?from=2024-01-01&to=2026-10-01",
+	} {
+		w = get(authorizeAll{}, query)
+		require.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+
+	h := NewHandler(&linkStore{}, authorizeAll{}, nil)
+	w = httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/api/v1/stats", nil)
+	require.NoError(t, err)
+	r.Header.Set("Mattermost-User-ID", "admin")
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusNotImplemented, w.Code)
+
+	h = NewHandler(store, authorizeAll{}, nil)
+	w = httptest.NewRecorder()
+	r, err = http.NewRequest("GET", "/api/v1/links?stats=true&sort=name", nil)
+	require.NoError(t, err)
+	r.Header.Set("Mattermost-User-ID", "admin")
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	var listed []struct {
+		Name     string       `json:"Name"`
+		Activity LinkActivity `json:"activity"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&listed))
+	require.Len(t, listed, 2)
+	require.Equal(t, "docs, wiki", listed[0].Name)
+	require.Equal(t, LinkActivity{}, listed[0].Activity)
+	require.Equal(t, LinkActivity{Posts7Days: 1, Posts30Days: 3}, listed[1].Activity)
+
+	h = NewHandler(&linkStore{}, authorizeAll{}, nil)
+	w = httptest.NewRecorder()
+	r, err = http.NewRequest("GET", "/api/v1/links?stats=true", nil)
+	require.NoError(t, err)
+	r.Header.Set("Mattermost-User-ID", "admin")
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusNotImplemented, w.Code)
+}
+
+func TestTestText(t *testing.T) {
+	store := &linkStore{
+		prev: []autolink.Autolink{{
+			Name:     "jira",
+			Pattern:  `MM-\d+`,
+			Template: "jira",
+			Scope:    []string{"team1"},
+		}, {
+			Name:     "docs",
+			Pattern:  "docs",
+			Template: "[docs](https://docs.example.com)",
+			Scope:    []string{"team2"},
+		}, {
+			Name:     "disabled",
+			Disabled: true,
+			Pattern:  "text",
+			Template: "disabled",
+		}},
+	}
+
+	for _, tc := range []struct {
+		name          string
+		authorization Authorization
+		expected      []LinkMatch
+	}{
+		{
+			name:          "admin",
+			authorization: authorizeAll{},
+			expected: []LinkMatch{
+				{Name: "jira", Matches: []string{"MM-1", "MM-2"}},
+				{Name: "docs", Matches: []string{"docs"}},
+			},
+		},
+		{
+			name:          "team admin",
+			authorization: authorizeTeamAdmin{"team1": true},
+			expected:      []LinkMatch{{Name: "jira", Matches: []string{"MM-1", "MM-2"}}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := NewHandler(store, tc.authorization, nil)
+
+			w := httptest.NewRecorder()
+			r, err := http.NewRequest("POST", "/api/v1/test",
+				bytes.NewReader([]byte(`{"text": "MM-1 and MM-2 in the docs text", "channel_id": "channel"}`)))
+			require.NoError(t, err)
+			r.Header.Set("Mattermost-User-ID", "admin")
+
+			h.ServeHTTP(w, r)
+			require.Equal(t, http.StatusOK, w.Code)
+
+			var result TestResult
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&result))
+			require.Equal(t, "jira and jira in the [docs](https://docs.example.com) text", result.Text)
+			require.Equal(t, tc.expected, result.Links)
+		})
+	}
+
+	t.Run("no channel", func(t *testing.T) {
+		h := NewHandler(store, authorizeAll{}, nil)
+
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest("POST", "/api/v1/test", bytes.NewReader([]byte(`{"text": "MM-1"}`)))
+		require.NoError(t, err)
+		r.Header.Set("Mattermost-User-ID", "admin")
+
+		h.ServeHTTP(w, r)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("channel not readable", func(t *testing.T) {
+		h := NewHandler(channelReaderStore{linkStore: store, readable: "channel"}, authorizeTeamAdmin{"team1": true}, nil)
+
+		for channelID, expected := range map[string]int{"channel": http.StatusOK, "private": http.StatusForbidden} {
+			w := httptest.NewRecorder()
+			r, err := http.NewRequest("POST", "/api/v1/test",
+				bytes.NewReader([]byte(`{"text": "MM-1", "channel_id": "`+channelID+`"}`)))
+			require.NoError(t, err)
+			r.Header.Set("Mattermost-User-ID", "user")
+
+			h.ServeHTTP(w, r)
+			require.Equal(t, expected, w.Code, channelID)
+		}
+	})
+}
+
+// channelReaderStore is a store letting the users read a single channel.
+type channelReaderStore struct {
+	*linkStore
+	readable string
+}
+
+func (s channelReaderStore) CanReadChannel(_, channelID string) bool {
+	return channelID == s.readable
+}
+
+func TestSimulate(t *testing.T) {
+	store := &linkStore{
+		prev: []autolink.Autolink{{
+			Name:     "jira",
+			Pattern:  `MM-\d+`,
+			Template: "jira",
+			Scope:    []string{"team1"},
+		}, {
+			Name:     "docs",
+			Pattern:  "docs",
+			Template: "[docs](https://docs.example.com)",
+			Scope:    []string{"team2"},
+		}, {
+			Name:     "disabled",
+			Disabled: true,
+			Pattern:  "text",
+			Template: "disabled",
+		}},
+	}
+	export := `[{"message": "MM-1 and MM-2"}, {"message": "the docs text"}, {"message": "nothing"}]`
+
+	for _, tc := range []struct {
+		name          string
+		url           string
+		authorization Authorization
+		expected      Simulation
+	}{
+		{
+			name:          "admin",
+			url:           "/api/v1/simulate",
+			authorization: authorizeAll{},
+			expected: Simulation{Posts: 3, Rewritten: 2, Links: []LinkSimulation{
+				{Name: "jira", Posts: 1, Matches: 2},
+				{Name: "docs", Posts: 1, Matches: 1},
+			}},
+		},
+		{
+			name:          "include disabled",
+			url:           "/api/v1/simulate?include_disabled=true",
+			authorization: authorizeAll{},
+			expected: Simulation{Posts: 3, Rewritten: 2, Links: []LinkSimulation{
+				{Name: "jira", Posts: 1, Matches: 2},
+				{Name: "docs", Posts: 1, Matches: 1},
+				{Name: "disabled", Disabled: true, Posts: 1, Matches: 1},
+			}},
+		},
+		{
+			name:          "team admin",
+			url:           "/api/v1/simulate",
+			authorization: authorizeTeamAdmin{"team1": true},
+			expected:      Simulation{Posts: 3, Rewritten: 1, Links: []LinkSimulation{{Name: "jira", Posts: 1, Matches: 2}}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := NewHandler(store, tc.authorization, nil)
+
+			w := httptest.NewRecorder()
+			r, err := http.NewRequest("POST", tc.url, bytes.NewReader([]byte(export)))
+			require.NoError(t, err)
+			r.Header.Set("Mattermost-User-ID", "admin")
+
+			h.ServeHTTP(w, r)
+			require.Equal(t, http.StatusOK, w.Code)
+
+			var result Simulation
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&result))
+			require.Equal(t, tc.expected, result)
+		})
+	}
+
+	t.Run("invalid export", func(t *testing.T) {
+		h := NewHandler(store, authorizeAll{}, nil)
+
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest("POST", "/api/v1/simulate", bytes.NewReader([]byte("a,b\n1,2\n")))
+		require.NoError(t, err)
+		r.Header.Set("Mattermost-User-ID", "admin")
+
+		h.ServeHTTP(w, r)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestImportLinks(t *testing.T) {
+	var saved []autolink.Autolink
+	var saveCalled bool
+	h := NewHandler(
+		&linkStore{
+			prev: []autolink.Autolink{{
+				Name:     "Handbook",
+				Pattern:  "handbook",
+				Template: "old",
+				Disabled: true,
+			}},
+			saveCalled: &saveCalled,
+			saved:      &saved,
+		},
+		authorizeAll{},
+		nil,
+	)
+
+	w := httptest.NewRecorder()
+	body := "term,url\nHandbook,https://kb.example.com/handbook\nSLA,https://kb.example.com/sla\n"
+	r, err := http.NewRequest("POST", "/api/v1/links/import", bytes.NewBufferString(body))
+	require.NoError(t, err)
+	r.Header.Set("Mattermost-User-ID", "admin")
+
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"added": ["SLA"], "updated": ["Handbook"]}`, w.Body.String())
+	require.True(t, saveCalled)
+	require.Len(t, saved, 2)
+	require.Equal(t, "[Handbook](https://kb.example.com/handbook)", saved[0].Template)
+	require.True(t, saved[0].Disabled, "other settings are kept")
+	require.Equal(t, "SLA", saved[1].Name)
+
+	w = httptest.NewRecorder()
+	r, err = http.NewRequest("POST", "/api/v1/links/import", bytes.NewBufferString("name,pattern,template\nbroken,(,x\n"))
+	require.NoError(t, err)
+	r.Header.Set("Mattermost-User-ID", "admin")
+
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestReplaceLinks(t *testing.T) {
+	var saved []autolink.Autolink
+	var saveCalled bool
+	store := &linkStore{
+		prev: []autolink.Autolink{
+			{Name: "jira", Pattern: "MM-1", Template: "old"},
+			{Name: "owned", Pattern: "owned", Template: "owned", PluginID: "com.example.plugin"},
+			{Name: "stale", Pattern: "stale", Template: "stale"},
+		},
+		saveCalled: &saveCalled,
+		saved:      &saved,
+	}
+
+	replace := func(authorization Authorization, header, value, body string) *httptest.ResponseRecorder {
+		h := NewHandler(store, authorization, nil)
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest("PUT", "/api/v1/links", bytes.NewBufferString(body))
+		require.NoError(t, err)
+		r.Header.Set(header, value)
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := replace(authorizeTeamAdmin{"team": true}, "Mattermost-User-ID", "teamadmin", `[]`)
+	require.Equal(t, http.StatusForbidden, w.Code)
+	w = replace(authorizeAll{}, "Mattermost-Plugin-ID", "com.example.plugin", `[]`)
+	require.Equal(t, http.StatusForbidden, w.Code)
+	w = replace(authorizeAll{}, "Mattermost-User-ID", "admin", `[{"Name": "broken", "Pattern": "(", "Template": "x"}]`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.False(t, saveCalled)
+
+	w = replace(authorizeAll{}, "Mattermost-User-ID", "admin",
+		`[{"Name": "jira", "Pattern": "MM-1", "Template": "new"}, {"Name": "docs", "Pattern": "docs", "Template": "docs"}]`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"added": ["docs"], "updated": ["jira"], "removed": ["stale"]}`, w.Body.String())
+	require.True(t, saveCalled)
+	require.Equal(t, []autolink.Autolink{
+		{Name: "jira", Pattern: "MM-1", Template: "new"},
+		{Name: "docs", Pattern: "docs", Template: "docs"},
+		{Name: "owned", Pattern: "owned", Template: "owned", PluginID: "com.example.plugin"},
+	}, saved)
+}
+
+// reloadStore counts the reloads of the configuration.
+type reloadStore struct {
+	linkStore
+	reloads int
+}
+
+func (s *reloadStore) Reload() (Status, error) {
+	s.reloads++
+	return Status{Links: []LinkStatus{{Name: "valid"}, {Name: "invalid", CompileError: "missing closing )"}}}, nil
+}
+
+func TestReload(t *testing.T) {
+	store := &reloadStore{}
+	post := func(store Store, authorization Authorization) *httptest.ResponseRecorder {
+		h := NewHandler(store, authorization, nil)
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest("POST", "/api/v1/reload", nil)
+		require.NoError(t, err)
+		r.Header.Set("Mattermost-User-ID", "admin")
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := post(store, authorizeAll{})
+	require.Equal(t, http.StatusOK, w.Code)
+	var status Status
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&status))
+	require.Equal(t, []LinkStatus{{Name: "valid"}, {Name: "invalid", CompileError: "missing closing )"}}, status.Links)
+	require.Equal(t, 1, store.reloads)
+
+	w = post(store, authorizeTeamAdmin{"team1": true})
+	require.Equal(t, http.StatusForbidden, w.Code)
+	require.Equal(t, 1, store.reloads)
+
+	w = post(&linkStore{}, authorizeAll{})
+	require.Equal(t, http.StatusNotImplemented, w.Code)
+}
+
+// gitlabStore imports the references of the GitLab projects it knows of.
+type gitlabStore struct {
+	linkStore
+	projects map[string][]autolink.Autolink
+}
+
+func (s *gitlabStore) ImportGitLab(target string) ([]autolink.Autolink, error) {
+	links, ok := s.projects[target]
+	if !ok {
+		return nil, errors.Errorf("GitLab API returned 404 for %s", target)
+	}
+	return links, nil
+}
+
+func TestImportGitLab(t *testing.T) {
+	var saved []autolink.Autolink
+	var saveCalled bool
+	store := &gitlabStore{
+		linkStore: linkStore{
+			prev:       []autolink.Autolink{{Name: "GitLab org/app issues", Pattern: "old", Template: "old"}},
+			saveCalled: &saveCalled,
+			saved:      &saved,
+		},
+		projects: map[string][]autolink.Autolink{"org/app": {
+			{Name: "GitLab org/app issues", Pattern: `org/app#(?P<num>[0-9]+)`, Template: "[org/app#${num}](https://gitlab.example.com/org/app/-/issues/${num})"},
+			{Name: "GitLab org/app merge requests", Pattern: `org/app!(?P<num>[0-9]+)`, Template: "[org/app!${num}](https://gitlab.example.com/org/app/-/merge_requests/${num})"},
+		}},
+	}
+	post := func(store Store, authorization Authorization, target string) *httptest.ResponseRecorder {
+		h := NewHandler(store, authorization, nil)
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest("POST", "/api/v1/links/import/gitlab?target="+url.QueryEscape(target), nil)
+		require.NoError(t, err)
+		r.Header.Set("Mattermost-User-ID", "admin")
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := post(store, authorizeAll{}, "org/app")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"added": ["GitLab org/app merge requests"], "updated": ["GitLab org/app issues"]}`, w.Body.String())
+	require.Len(t, saved, 2)
+	require.Equal(t, `org/app#(?P<num>[0-9]+)`, saved[0].Pattern)
+
+	saveCalled = false
+	require.Equal(t, http.StatusInternalServerError, post(store, authorizeAll{}, "org/missing").Code)
+	require.Equal(t, http.StatusBadRequest, post(store, authorizeAll{}, "").Code)
+	require.Equal(t, http.StatusForbidden, post(store, authorizeTeamAdmin{"team1": true}, "org/app").Code)
+	require.False(t, saveCalled)
+
+	require.Equal(t, http.StatusNotImplemented, post(&linkStore{}, authorizeAll{}, "org/app").Code)
+}
+
+// ciStore accepts the CI token "secret" for the "ci/" namespace.
+type ciStore struct {
+	linkStore
+}
+
+func (s *ciStore) CINamespace(token string) (string, bool) {
+	return "ci/", token == "secret"
+}
+
+func TestCILinks(t *testing.T) {
+	var saved []autolink.Autolink
+	var saveCalled bool
+	store := &ciStore{linkStore{
+		prev: []autolink.Autolink{
+			{Name: "jira", Pattern: "MM-(?P<id>\\d+)", Template: "[MM-$id](https://jira/$id)"},
+			{Name: "ci/app", Pattern: "APP-(?P<id>\\d+)", Template: "old"},
+			{Name: "ci/plugin", Pattern: "PLG-(?P<id>\\d+)", Template: "plugin", PluginID: "com.example.plugin"},
+		},
+		saveCalled: &saveCalled,
+		saved:      &saved,
+	}}
+	request := func(store Store, method, path, token, body string) *httptest.ResponseRecorder {
+		h := NewHandler(store, authorizeAll{}, nil)
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest(method, path, bytes.NewBufferString(body))
+		require.NoError(t, err)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	require.Equal(t, http.StatusUnauthorized, request(store, "GET", "/api/v1/ci/links", "", "").Code)
+	require.Equal(t, http.StatusUnauthorized, request(store, "GET", "/api/v1/ci/links", "wrong", "").Code)
+	require.Equal(t, http.StatusNotImplemented, request(&linkStore{}, "GET", "/api/v1/ci/links", "secret", "").Code)
+
+	w := request(store, "GET", "/api/v1/ci/links", "secret", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var listed []autolink.Autolink
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&listed))
+	require.Len(t, listed, 2)
+	require.Equal(t, "ci/app", listed[0].Name)
+
+	w = request(store, "POST", "/api/v1/ci/links", "secret",
+		`[{"Name": "ci/app", "Pattern": "APP-(?P<id>\\d+)", "Template": "[APP-$id](https://app/$id)"},
+		  {"Name": "ci/lib", "Pattern": "LIB-(?P<id>\\d+)", "Template": "[LIB-$id](https://lib/$id)"}]`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"added": ["ci/lib"], "updated": ["ci/app"]}`, w.Body.String())
+	require.Len(t, saved, 4)
+	require.Equal(t, "[APP-$id](https://app/$id)", saved[1].Template)
+	require.Equal(t, "jira", saved[0].Name, "the other links are kept")
+
+	saveCalled = false
+	for _, body := range []string{
+		`[{"Name": "jira", "Pattern": "MM-(?P<id>\\d+)", "Template": "changed"}]`,
+		`[{"Name": "ci/", "Pattern": "x", "Template": "y"}]`,
+		`[{"Name": "ci/plugin", "Pattern": "x", "Template": "y"}]`,
+	} {
+		require.Equal(t, http.StatusForbidden, request(store, "POST", "/api/v1/ci/links", "secret", body).Code, body)
+	}
+	require.Equal(t, http.StatusBadRequest, request(store, "POST", "/api/v1/ci/links", "secret",
+		`[{"Name": "ci/bad", "Pattern": "(", "Template": "y"}]`).Code)
+	require.Equal(t, http.StatusForbidden, request(store, "DELETE", "/api/v1/ci/links/jira", "secret", "").Code)
+	require.Equal(t, http.StatusForbidden, request(store, "DELETE", "/api/v1/ci/links/ci/plugin", "secret", "").Code)
+	require.False(t, saveCalled)
+
+	require.Equal(t, http.StatusOK, request(store, "DELETE", "/api/v1/ci/links/ci/app", "secret", "").Code)
+	require.Len(t, saved, 2)
+	require.Equal(t, "ci/plugin", saved[1].Name)
+}
+
+// apiKeyStore accepts the API keys "reader", which may read all the links,
+// "writer", which may change all the links, and "jira-writer", which may
+// change the links of the jira group.
+type apiKeyStore struct {
+	linkStore
+}
+
+func (s *apiKeyStore) APIKey(key string) (APIKeyScope, bool) {
+	switch key {
+	case "reader":
+		return APIKeyScope{Name: "reader"}, true
+	case "writer":
+		return APIKeyScope{Name: "writer", Write: true}, true
+	case "jira-writer":
+		return APIKeyScope{Name: "jira-writer", Write: true, Group: "jira"}, true
+	}
+	return APIKeyScope{}, false
+}
+
+func TestAPIKeys(t *testing.T) {
+	var saved []autolink.Autolink
+	var saveCalled bool
+	store := &apiKeyStore{linkStore{
+		prev: []autolink.Autolink{
+			{Name: "jira", Pattern: "MM-(?P<id>\\d+)", Template: "[MM-$id](https://jira/$id)", Group: "jira"},
+			{Name: "github", Pattern: "GH-(?P<id>\\d+)", Template: "[GH-$id](https://github/$id)"},
+			{Name: "plugin", Pattern: "PL-(?P<id>\\d+)", Template: "[PL-$id](https://plugin/$id)", Group: "jira", PluginID: "other"},
+		},
+		saveCalled: &saveCalled,
+		saved:      &saved,
+	}}
+	request := func(store Store, method, path, key, body string) *httptest.ResponseRecorder {
+		h := NewHandler(store, authorizeAll{}, nil)
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest(method, path, bytes.NewBufferString(body))
+		require.NoError(t, err)
+		r.Header.Set("Authorization", "Bearer "+key)
+		h.ServeHTTP(w, r)
+		return w
+	}
+	names := func(w *httptest.ResponseRecorder) []string {
+		var links []autolink.Autolink
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&links))
+		names := []string{}
+		for _, link := range links {
+			names = append(names, link.Name)
+		}
+		return names
+	}
+
+	require.Equal(t, http.StatusUnauthorized, request(store, "GET", "/api/v1/links", "wrong", "").Code)
+	require.Equal(t, http.StatusUnauthorized, request(&linkStore{}, "GET", "/api/v1/links", "reader", "").Code)
+
+	w := request(store, "GET", "/api/v1/links", "reader", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, []string{"jira", "github"}, names(w))
+	require.Equal(t, http.StatusForbidden, request(store, "DELETE", "/api/v1/links/jira", "reader", "").Code)
+
+	w = request(store, "GET", "/api/v1/links", "jira-writer", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, []string{"jira"}, names(w), "the key only sees the links of its group")
+
+	require.Equal(t, http.StatusForbidden, request(store, "DELETE", "/api/v1/links/github", "jira-writer", "").Code)
+	require.Equal(t, http.StatusForbidden, request(store, "POST", "/api/v1/link", "jira-writer",
+		`{"Name": "jira2", "Pattern": "JR-(?P<id>\\d+)", "Template": "x"}`).Code, "new links must be in the group")
+	require.Equal(t, http.StatusForbidden, request(store, "POST", "/api/v1/reload", "jira-writer", "").Code)
+	require.Equal(t, http.StatusForbidden, request(store, "PUT", "/api/v1/links", "jira-writer", "[]").Code)
+	require.Equal(t, http.StatusForbidden, request(store, "DELETE", "/api/v1/links/plugin", "jira-writer", "").Code,
+		"links owned by plugins are left to them")
+	require.Equal(t, http.StatusForbidden, request(store, "DELETE", "/api/v1/links/plugin", "writer", "").Code,
+		"links owned by plugins are left to them")
+	require.Equal(t, http.StatusForbidden, request(store, "POST", "/api/v1/link", "writer",
+		`{"Name": "jira2", "Pattern": "JR-(?P<id>\\d+)", "Template": "x", "PluginID": "other"}`).Code)
+	require.False(t, saveCalled)
+
+	w = request(store, "POST", "/api/v1/link", "jira-writer",
+		`{"Name": "jira2", "Pattern": "JR-(?P<id>\\d+)", "Template": "x", "Group": "jira"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, saved, 4)
+	require.Equal(t, http.StatusOK, request(store, "DELETE", "/api/v1/links/jira", "jira-writer", "").Code)
+	require.Len(t, saved, 2)
+	require.Equal(t, "github", saved[0].Name)
+	require.Equal(t, "plugin", saved[1].Name)
+}
+
+// middlewareStore is a store of the match middlewares of the plugins.
+type middlewareStore struct {
+	linkStore
+	paths map[string]string
+}
+
+func (s *middlewareStore) RegisterMatchMiddleware(pluginID, path string) error {
+	s.paths[pluginID] = path
+	return nil
+}
+
+func (s *middlewareStore) UnregisterMatchMiddleware(pluginID string) error {
+	delete(s.paths, pluginID)
+	return nil
+}
+
+func TestMatchMiddleware(t *testing.T) {
+	store := &middlewareStore{paths: map[string]string{}}
+	h := NewHandler(store, authorizeAll{}, nil)
+	request := func(method, header, value, body string) int {
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest(method, "/api/v1/middleware", bytes.NewBufferString(body))
+		require.NoError(t, err)
+		r.Header.Set(header, value)
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusForbidden, request("PUT", "Mattermost-User-ID", "admin", `{"path": "/match"}`))
+	require.Equal(t, http.StatusBadRequest, request("PUT", "Mattermost-Plugin-ID", "com.example.compliance", `{"path": "match"}`))
+	require.Empty(t, store.paths)
+
+	require.Equal(t, http.StatusOK, request("PUT", "Mattermost-Plugin-ID", "com.example.compliance", `{"path": "/match"}`))
+	require.Equal(t, map[string]string{"com.example.compliance": "/match"}, store.paths)
+
+	require.Equal(t, http.StatusOK, request("DELETE", "Mattermost-Plugin-ID", "com.example.compliance", ``))
+	require.Empty(t, store.paths)
+}
+
+func TestValidateLinks(t *testing.T) {
+	var saved []autolink.Autolink
+	var saveCalled bool
+	h := NewHandler(
+		&linkStore{
+			saveCalled: &saveCalled,
+			saved:      &saved,
+		},
+		authorizeAll{},
+		nil,
+	)
+
+	post := func(path string, body interface{}) *httptest.ResponseRecorder {
+		b, err := json.Marshal(body)
+		require.NoError(t, err)
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest("POST", path, bytes.NewReader(b))
+		require.NoError(t, err)
+		r.Header.Set("Mattermost-User-ID", "admin")
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := post("/api/v1/links/validate", []autolink.Autolink{
+		{Name: "valid", Pattern: "a", Template: "b"},
+		{Name: "unknown group", Pattern: "a", Template: "$key"},
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"errors": [{
+		"index": 1,
+		"link": "unknown group",
+		"kind": "template_group",
+		"message": "template references $key, which is not defined by the pattern"
+	}]}`, w.Body.String())
+
+	w = post("/api/v1/links/validate", []autolink.Autolink{{Name: "valid", Pattern: "a", Template: "b"}})
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"errors": []}`, w.Body.String())
+
+	w = post("/api/v1/link", autolink.Autolink{Name: "broken", Pattern: "(", Template: "b"})
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	var result struct {
+		Errors autolink.ValidationErrors `json:"errors"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&result))
+	require.Len(t, result.Errors, 1)
+	require.Equal(t, autolink.LintInvalid, result.Errors[0].Kind)
+	require.False(t, saveCalled)
+}
+
+// rateLimitedStore is a linkStore with rate limits
+type rateLimitedStore struct {
+	linkStore
+	perUser, perIP int
+	limited        []string
+	proxies        []string
+}
+
+func (s *rateLimitedStore) RateLimits() (int, int) {
+	return s.perUser, s.perIP
+}
+
+func (s *rateLimitedStore) TrustedProxies() []string {
+	return s.proxies
+}
+
+func (s *rateLimitedStore) RateLimited(caller string) {
+	s.limited = append(s.limited, caller)
+}
+
+func TestRateLimits(t *testing.T) {
+	store := &rateLimitedStore{perUser: 2, perIP: 3}
+	h := NewHandler(store, authorizeAll{}, nil)
+	now := time.Date(2024, time.January, 10, 12, 0, 0, 0, time.UTC)
+	h.limiter.now = func() time.Time { return now }
+
+	get := func(userID, ip string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest("GET", "/api/v1/links", nil)
+		require.NoError(t, err)
+		r.RemoteAddr = ip + ":1234"
+		if userID != "" {
+			r.Header.Set("Mattermost-User-ID", userID)
+		}
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	require.Equal(t, http.StatusOK, get("user1", "10.0.0.1").Code)
+	require.Equal(t, http.StatusOK, get("user1", "10.0.0.1").Code)
+	w := get("user1", "10.0.0.1")
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "30", w.Header().Get("Retry-After"))
+	require.Equal(t, http.StatusTooManyRequests, get("user1", "10.0.0.2").Code)
+	require.Equal(t, []string{"user:user1"}, store.limited, "callers are reported once")
+
+	require.Equal(t, http.StatusUnauthorized, get("", "10.0.0.1").Code, "other users are limited by IP")
+	require.Equal(t, http.StatusTooManyRequests, get("user2", "10.0.0.1").Code)
+	require.Equal(t, []string{"user:user1", "ip:10.0.0.1"}, store.limited)
+
+	now = now.Add(30 * time.Second)
+	require.Equal(t, http.StatusOK, get("user1", "10.0.0.2").Code, "tokens are refilled")
+
+	w = httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/api/v1/links", nil)
+	require.NoError(t, err)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("Mattermost-Plugin-ID", "other-plugin")
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code, "plugins are not limited")
+
+	forwarded := func(remoteAddr, forwardedFor string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest("GET", "/api/v1/links", nil)
+		require.NoError(t, err)
+		r.RemoteAddr = remoteAddr + ":1234"
+		r.Header.Set("X-Forwarded-For", forwardedFor)
+		h.ServeHTTP(w, r)
+		return w
+	}
+	now = now.Add(time.Minute)
+	for i := 0; i < 3; i++ {
+		require.Equal(t, http.StatusUnauthorized, forwarded("10.0.0.3", fmt.Sprintf("192.168.0.%d", i)).Code)
+	}
+	require.Equal(t, http.StatusTooManyRequests, forwarded("10.0.0.3", "192.168.0.9").Code,
+		"forwarded addresses are ignored without a trusted proxy")
+
+	store.proxies = []string{"10.0.0.0/24"}
+	for i := 0; i < 3; i++ {
+		require.Equal(t, http.StatusUnauthorized, forwarded("10.0.0.3", "192.168.0.9, 10.0.0.4").Code)
+	}
+	require.Equal(t, http.StatusTooManyRequests, forwarded("10.0.0.5", "192.168.0.9").Code,
+		"the client forwarded by a trusted proxy is limited")
+	require.Equal(t, http.StatusUnauthorized, forwarded("10.0.0.3", "192.168.0.10").Code)
+
+	bearer := func(key, ip string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest("GET", "/api/v1/links", nil)
+		require.NoError(t, err)
+		r.RemoteAddr = ip + ":1234"
+		r.Header.Set("Authorization", "Bearer "+key)
+		h.ServeHTTP(w, r)
+		return w
+	}
+	now = now.Add(time.Minute)
+	require.NotEqual(t, http.StatusTooManyRequests, bearer("key1", "172.16.0.1").Code)
+	require.NotEqual(t, http.StatusTooManyRequests, bearer("key1", "172.16.0.2").Code)
+	require.Equal(t, http.StatusTooManyRequests, bearer("key1", "172.16.0.3").Code, "API keys are limited")
+	require.NotEqual(t, http.StatusTooManyRequests, bearer("key2", "172.16.0.3").Code)
+	require.NotContains(t, store.limited[len(store.limited)-1], "key1", "API keys are not logged")
+}
+
+func TestClientIP(t *testing.T) {
+	proxies := parseProxies([]string{"10.0.0.0/8", "192.168.1.1", "invalid"})
+	require.Len(t, proxies, 2)
+
+	for _, tc := range []struct {
+		name, remoteAddr, forwardedFor, realIP, expected string
+	}{
+		{"direct", "1.2.3.4:80", "", "", "1.2.3.4"},
+		{"spoofed from a client", "1.2.3.4:80", "5.6.7.8", "5.6.7.9", "1.2.3.4"},
+		{"forwarded by a proxy", "10.0.0.1:80", "5.6.7.8", "", "5.6.7.8"},
+		{"client prepending an address", "10.0.0.1:80", "9.9.9.9, 5.6.7.8", "", "5.6.7.8"},
+		{"proxies chained", "10.0.0.1:80", "5.6.7.8, 192.168.1.1, 10.1.1.1", "", "5.6.7.8"},
+		{"real IP", "192.168.1.1:80", "", "5.6.7.8", "5.6.7.8"},
+		{"invalid forwarded address", "10.0.0.1:80", "unknown", "", "10.0.0.1"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := http.NewRequest("GET", "/", nil)
+			require.NoError(t, err)
+			r.RemoteAddr = tc.remoteAddr
+			if tc.forwardedFor != "" {
+				r.Header.Set("X-Forwarded-For", tc.forwardedFor)
+			}
+			if tc.realIP != "" {
+				r.Header.Set("X-Real-IP", tc.realIP)
+			}
+			require.Equal(t, tc.expected, clientIP(r, proxies))
+		})
+	}
+}
+
+func TestRateLimiterBuckets(t *testing.T) {
+	rl := newRateLimiter()
+	now := time.Date(2024, time.January, 10, 12, 0, 0, 0, time.UTC)
+	rl.now = func() time.Time { return now }
+
+	allowed, _, _ := rl.allow("first", 1)
+	require.True(t, allowed)
+	for i := 1; i < maxRateLimitBuckets+10; i++ {
+		now = now.Add(time.Millisecond)
+		rl.allow(fmt.Sprintf("caller%d", i), 1)
+	}
+	require.Len(t, rl.buckets, maxRateLimitBuckets)
+	require.NotContains(t, rl.buckets, "first", "the callers idle the longest are forgotten")
+}
+
+// actionStore handles the actions by echoing them.
+type actionStore struct {
+	linkStore
+}
+
+func (actionStore) HandleAction(userID, action string, request *model.PostActionIntegrationRequest) *model.PostActionIntegrationResponse {
+	return &model.PostActionIntegrationResponse{EphemeralText: userID + " " + action + " " + request.Context["link"].(string)}
+}
+
+func (actionStore) HandleDialog(userID, dialog string, request *model.SubmitDialogRequest) *model.SubmitDialogResponse {
+	if request.Submission["Name"] == "" {
+		return &model.SubmitDialogResponse{Errors: map[string]string{"Name": "required"}}
+	}
+	return nil
+}
+
+func TestActions(t *testing.T) {
+	h := NewHandler(&actionStore{}, authorizeTeamAdmin{}, optOuts{})
+
+	post := func(t *testing.T, path, body string, userID string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest("POST", path, bytes.NewBufferString(body))
+		require.NoError(t, err)
+		if userID != "" {
+			r.Header.Set("Mattermost-User-ID", userID)
+		}
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := post(t, "/api/v1/actions/disable", `{"context": {"link": "mm"}}`, "user1")
+	require.Equal(t, http.StatusOK, w.Code)
+	var response model.PostActionIntegrationResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	require.Equal(t, "user1 disable mm", response.EphemeralText)
+
+	w = post(t, "/api/v1/dialogs/edit", `{"submission": {"Name": ""}}`, "user1")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"errors": {"Name": "required"}}`, w.Body.String())
+
+	w = post(t, "/api/v1/dialogs/edit", `{"submission": {"Name": "mm"}}`, "user1")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Empty(t, w.Body.String())
+
+	t.Run("requires a user", func(t *testing.T) {
+		w := post(t, "/api/v1/actions/disable", `{"context": {"link": "mm"}}`, "")
+		require.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("not supported by the store", func(t *testing.T) {
+		h := NewHandler(&linkStore{}, authorizeTeamAdmin{}, optOuts{})
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest("POST", "/api/v1/actions/disable", bytes.NewBufferString(`{}`))
+		require.NoError(t, err)
+		r.Header.Set("Mattermost-User-ID", "user1")
+		h.ServeHTTP(w, r)
+		require.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("other routes", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest("GET", "/api/v1/links", nil)
+		require.NoError(t, err)
+		r.Header.Set("Mattermost-Plugin-ID", "testfrom")
+		h.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+	})
+}
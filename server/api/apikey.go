@@ -0,0 +1,61 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// APIKeyAuthenticator authenticates the API keys created by the plugin admins
+// for automation. Stores implementing it serve the requests of /api/v1 with a
+// valid key as the bearer token of their Authorization header, within the
+// scope of the key.
+type APIKeyAuthenticator interface {
+	// APIKey returns the scope of the key, and false if the key is not
+	// valid.
+	APIKey(key string) (APIKeyScope, bool)
+}
+
+// APIKeyScope is what an API key may do: read the links, or also change
+// them if Write is true, limited to the links of Group if it is not empty.
+type APIKeyScope struct {
+	Name  string
+	Write bool
+	Group string
+}
+
+// apiKeyScopeKey holds the scope of the API key of a request.
+const apiKeyScopeKey contextKey = "apiKeyScope"
+
+// authenticateAPIKey returns the request with the scope of its API key, and
+// false if it has no valid API key. Keys that may only read the links are
+// refused the requests that may change them.
+func (h *Handler) authenticateAPIKey(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	authenticator, ok := h.store.(APIKeyAuthenticator)
+	header := r.Header.Get("Authorization")
+	if !ok || !strings.HasPrefix(header, "Bearer ") {
+		http.Error(w, "Not authorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	scope, ok := authenticator.APIKey(strings.TrimPrefix(header, "Bearer "))
+	if !ok {
+		http.Error(w, "Not authorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	if !scope.Write && r.Method != http.MethodGet {
+		h.handleErrorWithCode(w, http.StatusForbidden, "Not authorized",
+			errors.Errorf("API key %q may only read the links", scope.Name))
+		return nil, false
+	}
+	return r.WithContext(context.WithValue(r.Context(), apiKeyScopeKey, scope)), true
+}
+
+// isLimited reports whether the caller may only manage some of the links, as
+// a team admin or with an API key, and not the plugin itself.
+func isLimited(r *http.Request) bool {
+	_, teamAdmin := r.Context().Value(teamAdminUserIDKey).(string)
+	_, apiKey := r.Context().Value(apiKeyScopeKey).(APIKeyScope)
+	return teamAdmin || apiKey
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+// CIAuthenticator authenticates the CI pipelines publishing links, e.g. the
+// links of newly created repositories. Stores implementing it serve
+// /api/v1/ci/links to the requests with a valid token, which otherwise get a
+// 501.
+type CIAuthenticator interface {
+	// CINamespace returns the prefix of the names of the links the token
+	// may manage, and false if the token is not valid.
+	CINamespace(token string) (string, bool)
+}
+
+// ciNamespaceKey holds the namespace of the links a CI request may manage.
+const ciNamespaceKey contextKey = "ciNamespace"
+
+// ciTokenRequired authenticates the requests by the bearer token of their
+// Authorization header, rather than by a Mattermost session.
+func (h *Handler) ciTokenRequired(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authenticator, ok := h.store.(CIAuthenticator)
+		if !ok {
+			h.handleErrorWithCode(w, http.StatusNotImplemented, "CI endpoint not available",
+				errors.New("the links can not be published by CI pipelines"))
+			return
+		}
+
+		header := r.Header.Get("Authorization")
+		if !strings.HasPrefix(header, "Bearer ") {
+			http.Error(w, "Not authorized", http.StatusUnauthorized)
+			return
+		}
+		namespace, ok := authenticator.CINamespace(strings.TrimPrefix(header, "Bearer "))
+		if !ok || namespace == "" {
+			http.Error(w, "Not authorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ciNamespaceKey, namespace)))
+	})
+}
+
+// inCINamespace reports whether the link is in the namespace of the CI
+// request.
+func inCINamespace(r *http.Request, name string) bool {
+	namespace, _ := r.Context().Value(ciNamespaceKey).(string)
+	return namespace != "" && len(name) > len(namespace) && strings.HasPrefix(name, namespace)
+}
+
+// getCILinks lists the links of the namespace of the CI request.
+func (h *Handler) getCILinks(w http.ResponseWriter, r *http.Request) {
+	links := []autolink.Autolink{}
+	for _, link := range h.store.GetLinks() {
+		if inCINamespace(r, link.Name) {
+			links = append(links, link)
+		}
+	}
+
+	b, err := json.Marshal(autolink.WithoutWebhooks(links))
+	if err != nil {
+		h.handleError(w, errors.Wrap(err, "unable to marshal links"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
+
+// publishCILinks adds the links of the JSON body, or replaces the links with
+// their names. All of them must be named in the namespace of the CI request,
+// for CI pipelines not to change the links managed by hand.
+func (h *Handler) publishCILinks(w http.ResponseWriter, r *http.Request) {
+	var published []autolink.Autolink
+	if err := json.NewDecoder(r.Body).Decode(&published); err != nil {
+		h.handleErrorWithCode(w, http.StatusBadRequest, "Invalid links", errors.Wrap(err, "unable to decode body"))
+		return
+	}
+	namespace, _ := r.Context().Value(ciNamespaceKey).(string)
+	for i := range published {
+		if !inCINamespace(r, published[i].Name) {
+			h.handleErrorWithCode(w, http.StatusForbidden, "Not authorized",
+				errors.Errorf("link %q is not in the %q namespace of the token", published[i].Name, namespace))
+			return
+		}
+		if published[i].PluginID != "" {
+			h.handleErrorWithCode(w, http.StatusBadRequest, "Invalid links",
+				errors.Errorf("link %q can not be owned by a plugin", published[i].Name))
+			return
+		}
+	}
+	if errs := autolink.Validate(published); len(errs) > 0 {
+		h.handleSaveError(w, errs)
+		return
+	}
+
+	links := append([]autolink.Autolink{}, h.store.GetLinks()...)
+	result := importResult{Added: []string{}, Updated: []string{}}
+	for _, link := range published {
+		found := false
+		for i := range links {
+			if links[i].Name != link.Name {
+				continue
+			}
+			if links[i].PluginID != "" {
+				h.handleNotAuthorized(w, links[i])
+				return
+			}
+			if err := keepWebhookURL(r, &link, links[i].WebhookURL); err != nil {
+				h.handleErrorWithCode(w, http.StatusForbidden, "Not authorized", err)
+				return
+			}
+			if !links[i].Equals(link) {
+				links[i] = link
+				result.Updated = append(result.Updated, link.Name)
+			}
+			found = true
+			break
+		}
+		if !found {
+			if err := keepWebhookURL(r, &link, ""); err != nil {
+				h.handleErrorWithCode(w, http.StatusForbidden, "Not authorized", err)
+				return
+			}
+			links = append(links, link)
+			result.Added = append(result.Added, link.Name)
+		}
+	}
+	if len(result.Added) > 0 || len(result.Updated) > 0 {
+		if err := h.store.SaveLinks(links); err != nil {
+			h.handleSaveError(w, err)
+			return
+		}
+	}
+
+	b, err := json.Marshal(result)
+	if err != nil {
+		h.handleError(w, errors.Wrap(err, "unable to marshal the publish result"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
+
+// deleteCILink deletes a link of the namespace of the CI request.
+func (h *Handler) deleteCILink(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if !inCINamespace(r, name) {
+		h.handleErrorWithCode(w, http.StatusForbidden, "Not authorized",
+			errors.Errorf("link %q is not in the namespace of the token", name))
+		return
+	}
+	for _, link := range h.store.GetLinks() {
+		if link.Name == name && link.PluginID != "" {
+			h.handleNotAuthorized(w, link)
+			return
+		}
+	}
+	h.deleteLink(w, r)
+}
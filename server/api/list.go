@@ -0,0 +1,195 @@
+package api
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+// defaultPerPage and maxPerPage are the default and maximum number of links
+// per page, when the links are listed page by page.
+const (
+	defaultPerPage = 60
+	maxPerPage     = 200
+)
+
+// Orders of the links list.
+const (
+	sortName    = "name"
+	sortLastHit = "last-hit"
+	sortCreated = "created"
+)
+
+// ActivityReporter reports when the links last changed a post and how many
+// posts they recently changed. Stores implementing it are used to annotate the
+// listed links with stats=true, which is otherwise answered with 501.
+type ActivityReporter interface {
+	LinkActivity(links []autolink.Autolink) ([]LinkActivity, error)
+}
+
+// LinkActivity is when a link last changed a post, and the number of posts it
+// changed over the last 7 and 30 days, today included.
+type LinkActivity struct {
+	LastFiredAt *time.Time `json:"last_fired_at,omitempty"`
+	Posts7Days  int        `json:"posts_7d"`
+	Posts30Days int        `json:"posts_30d"`
+}
+
+// linkWithActivity is a listed link annotated with its activity.
+type linkWithActivity struct {
+	autolink.Autolink
+	Activity LinkActivity `json:"activity"`
+}
+
+// listOptions are the query parameters selecting the links to list, and the
+// order and page to list them in.
+type listOptions struct {
+	// page and perPage select a page of the links, all of them if perPage
+	// is 0
+	page    int
+	perPage int
+	sort    string
+	// stats annotates the links with their activity
+	stats bool
+
+	// enabled filters the links on whether they are enabled, if not nil
+	enabled *bool
+	scope   string
+	group   string
+	tag     string
+}
+
+func parseListOptions(query url.Values) (listOptions, error) {
+	opts := listOptions{
+		sort:  sortCreated,
+		scope: query.Get("scope"),
+		group: query.Get("group"),
+		tag:   query.Get("tag"),
+	}
+
+	if page := query.Get("page"); page != "" {
+		n, err := strconv.Atoi(page)
+		if err != nil || n < 0 {
+			return opts, errors.Errorf("invalid page %q, must be a number from 0", page)
+		}
+		opts.page = n
+		opts.perPage = defaultPerPage
+	}
+	if perPage := query.Get("per_page"); perPage != "" {
+		n, err := strconv.Atoi(perPage)
+		if err != nil || n <= 0 {
+			return opts, errors.Errorf("invalid per_page %q, must be a positive number", perPage)
+		}
+		if n > maxPerPage {
+			n = maxPerPage
+		}
+		opts.perPage = n
+	}
+
+	switch s := query.Get("sort"); s {
+	case "":
+	case sortName, sortLastHit, sortCreated:
+		opts.sort = s
+	default:
+		return opts, errors.Errorf("invalid sort %q, must be %q, %q or %q", s, sortName, sortLastHit, sortCreated)
+	}
+
+	if stats := query.Get("stats"); stats != "" {
+		b, err := strconv.ParseBool(stats)
+		if err != nil {
+			return opts, errors.Errorf("invalid stats %q, must be true or false", stats)
+		}
+		opts.stats = b
+	}
+
+	if enabled := query.Get("enabled"); enabled != "" {
+		b, err := strconv.ParseBool(enabled)
+		if err != nil {
+			return opts, errors.Errorf("invalid enabled %q, must be true or false", enabled)
+		}
+		opts.enabled = &b
+	}
+	return opts, nil
+}
+
+// matches reports whether the link passes the filters. A scope filter matches
+// the links with that exact scope, and a team the links scoped to the team or
+// to any of its channels.
+func (opts listOptions) matches(link autolink.Autolink) bool {
+	if opts.enabled != nil && *opts.enabled == link.Disabled {
+		return false
+	}
+	if opts.group != "" && !strings.EqualFold(opts.group, link.Group) {
+		return false
+	}
+	if opts.tag != "" && !link.HasTag(opts.tag) {
+		return false
+	}
+	return opts.scope == "" || link.InScope(opts.scope)
+}
+
+// sortLinks sorts the links, in the order they were created by default.
+// lastFired are the times the links last matched, in the same order, used to
+// list the most recently matched links first.
+func (opts listOptions) sortLinks(links []autolink.Autolink, lastFired []*time.Time) {
+	switch opts.sort {
+	case sortName:
+		sort.SliceStable(links, func(i, j int) bool {
+			return strings.ToLower(links[i].DisplayName()) < strings.ToLower(links[j].DisplayName())
+		})
+	case sortLastHit:
+		order := make([]int, len(links))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			a, b := lastFired[order[i]], lastFired[order[j]]
+			return a != nil && (b == nil || a.After(*b))
+		})
+		sorted := make([]autolink.Autolink, len(links))
+		for i, k := range order {
+			sorted[i] = links[k]
+		}
+		copy(links, sorted)
+	}
+}
+
+// paginate returns the requested page of the links.
+func (opts listOptions) paginate(links []autolink.Autolink) []autolink.Autolink {
+	if opts.perPage == 0 {
+		return links
+	}
+	// compare pages rather than offsets, as a huge page would overflow the
+	// offset
+	if opts.page >= (len(links)+opts.perPage-1)/opts.perPage {
+		return []autolink.Autolink{}
+	}
+	start := opts.page * opts.perPage
+	end := start + opts.perPage
+	if end > len(links) {
+		end = len(links)
+	}
+	return links[start:end]
+}
+
+// lastFired returns the times the links last matched, nil for the links that
+// never did or if the store does not report them.
+func (h *Handler) lastFired(links []autolink.Autolink) []*time.Time {
+	lastFired := make([]*time.Time, len(links))
+	reporter, ok := h.store.(StatusReporter)
+	if !ok {
+		return lastFired
+	}
+	for i, linkStatus := range reporter.Status().Links {
+		if i < len(links) && linkStatus.Name == links[i].DisplayName() {
+			lastFired[i] = linkStatus.LastFiredAt
+		}
+	}
+	return lastFired
+}
@@ -0,0 +1,262 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RateLimits configures the rate limits of the API. Stores implementing it
+// have the requests of each user, API key and IP address limited, except those
+// made by other plugins.
+type RateLimits interface {
+	// RateLimits returns the maximum number of requests per minute of a
+	// single user or API key, and of a single IP address, 0 for no limit.
+	RateLimits() (perUser, perIP int)
+
+	// RateLimited is called when a caller, "user:<id>", "apikey:<hash>" or
+	// "ip:<address>", exceeds its limit, once until it is back under it.
+	RateLimited(caller string)
+}
+
+// TrustedProxies is implemented by the stores of the plugins served behind
+// reverse proxies. The requests coming from these proxies are limited by the
+// client address they forward, which is otherwise ignored as any client can
+// set it.
+type TrustedProxies interface {
+	// TrustedProxies returns the IP addresses and CIDR ranges of the proxies.
+	TrustedProxies() []string
+}
+
+// maxRateLimitBuckets is the maximum number of callers tracked at once. The
+// callers idle the longest are forgotten first when it is reached.
+const maxRateLimitBuckets = 10000
+
+// rateLimiter is a token bucket per caller, refilled at the rate of the
+// caller's limit per minute, and holding up to a minute of requests.
+type rateLimiter struct {
+	now func() time.Time
+
+	lock      sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// limited is set when the caller is rejected, for it to be reported once
+	limited bool
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		now:     time.Now,
+		buckets: map[string]*bucket{},
+	}
+}
+
+// allow takes a request from the bucket of the caller. It returns how long
+// the caller must wait for the next request if it has none left, and whether
+// the caller was just limited.
+func (rl *rateLimiter) allow(caller string, perMinute int) (bool, time.Duration, bool) {
+	if perMinute <= 0 {
+		return true, 0, false
+	}
+
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	now := rl.now()
+	rl.prune(now, false)
+
+	b, ok := rl.buckets[caller]
+	if !ok {
+		if len(rl.buckets) >= maxRateLimitBuckets {
+			rl.prune(now, true)
+		}
+		if len(rl.buckets) >= maxRateLimitBuckets {
+			rl.evictOldest()
+		}
+		b = &bucket{tokens: float64(perMinute), updated: now}
+		rl.buckets[caller] = b
+	}
+	rate := float64(perMinute) / float64(time.Minute)
+	b.tokens += float64(now.Sub(b.updated)) * rate
+	if b.tokens > float64(perMinute) {
+		b.tokens = float64(perMinute)
+	}
+	b.updated = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / rate)
+		justLimited := !b.limited
+		b.limited = true
+		return false, wait, justLimited
+	}
+	b.tokens--
+	b.limited = false
+	return true, 0, false
+}
+
+// prune forgets the callers that made no request in the last minute, whose
+// buckets are full again, at most once a minute unless forced.
+func (rl *rateLimiter) prune(now time.Time, force bool) {
+	if !force && now.Sub(rl.lastPrune) < time.Minute {
+		return
+	}
+	rl.lastPrune = now
+	for caller, b := range rl.buckets {
+		if now.Sub(b.updated) >= time.Minute {
+			delete(rl.buckets, caller)
+		}
+	}
+}
+
+// evictOldest forgets the caller whose last request is the oldest.
+func (rl *rateLimiter) evictOldest() {
+	oldest := ""
+	var oldestUpdated time.Time
+	for caller, b := range rl.buckets {
+		if oldest == "" || b.updated.Before(oldestUpdated) {
+			oldest, oldestUpdated = caller, b.updated
+		}
+	}
+	delete(rl.buckets, oldest)
+}
+
+// parseProxies returns the networks of the trusted proxies, skipping the
+// invalid entries.
+func parseProxies(entries []string) []*net.IPNet {
+	proxies := []*net.IPNet{}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				continue
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			proxies = append(proxies, network)
+		}
+	}
+	return proxies
+}
+
+// isProxy reports whether the address is one of the trusted proxies.
+func isProxy(address string, proxies []*net.IPNet) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, proxy := range proxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the IP address of the client. The addresses forwarded in
+// the X-Forwarded-For and X-Real-IP headers are only used for requests coming
+// from a trusted proxy, the last one not being a trusted proxy itself, as the
+// addresses before it may be set by the client.
+func clientIP(r *http.Request, proxies []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !isProxy(host, proxies) {
+		return host
+	}
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		addresses := strings.Split(forwarded, ",")
+		for i := len(addresses) - 1; i >= 0; i-- {
+			address := strings.TrimSpace(addresses[i])
+			if net.ParseIP(address) == nil {
+				break
+			}
+			if !isProxy(address, proxies) {
+				return address
+			}
+		}
+		return host
+	}
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+	return host
+}
+
+// apiKeyCaller returns the caller key of the API key of the request, if any,
+// hashed for the key not to be kept or logged.
+func apiKeyCaller(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(strings.TrimPrefix(header, "Bearer ")))
+	return "apikey:" + hex.EncodeToString(sum[:8])
+}
+
+type rateLimitedCaller struct {
+	key   string
+	limit int
+}
+
+// rateLimited rejects the requests of the users, API keys and IP addresses
+// that exceeded their limit with a 429 status.
+func (h *Handler) rateLimited(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limits, ok := h.store.(RateLimits)
+		if !ok || r.Header.Get("Mattermost-Plugin-ID") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var proxies []*net.IPNet
+		if trusted, ok := h.store.(TrustedProxies); ok {
+			proxies = parseProxies(trusted.TrustedProxies())
+		}
+
+		perUser, perIP := limits.RateLimits()
+		// Users and API keys are checked first, for the requests of a limited
+		// caller not to count against the others of the same address
+		callers := []rateLimitedCaller{}
+		if userID := r.Header.Get("Mattermost-User-ID"); userID != "" {
+			callers = append(callers, rateLimitedCaller{"user:" + userID, perUser})
+		} else if key := apiKeyCaller(r); key != "" {
+			callers = append(callers, rateLimitedCaller{key, perUser})
+		}
+		callers = append(callers, rateLimitedCaller{"ip:" + clientIP(r, proxies), perIP})
+
+		for _, caller := range callers {
+			allowed, wait, justLimited := h.limiter.allow(caller.key, caller.limit)
+			if allowed {
+				continue
+			}
+			if justLimited {
+				limits.RateLimited(caller.key)
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+			h.handleErrorWithCode(w, http.StatusTooManyRequests, "Too many requests.",
+				errors.Errorf("rate limit of %d requests per minute exceeded", caller.limit))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+	"github.com/mattermost/mattermost-plugin-autolink/server/importer"
+)
+
+// maxSimulationSize is the maximum size in bytes of the channel export the
+// links are simulated against.
+const maxSimulationSize = 50 * 1024 * 1024
+
+// Simulation is the report of the links simulated against the posts of a
+// channel export: the posts each link would have rewritten on its own, and
+// the posts the links would have rewritten together, in their order. Scopes
+// are ignored, the channels of the export not being known.
+type Simulation struct {
+	Posts     int              `json:"posts"`
+	Rewritten int              `json:"rewritten"`
+	Links     []LinkSimulation `json:"links"`
+	Failed    []string         `json:"failed,omitempty"`
+}
+
+// LinkSimulation is the number of posts a link would have rewritten, and of
+// matches it would have replaced in them.
+type LinkSimulation struct {
+	Name     string `json:"name"`
+	Disabled bool   `json:"disabled,omitempty"`
+	Posts    int    `json:"posts"`
+	Matches  int    `json:"matches"`
+}
+
+// SimulateLinks runs the links against the messages, without saving or
+// posting anything. The disabled links are simulated as if they were enabled
+// if includeDisabled is set, e.g. to size their impact before enabling them,
+// and skipped otherwise. The links that do not compile are reported as
+// failed.
+func SimulateLinks(links []autolink.Autolink, messages []string, includeDisabled bool) Simulation {
+	simulation := Simulation{Posts: len(messages), Links: []LinkSimulation{}}
+	compiled := []autolink.Autolink{}
+	for _, link := range links {
+		if link.Disabled && !includeDisabled {
+			continue
+		}
+		disabled := link.Disabled
+		link.Disabled = false
+		if err := link.Compile(); err != nil {
+			simulation.Failed = append(simulation.Failed, link.DisplayName())
+			continue
+		}
+		compiled = append(compiled, link)
+		simulation.Links = append(simulation.Links, LinkSimulation{Name: link.DisplayName(), Disabled: disabled})
+	}
+
+	for _, message := range messages {
+		rewritten := message
+		for i, link := range compiled {
+			if link.Replace(message) != message {
+				simulation.Links[i].Posts++
+				simulation.Links[i].Matches += len(link.Matches(message))
+			}
+			rewritten = link.Replace(rewritten)
+		}
+		if rewritten != message {
+			simulation.Rewritten++
+		}
+	}
+	return simulation
+}
+
+// simulate runs the links against the channel export of the body, see
+// importer.ParseChannelExport for its formats, and reports how many posts each
+// link would have rewritten. Team admins and API keys only simulate the links
+// they manage.
+func (h *Handler) simulate(w http.ResponseWriter, r *http.Request) {
+	data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxSimulationSize))
+	if err != nil {
+		h.handleErrorWithCode(w, http.StatusBadRequest, "Invalid export", errors.Wrap(err, "unable to read body"))
+		return
+	}
+	messages, err := importer.ParseChannelExport(data)
+	if err != nil {
+		h.handleErrorWithCode(w, http.StatusBadRequest, "Invalid export", err)
+		return
+	}
+
+	links := []autolink.Autolink{}
+	for _, link := range h.store.GetLinks() {
+		if ok, err := h.canManage(r, link); err != nil || !ok {
+			continue
+		}
+		links = append(links, link)
+	}
+	simulation := SimulateLinks(links, messages, r.URL.Query().Get("include_disabled") == "true")
+
+	b, err := json.Marshal(simulation)
+	if err != nil {
+		h.handleError(w, errors.Wrap(err, "unable to marshal the simulation"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// UsageReporter reports the usage of the links over days. Stores implementing
+// it are used by the stats endpoint, which otherwise responds with 501.
+type UsageReporter interface {
+	UsageStats(from, to time.Time) ([]UsageStat, error)
+}
+
+// UsageStat is the number of posts a link changed in a channel on a day, in
+// UTC.
+type UsageStat struct {
+	Date        string `json:"date"`
+	Link        string `json:"link"`
+	ChannelID   string `json:"channel_id"`
+	ChannelName string `json:"channel_name,omitempty"`
+	TeamName    string `json:"team_name,omitempty"`
+	Posts       int    `json:"posts"`
+}
+
+// StatsDateLayout is the layout of the dates of the stats.
+const StatsDateLayout = "2006-01-02"
+
+// defaultStatsDays is the number of days the stats cover without a from date,
+// and maxStatsDays the most they may cover.
+const (
+	defaultStatsDays = 30
+	maxStatsDays     = 366
+)
+
+// Formats of the stats.
+const (
+	statsFormatJSON = "json"
+	statsFormatCSV  = "csv"
+)
+
+// statsCSVHeader is the header row of the stats exported as CSV.
+var statsCSVHeader = []string{"date", "link", "channel_id", "channel_name", "team_name", "posts"}
+
+// parseStatsRange returns the range of days of the from and to query
+// parameters, both included, by default the last defaultStatsDays days.
+func parseStatsRange(from, to string, now time.Time) (time.Time, time.Time, error) {
+	end := now.UTC().Truncate(24 * time.Hour)
+	if to != "" {
+		t, err := time.Parse(StatsDateLayout, to)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.Errorf("invalid to %q, must be a date as YYYY-MM-DD", to)
+		}
+		end = t
+	}
+	start := end.AddDate(0, 0, 1-defaultStatsDays)
+	if from != "" {
+		t, err := time.Parse(StatsDateLayout, from)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.Errorf("invalid from %q, must be a date as YYYY-MM-DD", from)
+		}
+		start = t
+	}
+
+	if start.After(end) {
+		return time.Time{}, time.Time{}, errors.Errorf("from %s is after to %s", start.Format(StatsDateLayout), end.Format(StatsDateLayout))
+	}
+	if end.Sub(start) >= maxStatsDays*24*time.Hour {
+		return time.Time{}, time.Time{}, errors.Errorf("the range may not be longer than %d days", maxStatsDays)
+	}
+	return start, end, nil
+}
+
+// stats exports the number of posts each link changed in each channel, by
+// day, as JSON or CSV. Team admins only get the stats of the links they
+// manage.
+func (h *Handler) stats(w http.ResponseWriter, r *http.Request) {
+	reporter, ok := h.store.(UsageReporter)
+	if !ok {
+		h.handleErrorWithCode(w, http.StatusNotImplemented, "Stats not available",
+			errors.New("the usage of the links is not recorded"))
+		return
+	}
+
+	query := r.URL.Query()
+	format := query.Get("format")
+	switch format {
+	case "":
+		format = statsFormatJSON
+	case statsFormatJSON, statsFormatCSV:
+	default:
+		h.handleErrorWithCode(w, http.StatusBadRequest, "Invalid stats query",
+			errors.Errorf("invalid format %q, must be %q or %q", format, statsFormatJSON, statsFormatCSV))
+		return
+	}
+	from, to, err := parseStatsRange(query.Get("from"), query.Get("to"), time.Now())
+	if err != nil {
+		h.handleErrorWithCode(w, http.StatusBadRequest, "Invalid stats query", err)
+		return
+	}
+
+	stats, err := reporter.UsageStats(from, to)
+	if err != nil {
+		h.handleError(w, errors.Wrap(err, "unable to get the stats"))
+		return
+	}
+
+	if isLimited(r) {
+		managed := map[string]bool{}
+		for _, link := range h.store.GetLinks() {
+			if ok, err := h.canManage(r, link); err == nil && ok {
+				managed[link.DisplayName()] = true
+			}
+		}
+		kept := []UsageStat{}
+		for _, stat := range stats {
+			if managed[stat.Link] {
+				kept = append(kept, stat)
+			}
+		}
+		stats = kept
+	}
+	if stats == nil {
+		stats = []UsageStat{}
+	}
+
+	filename := "autolink-stats-" + from.Format(StatsDateLayout) + "-" + to.Format(StatsDateLayout) + "." + format
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	if format == statsFormatCSV {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		cw := csv.NewWriter(w)
+		_ = cw.Write(statsCSVHeader)
+		for _, stat := range stats {
+			_ = cw.Write([]string{stat.Date, stat.Link, stat.ChannelID, stat.ChannelName, stat.TeamName, strconv.Itoa(stat.Posts)})
+		}
+		cw.Flush()
+		return
+	}
+
+	b, err := json.Marshal(stats)
+	if err != nil {
+		h.handleError(w, errors.Wrap(err, "unable to marshal stats"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
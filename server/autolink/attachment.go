@@ -0,0 +1,115 @@
+package autolink
+
+// AttachmentTemplate is a message attachment added to the post for each match
+// of a link. Its texts are templates, like the link's Template.
+type AttachmentTemplate struct {
+	Title     string                    `json:"Title,omitempty"`
+	TitleLink string                    `json:"TitleLink,omitempty"`
+	Text      string                    `json:"Text,omitempty"`
+	Color     string                    `json:"Color,omitempty"`
+	Fields    []AttachmentFieldTemplate `json:"Fields,omitempty"`
+}
+
+// AttachmentFieldTemplate is a field of an AttachmentTemplate. Short fields
+// are displayed side by side.
+type AttachmentFieldTemplate struct {
+	Title string `json:"Title"`
+	Value string `json:"Value"`
+	Short bool   `json:"Short,omitempty"`
+}
+
+// Attachment is a message attachment generated for a match.
+type Attachment struct {
+	Title     string
+	TitleLink string
+	Text      string
+	Color     string
+	Fields    []AttachmentField
+}
+
+// AttachmentField is a field of an Attachment.
+type AttachmentField struct {
+	Title string
+	Value string
+	Short bool
+}
+
+func (a *AttachmentTemplate) equals(x *AttachmentTemplate) bool {
+	if a == nil || x == nil {
+		return a == x
+	}
+	if a.Title != x.Title || a.TitleLink != x.TitleLink || a.Text != x.Text || a.Color != x.Color || len(a.Fields) != len(x.Fields) {
+		return false
+	}
+	for i := range a.Fields {
+		if a.Fields[i] != x.Fields[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// templates returns the templates of the attachment.
+func (a *AttachmentTemplate) templates() []string {
+	if a == nil {
+		return nil
+	}
+	templates := []string{a.Title, a.TitleLink, a.Text, a.Color}
+	for _, f := range a.Fields {
+		templates = append(templates, f.Title, f.Value)
+	}
+	return templates
+}
+
+// compiledAttachment holds the parsed templates of an AttachmentTemplate, in
+// the order returned by templates.
+type compiledAttachment [][]templatePart
+
+func compileAttachment(a *AttachmentTemplate, mentions map[string]string, expandVariables func(string) string) (compiledAttachment, error) {
+	var compiled compiledAttachment
+	for _, template := range a.templates() {
+		parts, _, err := parseTemplate(expandVariables(template), mentions)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, parts)
+	}
+	return compiled, nil
+}
+
+// Attachments returns the attachment generated for each match of the link in
+// the message, or none if the link has no Attachment.
+func (l Autolink) Attachments(message string) []Attachment {
+	if l.re == nil || l.attachment == nil {
+		return nil
+	}
+
+	src := []byte(message)
+	var attachments []Attachment
+	for _, match := range l.re.FindAllSubmatchIndex(src, -1) {
+		attachments = append(attachments, l.attachment.expand(l.Attachment, l.re, src, match, l.post))
+	}
+	return attachments
+}
+
+func (c compiledAttachment) expand(a *AttachmentTemplate, re matcher, src []byte, match []int, post *PostContext) Attachment {
+	values := make([]string, len(c))
+	for i, parts := range c {
+		values[i] = string(expandTemplate(nil, re, parts, src, match, post))
+	}
+
+	attachment := Attachment{
+		Title:     values[0],
+		TitleLink: values[1],
+		Text:      values[2],
+		Color:     values[3],
+	}
+	for i, f := range a.Fields {
+		attachment.Fields = append(attachment.Fields, AttachmentField{
+			Title: values[4+2*i],
+			Value: values[5+2*i],
+			Short: f.Short,
+		})
+	}
+	return attachment
+}
@@ -0,0 +1,44 @@
+package autolink_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+func TestAttachments(t *testing.T) {
+	link := autolink.Autolink{
+		Pattern: `(?P<id>INC-\d+)`,
+		Attachment: &autolink.AttachmentTemplate{
+			Title:     "Incident ${id}",
+			TitleLink: "https://incidents.example.com/${id:urlencode}",
+			Color:     "#ff0000",
+			Fields: []autolink.AttachmentFieldTemplate{
+				{Title: "ID", Value: "$id", Short: true},
+			},
+		},
+	}
+	require.NoError(t, link.Compile())
+
+	assert.Equal(t, []autolink.Attachment{{
+		Title:     "Incident INC-1",
+		TitleLink: "https://incidents.example.com/INC-1",
+		Color:     "#ff0000",
+		Fields:    []autolink.AttachmentField{{Title: "ID", Value: "INC-1", Short: true}},
+	}, {
+		Title:     "Incident INC-22",
+		TitleLink: "https://incidents.example.com/INC-22",
+		Color:     "#ff0000",
+		Fields:    []autolink.AttachmentField{{Title: "ID", Value: "INC-22", Short: true}},
+	}}, link.Attachments("See INC-1 and INC-22"))
+	assert.Equal(t, "See INC-1", link.Replace("See INC-1"), "the match is kept without a template")
+	assert.Empty(t, link.Attachments("no incident"))
+
+	assert.Empty(t, (&autolink.Autolink{Pattern: "a", Template: "b"}).Attachments("a"))
+
+	link.Attachment.Text = "${id:unknown}"
+	assert.Error(t, link.Compile())
+}
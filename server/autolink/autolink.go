@@ -1,8 +1,16 @@
 package autolink
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"net/url"
 	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
 )
 
 // Autolink represents a pattern to autolink.
@@ -17,21 +25,331 @@ type Autolink struct {
 	DisableNonWordSuffix bool     `json:"DisableNonWordSuffix"`
 	ProcessBotPosts      bool     `json:"ProcessBotPosts"`
 
+	// ProcessIntegrationPosts applies the link to posts made by incoming
+	// webhooks and other integrations, even if the plugin is configured to skip
+	// them.
+	ProcessIntegrationPosts bool `json:"ProcessIntegrationPosts,omitempty"`
+
+	// ProcessPluginPosts applies the link to posts made by other plugins,
+	// even if the plugin is not configured to process them.
+	ProcessPluginPosts bool `json:"ProcessPluginPosts,omitempty"`
+	CaseInsensitive    bool `json:"CaseInsensitive,omitempty"`
+
+	// MultiLine makes ^ and $ of the pattern match at the start and end of
+	// each line, like prefixing it with (?m), and DotAll makes . match line
+	// breaks too, like prefixing it with (?s).
+	MultiLine bool `json:"MultiLine,omitempty"`
+	DotAll    bool `json:"DotAll,omitempty"`
+
+	// AcrossLines applies the link to the consecutive lines of each
+	// paragraph of a post together, for patterns spanning several lines,
+	// e.g. the header of a stack trace. Links apply to each line on its own
+	// otherwise.
+	AcrossLines bool `json:"AcrossLines,omitempty"`
+
+	// ProcessOnUpdate applies the link to edited posts, or not, regardless
+	// of whether the plugin is configured to process them, if not nil.
+	ProcessOnUpdate *bool `json:"ProcessOnUpdate,omitempty"`
+
+	// UnicodeWordMatch matches whole words like WordMatch, but treats the
+	// letters and digits of all scripts as part of words, while Chinese and
+	// Japanese characters separate them. BoundaryClass is a regular expression
+	// matching a single character allowed before and after a match, replacing
+	// the default ones.
+	UnicodeWordMatch bool   `json:"UnicodeWordMatch,omitempty"`
+	BoundaryClass    string `json:"BoundaryClass,omitempty"`
+
+	// PrefixChars and SuffixChars are the characters allowed right before and
+	// after a match, in addition to whitespace, e.g. "(" and ")". They take
+	// precedence over the other boundary settings on their side.
+	PrefixChars string `json:"PrefixChars,omitempty"`
+	SuffixChars string `json:"SuffixChars,omitempty"`
+
+	// MaxReplacements is the maximum number of matches replaced in a single
+	// post, 0 for no limit.
+	MaxReplacements int `json:"MaxReplacements,omitempty"`
+
+	// FirstMatchOnly replaces only the first occurrence of each match in a
+	// post, the repeated ones being left as is.
+	FirstMatchOnly bool `json:"FirstMatchOnly,omitempty"`
+
+	// ProcessLinkLabels applies the link to the label text of the markdown
+	// links of the post, e.g. `see MM-123` in `[see MM-123](url)`, which links
+	// skip by default. The URL of the markdown link is never changed.
+	ProcessLinkLabels bool `json:"ProcessLinkLabels,omitempty"`
+
+	// CodeBlocks and CodeSpans apply the link to the text of fenced and
+	// indented code blocks, and of inline code spans, which links skip by
+	// default. The code is left as is, the text generated for its matches
+	// being added after it. With CodeOnly, the link only applies to that code.
+	CodeBlocks bool `json:"CodeBlocks,omitempty"`
+	CodeSpans  bool `json:"CodeSpans,omitempty"`
+	CodeOnly   bool `json:"CodeOnly,omitempty"`
+
+	// BotAllowlist and BotDenylist are the usernames of the bots whose posts
+	// are, or are not, processed. A non-empty allowlist takes precedence over
+	// ProcessBotPosts.
+	BotAllowlist []string `json:"BotAllowlist,omitempty"`
+	BotDenylist  []string `json:"BotDenylist,omitempty"`
+
+	// Patterns are alternative spellings matched in addition to Pattern, all
+	// of them expanded with the same Template.
+	Patterns []string `json:"Patterns,omitempty"`
+
+	// WebhookURL receives the events of the link changing posts, instead of
+	// the webhook of the plugin configuration.
+	WebhookURL string `json:"WebhookURL,omitempty"`
+
+	// Group is a free-form name shared by related links, e.g. "jira", to list
+	// and filter them together.
+	Group string `json:"Group,omitempty"`
+
+	// Tags are free-form labels, e.g. "jira" and "deprecated", to list and
+	// filter the links by. Unlike the Group, a link can have several.
+	Tags []string `json:"Tags,omitempty"`
+
+	// Description tells why the link exists, e.g. what its pattern matches,
+	// and Owner who to ask before changing or deleting it, e.g. `@alice` or
+	// a team name. Both are free text, only shown to the admins.
+	Description string `json:"Description,omitempty"`
+	Owner       string `json:"Owner,omitempty"`
+
+	// PluginID is the ID of the plugin that registered the link through the
+	// plugin API. Links registered by a plugin can only be modified by that
+	// plugin (or an admin), and are removed when the plugin is uninstalled.
+	PluginID string `json:"PluginID,omitempty"`
+
+	// Enrich names the enricher that adds details looked up from an external
+	// system to the generated link text, e.g. "jira".
+	// EnrichTTL is how long the link reuses the details looked up for the
+	// same generated text, as a Go duration, e.g. "1h", instead of the cache
+	// duration of the enricher.
+	Enrich    string `json:"Enrich,omitempty"`
+	EnrichTTL string `json:"EnrichTTL,omitempty"`
+
+	// FallbackTemplate replaces the matches whose lookup failed, e.g. when
+	// Jira is unreachable or a permalink can not be quoted, instead of the
+	// text generated by the Template, or of the match left as is.
+	FallbackTemplate string `json:"FallbackTemplate,omitempty"`
+
+	// ActiveFrom and ActiveUntil limit the link to a time window, as RFC 3339
+	// timestamps. Schedule further limits it to the minutes matching a
+	// cron-like schedule, e.g. "* 9-17 * * 1-5". Both are optional.
+	ActiveFrom  string `json:"ActiveFrom,omitempty"`
+	ActiveUntil string `json:"ActiveUntil,omitempty"`
+	Schedule    string `json:"Schedule,omitempty"`
+
+	// ExpiresAt is the RFC 3339 time after which the link stops matching and
+	// the plugin admins are asked to delete it. ExpiryNotified is the value of
+	// ExpiresAt they were notified for.
+	ExpiresAt      string `json:"ExpiresAt,omitempty"`
+	ExpiryNotified string `json:"ExpiryNotified,omitempty"`
+
+	// Terminal keeps the links that come after this one from changing the
+	// text it generated. With TerminalPost, they are not applied to the post
+	// at all once this link matched it.
+	Terminal     bool `json:"Terminal,omitempty"`
+	TerminalPost bool `json:"TerminalPost,omitempty"`
+
+	// Debug logs every evaluation of the link at the debug level, to trace a
+	// single link without verbose logging for the whole plugin.
+	Debug bool `json:"Debug,omitempty"`
+
+	// ShadowMode evaluates the link and records its matches and stats, but
+	// never changes the posts, to trial a new pattern against live traffic
+	// before enabling it for real.
+	ShadowMode bool `json:"ShadowMode,omitempty"`
+
+	// Attachment is a message attachment added to the post for each match,
+	// e.g. with the details of an incident. The match is also replaced with
+	// Template, unless it is empty.
+	Attachment *AttachmentTemplate `json:"Attachment,omitempty"`
+
+	// Threads limits the link to the root posts of threads, to their
+	// replies, or to the threads whose root post the link matches, with
+	// ThreadsRoot, ThreadsReplies and ThreadsMatchingRoot respectively. The
+	// link applies to all posts by default.
+	Threads string `json:"Threads,omitempty"`
+
+	// Mentions map captured values, e.g. the name of an on-call rotation, to
+	// the `@username` or `~channel` mention substituted for them by the
+	// `mention` template modifier, ignoring case.
+	Mentions map[string]string `json:"Mentions,omitempty"`
+
+	// Cases are alternative templates selected by the value of a capture
+	// group. The first matching case is used, Template otherwise.
+	Cases []TemplateCase `json:"Cases,omitempty"`
+
+	// LocaleTemplates are alternative templates by locale, e.g. `es` or
+	// `pt-BR`, used for the posts of the authors with that locale, or that
+	// language, when no case matches.
+	LocaleTemplates map[string]string `json:"LocaleTemplates,omitempty"`
+
+	// ScopeTemplates are alternative templates by scope, `team/channel` or
+	// `team`, used for the posts of that channel, or of the channels of that
+	// team, when no case matches, e.g. for the same ticket format to link to
+	// the tracker of each team. They take precedence over LocaleTemplates.
+	ScopeTemplates map[string]string `json:"ScopeTemplates,omitempty"`
+
+	// Engine is the regular expression engine of the patterns, EngineRE2 if
+	// empty, or EngineBacktracking for patterns using lookarounds or
+	// backreferences.
+	Engine string `json:"Engine,omitempty"`
+
+	// Style is how the text generated by the templates is shown: StyleBold,
+	// StyleCode for inline code, or StylePlain for the bare URL of a markdown
+	// link. TextPrefix and TextSuffix are literal text added before and after
+	// it, e.g. an emoji.
+	Style      string `json:"Style,omitempty"`
+	TextPrefix string `json:"TextPrefix,omitempty"`
+	TextSuffix string `json:"TextSuffix,omitempty"`
+
+	// Kind is a specialized kind of link, KindCommit for Git commit SHAs,
+	// KindShorten for URLs shortened into a link whose text is the Template,
+	// KindPermalink for permalinks replaced with a quote of their post,
+	// KindRedact for text masked instead of linked, KindReject for posts
+	// rejected instead of changed, or KindKeyword for `@keywords` such as
+	// `@oncall`.
+	// Repositories are the base URLs of the repositories of the commits, by
+	// scope: "team/channel", "team", or DefaultRepository for the other
+	// posts. Templates reference the one of the post as `${post.repository}`.
+	Kind         string            `json:"Kind,omitempty"`
+	Repositories map[string]string `json:"Repositories,omitempty"`
+
 	template      string
-	re            *regexp.Regexp
+	templateParts []templatePart
+	cases         []compiledCase
+	locales       map[string]compiledAltTemplate
+	scopes        map[string]compiledAltTemplate
+	fallback      *compiledAltTemplate
+	re            matcher
 	canReplaceAll bool
+	enricher      Enricher
+	// enrichDeadline is when the enricher stops looking up the details of
+	// the matches of the post
+	enrichDeadline time.Time
+	// postLookup looks up the posts linked by a permalink link
+	postLookup  PostLookup
+	activeFrom  time.Time
+	activeUntil time.Time
+	expiresAt   time.Time
+	schedule    *schedule
+	attachment  compiledAttachment
+	usesPost    bool
+	post        *PostContext
+	// replaced are the matches already replaced in the post, for
+	// FirstMatchOnly
+	replaced    map[string]bool
+	matchFilter MatchFilter
+	variables   map[string]string
+	fragments   map[string]string
+}
+
+// mentionRegexp matches the mentions of a user or of a channel.
+var mentionRegexp = regexp.MustCompile(`^[@~][a-zA-Z0-9._-]+$`)
+
+// Values of Threads.
+const (
+	ThreadsRoot         = "root"
+	ThreadsReplies      = "replies"
+	ThreadsMatchingRoot = "matching-root"
+)
+
+// TemplateCase is an alternative template used when the capture group Group
+// matched Value.
+type TemplateCase struct {
+	Group    string `json:"Group"`
+	Value    string `json:"Value"`
+	Template string `json:"Template"`
+}
+
+type compiledCase struct {
+	TemplateCase
+	template      string
+	templateParts []templatePart
+}
+
+// Enricher adds details looked up from an external system to the text
+// generated for a single match. It returns the text as is if the lookup
+// failed.
+type Enricher interface {
+	Enrich(replacement string) string
 }
 
+// DeadlineEnricher is an Enricher whose lookups can be cut short, for the
+// lookups of a post not to delay it past a deadline. It returns the text as is
+// if the lookup is not done by the deadline.
+type DeadlineEnricher interface {
+	Enricher
+	EnrichBefore(replacement string, deadline time.Time) string
+}
+
+// MatchFilter inspects the text generated for a match before it replaces the
+// match, the characters matched around it as boundaries being left out of
+// both. It returns the text replacing the match, which it may transform, and
+// false to leave the match as is.
+type MatchFilter func(l Autolink, match, replacement string) (string, bool)
+
 func (l Autolink) Equals(x Autolink) bool {
 	if l.Disabled != x.Disabled ||
 		l.DisableNonWordPrefix != x.DisableNonWordPrefix ||
 		l.DisableNonWordSuffix != x.DisableNonWordSuffix ||
 		l.ProcessBotPosts != x.ProcessBotPosts ||
+		l.ProcessIntegrationPosts != x.ProcessIntegrationPosts ||
+		l.ProcessPluginPosts != x.ProcessPluginPosts ||
+		!equalBoolPtrs(l.ProcessOnUpdate, x.ProcessOnUpdate) ||
+		l.MaxReplacements != x.MaxReplacements ||
+		l.FirstMatchOnly != x.FirstMatchOnly ||
+		l.ProcessLinkLabels != x.ProcessLinkLabels ||
+		l.CodeBlocks != x.CodeBlocks ||
+		l.CodeSpans != x.CodeSpans ||
+		l.CodeOnly != x.CodeOnly ||
+		l.CaseInsensitive != x.CaseInsensitive ||
+		l.MultiLine != x.MultiLine ||
+		l.DotAll != x.DotAll ||
+		l.AcrossLines != x.AcrossLines ||
+		l.UnicodeWordMatch != x.UnicodeWordMatch ||
+		l.BoundaryClass != x.BoundaryClass ||
+		l.PrefixChars != x.PrefixChars ||
+		l.SuffixChars != x.SuffixChars ||
+		l.ActiveFrom != x.ActiveFrom ||
+		l.ActiveUntil != x.ActiveUntil ||
+		l.Schedule != x.Schedule ||
+		l.ExpiresAt != x.ExpiresAt ||
+		l.ExpiryNotified != x.ExpiryNotified ||
+		l.Terminal != x.Terminal ||
+		l.TerminalPost != x.TerminalPost ||
+		l.Debug != x.Debug ||
+		l.ShadowMode != x.ShadowMode ||
+		l.Threads != x.Threads ||
+		l.Engine != x.Engine ||
+		l.Style != x.Style ||
+		l.TextPrefix != x.TextPrefix ||
+		l.TextSuffix != x.TextSuffix ||
+		l.Kind != x.Kind ||
+		len(l.Repositories) != len(x.Repositories) ||
+		l.Group != x.Group ||
+		!equalStrings(l.Tags, x.Tags) ||
+		l.Description != x.Description ||
+		l.Owner != x.Owner ||
+		l.WebhookURL != x.WebhookURL ||
 		l.Name != x.Name ||
+		l.PluginID != x.PluginID ||
+		l.Enrich != x.Enrich ||
+		l.EnrichTTL != x.EnrichTTL ||
+		l.FallbackTemplate != x.FallbackTemplate ||
 		l.Pattern != x.Pattern ||
 		len(l.Scope) != len(x.Scope) ||
+		len(l.Cases) != len(x.Cases) ||
+		!equalStrings(l.Patterns, x.Patterns) ||
+		!equalStrings(l.BotAllowlist, x.BotAllowlist) ||
+		!equalStrings(l.BotDenylist, x.BotDenylist) ||
 		l.Template != x.Template ||
-		l.WordMatch != x.WordMatch {
+		l.WordMatch != x.WordMatch ||
+		!l.Attachment.equals(x.Attachment) ||
+		len(l.Mentions) != len(x.Mentions) ||
+		len(l.LocaleTemplates) != len(x.LocaleTemplates) ||
+		len(l.ScopeTemplates) != len(x.ScopeTemplates) {
 		return false
 	}
 	for i, scope := range l.Scope {
@@ -39,6 +357,50 @@ func (l Autolink) Equals(x Autolink) bool {
 			return false
 		}
 	}
+	for i, c := range l.Cases {
+		if c != x.Cases[i] {
+			return false
+		}
+	}
+	for value, mention := range l.Mentions {
+		if other, ok := x.Mentions[value]; !ok || other != mention {
+			return false
+		}
+	}
+	for scope, repository := range l.Repositories {
+		if other, ok := x.Repositories[scope]; !ok || other != repository {
+			return false
+		}
+	}
+	for locale, template := range l.LocaleTemplates {
+		if other, ok := x.LocaleTemplates[locale]; !ok || other != template {
+			return false
+		}
+	}
+	for scope, template := range l.ScopeTemplates {
+		if other, ok := x.ScopeTemplates[scope]; !ok || other != template {
+			return false
+		}
+	}
+	return true
+}
+
+func equalBoolPtrs(a, b *bool) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
 	return true
 }
 
@@ -50,61 +412,627 @@ func (l Autolink) DisplayName() string {
 	return l.Pattern
 }
 
+// ProcessesBot reports whether the posts of the bot with the given username
+// are processed.
+func (l Autolink) ProcessesBot(username string) bool {
+	if l.DeniesBot(username) {
+		return false
+	}
+	if len(l.BotAllowlist) != 0 {
+		return containsUsername(l.BotAllowlist, username)
+	}
+	return l.ProcessBotPosts
+}
+
+// AppliesOnUpdate reports whether the link applies to edited posts, given
+// whether the plugin is configured to process them.
+func (l Autolink) AppliesOnUpdate(enabled bool) bool {
+	if l.ProcessOnUpdate != nil {
+		return *l.ProcessOnUpdate
+	}
+	return enabled
+}
+
+// DeniesBot reports whether the bot with the given username is in the
+// BotDenylist of the link.
+func (l Autolink) DeniesBot(username string) bool {
+	return containsUsername(l.BotDenylist, username)
+}
+
+// ChecksBots reports whether processing depends on the author being a bot.
+func (l Autolink) ChecksBots() bool {
+	return !l.ProcessBotPosts || len(l.BotAllowlist) != 0 || len(l.BotDenylist) != 0
+}
+
+func containsUsername(usernames []string, username string) bool {
+	for _, u := range usernames {
+		if strings.EqualFold(strings.TrimPrefix(u, "@"), username) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasTag reports whether the link has the tag, ignoring case.
+func (l Autolink) HasTag(tag string) bool {
+	for _, t := range l.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllPatterns returns Pattern followed by the non-empty alternative Patterns.
+func (l Autolink) AllPatterns() []string {
+	var patterns []string
+	for _, pattern := range append([]string{l.Pattern}, l.Patterns...) {
+		if pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// ScopeTeams returns the names of the teams the link is scoped to, or nil if
+// the link applies everywhere.
+func (l Autolink) ScopeTeams() []string {
+	var teams []string
+	seen := map[string]bool{}
+	for _, scope := range l.Scope {
+		team := strings.ToLower(strings.SplitN(scope, "/", 2)[0])
+		if team == "" || seen[team] {
+			continue
+		}
+		seen[team] = true
+		teams = append(teams, team)
+	}
+	return teams
+}
+
+// InScope reports whether the link has the exact scope, ignoring case, or for
+// a team, whether it is scoped to the team or to any of its channels.
+func (l Autolink) InScope(scope string) bool {
+	for _, s := range l.Scope {
+		if strings.EqualFold(s, scope) || strings.HasPrefix(strings.ToLower(s), strings.ToLower(scope)+"/") {
+			return true
+		}
+	}
+	return false
+}
+
 // Compile compiles the link's regular expression
 func (l *Autolink) Compile() error {
-	if l.Disabled || len(l.Pattern) == 0 || len(l.Template) == 0 {
+	if err := l.compileSchedule(); err != nil {
+		return err
+	}
+	switch l.Threads {
+	case "", ThreadsRoot, ThreadsReplies, ThreadsMatchingRoot:
+	default:
+		return errors.Errorf("invalid Threads %q, must be %q, %q or %q", l.Threads, ThreadsRoot, ThreadsReplies, ThreadsMatchingRoot)
+	}
+	if err := ValidateWebhookURL(l.WebhookURL); err != nil {
+		return err
+	}
+	if err := l.checkStyle(); err != nil {
+		return err
+	}
+	if l.CodeOnly && !l.CodeBlocks && !l.CodeSpans {
+		return errors.New("CodeOnly requires CodeBlocks or CodeSpans")
+	}
+	if err := l.compileKind(); err != nil {
+		return err
+	}
+	if l.EnrichTTL != "" {
+		if l.Enrich == "" {
+			return errors.New("EnrichTTL requires Enrich")
+		}
+		if ttl, err := time.ParseDuration(l.EnrichTTL); err != nil || ttl <= 0 {
+			return errors.Errorf("invalid EnrichTTL %q, must be a positive duration such as 30m or 1h", l.EnrichTTL)
+		}
+	}
+	for value, mention := range l.Mentions {
+		if !mentionRegexp.MatchString(mention) {
+			return errors.Errorf("invalid mention %q for %q, must be an @username or a ~channel", mention, value)
+		}
+	}
+
+	patterns := l.expandedPatterns()
+	if l.Disabled || len(patterns) == 0 || l.isNoop() {
 		return nil
 	}
 
 	// `\b` can be used with ReplaceAll since it does not consume characters,
 	// custom patterns can not and need to be processed one at a time.
 	canReplaceAll := false
-	pattern := l.Pattern
-	template := l.Template
-	if !l.DisableNonWordPrefix {
-		if l.WordMatch {
+	// Each pattern is checked on its own first, so that errors point to it
+	// rather than to the boundary groups added below
+	for _, alias := range patterns {
+		if _, err := compileRegexp(l.Engine, alias); err != nil {
+			return err
+		}
+	}
+	pattern := patterns[0]
+	if len(patterns) > 1 {
+		pattern = `(?:(?:` + strings.Join(patterns, `)|(?:`) + `))`
+	}
+	prefix, suffix := "", ""
+	prefixBoundary, err := l.boundary(l.PrefixChars)
+	if err != nil {
+		return err
+	}
+	suffixBoundary, err := l.boundary(l.SuffixChars)
+	if err != nil {
+		return err
+	}
+	if !l.DisableNonWordPrefix && l.Kind != KindShorten && l.Kind != KindPermalink && l.Kind != KindKeyword {
+		switch {
+		case prefixBoundary != "":
+			pattern = `(?P<MattermostNonWordPrefix>^|` + prefixBoundary + `)` + pattern
+			prefix = `${MattermostNonWordPrefix}`
+		case l.WordMatch:
 			pattern = `\b` + pattern
 			canReplaceAll = true
-		} else {
+		default:
 			pattern = `(?P<MattermostNonWordPrefix>(^|\s))` + pattern
-			template = `${MattermostNonWordPrefix}` + template
+			prefix = `${MattermostNonWordPrefix}`
 		}
 	}
-	if !l.DisableNonWordSuffix {
-		if l.WordMatch {
+	if !l.DisableNonWordSuffix && l.Kind != KindShorten && l.Kind != KindPermalink && l.Kind != KindKeyword {
+		switch {
+		case suffixBoundary != "":
+			pattern += `(?P<MattermostNonWordSuffix>$|` + suffixBoundary + `)`
+			suffix = `${MattermostNonWordSuffix}`
+		case l.WordMatch:
 			pattern += `\b`
 			canReplaceAll = true
-		} else {
+		default:
 			pattern += `(?P<MattermostNonWordSuffix>$|[\s\.\!\?\,\)])`
-			template += `${MattermostNonWordSuffix}`
+			suffix = `${MattermostNonWordSuffix}`
 		}
 	}
 
-	re, err := regexp.Compile(pattern)
+	if l.Kind == KindShorten || l.Kind == KindPermalink {
+		pattern = shortenPrefix + `(?P<` + shortenURLGroup + `>` + pattern + `)` + shortenSuffix
+		prefix, suffix = `${MattermostNonWordPrefix}`, `${MattermostNonWordSuffix}`
+	}
+	if l.Kind == KindKeyword {
+		pattern = keywordPrefix + `(?:` + pattern + `)` + keywordSuffix
+		prefix, suffix = `${MattermostNonWordPrefix}`, `${MattermostNonWordSuffix}`
+	}
+
+	if l.CaseInsensitive || l.Kind == KindKeyword {
+		pattern = `(?i)` + pattern
+	}
+	if l.MultiLine {
+		pattern = `(?m)` + pattern
+	}
+	if l.DotAll {
+		pattern = `(?s)` + pattern
+	}
+
+	re, err := compileRegexp(l.Engine, pattern)
+	if err != nil {
+		return err
+	}
+	template := prefix + l.styleTemplate(l.linkTemplate(l.expandVariables(l.Template))) + suffix
+	parts, err := compileTemplate(template, l.Mentions)
+	if err != nil {
+		return err
+	}
+	var cases []compiledCase
+	for _, c := range l.Cases {
+		if c.Group == "" {
+			return errors.New("a template case must name a capture group")
+		}
+		caseTemplate := prefix + l.styleTemplate(l.linkTemplate(l.expandVariables(c.Template))) + suffix
+		caseParts, err := compileTemplate(caseTemplate, l.Mentions)
+		if err != nil {
+			return err
+		}
+		cases = append(cases, compiledCase{
+			TemplateCase:  c,
+			template:      caseTemplate,
+			templateParts: caseParts,
+		})
+	}
+	locales, err := l.compileLocaleTemplates(prefix, suffix)
+	if err != nil {
+		return err
+	}
+	scopes, err := l.compileScopeTemplates(prefix, suffix)
+	if err != nil {
+		return err
+	}
+	fallback, err := l.compileFallbackTemplate(prefix, suffix)
 	if err != nil {
 		return err
 	}
+	var attachment compiledAttachment
+	if l.Attachment != nil {
+		if attachment, err = compileAttachment(l.Attachment, l.Mentions, l.expandVariables); err != nil {
+			return err
+		}
+	}
+
 	l.re = re
+	l.attachment = attachment
 	l.template = template
+	l.templateParts = parts
+	l.cases = cases
+	l.locales = locales
+	l.scopes = scopes
+	l.fallback = fallback
 	l.canReplaceAll = canReplaceAll
+	l.usesPost = usesPostVariables(parts)
+	for _, c := range cases {
+		l.usesPost = l.usesPost || usesPostVariables(c.templateParts)
+	}
+	for _, t := range locales {
+		l.usesPost = l.usesPost || usesPostVariables(t.templateParts)
+	}
+	for _, t := range scopes {
+		l.usesPost = l.usesPost || usesPostVariables(t.templateParts)
+	}
+	if fallback != nil {
+		l.usesPost = l.usesPost || usesPostVariables(fallback.templateParts)
+	}
+	for _, attachmentParts := range attachment {
+		l.usesPost = l.usesPost || usesPostVariables(attachmentParts)
+	}
+
+	return nil
+}
+
+// compileSchedule parses the time window and schedule of the link.
+func (l *Autolink) compileSchedule() error {
+	l.activeFrom, l.activeUntil, l.expiresAt, l.schedule = time.Time{}, time.Time{}, time.Time{}, nil
+	if l.ActiveFrom != "" {
+		t, err := time.Parse(time.RFC3339, l.ActiveFrom)
+		if err != nil {
+			return errors.Wrap(err, "invalid ActiveFrom")
+		}
+		l.activeFrom = t
+	}
+	if l.ActiveUntil != "" {
+		t, err := time.Parse(time.RFC3339, l.ActiveUntil)
+		if err != nil {
+			return errors.Wrap(err, "invalid ActiveUntil")
+		}
+		l.activeUntil = t
+	}
+	if l.ExpiresAt != "" {
+		t, err := time.Parse(time.RFC3339, l.ExpiresAt)
+		if err != nil {
+			return errors.Wrap(err, "invalid ExpiresAt")
+		}
+		l.expiresAt = t
+	}
+	if l.Schedule != "" {
+		s, err := parseSchedule(l.Schedule)
+		if err != nil {
+			return errors.Wrap(err, "invalid Schedule")
+		}
+		l.schedule = s
+	}
+	return nil
+}
+
+// CheckSchedule returns the error of the time window or schedule of the link,
+// if any, leaving the link as is.
+func (l Autolink) CheckSchedule() error {
+	return l.compileSchedule()
+}
+
+// IsActive reports whether the time window and schedule of a compiled link
+// include the given time, and the link has not expired.
+func (l Autolink) IsActive(now time.Time) bool {
+	if l.IsExpired(now) {
+		return false
+	}
+	if !l.activeFrom.IsZero() && now.Before(l.activeFrom) {
+		return false
+	}
+	if !l.activeUntil.IsZero() && !now.Before(l.activeUntil) {
+		return false
+	}
+	return l.schedule == nil || l.schedule.matches(now)
+}
+
+// AppliesToThread reports whether the link applies to a post, given whether it
+// is a reply and the message of the root post of its thread. rootMessage is
+// only called when needed, for the threads whose root post must match.
+func (l Autolink) AppliesToThread(isReply bool, rootMessage func() (string, bool)) bool {
+	switch l.Threads {
+	case ThreadsRoot:
+		return !isReply
+	case ThreadsReplies:
+		return isReply
+	case ThreadsMatchingRoot:
+		if !isReply {
+			return true
+		}
+		message, ok := rootMessage()
+		return ok && l.re != nil && l.re.MatchString(message)
+	}
+	return true
+}
 
+// ParseMentions parses whitespace-separated `value=mention` pairs, e.g.
+// `primary=@alice dba=~dba-oncall`, into Mentions.
+func ParseMentions(s string) (map[string]string, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	mentions := map[string]string{}
+	for _, field := range fields {
+		i := strings.LastIndex(field, "=")
+		if i <= 0 {
+			return nil, errors.Errorf("invalid mention %q, must be value=@username or value=~channel", field)
+		}
+		mentions[field[:i]] = field[i+1:]
+	}
+	return mentions, nil
+}
+
+// FormatMentions formats Mentions as ParseMentions parses them, sorted by
+// value.
+func FormatMentions(mentions map[string]string) string {
+	values := make([]string, 0, len(mentions))
+	for value := range mentions {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	pairs := make([]string, len(values))
+	for i, value := range values {
+		pairs[i] = value + "=" + mentions[value]
+	}
+	return strings.Join(pairs, " ")
+}
+
+// ValidateWebhookURL checks that a webhook URL, if not empty, is an absolute
+// HTTP or HTTPS URL.
+func ValidateWebhookURL(webhook string) error {
+	if webhook == "" {
+		return nil
+	}
+	u, err := url.Parse(webhook)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.Errorf("invalid webhook URL %q, must be an http or https URL", webhook)
+	}
 	return nil
 }
 
+// WithoutWebhooks returns a copy of the links without their WebhookURL, for
+// the callers that may not know where the events of the links are sent.
+func WithoutWebhooks(links []Autolink) []Autolink {
+	hidden := make([]Autolink, len(links))
+	for i, link := range links {
+		link.WebhookURL = ""
+		hidden[i] = link
+	}
+	return hidden
+}
+
+// IsExpired reports whether a compiled link expired at the given time.
+func (l Autolink) IsExpired(now time.Time) bool {
+	return !l.expiresAt.IsZero() && !now.Before(l.expiresAt)
+}
+
+// unicodeBoundary matches the characters that separate words in any script:
+// anything but letters, marks, digits and underscores, as well as the
+// ideographs and kana of languages that do not separate words with spaces.
+const unicodeBoundary = `[^\p{L}\p{M}\p{N}_]|[\p{Han}\p{Hiragana}\p{Katakana}]`
+
+// boundary returns the expression matching a single character before or
+// after a match, or "" if the link uses the default boundaries. chars are the
+// characters allowed on that side in addition to whitespace, if any.
+func (l Autolink) boundary(chars string) (string, error) {
+	switch {
+	case chars != "":
+		return `\s|[` + strings.Replace(regexp.QuoteMeta(chars), "-", `\-`, -1) + `]`, nil
+	case l.BoundaryClass != "":
+		if _, err := regexp.Compile(l.BoundaryClass); err != nil {
+			return "", errors.Wrap(err, "invalid boundary class")
+		}
+		return `(?:` + l.BoundaryClass + `)`, nil
+	case l.UnicodeWordMatch:
+		return unicodeBoundary, nil
+	}
+	return "", nil
+}
+
+// compileTemplate parses a template, returning nil parts if the template can be
+// expanded by regexp.Expand.
+func compileTemplate(template string, mentions map[string]string) ([]templatePart, error) {
+	parts, hasModifiers, err := parseTemplate(template, mentions)
+	if err != nil || !hasModifiers {
+		return nil, err
+	}
+	return parts, nil
+}
+
+// SetEnricher sets the enricher applied to the text generated for each match.
+func (l *Autolink) SetEnricher(e Enricher) {
+	l.enricher = e
+}
+
+// SetEnrichDeadline sets the time after which the enricher, if it supports
+// deadlines, no longer waits for the lookups of the post the link is applied
+// to.
+func (l *Autolink) SetEnrichDeadline(deadline time.Time) {
+	l.enrichDeadline = deadline
+}
+
+// EnrichCacheTTL returns how long the details looked up by the enricher are
+// reused for the same generated text, or 0 to use the cache of the enricher.
+func (l Autolink) EnrichCacheTTL() time.Duration {
+	ttl, err := time.ParseDuration(l.EnrichTTL)
+	if err != nil || ttl <= 0 {
+		return 0
+	}
+	return ttl
+}
+
+// SetMatchFilter sets the filter applied to the text generated for each
+// match, after the enricher.
+func (l *Autolink) SetMatchFilter(f MatchFilter) {
+	l.matchFilter = f
+}
+
+// ReplacesMatches reports whether the link replaces the text it matches: links
+// with a Template, except reject links, and redact and permalink links. Links with only an
+// Attachment leave the message as is.
+func (l Autolink) ReplacesMatches() bool {
+	return (l.Template != "" && l.Kind != KindReject) || l.Kind == KindRedact || l.Kind == KindPermalink
+}
+
+// isNoop reports whether the link has no effect on the posts, neither
+// replacing its matches, nor adding attachments, nor rejecting them. Such links
+// are not compiled.
+func (l Autolink) isNoop() bool {
+	return !l.ReplacesMatches() && l.Attachment == nil && l.Kind != KindReject
+}
+
+// UsesPostContext reports whether the templates of a compiled link use post
+// variables, which are empty unless SetPostContext is called.
+func (l Autolink) UsesPostContext() bool {
+	return l.usesPost || l.Kind == KindCommit || len(l.locales) > 0 || len(l.scopes) > 0
+}
+
+// SetPostContext sets the post the link is applied to, for the post variables
+// of its templates. The repository of commit links is looked up for it.
+func (l *Autolink) SetPostContext(post *PostContext) {
+	if l.Kind == KindCommit && post != nil {
+		withRepository := *post
+		withRepository.Repository = l.Repository(post.TeamName, post.ChannelName)
+		post = &withRepository
+	}
+	l.post = post
+}
+
+// SetReplaced sets the matches already replaced in the post, shared by the
+// calls replacing the parts of a single post, for FirstMatchOnly links to
+// leave the repeated matches as is.
+func (l *Autolink) SetReplaced(replaced map[string]bool) {
+	l.replaced = replaced
+}
+
 // Replace will subsitute the regex's with the supplied links
 func (l Autolink) Replace(message string) string {
-	if l.re == nil {
-		return message
+	// Since they don't consume, `\b`s require no special handling, can just ReplaceAll
+	re, isRE2 := l.re.(*regexp.Regexp)
+	if isRE2 && l.ReplacesMatches() && l.canReplaceAll && l.enricher == nil && l.matchFilter == nil && l.templateParts == nil && len(l.cases) == 0 && len(l.locales) == 0 && len(l.scopes) == 0 && !l.FirstMatchOnly {
+		return re.ReplaceAllString(message, l.template)
+	}
+
+	out, _, _ := l.ReplaceN(message, -1)
+	return out
+}
+
+// ReplaceN is like Replace, but substitutes at most n matches if n is not
+// negative. It returns the number of substitutions made, and whether matches
+// were left unsubstituted because of the limit.
+func (l Autolink) ReplaceN(message string, n int) (string, int, bool) {
+	spans, count, truncated := l.ReplaceSpans(message, n)
+	if count == 0 {
+		return message, 0, truncated
+	}
+	out := make([]byte, 0, len(message))
+	for _, span := range spans {
+		out = append(out, span.Text...)
+	}
+	return string(out), count, truncated
+}
+
+// Span is a part of a message, generated by a link if Replaced is true.
+type Span struct {
+	Text     string
+	Replaced bool
+}
+
+// ReplaceSpans is like ReplaceN, but returns the message split into the text
+// generated for each match, and the text between matches.
+func (l Autolink) ReplaceSpans(message string, n int) ([]Span, int, bool) {
+	// Links with only an Attachment leave the message as is
+	if l.re == nil || !l.ReplacesMatches() {
+		return []Span{{Text: message}}, 0, false
+	}
+	// Permalinks are only linked once the posts can be looked up
+	if l.Kind == KindPermalink && l.postLookup == nil {
+		return []Span{{Text: message}}, 0, false
+	}
+	// Commits are only linked in the channels they have a repository in
+	if l.Kind == KindCommit {
+		if l.post == nil {
+			l.SetPostContext(&PostContext{})
+		}
+		if l.post.Repository == "" {
+			return []Span{{Text: message}}, 0, false
+		}
+	}
+
+	var spans []Span
+	addSpan := func(text []byte, replaced bool) {
+		if len(text) > 0 {
+			spans = append(spans, Span{Text: string(text), Replaced: replaced})
+		}
+	}
+
+	replaced := l.replaced
+	if l.FirstMatchOnly && replaced == nil {
+		replaced = map[string]bool{}
+	}
+	// repeated reports whether the match was replaced before, for
+	// FirstMatchOnly links, and returns the key it is recorded with
+	repeated := func(src []byte, submatch []int) (string, bool) {
+		if replaced == nil {
+			return "", false
+		}
+		key := l.matchText(src, submatch)
+		if l.CaseInsensitive {
+			key = strings.ToLower(key)
+		}
+		return key, replaced[key]
 	}
 
-	// Since they don't consume, `\b`s require no special handling, can just ReplaceAll
 	if l.canReplaceAll {
-		return l.re.ReplaceAllString(message, l.template)
+		in := []byte(message)
+		last := 0
+		limit := -1
+		if n >= 0 && replaced == nil && l.matchFilter == nil {
+			limit = n + 1
+		}
+		count := 0
+		truncated := false
+		for _, submatch := range l.re.FindAllSubmatchIndex(in, limit) {
+			key, isRepeated := repeated(in, submatch)
+			if isRepeated {
+				continue
+			}
+			if n >= 0 && count == n {
+				truncated = true
+				break
+			}
+			addSpan(in[last:submatch[0]], false)
+			last = submatch[1]
+			if !l.addExpandedSpans(addSpan, in, submatch) {
+				continue
+			}
+			if replaced != nil {
+				replaced[key] = true
+			}
+			count++
+		}
+		addSpan(in[last:], false)
+		return spans, count, truncated
 	}
 
 	// Replace one at a time
 	in := []byte(message)
-	out := []byte{}
+	count := 0
+	truncated := false
 	for {
 		if len(in) == 0 {
 			break
@@ -114,13 +1042,166 @@ func (l Autolink) Replace(message string) string {
 		if submatch == nil {
 			break
 		}
+		key, isRepeated := repeated(in, submatch)
+		if isRepeated {
+			addSpan(in[:submatch[1]], false)
+			in = in[submatch[1]:]
+			continue
+		}
+		if n >= 0 && count == n {
+			truncated = true
+			break
+		}
 
-		out = append(out, in[:submatch[0]]...)
-		out = l.re.Expand(out, []byte(l.template), in, submatch)
+		addSpan(in[:submatch[0]], false)
+		ok := l.addExpandedSpans(addSpan, in, submatch)
 		in = in[submatch[1]:]
+		if !ok {
+			continue
+		}
+		if replaced != nil {
+			replaced[key] = true
+		}
+		count++
+	}
+	addSpan(in, false)
+	return spans, count, truncated
+}
+
+// addExpandedSpans adds the spans of the text generated for a match: the text
+// generated from the template, and the characters matched around it as
+// boundaries, which are kept as is. It returns false if the match filter left
+// the match as is instead.
+func (l Autolink) addExpandedSpans(addSpan func([]byte, bool), src []byte, submatch []int) bool {
+	prefix := submatchValue(l.re, "MattermostNonWordPrefix", src, submatch)
+	suffix := submatchValue(l.re, "MattermostNonWordSuffix", src, submatch)
+	var expanded []byte
+	if l.Kind == KindPermalink {
+		// The posts that can not be quoted are left as is
+		text, ok := l.permalinkText(src, submatch)
+		switch {
+		case ok:
+			expanded = append(append(append(expanded, prefix...), text...), suffix...)
+		case l.fallback != nil:
+			expanded = l.expandFallback(nil, src, submatch)
+		default:
+			addSpan(src[submatch[0]:submatch[1]], false)
+			return false
+		}
+	} else {
+		expanded = l.expand(nil, src, submatch)
+	}
+	if !bytes.HasPrefix(expanded, prefix) || !bytes.HasSuffix(expanded[len(prefix):], suffix) {
+		prefix, suffix = nil, nil
+	}
+	generated := expanded[len(prefix) : len(expanded)-len(suffix)]
+
+	if l.matchFilter != nil {
+		replacement, ok := l.matchFilter(l, l.matchText(src, submatch), string(generated))
+		if !ok {
+			addSpan(src[submatch[0]:submatch[1]], false)
+			return false
+		}
+		generated = []byte(replacement)
+	}
+
+	addSpan(prefix, false)
+	addSpan(generated, true)
+	addSpan(suffix, false)
+	return true
+}
+
+// Matches returns the text of each match of the link in the message, without
+// the characters matched around it as boundaries.
+func (l Autolink) Matches(message string) []string {
+	if l.re == nil {
+		return nil
+	}
+
+	var matches []string
+	add := func(src []byte, match []int) {
+		matches = append(matches, l.matchText(src, match))
 	}
-	out = append(out, in...)
-	return string(out)
+
+	src := []byte(message)
+	if l.canReplaceAll {
+		for _, match := range l.re.FindAllSubmatchIndex(src, -1) {
+			add(src, match)
+		}
+		return matches
+	}
+
+	// Matched one at a time, like ReplaceSpans, for the boundaries consumed
+	// by a match to be available to the next one
+	for len(src) > 0 {
+		match := l.re.FindSubmatchIndex(src)
+		if match == nil {
+			break
+		}
+		add(src, match)
+		if match[1] == 0 {
+			break
+		}
+		src = src[match[1]:]
+	}
+	return matches
+}
+
+// matchText returns the text of the match, without the characters matched
+// around it as boundaries.
+func (l Autolink) matchText(src []byte, match []int) string {
+	text := string(src[match[0]:match[1]])
+	text = strings.TrimPrefix(text, string(submatchValue(l.re, "MattermostNonWordPrefix", src, match)))
+	return strings.TrimSuffix(text, string(submatchValue(l.re, "MattermostNonWordSuffix", src, match)))
+}
+
+// expand appends the text generated for a single match to dst.
+func (l Autolink) expand(dst []byte, src []byte, submatch []int) []byte {
+	template, parts := l.selectTemplate(src, submatch)
+
+	if l.enricher == nil {
+		if parts != nil {
+			return expandTemplate(dst, l.re, parts, src, submatch, l.post)
+		}
+		return l.re.Expand(dst, []byte(template), src, submatch)
+	}
+
+	var expanded []byte
+	if parts != nil {
+		expanded = expandTemplate(nil, l.re, parts, src, submatch, l.post)
+	} else {
+		expanded = l.re.Expand(nil, []byte(template), src, submatch)
+	}
+	// The enrichers leave the text as is when the lookup fails
+	var enriched string
+	if e, ok := l.enricher.(DeadlineEnricher); ok && !l.enrichDeadline.IsZero() {
+		enriched = e.EnrichBefore(string(expanded), l.enrichDeadline)
+	} else {
+		enriched = l.enricher.Enrich(string(expanded))
+	}
+	if enriched == string(expanded) && l.fallback != nil {
+		return l.expandFallback(dst, src, submatch)
+	}
+	return append(dst, enriched...)
+}
+
+// selectTemplate returns the template of the first case matching the captured
+// values, the template of the channel or team of the post, the template of the
+// locale of the post's author, or the link's template.
+func (l Autolink) selectTemplate(src []byte, submatch []int) (string, []templatePart) {
+	for _, c := range l.cases {
+		value := string(submatchValue(l.re, c.Group, src, submatch))
+		if value == c.Value || (l.CaseInsensitive && strings.EqualFold(value, c.Value)) {
+			return c.template, c.templateParts
+		}
+	}
+	if t, ok := l.scopeTemplate(); ok {
+		return t.template, t.templateParts
+	}
+	if t, ok := l.localeTemplate(); ok {
+		return t.template, t.templateParts
+	}
+	return l.template, l.templateParts
 }
 
 // ToMarkdown prints a Link as a markdown list element
@@ -141,7 +1222,16 @@ func (l Autolink) ToMarkdown(i int) string {
 	}
 	text += "\n"
 
+	if l.Description != "" {
+		text += fmt.Sprintf("  - Description: %s\n", l.Description)
+	}
+	if l.Owner != "" {
+		text += fmt.Sprintf("  - Owner: %s\n", l.Owner)
+	}
 	text += fmt.Sprintf("  - Pattern: `%s`\n", l.Pattern)
+	if len(l.Patterns) != 0 {
+		text += fmt.Sprintf("  - Patterns: `%v`\n", l.Patterns)
+	}
 	text += fmt.Sprintf("  - Template: `%s`\n", l.Template)
 
 	if l.DisableNonWordPrefix {
@@ -153,11 +1243,222 @@ func (l Autolink) ToMarkdown(i int) string {
 	if l.ProcessBotPosts {
 		text += fmt.Sprintf("  - ProcessBotPosts: `%v`\n", l.ProcessBotPosts)
 	}
+	if l.MaxReplacements != 0 {
+		text += fmt.Sprintf("  - MaxReplacements: `%d`\n", l.MaxReplacements)
+	}
+	if l.FirstMatchOnly {
+		text += fmt.Sprintf("  - FirstMatchOnly: `%v`\n", l.FirstMatchOnly)
+	}
+	if l.ProcessLinkLabels {
+		text += fmt.Sprintf("  - ProcessLinkLabels: `%v`\n", l.ProcessLinkLabels)
+	}
+	if l.CodeBlocks {
+		text += fmt.Sprintf("  - CodeBlocks: `%v`\n", l.CodeBlocks)
+	}
+	if l.CodeSpans {
+		text += fmt.Sprintf("  - CodeSpans: `%v`\n", l.CodeSpans)
+	}
+	if l.CodeOnly {
+		text += fmt.Sprintf("  - CodeOnly: `%v`\n", l.CodeOnly)
+	}
+	if l.ProcessIntegrationPosts {
+		text += fmt.Sprintf("  - ProcessIntegrationPosts: `%v`\n", l.ProcessIntegrationPosts)
+	}
+	if l.ProcessPluginPosts {
+		text += fmt.Sprintf("  - ProcessPluginPosts: `%v`\n", l.ProcessPluginPosts)
+	}
+	if l.ProcessOnUpdate != nil {
+		text += fmt.Sprintf("  - ProcessOnUpdate: `%v`\n", *l.ProcessOnUpdate)
+	}
+	if len(l.BotAllowlist) != 0 {
+		text += fmt.Sprintf("  - BotAllowlist: `%v`\n", l.BotAllowlist)
+	}
+	if len(l.BotDenylist) != 0 {
+		text += fmt.Sprintf("  - BotDenylist: `%v`\n", l.BotDenylist)
+	}
 	if len(l.Scope) != 0 {
 		text += fmt.Sprintf("  - Scope: `%v`\n", l.Scope)
 	}
 	if l.WordMatch {
 		text += fmt.Sprintf("  - WordMatch: `%v`\n", l.WordMatch)
 	}
+	if l.CaseInsensitive {
+		text += fmt.Sprintf("  - CaseInsensitive: `%v`\n", l.CaseInsensitive)
+	}
+	if l.MultiLine {
+		text += fmt.Sprintf("  - MultiLine: `%v`\n", l.MultiLine)
+	}
+	if l.DotAll {
+		text += fmt.Sprintf("  - DotAll: `%v`\n", l.DotAll)
+	}
+	if l.AcrossLines {
+		text += fmt.Sprintf("  - AcrossLines: `%v`\n", l.AcrossLines)
+	}
+	if l.UnicodeWordMatch {
+		text += fmt.Sprintf("  - UnicodeWordMatch: `%v`\n", l.UnicodeWordMatch)
+	}
+	if l.BoundaryClass != "" {
+		text += fmt.Sprintf("  - BoundaryClass: `%s`\n", l.BoundaryClass)
+	}
+	if l.ActiveFrom != "" {
+		text += fmt.Sprintf("  - ActiveFrom: `%s`\n", l.ActiveFrom)
+	}
+	if l.ActiveUntil != "" {
+		text += fmt.Sprintf("  - ActiveUntil: `%s`\n", l.ActiveUntil)
+	}
+	if l.ExpiresAt != "" {
+		text += fmt.Sprintf("  - ExpiresAt: `%s`\n", l.ExpiresAt)
+	}
+	if l.Schedule != "" {
+		text += fmt.Sprintf("  - Schedule: `%s`\n", l.Schedule)
+	}
+	if l.PrefixChars != "" {
+		text += fmt.Sprintf("  - PrefixChars: `%s`\n", l.PrefixChars)
+	}
+	if l.SuffixChars != "" {
+		text += fmt.Sprintf("  - SuffixChars: `%s`\n", l.SuffixChars)
+	}
+	if l.PluginID != "" {
+		text += fmt.Sprintf("  - PluginID: `%s`\n", l.PluginID)
+	}
+	if l.Enrich != "" {
+		text += fmt.Sprintf("  - Enrich: `%s`\n", l.Enrich)
+	}
+	if l.EnrichTTL != "" {
+		text += fmt.Sprintf("  - EnrichTTL: `%s`\n", l.EnrichTTL)
+	}
+	if l.FallbackTemplate != "" {
+		text += fmt.Sprintf("  - FallbackTemplate: `%s`\n", l.FallbackTemplate)
+	}
+	if l.Attachment != nil {
+		attachment, _ := json.Marshal(l.Attachment)
+		text += fmt.Sprintf("  - Attachment: `%s`\n", attachment)
+	}
+	if l.Terminal {
+		text += fmt.Sprintf("  - Terminal: `%v`\n", l.Terminal)
+	}
+	if l.TerminalPost {
+		text += fmt.Sprintf("  - TerminalPost: `%v`\n", l.TerminalPost)
+	}
+	if l.Debug {
+		text += fmt.Sprintf("  - Debug: `%v`\n", l.Debug)
+	}
+	if l.ShadowMode {
+		text += fmt.Sprintf("  - ShadowMode: `%v`\n", l.ShadowMode)
+	}
+	if l.Threads != "" {
+		text += fmt.Sprintf("  - Threads: `%s`\n", l.Threads)
+	}
+	if l.Engine != "" {
+		text += fmt.Sprintf("  - Engine: `%s`\n", l.Engine)
+	}
+	if l.Style != "" {
+		text += fmt.Sprintf("  - Style: `%s`\n", l.Style)
+	}
+	if l.TextPrefix != "" {
+		text += fmt.Sprintf("  - TextPrefix: `%s`\n", l.TextPrefix)
+	}
+	if l.TextSuffix != "" {
+		text += fmt.Sprintf("  - TextSuffix: `%s`\n", l.TextSuffix)
+	}
+	if l.Kind != "" {
+		text += fmt.Sprintf("  - Kind: `%s`\n", l.Kind)
+	}
+	if len(l.Repositories) != 0 {
+		text += fmt.Sprintf("  - Repositories: `%s`\n", FormatRepositories(l.Repositories))
+	}
+	if l.Group != "" {
+		text += fmt.Sprintf("  - Group: `%s`\n", l.Group)
+	}
+	if len(l.Tags) != 0 {
+		text += fmt.Sprintf("  - Tags: `%s`\n", strings.Join(l.Tags, " "))
+	}
+	if l.WebhookURL != "" {
+		text += fmt.Sprintf("  - WebhookURL: `%s`\n", l.WebhookURL)
+	}
+	for _, c := range l.Cases {
+		text += fmt.Sprintf("  - Case `%s` is `%s`: `%s`\n", c.Group, c.Value, c.Template)
+	}
+	for _, locale := range sortedKeys(l.LocaleTemplates) {
+		text += fmt.Sprintf("  - Template for `%s`: `%s`\n", locale, l.LocaleTemplates[locale])
+	}
+	for _, scope := range sortedKeys(l.ScopeTemplates) {
+		text += fmt.Sprintf("  - Template in `%s`: `%s`\n", scope, l.ScopeTemplates[scope])
+	}
+	if len(l.Mentions) != 0 {
+		text += fmt.Sprintf("  - Mentions: `%s`\n", FormatMentions(l.Mentions))
+	}
 	return text
 }
+
+// MarkdownTableHeader is the header of the markdown table of links whose rows
+// are printed by ToMarkdownTableRow.
+const MarkdownTableHeader = "| # | Name | Pattern | Template | Scope | Status |\n|---|---|---|---|---|---|\n"
+
+// ToMarkdownTableRow prints a Link as a row of a markdown table
+func (l Autolink) ToMarkdownTableRow(i int) string {
+	status := "Enabled"
+	if l.Disabled {
+		status = "Disabled"
+	}
+	return fmt.Sprintf("| %d | %s | %s | %s | %s | %s |\n",
+		i,
+		escapeTableCell(l.Name),
+		markdownCode(strings.Join(l.AllPatterns(), " ")),
+		markdownCode(l.Template),
+		escapeTableCell(strings.Join(l.Scope, " ")),
+		status)
+}
+
+// markdownCode formats s as inline code in a table cell, using enough
+// backticks to quote the ones it contains.
+func markdownCode(s string) string {
+	if s == "" {
+		return ""
+	}
+	fence := "`"
+	for strings.Contains(s, fence) {
+		fence += "`"
+	}
+	if strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+		s = " " + s + " "
+	}
+	return fence + escapeTableCell(s) + fence
+}
+
+func escapeTableCell(s string) string {
+	s = strings.ReplaceAll(s, "|", "\\|")
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+// SearchFilter returns a function reporting whether the name, patterns,
+// template, scope, tags, description or owner of a link contain the query,
+// ignoring case, or match it as a regular expression if isRegexp is true.
+func SearchFilter(query string, isRegexp bool) (func(Autolink) bool, error) {
+	var match func(string) bool
+	if isRegexp {
+		re, err := regexp.Compile(query)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid search expression")
+		}
+		match = re.MatchString
+	} else {
+		query = strings.ToLower(query)
+		match = func(s string) bool {
+			return strings.Contains(strings.ToLower(s), query)
+		}
+	}
+
+	return func(l Autolink) bool {
+		fields := append([]string{l.Name, l.Template}, l.AllPatterns()...)
+		fields = append(fields, l.Scope...)
+		fields = append(fields, l.Tags...)
+		fields = append(fields, l.Description, l.Owner)
+		for _, field := range fields {
+			if match(field) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
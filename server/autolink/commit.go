@@ -0,0 +1,114 @@
+package autolink
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// KindCommit is the Kind of the links of Git commit SHAs, linked to the
+// repository of the team or channel of the post.
+const KindCommit = "commit"
+
+// DefaultRepository is the key of Repositories used for the posts whose team
+// and channel have no repository.
+const DefaultRepository = "*"
+
+// Pattern and template of the commit links created by the `commit` preset.
+// The SHAs are shown in their short form.
+const (
+	CommitPattern  = `(?P<sha>[0-9a-f]{7,40})`
+	CommitTemplate = "[${sha:sha-prefix}](${post.repository}/commit/${sha})"
+)
+
+// compileKind checks the settings specific to the Kind of the link.
+func (l Autolink) compileKind() error {
+	switch l.Kind {
+	case "", KindShorten, KindReject:
+		return nil
+	case KindKeyword:
+		for _, pattern := range l.expandedPatterns() {
+			if strings.HasPrefix(pattern, "@") {
+				return errors.New("a keyword link matches the keywords without their @")
+			}
+		}
+		return nil
+	case KindPermalink:
+		if l.Template != "" {
+			return errors.New("a permalink link generates its text from the linked post and can not have a Template")
+		}
+		if !l.hasPostIDGroup() {
+			return errors.Errorf("the patterns of a permalink link must capture the post ID as (?P<%s>...)", PermalinkPostIDGroup)
+		}
+		return nil
+	case KindRedact:
+		// The text generated for code is added after it, which would leave
+		// the code unmasked
+		if l.CodeBlocks || l.CodeSpans {
+			return errors.New("a redact link can not apply to code")
+		}
+		return nil
+	case KindCommit:
+		if len(l.Repositories) == 0 {
+			return errors.New("a commit link needs at least one repository")
+		}
+		for scope, repository := range l.Repositories {
+			u, err := url.Parse(repository)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return errors.Errorf("invalid repository URL %q for %q, must be an http or https URL", repository, scope)
+			}
+		}
+		return nil
+	}
+	return errors.Errorf("invalid Kind %q, must be %q, %q, %q, %q, %q or %q", l.Kind, KindCommit, KindShorten, KindRedact, KindReject, KindKeyword, KindPermalink)
+}
+
+// Repository returns the base URL of the repository of the commits in the
+// channel, looked up in Repositories by channel, then by team, then as the
+// default one, ignoring case. It returns "" if there is none.
+func (l Autolink) Repository(team, channel string) string {
+	for _, key := range []string{team + "/" + channel, team, DefaultRepository} {
+		for scope, repository := range l.Repositories {
+			if strings.EqualFold(scope, key) {
+				return strings.TrimSuffix(repository, "/")
+			}
+		}
+	}
+	return ""
+}
+
+// ParseRepositories parses whitespace-separated `scope=url` pairs, e.g.
+// `*=https://github.com/org/app dev/backend=https://github.com/org/server`,
+// into Repositories.
+func ParseRepositories(s string) (map[string]string, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	repositories := map[string]string{}
+	for _, field := range fields {
+		i := strings.Index(field, "=")
+		if i <= 0 {
+			return nil, errors.Errorf("invalid repository %q, must be scope=url", field)
+		}
+		repositories[field[:i]] = field[i+1:]
+	}
+	return repositories, nil
+}
+
+// FormatRepositories formats Repositories as ParseRepositories parses them,
+// sorted by scope.
+func FormatRepositories(repositories map[string]string) string {
+	scopes := make([]string, 0, len(repositories))
+	for scope := range repositories {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+	pairs := make([]string, len(scopes))
+	for i, scope := range scopes {
+		pairs[i] = scope + "=" + repositories[scope]
+	}
+	return strings.Join(pairs, " ")
+}
@@ -0,0 +1,158 @@
+package autolink
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/dlclark/regexp2"
+	"github.com/pkg/errors"
+)
+
+// Values of Engine.
+const (
+	// EngineRE2 is Go's regexp package, matching in linear time. It is used
+	// by default.
+	EngineRE2 = "re2"
+
+	// EngineBacktracking supports lookarounds and backreferences, at the cost
+	// of a match possibly taking exponential time, which is stopped after
+	// BacktrackingTimeout.
+	EngineBacktracking = "backtracking"
+)
+
+// BacktrackingTimeout is the time a single match of a link using the
+// backtracking engine may take. A match taking longer is given up, as if the
+// link did not match the rest of the message.
+var BacktrackingTimeout = 100 * time.Millisecond
+
+// matcher is the part of *regexp.Regexp links are matched with, also
+// implemented for the backtracking engine.
+type matcher interface {
+	MatchString(s string) bool
+	FindString(s string) string
+	FindSubmatchIndex(b []byte) []int
+	FindAllSubmatchIndex(b []byte, n int) [][]int
+	SubexpNames() []string
+	Expand(dst []byte, template []byte, src []byte, match []int) []byte
+}
+
+// compileRegexp compiles the pattern with the engine.
+func compileRegexp(engine, pattern string) (matcher, error) {
+	switch engine {
+	case "", EngineRE2:
+		return regexp.Compile(pattern)
+	case EngineBacktracking:
+		return compileBacktracking(pattern)
+	}
+	return nil, errors.Errorf("invalid Engine %q, must be %q or %q", engine, EngineRE2, EngineBacktracking)
+}
+
+// backtrackingRegexp adapts a regexp2.Regexp to the byte offsets and group
+// numbers of the regexp package.
+type backtrackingRegexp struct {
+	re *regexp2.Regexp
+	// names are the names of the capture groups by number, empty for the
+	// unnamed ones, like SubexpNames
+	names []string
+}
+
+func compileBacktracking(pattern string) (*backtrackingRegexp, error) {
+	// The RE2 option accepts the `(?P<name>...)` groups the boundaries of
+	// the links are written with
+	re, err := regexp2.Compile(pattern, regexp2.RE2)
+	if err != nil {
+		return nil, err
+	}
+	re.MatchTimeout = BacktrackingTimeout
+
+	numbers := re.GetGroupNumbers()
+	count := 0
+	for _, num := range numbers {
+		if num+1 > count {
+			count = num + 1
+		}
+	}
+	names := make([]string, count)
+	for _, num := range numbers {
+		if name := re.GroupNameFromNumber(num); name != strconv.Itoa(num) {
+			names[num] = name
+		}
+	}
+	return &backtrackingRegexp{re: re, names: names}, nil
+}
+
+func (r *backtrackingRegexp) MatchString(s string) bool {
+	matched, err := r.re.MatchString(s)
+	return err == nil && matched
+}
+
+func (r *backtrackingRegexp) FindString(s string) string {
+	m, err := r.re.FindStringMatch(s)
+	if err != nil || m == nil {
+		return ""
+	}
+	return m.String()
+}
+
+func (r *backtrackingRegexp) FindSubmatchIndex(b []byte) []int {
+	matches := r.FindAllSubmatchIndex(b, 1)
+	if len(matches) == 0 {
+		return nil
+	}
+	return matches[0]
+}
+
+// FindAllSubmatchIndex returns the matches found until one times out, if any.
+func (r *backtrackingRegexp) FindAllSubmatchIndex(b []byte, n int) [][]int {
+	s := string(b)
+	var offsets []int
+	var matches [][]int
+	m, err := r.re.FindStringMatch(s)
+	for err == nil && m != nil && (n < 0 || len(matches) < n) {
+		if offsets == nil {
+			offsets = runeOffsets(s)
+		}
+		matches = append(matches, r.submatchIndex(m, offsets))
+		m, err = r.re.FindNextMatch(m)
+	}
+	return matches
+}
+
+// submatchIndex returns the byte offsets of the groups of the match, given
+// the byte offset of each rune of the text.
+func (r *backtrackingRegexp) submatchIndex(m *regexp2.Match, offsets []int) []int {
+	match := make([]int, 2*len(r.names))
+	for i := range match {
+		match[i] = -1
+	}
+	for _, g := range m.Groups() {
+		num := r.re.GroupNumberFromName(g.Name)
+		if num < 0 || num >= len(r.names) || len(g.Captures) == 0 {
+			continue
+		}
+		match[2*num] = offsets[g.Index]
+		match[2*num+1] = offsets[g.Index+g.Length]
+	}
+	return match
+}
+
+func (r *backtrackingRegexp) SubexpNames() []string {
+	return r.names
+}
+
+func (r *backtrackingRegexp) Expand(dst []byte, template []byte, src []byte, match []int) []byte {
+	// Templates without modifiers or post variables are always parsed
+	parts, _, _ := parseTemplate(string(template), nil)
+	return expandTemplate(dst, r, parts, src, match, nil)
+}
+
+// runeOffsets returns the byte offset of each rune of s, which regexp2
+// indexes, followed by the length of s.
+func runeOffsets(s string) []int {
+	offsets := make([]int, 0, len(s)+1)
+	for i := range s {
+		offsets = append(offsets, i)
+	}
+	return append(offsets, len(s))
+}
@@ -0,0 +1,31 @@
+package autolink
+
+import (
+	"github.com/pkg/errors"
+)
+
+// compileFallbackTemplate compiles the FallbackTemplate, with the prefix and
+// suffix of the link's Template, or returns nil if it has none.
+func (l Autolink) compileFallbackTemplate(prefix, suffix string) (*compiledAltTemplate, error) {
+	if l.FallbackTemplate == "" {
+		return nil, nil
+	}
+	if l.Enrich == "" && l.Kind != KindPermalink {
+		return nil, errors.Errorf("a FallbackTemplate is only used by the links with Enrich or of the %q Kind", KindPermalink)
+	}
+	template := prefix + l.styleTemplate(l.linkTemplate(l.expandVariables(l.FallbackTemplate))) + suffix
+	parts, err := compileTemplate(template, l.Mentions)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid FallbackTemplate")
+	}
+	return &compiledAltTemplate{template: template, templateParts: parts}, nil
+}
+
+// expandFallback appends the text generated by the FallbackTemplate for a
+// match to dst, once the lookup of the match failed.
+func (l Autolink) expandFallback(dst []byte, src []byte, submatch []int) []byte {
+	if l.fallback.templateParts != nil {
+		return expandTemplate(dst, l.re, l.fallback.templateParts, src, submatch, l.post)
+	}
+	return l.re.Expand(dst, []byte(l.fallback.template), src, submatch)
+}
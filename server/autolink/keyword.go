@@ -0,0 +1,17 @@
+package autolink
+
+// KindKeyword is the Kind of the links of keywords mentioned like users, e.g.
+// `@oncall` or `@security-rota`, turned into a link, e.g. to the current
+// on-call schedule, or into the mention of a real user or channel with the
+// `mention` template modifier. Their Pattern matches the keyword without its
+// `@`, which is added by the boundaries, and ignores case, like mentions.
+const KindKeyword = "keyword"
+
+// Boundaries of the keywords. Mentions may contain dots, dashes and
+// underscores, e.g. `@oncall-team` is not the keyword `oncall`, and do not
+// follow letters or digits, e.g. in an email address. Dots ending a sentence
+// are left out of the keyword, as they are out of mentions.
+const (
+	keywordPrefix = `(?P<MattermostNonWordPrefix>^|[^\p{L}\p{N}_.\-@])@`
+	keywordSuffix = `(?P<MattermostNonWordSuffix>$|[^\p{L}\p{N}_.\-]|\.+(?:$|[^\p{L}\p{N}_.\-]))`
+)
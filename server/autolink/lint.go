@@ -0,0 +1,421 @@
+package autolink
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Kinds of the issues found by Lint.
+const (
+	LintInvalid       = "invalid"
+	LintTemplateGroup = "template_group"
+	LintPatternGroup  = "pattern_group"
+	LintScope         = "scope"
+	LintOverlap       = "overlap"
+	LintShadowed      = "shadowed"
+	LintMention       = "mention"
+	LintVariable      = "variable"
+)
+
+// LintIssue is a likely configuration mistake found by Lint.
+type LintIssue struct {
+	Link    string `json:"link"`
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+// Lint checks the enabled links for patterns or templates that do not compile,
+// templates referencing capture groups that do not exist, malformed scopes,
+// and links matching the same text. Links matching the literal text of another
+// link are reported as overlapping, or as shadowing the other link when they
+// come first and match all of it. The other patterns are checked with an
+// example of the text they match, e.g. `MM-0` for `MM-\d+`, which other links
+// matching are reported as overlapping: the links may still overlap on texts
+// other than the example.
+func Lint(links []Autolink) []LintIssue {
+	issues := []LintIssue{}
+
+	type lintedLink struct {
+		Autolink
+		literals []string
+		examples []string
+	}
+	compiled := []lintedLink{}
+
+	for _, l := range links {
+		if l.Disabled {
+			continue
+		}
+
+		if len(l.AllPatterns()) == 0 || l.isNoop() {
+			for _, scope := range l.Scope {
+				if msg := checkScope(scope); msg != "" {
+					issues = append(issues, LintIssue{Link: l.DisplayName(), Kind: LintScope, Message: msg})
+				}
+			}
+			issues = append(issues, LintIssue{Link: l.DisplayName(), Kind: LintInvalid, Message: "the link has no pattern or template"})
+			continue
+		}
+
+		linkIssues, ok := checkLink(l)
+		issues = append(issues, linkIssues...)
+		if !ok {
+			continue
+		}
+		linted := lintedLink{Autolink: l}
+		_ = linted.Compile()
+		for _, pattern := range l.expandedPatterns() {
+			// Patterns using lookarounds are not literals
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				continue
+			}
+			if literal, complete := re.LiteralPrefix(); complete && literal != "" {
+				linted.literals = append(linted.literals, literal)
+			} else if example, ok := patternExample(pattern); ok && linted.re.FindString(example) != "" {
+				linted.examples = append(linted.examples, example)
+			}
+		}
+		compiled = append(compiled, linted)
+	}
+
+	for i, a := range compiled {
+		for j, b := range compiled {
+			if i == j || !scopesOverlap(a.Scope, b.Scope) {
+				continue
+			}
+			reported := false
+			for _, literal := range b.literals {
+				found := a.re.FindString(literal)
+				if found == "" {
+					continue
+				}
+				reported = true
+				if i < j && strings.TrimSpace(found) == literal {
+					issues = append(issues, LintIssue{
+						Link:    b.DisplayName(),
+						Kind:    LintShadowed,
+						Message: fmt.Sprintf("%q is matched by %q first", literal, a.DisplayName()),
+					})
+				} else {
+					issues = append(issues, LintIssue{
+						Link:    b.DisplayName(),
+						Kind:    LintOverlap,
+						Message: fmt.Sprintf("%q is also matched by %q", literal, a.DisplayName()),
+					})
+				}
+				break
+			}
+			for _, example := range b.examples {
+				if reported || a.re.FindString(example) == "" {
+					continue
+				}
+				issues = append(issues, LintIssue{
+					Link:    b.DisplayName(),
+					Kind:    LintOverlap,
+					Message: fmt.Sprintf("%q, an example of its pattern, is also matched by %q", example, a.DisplayName()),
+				})
+				break
+			}
+		}
+	}
+
+	return issues
+}
+
+// maxExampleLength is the maximum length of the examples of the patterns
+// checked by Lint.
+const maxExampleLength = 100
+
+// patternExample returns one of the shortest texts the pattern matches, e.g.
+// `MM-0` for `MM-\d+`, or false if none is found.
+func patternExample(pattern string) (string, bool) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return "", false
+	}
+	var example strings.Builder
+	if !writeExample(&example, re.Simplify()) || example.Len() == 0 || example.Len() > maxExampleLength {
+		return "", false
+	}
+	return example.String(), true
+}
+
+// writeExample writes one of the shortest texts the regular expression
+// matches, and reports whether there is one.
+func writeExample(b *strings.Builder, re *syntax.Regexp) bool {
+	if b.Len() > maxExampleLength {
+		return false
+	}
+	switch re.Op {
+	case syntax.OpLiteral:
+		b.WriteString(string(re.Rune))
+	case syntax.OpCharClass:
+		r, ok := classExample(re.Rune)
+		if !ok {
+			return false
+		}
+		b.WriteRune(r)
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		b.WriteRune('x')
+	case syntax.OpEmptyMatch, syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText, syntax.OpEndText,
+		syntax.OpWordBoundary, syntax.OpNoWordBoundary, syntax.OpStar, syntax.OpQuest:
+	case syntax.OpCapture, syntax.OpPlus:
+		return writeExample(b, re.Sub[0])
+	case syntax.OpRepeat:
+		for i := 0; i < re.Min; i++ {
+			if !writeExample(b, re.Sub[0]) {
+				return false
+			}
+		}
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if !writeExample(b, sub) {
+				return false
+			}
+		}
+	case syntax.OpAlternate:
+		return writeExample(b, re.Sub[0])
+	default:
+		return false
+	}
+	return true
+}
+
+// classExample returns a printable character of the ranges of a character
+// class, preferring letters and digits.
+func classExample(ranges []rune) (rune, bool) {
+	var fallback rune = -1
+	for i := 0; i+1 < len(ranges); i += 2 {
+		lo, hi := ranges[i], ranges[i+1]
+		for _, start := range []rune{'0', 'a', 'A'} {
+			if start >= lo && start <= hi {
+				return start, true
+			}
+		}
+		for r := lo; r <= hi && r < lo+128; r++ {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return r, true
+			}
+			if fallback < 0 && unicode.IsGraphic(r) && !unicode.IsSpace(r) {
+				fallback = r
+			}
+		}
+	}
+	return fallback, fallback >= 0
+}
+
+// checkLink returns the scopes of the link that are malformed, the patterns
+// and templates that do not compile, and the capture groups the templates
+// reference but the patterns do not define. It also reports whether the link
+// compiles.
+func checkLink(l Autolink) ([]LintIssue, bool) {
+	var issues []LintIssue
+	name := l.DisplayName()
+
+	for _, scope := range l.Scope {
+		if msg := checkScope(scope); msg != "" {
+			issues = append(issues, LintIssue{Link: name, Kind: LintScope, Message: msg})
+		}
+	}
+
+	// Patterns are checked on their own first, for errors not to mention
+	// the word boundary groups Compile adds
+	invalid := false
+	for _, pattern := range l.expandedPatterns() {
+		if _, err := compileRegexp(l.Engine, pattern); err != nil {
+			issues = append(issues, LintIssue{Link: name, Kind: LintInvalid, Message: err.Error()})
+			invalid = true
+		}
+	}
+	if invalid {
+		return issues, false
+	}
+	if err := l.Compile(); err != nil {
+		issues = append(issues, LintIssue{Link: name, Kind: LintInvalid, Message: err.Error()})
+		return issues, false
+	}
+
+	for _, msg := range checkPatternGroups(l) {
+		issues = append(issues, LintIssue{Link: name, Kind: LintPatternGroup, Message: msg})
+	}
+	for _, msg := range checkTemplateGroups(l) {
+		issues = append(issues, LintIssue{Link: name, Kind: LintTemplateGroup, Message: msg})
+	}
+	return issues, true
+}
+
+// ValidationError is a problem keeping a link from working as intended, found
+// by Validate.
+type ValidationError struct {
+	// Index is the index of the link in the validated links
+	Index int `json:"index"`
+	LintIssue
+}
+
+// ValidationErrors are the problems found by Validate.
+type ValidationErrors []ValidationError
+
+func (errs ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(errs))
+	for _, e := range errs {
+		msgs = append(msgs, fmt.Sprintf("link %q: %s", e.Link, e.Message))
+	}
+	return "invalid links: " + strings.Join(msgs, "; ")
+}
+
+// Validate checks the enabled links for malformed scopes, patterns or
+// templates that do not compile, and templates referencing capture groups that
+// do not exist. Unlike Lint, it does not report overlapping links, which may be
+// intended, nor links without a pattern or template, which match nothing while
+// they are being set up.
+func Validate(links []Autolink) ValidationErrors {
+	var errs ValidationErrors
+	for i, l := range links {
+		if l.Disabled || len(l.AllPatterns()) == 0 {
+			continue
+		}
+		issues, _ := checkLink(l)
+		for _, issue := range issues {
+			errs = append(errs, ValidationError{Index: i, LintIssue: issue})
+		}
+	}
+	return errs
+}
+
+// checkScope returns why the scope is malformed, or "" if it is well formed.
+func checkScope(scope string) string {
+	parts := strings.Split(scope, "/")
+	if len(parts) > 2 {
+		return fmt.Sprintf("scope %q must be `team` or `team/channel`", scope)
+	}
+	for _, part := range parts {
+		if part == "" {
+			return fmt.Sprintf("scope %q has an empty team or channel name", scope)
+		}
+		if _, err := path.Match(part, ""); err != nil {
+			return fmt.Sprintf("scope %q is not a valid wildcard pattern", scope)
+		}
+	}
+	return ""
+}
+
+// reservedGroupPrefix prefixes the names of the capture groups Compile adds
+// for the word boundaries, which the patterns can not use.
+const reservedGroupPrefix = "MattermostNonWord"
+
+// checkPatternGroups returns the capture groups named more than once in a
+// pattern, the templates only substituting the first of them, and those with
+// the names of the groups Compile adds.
+func checkPatternGroups(l Autolink) []string {
+	var msgs []string
+	reported := map[string]bool{}
+	for _, pattern := range l.expandedPatterns() {
+		re, err := compileRegexp(l.Engine, pattern)
+		if err != nil {
+			continue
+		}
+		seen := map[string]bool{}
+		for _, name := range re.SubexpNames() {
+			switch {
+			case name == "" || reported[name]:
+			case strings.HasPrefix(name, reservedGroupPrefix):
+				reported[name] = true
+				msgs = append(msgs, fmt.Sprintf("capture group %q is reserved, names starting with %s are used by the plugin", name, reservedGroupPrefix))
+			case seen[name]:
+				reported[name] = true
+				msgs = append(msgs, fmt.Sprintf("capture group %q is defined more than once in the pattern", name))
+			}
+			seen[name] = true
+		}
+	}
+	return msgs
+}
+
+// checkTemplateGroups returns the capture groups the templates of the link
+// reference, but none of its patterns define.
+func checkTemplateGroups(l Autolink) []string {
+	names := map[string]bool{}
+	numGroups := 0
+	for _, pattern := range l.expandedPatterns() {
+		re, err := compileRegexp(l.Engine, pattern)
+		if err != nil {
+			continue
+		}
+		for _, name := range re.SubexpNames() {
+			names[name] = true
+		}
+		if len(re.SubexpNames())-1 > numGroups {
+			numGroups = len(re.SubexpNames()) - 1
+		}
+	}
+
+	defined := func(ref string) bool {
+		if num, err := strconv.Atoi(ref); err == nil {
+			return num <= numGroups
+		}
+		return names[ref]
+	}
+
+	var msgs []string
+	reported := map[string]bool{}
+	templates := []string{l.Template}
+	for _, c := range l.Cases {
+		templates = append(templates, c.Template)
+		if !defined(c.Group) && !reported[c.Group] {
+			reported[c.Group] = true
+			msgs = append(msgs, fmt.Sprintf("case group %q is not defined by the pattern", c.Group))
+		}
+	}
+	templates = append(templates, l.sortedLocaleTemplates()...)
+	templates = append(templates, l.sortedScopeTemplates()...)
+	templates = append(templates, l.FallbackTemplate)
+	templates = append(templates, l.Attachment.templates()...)
+	for _, template := range templates {
+		parts, _, err := parseTemplate(template, nil)
+		if err != nil {
+			continue
+		}
+		for _, part := range parts {
+			if part.ref == "" || reported[part.ref] || defined(part.ref) {
+				continue
+			}
+			reported[part.ref] = true
+			msgs = append(msgs, fmt.Sprintf("template references $%s, which is not defined by the pattern", part.ref))
+		}
+	}
+	return msgs
+}
+
+// scopesOverlap reports whether posts could be in both scopes. Scopes with
+// wildcards are assumed to overlap.
+func scopesOverlap(a, b []string) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return true
+	}
+	for _, sa := range a {
+		for _, sb := range b {
+			if scopeOverlaps(strings.ToLower(sa), strings.ToLower(sb)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func scopeOverlaps(a, b string) bool {
+	if strings.ContainsAny(a+b, "*?[") {
+		return true
+	}
+	ap := strings.SplitN(a, "/", 2)
+	bp := strings.SplitN(b, "/", 2)
+	if ap[0] != bp[0] {
+		return false
+	}
+	return len(ap) == 1 || len(bp) == 1 || ap[1] == bp[1]
+}
@@ -0,0 +1,238 @@
+package autolink_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+func TestLint(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		links  []autolink.Autolink
+		expect []autolink.LintIssue
+	}{
+		{
+			name: "no issues",
+			links: []autolink.Autolink{{
+				Name:     "jira",
+				Pattern:  `(?P<key>MM-\d+)`,
+				Template: "[$key](https://jira.example.com/browse/$key)",
+				Scope:    []string{"team/channel", "other-*"},
+			}},
+			expect: []autolink.LintIssue{},
+		},
+		{
+			name: "invalid pattern",
+			links: []autolink.Autolink{{
+				Name:     "broken",
+				Pattern:  `(MM-\d+`,
+				Template: "$1",
+			}},
+			expect: []autolink.LintIssue{{
+				Link:    "broken",
+				Kind:    autolink.LintInvalid,
+				Message: "error parsing regexp: missing closing ): `(MM-\\d+`",
+			}},
+		},
+		{
+			name: "disabled links are ignored",
+			links: []autolink.Autolink{{
+				Name:     "broken",
+				Disabled: true,
+				Pattern:  `(MM-\d+`,
+				Template: "$1",
+			}},
+			expect: []autolink.LintIssue{},
+		},
+		{
+			name: "undefined template groups",
+			links: []autolink.Autolink{{
+				Name:     "jira",
+				Pattern:  `(?P<key>MM-\d+)`,
+				Template: "[$key]($url/${id:upper}/$2)",
+				Cases:    []autolink.TemplateCase{{Group: "project", Value: "MM", Template: "$key"}},
+			}},
+			expect: []autolink.LintIssue{{
+				Link:    "jira",
+				Kind:    autolink.LintTemplateGroup,
+				Message: `case group "project" is not defined by the pattern`,
+			}, {
+				Link:    "jira",
+				Kind:    autolink.LintTemplateGroup,
+				Message: "template references $url, which is not defined by the pattern",
+			}, {
+				Link:    "jira",
+				Kind:    autolink.LintTemplateGroup,
+				Message: "template references $id, which is not defined by the pattern",
+			}, {
+				Link:    "jira",
+				Kind:    autolink.LintTemplateGroup,
+				Message: "template references $2, which is not defined by the pattern",
+			}},
+		},
+		{
+			name: "malformed scopes",
+			links: []autolink.Autolink{{
+				Name:     "scoped",
+				Pattern:  `MM`,
+				Template: "mm",
+				Scope:    []string{"a/b/c", "team/", "[team"},
+			}},
+			expect: []autolink.LintIssue{{
+				Link:    "scoped",
+				Kind:    autolink.LintScope,
+				Message: `scope "a/b/c" must be ` + "`team` or `team/channel`",
+			}, {
+				Link:    "scoped",
+				Kind:    autolink.LintScope,
+				Message: `scope "team/" has an empty team or channel name`,
+			}, {
+				Link:    "scoped",
+				Kind:    autolink.LintScope,
+				Message: `scope "[team" is not a valid wildcard pattern`,
+			}},
+		},
+		{
+			name: "shadowed and overlapping",
+			links: []autolink.Autolink{{
+				Name:     "any",
+				Pattern:  `[A-Z]+-\d+`,
+				Template: "x",
+			}, {
+				Name:     "exact",
+				Pattern:  `MM-1`,
+				Template: "y",
+			}, {
+				Name:     "longer",
+				Pattern:  `See MM-2`,
+				Template: "z",
+			}},
+			expect: []autolink.LintIssue{{
+				Link:    "exact",
+				Kind:    autolink.LintShadowed,
+				Message: `"MM-1" is matched by "any" first`,
+			}, {
+				Link:    "longer",
+				Kind:    autolink.LintOverlap,
+				Message: `"See MM-2" is also matched by "any"`,
+			}},
+		},
+		{
+			name: "overlapping patterns",
+			links: []autolink.Autolink{{
+				Name:     "any",
+				Pattern:  `[A-Z]+-\d+`,
+				Template: "x",
+			}, {
+				Name:     "jira",
+				Pattern:  `(?P<key>(MM|OPS)-\d{2,})`,
+				Template: "y",
+			}, {
+				Name:     "github",
+				Pattern:  `#(?P<num>\d+)`,
+				Template: "z",
+			}, {
+				Name:     "lowercase",
+				Pattern:  `(?i)ticket-\d+`,
+				Template: "t",
+			}},
+			expect: []autolink.LintIssue{{
+				Link:    "jira",
+				Kind:    autolink.LintOverlap,
+				Message: `"MM-00", an example of its pattern, is also matched by "any"`,
+			}, {
+				Link:    "lowercase",
+				Kind:    autolink.LintOverlap,
+				Message: `"TICKET-0", an example of its pattern, is also matched by "any"`,
+			}},
+		},
+		{
+			name: "different scopes do not overlap",
+			links: []autolink.Autolink{{
+				Name:     "any",
+				Pattern:  `[A-Z]+-\d+`,
+				Template: "x",
+				Scope:    []string{"team1"},
+			}, {
+				Name:     "exact",
+				Pattern:  `MM-1`,
+				Template: "y",
+				Scope:    []string{"team2/town-square"},
+			}},
+			expect: []autolink.LintIssue{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expect, autolink.Lint(tc.links))
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	errs := autolink.Validate([]autolink.Autolink{{
+		Name:     "valid",
+		Pattern:  `(?P<key>MM-\d+)`,
+		Template: "$key",
+	}, {
+		Name: "incomplete",
+	}, {
+		Name:     "broken",
+		Pattern:  "(",
+		Template: "x",
+	}, {
+		Name:     "disabled",
+		Pattern:  "(",
+		Template: "x",
+		Disabled: true,
+	}, {
+		Name:     "unknown group",
+		Pattern:  `MM-\d+`,
+		Template: "$key",
+		Scope:    []string{"a/b/c"},
+	}, {
+		Name:     "overlapping",
+		Pattern:  `MM-1`,
+		Template: "x",
+	}})
+
+	assert.Len(t, errs, 3)
+	assert.Equal(t, 2, errs[0].Index)
+	assert.Equal(t, autolink.LintInvalid, errs[0].Kind)
+	assert.Equal(t, autolink.ValidationError{
+		Index: 4,
+		LintIssue: autolink.LintIssue{
+			Link:    "unknown group",
+			Kind:    autolink.LintScope,
+			Message: "scope \"a/b/c\" must be `team` or `team/channel`",
+		},
+	}, errs[1])
+	assert.Equal(t, autolink.ValidationError{
+		Index: 4,
+		LintIssue: autolink.LintIssue{
+			Link:    "unknown group",
+			Kind:    autolink.LintTemplateGroup,
+			Message: "template references $key, which is not defined by the pattern",
+		},
+	}, errs[2])
+	assert.Contains(t, errs.Error(), `link "broken": error parsing regexp`)
+
+	assert.Nil(t, autolink.Validate([]autolink.Autolink{{Pattern: "a", Template: "b"}}))
+
+	errs = autolink.Validate([]autolink.Autolink{{
+		Name:     "groups",
+		Pattern:  `(?P<key>MM-\d+)|(?P<key>ABC-\d+)|(?P<MattermostNonWordPrefix>x)`,
+		Template: "$key $2 $4",
+	}})
+	var messages []string
+	for _, e := range errs {
+		messages = append(messages, e.Kind+": "+e.Message)
+	}
+	assert.Equal(t, []string{
+		`pattern_group: capture group "key" is defined more than once in the pattern`,
+		`pattern_group: capture group "MattermostNonWordPrefix" is reserved, names starting with MattermostNonWord are used by the plugin`,
+		"template_group: template references $4, which is not defined by the pattern",
+	}, messages)
+}
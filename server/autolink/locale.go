@@ -0,0 +1,76 @@
+package autolink
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// compiledAltTemplate is a template of LocaleTemplates or ScopeTemplates,
+// compiled like the link's Template.
+type compiledAltTemplate struct {
+	template      string
+	templateParts []templatePart
+}
+
+// compileLocaleTemplates compiles the templates of LocaleTemplates, keyed by
+// their lowercase locale, with the prefix and suffix of the link's Template.
+func (l Autolink) compileLocaleTemplates(prefix, suffix string) (map[string]compiledAltTemplate, error) {
+	if len(l.LocaleTemplates) == 0 {
+		return nil, nil
+	}
+	compiled := make(map[string]compiledAltTemplate, len(l.LocaleTemplates))
+	for locale, template := range l.LocaleTemplates {
+		if strings.TrimSpace(locale) == "" {
+			return nil, errors.New("a locale template must name a locale")
+		}
+		localeTemplate := prefix + l.styleTemplate(l.linkTemplate(l.expandVariables(template))) + suffix
+		parts, err := compileTemplate(localeTemplate, l.Mentions)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid template for locale %q", locale)
+		}
+		compiled[strings.ToLower(locale)] = compiledAltTemplate{template: localeTemplate, templateParts: parts}
+	}
+	return compiled, nil
+}
+
+// localeTemplate returns the template of the locale of the author of the post,
+// looked up by the whole locale, e.g. `pt-br`, then by its language, e.g.
+// `pt`, ignoring case.
+func (l Autolink) localeTemplate() (compiledAltTemplate, bool) {
+	if len(l.locales) == 0 || l.post == nil || l.post.Locale == "" {
+		return compiledAltTemplate{}, false
+	}
+	locale := strings.ToLower(strings.ReplaceAll(l.post.Locale, "_", "-"))
+	if t, ok := l.locales[locale]; ok {
+		return t, true
+	}
+	if i := strings.Index(locale, "-"); i > 0 {
+		if t, ok := l.locales[locale[:i]]; ok {
+			return t, true
+		}
+	}
+	return compiledAltTemplate{}, false
+}
+
+// sortedLocaleTemplates returns the templates of LocaleTemplates, sorted by
+// locale.
+func (l Autolink) sortedLocaleTemplates() []string {
+	locales := sortedKeys(l.LocaleTemplates)
+	templates := make([]string, len(locales))
+	for i, locale := range locales {
+		templates[i] = l.LocaleTemplates[locale]
+	}
+	return templates
+}
+
+// sortedKeys returns the keys of the map, sorted.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
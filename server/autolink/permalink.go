@@ -0,0 +1,71 @@
+package autolink
+
+import (
+	"strings"
+)
+
+// KindPermalink is the Kind of the links of Mattermost permalinks, or of bare
+// post IDs, replaced with a link to the post whose text is a quoted snippet of
+// its message, e.g. `https://chat.example.com/dev/pl/<id>` into
+// `[“The build is broken on master”](https://chat.example.com/dev/pl/<id>)`.
+// Their Pattern captures the ID of the post as PermalinkPostIDGroup, and they
+// have no Template. The posts are looked up with the PostLookup set for the
+// post being processed, the matches being left as is without one.
+const KindPermalink = "permalink"
+
+// PermalinkPostIDGroup is the capture group of the post ID in the patterns of
+// permalink links.
+const PermalinkPostIDGroup = "post_id"
+
+// LinkedPost is a post linked by a permalink link: the snippet of its message
+// quoted as the link text, and its permalink.
+type LinkedPost struct {
+	Snippet   string
+	Permalink string
+}
+
+// PostLookup returns the post with the given ID, or false if it does not exist
+// or may not be quoted in the post being processed.
+type PostLookup func(postID string) (LinkedPost, bool)
+
+// SetPostLookup sets the lookup of the posts linked by a permalink link, for
+// the post it is applied to.
+func (l *Autolink) SetPostLookup(lookup PostLookup) {
+	l.postLookup = lookup
+}
+
+// hasPostIDGroup reports whether all the patterns of the link capture the
+// post ID.
+func (l Autolink) hasPostIDGroup() bool {
+	for _, pattern := range l.expandedPatterns() {
+		if !strings.Contains(pattern, "(?P<"+PermalinkPostIDGroup+">") && !strings.Contains(pattern, "(?<"+PermalinkPostIDGroup+">") {
+			return false
+		}
+	}
+	return true
+}
+
+// permalinkText returns the link to the post matched, quoting its snippet, or
+// false if it could not be looked up.
+func (l Autolink) permalinkText(src []byte, match []int) (string, bool) {
+	if l.postLookup == nil {
+		return "", false
+	}
+	postID := string(submatchValue(l.re, PermalinkPostIDGroup, src, match))
+	if postID == "" {
+		return "", false
+	}
+	post, ok := l.postLookup(postID)
+	if !ok || post.Permalink == "" {
+		return "", false
+	}
+	return "[“" + escapeLinkText(post.Snippet) + "”](" + post.Permalink + ")", true
+}
+
+// linkTextEscaper escapes the characters of a snippet that would end the link
+// text or the paragraph it is in.
+var linkTextEscaper = strings.NewReplacer(`\`, `\\`, `[`, `\[`, `]`, `\]`, "\r", " ", "\n", " ")
+
+func escapeLinkText(s string) string {
+	return linkTextEscaper.Replace(s)
+}
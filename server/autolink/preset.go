@@ -0,0 +1,186 @@
+package autolink
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Preset is a parameterized link for a commonly used service. Parameters are
+// referenced as `{{name}}` in the pattern and template. Values given for a
+// parameter are escaped in the pattern, while defaults are used as regular
+// expressions.
+type Preset struct {
+	Name        string
+	Description string
+	Params      []PresetParam
+	Pattern     string
+	Template    string
+	// Kind is the Kind of the link. The `repository` parameter of a commit
+	// preset is the default repository.
+	Kind string
+}
+
+// PresetParam is a parameter of a preset. Parameters without a default value
+// are required.
+type PresetParam struct {
+	Name    string
+	Default string
+}
+
+var presets = []Preset{
+	{
+		Name:        "jira",
+		Description: "Jira issue keys, e.g. MM-123",
+		Params:      []PresetParam{{Name: "base-url"}, {Name: "project", Default: `[A-Z][A-Z0-9_]+`}},
+		Pattern:     `(?P<key>{{project}}-\d+)`,
+		Template:    `[${key}]({{base-url}}/browse/${key})`,
+	},
+	{
+		Name:        "github",
+		Description: "GitHub issues and pull requests of a repository, e.g. mattermost/mattermost-server#123",
+		Params:      []PresetParam{{Name: "repo"}, {Name: "base-url", Default: "https://github.com"}},
+		Pattern:     `{{repo}}#(?P<id>\d+)`,
+		Template:    `[{{repo}}#${id}]({{base-url}}/{{repo}}/issues/${id})`,
+	},
+	{
+		Name:        "gitlab",
+		Description: "GitLab issues of a project, e.g. group/project#123",
+		Params:      []PresetParam{{Name: "project"}, {Name: "base-url", Default: "https://gitlab.com"}},
+		Pattern:     `{{project}}#(?P<id>\d+)`,
+		Template:    `[{{project}}#${id}]({{base-url}}/{{project}}/-/issues/${id})`,
+	},
+	{
+		Name:        "gitlab-mr",
+		Description: "GitLab merge requests of a project, e.g. group/project!123",
+		Params:      []PresetParam{{Name: "project"}, {Name: "base-url", Default: "https://gitlab.com"}},
+		Pattern:     `{{project}}!(?P<id>\d+)`,
+		Template:    `[{{project}}!${id}]({{base-url}}/{{project}}/-/merge_requests/${id})`,
+	},
+	{
+		Name:        "commit",
+		Description: "Git commit SHAs, shown in their short form, e.g. 0a1b2c3d",
+		Params:      []PresetParam{{Name: "repository"}},
+		Pattern:     CommitPattern,
+		Template:    CommitTemplate,
+		Kind:        KindCommit,
+	},
+	{
+		Name:        "jira-url",
+		Description: "Jira issue URLs, shortened to their key, e.g. https://mattermost.atlassian.net/browse/MM-123",
+		Params:      []PresetParam{{Name: "base-url"}},
+		Pattern:     `{{base-url}}/browse/(?P<key>[A-Z][A-Z0-9_]+-\d+)`,
+		Template:    `${key}`,
+		Kind:        KindShorten,
+	},
+	{
+		Name:        "github-url",
+		Description: "GitHub issue and pull request URLs, shortened to repo#number, e.g. https://github.com/mattermost/mattermost-server/pull/123",
+		Params:      []PresetParam{{Name: "base-url", Default: `https://github\.com`}},
+		Pattern:     `{{base-url}}/(?P<repo>[\w.-]+/[\w.-]+)/(?:issues|pull)/(?P<number>\d+)`,
+		Template:    `${repo}#${number}`,
+		Kind:        KindShorten,
+	},
+	{
+		Name:        "permalink",
+		Description: "Permalinks of the posts of this server, replaced with a quote of the post, e.g. https://chat.example.com/dev/pl/<post id>",
+		Params:      []PresetParam{{Name: "base-url"}},
+		Pattern:     `{{base-url}}/[\w-]+/pl/(?P<post_id>[a-z0-9]{26})`,
+		Kind:        KindPermalink,
+	},
+	{
+		Name:        "cve",
+		Description: "CVE identifiers, e.g. CVE-2021-44228",
+		Params:      []PresetParam{{Name: "base-url", Default: "https://nvd.nist.gov/vuln/detail"}},
+		Pattern:     `(?P<id>CVE-\d{4}-\d{4,})`,
+		Template:    `[${id}]({{base-url}}/${id})`,
+	},
+	{
+		Name:        "rfc",
+		Description: "IETF RFCs, e.g. RFC 2616",
+		Params:      []PresetParam{{Name: "base-url", Default: "https://www.rfc-editor.org/rfc"}},
+		Pattern:     `RFC ?(?P<num>\d{1,5})`,
+		Template:    `[RFC ${num}]({{base-url}}/rfc${num})`,
+	},
+	{
+		Name:        "zendesk",
+		Description: "Zendesk tickets, e.g. ZD-1234",
+		Params:      []PresetParam{{Name: "base-url"}, {Name: "prefix", Default: "ZD-"}},
+		Pattern:     `{{prefix}}(?P<id>\d+)`,
+		Template:    `[{{prefix}}${id}]({{base-url}}/agent/tickets/${id})`,
+	},
+	{
+		Name:        "servicenow",
+		Description: "ServiceNow task numbers, e.g. INC0012345",
+		Params:      []PresetParam{{Name: "base-url"}},
+		Pattern:     `(?P<number>(?:INC|CHG|PRB|RITM|REQ|TASK)\d{7})`,
+		Template:    `[${number}]({{base-url}}/nav_to.do?uri=task.do?sysparm_query=number=${number})`,
+	},
+}
+
+var presetParamRegexp = regexp.MustCompile(`{{([a-z-]+)}}`)
+
+// Presets returns the built-in presets, sorted by name.
+func Presets() []Preset {
+	sorted := append([]Preset{}, presets...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
+
+// GetPreset returns the preset with the given name.
+func GetPreset(name string) (Preset, bool) {
+	for _, p := range presets {
+		if p.Name == strings.ToLower(name) {
+			return p, true
+		}
+	}
+	return Preset{}, false
+}
+
+// Link returns the link of the preset with the given parameter values.
+func (p Preset) Link(values map[string]string) (Autolink, error) {
+	patternValues := map[string]string{}
+	templateValues := map[string]string{}
+	for _, param := range p.Params {
+		value, ok := values[param.Name]
+		switch {
+		case ok && value != "":
+			if param.Name == "base-url" {
+				value = strings.TrimSuffix(value, "/")
+			}
+			patternValues[param.Name] = regexp.QuoteMeta(value)
+			templateValues[param.Name] = value
+		case param.Default != "":
+			patternValues[param.Name] = param.Default
+			templateValues[param.Name] = param.Default
+		default:
+			return Autolink{}, errors.Errorf("preset %q requires the %q parameter", p.Name, param.Name)
+		}
+	}
+	for name := range values {
+		if _, ok := patternValues[name]; !ok {
+			return Autolink{}, errors.Errorf("preset %q has no %q parameter", p.Name, name)
+		}
+	}
+
+	expand := func(s string, values map[string]string) string {
+		return presetParamRegexp.ReplaceAllStringFunc(s, func(ref string) string {
+			return values[ref[2:len(ref)-2]]
+		})
+	}
+	l := Autolink{
+		Name:      p.Name,
+		Pattern:   expand(p.Pattern, patternValues),
+		Template:  expand(p.Template, templateValues),
+		WordMatch: true,
+		Kind:      p.Kind,
+	}
+	if p.Kind == KindCommit {
+		l.Repositories = map[string]string{DefaultRepository: templateValues["repository"]}
+	}
+	return l, nil
+}
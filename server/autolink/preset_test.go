@@ -0,0 +1,105 @@
+package autolink_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+func TestPresets(t *testing.T) {
+	for _, tc := range []struct {
+		preset          string
+		values          map[string]string
+		message         string
+		expectedMessage string
+	}{
+		{
+			preset:          "jira",
+			values:          map[string]string{"base-url": "https://jira.example.com/"},
+			message:         "See MM-123 and OPS-4.",
+			expectedMessage: "See [MM-123](https://jira.example.com/browse/MM-123) and [OPS-4](https://jira.example.com/browse/OPS-4).",
+		},
+		{
+			preset:          "jira",
+			values:          map[string]string{"base-url": "https://jira.example.com", "project": "MM"},
+			message:         "See MM-123 and OPS-4.",
+			expectedMessage: "See [MM-123](https://jira.example.com/browse/MM-123) and OPS-4.",
+		},
+		{
+			preset:          "github",
+			values:          map[string]string{"repo": "mattermost/mattermost-server"},
+			message:         "Fixed in mattermost/mattermost-server#123",
+			expectedMessage: "Fixed in [mattermost/mattermost-server#123](https://github.com/mattermost/mattermost-server/issues/123)",
+		},
+		{
+			preset:          "commit",
+			values:          map[string]string{"repository": "https://github.com/org/app/"},
+			message:         "Fixed in 0123456789abcdef0123456789abcdef01234567 and 0a1b2c3",
+			expectedMessage: "Fixed in [01234567](https://github.com/org/app/commit/0123456789abcdef0123456789abcdef01234567) and [0a1b2c3](https://github.com/org/app/commit/0a1b2c3)",
+		},
+		{
+			preset:          "jira-url",
+			values:          map[string]string{"base-url": "https://jira.example.com/"},
+			message:         "See https://jira.example.com/browse/MM-123.",
+			expectedMessage: "See [MM-123](https://jira.example.com/browse/MM-123).",
+		},
+		{
+			preset:          "github-url",
+			message:         "Fixed in https://github.com/mattermost/mattermost-server/pull/123",
+			expectedMessage: "Fixed in [mattermost/mattermost-server#123](https://github.com/mattermost/mattermost-server/pull/123)",
+		},
+		{
+			preset:          "gitlab-mr",
+			values:          map[string]string{"project": "group/project", "base-url": "https://gitlab.example.com"},
+			message:         "Merged group/project!7",
+			expectedMessage: "Merged [group/project!7](https://gitlab.example.com/group/project/-/merge_requests/7)",
+		},
+		{
+			preset:          "cve",
+			message:         "Patched CVE-2021-44228.",
+			expectedMessage: "Patched [CVE-2021-44228](https://nvd.nist.gov/vuln/detail/CVE-2021-44228).",
+		},
+		{
+			preset:          "rfc",
+			message:         "As per RFC 2616",
+			expectedMessage: "As per [RFC 2616](https://www.rfc-editor.org/rfc/rfc2616)",
+		},
+		{
+			preset:          "servicenow",
+			values:          map[string]string{"base-url": "https://example.service-now.com"},
+			message:         "INC0012345",
+			expectedMessage: "[INC0012345](https://example.service-now.com/nav_to.do?uri=task.do?sysparm_query=number=INC0012345)",
+		},
+	} {
+		t.Run(tc.preset, func(t *testing.T) {
+			preset, ok := autolink.GetPreset(tc.preset)
+			require.True(t, ok)
+			link, err := preset.Link(tc.values)
+			require.NoError(t, err)
+			require.NoError(t, link.Compile())
+			assert.Equal(t, tc.expectedMessage, link.Replace(tc.message))
+		})
+	}
+}
+
+func TestPresetParams(t *testing.T) {
+	preset, ok := autolink.GetPreset("zendesk")
+	require.True(t, ok)
+
+	_, err := preset.Link(nil)
+	assert.EqualError(t, err, `preset "zendesk" requires the "base-url" parameter`)
+
+	_, err = preset.Link(map[string]string{"base-url": "https://example.zendesk.com", "project": "x"})
+	assert.EqualError(t, err, `preset "zendesk" has no "project" parameter`)
+
+	link, err := preset.Link(map[string]string{"base-url": "https://example.zendesk.com", "prefix": "T+"})
+	require.NoError(t, err)
+	assert.Equal(t, `T\+(?P<id>\d+)`, link.Pattern)
+	assert.Equal(t, "[T+${id}](https://example.zendesk.com/agent/tickets/${id})", link.Template)
+
+	_, ok = autolink.GetPreset("unknown")
+	assert.False(t, ok)
+}
@@ -0,0 +1,11 @@
+package autolink
+
+// KindRedact is the Kind of the links masking the text they match, e.g.
+// credit card numbers, API keys or internal hostnames, with the text generated
+// by their Template, or with RedactPlaceholder if they have none. The text
+// matched is not kept anywhere, it can not be restored.
+const KindRedact = "redact"
+
+// RedactPlaceholder replaces the text matched by the redact links without a
+// Template.
+const RedactPlaceholder = "[redacted]"
@@ -0,0 +1,34 @@
+package autolink
+
+import "strings"
+
+// KindReject is the Kind of the links rejecting the posts they match, e.g.
+// posts containing secrets or links to forbidden trackers, instead of changing
+// them. Their Template, if any, generates the explanation shown to the author
+// for the first match, DefaultRejection being shown otherwise.
+const KindReject = "reject"
+
+// DefaultRejection is the explanation of the rejection of a post by a reject
+// link without a Template.
+const DefaultRejection = "This message contains text that is not allowed and was not posted."
+
+// Rejection returns the explanation of the rejection of the message by the
+// link, and whether the link rejects it.
+func (l Autolink) Rejection(message string) (string, bool) {
+	if l.Kind != KindReject || l.re == nil {
+		return "", false
+	}
+	src := []byte(message)
+	match := l.re.FindSubmatchIndex(src)
+	if match == nil {
+		return "", false
+	}
+	if l.Template == "" {
+		return DefaultRejection, true
+	}
+
+	// The boundaries matched around the text are left out, like in Matches
+	text := string(l.expand(nil, src, match))
+	text = strings.TrimPrefix(text, string(submatchValue(l.re, "MattermostNonWordPrefix", src, match)))
+	return strings.TrimSuffix(text, string(submatchValue(l.re, "MattermostNonWordSuffix", src, match))), true
+}
@@ -0,0 +1,138 @@
+package autolink
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// schedule is a parsed cron-like schedule with the five usual fields: minute,
+// hour, day of month, month and day of week. A time matches the schedule if
+// all fields match it, except that either day field matches when both are
+// restricted, like cron does.
+type schedule struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+	location                      *time.Location
+}
+
+type scheduleField struct {
+	min, max int
+}
+
+var scheduleFields = []scheduleField{
+	{0, 59}, // minute
+	{0, 23}, // hour
+	{1, 31}, // day of month
+	{1, 12}, // month
+	{0, 7},  // day of week, 0 and 7 are both Sunday
+}
+
+// parseSchedule parses a schedule like "* 9-17 * * 1-5", optionally prefixed
+// with the time zone it is evaluated in, "TZ=Europe/Paris * 9-17 * * 1-5".
+// Schedules are evaluated in UTC by default.
+func parseSchedule(spec string) (*schedule, error) {
+	fields := strings.Fields(spec)
+	location := time.UTC
+	if len(fields) > 0 && strings.HasPrefix(fields[0], "TZ=") {
+		loc, err := time.LoadLocation(strings.TrimPrefix(fields[0], "TZ="))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid schedule time zone %q", fields[0])
+		}
+		location = loc
+		fields = fields[1:]
+	}
+	if len(fields) != len(scheduleFields) {
+		return nil, errors.Errorf("schedule %q must have 5 fields: minute, hour, day of month, month and day of week", spec)
+	}
+
+	bits := make([]uint64, len(fields))
+	for i, field := range fields {
+		b, err := parseScheduleField(field, scheduleFields[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid schedule %q", spec)
+		}
+		bits[i] = b
+	}
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+
+	return &schedule{
+		minute:   bits[0],
+		hour:     bits[1],
+		dom:      bits[2],
+		month:    bits[3],
+		dow:      bits[4],
+		domAny:   fields[2] == "*",
+		dowAny:   fields[4] == "*",
+		location: location,
+	}, nil
+}
+
+// parseScheduleField parses a comma-separated list of values, ranges (`1-5`)
+// and steps (`*/15`, `5/15`, `0-30/10`) into a bit set.
+func parseScheduleField(field string, bounds scheduleField) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(field, ",") {
+		rangePart, step := item, 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			s, err := strconv.Atoi(item[i+1:])
+			if err != nil || s <= 0 {
+				return 0, errors.Errorf("invalid step in %q", item)
+			}
+			rangePart, step = item[:i], s
+		}
+
+		start, end := bounds.min, bounds.max
+		if rangePart != "*" {
+			var err error
+			bounds := strings.SplitN(rangePart, "-", 2)
+			if start, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, errors.Errorf("invalid value %q", item)
+			}
+			// A single value with a step, e.g. `5/15`, runs up to the maximum
+			if len(bounds) == 1 && step == 1 {
+				end = start
+			}
+			if len(bounds) == 2 {
+				if end, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, errors.Errorf("invalid value %q", item)
+				}
+			}
+		}
+		if start < bounds.min || end > bounds.max || start > end {
+			return 0, errors.Errorf("%q is out of the %d-%d range", item, bounds.min, bounds.max)
+		}
+
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// matches reports whether the minute of t is part of the schedule.
+func (s *schedule) matches(t time.Time) bool {
+	t = t.In(s.location)
+	has := func(bits uint64, v int) bool {
+		return bits&(1<<uint(v)) != 0
+	}
+	if !has(s.minute, t.Minute()) || !has(s.hour, t.Hour()) || !has(s.month, int(t.Month())) {
+		return false
+	}
+
+	domMatch := has(s.dom, t.Day())
+	dowMatch := has(s.dow, int(t.Weekday()))
+	switch {
+	case s.domAny && s.dowAny:
+		return true
+	case s.domAny:
+		return dowMatch
+	case s.dowAny:
+		return domMatch
+	}
+	return domMatch || dowMatch
+}
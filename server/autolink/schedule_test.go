@@ -0,0 +1,128 @@
+package autolink_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+func TestIsActive(t *testing.T) {
+	// A Wednesday
+	now := time.Date(2024, time.January, 10, 12, 30, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name     string
+		link     autolink.Autolink
+		expected bool
+	}{
+		{
+			name:     "always",
+			link:     autolink.Autolink{},
+			expected: true,
+		},
+		{
+			name:     "not started",
+			link:     autolink.Autolink{ActiveFrom: "2024-01-11T00:00:00Z"},
+			expected: false,
+		},
+		{
+			name:     "started",
+			link:     autolink.Autolink{ActiveFrom: "2024-01-10T00:00:00Z"},
+			expected: true,
+		},
+		{
+			name:     "ended",
+			link:     autolink.Autolink{ActiveUntil: "2024-01-10T12:30:00Z"},
+			expected: false,
+		},
+		{
+			name:     "window",
+			link:     autolink.Autolink{ActiveFrom: "2024-01-01T00:00:00Z", ActiveUntil: "2024-02-01T00:00:00+01:00"},
+			expected: true,
+		},
+		{
+			name:     "expired",
+			link:     autolink.Autolink{ExpiresAt: "2024-01-01T00:00:00Z"},
+			expected: false,
+		},
+		{
+			name:     "office hours",
+			link:     autolink.Autolink{Schedule: "* 9-17 * * 1-5"},
+			expected: true,
+		},
+		{
+			name:     "weekends",
+			link:     autolink.Autolink{Schedule: "* * * * 0,6"},
+			expected: false,
+		},
+		{
+			name:     "steps",
+			link:     autolink.Autolink{Schedule: "*/15 * * * *"},
+			expected: true,
+		},
+		{
+			name:     "steps with an offset",
+			link:     autolink.Autolink{Schedule: "20/5 * * * *"},
+			expected: true,
+		},
+		{
+			name:     "steps with an offset not matching",
+			link:     autolink.Autolink{Schedule: "5/15 * * * *"},
+			expected: false,
+		},
+		{
+			name:     "hour steps with an offset",
+			link:     autolink.Autolink{Schedule: "* 2/5 * * *"},
+			expected: true,
+		},
+		{
+			name:     "hour steps with an offset not matching",
+			link:     autolink.Autolink{Schedule: "* 3/5 * * *"},
+			expected: false,
+		},
+		{
+			name:     "range steps",
+			link:     autolink.Autolink{Schedule: "10-40/10 * * * *"},
+			expected: true,
+		},
+		{
+			name:     "first week",
+			link:     autolink.Autolink{Schedule: "* * 1-7 * *"},
+			expected: false,
+		},
+		{
+			name:     "day of month or week",
+			link:     autolink.Autolink{Schedule: "* * 1-7 * 3"},
+			expected: true,
+		},
+		{
+			name:     "time zone",
+			link:     autolink.Autolink{Schedule: "TZ=Asia/Tokyo * 21 * * *"},
+			expected: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.NoError(t, tc.link.Compile())
+			assert.Equal(t, tc.expected, tc.link.IsActive(now))
+		})
+	}
+}
+
+func TestInvalidSchedule(t *testing.T) {
+	for _, link := range []autolink.Autolink{
+		{ActiveFrom: "2024-01-10"},
+		{ActiveUntil: "tomorrow"},
+		{ExpiresAt: "2024"},
+		{Schedule: "* * * *"},
+		{Schedule: "60 * * * *"},
+		{Schedule: "* 5-1 * * *"},
+		{Schedule: "*/0 * * * *"},
+		{Schedule: "TZ=Nowhere/Atlantis * * * * *"},
+	} {
+		assert.Error(t, link.Compile(), "%+v", link)
+	}
+}
@@ -0,0 +1,55 @@
+package autolink
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// compileScopeTemplates compiles the templates of ScopeTemplates, keyed by
+// their lowercase scope, with the prefix and suffix of the link's Template.
+func (l Autolink) compileScopeTemplates(prefix, suffix string) (map[string]compiledAltTemplate, error) {
+	if len(l.ScopeTemplates) == 0 {
+		return nil, nil
+	}
+	compiled := make(map[string]compiledAltTemplate, len(l.ScopeTemplates))
+	for scope, template := range l.ScopeTemplates {
+		parts := strings.Split(scope, "/")
+		if len(parts) > 2 || parts[0] == "" || (len(parts) == 2 && parts[1] == "") {
+			return nil, errors.Errorf("invalid scope %q of a scope template, must be `team` or `team/channel`", scope)
+		}
+		scopeTemplate := prefix + l.styleTemplate(l.linkTemplate(l.expandVariables(template))) + suffix
+		templateParts, err := compileTemplate(scopeTemplate, l.Mentions)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid template for scope %q", scope)
+		}
+		compiled[strings.ToLower(scope)] = compiledAltTemplate{template: scopeTemplate, templateParts: templateParts}
+	}
+	return compiled, nil
+}
+
+// scopeTemplate returns the template of the channel of the post, looked up by
+// `team/channel`, then by team, ignoring case.
+func (l Autolink) scopeTemplate() (compiledAltTemplate, bool) {
+	if len(l.scopes) == 0 || l.post == nil || l.post.TeamName == "" {
+		return compiledAltTemplate{}, false
+	}
+	team := strings.ToLower(l.post.TeamName)
+	for _, key := range []string{team + "/" + strings.ToLower(l.post.ChannelName), team} {
+		if t, ok := l.scopes[key]; ok {
+			return t, true
+		}
+	}
+	return compiledAltTemplate{}, false
+}
+
+// sortedScopeTemplates returns the templates of ScopeTemplates, sorted by
+// scope.
+func (l Autolink) sortedScopeTemplates() []string {
+	scopes := sortedKeys(l.ScopeTemplates)
+	templates := make([]string, len(scopes))
+	for i, scope := range scopes {
+		templates[i] = l.ScopeTemplates[scope]
+	}
+	return templates
+}
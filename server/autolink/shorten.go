@@ -0,0 +1,40 @@
+package autolink
+
+// KindShorten is the Kind of the links shortening the URLs they match into a
+// markdown link, whose text is generated by the Template, e.g.
+// `https://mattermost.atlassian.net/browse/MM-123` into
+// `[MM-123](https://mattermost.atlassian.net/browse/MM-123)`.
+const KindShorten = "shorten"
+
+// Boundaries of the URLs shortened. The whole URL must be matched, regardless
+// of WordMatch and the other boundary settings, for the link not to drop the
+// rest of it, e.g. a comment anchor. Punctuation ending a sentence is left
+// out of the URL.
+const (
+	shortenURLGroup = "MattermostURL"
+	shortenPrefix   = `(?P<MattermostNonWordPrefix>^|\s)`
+	shortenSuffix   = `(?P<MattermostNonWordSuffix>[\.\!\?\,\)]*(?:$|\s))`
+)
+
+// linkTemplate returns the template generating the text of a match: the
+// template itself, the markdown link to the URL matched for shorten links, or
+// the placeholder of redact links without a template.
+func (l Autolink) linkTemplate(template string) string {
+	switch {
+	case l.Kind == KindShorten:
+		return "[" + template + "](${" + shortenURLGroup + "})"
+	case l.Kind == KindRedact && template == "":
+		return RedactPlaceholder
+	}
+	return template
+}
+
+// IsTerminal reports whether the text generated by the link is kept out of
+// the reach of the links after it: for Terminal links, for shorten links,
+// whose link text would otherwise be linked again, e.g. by a link of Jira
+// issue keys, for redact links, whose masks must stay as they are, for keyword
+// links, whose mentions must stay mentions, and for permalink links, whose
+// quotes must stay as posted.
+func (l Autolink) IsTerminal() bool {
+	return l.Terminal || l.Kind == KindShorten || l.Kind == KindRedact || l.Kind == KindKeyword || l.Kind == KindPermalink
+}
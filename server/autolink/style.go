@@ -0,0 +1,53 @@
+package autolink
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Values of Style.
+const (
+	StyleBold  = "bold"
+	StyleCode  = "code"
+	StylePlain = "plain"
+)
+
+// markdownLinkRegexp matches the templates generating a single markdown link,
+// capturing its text and URL.
+var markdownLinkRegexp = regexp.MustCompile(`^\[([^\[\]]*)\]\(([^\s()]*)\)$`)
+
+// checkStyle returns the error of an invalid Style.
+func (l Autolink) checkStyle() error {
+	switch l.Style {
+	case "", StyleBold, StyleCode, StylePlain:
+		return nil
+	}
+	return errors.Errorf("invalid Style %q, must be %q, %q or %q", l.Style, StyleBold, StyleCode, StylePlain)
+}
+
+// styleTemplate applies the Style of the link to a template, and adds its
+// TextPrefix and TextSuffix around it. The text of a markdown link is shown
+// as code, keeping the link, and plain replaces the link with its URL. Other
+// templates are shown as code as a whole, and left as they are by plain. The
+// explanations of reject links and empty templates are not styled.
+func (l Autolink) styleTemplate(template string) string {
+	if l.Kind == KindReject || template == "" {
+		return template
+	}
+
+	link := markdownLinkRegexp.FindStringSubmatch(template)
+	switch {
+	case l.Style == StyleBold:
+		template = "**" + template + "**"
+	case l.Style == StyleCode && link != nil:
+		template = "[`" + link[1] + "`](" + link[2] + ")"
+	case l.Style == StyleCode:
+		template = "`" + template + "`"
+	case l.Style == StylePlain && link != nil:
+		template = link[2]
+	}
+	// The prefix and suffix are literal text
+	return strings.ReplaceAll(l.TextPrefix, "$", "$$") + template + strings.ReplaceAll(l.TextSuffix, "$", "$$")
+}
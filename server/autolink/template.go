@@ -0,0 +1,309 @@
+package autolink
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// templatePart is either literal text, or a reference to a capture group
+// (`$name`, `${name}`, `$1`) or to a post variable (`${post.channel}`),
+// optionally followed by modifiers (`${name:upper:urlencode}`) and by the
+// default value of an empty group (`${env|prod}`).
+type templatePart struct {
+	literal    string
+	ref        string
+	postVar    string
+	modifiers  []modifier
+	fallback   string
+	hasDefault bool
+}
+
+// PostContext is the post a link is applied to, substituted for the post
+// variables of its templates.
+type PostContext struct {
+	ChannelName string
+	TeamName    string
+	Username    string
+	CreateAt    time.Time
+
+	// Locale is the locale of the author, selecting the LocaleTemplates.
+	Locale string
+
+	// Repository is the base URL of the repository of the commit links in
+	// the channel, set by SetPostContext.
+	Repository string
+}
+
+// postVariables are the values of the post variables, `${post.<name>}` in
+// templates.
+var postVariables = map[string]func(*PostContext) string{
+	"channel":    func(c *PostContext) string { return c.ChannelName },
+	"team":       func(c *PostContext) string { return c.TeamName },
+	"user":       func(c *PostContext) string { return c.Username },
+	"timestamp":  func(c *PostContext) string { return c.CreateAt.UTC().Format(time.RFC3339) },
+	"repository": func(c *PostContext) string { return c.Repository },
+}
+
+const postVariablePrefix = "post."
+
+type modifier func(string) string
+
+// modifiers transform the value of a capture group before it is substituted
+// into the template.
+var modifiers = map[string]modifier{
+	"upper":      strings.ToUpper,
+	"lower":      strings.ToLower,
+	"title":      title,
+	"trim":       strings.TrimSpace,
+	"urlencode":  url.QueryEscape,
+	"pathescape": url.PathEscape,
+	"sha-prefix": shaPrefix,
+}
+
+// argModifiers are the modifiers taking the next field of the reference as
+// argument, e.g. `${sha:short:8}`.
+var argModifiers = map[string]func(arg string) (modifier, error){
+	"short": shortModifier,
+}
+
+// shortModifier truncates a value to at most n characters.
+func shortModifier(arg string) (modifier, error) {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n <= 0 {
+		return nil, errors.Errorf("%q is not a positive number of characters", arg)
+	}
+	return func(s string) string {
+		return truncate(s, n)
+	}, nil
+}
+
+func truncate(s string, n int) string {
+	i := 0
+	for j := range s {
+		if i == n {
+			return s[:j]
+		}
+		i++
+	}
+	return s
+}
+
+// shaPrefixLength is the length of the short form of hashes, e.g. of commits.
+const shaPrefixLength = 8
+
+var hexRegexp = regexp.MustCompile(`^[0-9a-fA-F]+$`)
+
+// shaPrefix returns the short form of a hexadecimal hash, such as a commit
+// SHA. Other values are left as is.
+func shaPrefix(s string) string {
+	if !hexRegexp.MatchString(s) {
+		return s
+	}
+	return truncate(s, shaPrefixLength)
+}
+
+// mentionModifier is the `mention` modifier, replacing the values found in the
+// Mentions of a link with their mention, ignoring case. Other values are left
+// as is.
+func mentionModifier(mentions map[string]string) modifier {
+	lowered := make(map[string]string, len(mentions))
+	for value, mention := range mentions {
+		lowered[strings.ToLower(value)] = mention
+	}
+	return func(s string) string {
+		if mention, ok := lowered[strings.ToLower(s)]; ok {
+			return mention
+		}
+		return s
+	}
+}
+
+func title(s string) string {
+	if s == "" {
+		return s
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + strings.ToLower(s[size:])
+}
+
+var templateNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_]+`)
+
+// parseTemplate splits a template into literal text and capture group
+// references. It reports whether any reference uses modifiers, a default value
+// or a post variable, templates without them can be expanded by regexp.Expand
+// as is.
+// mentions are the values looked up by the `mention` modifier.
+func parseTemplate(template string, mentions map[string]string) ([]templatePart, bool, error) {
+	parts := []templatePart{}
+	hasModifiers := false
+	literal := ""
+	for len(template) > 0 {
+		i := strings.Index(template, "$")
+		if i < 0 {
+			literal += template
+			break
+		}
+		literal += template[:i]
+		template = template[i+1:]
+
+		switch {
+		case strings.HasPrefix(template, "$"):
+			literal += "$"
+			template = template[1:]
+			continue
+
+		case strings.HasPrefix(template, "{"):
+			end := strings.Index(template, "}")
+			if end < 0 {
+				// Not a valid reference, regexp.Expand leaves these as is
+				literal += "$"
+				continue
+			}
+			// The default value is everything after the first |, and may
+			// contain colons, e.g. of a URL
+			reference := template[1:end]
+			fallback, hasDefault := "", false
+			if j := strings.Index(reference, "|"); j >= 0 {
+				reference, fallback, hasDefault = reference[:j], reference[j+1:], true
+			}
+			fields := strings.Split(reference, ":")
+			part := templatePart{ref: fields[0]}
+			if strings.HasPrefix(fields[0], postVariablePrefix) {
+				name := strings.TrimPrefix(fields[0], postVariablePrefix)
+				if postVariables[name] == nil {
+					return nil, false, errors.Errorf("unknown post variable %q in ${%s}", name, template[1:end])
+				}
+				part = templatePart{postVar: name}
+				hasModifiers = true
+			} else if templateNameRegexp.FindString(fields[0]) != fields[0] || fields[0] == "" {
+				literal += "$"
+				continue
+			}
+			for j := 1; j < len(fields); j++ {
+				name := fields[j]
+				if newModifier, ok := argModifiers[name]; ok {
+					if j+1 == len(fields) {
+						return nil, false, errors.Errorf("template modifier %q needs an argument in ${%s}", name, template[1:end])
+					}
+					j++
+					mod, err := newModifier(fields[j])
+					if err != nil {
+						return nil, false, errors.Wrapf(err, "invalid template modifier %q in ${%s}", name, template[1:end])
+					}
+					part.modifiers = append(part.modifiers, mod)
+					hasModifiers = true
+					continue
+				}
+				mod, ok := modifiers[name]
+				if name == "mention" {
+					mod, ok = mentionModifier(mentions), true
+				}
+				if !ok {
+					return nil, false, errors.Errorf("unknown template modifier %q in ${%s}", name, template[1:end])
+				}
+				part.modifiers = append(part.modifiers, mod)
+				hasModifiers = true
+			}
+			if hasDefault {
+				part.fallback, part.hasDefault = fallback, true
+				hasModifiers = true
+			}
+			parts = append(parts, templatePart{literal: literal}, part)
+			literal = ""
+			template = template[end+1:]
+
+		default:
+			name := templateNameRegexp.FindString(template)
+			if name == "" {
+				literal += "$"
+				continue
+			}
+			parts = append(parts, templatePart{literal: literal}, templatePart{ref: name})
+			literal = ""
+			template = template[len(name):]
+		}
+	}
+	parts = append(parts, templatePart{literal: literal})
+
+	return parts, hasModifiers, nil
+}
+
+func usesPostVariables(parts []templatePart) bool {
+	for _, part := range parts {
+		if part.postVar != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// expandTemplate appends the template to dst with the capture group
+// references replaced by the corresponding submatches of src, the same way
+// regexp.Expand does, and the post variables by their value for the post if
+// known. Empty values, e.g. of optional groups that did not participate in the
+// match, are replaced by the default value of their reference if it has one,
+// before the modifiers of the reference are applied.
+func expandTemplate(dst []byte, re matcher, parts []templatePart, src []byte, match []int, post *PostContext) []byte {
+	for _, part := range parts {
+		if part.ref == "" && part.postVar == "" {
+			dst = append(dst, part.literal...)
+			continue
+		}
+
+		value := ""
+		if part.postVar != "" {
+			if post != nil {
+				value = postVariables[part.postVar](post)
+			}
+		} else {
+			value = string(submatchValue(re, part.ref, src, match))
+		}
+		if value == "" && part.hasDefault {
+			value = part.fallback
+		}
+		for _, mod := range part.modifiers {
+			value = mod(value)
+		}
+		dst = append(dst, value...)
+	}
+	return dst
+}
+
+// submatchValue returns the value of the capture group with the given name or
+// number. Like regexp.Expand, the first participating group of a name is used.
+func submatchValue(re matcher, ref string, src []byte, match []int) []byte {
+	if num, ok := parseGroupNumber(ref); ok {
+		if 2*num+1 < len(match) && match[2*num] >= 0 {
+			return src[match[2*num]:match[2*num+1]]
+		}
+		return nil
+	}
+
+	for i, name := range re.SubexpNames() {
+		if name == ref && 2*i+1 < len(match) && match[2*i] >= 0 {
+			return src[match[2*i]:match[2*i+1]]
+		}
+	}
+	return nil
+}
+
+func parseGroupNumber(ref string) (int, bool) {
+	num := 0
+	for _, c := range ref {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		num = num*10 + int(c-'0')
+		if num >= 1e8 {
+			return 0, false
+		}
+	}
+	return num, true
+}
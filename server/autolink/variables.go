@@ -0,0 +1,158 @@
+package autolink
+
+import (
+	"bufio"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// variableRegexp matches the references to the global variables in the
+// templates, e.g. `{{JIRA_BASE}}`, and to the pattern fragments in the
+// patterns.
+var variableRegexp = regexp.MustCompile(`\{\{([A-Za-z_][A-Za-z0-9_]*)\}\}`)
+
+// variableNameRegexp matches the names of the global variables.
+var variableNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ParseVariables parses global variables, one `NAME=value` per line. Empty
+// lines and lines starting with `#` are ignored.
+func ParseVariables(s string) (map[string]string, error) {
+	variables := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(s))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		name := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || !variableNameRegexp.MatchString(name) {
+			return nil, errors.Errorf("invalid variable %q, must be NAME=value, the name made of letters, digits and underscores", line)
+		}
+		variables[name] = strings.TrimSpace(parts[1])
+	}
+	return variables, scanner.Err()
+}
+
+// ParsePatternFragments parses named pattern fragments, one `NAME=regexp` per
+// line like ParseVariables. The fragments are checked to compile with either
+// engine, and to define no capture groups, which would change the groups of
+// the patterns using them.
+func ParsePatternFragments(s string) (map[string]string, error) {
+	fragments, err := ParseVariables(s)
+	if err != nil {
+		return nil, err
+	}
+	for name, fragment := range fragments {
+		re, err := compileRegexp(EngineRE2, fragment)
+		if err != nil {
+			if re, err = compileRegexp(EngineBacktracking, fragment); err != nil {
+				return nil, errors.Wrapf(err, "invalid pattern fragment %s", name)
+			}
+		}
+		if len(re.SubexpNames()) > 1 {
+			return nil, errors.Errorf("pattern fragment %s defines capture groups, use (?:...) instead", name)
+		}
+	}
+	return fragments, nil
+}
+
+// SetVariables sets the global variables substituted for their references in
+// the templates when the link is compiled, e.g. `{{JIRA_BASE}}/browse/${key}`.
+// References to undefined variables are left as they are.
+func (l *Autolink) SetVariables(variables map[string]string) {
+	l.variables = variables
+}
+
+// SetPatternFragments sets the named pattern fragments substituted for their
+// references in the patterns when the link is compiled, e.g.
+// `(?P<key>{{PROJECT}}-\d+)`. References to undefined fragments are left as
+// they are.
+func (l *Autolink) SetPatternFragments(fragments map[string]string) {
+	l.fragments = fragments
+}
+
+// expandedPatterns returns AllPatterns with the pattern fragments substituted,
+// each in a non-capturing group for its alternatives not to extend to the
+// rest of the pattern.
+func (l Autolink) expandedPatterns() []string {
+	patterns := l.AllPatterns()
+	if len(l.fragments) == 0 {
+		return patterns
+	}
+	expanded := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		expanded = append(expanded, variableRegexp.ReplaceAllStringFunc(pattern, func(ref string) string {
+			fragment, ok := l.fragments[ref[2:len(ref)-2]]
+			if !ok {
+				return ref
+			}
+			return "(?:" + fragment + ")"
+		}))
+	}
+	return expanded
+}
+
+// expandVariables substitutes the global variables in a template. Their
+// values are literal text, their `$` being escaped.
+func (l Autolink) expandVariables(template string) string {
+	if len(l.variables) == 0 {
+		return template
+	}
+	return variableRegexp.ReplaceAllStringFunc(template, func(ref string) string {
+		value, ok := l.variables[ref[2:len(ref)-2]]
+		if !ok {
+			return ref
+		}
+		return strings.ReplaceAll(value, "$", "$$")
+	})
+}
+
+// UndefinedVariables returns the names of the global variables the templates
+// of the link reference, but are not defined, sorted.
+func (l Autolink) UndefinedVariables(variables map[string]string) []string {
+	templates := []string{l.Template}
+	for _, c := range l.Cases {
+		templates = append(templates, c.Template)
+	}
+	templates = append(templates, l.sortedLocaleTemplates()...)
+	templates = append(templates, l.sortedScopeTemplates()...)
+	templates = append(templates, l.FallbackTemplate)
+	templates = append(templates, l.Attachment.templates()...)
+
+	found := map[string]bool{}
+	for _, template := range templates {
+		for _, match := range variableRegexp.FindAllStringSubmatch(template, -1) {
+			if _, ok := variables[match[1]]; !ok {
+				found[match[1]] = true
+			}
+		}
+	}
+	return sortedNames(found)
+}
+
+// UndefinedPatternFragments returns the names of the pattern fragments the
+// patterns of the link reference, but are not defined, sorted.
+func (l Autolink) UndefinedPatternFragments(fragments map[string]string) []string {
+	found := map[string]bool{}
+	for _, pattern := range l.AllPatterns() {
+		for _, match := range variableRegexp.FindAllStringSubmatch(pattern, -1) {
+			if _, ok := fragments[match[1]]; !ok {
+				found[match[1]] = true
+			}
+		}
+	}
+	return sortedNames(found)
+}
+
+func sortedNames(set map[string]bool) []string {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -3,9 +3,12 @@ package autolinkclient
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
 )
@@ -38,6 +41,49 @@ func NewClientPlugin(api PluginAPI) *Client {
 	return client
 }
 
+// tokenRoundTripper sends the requests to the plugin on a Mattermost server,
+// authenticated with a session or personal access token.
+type tokenRoundTripper struct {
+	siteURL string
+	token   string
+	next    http.RoundTripper
+}
+
+func (t *tokenRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	target, err := url.Parse(strings.TrimSuffix(t.siteURL, "/") + "/plugins" + req.URL.Path)
+	if err != nil {
+		return nil, err
+	}
+	target.RawQuery = req.URL.RawQuery
+
+	// A RoundTripper must not modify the request
+	out := new(http.Request)
+	*out = *req
+	out.URL = target
+	out.Host = target.Host
+	out.Header = make(http.Header, len(req.Header)+1)
+	for key, values := range req.Header {
+		out.Header[key] = values
+	}
+	out.Header.Set("Authorization", "Bearer "+t.token)
+	return t.next.RoundTrip(out)
+}
+
+// NewClientToken returns a client for external automation, calling the plugin
+// on the Mattermost server at siteURL with a session or personal access token.
+// The token must belong to a System Admin or a plugin admin, or to a team admin
+// for the links scoped to their teams if team admins are allowed to manage
+// links.
+func NewClientToken(siteURL, token string) *Client {
+	client := &Client{}
+	client.Transport = &tokenRoundTripper{
+		siteURL: siteURL,
+		token:   token,
+		next:    http.DefaultTransport,
+	}
+	return client
+}
+
 func (c *Client) Add(links ...autolink.Autolink) error {
 	for _, link := range links {
 		linkBytes, err := json.Marshal(link)
@@ -64,3 +110,324 @@ func (c *Client) Add(links ...autolink.Autolink) error {
 
 	return nil
 }
+
+// Delete removes the links with the given names. Only links registered by the
+// calling plugin may be deleted.
+func (c *Client) Delete(names ...string) error {
+	for _, name := range names {
+		req, err := http.NewRequest("DELETE", "/"+autolinkPluginID+"/api/v1/links/"+url.PathEscape(name), nil)
+		if err != nil {
+			return err
+		}
+
+		resp, err := c.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			respBody, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			return fmt.Errorf("unable to delete autolink. Error: %v, %v", resp.StatusCode, string(respBody))
+		}
+		resp.Body.Close()
+	}
+
+	return nil
+}
+
+// ErrLinkChanged is returned by Patch when the link was changed since its
+// entity tag was read.
+var ErrLinkChanged = errors.New("the link was changed since it was read")
+
+// Get returns the link with the given name, and its entity tag for Patch.
+func (c *Client) Get(name string) (*autolink.Autolink, string, error) {
+	req, err := http.NewRequest("GET", "/"+autolinkPluginID+"/api/v1/links/"+url.PathEscape(name), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	return c.doLink(req, "get")
+}
+
+// Patch updates the given fields of the link with the given name, by their
+// JSON names, leaving the others as they are. If etag is not empty, the link
+// is only updated if its entity tag is still etag, ErrLinkChanged being
+// returned otherwise. It returns the updated link and its new entity tag.
+func (c *Client) Patch(name string, fields map[string]interface{}, etag string) (*autolink.Autolink, string, error) {
+	body, err := json.Marshal(fields)
+	if err != nil {
+		return nil, "", err
+	}
+
+	req, err := http.NewRequest("PATCH", "/"+autolinkPluginID+"/api/v1/links/"+url.PathEscape(name), bytes.NewReader(body))
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	if etag != "" {
+		req.Header.Set("If-Match", etag)
+	}
+	return c.doLink(req, "patch")
+}
+
+// doLink sends a request responding with a link and its entity tag.
+func (c *Client) doLink(req *http.Request, action string) (*autolink.Autolink, string, error) {
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		return nil, "", ErrLinkChanged
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("unable to %s autolink. Error: %v, %v", action, resp.StatusCode, string(respBody))
+	}
+
+	var link autolink.Autolink
+	if err = json.Unmarshal(respBody, &link); err != nil {
+		return nil, "", err
+	}
+	return &link, resp.Header.Get("ETag"), nil
+}
+
+// List returns the links registered by the calling plugin.
+func (c *Client) List() ([]autolink.Autolink, error) {
+	req, err := http.NewRequest("GET", "/"+autolinkPluginID+"/api/v1/links", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to list autolinks. Error: %v, %v", resp.StatusCode, string(respBody))
+	}
+
+	var links []autolink.Autolink
+	if err = json.Unmarshal(respBody, &links); err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+// Validate returns the errors that would keep the links from working as
+// intended, without saving them. It returns no errors if they are all valid.
+func (c *Client) Validate(links ...autolink.Autolink) (autolink.ValidationErrors, error) {
+	linksBytes, err := json.Marshal(links)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", "/"+autolinkPluginID+"/api/v1/links/validate", bytes.NewReader(linksBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to validate autolinks. Error: %v, %v", resp.StatusCode, string(respBody))
+	}
+
+	var result struct {
+		Errors autolink.ValidationErrors `json:"errors"`
+	}
+	if err = json.Unmarshal(respBody, &result); err != nil {
+		return nil, err
+	}
+	return result.Errors, nil
+}
+
+// ReplaceResult is the names of the links added, updated and removed by
+// Replace.
+type ReplaceResult struct {
+	Added   []string `json:"added"`
+	Updated []string `json:"updated"`
+	Removed []string `json:"removed"`
+}
+
+// Replace replaces all the links that are not owned by a plugin with the
+// given links, e.g. to sync the links of another server. Only plugin admins
+// may replace the links, so it is not available to other plugins.
+func (c *Client) Replace(links []autolink.Autolink) (*ReplaceResult, error) {
+	linksBytes, err := json.Marshal(links)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("PUT", "/"+autolinkPluginID+"/api/v1/links", bytes.NewReader(linksBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to replace autolinks. Error: %v, %v", resp.StatusCode, string(respBody))
+	}
+
+	var result ReplaceResult
+	if err = json.Unmarshal(respBody, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// TestResult is the text rewritten by the links, and the text matched by each
+// link that changed it. Rejection is the explanation of the rejection of the
+// text by a reject link, if any.
+type TestResult struct {
+	Text      string `json:"text"`
+	Rejection string `json:"rejection,omitempty"`
+	Links     []struct {
+		Name    string   `json:"name"`
+		Matches []string `json:"matches"`
+	} `json:"links"`
+}
+
+// Test applies the links to the text as if it was posted in the channel,
+// without posting it, the links scoped to a channel or team only applying to
+// the text of their channels.
+func (c *Client) Test(text, channelID string) (*TestResult, error) {
+	body, err := json.Marshal(map[string]string{"text": text, "channel_id": channelID})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", "/"+autolinkPluginID+"/api/v1/test", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to test the text. Error: %v, %v", resp.StatusCode, string(respBody))
+	}
+
+	var result TestResult
+	if err = json.Unmarshal(respBody, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// MatchRequest is the body of the requests sent to the match middleware of a
+// plugin for each match of a link, before the match is replaced. The
+// characters matched around the match as boundaries are left out of Match and
+// Replacement.
+type MatchRequest struct {
+	Link        autolink.Autolink `json:"link"`
+	Match       string            `json:"match"`
+	Replacement string            `json:"replacement"`
+	PostID      string            `json:"post_id,omitempty"`
+	RootID      string            `json:"root_id,omitempty"`
+	UserID      string            `json:"user_id"`
+	ChannelID   string            `json:"channel_id"`
+	ChannelName string            `json:"channel_name,omitempty"`
+	TeamName    string            `json:"team_name,omitempty"`
+}
+
+// Actions of a MatchResponse.
+const (
+	// MatchAllow replaces the match with the replacement.
+	MatchAllow = "allow"
+	// MatchReplace replaces the match with the Replacement of the response.
+	MatchReplace = "replace"
+	// MatchVeto leaves the match as is.
+	MatchVeto = "veto"
+)
+
+// MatchResponse is the response of a match middleware.
+type MatchResponse struct {
+	Action      string `json:"action"`
+	Replacement string `json:"replacement,omitempty"`
+}
+
+// RegisterMatchMiddleware registers the calling plugin's match middleware, the
+// path of its HTTP handler receiving a MatchRequest for each match of the
+// links, and responding with a MatchResponse. A plugin has a single
+// middleware, registering another path replaces it.
+func (c *Client) RegisterMatchMiddleware(path string) error {
+	body, err := json.Marshal(struct {
+		Path string `json:"path"`
+	}{path})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("PUT", "/"+autolinkPluginID+"/api/v1/middleware", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("unable to register the match middleware. Error: %v, %v", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+// UnregisterMatchMiddleware unregisters the calling plugin's match
+// middleware.
+func (c *Client) UnregisterMatchMiddleware() error {
+	req, err := http.NewRequest("DELETE", "/"+autolinkPluginID+"/api/v1/middleware", nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("unable to unregister the match middleware. Error: %v, %v", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
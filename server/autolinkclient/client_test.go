@@ -1,7 +1,9 @@
 package autolinkclient
 
 import (
+	"encoding/json"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/mattermost/mattermost-server/v6/plugin/plugintest"
@@ -53,3 +55,103 @@ func TestAddAutolinksErr(t *testing.T) {
 	err := client.Add(autolink.Autolink{})
 	require.Error(t, err)
 }
+
+func TestClientToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/plugins/mattermost-autolink/api/v1/links", r.URL.Path)
+		require.Equal(t, "Bearer token1", r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte(`[{"Name": "link1"}]`))
+	}))
+	defer server.Close()
+
+	client := NewClientToken(server.URL+"/", "token1")
+	links, err := client.List()
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	require.Equal(t, "link1", links[0].Name)
+}
+
+func TestReplace(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "PUT", r.Method)
+		require.Equal(t, "/plugins/mattermost-autolink/api/v1/links", r.URL.Path)
+		var links []autolink.Autolink
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&links))
+		require.Len(t, links, 1)
+		_, _ = w.Write([]byte(`{"added": ["link1"], "updated": null, "removed": ["link2"]}`))
+	}))
+	defer server.Close()
+
+	client := NewClientToken(server.URL, "token1")
+	result, err := client.Replace([]autolink.Autolink{{Name: "link1"}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"link1"}, result.Added)
+	require.Equal(t, []string{"link2"}, result.Removed)
+}
+
+func TestTest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "POST", r.Method)
+		require.Equal(t, "/plugins/mattermost-autolink/api/v1/test", r.URL.Path)
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		require.Equal(t, map[string]string{"text": "MM-1", "channel_id": "channel1"}, body)
+		_, _ = w.Write([]byte(`{"text": "[MM-1](https://jira)", "links": [{"name": "jira", "matches": ["MM-1"]}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClientToken(server.URL, "token1")
+	result, err := client.Test("MM-1", "channel1")
+	require.NoError(t, err)
+	require.Equal(t, "[MM-1](https://jira)", result.Text)
+	require.Len(t, result.Links, 1)
+	require.Equal(t, "jira", result.Links[0].Name)
+	require.Equal(t, []string{"MM-1"}, result.Links[0].Matches)
+}
+
+func TestPatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "PATCH", r.Method)
+		require.Equal(t, "/plugins/mattermost-autolink/api/v1/links/jira", r.URL.Path)
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		require.Equal(t, map[string]interface{}{"Disabled": true}, body)
+		if r.Header.Get("If-Match") != `"v1"` {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		w.Header().Set("ETag", `"v2"`)
+		_, _ = w.Write([]byte(`{"Name": "jira", "Disabled": true}`))
+	}))
+	defer server.Close()
+
+	client := NewClientToken(server.URL, "token1")
+	link, etag, err := client.Patch("jira", map[string]interface{}{"Disabled": true}, `"v1"`)
+	require.NoError(t, err)
+	require.True(t, link.Disabled)
+	require.Equal(t, `"v2"`, etag)
+
+	_, _, err = client.Patch("jira", map[string]interface{}{"Disabled": true}, `"v0"`)
+	require.Equal(t, ErrLinkChanged, err)
+}
+
+func TestRegisterMatchMiddleware(t *testing.T) {
+	mockPluginAPI := &plugintest.API{}
+	mockPluginAPI.On("PluginHTTP", mock.AnythingOfType("*http.Request")).Return(func(req *http.Request) *http.Response {
+		require.Equal(t, "/mattermost-autolink/api/v1/middleware", req.URL.Path)
+		if req.Method == "PUT" {
+			var body struct {
+				Path string `json:"path"`
+			}
+			require.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+			require.Equal(t, "/autolink/match", body.Path)
+		} else {
+			require.Equal(t, "DELETE", req.Method)
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}
+	})
+
+	client := NewClientPlugin(mockPluginAPI)
+	require.NoError(t, client.RegisterMatchMiddleware("/autolink/match"))
+	require.NoError(t, client.UnregisterMatchMiddleware())
+}
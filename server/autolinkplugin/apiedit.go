@@ -0,0 +1,50 @@
+package autolinkplugin
+
+import (
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin"
+)
+
+// editPreservedPostProps are the post props kept from the previous version of
+// an edited post when the edit drops them, as edits made through the API
+// replace all the props: the props of the plugin, and those marking who made
+// the post, for an edit not to change how the post of its author is treated.
+var editPreservedPostProps = append([]string{
+	optOutPostProp,
+	originalMessagePostProp,
+	rewrittenMessagePostProp,
+	generatedPostProp,
+	rewritePassesPostProp,
+	pluginPostProp,
+	"from_bot",
+}, integrationPostProps...)
+
+// preserveEditedPostProps restores the props of the previous version of the
+// post that the edit dropped.
+func preserveEditedPostProps(post, oldPost *model.Post) {
+	if oldPost == nil {
+		return
+	}
+	for _, prop := range editPreservedPostProps {
+		if value := oldPost.GetProp(prop); value != nil && post.GetProp(prop) == nil {
+			post.AddProp(prop, value)
+		}
+	}
+}
+
+// isAPIEdit reports whether the post is being edited programmatically rather
+// than by a user in a client: by a plugin or the server itself, which have no
+// session, or with a personal access token, a bot token or an OAuth app.
+func (p *Plugin) isAPIEdit(c *plugin.Context) bool {
+	if c == nil || c.SessionId == "" {
+		return true
+	}
+	session, appErr := p.API.GetSession(c.SessionId)
+	if appErr != nil {
+		p.API.LogWarn("Failed to get the session editing the post", "error", appErr.Error())
+		return false
+	}
+	return session.IsOAuth ||
+		session.Props[model.SessionPropType] == model.SessionTypeUserAccessToken ||
+		session.Props[model.SessionPropIsBot] == model.SessionPropIsBotValue
+}
@@ -0,0 +1,201 @@
+package autolinkplugin
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin"
+	"github.com/pkg/errors"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/api"
+)
+
+// apiKeysKey is the KV store key of the API keys of the REST API, a JSON
+// object of the keys by name. Only the SHA-256 hashes of the keys are kept,
+// the keys themselves are shown once when they are created.
+const apiKeysKey = "api_keys"
+
+// apiKeyPrefix starts the API keys, for them to be recognized e.g. by secret
+// scanners.
+const apiKeyPrefix = "autolink_"
+
+// API key scopes
+const (
+	apiKeyScopeRead  = "read"
+	apiKeyScopeWrite = "write"
+)
+
+// storedAPIKey is an API key saved in the KV store.
+type storedAPIKey struct {
+	Hash      string    `json:"hash"`
+	Scope     string    `json:"scope"`
+	Group     string    `json:"group,omitempty"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// getAPIKeys returns the API keys, by name.
+func (p *Plugin) getAPIKeys() (map[string]storedAPIKey, error) {
+	data, appErr := p.API.KVGet(apiKeysKey)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to get the API keys")
+	}
+	keys := map[string]storedAPIKey{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &keys); err != nil {
+			return nil, errors.Wrap(err, "failed to decode the API keys")
+		}
+	}
+	return keys, nil
+}
+
+// saveAPIKeys saves the API keys.
+func (p *Plugin) saveAPIKeys(keys map[string]storedAPIKey) error {
+	data, err := json.Marshal(keys)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode the API keys")
+	}
+	if appErr := p.API.KVSet(apiKeysKey, data); appErr != nil {
+		return errors.Wrap(appErr, "failed to save the API keys")
+	}
+	return nil
+}
+
+// hashAPIKey returns the hash of an API key saved in the KV store. The keys
+// are random, so a plain hash is enough to not keep them.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKey returns the scope of an API key, if it is one of the keys created
+// with `/autolink apikey create`.
+func (p *Plugin) APIKey(key string) (api.APIKeyScope, bool) {
+	keys, err := p.getAPIKeys()
+	if err != nil {
+		p.API.LogError("Failed to load the API keys", "error", err.Error())
+		return api.APIKeyScope{}, false
+	}
+	hash := []byte(hashAPIKey(key))
+	for name, stored := range keys {
+		if subtle.ConstantTimeCompare(hash, []byte(stored.Hash)) == 1 {
+			return api.APIKeyScope{Name: name, Write: stored.Scope == apiKeyScopeWrite, Group: stored.Group}, true
+		}
+	}
+	return api.APIKeyScope{}, false
+}
+
+// checkAPIKeysAuthorized returns an error response unless the user is a plugin
+// admin, the only users who may manage the API keys.
+func checkAPIKeysAuthorized(p *Plugin, header *model.CommandArgs) *model.CommandResponse {
+	filter, err := linkFilter(p, header)
+	if err != nil {
+		return responsef("%v", err)
+	}
+	if filter != nil {
+		return responsef(header.T("autolink.command.apikey.not_authorized"))
+	}
+	return nil
+}
+
+func executeAPIKeyCreate(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) < 1 {
+		return responsef(header.T("autolink.command.help"))
+	}
+	if resp := checkAPIKeysAuthorized(p, header); resp != nil {
+		return resp
+	}
+	name := args[0]
+	stored := storedAPIKey{Scope: apiKeyScopeRead, CreatedBy: header.UserId, CreatedAt: time.Now().UTC()}
+	for i := 1; i < len(args); i++ {
+		switch {
+		case args[i] == optScopeFilter && i+1 < len(args):
+			i++
+			stored.Scope = args[i]
+		case args[i] == optGroupFilter && i+1 < len(args):
+			i++
+			stored.Group = args[i]
+		default:
+			return responsef(header.T("autolink.command.help"))
+		}
+	}
+	if stored.Scope != apiKeyScopeRead && stored.Scope != apiKeyScopeWrite {
+		return responsef(header.T("autolink.command.apikey.invalid_scope"), stored.Scope)
+	}
+
+	keys, err := p.getAPIKeys()
+	if err != nil {
+		return responsef(header.T("autolink.command.apikey.failed"), err)
+	}
+	if _, ok := keys[name]; ok {
+		return responsef(header.T("autolink.command.apikey.exists"), name)
+	}
+	key := apiKeyPrefix + model.NewId() + model.NewId()
+	stored.Hash = hashAPIKey(key)
+	keys[name] = stored
+	if err = p.saveAPIKeys(keys); err != nil {
+		return responsef(header.T("autolink.command.apikey.failed"), err)
+	}
+	p.API.LogInfo("API key created", "name", name, "scope", stored.Scope, "group", stored.Group, "user_id", header.UserId)
+	return responsef(header.T("autolink.command.apikey.created"), name, key)
+}
+
+func executeAPIKeyList(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) != 0 {
+		return responsef(header.T("autolink.command.help"))
+	}
+	if resp := checkAPIKeysAuthorized(p, header); resp != nil {
+		return resp
+	}
+	keys, err := p.getAPIKeys()
+	if err != nil {
+		return responsef(header.T("autolink.command.apikey.failed"), err)
+	}
+	if len(keys) == 0 {
+		return responsef(header.T("autolink.command.apikey.none"))
+	}
+
+	names := make([]string, 0, len(keys))
+	for name := range keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := header.T("autolink.command.apikey.list")
+	for _, name := range names {
+		stored := keys[name]
+		group := stored.Group
+		if group == "" {
+			group = "*"
+		}
+		out += fmt.Sprintf("- `%s`: %s, group `%s`, created %s\n", name, stored.Scope, group, stored.CreatedAt.Format(time.RFC3339))
+	}
+	return responsef("%s", out)
+}
+
+func executeAPIKeyRevoke(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) != 1 {
+		return responsef(header.T("autolink.command.help"))
+	}
+	if resp := checkAPIKeysAuthorized(p, header); resp != nil {
+		return resp
+	}
+	keys, err := p.getAPIKeys()
+	if err != nil {
+		return responsef(header.T("autolink.command.apikey.failed"), err)
+	}
+	if _, ok := keys[args[0]]; !ok {
+		return responsef(header.T("autolink.command.apikey.not_found"), args[0])
+	}
+	delete(keys, args[0])
+	if err = p.saveAPIKeys(keys); err != nil {
+		return responsef(header.T("autolink.command.apikey.failed"), err)
+	}
+	p.API.LogInfo("API key revoked", "name", args[0], "user_id", header.UserId)
+	return responsef(header.T("autolink.command.apikey.revoked"), args[0])
+}
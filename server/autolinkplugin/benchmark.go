@@ -0,0 +1,165 @@
+package autolinkplugin
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+const (
+	// benchmarkRounds is the maximum number of times each link is run
+	// against each message by `/autolink benchmark`.
+	benchmarkRounds = 20
+
+	// benchmarkBudget is the time after which `/autolink benchmark` stops
+	// starting new rounds, for large link sets not to tie up the server.
+	benchmarkBudget = 5 * time.Second
+
+	// benchmarkSlowFactor is how many times slower than the median link a
+	// link must be to be highlighted as slow.
+	benchmarkSlowFactor = 10
+)
+
+// benchmarkCorpus are the sample messages the links are benchmarked against,
+// in addition to the last posts of the channel.
+var benchmarkCorpus = []string{
+	"Hello everyone, good morning!",
+	"Can someone review MM-12345 and MM-67890 before the release? Thanks",
+	"See https://github.com/mattermost/mattermost-server/pull/12345 and https://example.com/docs?page=2#install",
+	"The build failed:\n```\npanic: runtime error: index out of range [3] with length 3\n\tmain.go:42 +0x1d\n```\nAny idea?",
+	"| Ticket | Owner | Status |\n|---|---|---|\n| INC-1 | @alice | open |\n| INC-2 | @bob | closed |",
+	"Привет! 你好，请看一下 ABC-123。こんにちは、よろしくお願いします 🚀",
+	strings.Repeat("The quick brown fox jumps over the lazy dog, then reports bug 4111 1111 1111 1111 to support@example.com. ", 40),
+	strings.Repeat("a", 2000),
+	strings.Repeat("MM-1 ", 400),
+	strings.Repeat("((((([[[[[{{{{{ ", 100),
+}
+
+// linkTiming are the times a link took to process single messages.
+type linkTiming struct {
+	name    string
+	samples []time.Duration
+	average time.Duration
+}
+
+func (lt linkTiming) percentile(p int) time.Duration {
+	if len(lt.samples) == 0 {
+		return 0
+	}
+	return lt.samples[(len(lt.samples)-1)*p/100]
+}
+
+// benchmarkLinks runs each link against each message for up to rounds rounds,
+// and returns the timings of the links from the slowest to the fastest on
+// average, and the number of rounds run before the budget was exhausted.
+func benchmarkLinks(links []autolink.Autolink, messages []string, rounds int, budget time.Duration) ([]linkTiming, int) {
+	timings := make([]linkTiming, len(links))
+	for i, l := range links {
+		timings[i].name = l.DisplayName()
+	}
+
+	start := time.Now()
+	round := 0
+	for round < rounds && (round == 0 || time.Since(start) < budget) {
+		for i, l := range links {
+			for _, message := range messages {
+				before := time.Now()
+				l.Replace(message)
+				timings[i].samples = append(timings[i].samples, time.Since(before))
+			}
+		}
+		round++
+	}
+
+	for i := range timings {
+		samples := timings[i].samples
+		sort.Slice(samples, func(a, b int) bool { return samples[a] < samples[b] })
+		var total time.Duration
+		for _, d := range samples {
+			total += d
+		}
+		if len(samples) > 0 {
+			timings[i].average = total / time.Duration(len(samples))
+		}
+	}
+	sort.SliceStable(timings, func(a, b int) bool { return timings[a].average > timings[b].average })
+	return timings, round
+}
+
+func executeBenchmark(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) > 1 {
+		return responsef(header.T("autolink.command.help"))
+	}
+
+	links, refs, err := searchLinkRef(p, header, false, args...)
+	if err != nil {
+		return responsef("%v", err)
+	}
+	if refs == nil {
+		refs = []int{}
+		for i := range links {
+			refs = append(refs, i)
+		}
+	}
+
+	compiled := []autolink.Autolink{}
+	failed := []string{}
+	for _, ref := range refs {
+		l := links[ref]
+		l.Disabled = false
+		if l.Compile() != nil {
+			failed = append(failed, l.DisplayName())
+			continue
+		}
+		compiled = append(compiled, l)
+	}
+	if len(compiled) == 0 {
+		return responsef(header.T("autolink.command.benchmark.no_links"))
+	}
+
+	messages := append([]string{}, benchmarkCorpus...)
+	postList, appErr := p.API.GetPostsForChannel(header.ChannelId, 0, maxTestLastPosts)
+	if appErr != nil {
+		p.API.LogWarn("Failed to get the channel posts to benchmark the links", "error", appErr.Error())
+	} else {
+		for _, id := range postList.Order {
+			if post := postList.Posts[id]; post != nil && post.Message != "" {
+				messages = append(messages, post.Message)
+			}
+		}
+	}
+
+	timings, rounds := benchmarkLinks(compiled, messages, benchmarkRounds, benchmarkBudget)
+
+	out := header.T("autolink.command.benchmark.summary", len(compiled), len(messages), rounds)
+	out += "| Link | Average | p50 | p95 | p99 | Max |\n|---|---|---|---|---|---|\n"
+	median := timings[len(timings)/2].average
+	slow := []string{}
+	for _, lt := range timings {
+		name := escapeTableCell(lt.name)
+		if len(timings) > 1 && lt.average >= benchmarkSlowFactor*median && lt.average > 0 {
+			name = "**" + name + "**"
+			slow = append(slow, lt.name)
+		}
+		out += fmt.Sprintf("| %s | %v | %v | %v | %v | %v |\n", name,
+			lt.average, lt.percentile(50), lt.percentile(95), lt.percentile(99), lt.percentile(100))
+	}
+	if len(slow) > 0 {
+		out += header.T("autolink.command.benchmark.slow", benchmarkSlowFactor, strings.Join(slow, ", "))
+	}
+	if len(failed) > 0 {
+		out += header.T("autolink.command.benchmark.failed", strings.Join(failed, ", "))
+	}
+	return responsef("%s", out)
+}
+
+// escapeTableCell keeps the text from breaking a markdown table row.
+func escapeTableCell(text string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(text)
+}
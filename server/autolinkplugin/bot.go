@@ -0,0 +1,131 @@
+package autolinkplugin
+
+import (
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	botUsername    = "autolink"
+	botDisplayName = "Autolink"
+	botDescription = "Created by the Autolink plugin."
+)
+
+// ensureBot returns the user ID of the plugin bot, creating the bot if it
+// does not exist yet. The bot is ensured when the plugin is activated, and
+// again on first use if that failed.
+func (p *Plugin) ensureBot() (string, error) {
+	p.botLock.Lock()
+	defer p.botLock.Unlock()
+
+	if p.botUserID != "" {
+		return p.botUserID, nil
+	}
+
+	user, appErr := p.API.GetUserByUsername(botUsername)
+	if appErr == nil && user != nil {
+		if !user.IsBot {
+			return "", errors.Errorf("the %q username is taken by a user who is not a bot", botUsername)
+		}
+		p.botUserID = user.Id
+		return p.botUserID, nil
+	}
+
+	bot, appErr := p.API.CreateBot(&model.Bot{
+		Username:    botUsername,
+		DisplayName: botDisplayName,
+		Description: botDescription,
+	})
+	if appErr != nil {
+		return "", errors.Wrap(appErr, "failed to create the bot")
+	}
+	p.botUserID = bot.UserId
+	return p.botUserID, nil
+}
+
+// sendBotEphemeral shows the user an ephemeral post from the plugin bot, or
+// from the system if the bot could not be ensured on activation.
+func (p *Plugin) sendBotEphemeral(userID string, post *model.Post) {
+	p.botLock.Lock()
+	post.UserId = p.botUserID
+	p.botLock.Unlock()
+
+	p.API.SendEphemeralPost(userID, post)
+}
+
+// isBotPost reports whether the post was made by the plugin bot.
+func (p *Plugin) isBotPost(post *model.Post) bool {
+	p.botLock.Lock()
+	defer p.botLock.Unlock()
+
+	return p.botUserID != "" && post.UserId == p.botUserID
+}
+
+// sendBotDM sends a direct message from the plugin bot to the user.
+func (p *Plugin) sendBotDM(userID, message string) error {
+	botUserID, err := p.ensureBot()
+	if err != nil {
+		return err
+	}
+
+	channel, appErr := p.API.GetDirectChannel(botUserID, userID)
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to get the direct channel")
+	}
+	_, appErr = p.API.CreatePost(&model.Post{
+		UserId:    botUserID,
+		ChannelId: channel.Id,
+		Message:   message,
+	})
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to send the direct message")
+	}
+	return nil
+}
+
+// notifyAdmins sends the plugin admins a direct message, translated to their
+// locale. It reports whether at least one of them was notified.
+func (p *Plugin) notifyAdmins(messageID string, args ...interface{}) bool {
+	adminIDs, err := p.pluginAdminIDs()
+	if err != nil {
+		p.API.LogError("Failed to get the admins to notify", "error", err.Error())
+		return false
+	}
+	notified := false
+	for _, userID := range adminIDs {
+		t := p.translateFunc(p.userLocale(userID))
+		if err = p.sendBotDM(userID, t(messageID, args...)); err != nil {
+			p.API.LogWarn("Failed to notify an admin", "user_id", userID, "error", err.Error())
+			continue
+		}
+		notified = true
+	}
+	return notified
+}
+
+// pluginAdminIDs returns the IDs of the users to notify about the links: the
+// plugin admins, or the system admins if there are none.
+func (p *Plugin) pluginAdminIDs() ([]string, error) {
+	conf := p.getConfig()
+	if len(conf.AdminUserIds) > 0 {
+		ids := make([]string, 0, len(conf.AdminUserIds))
+		for id := range conf.AdminUserIds {
+			ids = append(ids, id)
+		}
+		return ids, nil
+	}
+
+	users, appErr := p.API.GetUsers(&model.UserGetOptions{
+		Role:    model.SystemAdminRoleId,
+		Active:  true,
+		PerPage: 200,
+	})
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to get the system admins")
+	}
+	ids := make([]string, 0, len(users))
+	for _, user := range users {
+		ids = append(ids, user.Id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,16 @@
+package autolinkplugin
+
+import "crypto/subtle"
+
+// CINamespace returns the namespace of the links CI pipelines may publish
+// with the CI token, if the token is the one configured.
+func (p *Plugin) CINamespace(token string) (string, bool) {
+	conf := p.getConfig()
+	if conf.CIToken == "" || conf.CINamespace == "" {
+		return "", false
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(conf.CIToken)) != 1 {
+		return "", false
+	}
+	return conf.CINamespace, true
+}
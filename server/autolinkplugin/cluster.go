@@ -0,0 +1,128 @@
+package autolinkplugin
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin"
+)
+
+// The events sent to the other servers of a cluster, for them to apply the
+// changes made on this server instead of waiting for their next checks.
+const (
+	// clusterEventLinksChanged is sent when the links were saved, for the
+	// other servers to load them again.
+	clusterEventLinksChanged = "links_changed"
+
+	// clusterEventPauseChanged is sent with the end of the pause, empty when
+	// autolinking was resumed.
+	clusterEventPauseChanged = "pause_changed"
+
+	// clusterEventOptOutChanged is sent with the KV store key of an opt-out
+	// preference that changed, for the other servers to forget its cached
+	// value.
+	clusterEventOptOutChanged = "optout_changed"
+
+	// clusterEventLinkStats is sent with the linkStats of this server.
+	clusterEventLinkStats = "link_stats"
+
+	// clusterEventMiddlewaresChanged is sent when the match middlewares of
+	// the other plugins changed, for the other servers to load them again.
+	clusterEventMiddlewaresChanged = "middlewares_changed"
+
+	// clusterEventReload is sent when the configuration was reloaded with
+	// `/autolink reload`, for the other servers to reload it too.
+	clusterEventReload = "reload"
+)
+
+// statsShareInterval is how often the activity of the links is shared with
+// the other servers.
+const statsShareInterval = time.Minute
+
+// publishClusterEvent sends the event to the other servers of the cluster.
+// Nothing is sent on a single server.
+func (p *Plugin) publishClusterEvent(id string, data []byte, sendType string) {
+	err := p.API.PublishPluginClusterEvent(
+		model.PluginClusterEvent{Id: id, Data: data},
+		model.PluginClusterEventSendOptions{SendType: sendType},
+	)
+	if err != nil {
+		p.API.LogWarn("Failed to send the change to the other servers", "event", id, "error", err.Error())
+	}
+}
+
+// shareStats sends the activity of the links since the last call to the
+// other servers. Lost stats are not sent again.
+func (p *Plugin) shareStats() {
+	stats := p.diagnostics.takeStats()
+	if stats == nil {
+		return
+	}
+	data, err := json.Marshal(stats)
+	if err != nil {
+		p.API.LogWarn("Failed to encode the link stats", "error", err.Error())
+		return
+	}
+	p.publishClusterEvent(clusterEventLinkStats, data, model.PluginClusterEventSendTypeBestEffort)
+}
+
+// OnPluginClusterEvent applies the changes made on another server of the
+// cluster.
+func (p *Plugin) OnPluginClusterEvent(c *plugin.Context, ev model.PluginClusterEvent) {
+	switch ev.Id {
+	case clusterEventLinksChanged:
+		p.reloadLinks()
+
+	case clusterEventPauseChanged:
+		var until time.Time
+		if len(ev.Data) > 0 {
+			var err error
+			if until, err = time.Parse(time.RFC3339, string(ev.Data)); err != nil {
+				p.API.LogWarn("Invalid pause", "value", string(ev.Data), "error", err.Error())
+				return
+			}
+		}
+		p.pause.lock.Lock()
+		p.pause.until = until
+		p.pause.lock.Unlock()
+
+	case clusterEventOptOutChanged:
+		p.optOutCache.Delete(string(ev.Data))
+
+	case clusterEventLinkStats:
+		var stats linkStats
+		if err := json.Unmarshal(ev.Data, &stats); err != nil {
+			p.API.LogWarn("Failed to decode the link stats", "error", err.Error())
+			return
+		}
+		p.diagnostics.mergeStats(stats)
+
+	case clusterEventMiddlewaresChanged:
+		p.loadMiddlewares()
+
+	case clusterEventReload:
+		if err := p.loadConfiguration(true); err != nil {
+			p.API.LogError("Failed to reload the configuration", "error", err.Error())
+		}
+
+	default:
+		p.API.LogWarn("Unknown cluster event", "event", ev.Id)
+	}
+}
+
+// reloadLinks loads the links from the KV store, after another server saved
+// them.
+func (p *Plugin) reloadLinks() {
+	p.confLock.Lock()
+	defer p.confLock.Unlock()
+
+	c := *p.conf
+	links, _, err := p.readLinks(&c)
+	if err != nil {
+		p.API.LogError("Failed to load the links changed by another server", "error", err.Error())
+		return
+	}
+	p.setLinks(&c, links, p.conf)
+	p.conf = &c
+}
@@ -0,0 +1,165 @@
+package autolinkplugin
+
+import (
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v6/shared/markdown"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+// textKind is the part of a message some text is in, which decides the links
+// applying to it.
+type textKind int
+
+const (
+	textPlain textKind = iota
+	textLabel
+	textCodeSpan
+	textCodeBlock
+)
+
+func (k textKind) isCode() bool {
+	return k == textCodeSpan || k == textCodeBlock
+}
+
+// appliesToText reports whether the link applies to the text of the kind.
+func appliesToText(link autolink.Autolink, kind textKind) bool {
+	switch kind {
+	case textLabel:
+		return link.ProcessLinkLabels && !link.CodeOnly
+	case textCodeSpan:
+		return link.CodeSpans
+	case textCodeBlock:
+		return link.CodeBlocks
+	}
+	return !link.CodeOnly
+}
+
+// generatedTexts applies the link to the spans of code that were not generated
+// by a Terminal link, substituting at most limit matches if it is not
+// negative. It returns the text generated for each match, the code itself
+// being left as is.
+func generatedTexts(link autolink.Autolink, spans []autolink.Span, limit int) ([]string, int, bool) {
+	var generated []string
+	total := 0
+	truncated := false
+	for _, span := range spans {
+		if span.Replaced {
+			continue
+		}
+
+		n := limit
+		if limit >= 0 {
+			n = limit - total
+		}
+		replaced, count, spanTruncated := link.ReplaceSpans(span.Text, n)
+		for _, s := range replaced {
+			if s.Replaced {
+				generated = append(generated, s.Text)
+			}
+		}
+		total += count
+		truncated = truncated || spanTruncated
+	}
+	return generated, total, truncated
+}
+
+// findCodeSpan finds the code span of the code in the message, at or after
+// from. It returns the range of the code between the backticks, and the end
+// of the closing backticks.
+func findCodeSpan(message string, from int, code string) (int, int, int, bool) {
+	for from < len(message) {
+		i := strings.IndexByte(message[from:], '`')
+		if i < 0 {
+			break
+		}
+		codeStart := from + i
+		for codeStart < len(message) && message[codeStart] == '`' {
+			codeStart++
+		}
+		// The code span ends with as many backticks as it starts with
+		fence := message[from+i : codeStart]
+		for search := codeStart; search < len(message); {
+			j := strings.Index(message[search:], fence)
+			if j < 0 {
+				break
+			}
+			codeEnd := search + j
+			end := codeEnd + len(fence)
+			if end < len(message) && message[end] == '`' {
+				for end < len(message) && message[end] == '`' {
+					end++
+				}
+				search = end
+				continue
+			}
+			if strings.Join(strings.Fields(message[codeStart:codeEnd]), " ") == code {
+				return codeStart, codeEnd, end, true
+			}
+			break
+		}
+		from = codeStart
+	}
+	return 0, 0, 0, false
+}
+
+// codeBlockLines returns the ranges of the lines of code of a fenced or
+// indented code block, the end of the block, before the line ending of its
+// last line, and the prefix of its lines, keeping the text added after the
+// block in the same list item or block quote.
+func codeBlockLines(message string, node interface{}) ([]markdown.Range, int, string) {
+	var lines []markdown.Range
+	blockEnd, prefix := 0, ""
+	switch node := node.(type) {
+	case *markdown.FencedCode:
+		for _, line := range node.RawCode {
+			lines = append(lines, line.Range)
+		}
+		lineStart := strings.LastIndexByte(message[:node.OpeningFence.Position], '\n') + 1
+		prefix = containerPrefix(message[lineStart:node.OpeningFence.Position])
+
+		blockEnd = node.RawInfo.End
+		if len(lines) > 0 {
+			blockEnd = lines[len(lines)-1].End
+		}
+		// The closing fence is the line after the code, if the block is
+		// closed
+		closing := blockEnd
+		if closing < len(message) && message[closing] == '\n' {
+			closing++
+		}
+		lineEnd := len(message)
+		if i := strings.IndexByte(message[closing:], '\n'); i >= 0 {
+			lineEnd = closing + i
+		}
+		fence := message[node.OpeningFence.Position:node.OpeningFence.End]
+		if strings.HasPrefix(strings.TrimLeft(message[closing:lineEnd], " \t>"), fence) {
+			blockEnd = lineEnd
+		}
+
+	case *markdown.IndentedCode:
+		for _, line := range node.RawCode {
+			lines = append(lines, line.Range)
+		}
+		if len(lines) > 0 {
+			blockEnd = lines[len(lines)-1].End
+		}
+	}
+	blockEnd = strings.LastIndexFunc(message[:blockEnd], func(r rune) bool {
+		return r != '\n' && r != '\r'
+	}) + 1
+	return lines, blockEnd, prefix
+}
+
+// containerPrefix returns the prefix of the lines continuing the list items
+// and block quotes the line starting with prefix is in: its `>` and
+// whitespace, the list markers being replaced with spaces.
+func containerPrefix(prefix string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '>' || r == ' ' || r == '\t' {
+			return r
+		}
+		return ' '
+	}, prefix)
+}
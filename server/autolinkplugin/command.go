@@ -1,41 +1,152 @@
 package autolinkplugin
 
 import (
+	"encoding/json"
 	"fmt"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
 	"github.com/mattermost/mattermost-server/v6/model"
 	"github.com/mattermost/mattermost-server/v6/plugin"
 	"github.com/pkg/errors"
 
+	"github.com/mattermost/mattermost-plugin-autolink/server/api"
 	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+	"github.com/mattermost/mattermost-plugin-autolink/server/importer"
 )
 
 const (
-	autolinkCommand         = "/autolink"
-	optName                 = "Name"
-	optTemplate             = "Template"
-	optPattern              = "Pattern"
-	optScope                = "Scope"
-	optDisabled             = "Disabled"
-	optProcessBotPosts      = "ProcessBotPosts"
-	optDisableNonWordPrefix = "DisableNonWordPrefix"
-	optDisableNonWordSuffix = "DisableNonWordSuffix"
-	optWordMatch            = "WordMatch"
+	optName                    = "Name"
+	optTemplate                = "Template"
+	optPattern                 = "Pattern"
+	optScope                   = "Scope"
+	optDisabled                = "Disabled"
+	optProcessBotPosts         = "ProcessBotPosts"
+	optProcessIntegrationPosts = "ProcessIntegrationPosts"
+	optProcessPluginPosts      = "ProcessPluginPosts"
+	optProcessOnUpdate         = "ProcessOnUpdate"
+	optDisableNonWordPrefix    = "DisableNonWordPrefix"
+	optDisableNonWordSuffix    = "DisableNonWordSuffix"
+	optWordMatch               = "WordMatch"
+	optCaseInsensitive         = "CaseInsensitive"
+	optMultiLine               = "MultiLine"
+	optDotAll                  = "DotAll"
+	optAcrossLines             = "AcrossLines"
+	optUnicodeWordMatch        = "UnicodeWordMatch"
+	optBoundaryClass           = "BoundaryClass"
+	optPrefixChars             = "PrefixChars"
+	optSuffixChars             = "SuffixChars"
+	optEnrich                  = "Enrich"
+	optEnrichTTL               = "EnrichTTL"
+	optFallbackTemplate        = "FallbackTemplate"
+	optCases                   = "Cases"
+	optLocaleTemplates         = "LocaleTemplates"
+	optScopeTemplates          = "ScopeTemplates"
+	optTerminal                = "Terminal"
+	optAttachment              = "Attachment"
+	optTerminalPost            = "TerminalPost"
+	optDebug                   = "Debug"
+	optShadowMode              = "ShadowMode"
+	optThreads                 = "Threads"
+	optGroup                   = "Group"
+	optTags                    = "Tags"
+	optDescription             = "Description"
+	optOwner                   = "Owner"
+	optWebhookURL              = "WebhookURL"
+	optMentions                = "Mentions"
+	optEngine                  = "Engine"
+	optStyle                   = "Style"
+	optTextPrefix              = "TextPrefix"
+	optTextSuffix              = "TextSuffix"
+	optKind                    = "Kind"
+	optRepositories            = "Repositories"
+	optPatterns                = "Patterns"
+	optBotAllowlist            = "BotAllowlist"
+	optBotDenylist             = "BotDenylist"
+	optLast                    = "--last"
+	optMaxReplacements         = "MaxReplacements"
+	optFirstMatchOnly          = "FirstMatchOnly"
+	optProcessLinkLabels       = "ProcessLinkLabels"
+	optCodeBlocks              = "CodeBlocks"
+	optCodeSpans               = "CodeSpans"
+	optCodeOnly                = "CodeOnly"
+	optPage                    = "--page"
+	optRegex                   = "--regex"
+	optFormat                  = "--format"
+	optPost                    = "--post"
+	optStats                   = "--stats"
+	optFilter                  = "--filter"
+	optDryRun                  = "--dry-run"
+	optScopeFilter             = "--scope"
+	optGroupFilter             = "--group"
+	optTagFilter               = "--tag"
+	optEnabledFilter           = "--enabled"
+	optDisabledFilter          = "--disabled"
+	optConfirm                 = "--confirm"
+	optActiveFrom              = "ActiveFrom"
+	optActiveUntil             = "ActiveUntil"
+	optSchedule                = "Schedule"
+	optExpiresAt               = "ExpiresAt"
 )
 
+// listPageSize is the number of links listed per page by `/autolink list`.
+const listPageSize = 20
+
+// maxTestLastPosts is the maximum number of channel posts `/autolink test`
+// runs a link against.
+const maxTestLastPosts = 100
+
 const helpText = "###### Mattermost Autolink Plugin Administration\n" +
-	"<linkref> is either the Name of a link, or its number in the `/autolink list` output. A partial Name can be specified, but some commands require it to be uniquely resolved.\n" +
+	"<linkref> is either the Name of a link, or its number in the `/autolink list` output. A partial Name can be specified, but some commands require it to be uniquely resolved, by the exact Name or by the only Name starting with it.\n" +
 	"* `/autolink add <name>` - add a new link, named <name>.\n" +
-	"* `/autolink delete <linkref>` - delete a link.\n" +
-	"* `/autolink disable <linkref>` - disable a link.\n" +
-	"* `/autolink enable <linkref>` - enable a link.\n" +
+	"* `/autolink add-preset <preset> [--name <name>] [--<param> <value>]...` - add a link for a common service, like `jira` or `github`. Run without arguments to list the presets and their parameters.\n" +
+	"* `/autolink channel disable|enable` - disable or enable autolinking in the current channel. Available to channel admins.\n" +
+	"* `/autolink delete <linkref> [--confirm]` - delete a link, once confirmed.\n" +
+	"* `/autolink disable <linkref>|--all` - disable a link, or all the links.\n" +
+	"* `/autolink enable <linkref>|--all` - enable a link, or all the links.\n" +
+	"* `/autolink debug <linkref> on|off` - log every evaluation of a link at the debug level, or stop logging them.\n" +
+	"* `/autolink import-github <owner>[/<repo>]` - import the autolink references of a GitHub organization, user or repository.\n" +
+	"* `/autolink import-gitlab <group>[/<project>]` - import the issue and merge request references of a GitLab group or project.\n" +
+	"* `/autolink accept-suggestion <id>` - add a link suggested for URLs posted often, when suggestions are enabled.\n" +
+	"* `/autolink import-csv <csv>` - add or update links from CSV lines following the command, with `name,pattern,template,scope` columns named on the first line, or `term,url` pairs.\n" +
+	"* `/autolink selftest` - check the configuration, the links, the current channel, a test rewrite and the KV store, reporting each stage as passed or failed.\n" +
+	"* `/autolink lint` - check the links for overlapping patterns, invalid scopes and other likely mistakes.\n" +
+	"* `/autolink benchmark [linkref]` - time the links against sample messages and the last posts of the channel, to find slow patterns.\n" +
 	"* `/autolink list <linkref>` - list a specific link.\n" +
+	"* `/autolink manage [--page <n>]` - show the links with buttons to enable, disable, edit or delete them.\n" +
+	"* `/autolink preview <text>` - show how a message would be autolinked in the current channel, and which links match. Available to all users.\n" +
+	"* `/autolink optout [on|off]` - stop or resume autolinking your own posts. Available to all users.\n" +
+	"* `/autolink reload` - read the configuration and the links again and compile all the links, on every server, reporting the links that do not compile.\n" +
+	"* `/autolink profile save|apply|delete <name>` - save which links are enabled as a profile, enable only the links of a profile, or delete a profile. `/autolink profile apply off` disables all the links.\n" +
+	"* `/autolink profile list` - list the profiles and the links they enable.\n" +
+	"* `/autolink pause [duration]` - stop autolinking all posts for a while, 1h by default, e.g. during an import.\n" +
+	"* `/autolink resume` - resume autolinking before the end of a pause.\n" +
+	"* `/autolink sync pull|push [--dry-run]` - replace the links with the links of the server configured to sync with, or replace its links with these. `--dry-run` lists the changes without making them.\n" +
+	"* `/autolink revert [permalink]` - restore the message of your post as it was before being autolinked, by default your latest autolinked post in the channel. Available to all users.\n" +
 	"* `/autolink list <field> value` - list links whose <field> contains value. Here <field> can be Template or Pattern\n" +
 	"* `/autolink list` - list all configured links.\n" +
+	"* `/autolink list ... --page <n>` - show another page of a long list, 20 links per page.\n" +
+	"* `/autolink list ... [--scope <team>[/<channel>]] [--group <group>] [--tag <tag>] [--enabled|--disabled]` - list only the links with the scope, a team matching its channels too, in the group, with the tag, or enabled or disabled.\n" +
+	"* `/autolink list ... --format default|markdown|json [--post]` - list the links as a markdown table or as JSON, and with `--post` post the list to the channel for everyone to see.\n" +
+	"* `/autolink list ... --stats` - show how many posts each link changed over the last 7 and 30 days, and when it last did, to spot the unused links.\n" +
+	"* `/autolink search [--regex] <text>` - list the links whose name, patterns, template or scope contain <text>, or match it as a regular expression.\n" +
+	"* `/autolink setup` - create a link step by step in dialogs: choose a preset or a custom pattern, test it on a sample text, and choose its scope.\n" +
 	"* `/autolink set <linkref> <field> value...` - sets a link's field to a value. The entire command line after <field> is used for the value, unescaped, leading/trailing whitespace trimmed.\n" +
+	"* `/autolink set --filter <field>=<pattern> <field> value... [--dry-run|--confirm]` - set a field of all the links whose name, pattern, template or scope matches the pattern, where `*` matches any text. With `--filter scope=oldteam/* Scope newteam/*`, matching scopes are renamed. `--dry-run` lists the links without changing them, and `--confirm` skips the confirmation.\n" +
 	"* `/autolink test <linkref> test-text...` - test a link on a sample.\n" +
+	"* `/autolink test <linkref> --last N` - test a link on the last N posts of the current channel.\n" +
+	"* `/autolink test-all test-text...` - test all the links applying to the current channel on a sample, in the order they apply.\n" +
+	"* `/autolink sample add <linkref> <name> <text>` - record a named sample text of a link, with the text the link generates from it.\n" +
+	"* `/autolink sample list|delete|update <linkref> [name]` - list the samples of a link, delete one, or record what the link generates now once a change is intended.\n" +
+	"* `/autolink verify [linkref]` - run the links against their samples, reporting the samples whose generated text changed.\n" +
+	"* `/autolink simulate [--include-disabled] [file-id]` - run the links against an exported channel, the file or the last file you posted in the channel, and report how many posts each link would have rewritten.\n" +
+	"* `/autolink export [--scope <team>[/<channel>]] [--group <group>] [--tag <tag>] [--enabled|--disabled]` - send yourself the links, or only the links with the scope, group or tag, as a JSON file to add to the links of another server.\n" +
+	"* `/autolink apikey create <name> [--scope read|write] [--group <group>]` - create a key of the REST API for automation, reading or also changing the links, of a group or all of them.\n" +
+	"* `/autolink apikey list|revoke [name]` - list the API keys, or revoke one.\n" +
 	"\n" +
 	"Example:\n" +
 	"```\n" +
@@ -44,6 +155,12 @@ const helpText = "###### Mattermost Autolink Plugin Administration\n" +
 	`/autolink set Visa Pattern (?P<VISA>(?P<part1>4\d{3})[ -]?(?P<part2>\d{4})[ -]?(?P<part3>\d{4})[ -]?(?P<LastFour>[0-9]{4}))` + "\n" +
 	"/autolink set Visa Template VISA XXXX-XXXX-XXXX-$LastFour\n" +
 	"/autolink set Visa WordMatch true\n" +
+	"/autolink set Visa CaseInsensitive true\n" +
+	"/autolink set Visa UnicodeWordMatch true\n" +
+	"/autolink set Visa PrefixChars (\n" +
+	"/autolink set Visa ActiveUntil 2024-01-31T00:00:00Z\n" +
+	"/autolink set Visa Schedule * 9-17 * * 1-5\n" +
+	"/autolink set Visa ExpiresAt 2024-06-30T00:00:00Z\n" +
 	"/autolink set Visa Scope team/townsquare\n" +
 	"/autolink set Visa ProcessBotPosts true\n" +
 	"/autolink test Visa 4356-7891-2345-1111 -- (4111222233334444)\n" +
@@ -60,81 +177,465 @@ type CommandHandler struct {
 
 var autolinkCommandHandler = CommandHandler{
 	handlers: map[string]CommandHandlerFunc{
-		"help":    executeHelp,
-		"list":    executeList,
-		"delete":  executeDelete,
-		"disable": executeDisable,
-		"enable":  executeEnable,
-		"add":     executeAdd,
-		"set":     executeSet,
-		"test":    executeTest,
+		"help":          executeHelp,
+		"list":          executeList,
+		"search":        executeSearch,
+		"delete":        executeDelete,
+		"disable":       executeDisable,
+		"enable":        executeEnable,
+		"debug":         executeDebug,
+		"add":           executeAdd,
+		"add-preset":    executeAddPreset,
+		"set":           executeSet,
+		"test":          executeTest,
+		"test-all":      executeTestAll,
+		"lint":          executeLint,
+		"benchmark":     executeBenchmark,
+		"manage":        executeManage,
+		"setup":         executeSetup,
+		"import-github": executeImportGitHub,
+		"import-gitlab": executeImportGitLab,
+		"import-csv":    executeImportCSV,
+		"pause":         executePause,
+		"resume":        executeResume,
+		"sync":          executeSync,
+		"selftest":      executeSelfTest,
+		"reload":        executeReload,
+
+		"profile":        executeProfileList,
+		"profile/list":   executeProfileList,
+		"profile/save":   executeProfileSave,
+		"profile/apply":  executeProfileApply,
+		"profile/delete": executeProfileDelete,
+
+		"sample/add":    executeSampleAdd,
+		"sample/list":   executeSampleList,
+		"sample/update": executeSampleUpdate,
+		"sample/delete": executeSampleDelete,
+		"verify":        executeVerify,
+		"simulate":      executeSimulate,
+		"export":        executeExport,
+
+		"apikey/create": executeAPIKeyCreate,
+		"apikey/list":   executeAPIKeyList,
+		"apikey/revoke": executeAPIKeyRevoke,
+
+		"accept-suggestion": executeAcceptSuggestion,
 	},
 	defaultHandler: executeHelp,
 }
 
+// userCommandHandler handles the commands available to all users, or
+// authorized by the handlers themselves.
+var userCommandHandler = CommandHandler{
+	handlers: map[string]CommandHandlerFunc{
+		"optout":          executeOptOut,
+		"preview":         executePreview,
+		"revert":          executeRevert,
+		"channel":         executeChannelStatus,
+		"channel/disable": executeChannelDisable,
+		"channel/enable":  executeChannelEnable,
+	},
+}
+
+// readOnlyCommands are the commands that do not change the links, available
+// to the plugin viewers and the users with one of the reader roles in addition
+// to the admins.
+var readOnlyCommands = map[string]bool{
+	"help":     true,
+	"list":     true,
+	"search":   true,
+	"test":     true,
+	"test-all": true,
+	"verify":   true,
+	"simulate": true,
+	"export":   true,
+}
+
 func (ch CommandHandler) Handle(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if h, rest := ch.find(args...); h != nil {
+		return h(p, c, header, rest...)
+	}
+	return ch.defaultHandler(p, c, header, args...)
+}
+
+// find returns the handler of the longest matching subcommand, and the
+// remaining arguments.
+func (ch CommandHandler) find(args ...string) (CommandHandlerFunc, []string) {
 	for n := len(args); n > 0; n-- {
 		h := ch.handlers[strings.Join(args[:n], "/")]
 		if h != nil {
-			return h(p, c, header, args[n:]...)
+			return h, args[n:]
 		}
 	}
-	return ch.defaultHandler(p, c, header, args...)
+	return nil, nil
 }
 
 func (p *Plugin) ExecuteCommand(c *plugin.Context, commandArgs *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	commandArgs.T = p.translateFunc(p.userLocale(commandArgs.UserId))
+
+	command := "/" + p.getConfig().commandTrigger()
+	args := strings.Fields(commandArgs.Command)
+	if len(args) > 1 && args[0] == command {
+		if h, rest := userCommandHandler.find(args[1:]...); h != nil {
+			return h(p, c, commandArgs, rest...), nil
+		}
+	}
+
 	isAdmin, err := p.IsAuthorizedAdmin(commandArgs.UserId)
 	if err != nil {
-		return responsef("error occurred while authorizing the command: %v", err), nil
+		return responsef(commandArgs.T("autolink.command.authorize_failed"), err), nil
 	}
-	if !isAdmin {
-		return responsef("`/autolink` commands can only be executed by a system administrator or `autolink` plugin admins."), nil
+	if !isAdmin && !p.isCommandTeamAdmin(commandArgs) {
+		if isReadOnlyCommand(commandArgs.Command) && args[0] == command && p.isCommandReader(commandArgs.UserId) {
+			return autolinkCommandHandler.Handle(p, c, commandArgs, args[1:]...), nil
+		}
+		return responsef(commandArgs.T("autolink.command.not_authorized")), nil
 	}
 
-	args := strings.Fields(commandArgs.Command)
-	if len(args) == 0 || args[0] != autolinkCommand {
-		return responsef(helpText), nil
+	if len(args) == 0 || args[0] != command {
+		return responsef(commandArgs.T("autolink.command.help")), nil
 	}
 
 	return autolinkCommandHandler.Handle(p, c, commandArgs, args[1:]...), nil
 }
 
+// commandRest returns the command line after the trigger, e.g. " set x" for
+// "/autolink set x".
+func commandRest(command string) string {
+	command = strings.TrimLeftFunc(command, unicode.IsSpace)
+	if i := strings.IndexFunc(command, unicode.IsSpace); i >= 0 {
+		return command[i:]
+	}
+	return ""
+}
+
+// isCommandTeamAdmin reports whether the user running the command may manage
+// the links scoped to the current team.
+func (p *Plugin) isCommandTeamAdmin(header *model.CommandArgs) bool {
+	return p.getConfig().EnableTeamAdminDelegation &&
+		header.TeamId != "" &&
+		p.API.HasPermissionToTeam(header.UserId, header.TeamId, model.PermissionManageTeam)
+}
+
+// isCommandReader reports whether the user is a plugin viewer, or has one of
+// the roles allowed to run the read-only commands.
+func (p *Plugin) isCommandReader(userID string) bool {
+	if viewer, _ := p.IsAuthorizedViewer(userID); viewer {
+		return true
+	}
+	readerRoles := strings.FieldsFunc(p.getConfig().CommandReaderRoles, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	if len(readerRoles) == 0 {
+		return false
+	}
+	user, appErr := p.API.GetUser(userID)
+	if appErr != nil {
+		p.API.LogWarn("Failed to get the user running the command", "user_id", userID, "error", appErr.Error())
+		return false
+	}
+	for _, role := range strings.Fields(user.Roles) {
+		for _, readerRole := range readerRoles {
+			if role == readerRole {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isReadOnlyCommand reports whether the command does not change the links.
+func isReadOnlyCommand(command string) bool {
+	args := strings.Fields(command)
+	return len(args) > 1 && readOnlyCommands[args[1]]
+}
+
+// linkFilter returns a filter matching the links the user running the command
+// may manage, or nil if the user is a plugin admin and may manage all links.
+// Readers see all the links with the read-only commands.
+func linkFilter(p *Plugin, header *model.CommandArgs) (func(autolink.Autolink) bool, error) {
+	isAdmin, err := p.IsAuthorizedAdmin(header.UserId)
+	if err != nil {
+		return nil, err
+	}
+	if isAdmin || (isReadOnlyCommand(header.Command) && p.isCommandReader(header.UserId)) {
+		return nil, nil
+	}
+
+	teamAdmin := map[string]bool{}
+	return func(l autolink.Autolink) bool {
+		teams := l.ScopeTeams()
+		if len(teams) == 0 {
+			return false
+		}
+		for _, team := range teams {
+			ok, checked := teamAdmin[team]
+			if !checked {
+				var tErr error
+				ok, tErr = p.IsAuthorizedTeamAdmin(header.UserId, []string{team})
+				if tErr != nil {
+					p.API.LogWarn("Failed to check team admin permissions", "team", team, "error", tErr.Error())
+				}
+				teamAdmin[team] = ok
+			}
+			if !ok {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
 func executeList(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	args, opts, err := parseListOptions(header, args)
+	if err != nil {
+		return responsef("%v", err)
+	}
+
 	var links []autolink.Autolink
 	var refs []int
-	var err error
 
 	if len(args) > 0 && (args[0] == optTemplate || args[0] == optPattern) {
 		links, refs, err = searchLinkRefByTemplateOrPattern(p, header, args...)
 	} else {
-		links, refs, err = searchLinkRef(p, false, args...)
+		links, refs, err = searchLinkRef(p, header, false, args...)
 	}
 	if err != nil {
 		return responsef("%v", err)
 	}
 
+	return listLinks(p, header, links, refs, opts)
+}
+
+// listOptions are the options of the commands listing links.
+type listOptions struct {
+	page   int
+	format string
+	post   bool
+	// stats annotates the links with their activity
+	stats bool
+
+	// scope, group and tag filter the links, and enabled on whether they
+	// are enabled if not nil
+	scope   string
+	group   string
+	tag     string
+	enabled *bool
+}
+
+// matches reports whether the link passes the filters. A team scope filter
+// matches the links scoped to the team or to any of its channels.
+func (opts listOptions) matches(l autolink.Autolink) bool {
+	if opts.enabled != nil && *opts.enabled == l.Disabled {
+		return false
+	}
+	if opts.group != "" && !strings.EqualFold(opts.group, l.Group) {
+		return false
+	}
+	if opts.tag != "" && !l.HasTag(opts.tag) {
+		return false
+	}
+	return opts.scope == "" || l.InScope(opts.scope)
+}
+
+// Formats of the listed links
+const (
+	listFormatDefault  = "default"
+	listFormatMarkdown = "markdown"
+	listFormatJSON     = "json"
+)
+
+// listLinks renders a page of the links with the given indexes, or of all
+// links if refs is nil.
+func listLinks(p *Plugin, header *model.CommandArgs, links []autolink.Autolink, refs []int, opts listOptions) *model.CommandResponse {
+	if refs == nil {
+		refs = make([]int, len(links))
+		for i := range links {
+			refs[i] = i
+		}
+	}
+	filtered := []int{}
+	for _, i := range refs {
+		if opts.matches(links[i]) {
+			filtered = append(filtered, i)
+		}
+	}
+	refs = filtered
+	if len(refs) == 0 {
+		return responsef(header.T("autolink.command.list.empty"))
+	}
+	if isAdmin, _ := p.IsAuthorizedAdmin(header.UserId); !isAdmin {
+		links = autolink.WithoutWebhooks(links)
+	}
+
+	pages := (len(refs) + listPageSize - 1) / listPageSize
+	if opts.page > pages {
+		return responsef(header.T("autolink.command.list.invalid_page"), strconv.Itoa(opts.page))
+	}
+	end := opts.page * listPageSize
+	if end > len(refs) {
+		end = len(refs)
+	}
+	pageRefs := refs[(opts.page-1)*listPageSize : end]
+
 	text := ""
-	if len(refs) > 0 {
-		for _, i := range refs {
+	switch opts.format {
+	case listFormatMarkdown:
+		text = autolink.MarkdownTableHeader
+		for _, i := range pageRefs {
+			text += links[i].ToMarkdownTableRow(i + 1)
+		}
+	case listFormatJSON:
+		pageLinks := make([]autolink.Autolink, 0, len(pageRefs))
+		for _, i := range pageRefs {
+			pageLinks = append(pageLinks, links[i])
+		}
+		b, err := json.MarshalIndent(pageLinks, "", "  ")
+		if err != nil {
+			return responsef("%v", err)
+		}
+		text = "```json\n" + string(b) + "\n```\n"
+	default:
+		var activity []api.LinkActivity
+		if opts.stats {
+			pageLinks := make([]autolink.Autolink, 0, len(pageRefs))
+			for _, i := range pageRefs {
+				pageLinks = append(pageLinks, links[i])
+			}
+			var err error
+			if activity, err = p.LinkActivity(pageLinks); err != nil {
+				return responsef("%v", err)
+			}
+		}
+		for k, i := range pageRefs {
 			text += links[i].ToMarkdown(i + 1)
+			if activity != nil {
+				text += formatLinkActivity(header, activity[k])
+			}
 		}
-	} else {
-		for i, l := range links {
-			text += l.ToMarkdown(i + 1)
+	}
+	if pages > 1 {
+		text += fmt.Sprintf(header.T("autolink.command.list.page"), opts.page, pages, len(refs))
+	}
+
+	resp := responsef("%s", text)
+	if opts.post {
+		resp.ResponseType = model.CommandResponseTypeInChannel
+	}
+	return resp
+}
+
+// formatLinkActivity renders when a link last changed a post and how many
+// posts it recently changed, as an item of the link in the list.
+func formatLinkActivity(header *model.CommandArgs, activity api.LinkActivity) string {
+	if activity.Posts30Days == 0 && activity.LastFiredAt == nil {
+		return header.T("autolink.command.list.activity.unused")
+	}
+	last := ""
+	if activity.LastFiredAt != nil {
+		last = fmt.Sprintf(header.T("autolink.command.list.activity.last"), activity.LastFiredAt.UTC().Format(time.RFC3339))
+	}
+	return fmt.Sprintf(header.T("autolink.command.list.activity"), activity.Posts7Days, activity.Posts30Days, last)
+}
+
+// parseListOptions removes the `--page <n>`, `--format <format>`, `--post`
+// and `--stats` options, and the `--scope <scope>`, `--group <group>`, `--tag <tag>`,
+// `--enabled` and `--disabled` filters from args, and returns them.
+func parseListOptions(header *model.CommandArgs, args []string) ([]string, listOptions, error) {
+	opts := listOptions{page: 1, format: listFormatDefault}
+	rest := []string{}
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == optPost:
+			opts.post = true
+		case args[i] == optStats:
+			opts.stats = true
+		case args[i] == optEnabledFilter || args[i] == optDisabledFilter:
+			enabled := args[i] == optEnabledFilter
+			opts.enabled = &enabled
+		case args[i] == optScopeFilter && i+1 < len(args):
+			i++
+			opts.scope = args[i]
+		case args[i] == optGroupFilter && i+1 < len(args):
+			i++
+			opts.group = args[i]
+		case args[i] == optTagFilter && i+1 < len(args):
+			i++
+			opts.tag = args[i]
+		case args[i] == optPage && i+1 < len(args):
+			i++
+			page, err := strconv.Atoi(args[i])
+			if err != nil || page < 1 {
+				return nil, opts, errors.Errorf(header.T("autolink.command.list.invalid_page"), args[i])
+			}
+			opts.page = page
+		case args[i] == optFormat && i+1 < len(args):
+			i++
+			switch args[i] {
+			case listFormatDefault, listFormatMarkdown, listFormatJSON:
+				opts.format = args[i]
+			default:
+				return nil, opts, errors.Errorf(header.T("autolink.command.list.invalid_format"), args[i])
+			}
+		default:
+			rest = append(rest, args[i])
+		}
+	}
+	return rest, opts, nil
+}
+
+func executeSearch(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	args, opts, err := parseListOptions(header, args)
+	if err != nil {
+		return responsef("%v", err)
+	}
+	isRegexp := len(args) > 0 && args[0] == optRegex
+	if isRegexp {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return responsef(header.T("autolink.command.help"))
+	}
+	query := strings.Join(args, " ")
+
+	match, err := autolink.SearchFilter(query, isRegexp)
+	if err != nil {
+		return responsef("%v", err)
+	}
+	links, refs, err := searchLinkRef(p, header, false)
+	if err != nil {
+		return responsef("%v", err)
+	}
+	if refs == nil {
+		refs = make([]int, len(links))
+		for i := range links {
+			refs[i] = i
+		}
+	}
+
+	found := []int{}
+	for _, i := range refs {
+		if match(links[i]) {
+			found = append(found, i)
 		}
 	}
-	return responsef(text)
+	return listLinks(p, header, links, found, opts)
 }
 
 func executeDelete(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
-	if len(args) != 1 {
-		return responsef(helpText)
+	confirmed := len(args) == 2 && args[1] == optConfirm
+	if len(args) != 1 && !confirmed {
+		return responsef(header.T("autolink.command.help"))
 	}
-	oldLinks, refs, err := searchLinkRef(p, true, args...)
+	oldLinks, refs, err := searchLinkRef(p, header, true, args[0])
 	if err != nil {
 		return responsef("%v", err)
 	}
 	n := refs[0]
+	if !confirmed {
+		return confirmDeleteResponse(header, oldLinks[n], n)
+	}
 
 	removed := oldLinks[n]
 	newLinks := oldLinks[:n]
@@ -142,76 +643,55 @@ func executeDelete(p *Plugin, c *plugin.Context, header *model.CommandArgs, args
 		newLinks = append(newLinks, oldLinks[n+1:]...)
 	}
 
-	err = saveConfigLinks(p, newLinks)
+	err = p.SaveLinks(newLinks)
 	if err != nil {
 		return responsef(err.Error())
 	}
 
-	return responsef("removed: \n%v", removed.ToMarkdown(0))
+	return responsef(header.T("autolink.command.delete.removed"), removed.ToMarkdown(0))
 }
 
 func executeSet(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) > 0 && args[0] == optFilter {
+		return executeBulkSet(p, header, args[1:]...)
+	}
 	if len(args) < 3 {
-		return responsef(helpText)
+		return responsef(header.T("autolink.command.help"))
 	}
 
-	links, refs, err := searchLinkRef(p, true, args...)
+	links, refs, err := searchLinkRef(p, header, true, args...)
 	if err != nil {
 		return responsef("%v", err)
 	}
-	l := &links[refs[0]]
+	filter, err := linkFilter(p, header)
+	if err != nil {
+		return responsef("%v", err)
+	}
+	// The link is changed on a copy, saved once the change is authorized
+	updated := links[refs[0]]
+	l := &updated
 
 	fieldName := args[1]
-	restOfCommand := header.Command[len(autolinkCommand):] // "/autolink "
+	restOfCommand := commandRest(header.Command)
 	restOfCommand = restOfCommand[strings.Index(restOfCommand, args[0])+len(args[0]):]
 	restOfCommand = restOfCommand[strings.Index(restOfCommand, args[1])+len(args[1]):]
 	value := strings.TrimSpace(restOfCommand)
 
-	switch fieldName {
-	case optName:
-		l.Name = value
-	case optPattern:
-		l.Pattern = value
-	case optTemplate:
-		l.Template = value
-	case optScope:
-		l.Scope = args[2:]
-	case optDisableNonWordPrefix:
-		boolValue, e := parseBoolArg(value)
-		if e != nil {
-			return responsef("%v", e)
-		}
-		l.DisableNonWordPrefix = boolValue
-	case optDisableNonWordSuffix:
-		boolValue, e := parseBoolArg(value)
-		if e != nil {
-			return responsef("%v", e)
-		}
-		l.DisableNonWordSuffix = boolValue
-	case optWordMatch:
-		boolValue, e := parseBoolArg(value)
-		if e != nil {
-			return responsef("%v", e)
-		}
-		l.WordMatch = boolValue
-	case optDisabled:
-		boolValue, e := parseBoolArg(value)
-		if e != nil {
-			return responsef("%v", e)
-		}
-		l.Disabled = boolValue
-	case optProcessBotPosts:
-		boolValue, e := parseBoolArg(value)
-		if e != nil {
-			return responsef("%v", e)
+	if fieldName == optWebhookURL {
+		if resp := checkWebhookField(p, header, value); resp != nil {
+			return resp
 		}
-		l.ProcessBotPosts = boolValue
-	default:
-		return responsef("%q is not a supported field, must be one of %q", fieldName,
-			[]string{optName, optDisabled, optPattern, optTemplate, optScope, optDisableNonWordPrefix, optDisableNonWordSuffix, optWordMatch, optProcessBotPosts})
+	}
+	if resp := setField(header, l, fieldName, value, args[2:]); resp != nil {
+		return resp
+	}
+	if filter != nil && !filter(*l) {
+		return responsef(header.T("autolink.command.set.team_admin_scope"))
 	}
 
-	err = saveConfigLinks(p, links)
+	newLinks := append([]autolink.Autolink{}, links...)
+	newLinks[refs[0]] = updated
+	err = p.SaveLinks(newLinks)
 	if err != nil {
 		return responsef(err.Error())
 	}
@@ -223,170 +703,1317 @@ func executeSet(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ..
 	return executeList(p, c, header, ref)
 }
 
-func executeTest(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
-	if len(args) < 2 {
-		return responsef(helpText)
-	}
-
-	links, refs, err := searchLinkRef(p, false, args...)
-	if err != nil {
-		return responsef("%v", err)
-	}
+// bulkSetMode is whether a bulk update is a dry run, saved once the user
+// confirms it, or saved right away.
+type bulkSetMode int
 
-	restOfCommand := header.Command[len(autolinkCommand):] // "/autolink "
-	restOfCommand = restOfCommand[strings.Index(restOfCommand, args[0])+len(args[0]):]
-	orig := strings.TrimSpace(restOfCommand)
-	out := fmt.Sprintf("- Original: `%s`\n", orig)
+const (
+	bulkSetConfirm bulkSetMode = iota
+	bulkSetDryRun
+	bulkSetConfirmed
+)
 
-	for _, ref := range refs {
-		l := links[ref]
-		l.Disabled = false
-		err = l.Compile()
-		if err != nil {
-			return responsef("failed to compile link %s: %v", l.DisplayName(), err)
-		}
-		replaced := l.Replace(orig)
-		if replaced == orig {
-			out += fmt.Sprintf("- Link %s: _no change_\n", l.DisplayName())
-		} else {
-			out += fmt.Sprintf("- Link %s: changed to `%s`\n", l.DisplayName(), replaced)
-			orig = replaced
+// executeBulkSet sets a field of all the links matching a filter, given as
+// `<field>=<wildcard pattern>`. The field and value are given either as for
+// `/autolink set`, or as `<Field>=<value>`. When both the filter and the value
+// of a Scope contain a `*`, the matching scopes are renamed, keeping the part
+// matched by the `*`. Unless run with `--confirm`, the user is asked to
+// confirm the update.
+func executeBulkSet(p *Plugin, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	mode := bulkSetConfirm
+	for len(args) > 0 && (args[len(args)-1] == optDryRun || args[len(args)-1] == optConfirm) {
+		if args[len(args)-1] == optDryRun {
+			mode = bulkSetDryRun
+		} else if mode != bulkSetDryRun {
+			mode = bulkSetConfirmed
 		}
+		args = args[:len(args)-1]
 	}
-
-	return responsef(out)
+	return bulkSet(p, header, args, mode, nil)
 }
 
-func executeEnable(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
-	if len(args) != 1 {
-		return responsef(helpText)
+// bulkSet runs a bulk update. A confirmed update is given the names of the
+// links the user confirmed updating, for the update to be cancelled if it now
+// matches other links.
+func bulkSet(p *Plugin, header *model.CommandArgs, args []string, mode bulkSetMode, confirmedNames []string) *model.CommandResponse {
+	if len(args) < 2 {
+		return responsef(header.T("autolink.command.help"))
 	}
-	return executeEnableImpl(p, c, header, args[0], true)
-}
 
-func executeDisable(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
-	if len(args) != 1 {
-		return responsef(helpText)
+	filterField, filterPattern, ok := splitAssignment(args[0])
+	filterField = strings.ToLower(filterField)
+	if !ok || bulkFilterFields[filterField] == nil {
+		return responsef(header.T("autolink.command.set.invalid_filter"), args[0])
 	}
-	return executeEnableImpl(p, c, header, args[0], false)
-}
+	filterRegexp := wildcardRegexp(filterPattern)
 
-func executeEnableImpl(p *Plugin, c *plugin.Context, header *model.CommandArgs, ref string, enabled bool) *model.CommandResponse {
-	links, refs, err := searchLinkRef(p, true, ref)
-	if err != nil {
-		return responsef("%v", err)
+	fieldName, values := args[1], args[2:]
+	if name, value, ok := splitAssignment(fieldName); ok && len(values) == 0 {
+		fieldName, values = name, strings.Fields(value)
 	}
-	l := &links[refs[0]]
-	l.Disabled = !enabled
+	if len(values) == 0 {
+		return responsef(header.T("autolink.command.help"))
+	}
+	value := strings.Join(values, " ")
 
-	err = saveConfigLinks(p, links)
+	teamAdminFilter, err := linkFilter(p, header)
 	if err != nil {
-		return responsef(err.Error())
+		return responsef("%v", err)
+	}
+	if fieldName == optWebhookURL {
+		if resp := checkWebhookField(p, header, value); resp != nil {
+			return resp
+		}
 	}
 
-	if l.Name != "" {
-		ref = l.Name
+	matches := func(l autolink.Autolink) bool {
+		for _, v := range bulkFilterFields[filterField](l) {
+			if filterRegexp.MatchString(v) {
+				return true
+			}
+		}
+		return false
 	}
-	return executeList(p, c, header, ref)
-}
+	rename := fieldName == optScope && filterField == "scope" &&
+		strings.Count(filterPattern, "*") == 1 && strings.Count(value, "*") == 1
 
-func executeAdd(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
-	if len(args) > 1 {
-		return responsef(helpText)
+	links := append([]autolink.Autolink{}, p.GetLinks()...)
+	text := ""
+	count := 0
+	names := []string{}
+	for i := range links {
+		l := &links[i]
+		if !matches(*l) || (teamAdminFilter != nil && !teamAdminFilter(*l)) {
+			continue
+		}
+
+		if rename {
+			l.Scope = renameScopes(l.Scope, filterRegexp, value)
+		} else if resp := setField(header, l, fieldName, value, values); resp != nil {
+			return resp
+		}
+		if teamAdminFilter != nil && !teamAdminFilter(*l) {
+			return responsef(header.T("autolink.command.set.team_admin_scope"))
+		}
+		text += l.ToMarkdown(0)
+		count++
+		names = append(names, l.Name)
 	}
-	name := ""
-	if len(args) == 1 {
-		name = args[0]
+	if count == 0 {
+		return responsef(header.T("autolink.command.list.empty"))
 	}
 
-	err := saveConfigLinks(p, append(p.getConfig().Links, autolink.Autolink{
-		Name: name,
-	}))
-	if err != nil {
-		return responsef(err.Error())
+	switch mode {
+	case bulkSetDryRun:
+		return responsef(header.T("autolink.command.set.bulk_dry_run"), count, text)
+	case bulkSetConfirm:
+		return confirmResponse(header, header.T("autolink.command.set.bulk_confirm", count, text),
+			header.T("autolink.command.confirm.apply"), confirmActionBulkSet,
+			map[string]interface{}{"args": args, "links": names})
 	}
-
-	if name == "" {
-		return executeList(p, c, header)
+	if confirmedNames != nil && strings.Join(confirmedNames, "\n") != strings.Join(names, "\n") {
+		return responsef(header.T("autolink.command.confirm.changed"))
 	}
-	return executeList(p, c, header, name)
+	if err = p.SaveLinks(links); err != nil {
+		return responsef(err.Error())
+	}
+	return responsef(header.T("autolink.command.set.bulk_updated"), count, text)
 }
 
-func executeHelp(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
-	return responsef(helpText)
+// bulkFilterFields are the fields bulk updates can filter links on.
+var bulkFilterFields = map[string]func(autolink.Autolink) []string{
+	"name":     func(l autolink.Autolink) []string { return []string{l.Name} },
+	"pattern":  func(l autolink.Autolink) []string { return l.AllPatterns() },
+	"template": func(l autolink.Autolink) []string { return []string{l.Template} },
+	"scope":    func(l autolink.Autolink) []string { return l.Scope },
+	"group":    func(l autolink.Autolink) []string { return []string{l.Group} },
+	"tag":      func(l autolink.Autolink) []string { return l.Tags },
 }
 
-func responsef(format string, args ...interface{}) *model.CommandResponse {
-	return &model.CommandResponse{
-		ResponseType: model.CommandResponseTypeEphemeral,
-		Text:         fmt.Sprintf(format, args...),
-		Type:         model.PostTypeDefault,
+func splitAssignment(arg string) (string, string, bool) {
+	i := strings.Index(arg, "=")
+	if i <= 0 {
+		return "", "", false
 	}
+	return arg[:i], arg[i+1:], true
 }
 
-func searchLinkRef(p *Plugin, requireUnique bool, args ...string) ([]autolink.Autolink, []int, error) {
-	links := p.getConfig().Sorted().Links
-	if len(args) == 0 {
-		if requireUnique {
-			return nil, nil, errors.New("unreachable")
-		}
-
-		return links, nil, nil
+// wildcardRegexp returns a case-insensitive regexp matching the whole text
+// against a pattern where `*` matches any text, capturing it.
+func wildcardRegexp(pattern string) *regexp.Regexp {
+	parts := strings.Split(pattern, "*")
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
 	}
+	return regexp.MustCompile("(?is)^" + strings.Join(parts, "(.*)") + "$")
+}
 
-	n, err := strconv.ParseUint(args[0], 10, 32)
-	if err == nil {
-		if n < 1 || int(n) > len(links) {
-			return nil, nil, errors.Errorf("%v is not a valid link number", n)
+// renameScopes replaces the scopes matching the wildcard pattern, substituting
+// the text matched by its `*` for the `*` of the replacement.
+func renameScopes(scopes []string, pattern *regexp.Regexp, replacement string) []string {
+	renamed := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		m := pattern.FindStringSubmatch(scope)
+		if m == nil {
+			renamed = append(renamed, scope)
+			continue
 		}
-		return links, []int{int(n) - 1}, nil
+		renamed = append(renamed, strings.Replace(replacement, "*", m[1], 1))
 	}
+	return renamed
+}
 
-	found := []int{}
-	for i, l := range links {
-		if strings.Contains(l.Name, args[0]) {
-			found = append(found, i)
-		}
-	}
-	if len(found) == 0 {
-		return nil, nil, errors.Errorf("%q not found", args[0])
-	}
-	if requireUnique && len(found) > 1 {
-		names := []string{}
-		for _, i := range found {
-			names = append(names, links[i].Name)
-		}
-		return nil, nil, errors.Errorf("%q matched more than one link: %q", args[0], names)
+// setField sets a field of the link to the value, given as is and split into
+// words. It returns the response to send if the value is invalid.
+// setScheduleField sets one of the time window and schedule fields of a link.
+func setScheduleField(l *autolink.Autolink, fieldName, value string) {
+	switch fieldName {
+	case optActiveFrom:
+		l.ActiveFrom = value
+	case optActiveUntil:
+		l.ActiveUntil = value
+	case optSchedule:
+		l.Schedule = value
+	case optExpiresAt:
+		l.ExpiresAt = value
 	}
-
-	return links, found, nil
 }
 
-func searchLinkRefByTemplateOrPattern(p *Plugin, header *model.CommandArgs, args ...string) ([]autolink.Autolink, []int, error) {
-	links := p.getConfig().Sorted().Links
-	if len(args) == 1 {
-		return links, nil, nil
+func setField(header *model.CommandArgs, l *autolink.Autolink, fieldName, value string, values []string) *model.CommandResponse {
+	switch fieldName {
+	case optName:
+		l.Name = value
+	case optPattern:
+		l.Pattern = value
+	case optPatterns:
+		l.Patterns = values
+	case optTemplate:
+		l.Template = value
+	case optScope:
+		l.Scope = values
+	case optMaxReplacements:
+		maxReplacements, e := strconv.Atoi(value)
+		if e != nil || maxReplacements < 0 {
+			return responsef(header.T("autolink.command.set.not_count"), value)
+		}
+		l.MaxReplacements = maxReplacements
+	case optFirstMatchOnly:
+		boolValue, e := parseBoolArg(value)
+		if e != nil {
+			return responsef(header.T("autolink.command.set.not_bool"), value)
+		}
+		l.FirstMatchOnly = boolValue
+	case optProcessLinkLabels:
+		boolValue, e := parseBoolArg(value)
+		if e != nil {
+			return responsef(header.T("autolink.command.set.not_bool"), value)
+		}
+		l.ProcessLinkLabels = boolValue
+	case optCodeBlocks, optCodeSpans, optCodeOnly:
+		boolValue, e := parseBoolArg(value)
+		if e != nil {
+			return responsef(header.T("autolink.command.set.not_bool"), value)
+		}
+		switch fieldName {
+		case optCodeBlocks:
+			l.CodeBlocks = boolValue
+		case optCodeSpans:
+			l.CodeSpans = boolValue
+		default:
+			l.CodeOnly = boolValue
+		}
+	case optBotAllowlist:
+		l.BotAllowlist = values
+	case optBotDenylist:
+		l.BotDenylist = values
+	case optDisableNonWordPrefix:
+		boolValue, e := parseBoolArg(value)
+		if e != nil {
+			return responsef(header.T("autolink.command.set.not_bool"), value)
+		}
+		l.DisableNonWordPrefix = boolValue
+	case optDisableNonWordSuffix:
+		boolValue, e := parseBoolArg(value)
+		if e != nil {
+			return responsef(header.T("autolink.command.set.not_bool"), value)
+		}
+		l.DisableNonWordSuffix = boolValue
+	case optWordMatch:
+		boolValue, e := parseBoolArg(value)
+		if e != nil {
+			return responsef(header.T("autolink.command.set.not_bool"), value)
+		}
+		l.WordMatch = boolValue
+	case optCaseInsensitive:
+		boolValue, e := parseBoolArg(value)
+		if e != nil {
+			return responsef(header.T("autolink.command.set.not_bool"), value)
+		}
+		l.CaseInsensitive = boolValue
+	case optMultiLine:
+		boolValue, e := parseBoolArg(value)
+		if e != nil {
+			return responsef(header.T("autolink.command.set.not_bool"), value)
+		}
+		l.MultiLine = boolValue
+	case optDotAll:
+		boolValue, e := parseBoolArg(value)
+		if e != nil {
+			return responsef(header.T("autolink.command.set.not_bool"), value)
+		}
+		l.DotAll = boolValue
+	case optAcrossLines:
+		boolValue, e := parseBoolArg(value)
+		if e != nil {
+			return responsef(header.T("autolink.command.set.not_bool"), value)
+		}
+		l.AcrossLines = boolValue
+	case optTerminal:
+		boolValue, e := parseBoolArg(value)
+		if e != nil {
+			return responsef(header.T("autolink.command.set.not_bool"), value)
+		}
+		l.Terminal = boolValue
+	case optTerminalPost:
+		boolValue, e := parseBoolArg(value)
+		if e != nil {
+			return responsef(header.T("autolink.command.set.not_bool"), value)
+		}
+		l.TerminalPost = boolValue
+	case optDebug:
+		boolValue, e := parseBoolArg(value)
+		if e != nil {
+			return responsef(header.T("autolink.command.set.not_bool"), value)
+		}
+		l.Debug = boolValue
+	case optShadowMode:
+		boolValue, e := parseBoolArg(value)
+		if e != nil {
+			return responsef(header.T("autolink.command.set.not_bool"), value)
+		}
+		l.ShadowMode = boolValue
+	case optThreads:
+		if value == "none" {
+			value = ""
+		}
+		switch value {
+		case "", autolink.ThreadsRoot, autolink.ThreadsReplies, autolink.ThreadsMatchingRoot:
+		default:
+			return responsef(header.T("autolink.command.set.unsupported_threads"), value,
+				[]string{autolink.ThreadsRoot, autolink.ThreadsReplies, autolink.ThreadsMatchingRoot, "none"})
+		}
+		l.Threads = value
+	case optEngine:
+		switch value {
+		case "", autolink.EngineRE2, autolink.EngineBacktracking:
+		default:
+			return responsef(header.T("autolink.command.set.unsupported_engine"), value,
+				[]string{autolink.EngineRE2, autolink.EngineBacktracking})
+		}
+		l.Engine = value
+	case optStyle:
+		if value == "none" {
+			value = ""
+		}
+		switch value {
+		case "", autolink.StyleBold, autolink.StyleCode, autolink.StylePlain:
+		default:
+			return responsef(header.T("autolink.command.set.unsupported_style"), value,
+				[]string{autolink.StyleBold, autolink.StyleCode, autolink.StylePlain, "none"})
+		}
+		l.Style = value
+	case optTextPrefix:
+		l.TextPrefix = value
+	case optTextSuffix:
+		l.TextSuffix = value
+	case optKind:
+		if value == "none" {
+			value = ""
+		}
+		if value != "" && value != autolink.KindCommit && value != autolink.KindShorten && value != autolink.KindRedact && value != autolink.KindReject && value != autolink.KindKeyword && value != autolink.KindPermalink {
+			return responsef(header.T("autolink.command.set.unsupported_kind"), value,
+				[]string{autolink.KindCommit, autolink.KindShorten, autolink.KindRedact, autolink.KindReject, autolink.KindKeyword, autolink.KindPermalink, "none"})
+		}
+		l.Kind = value
+	case optRepositories:
+		repositories, e := autolink.ParseRepositories(value)
+		if e == nil && repositories != nil {
+			test := autolink.Autolink{Kind: autolink.KindCommit, Repositories: repositories}
+			e = test.Compile()
+		}
+		if e != nil {
+			return responsef(header.T("autolink.command.set.invalid_repositories"), e)
+		}
+		l.Repositories = repositories
+	case optGroup:
+		l.Group = value
+	case optTags:
+		l.Tags = values
+	case optDescription:
+		l.Description = value
+	case optOwner:
+		l.Owner = value
+	case optWebhookURL:
+		if e := autolink.ValidateWebhookURL(value); e != nil {
+			return responsef(header.T("autolink.command.set.invalid_webhook"), e)
+		}
+		l.WebhookURL = value
+	case optMentions:
+		mentions, e := autolink.ParseMentions(value)
+		if e == nil {
+			test := autolink.Autolink{Mentions: mentions}
+			e = test.Compile()
+		}
+		if e != nil {
+			return responsef(header.T("autolink.command.set.invalid_mentions"), e)
+		}
+		l.Mentions = mentions
+	case optUnicodeWordMatch:
+		boolValue, e := parseBoolArg(value)
+		if e != nil {
+			return responsef(header.T("autolink.command.set.not_bool"), value)
+		}
+		l.UnicodeWordMatch = boolValue
+	case optBoundaryClass:
+		l.BoundaryClass = value
+	case optPrefixChars:
+		l.PrefixChars = value
+	case optSuffixChars:
+		l.SuffixChars = value
+	case optDisabled:
+		boolValue, e := parseBoolArg(value)
+		if e != nil {
+			return responsef(header.T("autolink.command.set.not_bool"), value)
+		}
+		l.Disabled = boolValue
+	case optProcessBotPosts:
+		boolValue, e := parseBoolArg(value)
+		if e != nil {
+			return responsef(header.T("autolink.command.set.not_bool"), value)
+		}
+		l.ProcessBotPosts = boolValue
+	case optProcessIntegrationPosts:
+		boolValue, e := parseBoolArg(value)
+		if e != nil {
+			return responsef(header.T("autolink.command.set.not_bool"), value)
+		}
+		l.ProcessIntegrationPosts = boolValue
+	case optProcessPluginPosts:
+		boolValue, e := parseBoolArg(value)
+		if e != nil {
+			return responsef(header.T("autolink.command.set.not_bool"), value)
+		}
+		l.ProcessPluginPosts = boolValue
+	case optProcessOnUpdate:
+		if value == "none" {
+			l.ProcessOnUpdate = nil
+			break
+		}
+		boolValue, e := parseBoolArg(value)
+		if e != nil {
+			return responsef(header.T("autolink.command.set.not_bool"), value)
+		}
+		l.ProcessOnUpdate = &boolValue
+	case optEnrich:
+		if value != "" && value != enrichJira && value != enrichCVE {
+			return responsef(header.T("autolink.command.set.unsupported_enrichment"), value, []string{enrichJira, enrichCVE})
+		}
+		l.Enrich = value
+	case optFallbackTemplate:
+		l.FallbackTemplate = value
+		if e := l.Compile(); e != nil {
+			return responsef(header.T("autolink.command.set.invalid_fallback"), e)
+		}
+	case optEnrichTTL:
+		l.EnrichTTL = value
+		if e := l.Compile(); e != nil {
+			return responsef(header.T("autolink.command.set.invalid_enrich_ttl"), e)
+		}
+	case optActiveFrom, optActiveUntil, optSchedule, optExpiresAt:
+		if value == "none" {
+			value = ""
+		}
+		// The value is checked on its own, for the error to be about the
+		// field set rather than the other fields of the link
+		var check autolink.Autolink
+		setScheduleField(&check, fieldName, value)
+		if e := check.CheckSchedule(); e != nil {
+			return responsef(header.T("autolink.command.set.invalid_schedule"), e)
+		}
+		setScheduleField(l, fieldName, value)
+	case optAttachment:
+		var attachment *autolink.AttachmentTemplate
+		if value != "" {
+			if e := json.Unmarshal([]byte(value), &attachment); e != nil {
+				return responsef(header.T("autolink.command.set.invalid_attachment"), e)
+			}
+		}
+		l.Attachment = attachment
+	case optCases:
+		var cases []autolink.TemplateCase
+		if value != "" {
+			if e := json.Unmarshal([]byte(value), &cases); e != nil {
+				return responsef(header.T("autolink.command.set.invalid_cases"), e)
+			}
+		}
+		l.Cases = cases
+	case optLocaleTemplates:
+		var templates map[string]string
+		if value != "" {
+			if e := json.Unmarshal([]byte(value), &templates); e != nil {
+				return responsef(header.T("autolink.command.set.invalid_locale_templates"), e)
+			}
+		}
+		l.LocaleTemplates = templates
+	case optScopeTemplates:
+		var templates map[string]string
+		if value != "" {
+			if e := json.Unmarshal([]byte(value), &templates); e != nil {
+				return responsef(header.T("autolink.command.set.invalid_scope_templates"), e)
+			}
+		}
+		l.ScopeTemplates = templates
+	default:
+		return responsef(header.T("autolink.command.set.unsupported_field"), fieldName,
+			[]string{optName, optDisabled, optPattern, optPatterns, optTemplate, optScope, optDisableNonWordPrefix, optDisableNonWordSuffix, optWordMatch, optUnicodeWordMatch, optBoundaryClass, optPrefixChars, optSuffixChars, optCaseInsensitive, optMultiLine, optDotAll, optAcrossLines, optMaxReplacements, optFirstMatchOnly, optProcessLinkLabels, optCodeBlocks, optCodeSpans, optCodeOnly, optProcessBotPosts, optProcessIntegrationPosts, optProcessPluginPosts, optProcessOnUpdate, optBotAllowlist, optBotDenylist, optActiveFrom, optActiveUntil, optSchedule, optExpiresAt, optEnrich, optEnrichTTL, optFallbackTemplate, optCases, optLocaleTemplates, optScopeTemplates, optTerminal, optTerminalPost, optDebug, optShadowMode, optAttachment, optThreads, optGroup, optTags, optDescription, optOwner, optWebhookURL, optMentions, optEngine, optStyle, optTextPrefix, optTextSuffix, optKind, optRepositories})
+	}
+	return nil
+}
+
+func executeTest(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) < 2 {
+		return responsef(header.T("autolink.command.help"))
 	}
 
-	restOfCommand := header.Command[len(autolinkCommand):]
+	links, refs, err := searchLinkRef(p, header, false, args...)
+	if err != nil {
+		return responsef("%v", err)
+	}
+
+	if args[1] == optLast {
+		if len(args) != 3 {
+			return responsef(header.T("autolink.command.help"))
+		}
+		return executeTestLastPosts(p, header, links, refs, args[2])
+	}
+
+	restOfCommand := commandRest(header.Command)
+	restOfCommand = restOfCommand[strings.Index(restOfCommand, args[0])+len(args[0]):]
+	orig := strings.TrimSpace(restOfCommand)
+	out := header.T("autolink.command.test.original", orig)
+
+	for _, ref := range refs {
+		l := links[ref]
+		l.Disabled = false
+		err = l.Compile()
+		if err != nil {
+			return responsef(header.T("autolink.command.test.compile_failed"), l.DisplayName(), err)
+		}
+		replaced := l.Replace(orig)
+		if replaced == orig {
+			out += header.T("autolink.command.test.no_change", l.DisplayName())
+		} else {
+			out += header.T("autolink.command.test.changed", l.DisplayName(), replaced)
+			orig = replaced
+		}
+	}
+
+	return responsef("%s", out)
+}
+
+// executeTestLastPosts runs the links against the last posts of the current
+// channel, and reports the posts they would change.
+func executeTestLastPosts(p *Plugin, header *model.CommandArgs, links []autolink.Autolink, refs []int, count string) *model.CommandResponse {
+	n, err := strconv.Atoi(count)
+	if err != nil || n < 1 || n > maxTestLastPosts {
+		return responsef(header.T("autolink.command.test.invalid_last"), count, maxTestLastPosts)
+	}
+
+	compiled := []autolink.Autolink{}
+	for _, ref := range refs {
+		l := links[ref]
+		l.Disabled = false
+		if err = l.Compile(); err != nil {
+			return responsef(header.T("autolink.command.test.compile_failed"), l.DisplayName(), err)
+		}
+		compiled = append(compiled, l)
+	}
+
+	postList, appErr := p.API.GetPostsForChannel(header.ChannelId, 0, n)
+	if appErr != nil {
+		return responsef(header.T("autolink.command.test.posts_failed"), appErr)
+	}
+
+	out := ""
+	changed := 0
+	for _, id := range postList.Order {
+		post := postList.Posts[id]
+		if post == nil || post.Message == "" {
+			continue
+		}
+
+		orig := strings.Replace(post.Message, "\n", " ", -1)
+		replaced := orig
+		matched := []string{}
+		for _, l := range compiled {
+			if r := l.Replace(replaced); r != replaced {
+				replaced = r
+				matched = append(matched, l.DisplayName())
+			}
+		}
+		if len(matched) == 0 {
+			continue
+		}
+		changed++
+		out += header.T("autolink.command.test.post_changed", orig, replaced, strings.Join(matched, ", "))
+	}
+
+	return responsef("%s", header.T("autolink.command.test.posts_summary", changed, len(postList.Order))+out)
+}
+
+// executeTestAll runs the text through all the links applying to the current
+// channel, in the order they are applied to posts, and reports the text each
+// of them generated.
+func executeTestAll(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) == 0 {
+		return responsef(header.T("autolink.command.help"))
+	}
+
+	restOfCommand := commandRest(header.Command)
+	restOfCommand = restOfCommand[strings.Index(restOfCommand, "test-all")+len("test-all"):]
+	text := strings.TrimSpace(restOfCommand)
+
+	channelName, teamName := "", ""
+	if header.ChannelId != "" {
+		var appErr *model.AppError
+		if channelName, teamName, appErr = p.resolveScope(header.ChannelId); appErr != nil {
+			return responsef(header.T("autolink.command.test_all.channel_failed"), appErr)
+		}
+	}
+	now := time.Now()
+	postContext := &autolink.PostContext{ChannelName: channelName, TeamName: teamName, CreateAt: now}
+
+	out := header.T("autolink.command.test.original", text)
+	applied, matched := 0, 0
+	for _, l := range p.mergeTeamLinks(p.GetLinks(), channelName, teamName) {
+		if l.Disabled || !l.IsActive(now) || !p.inScope(l.Scope, channelName, teamName) {
+			continue
+		}
+		applied++
+		if l.UsesPostContext() {
+			l.SetPostContext(postContext)
+		}
+		if rejection, ok := l.Rejection(text); ok {
+			matched++
+			out += header.T("autolink.command.test_all.rejected", matched, l.DisplayName(), rejection)
+			continue
+		}
+		replaced := l.Replace(text)
+		if replaced == text {
+			continue
+		}
+		matched++
+		out += header.T("autolink.command.test_all.changed", matched, l.DisplayName(), replaced)
+		text = replaced
+	}
+
+	if matched == 0 {
+		return responsef(header.T("autolink.command.test_all.no_match"), applied)
+	}
+	return responsef("%s%s", out, header.T("autolink.command.test_all.summary", matched, applied))
+}
+
+func executeLint(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) != 0 {
+		return responsef(header.T("autolink.command.help"))
+	}
+
+	links, refs, err := searchLinkRef(p, header, false)
+	if err != nil {
+		return responsef("%v", err)
+	}
+	if refs != nil {
+		filtered := []autolink.Autolink{}
+		for _, ref := range refs {
+			filtered = append(filtered, links[ref])
+		}
+		links = filtered
+	}
+
+	issues := p.LintLinks(links)
+	if len(issues) == 0 {
+		return responsef(header.T("autolink.command.lint.no_issues"))
+	}
+
+	out := header.T("autolink.command.lint.issues", len(issues))
+	for _, issue := range issues {
+		out += fmt.Sprintf("- **%s** (%s): %s\n", issue.Link, issue.Kind, issue.Message)
+	}
+	return responsef("%s", out)
+}
+
+func executeEnable(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) != 1 {
+		return responsef(header.T("autolink.command.help"))
+	}
+	if args[0] == optAll {
+		return executeEnableAll(p, header, true)
+	}
+	return executeEnableImpl(p, c, header, args[0], true)
+}
+
+func executeDisable(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) != 1 {
+		return responsef(header.T("autolink.command.help"))
+	}
+	if args[0] == optAll {
+		return executeEnableAll(p, header, false)
+	}
+	return executeEnableImpl(p, c, header, args[0], false)
+}
+
+func executeEnableImpl(p *Plugin, c *plugin.Context, header *model.CommandArgs, ref string, enabled bool) *model.CommandResponse {
+	links, refs, err := searchLinkRef(p, header, true, ref)
+	if err != nil {
+		return responsef("%v", err)
+	}
+	l := &links[refs[0]]
+	l.Disabled = !enabled
+
+	err = p.SaveLinks(links)
+	if err != nil {
+		return responsef(err.Error())
+	}
+
+	if l.Name != "" {
+		ref = l.Name
+	}
+	return executeList(p, c, header, ref)
+}
+
+func executeDebug(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) != 2 {
+		return responsef(header.T("autolink.command.help"))
+	}
+	var debug bool
+	switch args[1] {
+	case "on":
+		debug = true
+	case "off":
+	default:
+		return responsef(header.T("autolink.command.help"))
+	}
+
+	links, refs, err := searchLinkRef(p, header, true, args[0])
+	if err != nil {
+		return responsef("%v", err)
+	}
+	l := &links[refs[0]]
+	l.Debug = debug
+
+	err = p.SaveLinks(links)
+	if err != nil {
+		return responsef(err.Error())
+	}
+
+	ref := args[0]
+	if l.Name != "" {
+		ref = l.Name
+	}
+	return executeList(p, c, header, ref)
+}
+
+func executeAdd(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) > 1 {
+		return responsef(header.T("autolink.command.help"))
+	}
+	name := ""
+	if len(args) == 1 {
+		name = args[0]
+	}
+
+	newLink := autolink.Autolink{
+		Name: name,
+	}
+
+	filter, err := linkFilter(p, header)
+	if err != nil {
+		return responsef("%v", err)
+	}
+	if filter != nil {
+		// Links added by team admins are scoped to the current team
+		team, appErr := p.API.GetTeam(header.TeamId)
+		if appErr != nil {
+			return responsef(header.T("autolink.command.add.team_failed"), appErr)
+		}
+		newLink.Scope = []string{team.Name}
+	}
+
+	err = p.SaveLinks(append(p.getConfig().Links, newLink))
+	if err != nil {
+		return responsef(err.Error())
+	}
+
+	if name == "" {
+		return executeList(p, c, header)
+	}
+	return executeList(p, c, header, name)
+}
+
+func executeAddPreset(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) == 0 {
+		out := header.T("autolink.command.add_preset.presets")
+		for _, preset := range autolink.Presets() {
+			params := []string{}
+			for _, param := range preset.Params {
+				if param.Default == "" {
+					params = append(params, fmt.Sprintf("--%s <value>", param.Name))
+				} else {
+					params = append(params, fmt.Sprintf("[--%s <value>]", param.Name))
+				}
+			}
+			out += fmt.Sprintf("- `%s %s` - %s\n", preset.Name, strings.Join(params, " "), preset.Description)
+		}
+		return responsef("%s", out)
+	}
+
+	preset, ok := autolink.GetPreset(args[0])
+	if !ok {
+		return responsef(header.T("autolink.command.add_preset.not_found"), args[0])
+	}
+	if len(args)%2 != 1 {
+		return responsef(header.T("autolink.command.help"))
+	}
+
+	name := preset.Name
+	values := map[string]string{}
+	for i := 1; i < len(args); i += 2 {
+		if !strings.HasPrefix(args[i], "--") {
+			return responsef(header.T("autolink.command.help"))
+		}
+		if args[i] == "--name" {
+			name = args[i+1]
+			continue
+		}
+		values[strings.TrimPrefix(args[i], "--")] = args[i+1]
+	}
+
+	newLink, err := preset.Link(values)
+	if err != nil {
+		return responsef("%v", err)
+	}
+	newLink.Name = name
+
+	links := p.getConfig().Links
+	for _, l := range links {
+		if l.Name == name {
+			return responsef(header.T("autolink.command.add_preset.exists"), name)
+		}
+	}
+
+	filter, err := linkFilter(p, header)
+	if err != nil {
+		return responsef("%v", err)
+	}
+	if filter != nil {
+		// Links added by team admins are scoped to the current team
+		team, appErr := p.API.GetTeam(header.TeamId)
+		if appErr != nil {
+			return responsef(header.T("autolink.command.add.team_failed"), appErr)
+		}
+		newLink.Scope = []string{team.Name}
+	}
+
+	err = p.SaveLinks(append(links, newLink))
+	if err != nil {
+		return responsef(err.Error())
+	}
+	return executeList(p, c, header, name)
+}
+
+func executeImportGitHub(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) != 1 {
+		return responsef(header.T("autolink.command.help"))
+	}
+
+	filter, err := linkFilter(p, header)
+	if err != nil {
+		return responsef("%v", err)
+	}
+	if filter != nil {
+		return responsef(header.T("autolink.command.import_github.not_authorized"))
+	}
+
+	conf := p.getConfig()
+	imported, failed, err := importer.NewGitHub(conf.GitHubAPIURL, conf.GitHubToken).Import(args[0])
+	if err != nil {
+		return responsef(header.T("autolink.command.import_github.failed"), err)
+	}
+	failures := ""
+	repos := make([]string, 0, len(failed))
+	for repo := range failed {
+		repos = append(repos, repo)
+	}
+	sort.Strings(repos)
+	for _, repo := range repos {
+		failures += header.T("autolink.command.import_github.repository_failed", repo, failed[repo].Error())
+	}
+	if len(imported) == 0 {
+		return responsef("%s", header.T("autolink.command.import_github.not_found", args[0])+failures)
+	}
+
+	links := append([]autolink.Autolink{}, conf.Links...)
+	text := ""
+	for _, link := range imported {
+		replaced := false
+		for i := range links {
+			if links[i].Name == link.Name {
+				links[i].Pattern = link.Pattern
+				links[i].Template = link.Template
+				replaced = true
+				break
+			}
+		}
+		if replaced {
+			text += header.T("autolink.command.import_github.updated", link.Name)
+		} else {
+			links = append(links, link)
+			text += header.T("autolink.command.import_github.added", link.Name)
+		}
+	}
+
+	err = p.SaveLinks(links)
+	if err != nil {
+		return responsef(err.Error())
+	}
+
+	return responsef(header.T("autolink.command.import_github.imported"), len(imported), text+failures)
+}
+
+// executeImportCSV adds or updates the links of the CSV following the command,
+// on the same line or the next ones.
+func executeImportCSV(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) == 0 {
+		return responsef(header.T("autolink.command.help"))
+	}
+
+	filter, err := linkFilter(p, header)
+	if err != nil {
+		return responsef("%v", err)
+	}
+	if filter != nil {
+		return responsef(header.T("autolink.command.import_github.not_authorized"))
+	}
+
+	restOfCommand := commandRest(header.Command)
+	restOfCommand = restOfCommand[strings.Index(restOfCommand, "import-csv")+len("import-csv"):]
+	imported, err := importer.ParseCSV(strings.NewReader(strings.TrimSpace(restOfCommand)))
+	if err != nil {
+		return responsef(header.T("autolink.command.import_csv.failed"), err)
+	}
+	if len(imported) == 0 {
+		return responsef(header.T("autolink.command.list.empty"))
+	}
+
+	links, added, updated := importer.Merge(p.GetLinks(), imported)
+	text := ""
+	for _, name := range added {
+		text += header.T("autolink.command.import_github.added", name)
+	}
+	for _, name := range updated {
+		text += header.T("autolink.command.import_github.updated", name)
+	}
+
+	err = p.SaveLinks(links)
+	if err != nil {
+		return responsef(err.Error())
+	}
+
+	return responsef(header.T("autolink.command.import_csv.imported"), len(imported), text)
+}
+
+func executeHelp(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	return responsef(header.T("autolink.command.help"))
+}
+
+func responsef(format string, args ...interface{}) *model.CommandResponse {
+	return &model.CommandResponse{
+		ResponseType: model.CommandResponseTypeEphemeral,
+		Text:         fmt.Sprintf(format, args...),
+		Type:         model.PostTypeDefault,
+	}
+}
+
+func executePreview(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) == 0 {
+		return responsef(header.T("autolink.command.help"))
+	}
+
+	restOfCommand := commandRest(header.Command)
+	restOfCommand = restOfCommand[strings.Index(restOfCommand, "preview")+len("preview"):]
+	text := strings.TrimSpace(restOfCommand)
+
+	var matched []string
+	post, rejection := p.previewPost(&model.Post{
+		UserId:    header.UserId,
+		ChannelId: header.ChannelId,
+		Message:   text,
+	}, func(l autolink.Autolink, _ []string) {
+		matched = append(matched, l.DisplayName())
+	})
+
+	if rejection != "" {
+		return responsef(header.T("autolink.command.preview.rejected"), rejection, strings.Join(matched, ", "))
+	}
+	if len(matched) == 0 {
+		return responsef(header.T("autolink.command.preview.no_change"))
+	}
+	return responsef(header.T("autolink.command.preview.changed"), post.Message, post.Message, strings.Join(matched, ", "))
+}
+
+func executeOptOut(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) > 1 {
+		return responsef(header.T("autolink.command.help"))
+	}
+
+	var optedOut bool
+	if len(args) == 0 {
+		var err error
+		optedOut, err = p.IsUserOptedOut(header.UserId)
+		if err != nil {
+			return responsef(header.T("autolink.command.optout.failed"), err)
+		}
+	} else {
+		var err error
+		optedOut, err = parseBoolArg(args[0])
+		if err != nil {
+			return responsef(header.T("autolink.command.set.not_bool"), args[0])
+		}
+		if err = p.SetUserOptedOut(header.UserId, optedOut); err != nil {
+			return responsef(header.T("autolink.command.optout.failed"), err)
+		}
+	}
+
+	if optedOut {
+		return responsef(header.T("autolink.command.optout.on"))
+	}
+	return responsef(header.T("autolink.command.optout.off"))
+}
+
+// revertSearchDepth is the number of recent posts of the channel searched for
+// the latest autolinked post of the user, when no post is given.
+const revertSearchDepth = 50
+
+func executeRevert(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) > 1 {
+		return responsef(header.T("autolink.command.help"))
+	}
+
+	var post *model.Post
+	if len(args) == 1 {
+		// A permalink ends with the post ID, e.g. https://host/team/pl/<id>.
+		postID := args[0]
+		if i := strings.LastIndex(postID, "/"); i >= 0 {
+			postID = postID[i+1:]
+		}
+		if !model.IsValidId(postID) {
+			return responsef(header.T("autolink.command.revert.invalid_post"), args[0])
+		}
+		var appErr *model.AppError
+		post, appErr = p.API.GetPost(postID)
+		if appErr != nil {
+			return responsef(header.T("autolink.command.revert.invalid_post"), args[0])
+		}
+		if post.UserId != header.UserId {
+			return responsef(header.T("autolink.command.revert.not_authorized"))
+		}
+	} else {
+		posts, appErr := p.API.GetPostsForChannel(header.ChannelId, 0, revertSearchDepth)
+		if appErr != nil {
+			return responsef(header.T("autolink.command.revert.failed"), appErr)
+		}
+		posts.UniqueOrder()
+		for _, id := range posts.Order {
+			candidate := posts.Posts[id]
+			if candidate.UserId == header.UserId && candidate.GetProp(originalMessagePostProp) != nil {
+				post = candidate
+				break
+			}
+		}
+		if post == nil {
+			return responsef(header.T("autolink.command.revert.not_found"))
+		}
+	}
+
+	original, ok := post.GetProp(originalMessagePostProp).(string)
+	if !ok {
+		return responsef(header.T("autolink.command.revert.not_autolinked"))
+	}
+	// An edited post is not reverted, which would drop the changes of the edit
+	if rewritten, ok := post.GetProp(rewrittenMessagePostProp).(string); ok && post.Message != rewritten {
+		return responsef(header.T("autolink.command.revert.edited"))
+	}
+
+	// The post is opted out, for the update not to be autolinked again.
+	post = post.Clone()
+	post.Message = original
+	post.Hashtags, _ = model.ParseHashtags(original)
+	clearRevertPostProps(post)
+	post.AddProp(optOutPostProp, true)
+	if _, appErr := p.API.UpdatePost(post); appErr != nil {
+		return responsef(header.T("autolink.command.revert.failed"), appErr)
+	}
+	return responsef(header.T("autolink.command.revert.done"))
+}
+
+// isChannelAdmin reports whether the user running the command may enable or
+// disable autolinking in the current channel.
+func (p *Plugin) isChannelAdmin(header *model.CommandArgs) (bool, error) {
+	isAdmin, err := p.IsAuthorizedAdmin(header.UserId)
+	if err != nil || isAdmin {
+		return isAdmin, err
+	}
+	return p.API.HasPermissionToChannel(header.UserId, header.ChannelId, model.PermissionManageChannelRoles), nil
+}
+
+func executeChannelStatus(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) != 0 {
+		return responsef(header.T("autolink.command.help"))
+	}
+
+	optedOut, err := p.IsChannelOptedOut(header.ChannelId)
+	if err != nil {
+		return responsef(header.T("autolink.command.channel.failed"), err)
+	}
+	if optedOut {
+		return responsef(header.T("autolink.command.channel.disabled"))
+	}
+	return responsef(header.T("autolink.command.channel.enabled"))
+}
+
+func executeChannelDisable(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	return setChannelOptedOut(p, header, true)
+}
+
+func executeChannelEnable(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	return setChannelOptedOut(p, header, false)
+}
+
+func setChannelOptedOut(p *Plugin, header *model.CommandArgs, optOut bool) *model.CommandResponse {
+	ok, err := p.isChannelAdmin(header)
+	if err != nil {
+		return responsef(header.T("autolink.command.authorize_failed"), err)
+	}
+	if !ok {
+		return responsef(header.T("autolink.command.channel.not_authorized"))
+	}
+
+	if err = p.SetChannelOptedOut(header.ChannelId, optOut); err != nil {
+		return responsef(header.T("autolink.command.channel.failed"), err)
+	}
+	if optOut {
+		return responsef(header.T("autolink.command.channel.disabled"))
+	}
+	return responsef(header.T("autolink.command.channel.enabled"))
+}
+
+func searchLinkRef(p *Plugin, header *model.CommandArgs, requireUnique bool, args ...string) ([]autolink.Autolink, []int, error) {
+	links := p.getConfig().Sorted().Links
+	filter, err := linkFilter(p, header)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(args) == 0 {
+		if requireUnique {
+			return nil, nil, errors.New("unreachable")
+		}
+		if filter == nil {
+			return links, nil, nil
+		}
+
+		found := []int{}
+		for i, l := range links {
+			if filter(l) {
+				found = append(found, i)
+			}
+		}
+		return links, found, nil
+	}
+
+	n, err := strconv.ParseUint(args[0], 10, 32)
+	if err == nil {
+		if n < 1 || int(n) > len(links) || (filter != nil && !filter(links[n-1])) {
+			return nil, nil, errors.Errorf(header.T("autolink.command.ref.invalid_number"), n)
+		}
+		return links, []int{int(n) - 1}, nil
+	}
+
+	found := []int{}
+	for i, l := range links {
+		if strings.Contains(l.Name, args[0]) && (filter == nil || filter(l)) {
+			found = append(found, i)
+		}
+	}
+	if len(found) == 0 {
+		if suggestions := suggestLinkNames(links, filter, args[0]); len(suggestions) > 0 {
+			return nil, nil, errors.Errorf(header.T("autolink.command.ref.not_found_suggestions"), args[0], strings.Join(suggestions, ", "))
+		}
+		return nil, nil, errors.Errorf(header.T("autolink.command.ref.not_found"), args[0])
+	}
+	if requireUnique && len(found) > 1 {
+		// The link named exactly, or else the only one whose name starts with
+		// the reference, is the one meant
+		if i, ok := uniqueLinkRef(links, found, args[0]); ok {
+			return links, []int{i}, nil
+		}
+		names := []string{}
+		for _, i := range found {
+			names = append(names, links[i].Name)
+		}
+		return nil, nil, errors.Errorf(header.T("autolink.command.ref.ambiguous"), args[0], names)
+	}
+
+	return links, found, nil
+}
+
+// uniqueLinkRef returns the link among the links found for the reference
+// whose name is the reference, ignoring case, or else the only one whose name
+// starts with it.
+func uniqueLinkRef(links []autolink.Autolink, found []int, ref string) (int, bool) {
+	ref = strings.ToLower(ref)
+	exact, prefixed := []int{}, []int{}
+	for _, i := range found {
+		name := strings.ToLower(links[i].Name)
+		if name == ref {
+			exact = append(exact, i)
+		}
+		if strings.HasPrefix(name, ref) {
+			prefixed = append(prefixed, i)
+		}
+	}
+	switch {
+	case len(exact) == 1:
+		return exact[0], true
+	case len(exact) == 0 && len(prefixed) == 1:
+		return prefixed[0], true
+	}
+	return 0, false
+}
+
+// maxLinkNameSuggestions is the maximum number of names suggested for a link
+// reference that was not found.
+const maxLinkNameSuggestions = 3
+
+// suggestLinkNames returns the names of the links closest to the reference,
+// for typos to be fixed: the names differing by at most a third of their
+// letters, the closest first.
+func suggestLinkNames(links []autolink.Autolink, filter func(autolink.Autolink) bool, ref string) []string {
+	type suggestion struct {
+		name     string
+		distance int
+	}
+	suggestions := []suggestion{}
+	for _, l := range links {
+		if l.Name == "" || (filter != nil && !filter(l)) {
+			continue
+		}
+		distance := editDistance(strings.ToLower(ref), strings.ToLower(l.Name))
+		maxDistance := len([]rune(l.Name)) / 3
+		if maxDistance < 1 {
+			maxDistance = 1
+		}
+		if distance <= maxDistance {
+			suggestions = append(suggestions, suggestion{l.Name, distance})
+		}
+	}
+	sort.SliceStable(suggestions, func(i, j int) bool { return suggestions[i].distance < suggestions[j].distance })
+
+	names := []string{}
+	for _, s := range suggestions {
+		if len(names) == maxLinkNameSuggestions {
+			break
+		}
+		names = append(names, s.name)
+	}
+	return names
+}
+
+// editDistance returns the number of letters to insert, delete or substitute,
+// or of adjacent letters to swap, to turn a into b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	beforePrevious := make([]int, len(rb)+1)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = previous[j-1] + cost
+			if previous[j]+1 < current[j] {
+				current[j] = previous[j] + 1
+			}
+			if current[j-1]+1 < current[j] {
+				current[j] = current[j-1] + 1
+			}
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] && beforePrevious[j-2]+1 < current[j] {
+				current[j] = beforePrevious[j-2] + 1
+			}
+		}
+		beforePrevious, previous, current = previous, current, beforePrevious
+	}
+	return previous[len(rb)]
+}
+
+func searchLinkRefByTemplateOrPattern(p *Plugin, header *model.CommandArgs, args ...string) ([]autolink.Autolink, []int, error) {
+	if len(args) == 1 {
+		return searchLinkRef(p, header, false)
+	}
+
+	links := p.getConfig().Sorted().Links
+	filter, err := linkFilter(p, header)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	restOfCommand := commandRest(header.Command)
 	restOfCommand = restOfCommand[strings.Index(restOfCommand, args[0])+len(args[0]):]
 	value := strings.TrimSpace(restOfCommand)
 
 	found := []int{}
 	for i, l := range links {
+		if filter != nil && !filter(l) {
+			continue
+		}
 		if (args[0] == optTemplate && strings.Contains(strings.ToLower(l.Template), strings.ToLower(value))) ||
-			(args[0] == optPattern && strings.Contains(strings.ToLower(l.Pattern), strings.ToLower(value))) {
+			(args[0] == optPattern && patternsContain(l, value)) {
 			found = append(found, i)
 		}
 	}
 
 	if len(found) == 0 {
-		return nil, nil, errors.Errorf("%q not found", value)
+		return nil, nil, errors.Errorf(header.T("autolink.command.ref.not_found"), value)
 	}
 
 	return links, found, nil
 }
 
+func patternsContain(l autolink.Autolink, value string) bool {
+	for _, pattern := range l.AllPatterns() {
+		if strings.Contains(strings.ToLower(pattern), strings.ToLower(value)) {
+			return true
+		}
+	}
+	return false
+}
+
 func parseBoolArg(arg string) (bool, error) {
 	switch strings.ToLower(arg) {
 	case "true", "on":
@@ -396,19 +2023,3 @@ func parseBoolArg(arg string) (bool, error) {
 	}
 	return false, errors.Errorf("Not a bool, %q", arg)
 }
-
-func saveConfigLinks(p *Plugin, links []autolink.Autolink) error {
-	conf := p.getConfig()
-	conf.Links = links
-
-	configMap, err := p.getConfig().ToMap()
-	if err != nil {
-		return err
-	}
-
-	appErr := p.API.SavePluginConfig(configMap)
-	if appErr != nil {
-		return appErr
-	}
-	return nil
-}
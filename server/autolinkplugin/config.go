@@ -7,152 +7,832 @@ import (
 
 	"github.com/mattermost/mattermost-server/v6/model"
 	"github.com/mattermost/mattermost-server/v6/plugin"
+	"github.com/mattermost/mattermost-server/v6/shared/i18n"
 	"github.com/pkg/errors"
 
 	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+	"github.com/mattermost/mattermost-plugin-autolink/server/enrich"
 )
 
+// Autolink.Enrich values selecting the Jira issue enrichment, and the CVE
+// severity and summary enrichment
+const (
+	enrichJira = "jira"
+	enrichCVE  = "cve"
+)
+
+// defaultCommandTrigger is the trigger of the command, unless another one is
+// configured.
+const defaultCommandTrigger = "autolink"
+
 // Config from config.json
 type Config struct {
-	EnableAdminCommand bool                `json:"enableadmincommand"`
-	EnableOnUpdate     bool                `json:"enableonupdate"`
-	PluginAdmins       string              `json:"pluginadmins"`
-	Links              []autolink.Autolink `json:"links"`
+	EnableAdminCommand        bool   `json:"enableadmincommand"`
+	CommandTrigger            string `json:"commandtrigger"`
+	EnableOnUpdate            bool   `json:"enableonupdate"`
+	SkipIntegrationPosts      bool   `json:"skipintegrationposts"`
+	ProcessPluginPosts        bool   `json:"processpluginposts"`
+	SkipAPIEdits              bool   `json:"skipapiedits"`
+	SkipFileComments          bool   `json:"skipfilecomments"`
+	MaxReplacementsPerPost    int    `json:"maxreplacementsperpost"`
+	EnableTeamAdminDelegation bool   `json:"enableteamadmindelegation"`
+	PluginAdmins              string `json:"pluginadmins"`
+	PluginViewers             string `json:"pluginviewers"`
+
+	// CommandReaderRoles are the roles, e.g. system_user, allowed to list,
+	// search and test the links with the command, separated by commas.
+	CommandReaderRoles string `json:"commandreaderroles"`
+
+	GitHubToken  string `json:"githubtoken"`
+	GitHubAPIURL string `json:"githubapiurl"`
+	GitLabToken  string `json:"gitlabtoken"`
+	GitLabAPIURL string `json:"gitlabapiurl"`
+
+	// CIToken authenticates the CI pipelines publishing links, which may
+	// only manage the links whose names start with CINamespace.
+	CIToken     string `json:"citoken"`
+	CINamespace string `json:"cinamespace"`
+
+	JiraURL      string `json:"jiraurl"`
+	JiraUsername string `json:"jirausername"`
+	JiraToken    string `json:"jiratoken"`
+	NVDAPIKey    string `json:"nvdapikey"`
+
+	// APIRateLimitPerUser and APIRateLimitPerIP are the maximum numbers of
+	// requests per minute to the HTTP API of a single user and of a single IP
+	// address, 0 for no limit.
+	APIRateLimitPerUser int `json:"apiratelimitperuser"`
+	APIRateLimitPerIP   int `json:"apiratelimitperip"`
+	// APITrustedProxies lists the reverse proxies, as IP addresses or CIDR
+	// ranges, whose forwarded client addresses are rate limited.
+	APITrustedProxies string `json:"apitrustedproxies"`
+
+	// WebhookURL receives the events of the links changing posts, except for
+	// the links with their own webhook.
+	WebhookURL string `json:"webhookurl"`
+
+	// WebhookAllowedHosts are the hosts, separated by commas, the links may
+	// send their events to with their own WebhookURL, in addition to the
+	// WebhookURL of the settings.
+	WebhookAllowedHosts string `json:"webhookallowedhosts"`
+
+	// MaxMessageSize is the size in kilobytes above which messages are left
+	// as they are, without applying the links to them, 0 for no limit.
+	MaxMessageSize int `json:"maxmessagesize"`
+
+	// MaxRewritePasses is the number of times a post is rewritten, e.g. when
+	// it is edited or updated by another plugin, after which it is left as it
+	// is, 0 for no limit.
+	MaxRewritePasses int `json:"maxrewritepasses"`
+
+	// MaxRewritesPerChannel is the number of posts rewritten in a channel per
+	// minute, after which the posts of the channel are left as they are until
+	// the next minute, 0 for no limit.
+	MaxRewritesPerChannel int `json:"maxrewritesperchannel"`
+
+	// SlowLinkThreshold is the time in milliseconds above which the 95th
+	// percentile of the time a link takes to process a message is reported
+	// to the admins, 0 not to measure it. With DisableSlowLinks, the slow
+	// links are also disabled.
+	SlowLinkThreshold int  `json:"slowlinkthreshold"`
+	DisableSlowLinks  bool `json:"disableslowlinks"`
+
+	// EnableSuggestions counts the URLs posted in the channels, and suggests
+	// the admins links generating the ones posted often.
+	EnableSuggestions bool `json:"enablesuggestions"`
+
+	// AdminDigest is `daily` or `weekly` to send the admins a digest of the
+	// failures, expiring links and activity of the links instead of a
+	// message for each failure or expired link, empty not to.
+	AdminDigest string `json:"admindigest"`
+
+	// EnableTelemetry opts in to sending anonymous usage metrics once a day,
+	// when the telemetry of the server is enabled too.
+	EnableTelemetry bool `json:"enabletelemetry"`
+
+	// SyncSiteURL and SyncToken are the Mattermost server whose links
+	// `/autolink sync` pulls and pushes, and the token of one of its plugin
+	// admins. SyncPullInterval is how often the links are pulled from it, in
+	// minutes, 0 not to pull them on schedule.
+	SyncSiteURL      string `json:"syncsiteurl"`
+	SyncToken        string `json:"synctoken"`
+	SyncPullInterval int    `json:"syncpullinterval"`
+
+	// Variables are the global variables the templates of every link
+	// reference, e.g. `{{JIRA_BASE}}/browse/${key}`, one `NAME=value` per
+	// line, parsed into variables on each configuration change.
+	Variables string `json:"variables"`
+
+	// PatternFragments are the named regular expressions the patterns of
+	// every link reference, e.g. `(?P<key>{{PROJECT}}-\d+)`, one
+	// `NAME=regexp` per line, parsed into fragments on each configuration
+	// change.
+	PatternFragments string `json:"patternfragments"`
+
+	// ExcludedPosts are the posts left as they are, e.g. posts created
+	// through the REST API with some props, one exclusion per line, parsed
+	// into postExclusions on each configuration change.
+	ExcludedPosts string `json:"excludedposts"`
+
+	// SchemaVersion is the version of the format of the saved links, which
+	// are migrated to the current version when the plugin starts.
+	SchemaVersion int `json:"schemaversion"`
+
+	// Links are kept in the KV store. Links found in the configuration, added
+	// to config.json or by an older version of the plugin, are imported into
+	// the KV store and removed from the configuration.
+	Links []autolink.Autolink `json:"links"`
+
+	// LinkEntries are links to add, update or delete, edited in the System
+	// Console one link per block of `Field: value` lines, parsed into
+	// entryLinks and deletedLinks on each configuration change. Like Links,
+	// they are imported into the KV store and removed from the configuration.
+	LinkEntries string `json:"linkentries"`
 
 	// AdminUserIds is a set of UserIds that are permitted to perform
 	// administrative operations on the plugin configuration (i.e. plugin
 	// admins). On each configuration change the contents of PluginAdmins
 	// config field is parsed into this field.
 	AdminUserIds map[string]struct{} `json:"-"`
+
+	// unresolvedAdmins are the entries of PluginAdmins that are not the ID
+	// or username of an active user, e.g. of a deactivated user
+	unresolvedAdmins []string
+
+	// ViewerUserIds are the IDs of the users of PluginViewers, and
+	// unresolvedViewers its entries that are not active users.
+	ViewerUserIds     map[string]struct{} `json:"-"`
+	unresolvedViewers []string
+
+	variables      map[string]string
+	fragments      map[string]string
+	postExclusions []postExclusion
+	entryLinks     []autolink.Autolink
+	deletedLinks   []string
+
+	// compileErrors are the errors compiling the links, by index
+	compileErrors []error
+
+	// scopeIndex caches the links applying to each channel
+	scopeIndex *scopeIndex
+
+	// loaded is set once the configuration was loaded, the configuration of
+	// a new plugin being empty
+	loaded bool
+
+	// linksData is the value of the links in the KV store the links were
+	// loaded from, to detect concurrent changes when saving them
+	linksData []byte
+
+	jira *enrich.Jira
+	cve  *enrich.CVE
 }
 
 // OnConfigurationChange is invoked when configuration changes may have been made.
 func (p *Plugin) OnConfigurationChange() error {
+	return p.loadConfiguration(false)
+}
+
+// loadConfiguration loads the plugin configuration and the links. The links
+// that did not change keep their compiled patterns, unless recompile is set.
+func (p *Plugin) loadConfiguration(recompile bool) error {
 	var c Config
 	if err := p.API.LoadPluginConfiguration(&c); err != nil {
-		return errors.Wrap(err, "failed to load plugin configuration")
+		err = errors.Wrap(err, "failed to load plugin configuration")
+		p.diagnostics.setConfigError(err)
+		return err
+	}
+	p.diagnostics.setConfigError(nil)
+
+	if c.JiraURL != "" {
+		c.jira = enrich.NewJira(c.JiraURL, c.JiraUsername, c.JiraToken)
 	}
+	c.cve = enrich.NewCVE("", c.NVDAPIKey)
 
-	for i := range c.Links {
-		if err := c.Links[i].Compile(); err != nil {
-			p.API.LogError("Error creating autolinker", "link", c.Links[i], "error", err.Error())
+	// If a variable is invalid, none is substituted, the templates keeping
+	// their references for /autolink lint to report them
+	variables, err := autolink.ParseVariables(c.Variables)
+	if err != nil {
+		p.API.LogError("Invalid template variables", "error", err.Error())
+		p.diagnostics.setConfigError(errors.Wrap(err, "invalid template variables"))
+	}
+	c.variables = variables
+
+	// Likewise for the pattern fragments
+	fragments, err := autolink.ParsePatternFragments(c.PatternFragments)
+	if err != nil {
+		p.API.LogError("Invalid pattern fragments", "error", err.Error())
+		p.diagnostics.setConfigError(errors.Wrap(err, "invalid pattern fragments"))
+	}
+	c.fragments = fragments
+
+	postExclusions, err := parsePostExclusions(c.ExcludedPosts)
+	if err != nil {
+		p.API.LogError("Invalid post exclusions", "error", err.Error())
+		p.diagnostics.setConfigError(errors.Wrap(err, "invalid post exclusions"))
+	}
+	c.postExclusions = postExclusions
+
+	// Invalid link entries are not imported, the error being reported at
+	// their top for the admin to fix them in the System Console
+	entryLinks, deletedLinks, entriesErr := parseLinkEntries(c.LinkEntries)
+	if entriesErr != nil {
+		entriesErr = errors.Wrap(entriesErr, "invalid link entries")
+		p.API.LogError("Invalid link entries", "error", entriesErr.Error())
+		p.diagnostics.setConfigError(entriesErr)
+	} else {
+		c.entryLinks, c.deletedLinks = entryLinks, deletedLinks
+	}
+
+	links, err := p.loadLinks(&c)
+	if err != nil {
+		p.API.LogError("Failed to load the links", "error", err.Error())
+		p.diagnostics.setConfigError(err)
+		if links == nil {
+			links = p.GetLinks()
 		}
+		if entriesErr == nil {
+			entriesErr = err
+		}
+	}
+	if c.LinkEntries != "" {
+		p.reportLinkEntriesError(&c, entriesErr)
 	}
+	previous := p.getConfig()
+	if recompile {
+		previous = nil
+	}
+	p.setLinks(&c, links, previous)
 
 	// Plugin admin UserId parsing and validation errors are
 	// not fatal, if everything fails only sysadmin will be able to manage the
 	// config which is still OK
 	c.parsePluginAdminList(p.API)
 
+	if c.CommandTrigger != "" && c.commandTrigger() == defaultCommandTrigger {
+		p.API.LogWarn("Invalid command trigger, using the default one", "trigger", c.CommandTrigger)
+	}
+	previousTrigger := p.getConfig().commandTrigger()
+
+	if previous := p.getConfig(); previous.loaded {
+		p.logConfigChanges(previous, &c)
+	}
+	c.loaded = true
+
 	p.UpdateConfig(func(conf *Config) {
 		*conf = c
 	})
 
-	go func() {
-		if c.EnableAdminCommand {
-			_ = p.API.RegisterCommand(&model.Command{
-				Trigger:          "autolink",
-				DisplayName:      "Autolink",
-				Description:      "Autolink administration.",
-				AutoComplete:     true,
-				AutoCompleteDesc: "Available commands: add, delete, disable, enable, list, set, test",
-				AutoCompleteHint: "[command]",
-				AutocompleteData: getAutoCompleteData(),
-			})
-		} else {
-			_ = p.API.UnregisterCommand("", "autolink")
-		}
-	}()
+	go p.registerCommand(c.EnableAdminCommand, c.commandTrigger(), previousTrigger)
 
 	return nil
 }
 
-func getAutoCompleteData() *model.AutocompleteData {
-	autolink := model.NewAutocompleteData("autolink", "[command]",
-		"Available command : add, delete, disable, enable, list, set, test")
+// commandTrigger returns the configured trigger of the command, without the
+// leading slash, or the default one if it is not set or not valid.
+func (conf *Config) commandTrigger() string {
+	trigger := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(conf.CommandTrigger), "/"))
+	if trigger == "" || strings.ContainsAny(trigger, "/ \t\n") {
+		return defaultCommandTrigger
+	}
+	return trigger
+}
+
+// registerCommand registers the command with the autocomplete data in the
+// server locale, or unregisters it if disabled. The command is unregistered
+// from its previous trigger if the trigger changed.
+func (p *Plugin) registerCommand(enabled bool, trigger, previousTrigger string) {
+	if previousTrigger != "" && previousTrigger != trigger {
+		_ = p.API.UnregisterCommand("", previousTrigger)
+	}
+	if !enabled {
+		_ = p.API.UnregisterCommand("", trigger)
+		return
+	}
+
+	t := p.translateFunc(p.serverLocale())
+	_ = p.API.RegisterCommand(&model.Command{
+		Trigger:          trigger,
+		DisplayName:      "Autolink",
+		Description:      t("autolink.autocomplete.description"),
+		AutoComplete:     true,
+		AutoCompleteDesc: t("autolink.autocomplete.commands"),
+		AutoCompleteHint: "[command]",
+		AutocompleteData: getAutoCompleteData(t, trigger),
+	})
+}
+
+func getAutoCompleteData(t i18n.TranslateFunc, trigger string) *model.AutocompleteData {
+	presetItems := []model.AutocompleteListItem{}
+	for _, preset := range autolink.Presets() {
+		presetItems = append(presetItems, model.AutocompleteListItem{
+			HelpText: preset.Description,
+			Hint:     "",
+			Item:     preset.Name,
+		})
+	}
+
+	autolink := model.NewAutocompleteData(trigger, "[command]",
+		t("autolink.autocomplete.commands"))
 
 	add := model.NewAutocompleteData("add", "",
-		"Add a new link with a given name")
-	add.AddTextArgument("Name for a new link", "[name]", "")
+		t("autolink.autocomplete.add"))
+	add.AddTextArgument(t("autolink.autocomplete.add.name"), "[name]", "")
 	autolink.AddCommand(add)
 
+	addPreset := model.NewAutocompleteData("add-preset", "",
+		t("autolink.autocomplete.add_preset"))
+	addPreset.AddStaticListArgument(t("autolink.autocomplete.add_preset.preset"), false, presetItems)
+	autolink.AddCommand(addPreset)
+
+	channel := model.NewAutocompleteData("channel", "",
+		t("autolink.autocomplete.channel"))
+	channel.AddCommand(model.NewAutocompleteData("disable", "", t("autolink.autocomplete.channel.disable")))
+	channel.AddCommand(model.NewAutocompleteData("enable", "", t("autolink.autocomplete.channel.enable")))
+	autolink.AddCommand(channel)
+
 	delete := model.NewAutocompleteData("delete", "",
-		"Delete a link with a given name")
-	delete.AddTextArgument("Name of the link to delete", "[name]", "")
+		t("autolink.autocomplete.delete"))
+	delete.AddTextArgument(t("autolink.autocomplete.delete.name"), "[name]", "")
 	autolink.AddCommand(delete)
 
 	disable := model.NewAutocompleteData("disable", "",
-		"Disable a link with a given name")
-	disable.AddTextArgument("Name of the link to disable", "[name]", "")
+		t("autolink.autocomplete.disable"))
+	disable.AddTextArgument(t("autolink.autocomplete.disable.name"), "[name] or --all", "")
 	autolink.AddCommand(disable)
 
 	enable := model.NewAutocompleteData("enable", "",
-		"Enable a link with a given name")
-	enable.AddTextArgument("Name of the link to enable", "[name]", "")
+		t("autolink.autocomplete.enable"))
+	enable.AddTextArgument(t("autolink.autocomplete.enable.name"), "[name] or --all", "")
 	autolink.AddCommand(enable)
 
+	debug := model.NewAutocompleteData("debug", "",
+		t("autolink.autocomplete.debug"))
+	debug.AddTextArgument(t("autolink.autocomplete.debug.name"), "[name]", "")
+	debug.AddStaticListArgument(t("autolink.autocomplete.debug.value"), true,
+		[]model.AutocompleteListItem{
+			{
+				HelpText: "",
+				Hint:     "",
+				Item:     "on",
+			},
+			{
+				HelpText: "",
+				Hint:     "",
+				Item:     "off",
+			},
+		})
+	autolink.AddCommand(debug)
+
+	importGitHub := model.NewAutocompleteData("import-github", "",
+		t("autolink.autocomplete.import_github"))
+	importGitHub.AddTextArgument(t("autolink.autocomplete.import_github.target"), "[owner] or [owner/repo]", "")
+	autolink.AddCommand(importGitHub)
+
+	importGitLab := model.NewAutocompleteData("import-gitlab", "",
+		t("autolink.autocomplete.import_gitlab"))
+	importGitLab.AddTextArgument(t("autolink.autocomplete.import_gitlab.target"), "[group] or [group/project]", "")
+	autolink.AddCommand(importGitLab)
+
+	pause := model.NewAutocompleteData("pause", "",
+		t("autolink.autocomplete.pause"))
+	pause.AddTextArgument(t("autolink.autocomplete.pause.duration"), "[duration]", "")
+	autolink.AddCommand(pause)
+
+	autolink.AddCommand(model.NewAutocompleteData("resume", "", t("autolink.autocomplete.resume")))
+
+	profile := model.NewAutocompleteData("profile", "",
+		t("autolink.autocomplete.profile"))
+	profile.AddCommand(model.NewAutocompleteData("list", "", t("autolink.autocomplete.profile.list")))
+	for _, sub := range []string{"save", "apply", "delete"} {
+		profileSub := model.NewAutocompleteData(sub, "", t("autolink.autocomplete.profile."+sub))
+		profileSub.AddTextArgument(t("autolink.autocomplete.profile.name"), "[name]", "")
+		profile.AddCommand(profileSub)
+	}
+	autolink.AddCommand(profile)
+
+	sample := model.NewAutocompleteData("sample", "",
+		t("autolink.autocomplete.sample"))
+	sampleAdd := model.NewAutocompleteData("add", "", t("autolink.autocomplete.sample.add"))
+	sampleAdd.AddTextArgument(t("autolink.autocomplete.sample.add.args"), "[linkref] [name] [text]", "")
+	sample.AddCommand(sampleAdd)
+	for _, sub := range []string{"list", "update", "delete"} {
+		sampleSub := model.NewAutocompleteData(sub, "", t("autolink.autocomplete.sample."+sub))
+		sampleSub.AddTextArgument(t("autolink.autocomplete.sample.args"), "[linkref] [name]", "")
+		sample.AddCommand(sampleSub)
+	}
+	autolink.AddCommand(sample)
+
+	verify := model.NewAutocompleteData("verify", "",
+		t("autolink.autocomplete.verify"))
+	verify.AddTextArgument(t("autolink.autocomplete.verify.linkref"), "[linkref]", "")
+	autolink.AddCommand(verify)
+
+	simulate := model.NewAutocompleteData("simulate", "",
+		t("autolink.autocomplete.simulate"))
+	simulate.AddTextArgument(t("autolink.autocomplete.simulate.args"), "[--include-disabled] [file-id]", "")
+	autolink.AddCommand(simulate)
+
+	export := model.NewAutocompleteData("export", "",
+		t("autolink.autocomplete.export"))
+	export.AddTextArgument(t("autolink.autocomplete.export.args"), "[--scope team/channel] [--group group] [--tag tag]", "")
+	autolink.AddCommand(export)
+
+	apiKey := model.NewAutocompleteData("apikey", "",
+		t("autolink.autocomplete.apikey"))
+	apiKeyCreate := model.NewAutocompleteData("create", "", t("autolink.autocomplete.apikey.create"))
+	apiKeyCreate.AddTextArgument(t("autolink.autocomplete.apikey.create.args"), "[name] [--scope read|write] [--group group]", "")
+	apiKey.AddCommand(apiKeyCreate)
+	apiKey.AddCommand(model.NewAutocompleteData("list", "", t("autolink.autocomplete.apikey.list")))
+	apiKeyRevoke := model.NewAutocompleteData("revoke", "", t("autolink.autocomplete.apikey.revoke"))
+	apiKeyRevoke.AddTextArgument(t("autolink.autocomplete.apikey.name"), "[name]", "")
+	apiKey.AddCommand(apiKeyRevoke)
+	autolink.AddCommand(apiKey)
+	autolink.AddCommand(model.NewAutocompleteData("selftest", "", t("autolink.autocomplete.selftest")))
+	autolink.AddCommand(model.NewAutocompleteData("reload", "", t("autolink.autocomplete.reload")))
+
+	sync := model.NewAutocompleteData("sync", "",
+		t("autolink.autocomplete.sync"))
+	syncPull := model.NewAutocompleteData("pull", "", t("autolink.autocomplete.sync.pull"))
+	syncPull.AddTextArgument(t("autolink.autocomplete.sync.dry_run"), "[--dry-run]", "")
+	sync.AddCommand(syncPull)
+	syncPush := model.NewAutocompleteData("push", "", t("autolink.autocomplete.sync.push"))
+	syncPush.AddTextArgument(t("autolink.autocomplete.sync.dry_run"), "[--dry-run]", "")
+	sync.AddCommand(syncPush)
+	autolink.AddCommand(sync)
+
+	acceptSuggestion := model.NewAutocompleteData("accept-suggestion", "",
+		t("autolink.autocomplete.accept_suggestion"))
+	acceptSuggestion.AddTextArgument(t("autolink.autocomplete.accept_suggestion.id"), "[id]", "")
+	autolink.AddCommand(acceptSuggestion)
+
+	importCSV := model.NewAutocompleteData("import-csv", "",
+		t("autolink.autocomplete.import_csv"))
+	importCSV.AddTextArgument(t("autolink.autocomplete.import_csv.csv"), "[csv]", "")
+	autolink.AddCommand(importCSV)
+
+	benchmark := model.NewAutocompleteData("benchmark", "",
+		t("autolink.autocomplete.benchmark"))
+	benchmark.AddTextArgument(t("autolink.autocomplete.benchmark.name"), "[name]", "")
+	autolink.AddCommand(benchmark)
+
+	setup := model.NewAutocompleteData("setup", "",
+		t("autolink.autocomplete.setup"))
+	autolink.AddCommand(setup)
+
+	manage := model.NewAutocompleteData("manage", "",
+		t("autolink.autocomplete.manage"))
+	autolink.AddCommand(manage)
+
+	lint := model.NewAutocompleteData("lint", "",
+		t("autolink.autocomplete.lint"))
+	autolink.AddCommand(lint)
+
 	list := model.NewAutocompleteData("list", "",
-		"List all configured links")
-	list.AddStaticListArgument("List the link which match with the given condition",
+		t("autolink.autocomplete.list"))
+	list.AddStaticListArgument(t("autolink.autocomplete.list.condition"),
 		false, []model.AutocompleteListItem{
 			{
-				HelpText: "If `name` of a link is provided, it will only list a configuration of `name` link ",
+				HelpText: t("autolink.autocomplete.list.name"),
 				Hint:     "(optional)",
 				Item:     "[name]",
 			},
 			{
-				HelpText: "List configuration of link matched with the given template",
+				HelpText: t("autolink.autocomplete.list.template"),
 				Hint:     "(optional)",
 				Item:     "Template",
 			},
 			{
-				HelpText: "List configuration of link matched with the given pattern",
+				HelpText: t("autolink.autocomplete.list.pattern"),
 				Hint:     "(optional)",
 				Item:     "Pattern",
 			},
 		})
+	list.AddNamedStaticListArgument("format", t("autolink.autocomplete.list.format"), false,
+		[]model.AutocompleteListItem{
+			{Item: "default"},
+			{Item: "markdown"},
+			{Item: "json"},
+		})
 	autolink.AddCommand(list)
 
+	optOut := model.NewAutocompleteData("optout", "",
+		t("autolink.autocomplete.optout"))
+	optOut.AddStaticListArgument(t("autolink.autocomplete.optout.value"), false,
+		[]model.AutocompleteListItem{
+			{
+				HelpText: "",
+				Hint:     "",
+				Item:     "on",
+			},
+			{
+				HelpText: "",
+				Hint:     "",
+				Item:     "off",
+			},
+		})
+	autolink.AddCommand(optOut)
+
+	preview := model.NewAutocompleteData("preview", "",
+		t("autolink.autocomplete.preview"))
+	preview.AddTextArgument(t("autolink.autocomplete.preview.text"), "[text]", "")
+	autolink.AddCommand(preview)
+
+	revert := model.NewAutocompleteData("revert", "",
+		t("autolink.autocomplete.revert"))
+	revert.AddTextArgument(t("autolink.autocomplete.revert.post"), "[permalink]", "")
+	autolink.AddCommand(revert)
+
+	search := model.NewAutocompleteData("search", "",
+		t("autolink.autocomplete.search"))
+	search.AddTextArgument(t("autolink.autocomplete.search.text"), "[--regex] [text]", "")
+	autolink.AddCommand(search)
+
 	set := model.NewAutocompleteData("set", "",
-		"Set a field of a link with a given value")
-	set.AddTextArgument("Name of a link to set", "[name]", "")
-	set.AddStaticListArgument("A name of a field to set a value", false,
+		t("autolink.autocomplete.set"))
+	set.AddTextArgument(t("autolink.autocomplete.set.name"), "[name]", "")
+	set.AddStaticListArgument(t("autolink.autocomplete.set.field"), false,
 		[]model.AutocompleteListItem{
 			{
-				HelpText: "Set the `Template` field",
+				HelpText: t("autolink.autocomplete.set.template"),
 				Hint:     "",
 				Item:     "Template",
 			},
 			{
-				HelpText: "Set the `Pattern` field",
+				HelpText: t("autolink.autocomplete.set.pattern"),
 				Hint:     "",
 				Item:     "Pattern",
 			},
 			{
-				HelpText: "If true uses the \\b word boundaries",
+				HelpText: t("autolink.autocomplete.set.patterns"),
+				Hint:     "",
+				Item:     "Patterns",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.word_match"),
 				Hint:     "",
 				Item:     "WordMatch",
 			},
 			{
-				HelpText: "If true applies changes to posts created by bot accounts.",
+				HelpText: t("autolink.autocomplete.set.unicode_word_match"),
+				Hint:     "",
+				Item:     "UnicodeWordMatch",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.boundary_class"),
+				Hint:     "",
+				Item:     "BoundaryClass",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.prefix_chars"),
+				Hint:     "",
+				Item:     "PrefixChars",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.suffix_chars"),
+				Hint:     "",
+				Item:     "SuffixChars",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.max_replacements"),
+				Hint:     "",
+				Item:     "MaxReplacements",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.first_match_only"),
+				Hint:     "",
+				Item:     "FirstMatchOnly",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.process_link_labels"),
+				Hint:     "",
+				Item:     "ProcessLinkLabels",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.code_blocks"),
+				Hint:     "",
+				Item:     "CodeBlocks",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.code_spans"),
+				Hint:     "",
+				Item:     "CodeSpans",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.code_only"),
+				Hint:     "",
+				Item:     "CodeOnly",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.active_from"),
+				Hint:     "",
+				Item:     "ActiveFrom",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.active_until"),
+				Hint:     "",
+				Item:     "ActiveUntil",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.schedule"),
+				Hint:     "",
+				Item:     "Schedule",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.expires_at"),
+				Hint:     "",
+				Item:     "ExpiresAt",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.case_insensitive"),
+				Hint:     "",
+				Item:     "CaseInsensitive",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.multi_line"),
+				Hint:     "",
+				Item:     "MultiLine",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.dot_all"),
+				Hint:     "",
+				Item:     "DotAll",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.across_lines"),
+				Hint:     "",
+				Item:     "AcrossLines",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.process_bot_posts"),
 				Hint:     "",
 				Item:     "ProcessBotPosts",
 			},
 			{
-				HelpText: "team/channel the autolink applies to",
+				HelpText: t("autolink.autocomplete.set.process_integration_posts"),
+				Hint:     "",
+				Item:     "ProcessIntegrationPosts",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.process_plugin_posts"),
+				Hint:     "",
+				Item:     "ProcessPluginPosts",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.process_on_update"),
+				Hint:     "",
+				Item:     "ProcessOnUpdate",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.bot_allowlist"),
+				Hint:     "",
+				Item:     "BotAllowlist",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.bot_denylist"),
+				Hint:     "",
+				Item:     "BotDenylist",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.scope"),
 				Hint:     "",
 				Item:     "Scope",
 			},
+			{
+				HelpText: t("autolink.autocomplete.set.enrich"),
+				Hint:     "",
+				Item:     "Enrich",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.enrich_ttl"),
+				Hint:     "",
+				Item:     "EnrichTTL",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.fallback_template"),
+				Hint:     "",
+				Item:     "FallbackTemplate",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.cases"),
+				Hint:     "",
+				Item:     "Cases",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.locale_templates"),
+				Hint:     "",
+				Item:     "LocaleTemplates",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.scope_templates"),
+				Hint:     "",
+				Item:     "ScopeTemplates",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.attachment"),
+				Hint:     "",
+				Item:     "Attachment",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.terminal"),
+				Hint:     "",
+				Item:     "Terminal",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.terminal_post"),
+				Hint:     "",
+				Item:     "TerminalPost",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.debug"),
+				Hint:     "",
+				Item:     "Debug",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.shadow_mode"),
+				Hint:     "",
+				Item:     "ShadowMode",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.threads"),
+				Hint:     "",
+				Item:     "Threads",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.group"),
+				Hint:     "",
+				Item:     "Group",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.tags"),
+				Hint:     "",
+				Item:     "Tags",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.description"),
+				Hint:     "",
+				Item:     "Description",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.owner"),
+				Hint:     "",
+				Item:     "Owner",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.webhook_url"),
+				Hint:     "",
+				Item:     "WebhookURL",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.mentions"),
+				Hint:     "",
+				Item:     "Mentions",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.engine"),
+				Hint:     "",
+				Item:     "Engine",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.style"),
+				Hint:     "",
+				Item:     "Style",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.text_prefix"),
+				Hint:     "",
+				Item:     "TextPrefix",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.text_suffix"),
+				Hint:     "",
+				Item:     "TextSuffix",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.kind"),
+				Hint:     "",
+				Item:     "Kind",
+			},
+			{
+				HelpText: t("autolink.autocomplete.set.repositories"),
+				Hint:     "",
+				Item:     "Repositories",
+			},
 		})
 	autolink.AddCommand(set)
 
 	test := model.NewAutocompleteData("test", "",
-		"Test a link on the text provided")
-	test.AddTextArgument("Name of a link to test with", "[name]", "")
-	test.AddTextArgument("Sample text which the link applies", "[sample text]", "")
+		t("autolink.autocomplete.test"))
+	test.AddTextArgument(t("autolink.autocomplete.test.name"), "[name]", "")
+	test.AddTextArgument(t("autolink.autocomplete.test.text"), "[sample text]", "")
 	autolink.AddCommand(test)
 
-	help := model.NewAutocompleteData("help", "", "Autolink plugin slash command help")
+	testAll := model.NewAutocompleteData("test-all", "",
+		t("autolink.autocomplete.test_all"))
+	testAll.AddTextArgument(t("autolink.autocomplete.test_all.text"), "[sample text]", "")
+	autolink.AddCommand(testAll)
+
+	help := model.NewAutocompleteData("help", "", t("autolink.autocomplete.help"))
 	autolink.AddCommand(help)
 
 	return autolink
@@ -165,31 +845,6 @@ func (p *Plugin) getConfig() *Config {
 	return p.conf
 }
 
-func (p *Plugin) GetLinks() []autolink.Autolink {
-	p.confLock.RLock()
-	defer p.confLock.RUnlock()
-
-	return p.conf.Links
-}
-
-func (p *Plugin) SaveLinks(links []autolink.Autolink) error {
-	p.UpdateConfig(func(conf *Config) {
-		conf.Links = links
-	})
-
-	configMap, err := p.getConfig().ToMap()
-	if err != nil {
-		return errors.Wrap(err, "unable convert config to map")
-	}
-
-	appErr := p.API.SavePluginConfig(configMap)
-	if appErr != nil {
-		return errors.Wrap(appErr, "unable to save links")
-	}
-
-	return nil
-}
-
 func (p *Plugin) UpdateConfig(f func(conf *Config)) {
 	p.confLock.Lock()
 	defer p.confLock.Unlock()
@@ -213,34 +868,83 @@ func (conf *Config) ToMap() (map[string]interface{}, error) {
 	return out, nil
 }
 
-// Sorted returns a clone of the Config, with links sorted alphabetically
+// Sorted returns a clone of the Config, with links sorted alphabetically. The
+// links are copied, for the callers to change them without changing the
+// links the hooks are applying.
 func (conf *Config) Sorted() *Config {
-	sorted := conf
+	sorted := *conf
 	sorted.Links = append([]autolink.Autolink{}, conf.Links...)
-	sort.Slice(conf.Links, func(i, j int) bool {
-		return strings.Compare(conf.Links[i].DisplayName(), conf.Links[j].DisplayName()) < 0
+	sort.Slice(sorted.Links, func(i, j int) bool {
+		return strings.Compare(sorted.Links[i].DisplayName(), sorted.Links[j].DisplayName()) < 0
 	})
-	return conf
+	return &sorted
 }
 
-// parsePluginAdminList parses the contents of PluginAdmins config field
+// parsePluginAdminList parses the contents of PluginAdmins config field, user
+// IDs or usernames, into the IDs of the active users. The other entries are
+// kept in unresolvedAdmins. PluginViewers is parsed the same way.
 func (conf *Config) parsePluginAdminList(api plugin.API) {
-	conf.AdminUserIds = make(map[string]struct{}, len(conf.PluginAdmins))
+	conf.AdminUserIds, conf.unresolvedAdmins = parseUserList(api, conf.PluginAdmins, "plugin admin")
+	conf.ViewerUserIds, conf.unresolvedViewers = parseUserList(api, conf.PluginViewers, "plugin viewer")
+}
 
-	if len(conf.PluginAdmins) == 0 {
-		// There were no plugin admin users defined
-		return
+// parseUserList parses a comma-separated list of user IDs or usernames of the
+// role, e.g. plugin admin, into the IDs of the active users, and the entries
+// that are not active users.
+func parseUserList(api plugin.API, list, role string) (map[string]struct{}, []string) {
+	userIDs := map[string]struct{}{}
+	var unresolved []string
+
+	if len(list) == 0 {
+		// There were no users defined
+		return userIDs, nil
 	}
 
-	userIDs := strings.Split(conf.PluginAdmins, ",")
-	for _, userID := range userIDs {
-		userID = strings.TrimSpace(userID)
-		// Let's verify that the given user really exists
-		_, appErr := api.GetUser(userID)
-		if appErr != nil {
-			api.LogWarn("Error occurred while verifying userID", "userID", userID, "error", appErr)
-		} else {
-			conf.AdminUserIds[userID] = struct{}{}
+	entries := strings.Split(list, ",")
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		// Let's verify that the given user really exists, by ID and then
+		// by username
+		userID := entry
+		user, appErr := api.GetUser(entry)
+		if appErr != nil && !model.IsValidId(entry) {
+			user, appErr = api.GetUserByUsername(strings.TrimPrefix(entry, "@"))
+			if appErr == nil {
+				userID = user.Id
+			}
+		}
+		switch {
+		case appErr != nil:
+			api.LogWarn("Error occurred while verifying "+role, "entry", entry, "error", appErr)
+			unresolved = append(unresolved, entry)
+		case user.DeleteAt != 0:
+			api.LogWarn(strings.ToUpper(role[:1])+role[1:]+" is deactivated", "entry", entry)
+			unresolved = append(unresolved, entry)
+		default:
+			userIDs[userID] = struct{}{}
 		}
 	}
+	return userIDs, unresolved
+}
+
+// refreshPluginAdmins parses PluginAdmins and PluginViewers again, for the
+// users deactivated or renamed since the configuration changed to be noticed.
+func (p *Plugin) refreshPluginAdmins() {
+	conf := p.getConfig()
+	parsed := Config{PluginAdmins: conf.PluginAdmins, PluginViewers: conf.PluginViewers}
+	parsed.parsePluginAdminList(p.API)
+
+	p.confLock.Lock()
+	defer p.confLock.Unlock()
+	if p.conf.PluginAdmins != parsed.PluginAdmins || p.conf.PluginViewers != parsed.PluginViewers {
+		// The configuration changed meanwhile, and was parsed again
+		return
+	}
+	c := *p.conf
+	c.AdminUserIds, c.unresolvedAdmins = parsed.AdminUserIds, parsed.unresolvedAdmins
+	c.ViewerUserIds, c.unresolvedViewers = parsed.ViewerUserIds, parsed.unresolvedViewers
+	p.conf = &c
 }
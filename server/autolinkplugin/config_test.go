@@ -38,18 +38,15 @@ func TestOnConfigurationChange(t *testing.T) {
 		}
 
 		api := &plugintest.API{}
+		mockLinksStore(api)
 		api.On("LoadPluginConfiguration",
 			mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
 			*dest.(*Config) = conf
 			return nil
 		})
 
-		api.On("LogError",
-			mock.AnythingOfType("string"),
-			mock.AnythingOfType("string"),
-			mock.AnythingOfType("autolink.Autolink"),
-			mock.AnythingOfType("string"),
-			mock.AnythingOfType("string")).Return(nil)
+		// The invalid link is not imported
+		api.On("LogError", "Failed to load the links", "error", mock.AnythingOfType("string")).Return(nil)
 
 		api.On("UnregisterCommand", mock.AnythingOfType("string"),
 			mock.AnythingOfType("string")).Return((*model.AppError)(nil))
@@ -60,5 +57,43 @@ func TestOnConfigurationChange(t *testing.T) {
 		require.NoError(t, err)
 
 		api.AssertNumberOfCalls(t, "LogError", 1)
+		assert.Empty(t, p.GetLinks())
 	})
 }
+
+func TestDiffConfig(t *testing.T) {
+	previous := &Config{
+		EnableOnUpdate: true,
+		JiraToken:      "secret",
+		Links: []autolink.Autolink{
+			{Name: "jira", Pattern: "MM-1", Template: "one"},
+			{Name: "docs", Pattern: "docs", Template: "docs"},
+			{Name: "removed", Pattern: "removed"},
+		},
+	}
+	next := &Config{
+		EnableOnUpdate: false,
+		JiraToken:      "other secret",
+		Links: []autolink.Autolink{
+			{Name: "jira", Pattern: "MM-2", Template: "two", Scope: []string{"team"}},
+			{Name: "docs", Pattern: "docs", Template: "docs"},
+			{Name: "added", Pattern: "added"},
+		},
+	}
+
+	changes := diffConfig(previous, next)
+	assert.Equal(t, []string{"added"}, changes.added)
+	assert.Equal(t, []string{"removed"}, changes.removed)
+	assert.Equal(t, map[string][]string{"jira": {"Pattern", "Scope", "Template"}}, changes.changed)
+	assert.Equal(t, []string{"enableonupdate", "jiratoken"}, changes.settings)
+	assert.True(t, diffConfig(next, next).empty())
+
+	api := &plugintest.API{}
+	api.On("LogInfo", "Configuration changed", "links_added", "added", "links_removed", "removed",
+		"links_changed", "jira (Pattern, Scope, Template)", "settings_changed", "enableonupdate, jiratoken")
+	p := New()
+	p.SetAPI(api)
+	p.logConfigChanges(previous, next)
+	p.logConfigChanges(next, next)
+	api.AssertNumberOfCalls(t, "LogInfo", 1)
+}
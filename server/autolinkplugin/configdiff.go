@@ -0,0 +1,121 @@
+package autolinkplugin
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+// configChanges are the differences between two configurations: the names of
+// the links added and removed, the fields changed by link name, and the
+// settings changed. Only names are kept, for the values of secrets such as
+// tokens not to be logged.
+type configChanges struct {
+	added    []string
+	removed  []string
+	changed  map[string][]string
+	settings []string
+}
+
+func (c configChanges) empty() bool {
+	return len(c.added) == 0 && len(c.removed) == 0 && len(c.changed) == 0 && len(c.settings) == 0
+}
+
+// diffConfig returns the changes from the previous to the next configuration.
+// The links are told apart by name, the first one of a name being compared
+// when several share it.
+func diffConfig(previous, next *Config) configChanges {
+	changes := configChanges{changed: map[string][]string{}}
+
+	previousLinks := map[string]autolink.Autolink{}
+	for _, link := range previous.Links {
+		if _, ok := previousLinks[link.DisplayName()]; !ok {
+			previousLinks[link.DisplayName()] = link
+		}
+	}
+	seen := map[string]bool{}
+	for _, link := range next.Links {
+		name := link.DisplayName()
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		old, ok := previousLinks[name]
+		if !ok {
+			changes.added = append(changes.added, name)
+			continue
+		}
+		if fields := changedFields(old, link); len(fields) > 0 {
+			changes.changed[name] = fields
+		}
+	}
+	for _, link := range previous.Links {
+		if name := link.DisplayName(); !seen[name] {
+			changes.removed = append(changes.removed, name)
+			seen[name] = true
+		}
+	}
+
+	previousSettings, nextSettings := *previous, *next
+	previousSettings.Links, nextSettings.Links = nil, nil
+	changes.settings = changedFields(previousSettings, nextSettings)
+	return changes
+}
+
+// changedFields returns the names of the fields whose values differ between
+// a and b, as encoded to JSON, sorted.
+func changedFields(a, b interface{}) []string {
+	fieldsA, fieldsB := jsonFields(a), jsonFields(b)
+	var fields []string
+	for name, value := range fieldsA {
+		if other, ok := fieldsB[name]; !ok || !reflect.DeepEqual(value, other) {
+			fields = append(fields, name)
+		}
+	}
+	for name := range fieldsB {
+		if _, ok := fieldsA[name]; !ok {
+			fields = append(fields, name)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func jsonFields(v interface{}) map[string]interface{} {
+	fields := map[string]interface{}{}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fields
+	}
+	_ = json.Unmarshal(data, &fields)
+	return fields
+}
+
+// logConfigChanges logs the changes made to the configuration, if any, for
+// the operators to correlate the changes of behavior with the saves of the
+// configuration.
+func (p *Plugin) logConfigChanges(previous, next *Config) {
+	changes := diffConfig(previous, next)
+	if changes.empty() {
+		return
+	}
+
+	names := make([]string, 0, len(changes.changed))
+	for name := range changes.changed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	changed := make([]string, 0, len(names))
+	for _, name := range names {
+		changed = append(changed, name+" ("+strings.Join(changes.changed[name], ", ")+")")
+	}
+
+	p.API.LogInfo("Configuration changed",
+		"links_added", strings.Join(changes.added, ", "),
+		"links_removed", strings.Join(changes.removed, ", "),
+		"links_changed", strings.Join(changed, "; "),
+		"settings_changed", strings.Join(changes.settings, ", "))
+}
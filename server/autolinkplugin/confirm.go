@@ -0,0 +1,89 @@
+package autolinkplugin
+
+import (
+	"github.com/mattermost/mattermost-server/v6/model"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+// Actions of the buttons confirming the commands deleting or changing links,
+// when they are run without `--confirm`.
+const (
+	confirmActionDelete  = "confirm-delete"
+	confirmActionBulkSet = "confirm-set"
+	confirmActionCancel  = "cancel"
+)
+
+// confirmResponse asks the user to confirm a command, with the text showing
+// what the command would change. The confirm button's action is given the
+// context, to check that the links did not change meanwhile.
+func confirmResponse(header *model.CommandArgs, text, label, action string, context map[string]interface{}) *model.CommandResponse {
+	resp := responsef("%s", text)
+	resp.Attachments = []*model.SlackAttachment{{
+		Actions: []*model.PostAction{{
+			Type:  model.PostActionTypeButton,
+			Name:  label,
+			Style: "danger",
+			Integration: &model.PostActionIntegration{
+				URL:     manageActionURL(action),
+				Context: context,
+			},
+		}, {
+			Type: model.PostActionTypeButton,
+			Name: header.T("autolink.command.confirm.cancel"),
+			Integration: &model.PostActionIntegration{
+				URL: manageActionURL(confirmActionCancel),
+			},
+		}},
+	}}
+	return resp
+}
+
+// confirmDeleteResponse asks the user to confirm deleting the link, at the
+// index of the sorted links.
+func confirmDeleteResponse(header *model.CommandArgs, l autolink.Autolink, index int) *model.CommandResponse {
+	return confirmResponse(header,
+		header.T("autolink.command.delete.confirm", l.ToMarkdown(0)),
+		header.T("autolink.command.manage.delete"), confirmActionDelete,
+		manageState{Index: index, Name: l.Name}.context())
+}
+
+// handleConfirm handles the buttons of the confirmations, and returns the
+// message replacing the confirmation.
+func (p *Plugin) handleConfirm(header *model.CommandArgs, action string, ctx map[string]interface{}) string {
+	switch action {
+	case confirmActionDelete:
+		state := manageStateFromContext(ctx)
+		links, err := p.managedLinks(header, state)
+		if err != nil {
+			return err.Error()
+		}
+		removed := links[state.Index]
+		links = append(links[:state.Index], links[state.Index+1:]...)
+		if err = p.SaveLinks(links); err != nil {
+			return err.Error()
+		}
+		return header.T("autolink.command.delete.removed", removed.ToMarkdown(0))
+
+	case confirmActionBulkSet:
+		return bulkSet(p, header, contextStrings(ctx, "args"), bulkSetConfirmed, contextStrings(ctx, "links")).Text
+	}
+	return header.T("autolink.command.confirm.cancelled")
+}
+
+// contextStrings returns a list of strings of the context of an action,
+// decoded from JSON as a list of interface{}.
+func contextStrings(ctx map[string]interface{}, key string) []string {
+	values := []string{}
+	switch list := ctx[key].(type) {
+	case []interface{}:
+		for _, v := range list {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+	case []string:
+		values = list
+	}
+	return values
+}
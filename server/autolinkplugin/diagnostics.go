@@ -0,0 +1,239 @@
+package autolinkplugin
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/api"
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+// diagnostics keeps track of the problems and activity reported by the status
+// endpoint. They are kept in memory. The activity of the links is shared with
+// the other servers of a cluster, the problems only describe the current
+// server.
+type diagnostics struct {
+	lock          sync.Mutex
+	configError   string
+	lastFired     map[string]time.Time
+	scopeFailures int
+	// scopeFailuresNotified is scopeFailures when the admins were last
+	// checked for scope failures to notify about
+	scopeFailuresNotified int
+	lastScopeFailure      string
+	lastScopeFailureAt    time.Time
+	// durations are the last times each link took to process a message, by
+	// link name, when slow links are detected
+	durations map[string]*linkDurations
+	// pending is the activity of the links not shared with the other
+	// servers yet
+	pending linkStats
+}
+
+// linkStats is the activity of the links on a server, by link name, shared
+// with the other servers of a cluster.
+type linkStats struct {
+	LastFired map[string]time.Time       `json:"last_fired,omitempty"`
+	Durations map[string][]time.Duration `json:"durations,omitempty"`
+}
+
+const (
+	// slowLinkSamples is the number of the last messages the time of a link
+	// is measured on to detect slow links.
+	slowLinkSamples = 100
+
+	// slowLinkMinSamples is the number of messages a link must have processed
+	// to be reported as slow.
+	slowLinkMinSamples = 20
+)
+
+// linkDurations is a ring of the last times a link took to process a message.
+type linkDurations struct {
+	samples []time.Duration
+	next    int
+}
+
+func (d *diagnostics) setConfigError(err error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.configError = ""
+	if err != nil {
+		d.configError = err.Error()
+	}
+}
+
+// configErr returns the error loading the configuration, or "" if it loaded.
+func (d *diagnostics) configErr() string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.configError
+}
+
+// linkFired records that the link changed a post.
+func (d *diagnostics) linkFired(link autolink.Autolink) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.lastFired == nil {
+		d.lastFired = map[string]time.Time{}
+	}
+	if d.pending.LastFired == nil {
+		d.pending.LastFired = map[string]time.Time{}
+	}
+	now := time.Now()
+	d.lastFired[link.DisplayName()] = now
+	d.pending.LastFired[link.DisplayName()] = now
+}
+
+// linkTimed records the time the link took to process a message.
+func (d *diagnostics) linkTimed(name string, duration time.Duration) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.addDuration(name, duration)
+	if d.pending.Durations == nil {
+		d.pending.Durations = map[string][]time.Duration{}
+	}
+	pending := append(d.pending.Durations[name], duration)
+	if len(pending) > slowLinkSamples {
+		pending = pending[len(pending)-slowLinkSamples:]
+	}
+	d.pending.Durations[name] = pending
+}
+
+// addDuration adds a time the link took to the last ones. d.lock must be
+// held.
+func (d *diagnostics) addDuration(name string, duration time.Duration) {
+	if d.durations == nil {
+		d.durations = map[string]*linkDurations{}
+	}
+	ld := d.durations[name]
+	if ld == nil {
+		ld = &linkDurations{}
+		d.durations[name] = ld
+	}
+	if len(ld.samples) < slowLinkSamples {
+		ld.samples = append(ld.samples, duration)
+		return
+	}
+	ld.samples[ld.next] = duration
+	ld.next = (ld.next + 1) % slowLinkSamples
+}
+
+// takeStats returns the activity of the links since the last call, to share
+// it with the other servers, or nil if there was none.
+func (d *diagnostics) takeStats() *linkStats {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if len(d.pending.LastFired) == 0 && len(d.pending.Durations) == 0 {
+		return nil
+	}
+	stats := d.pending
+	d.pending = linkStats{}
+	return &stats
+}
+
+// mergeStats adds the activity of the links on another server.
+func (d *diagnostics) mergeStats(stats linkStats) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for name, at := range stats.LastFired {
+		if d.lastFired == nil {
+			d.lastFired = map[string]time.Time{}
+		}
+		if at.After(d.lastFired[name]) {
+			d.lastFired[name] = at
+		}
+	}
+	for name, durations := range stats.Durations {
+		for _, duration := range durations {
+			d.addDuration(name, duration)
+		}
+	}
+}
+
+// slowLinks returns the 95th percentile of the time of the links slower than
+// the threshold, by link name.
+func (d *diagnostics) slowLinks(threshold time.Duration) map[string]time.Duration {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	slow := map[string]time.Duration{}
+	for name, ld := range d.durations {
+		if len(ld.samples) < slowLinkMinSamples {
+			continue
+		}
+		sorted := append([]time.Duration{}, ld.samples...)
+		sort.Slice(sorted, func(a, b int) bool { return sorted[a] < sorted[b] })
+		if p95 := sorted[(len(sorted)-1)*95/100]; p95 > threshold {
+			slow[name] = p95
+		}
+	}
+	return slow
+}
+
+// forgetDurations forgets the times of a link that changed, for it to be
+// measured again.
+func (d *diagnostics) forgetDurations(name string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	delete(d.durations, name)
+	delete(d.pending.Durations, name)
+}
+
+func (d *diagnostics) scopeFailed(err error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.scopeFailures++
+	d.lastScopeFailure = err.Error()
+	d.lastScopeFailureAt = time.Now()
+}
+
+// Status reports the compile errors of the links, when they last changed a
+// post, the configuration and scope resolution errors, and the pause of
+// autolinking.
+func (p *Plugin) Status() api.Status {
+	conf := p.getConfig()
+	pausedUntil := p.PausedUntil()
+	d := &p.diagnostics
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	status := api.Status{
+		ConfigError:       d.configError,
+		ScopeFailures:     d.scopeFailures,
+		LastScopeFailure:  d.lastScopeFailure,
+		UnresolvedAdmins:  conf.unresolvedAdmins,
+		UnresolvedViewers: conf.unresolvedViewers,
+		Links:             make([]api.LinkStatus, 0, len(conf.Links)),
+	}
+	if !d.lastScopeFailureAt.IsZero() {
+		at := d.lastScopeFailureAt
+		status.LastScopeFailureAt = &at
+	}
+	if !pausedUntil.IsZero() {
+		status.PausedUntil = &pausedUntil
+	}
+
+	for i, link := range conf.Links {
+		linkStatus := api.LinkStatus{
+			Name:     link.DisplayName(),
+			Disabled: link.Disabled,
+		}
+		if i < len(conf.compileErrors) && conf.compileErrors[i] != nil {
+			linkStatus.CompileError = conf.compileErrors[i].Error()
+		}
+		if at, ok := d.lastFired[link.DisplayName()]; ok {
+			linkStatus.LastFiredAt = &at
+		}
+		status.Links = append(status.Links, linkStatus)
+	}
+	return status
+}
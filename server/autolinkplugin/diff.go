@@ -0,0 +1,277 @@
+package autolinkplugin
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+// maxDiffCells is the maximum size of the table used to diff the changed part
+// of an edited message. Larger edits are treated as replacing that part
+// entirely.
+const maxDiffCells = 1 << 20
+
+// textRange is a range of bytes of a message.
+type textRange struct {
+	start, end int
+}
+
+// messageEdit is the part of an edited message that was inserted by the
+// edit. Only that part is autolinked, for the changes users made to the rest
+// of the message, such as removing a link, to be kept. A nil messageEdit
+// stands for a new message, autolinked entirely.
+type messageEdit struct {
+	inserted []textRange
+
+	// skipped is set for the edits left as they are, but for the reject
+	// links, e.g. the edits made through the API with SkipAPIEdits
+	skipped bool
+}
+
+// newMessageEdit diffs the old and new messages of an edited post. The words
+// that are new or changed are inserted, so that a match is linked if any part
+// of it was typed by the edit.
+func newMessageEdit(oldMessage, newMessage string) *messageEdit {
+	oldTokens, newTokens := tokenize(oldMessage), tokenize(newMessage)
+
+	prefix := 0
+	for prefix < len(oldTokens) && prefix < len(newTokens) && oldTokens[prefix].text == newTokens[prefix].text {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(oldTokens)-prefix && suffix < len(newTokens)-prefix &&
+		oldTokens[len(oldTokens)-1-suffix].text == newTokens[len(newTokens)-1-suffix].text {
+		suffix++
+	}
+	oldTokens = oldTokens[prefix : len(oldTokens)-suffix]
+	newTokens = newTokens[prefix : len(newTokens)-suffix]
+
+	edit := &messageEdit{}
+	for _, i := range insertedTokens(oldTokens, newTokens) {
+		// Whitespace does not change what the words around it match
+		if strings.TrimSpace(newTokens[i].text) == "" {
+			continue
+		}
+		edit.add(wordAround(newMessage, newTokens[i].textRange))
+	}
+	return edit
+}
+
+// wholeMessageEdit is an edit inserting the whole message, for the edits
+// whose previous message is unknown.
+func wholeMessageEdit(message string) *messageEdit {
+	return &messageEdit{inserted: []textRange{{0, len(message)}}}
+}
+
+// add adds a range to the inserted ranges, merging it with the last one if
+// they overlap or touch.
+func (e *messageEdit) add(r textRange) {
+	if n := len(e.inserted); n > 0 && r.start <= e.inserted[n-1].end {
+		if r.end > e.inserted[n-1].end {
+			e.inserted[n-1].end = r.end
+		}
+		return
+	}
+	e.inserted = append(e.inserted, r)
+}
+
+// retain removes the occurrences of the texts in the message from the
+// inserted ranges, for the links to leave them as they are.
+func (e *messageEdit) retain(message string, texts []string) {
+	var retained []textRange
+	for _, text := range texts {
+		if text == "" {
+			continue
+		}
+		for from := 0; ; {
+			i := strings.Index(message[from:], text)
+			if i < 0 {
+				break
+			}
+			retained = append(retained, textRange{from + i, from + i + len(text)})
+			from += i + len(text)
+		}
+	}
+	if len(retained) == 0 {
+		return
+	}
+	sort.Slice(retained, func(i, j int) bool { return retained[i].start < retained[j].start })
+
+	inserted := e.inserted
+	e.inserted = nil
+	for _, r := range inserted {
+		for _, kept := range retained {
+			if kept.end <= r.start || kept.start >= r.end {
+				continue
+			}
+			if kept.start > r.start {
+				e.add(textRange{r.start, kept.start})
+			}
+			r.start = kept.end
+			if r.start >= r.end {
+				break
+			}
+		}
+		if r.start < r.end {
+			e.add(r)
+		}
+	}
+}
+
+// spans splits the text found at start in the message into spans, those that
+// were not inserted by the edit being marked as replaced to keep the links
+// from changing them.
+func (e *messageEdit) spans(text string, start int) []autolink.Span {
+	if e == nil {
+		return []autolink.Span{{Text: text}}
+	}
+
+	var spans []autolink.Span
+	addSpan := func(from, to int, retained bool) {
+		if from < to {
+			spans = append(spans, autolink.Span{Text: text[from:to], Replaced: retained})
+		}
+	}
+	end := start + len(text)
+	last := 0
+	for _, r := range e.inserted {
+		if r.end <= start || r.start >= end {
+			continue
+		}
+		from, to := r.start-start, r.end-start
+		if from < 0 {
+			from = 0
+		}
+		if to > len(text) {
+			to = len(text)
+		}
+		addSpan(last, from, true)
+		addSpan(from, to, false)
+		last = to
+	}
+	addSpan(last, len(text), true)
+	return spans
+}
+
+// insertedText returns the text of the spans that can still be changed by the
+// links, or the whole text for a new message.
+func (e *messageEdit) insertedText(text string, spans []autolink.Span) string {
+	if e == nil {
+		return text
+	}
+	inserted := ""
+	for _, span := range spans {
+		if !span.Replaced {
+			inserted += span.Text + "\n"
+		}
+	}
+	return inserted
+}
+
+// token is a word, a run of whitespace, or any other single character of a
+// message.
+type token struct {
+	textRange
+	text string
+}
+
+func tokenize(message string) []token {
+	var tokens []token
+	for start := 0; start < len(message); {
+		r, size := utf8.DecodeRuneInString(message[start:])
+		end := start + size
+		switch {
+		case isWordRune(r):
+			for end < len(message) {
+				r, size := utf8.DecodeRuneInString(message[end:])
+				if !isWordRune(r) {
+					break
+				}
+				end += size
+			}
+		case unicode.IsSpace(r):
+			for end < len(message) {
+				r, size := utf8.DecodeRuneInString(message[end:])
+				if !unicode.IsSpace(r) {
+					break
+				}
+				end += size
+			}
+		}
+		tokens = append(tokens, token{textRange{start, end}, message[start:end]})
+		start = end
+	}
+	return tokens
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// insertedTokens returns the indexes of the new tokens that are not part of
+// the longest common subsequence of the old and new tokens.
+func insertedTokens(oldTokens, newTokens []token) []int {
+	var inserted []int
+	if len(oldTokens) == 0 || len(newTokens) == 0 || (len(oldTokens)+1)*(len(newTokens)+1) > maxDiffCells {
+		for i := range newTokens {
+			inserted = append(inserted, i)
+		}
+		return inserted
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of
+	// oldTokens[i:] and newTokens[j:]
+	width := len(newTokens) + 1
+	lcs := make([]int32, (len(oldTokens)+1)*width)
+	for i := len(oldTokens) - 1; i >= 0; i-- {
+		for j := len(newTokens) - 1; j >= 0; j-- {
+			switch {
+			case oldTokens[i].text == newTokens[j].text:
+				lcs[i*width+j] = lcs[(i+1)*width+j+1] + 1
+			case lcs[(i+1)*width+j] >= lcs[i*width+j+1]:
+				lcs[i*width+j] = lcs[(i+1)*width+j]
+			default:
+				lcs[i*width+j] = lcs[i*width+j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for j < len(newTokens) {
+		switch {
+		case i < len(oldTokens) && oldTokens[i].text == newTokens[j].text:
+			i++
+			j++
+		case i < len(oldTokens) && lcs[(i+1)*width+j] >= lcs[i*width+j+1]:
+			i++
+		default:
+			inserted = append(inserted, j)
+			j++
+		}
+	}
+	return inserted
+}
+
+// wordAround extends the range to the whitespace around it, for matches
+// extending past the inserted characters, e.g. when a digit is added to an
+// issue number, to be linked.
+func wordAround(message string, r textRange) textRange {
+	for r.start > 0 {
+		c, size := utf8.DecodeLastRuneInString(message[:r.start])
+		if unicode.IsSpace(c) {
+			break
+		}
+		r.start -= size
+	}
+	for r.end < len(message) {
+		c, size := utf8.DecodeRuneInString(message[r.end:])
+		if unicode.IsSpace(c) {
+			break
+		}
+		r.end += size
+	}
+	return r
+}
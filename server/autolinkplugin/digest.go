@@ -0,0 +1,211 @@
+package autolinkplugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	// digestKey is the KV store key of the admin digest: when it was last
+	// sent and the events to report in the next one, for every server of a
+	// cluster to add its events and one of them to send it.
+	digestKey = "admin_digest"
+
+	// digestAttempts is the number of attempts to save the digest when
+	// another server changes it meanwhile.
+	digestAttempts = 3
+
+	// digestTopLinks is the number of links listed in the activity of the
+	// digest, most active first.
+	digestTopLinks = 5
+)
+
+// Config.AdminDigest values sending the admins a digest once a day or once a
+// week instead of a message for each event
+const (
+	adminDigestDaily  = "daily"
+	adminDigestWeekly = "weekly"
+)
+
+// adminDigest is the digest saved in the KV store.
+type adminDigest struct {
+	SentAt time.Time `json:"sent_at"`
+	Events []string  `json:"events,omitempty"`
+}
+
+// digestPeriod returns how often the digest is sent, or 0 if the admins are
+// sent a message for each event.
+func (c *Config) digestPeriod() time.Duration {
+	switch c.AdminDigest {
+	case adminDigestDaily:
+		return 24 * time.Hour
+	case adminDigestWeekly:
+		return 7 * 24 * time.Hour
+	}
+	return 0
+}
+
+// notifyAdminsOrDigest sends the admins a direct message listing the events,
+// or adds them to the next digest when the admins are sent a digest.
+func (p *Plugin) notifyAdminsOrDigest(messageID, list string) bool {
+	if p.getConfig().digestPeriod() == 0 {
+		return p.notifyAdmins(messageID, list)
+	}
+	err := p.updateDigest(func(digest *adminDigest) bool {
+		digest.Events = append(digest.Events, list)
+		return true
+	})
+	if err != nil {
+		p.API.LogError("Failed to add the events to the admin digest", "error", err.Error())
+		return false
+	}
+	return true
+}
+
+// sendDigest sends the admins the digest once the period of the digest
+// elapsed since the last one: the events since then, the links expiring
+// before the next one, and the posts the links changed since then.
+func (p *Plugin) sendDigest(now time.Time) {
+	conf := p.getConfig()
+	period := conf.digestPeriod()
+	if period == 0 {
+		return
+	}
+
+	var events []string
+	var since time.Time
+	send := false
+	err := p.updateDigest(func(digest *adminDigest) bool {
+		// The first digest is sent a period after it was enabled
+		if digest.SentAt.IsZero() {
+			digest.SentAt, send = now, false
+			return true
+		}
+		if now.Sub(digest.SentAt) < period {
+			return false
+		}
+		events, since, send = digest.Events, digest.SentAt, true
+		*digest = adminDigest{SentAt: now}
+		return true
+	})
+	if err != nil {
+		p.API.LogError("Failed to save the admin digest", "error", err.Error())
+		return
+	}
+	if !send {
+		return
+	}
+
+	reported := ""
+	for _, list := range events {
+		reported += list
+	}
+	if reported == "" {
+		reported = "- None\n"
+	}
+
+	messageID := "autolink.digest.daily"
+	if conf.AdminDigest == adminDigestWeekly {
+		messageID = "autolink.digest.weekly"
+	}
+	p.notifyAdmins(messageID, reported, p.digestExpiringLinks(now, period), p.digestActivity(since, now))
+}
+
+// digestExpiringLinks lists the links expiring before the next digest.
+func (p *Plugin) digestExpiringLinks(now time.Time, period time.Duration) string {
+	list := ""
+	for _, link := range p.GetLinks() {
+		if link.ExpiresAt == "" || link.IsExpired(now) || !link.IsExpired(now.Add(period)) {
+			continue
+		}
+		list += fmt.Sprintf("- `%s` expires at %s\n", link.DisplayName(), link.ExpiresAt)
+	}
+	if list == "" {
+		return "- None\n"
+	}
+	return list
+}
+
+// digestActivity summarizes the posts the links changed since the last digest,
+// counted by day, the most active links first.
+func (p *Plugin) digestActivity(since, now time.Time) string {
+	stats, err := p.UsageStats(since.UTC().Truncate(24*time.Hour), now.UTC().Truncate(24*time.Hour))
+	if err != nil {
+		p.API.LogWarn("Failed to load the activity of the links for the admin digest", "error", err.Error())
+		return "- The activity of the links could not be loaded\n"
+	}
+	posts := map[string]int{}
+	total := 0
+	for _, stat := range stats {
+		posts[stat.Link] += stat.Posts
+		total += stat.Posts
+	}
+	names := make([]string, 0, len(posts))
+	for name := range posts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if posts[names[i]] != posts[names[j]] {
+			return posts[names[i]] > posts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	unused := 0
+	for _, link := range p.GetLinks() {
+		if !link.Disabled && !link.IsExpired(now) && posts[link.DisplayName()] == 0 {
+			unused++
+		}
+	}
+
+	list := fmt.Sprintf("- The links changed %d post(s), %d enabled link(s) changed none\n", total, unused)
+	if len(names) > digestTopLinks {
+		names = names[:digestTopLinks]
+	}
+	for _, name := range names {
+		list += fmt.Sprintf("  - `%s`: %d post(s)\n", name, posts[name])
+	}
+	return list
+}
+
+// updateDigest changes the digest saved in the KV store, retrying when
+// another server changed it meanwhile. The digest is left as is if update
+// returns false.
+func (p *Plugin) updateDigest(update func(*adminDigest) bool) error {
+	for attempt := 0; attempt < digestAttempts; attempt++ {
+		oldValue, appErr := p.API.KVGet(digestKey)
+		if appErr != nil {
+			return errors.Wrap(appErr, "failed to load the admin digest")
+		}
+		digest := adminDigest{}
+		if oldValue != nil {
+			if err := json.Unmarshal(oldValue, &digest); err != nil {
+				return errors.Wrap(err, "failed to decode the admin digest")
+			}
+		}
+		if !update(&digest) {
+			return nil
+		}
+
+		value, err := json.Marshal(digest)
+		if err != nil {
+			return errors.Wrap(err, "failed to encode the admin digest")
+		}
+		saved, appErr := p.API.KVSetWithOptions(digestKey, value, model.PluginKVSetOptions{
+			Atomic:   true,
+			OldValue: oldValue,
+		})
+		if appErr != nil {
+			return errors.Wrap(appErr, "failed to save the admin digest")
+		}
+		if saved {
+			return nil
+		}
+	}
+	return errors.New("the admin digest kept changing")
+}
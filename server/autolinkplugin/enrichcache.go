@@ -0,0 +1,53 @@
+package autolinkplugin
+
+import (
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+	"github.com/mattermost/mattermost-plugin-autolink/server/enrich"
+)
+
+// linkEnrichCaches are the caches of the enrichments of the links with an
+// EnrichTTL, by link name, enrichment and TTL. A link keeps its cache across
+// configuration changes, e.g. when the Jira credentials change, as long as
+// these do not change.
+type linkEnrichCaches struct {
+	previous map[string]*enrich.Cache
+	kept     map[string]*enrich.Cache
+}
+
+// newLinkEnrichCaches returns the caches of the links, starting from those of
+// the previous configuration.
+func (p *Plugin) newLinkEnrichCaches() *linkEnrichCaches {
+	p.enrichCachesLock.Lock()
+	defer p.enrichCachesLock.Unlock()
+
+	return &linkEnrichCaches{previous: p.enrichCaches, kept: map[string]*enrich.Cache{}}
+}
+
+// get returns the cache of the enrichments of the link, or nil if it has no
+// EnrichTTL.
+func (c *linkEnrichCaches) get(link autolink.Autolink) *enrich.Cache {
+	ttl := link.EnrichCacheTTL()
+	if ttl == 0 {
+		return nil
+	}
+	key := link.DisplayName() + "\n" + link.Enrich + "\n" + ttl.String()
+	cache := c.kept[key]
+	if cache == nil {
+		cache = c.previous[key]
+	}
+	if cache == nil {
+		// The failures are not cached by the link, see enrich.Cached
+		cache = enrich.NewCache(ttl, 0)
+	}
+	c.kept[key] = cache
+	return cache
+}
+
+// setEnrichCaches sets the caches of the links of the configuration, the
+// caches of the links that changed being dropped.
+func (p *Plugin) setEnrichCaches(caches map[string]*enrich.Cache) {
+	p.enrichCachesLock.Lock()
+	defer p.enrichCachesLock.Unlock()
+
+	p.enrichCaches = caches
+}
@@ -0,0 +1,89 @@
+package autolinkplugin
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+)
+
+// postTypeExclusionPrefix prefixes the exclusions of the posts of a type, e.g.
+// `type:custom_deploy`.
+const postTypeExclusionPrefix = "type:"
+
+// postExclusion is a rule exempting the posts it matches from being
+// autolinked: the posts of a type, those with a prop set, or those with a prop
+// of a value.
+type postExclusion struct {
+	postType string
+	prop     string
+	value    string
+	hasValue bool
+}
+
+// parsePostExclusions parses the exclusions of posts, one per line:
+// `type:<post type>`, `<prop>` for the posts with the prop set, or
+// `<prop>=<value>` for the posts with the prop of the value. Empty lines and
+// lines starting with `#` are ignored.
+func parsePostExclusions(s string) ([]postExclusion, error) {
+	var exclusions []postExclusion
+	scanner := bufio.NewScanner(strings.NewReader(s))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var exclusion postExclusion
+		if strings.HasPrefix(line, postTypeExclusionPrefix) {
+			exclusion.postType = strings.TrimSpace(strings.TrimPrefix(line, postTypeExclusionPrefix))
+			if exclusion.postType == "" {
+				return nil, errors.Errorf("invalid post exclusion %q, the post type is missing", line)
+			}
+			exclusions = append(exclusions, exclusion)
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		exclusion.prop = strings.TrimSpace(parts[0])
+		if exclusion.prop == "" {
+			return nil, errors.Errorf("invalid post exclusion %q, the prop name is missing", line)
+		}
+		if len(parts) == 2 {
+			exclusion.value = strings.TrimSpace(parts[1])
+			exclusion.hasValue = true
+		}
+		exclusions = append(exclusions, exclusion)
+	}
+	return exclusions, scanner.Err()
+}
+
+// matches reports whether the exclusion applies to the post.
+func (e postExclusion) matches(post *model.Post) bool {
+	if e.postType != "" {
+		return post.Type == e.postType
+	}
+	value := post.GetProp(e.prop)
+	if value == nil {
+		return false
+	}
+	// The props of the posts created through the REST API are often strings,
+	// e.g. "true" for from_webhook
+	text := fmt.Sprint(value)
+	if e.hasValue {
+		return text == e.value
+	}
+	return text != "" && text != "false"
+}
+
+// isExcludedPost reports whether one of the exclusions of the configuration
+// applies to the post.
+func isExcludedPost(post *model.Post, conf *Config) bool {
+	for _, exclusion := range conf.postExclusions {
+		if exclusion.matches(post) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package autolinkplugin
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+// notifyExpiredLinks sends the plugin admins a direct message listing the
+// links that expired since the last check, suggesting to delete them, or adds
+// them to the admin digest. Each expiry is only reported once, unless
+// ExpiresAt is changed.
+func (p *Plugin) notifyExpiredLinks(now time.Time) {
+	links := append([]autolink.Autolink{}, p.GetLinks()...)
+	list := ""
+	var expired []int
+	for i, link := range links {
+		if link.ExpiresAt == "" || link.ExpiryNotified == link.ExpiresAt || !link.IsExpired(now) {
+			continue
+		}
+		list += fmt.Sprintf("- `%s` (expired at %s)\n", link.DisplayName(), link.ExpiresAt)
+		expired = append(expired, i)
+	}
+	if len(expired) == 0 {
+		return
+	}
+
+	if !p.notifyAdminsOrDigest("autolink.expiry.notification", list) {
+		return
+	}
+
+	for _, i := range expired {
+		links[i].ExpiryNotified = links[i].ExpiresAt
+	}
+	if err := p.SaveLinks(links); err != nil {
+		p.API.LogError("Failed to save the expired links notification", "error", err.Error())
+	}
+}
@@ -0,0 +1,105 @@
+package autolinkplugin
+
+import (
+	"encoding/json"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin"
+	"github.com/pkg/errors"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+// exportFileName is the name of the file `/autolink export` sends.
+const exportFileName = "autolink-links.json"
+
+// exportLinks returns the links to export, as a JSON list ready to be added
+// to the Links of another server's configuration. The links owned by other
+// plugins are left out, since these plugins manage them, and the debug logging
+// of the links is not exported.
+func exportLinks(links []autolink.Autolink) ([]byte, int, error) {
+	exported := []autolink.Autolink{}
+	for _, link := range links {
+		if link.PluginID != "" {
+			continue
+		}
+		link.Debug = false
+		exported = append(exported, link)
+	}
+	data, err := json.MarshalIndent(exported, "", "  ")
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to encode the links")
+	}
+	return data, len(exported), nil
+}
+
+// executeExport sends the user the links passing the filters of the list, as
+// a JSON file in a direct message from the plugin bot.
+func executeExport(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	args, opts, err := parseListOptions(header, args)
+	if err != nil {
+		return responsef("%v", err)
+	}
+	if len(args) != 0 || opts.page != 1 || opts.format != listFormatDefault || opts.post || opts.stats {
+		return responsef(header.T("autolink.command.help"))
+	}
+
+	links, refs, err := searchLinkRef(p, header, false)
+	if err != nil {
+		return responsef("%v", err)
+	}
+	if refs == nil {
+		refs = make([]int, len(links))
+		for i := range links {
+			refs[i] = i
+		}
+	}
+	var matching []autolink.Autolink
+	for _, i := range refs {
+		if opts.matches(links[i]) {
+			matching = append(matching, links[i])
+		}
+	}
+
+	if isAdmin, _ := p.IsAuthorizedAdmin(header.UserId); !isAdmin {
+		matching = autolink.WithoutWebhooks(matching)
+	}
+	data, n, err := exportLinks(matching)
+	if err != nil {
+		return responsef(header.T("autolink.command.export.failed"), err)
+	}
+	if n == 0 {
+		return responsef(header.T("autolink.command.list.empty"))
+	}
+	if err = p.sendExport(header.UserId, data); err != nil {
+		return responsef(header.T("autolink.command.export.failed"), err)
+	}
+	p.API.LogInfo("Links exported", "links", n, "scope", opts.scope, "group", opts.group, "tag", opts.tag, "user_id", header.UserId)
+	return responsef(header.T("autolink.command.export.sent"), n)
+}
+
+// sendExport sends the exported links to the user, as a file in a direct
+// message from the plugin bot.
+func (p *Plugin) sendExport(userID string, data []byte) error {
+	botUserID, err := p.ensureBot()
+	if err != nil {
+		return err
+	}
+	channel, appErr := p.API.GetDirectChannel(botUserID, userID)
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to get the direct channel")
+	}
+	info, appErr := p.API.UploadFile(data, channel.Id, exportFileName)
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to upload the file")
+	}
+	_, appErr = p.API.CreatePost(&model.Post{
+		UserId:    botUserID,
+		ChannelId: channel.Id,
+		FileIds:   model.StringArray{info.Id},
+	})
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to send the file")
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package autolinkplugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+const (
+	// failuresKey is the KV store key of the failures the admins were
+	// notified about, for every server of a cluster to notify them once.
+	failuresKey = "notified_failures"
+
+	// failureCheckInterval is how often failures are checked for.
+	failureCheckInterval = 5 * time.Minute
+
+	// scopeFailureThreshold is the number of scope resolution failures
+	// between two checks for the admins to be notified.
+	scopeFailureThreshold = 10
+)
+
+// notifyFailures sends the plugin admins a direct message about the links that
+// do not compile, the configuration that cannot be loaded, the plugin admins
+// that are not active users, and scope resolution failing repeatedly, or adds them to the admin digest. Compile and
+// configuration errors are only reported once, until they are fixed.
+func (p *Plugin) notifyFailures() {
+	conf := p.getConfig()
+	d := &p.diagnostics
+
+	failures := map[string]string{}
+	for i, err := range conf.compileErrors {
+		if err != nil && i < len(conf.Links) {
+			failures["compile:"+conf.Links[i].DisplayName()+":"+err.Error()] =
+				fmt.Sprintf("- Link `%s` does not compile: %s\n", conf.Links[i].DisplayName(), err.Error())
+		}
+	}
+	for _, entry := range conf.unresolvedAdmins {
+		failures["admin:"+entry] = fmt.Sprintf("- Plugin admin `%s` is not an active user, and can not manage the links\n", entry)
+	}
+	for _, entry := range conf.unresolvedViewers {
+		failures["viewer:"+entry] = fmt.Sprintf("- Plugin viewer `%s` is not an active user, and can not view the links\n", entry)
+	}
+	for key, failure := range p.checkSlowLinks(conf) {
+		failures[key] = failure
+	}
+	d.lock.Lock()
+	if d.configError != "" {
+		failures["config:"+d.configError] = fmt.Sprintf("- The configuration could not be loaded: %s\n", d.configError)
+	}
+	scopeFailures := d.scopeFailures - d.scopeFailuresNotified
+	lastScopeFailure := d.lastScopeFailure
+	d.scopeFailuresNotified = d.scopeFailures
+	d.lock.Unlock()
+
+	var notified map[string]bool
+	oldValue, appErr := p.API.KVGet(failuresKey)
+	if appErr != nil {
+		p.API.LogError("Failed to load the notified failures", "error", appErr.Error())
+		return
+	}
+	if oldValue != nil {
+		if err := json.Unmarshal(oldValue, &notified); err != nil {
+			p.API.LogWarn("Failed to decode the notified failures", "error", err.Error())
+		}
+	}
+
+	var keys []string
+	current := map[string]bool{}
+	for key := range failures {
+		current[key] = true
+		if !notified[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	list := ""
+	for _, key := range keys {
+		list += failures[key]
+	}
+	scopeList := ""
+	if scopeFailures >= scopeFailureThreshold {
+		scopeList = fmt.Sprintf("- Scoped links could not resolve their channel or team %d times, last: %s\n", scopeFailures, lastScopeFailure)
+	}
+
+	// Fixed failures are forgotten, to be reported again if they come back.
+	// Only the server that records the new failures reports them, while
+	// scope failures are counted and reported by each server.
+	if len(current) != len(notified) || len(keys) > 0 {
+		value, err := json.Marshal(current)
+		if err != nil {
+			p.API.LogError("Failed to encode the notified failures", "error", err.Error())
+			return
+		}
+		saved, appErr := p.API.KVSetWithOptions(failuresKey, value, model.PluginKVSetOptions{
+			Atomic:   true,
+			OldValue: oldValue,
+		})
+		if appErr != nil {
+			p.API.LogError("Failed to save the notified failures", "error", appErr.Error())
+			return
+		}
+		if !saved {
+			list = ""
+		}
+	}
+
+	if list+scopeList != "" {
+		p.notifyAdminsOrDigest("autolink.failures.notification", list+scopeList)
+	}
+}
+
+// checkSlowLinks returns the failures of the links slower than the slow link
+// threshold, which are also disabled if the plugin is configured to.
+func (p *Plugin) checkSlowLinks(conf *Config) map[string]string {
+	failures := map[string]string{}
+	if conf.SlowLinkThreshold <= 0 {
+		return failures
+	}
+	slow := p.diagnostics.slowLinks(time.Duration(conf.SlowLinkThreshold) * time.Millisecond)
+	if len(slow) == 0 {
+		return failures
+	}
+
+	disabled := map[string]bool{}
+	if conf.DisableSlowLinks {
+		disabled = p.disableLinks(slow)
+	}
+	for name, p95 := range slow {
+		p.API.LogWarn("Slow link",
+			"link", name,
+			"p95_ms", float64(p95)/float64(time.Millisecond),
+			"threshold_ms", conf.SlowLinkThreshold,
+			"disabled", disabled[name])
+		failure := fmt.Sprintf("- Link `%s` takes %v to process a message, at the 95th percentile\n", name, p95.Round(time.Microsecond))
+		if disabled[name] {
+			failure = fmt.Sprintf("- Link `%s` took %v to process a message, at the 95th percentile, and was disabled\n", name, p95.Round(time.Microsecond))
+		}
+		failures["slow:"+name] = failure
+	}
+	return failures
+}
+
+// disableLinks disables the enabled links with the given names, and returns
+// the names of the links it disabled.
+func (p *Plugin) disableLinks(names map[string]time.Duration) map[string]bool {
+	disabled := map[string]bool{}
+	links := append([]autolink.Autolink{}, p.GetLinks()...)
+	for i := range links {
+		if _, ok := names[links[i].DisplayName()]; ok && !links[i].Disabled {
+			links[i].Disabled = true
+			disabled[links[i].DisplayName()] = true
+		}
+	}
+	if len(disabled) == 0 {
+		return disabled
+	}
+	if err := p.SaveLinks(links); err != nil {
+		p.API.LogError("Failed to disable the slow links", "error", err.Error())
+		return map[string]bool{}
+	}
+	return disabled
+}
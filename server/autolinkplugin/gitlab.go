@@ -0,0 +1,54 @@
+package autolinkplugin
+
+import (
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+	"github.com/mattermost/mattermost-plugin-autolink/server/importer"
+)
+
+// ImportGitLab converts the issue and merge request references of a GitLab
+// group or project into links, using the GitLab settings of the plugin.
+func (p *Plugin) ImportGitLab(target string) ([]autolink.Autolink, error) {
+	conf := p.getConfig()
+	return importer.NewGitLab(conf.GitLabAPIURL, conf.GitLabToken).Import(target)
+}
+
+func executeImportGitLab(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) != 1 {
+		return responsef(header.T("autolink.command.help"))
+	}
+
+	filter, err := linkFilter(p, header)
+	if err != nil {
+		return responsef("%v", err)
+	}
+	if filter != nil {
+		return responsef(header.T("autolink.command.import_github.not_authorized"))
+	}
+
+	imported, err := p.ImportGitLab(args[0])
+	if err != nil {
+		return responsef(header.T("autolink.command.import_gitlab.failed"), err)
+	}
+	if len(imported) == 0 {
+		return responsef(header.T("autolink.command.import_gitlab.not_found"), args[0])
+	}
+
+	links, added, updated := importer.Merge(p.GetLinks(), imported)
+	text := ""
+	for _, name := range added {
+		text += header.T("autolink.command.import_github.added", name)
+	}
+	for _, name := range updated {
+		text += header.T("autolink.command.import_github.updated", name)
+	}
+
+	err = p.SaveLinks(links)
+	if err != nil {
+		return responsef(err.Error())
+	}
+
+	return responsef(header.T("autolink.command.import_gitlab.imported"), len(imported), text)
+}
@@ -0,0 +1,486 @@
+package autolinkplugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v6/shared/i18n"
+	"github.com/pkg/errors"
+)
+
+// i18nDir is the directory of the plugin bundle holding the translation
+// files, one `<locale>.json` file per locale mapping message IDs to text.
+const i18nDir = "assets/i18n"
+
+const defaultLocale = "en"
+
+// defaultMessages holds the English text of every message, used when there is
+// no translation for the locale. Messages are fmt format strings.
+var defaultMessages = map[string]string{
+	"autolink.command.help":             helpText,
+	"autolink.command.not_authorized":   "`/autolink` commands can only be executed by a system administrator or `autolink` plugin admins.",
+	"autolink.command.authorize_failed": "error occurred while authorizing the command: %v",
+
+	"autolink.command.ref.invalid_number":        "%v is not a valid link number",
+	"autolink.command.ref.not_found":             "%q not found",
+	"autolink.command.ref.not_found_suggestions": "%q not found, did you mean: %s?",
+	"autolink.command.ref.ambiguous":             "%q matched more than one link: %q",
+
+	"autolink.command.list.empty":                   "No links found.",
+	"autolink.command.list.invalid_page":            "%q is not a valid page number",
+	"autolink.command.list.invalid_format":          "%q is not a valid format, must be default, markdown or json",
+	"autolink.command.list.activity":                "  - Matches: %d post(s) in the last 7 days, %d in the last 30 days%s\n",
+	"autolink.command.list.activity.last":           ", last at %s",
+	"autolink.command.list.activity.unused":         "  - Matches: **none** in the last 30 days\n",
+	"autolink.command.list.page":                    "\nPage %d of %d, %d links. Use `/autolink list ... --page <n>` to see other pages, or `--scope`, `--group`, `--tag`, `--enabled` or `--disabled` to filter them.",
+	"autolink.command.delete.removed":               "removed: \n%v",
+	"autolink.command.delete.confirm":               "Delete this link? Run the command with `--confirm` to skip this step.\n%s",
+	"autolink.command.confirm.apply":                "Apply",
+	"autolink.command.confirm.cancel":               "Cancel",
+	"autolink.command.confirm.cancelled":            "Cancelled, nothing was changed.",
+	"autolink.command.confirm.changed":              "The links changed since the command was run, nothing was changed. Run the command again.",
+	"autolink.command.set.not_bool":                 "Not a bool, %q",
+	"autolink.command.set.not_count":                "Not a positive number or 0, %q",
+	"autolink.command.set.unsupported_threads":      "%q is not a supported Threads value, must be one of %q",
+	"autolink.command.set.unsupported_engine":       "%q is not a supported Engine, must be one of %q",
+	"autolink.command.set.unsupported_kind":         "%q is not a supported Kind, must be one of %q",
+	"autolink.command.set.unsupported_style":        "%q is not a supported Style, must be one of %q",
+	"autolink.command.set.invalid_repositories":     "Repositories must be whitespace-separated `scope=url` pairs, the scope being `team/channel`, `team` or `*`: %v",
+	"autolink.command.set.invalid_enrich_ttl":       "Invalid EnrichTTL: %v",
+	"autolink.command.set.invalid_fallback":         "Invalid FallbackTemplate: %v",
+	"autolink.command.set.unsupported_enrichment":   "%q is not a supported enrichment, must be one of %q",
+	"autolink.command.set.unsupported_field":        "%q is not a supported field, must be one of %q",
+	"autolink.command.set.team_admin_scope":         "Team admins can only scope links to the teams they administer.",
+	"autolink.command.set.invalid_filter":           "Invalid filter %q, must be `<field>=<pattern>` where <field> is name, pattern, template, scope or group",
+	"autolink.command.set.bulk_dry_run":             "Would update %d link(s):\n%s",
+	"autolink.command.set.bulk_updated":             "Updated %d link(s):\n%s",
+	"autolink.command.set.bulk_confirm":             "Update %d link(s)? Run the command with `--confirm` to skip this step.\n%s",
+	"autolink.command.set.invalid_schedule":         "Invalid time window or schedule: %v",
+	"autolink.command.set.invalid_webhook":          "Invalid webhook: %v",
+	"autolink.command.set.webhook_not_authorized":   "Only system administrators and `autolink` plugin admins can set the WebhookURL of a link.",
+	"autolink.command.set.webhook_not_allowed":      "The webhook %q is neither the Webhook URL of the plugin settings nor on one of the allowed webhook hosts.",
+	"autolink.command.set.invalid_mentions":         "Mentions must be whitespace-separated `value=@username` or `value=~channel` pairs: %v",
+	"autolink.command.set.invalid_attachment":       "Attachment must be a JSON `{\"Title\": ..., \"TitleLink\": ..., \"Text\": ..., \"Color\": ..., \"Fields\": [{\"Title\": ..., \"Value\": ..., \"Short\": ...}]}` object: %v",
+	"autolink.command.set.invalid_cases":            "Cases must be a JSON list of `{\"Group\": ..., \"Value\": ..., \"Template\": ...}` objects: %v",
+	"autolink.command.set.invalid_locale_templates": "LocaleTemplates must be a JSON object of templates by locale, e.g. `{\"es\": ...}`: %v",
+	"autolink.command.set.invalid_scope_templates":  "ScopeTemplates must be a JSON object of templates by scope, e.g. `{\"team/channel\": ...}`: %v",
+	"autolink.command.test.compile_failed":          "failed to compile link %s: %v",
+	"autolink.command.test.original":                "- Original: `%s`\n",
+	"autolink.command.test.no_change":               "- Link %s: _no change_\n",
+	"autolink.command.test.changed":                 "- Link %s: changed to `%s`\n",
+	"autolink.command.test.invalid_last":            "%q is not a valid number of posts, must be between 1 and %d",
+	"autolink.command.test.posts_failed":            "failed to get the channel posts: %v",
+	"autolink.command.test.posts_summary":           "%d of the last %d posts would be changed:\n",
+	"autolink.command.test.post_changed":            "- `%s`\n  - changed to `%s` by %s\n",
+	"autolink.command.test_all.channel_failed":      "failed to get the current channel: %v",
+	"autolink.command.test_all.changed":             "%d. Link %s: changed to `%s`\n",
+	"autolink.command.test_all.rejected":            "%d. Link %s: rejects the message: %s\n",
+	"autolink.command.test_all.summary":             "\n%d of the %d links applying to this channel matched.",
+	"autolink.command.test_all.no_match":            "None of the %d links applying to this channel matches the text.",
+	"autolink.command.benchmark.no_links":           "No links to benchmark.",
+	"autolink.command.benchmark.summary":            "Ran %d link(s) against %d messages, %d time(s):\n\n",
+	"autolink.command.benchmark.slow":               "\nLinks at least %d times slower than the median: %s\n",
+	"autolink.command.benchmark.failed":             "\nLinks that do not compile: %s\n",
+	"autolink.command.selftest.config":              "Configuration",
+	"autolink.command.selftest.config_loaded":       "loaded, %d link(s)",
+	"autolink.command.selftest.links":               "Links",
+	"autolink.command.selftest.links_compiled":      "the %d enabled link(s) compile",
+	"autolink.command.selftest.links_failed":        "links that do not compile: %s",
+	"autolink.command.selftest.scope":               "Scope resolution",
+	"autolink.command.selftest.scope_resolved":      "this channel is `%s/%s`",
+	"autolink.command.selftest.rewrite":             "Post rewrite",
+	"autolink.command.selftest.rewrite_done":        "a test link rewrote a test post",
+	"autolink.command.selftest.rewrite_failed":      "expected `%s`, got `%s`",
+	"autolink.command.selftest.kv":                  "KV store",
+	"autolink.command.selftest.kv_done":             "wrote, read and deleted a test value",
+	"autolink.command.selftest.passed":              "- :white_check_mark: %s: %s\n",
+	"autolink.command.selftest.failed":              "- :x: %s: %v\n",
+	"autolink.command.selftest.all_passed":          "\nAll the stages passed.",
+	"autolink.command.selftest.summary":             "\n%d of the %d stages failed.",
+	"autolink.command.lint.no_issues":               "No issues found.",
+	"autolink.command.lint.issues":                  "Found %d issue(s):\n",
+	"autolink.command.manage.title":                 "###### Autolink links",
+	"autolink.command.manage.enable":                "Enable",
+	"autolink.command.manage.disable":               "Disable",
+	"autolink.command.manage.edit":                  "Edit",
+	"autolink.command.manage.delete":                "Delete",
+	"autolink.command.manage.previous":              "Previous",
+	"autolink.command.manage.next":                  "Next",
+	"autolink.command.manage.page":                  "Page %d of %d, %d link(s)",
+	"autolink.command.manage.changed":               "The links changed since this message was posted, nothing was changed.",
+	"autolink.command.manage.edit_title":            "Edit %s",
+	"autolink.command.manage.save":                  "Save",
+	"autolink.command.manage.scope_help":            "Teams or team/channel pairs, separated by spaces",
+	"autolink.command.manage.updated":               "Updated the link:\n%s",
+	"autolink.command.setup.failed":                 "failed to start the setup: %v",
+	"autolink.command.setup.title":                  "Set up a link",
+	"autolink.command.setup.next":                   "Next",
+	"autolink.command.setup.create":                 "Create",
+	"autolink.command.setup.continue":               "Continue",
+	"autolink.command.setup.back":                   "Back",
+	"autolink.command.setup.required":               "This field is required.",
+	"autolink.command.setup.custom":                 "Custom pattern and template",
+	"autolink.command.setup.kind":                   "Kind",
+	"autolink.command.setup.kind_intro":             "Name the link, and choose a preset for a common service or write your own pattern.",
+	"autolink.command.setup.kind_done":              "Setting up the link **%s**. Continue to enter what it links.",
+	"autolink.command.setup.pattern_intro":          "Enter what the link matches and what it turns it into. Add a sample text to check that the link matches it.",
+	"autolink.command.setup.pattern_help":           "Regular expression, with named groups like `(?P<id>\\d+)` to use in the template",
+	"autolink.command.setup.template_help":          "Markdown the matches are replaced with, using the groups like `${id}`",
+	"autolink.command.setup.sample":                 "Sample text",
+	"autolink.command.setup.sample_help":            "A message the link should change",
+	"autolink.command.setup.no_match":               "The link does not change this text, check the pattern.",
+	"autolink.command.setup.pattern_done":           "The link compiles:\n%s",
+	"autolink.command.setup.sample_done":            "The sample text becomes:\n%s\n",
+	"autolink.command.setup.scope_intro":            "Choose where the link applies, everywhere by default.",
+	"autolink.command.setup.created":                "Created the link:\n%s",
+	"autolink.command.add.team_failed":              "failed to get the current team: %v",
+
+	"autolink.command.add_preset.presets":   "Available presets:\n",
+	"autolink.command.add_preset.not_found": "%q is not a preset, run `/autolink add-preset` for the list of presets.",
+	"autolink.command.add_preset.exists":    "A link named %q already exists, use `--name` to choose another name.",
+
+	"autolink.command.accept_suggestion.not_authorized": "Only system administrators and `autolink` plugin admins can accept suggested links.",
+	"autolink.command.accept_suggestion.failed":         "failed to load the suggested links: %v",
+	"autolink.command.accept_suggestion.not_found":      "No suggested link %q.",
+	"autolink.command.accept_suggestion.accepted":       "Added the suggested link:\n%s",
+	"autolink.command.reload.not_authorized":            "Only system administrators and `autolink` plugin admins can reload the configuration.",
+	"autolink.command.reload.failed":                    "failed to reload the configuration: %v",
+	"autolink.command.reload.reloaded":                  "Reloaded the configuration, %d of the %d link(s) compile.",
+	"autolink.command.reload.compile_error":             "\n- `%s`: %s",
+	"autolink.command.pause.not_authorized":             "Only system administrators and `autolink` plugin admins can pause autolinking.",
+	"autolink.command.pause.invalid_duration":           "%q is not a valid duration, must be like `30m` or `2h`, and at most %v.",
+	"autolink.command.pause.failed":                     "failed to pause or resume autolinking: %v",
+	"autolink.command.sync.not_authorized":              "Only system administrators and `autolink` plugin admins can sync the links.",
+	"autolink.command.sync.failed":                      "failed to sync the links with %s: %v",
+	"autolink.command.sync.in_sync":                     "The links are already in sync with %s.",
+	"autolink.command.sync.removed":                     "- Removed %s\n",
+	"autolink.command.sync.pulled":                      "Pulled the links from %s:\n%s",
+	"autolink.command.sync.pushed":                      "Pushed the links to %s:\n%s",
+	"autolink.command.sync.dry_run":                     "Syncing with %s would make these changes, nothing was changed:\n%s",
+	"autolink.command.pause.paused":                     "Autolinking is paused for all posts until %s (for %v). Run `/autolink resume` to resume it earlier.",
+	"autolink.command.resume.resumed":                   "Autolinking is resumed.",
+	"autolink.command.sample.unnamed":                   "Only named links can have samples, set the Name of the link first.",
+	"autolink.command.sample.failed":                    "failed to load or save the samples: %v",
+	"autolink.command.sample.exists":                    "The link %[2]q already has a sample %[1]q, delete it first.",
+	"autolink.command.sample.added":                     "Added the sample %q to the link %q, which generates:\n```\n%s\n```",
+	"autolink.command.sample.none":                      "The link %q has no samples, add one with `/autolink sample add`.",
+	"autolink.command.sample.not_found":                 "The link %[2]q has no sample %[1]q.",
+	"autolink.command.sample.list":                      "Samples of the link %q:\n",
+	"autolink.command.sample.updated":                   "Updated %d sample(s) of the link %q.",
+	"autolink.command.sample.deleted":                   "Deleted the sample %q of the link %q.",
+	"autolink.command.verify.no_samples":                "No samples to verify, add some with `/autolink sample add`.",
+	"autolink.command.verify.passed":                    "All %d sample(s) of %d link(s) passed.",
+	"autolink.command.verify.failed":                    "%d of the %d sample(s) of %d link(s) failed:\n",
+	"autolink.command.verify.regression":                "- **%s** `%s`: `%s`\n  - expected: `%s`\n  - actual: `%s`\n",
+	"autolink.command.verify.compile_failed":            "- **%s** `%s`: the link does not compile: %v\n",
+	"autolink.command.enable.all":                       "Enabled %d link(s).",
+	"autolink.command.disable.all":                      "Disabled %d link(s).",
+	"autolink.command.simulate.no_file":                 "No file to simulate the links against, post the channel export in this channel first, or pass its file ID.",
+	"autolink.command.simulate.not_yours":               "Only the files you uploaded can be simulated against.",
+	"autolink.command.simulate.too_large":               "The file is larger than %d MB.",
+	"autolink.command.simulate.failed":                  "failed to simulate the links: %v",
+	"autolink.command.simulate.summary":                 "Simulated the links against `%s`: %d post(s), %d of which would have been rewritten.\n\n",
+	"autolink.command.simulate.disabled":                " (disabled)",
+	"autolink.command.export.sent":                      "Sent %d link(s) as a file in your direct messages with the `autolink` bot.",
+	"autolink.command.export.failed":                    "failed to export the links: %v",
+	"autolink.command.apikey.not_authorized":            "Only system administrators and `autolink` plugin admins can manage the API keys.",
+	"autolink.command.apikey.failed":                    "failed to load or save the API keys: %v",
+	"autolink.command.apikey.invalid_scope":             "%q is not a valid scope, must be read or write",
+	"autolink.command.apikey.exists":                    "The API key %q already exists, revoke it first.",
+	"autolink.command.apikey.created":                   "Created the API key %q. Copy it now, it is not shown again:\n```\n%s\n```\nSend it as an `Authorization: Bearer <key>` header to the REST API.",
+	"autolink.command.apikey.none":                      "There are no API keys, create one with `/autolink apikey create`.",
+	"autolink.command.apikey.list":                      "API keys:\n",
+	"autolink.command.apikey.not_found":                 "The API key %q does not exist.",
+	"autolink.command.apikey.revoked":                   "Revoked the API key %q.",
+	"autolink.command.profile.not_authorized":           "Only system administrators and `autolink` plugin admins can manage the profiles.",
+	"autolink.command.profile.failed":                   "failed to load or save the profiles: %v",
+	"autolink.command.profile.built_in":                 "%q is a built-in profile, it can not be saved or deleted.",
+	"autolink.command.profile.not_found":                "No profile %q, run `/autolink profile list` for the list of profiles.",
+	"autolink.command.profile.list":                     "Profiles:\n",
+	"autolink.command.profile.off":                      "- `%s`: all the links disabled\n",
+	"autolink.command.profile.saved":                    "Saved the profile %q, enabling %d link(s). Run `/autolink profile apply` with its name to switch back to it.",
+	"autolink.command.profile.applied":                  "Applied the profile %q, %d of the %d link(s) are enabled.",
+	"autolink.command.profile.deleted":                  "Deleted the profile %q.",
+	"autolink.command.import_github.not_authorized":     "Only system administrators and `autolink` plugin admins can import links.",
+	"autolink.command.import_github.failed":             "failed to import autolink references from GitHub: %v",
+	"autolink.command.import_github.not_found":          "No autolink references found for %q.",
+	"autolink.command.import_github.added":              "- Added %s\n",
+	"autolink.command.import_github.updated":            "- Updated %s\n",
+	"autolink.command.import_github.repository_failed":  "- Failed to import %s: %s\n",
+	"autolink.command.import_csv.failed":                "Failed to import the CSV: %v",
+	"autolink.command.import_csv.imported":              "Imported %d link(s) from CSV:\n%s",
+	"autolink.command.import_github.imported":           "Imported %d autolink reference(s) from GitHub:\n%s",
+	"autolink.command.import_gitlab.failed":             "failed to import references from GitLab: %v",
+	"autolink.command.import_gitlab.not_found":          "No projects with issues or merge requests found for %q.",
+	"autolink.command.import_gitlab.imported":           "Imported %d reference(s) from GitLab:\n%s",
+
+	"autolink.command.optout.failed": "failed to update your autolink preference: %v",
+	"autolink.command.optout.on":     "Your posts are not autolinked. Use `/autolink optout off` to have them autolinked again.",
+	"autolink.command.optout.off":    "Your posts are autolinked. Use `/autolink optout on` to stop autolinking them.",
+
+	"autolink.command.revert.invalid_post":   "%q is not the permalink of a post.",
+	"autolink.command.revert.not_authorized": "Only the author of a post can revert it.",
+	"autolink.command.revert.not_found":      "None of your recent posts in this channel was autolinked.",
+	"autolink.command.revert.not_autolinked": "The post was not autolinked.",
+	"autolink.command.revert.edited":         "The post was edited since it was autolinked, and can not be reverted.",
+	"autolink.command.revert.failed":         "failed to revert the post: %v",
+	"autolink.command.revert.done":           "The post was restored as it was before being autolinked, and will not be autolinked when edited.",
+
+	"autolink.command.preview.no_change": "No links match, the message would be posted as is.",
+	"autolink.command.preview.changed":   "The message would be posted as:\n\n%s\n\n```\n%s\n```\nMatched links: %s",
+	"autolink.command.preview.rejected":  "The message would be rejected: %s\nMatched links: %s",
+
+	"autolink.command.channel.not_authorized": "Only channel admins can disable or enable autolinking in a channel.",
+	"autolink.command.channel.failed":         "failed to update the channel: %v",
+	"autolink.command.channel.disabled":       "Autolinking is disabled in this channel.",
+	"autolink.command.channel.enabled":        "Autolinking is enabled in this channel.",
+
+	"autolink.failures.notification":    "Some links are not working:\n%s\nRun `/autolink lint` or check `GET /plugins/mattermost-autolink/api/v1/status` for details.",
+	"autolink.suggestions.notification": "These URLs are posted often, and could be generated by links instead:\n%s\nThe links can be edited with `/autolink set` once accepted.",
+	"autolink.expiry.notification":      "The following links expired and no longer match:\n%s\nDelete them with `/autolink delete <name>`, or set a later `ExpiresAt` to keep them.",
+	"autolink.digest.daily":             "#### Autolink daily digest\n**Failures and expired links**\n%s\n**Links expiring before the next digest**\n%s\n**Activity**\n%s\nRun `/autolink lint` or `/autolink list --stats` for details.",
+	"autolink.digest.weekly":            "#### Autolink weekly digest\n**Failures and expired links**\n%s\n**Links expiring before the next digest**\n%s\n**Activity**\n%s\nRun `/autolink lint` or `/autolink list --stats` for details.",
+
+	"autolink.autocomplete.description":                   "Autolink administration.",
+	"autolink.autocomplete.commands":                      "Available commands: accept-suggestion, add, add-preset, apikey, benchmark, channel, debug, delete, disable, enable, export, import-csv, import-github, import-gitlab, lint, list, manage, optout, pause, preview, profile, reload, resume, revert, sample, search, selftest, set, setup, simulate, sync, test, test-all, verify",
+	"autolink.autocomplete.add":                           "Add a new link with a given name",
+	"autolink.autocomplete.add.name":                      "Name for a new link",
+	"autolink.autocomplete.add_preset":                    "Add a link for a common service from a preset",
+	"autolink.autocomplete.add_preset.preset":             "Name of the preset",
+	"autolink.autocomplete.channel":                       "Disable or enable autolinking in the current channel",
+	"autolink.autocomplete.channel.disable":               "Disable autolinking in the current channel",
+	"autolink.autocomplete.channel.enable":                "Enable autolinking in the current channel",
+	"autolink.autocomplete.debug":                         "Log every evaluation of a link at the debug level",
+	"autolink.autocomplete.debug.name":                    "Name of the link to trace",
+	"autolink.autocomplete.debug.value":                   "`on` to log the evaluations of the link, `off` to stop",
+	"autolink.autocomplete.delete":                        "Delete a link with a given name",
+	"autolink.autocomplete.delete.name":                   "Name of the link to delete",
+	"autolink.autocomplete.disable":                       "Disable a link with a given name",
+	"autolink.autocomplete.disable.name":                  "Name of the link to disable, or `--all` for all the links",
+	"autolink.autocomplete.enable":                        "Enable a link with a given name",
+	"autolink.autocomplete.enable.name":                   "Name of the link to enable, or `--all` for all the links",
+	"autolink.autocomplete.accept_suggestion":             "Add a link suggested for URLs posted often",
+	"autolink.autocomplete.accept_suggestion.id":          "ID of the suggested link",
+	"autolink.autocomplete.pause":                         "Stop autolinking all posts for a while",
+	"autolink.autocomplete.pause.duration":                "How long to pause autolinking, e.g. 30m or 2h, 1h by default",
+	"autolink.autocomplete.sync":                          "Sync the links with the server configured to sync with",
+	"autolink.autocomplete.sync.pull":                     "Replace the links with the links of the other server",
+	"autolink.autocomplete.sync.push":                     "Replace the links of the other server with these links",
+	"autolink.autocomplete.sync.dry_run":                  "List the changes without making them",
+	"autolink.autocomplete.resume":                        "Resume autolinking before the end of a pause",
+	"autolink.autocomplete.profile":                       "Save and switch between sets of enabled links",
+	"autolink.autocomplete.profile.list":                  "List the profiles and the links they enable",
+	"autolink.autocomplete.profile.save":                  "Save which links are enabled as a profile",
+	"autolink.autocomplete.profile.apply":                 "Enable only the links of a profile, `off` to disable all the links",
+	"autolink.autocomplete.profile.delete":                "Delete a profile",
+	"autolink.autocomplete.profile.name":                  "Name of the profile",
+	"autolink.autocomplete.simulate":                      "Run the links against an exported channel and report the posts they would rewrite",
+	"autolink.autocomplete.simulate.args":                 "Include the disabled links, and file ID of the export",
+	"autolink.autocomplete.export":                        "Send yourself the links as a JSON file, to add them to another server",
+	"autolink.autocomplete.export.args":                   "Export only the links with the scope, group or tag",
+	"autolink.autocomplete.apikey":                        "Manage the keys of the REST API for automation",
+	"autolink.autocomplete.apikey.create":                 "Create an API key, shown once",
+	"autolink.autocomplete.apikey.create.args":            "Name of the key, its scope and group",
+	"autolink.autocomplete.apikey.list":                   "List the API keys",
+	"autolink.autocomplete.apikey.revoke":                 "Revoke an API key",
+	"autolink.autocomplete.apikey.name":                   "Name of the key",
+	"autolink.autocomplete.sample":                        "Manage the sample texts of the links, checked by verify",
+	"autolink.autocomplete.sample.add":                    "Record a sample text of a link and what the link generates from it",
+	"autolink.autocomplete.sample.add.args":               "Link, name of the sample, and text",
+	"autolink.autocomplete.sample.list":                   "List the samples of a link",
+	"autolink.autocomplete.sample.update":                 "Record what the link generates now from its samples",
+	"autolink.autocomplete.sample.delete":                 "Delete a sample of a link",
+	"autolink.autocomplete.sample.args":                   "Link, and name of the sample",
+	"autolink.autocomplete.verify":                        "Run the links against their samples and report regressions",
+	"autolink.autocomplete.verify.linkref":                "Link to verify, all the links by default",
+	"autolink.autocomplete.import_github":                 "Import the autolink references of a GitHub organization or repository",
+	"autolink.autocomplete.import_csv":                    "Add or update links from CSV, one link per line",
+	"autolink.autocomplete.import_csv.csv":                "CSV with name,pattern,template,scope columns named on the first line, or term,url pairs",
+	"autolink.autocomplete.import_github.target":          "GitHub organization, user or repository",
+	"autolink.autocomplete.import_gitlab":                 "Import the issue and merge request references of a GitLab group or project",
+	"autolink.autocomplete.import_gitlab.target":          "GitLab group, subgroup or project",
+	"autolink.autocomplete.benchmark":                     "Time the links against sample messages to find slow patterns",
+	"autolink.autocomplete.benchmark.name":                "Name of the link, all links by default",
+	"autolink.autocomplete.lint":                          "Check the links for likely configuration mistakes",
+	"autolink.autocomplete.setup":                         "Create a link step by step",
+	"autolink.autocomplete.manage":                        "Show the links with buttons to enable, disable, edit or delete them",
+	"autolink.autocomplete.list":                          "List all configured links",
+	"autolink.autocomplete.list.condition":                "List the link which match with the given condition",
+	"autolink.autocomplete.list.format":                   "Format of the list: default, a markdown table or JSON. Add `--post` to post it to the channel",
+	"autolink.autocomplete.list.name":                     "If `name` of a link is provided, it will only list a configuration of `name` link ",
+	"autolink.autocomplete.list.template":                 "List configuration of link matched with the given template",
+	"autolink.autocomplete.list.pattern":                  "List configuration of link matched with the given pattern",
+	"autolink.autocomplete.optout":                        "Stop or resume autolinking your own posts",
+	"autolink.autocomplete.optout.value":                  "`on` to stop autolinking your posts, `off` to resume",
+	"autolink.autocomplete.preview":                       "Show how a message would be autolinked",
+	"autolink.autocomplete.preview.text":                  "Message to preview",
+	"autolink.autocomplete.revert":                        "Restore your post as it was before being autolinked",
+	"autolink.autocomplete.revert.post":                   "Permalink of the post, by default your latest autolinked post in the channel",
+	"autolink.autocomplete.search":                        "List the links whose name, patterns, template or scope contain a text",
+	"autolink.autocomplete.search.text":                   "Text to search for, or a regular expression with `--regex`",
+	"autolink.autocomplete.set":                           "Set a field of a link with a given value",
+	"autolink.autocomplete.set.name":                      "Name of a link to set",
+	"autolink.autocomplete.set.field":                     "A name of a field to set a value",
+	"autolink.autocomplete.set.template":                  "Set the `Template` field",
+	"autolink.autocomplete.set.pattern":                   "Set the `Pattern` field",
+	"autolink.autocomplete.set.patterns":                  "Set the whitespace-separated alternative patterns",
+	"autolink.autocomplete.set.word_match":                "If true uses the \\b word boundaries",
+	"autolink.autocomplete.set.unicode_word_match":        "If true matches whole words in any language, including Chinese and Japanese",
+	"autolink.autocomplete.set.boundary_class":            "Regular expression matching a character allowed before and after a match",
+	"autolink.autocomplete.set.prefix_chars":              "Characters allowed right before a match, in addition to whitespace",
+	"autolink.autocomplete.set.suffix_chars":              "Characters allowed right after a match, in addition to whitespace",
+	"autolink.autocomplete.set.active_from":               "RFC 3339 time the link is active from, or `none`",
+	"autolink.autocomplete.set.active_until":              "RFC 3339 time the link is active until, or `none`",
+	"autolink.autocomplete.set.schedule":                  "Cron-like schedule of the minutes the link is active, or `none`",
+	"autolink.autocomplete.set.expires_at":                "RFC 3339 time after which the link stops matching and admins are asked to delete it, or `none`",
+	"autolink.autocomplete.set.max_replacements":          "Maximum number of matches replaced in a post, 0 for no limit",
+	"autolink.autocomplete.set.first_match_only":          "If true only the first occurrence of each match in a post is replaced",
+	"autolink.autocomplete.set.code_blocks":               "If true applies the link to code blocks, adding the generated text after them",
+	"autolink.autocomplete.set.code_spans":                "If true applies the link to inline code, adding the generated text after it",
+	"autolink.autocomplete.set.code_only":                 "If true applies the link only to the code enabled by CodeBlocks or CodeSpans",
+	"autolink.autocomplete.set.process_link_labels":       "If true applies changes to the label text of markdown links, but not to their URL",
+	"autolink.autocomplete.set.case_insensitive":          "If true the pattern matches regardless of letter case",
+	"autolink.autocomplete.set.multi_line":                "If true ^ and $ match at the start and end of each line",
+	"autolink.autocomplete.set.dot_all":                   "If true . matches line breaks too",
+	"autolink.autocomplete.set.across_lines":              "If true the link applies to the lines of each paragraph together",
+	"autolink.autocomplete.set.process_bot_posts":         "If true applies changes to posts created by bot accounts.",
+	"autolink.autocomplete.set.process_integration_posts": "If true applies changes to posts created by incoming webhooks and integrations.",
+	"autolink.autocomplete.set.process_plugin_posts":      "If true applies changes to posts created by other plugins.",
+	"autolink.autocomplete.set.process_on_update":         "If true applies changes to edited posts, if false only to new posts, none to follow the plugin settings",
+	"autolink.autocomplete.set.bot_allowlist":             "Usernames of the only bots whose posts are processed",
+	"autolink.autocomplete.set.bot_denylist":              "Usernames of the bots whose posts are never processed",
+	"autolink.autocomplete.set.scope":                     "team/channel the autolink applies to",
+	"autolink.autocomplete.set.enrich_ttl":                "How long the details looked up for the same generated link are reused, e.g. `1h`, empty for the cache of the enrichment",
+	"autolink.autocomplete.set.fallback_template":         "Template used when the enrichment or the permalink lookup fails, empty to clear",
+	"autolink.autocomplete.set.enrich":                    "Set to `jira` to append the issue summary and status to generated links, or `cve` for the CVE severity and summary",
+	"autolink.autocomplete.set.attachment":                "JSON message attachment added to the post for each match, or empty to remove it",
+	"autolink.autocomplete.set.terminal":                  "If true the next links do not change the text generated by this link",
+	"autolink.autocomplete.reload":                        "Read the configuration and the links again and compile all the links",
+	"autolink.autocomplete.selftest":                      "Check the configuration, the links and the access to the channel and KV store",
+	"autolink.autocomplete.set.debug":                     "If true every evaluation of the link is logged at the debug level",
+	"autolink.autocomplete.set.shadow_mode":               "If true the matches of the link are recorded but the posts are left as is",
+	"autolink.autocomplete.set.terminal_post":             "If true the next links are not applied to posts this link matched",
+	"autolink.autocomplete.set.threads":                   "Limits the link to root posts (root), replies (replies), or threads whose root post matches (matching-root), none to clear",
+	"autolink.autocomplete.set.description":               "Why the link exists, e.g. what its pattern matches, or empty to clear",
+	"autolink.autocomplete.set.owner":                     "Who to ask before changing or deleting the link, or empty to clear",
+	"autolink.autocomplete.set.tags":                      "Tags of the link, e.g. `jira deprecated` (a whitespace-separated list), or empty to clear",
+	"autolink.autocomplete.set.group":                     "Name of the group of related links the link belongs to, or empty to clear",
+	"autolink.autocomplete.set.webhook_url":               "URL receiving the events of the link changing posts, or empty to use the global webhook",
+	"autolink.autocomplete.set.mentions":                  "value=@username or value=~channel pairs used by the mention template modifier, or empty to clear",
+	"autolink.autocomplete.set.engine":                    "Regular expression engine of the patterns, re2 (default) or backtracking for lookarounds",
+	"autolink.autocomplete.set.style":                     "How the generated text is shown, bold, code for inline code, plain for the bare URL, none to clear",
+	"autolink.autocomplete.set.text_prefix":               "Text added before the generated text, e.g. an emoji, or empty to clear",
+	"autolink.autocomplete.set.text_suffix":               "Text added after the generated text, or empty to clear",
+	"autolink.autocomplete.set.kind":                      "Specialized kind of link, commit for Git commit SHAs, shorten for URLs shortened into links, keyword for @keywords such as @oncall, none to clear",
+	"autolink.autocomplete.set.repositories":              "scope=url pairs of the repositories of a commit link, the scope being team/channel, team or *",
+	"autolink.autocomplete.set.cases":                     "JSON list of templates selected by the value of a capture group",
+	"autolink.autocomplete.set.locale_templates":          "JSON object of templates by locale of the author, e.g. es or pt-BR, or empty to clear",
+	"autolink.autocomplete.set.scope_templates":           "JSON object of templates by team or team/channel of the post, or empty to clear",
+	"autolink.autocomplete.test":                          "Test a link on the text provided",
+	"autolink.autocomplete.test.name":                     "Name of a link to test with",
+	"autolink.autocomplete.test.text":                     "Sample text which the link applies",
+	"autolink.autocomplete.test_all":                      "Test all the links on the text provided, in the order they apply",
+	"autolink.autocomplete.test_all.text":                 "Sample text which the links apply",
+	"autolink.autocomplete.help":                          "Autolink plugin slash command help",
+}
+
+// loadTranslations reads the translation files from the i18n directory of the
+// plugin bundle. A missing directory is not an error, all messages are then
+// rendered in English.
+func loadTranslations(bundlePath string) (map[string]map[string]string, error) {
+	dir := filepath.Join(bundlePath, i18nDir)
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read translations directory")
+	}
+
+	translations := map[string]map[string]string{}
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read translation file %s", file.Name())
+		}
+		messages := map[string]string{}
+		if err = json.Unmarshal(data, &messages); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse translation file %s", file.Name())
+		}
+		translations[strings.ToLower(strings.TrimSuffix(file.Name(), ".json"))] = messages
+	}
+	return translations, nil
+}
+
+// translateFunc returns a function rendering messages in the given locale,
+// falling back to the language of a regional locale (`pt-br` to `pt`), and
+// then to English. When called with args the message is formatted, otherwise
+// the format string is returned as is.
+func (p *Plugin) translateFunc(locale string) i18n.TranslateFunc {
+	locale = strings.ToLower(strings.Replace(locale, "_", "-", -1))
+	var messages, languageMessages map[string]string
+	if p.translations != nil {
+		messages = p.translations[locale]
+		languageMessages = p.translations[strings.SplitN(locale, "-", 2)[0]]
+	}
+
+	return func(translationID string, args ...interface{}) string {
+		text, ok := messages[translationID]
+		if !ok {
+			text, ok = languageMessages[translationID]
+		}
+		if !ok {
+			text, ok = defaultMessages[translationID]
+		}
+		if !ok {
+			text = translationID
+		}
+
+		// The messages name the command by its default trigger
+		if trigger := p.getConfig().commandTrigger(); trigger != defaultCommandTrigger {
+			text = strings.Replace(text, "`/"+defaultCommandTrigger, "`/"+trigger, -1)
+		}
+
+		if len(args) == 0 {
+			return text
+		}
+		return fmt.Sprintf(text, args...)
+	}
+}
+
+// userLocale returns the locale of the user, or the server locale if the user
+// has not chosen one.
+func (p *Plugin) userLocale(userID string) string {
+	if len(p.translations) == 0 {
+		// Everything is rendered in English anyway
+		return defaultLocale
+	}
+
+	user, appErr := p.API.GetUser(userID)
+	if appErr == nil && user.Locale != "" {
+		return user.Locale
+	}
+	return p.serverLocale()
+}
+
+// serverLocale returns the default server locale.
+func (p *Plugin) serverLocale() string {
+	if len(p.translations) == 0 {
+		return defaultLocale
+	}
+
+	config := p.API.GetConfig()
+	if config == nil || config.LocalizationSettings.DefaultServerLocale == nil ||
+		*config.LocalizationSettings.DefaultServerLocale == "" {
+		return defaultLocale
+	}
+	return *config.LocalizationSettings.DefaultServerLocale
+}
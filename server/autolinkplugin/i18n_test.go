@@ -0,0 +1,77 @@
+package autolinkplugin
+
+import (
+	"regexp"
+	"sort"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// formatVerb matches the fmt verbs of a message.
+var formatVerb = regexp.MustCompile(`%(\[\d+\])?[-+# 0]*\d*(\.\d+)?[a-zA-Z%]`)
+
+// formatVerbs returns the fmt verbs of a message, sorted as translations may
+// reorder them.
+func formatVerbs(message string) []string {
+	verbs := formatVerb.FindAllString(message, -1)
+	sort.Strings(verbs)
+	return verbs
+}
+
+func TestBundledTranslations(t *testing.T) {
+	translations, err := loadTranslations("../..")
+	require.NoError(t, err)
+	require.NotEmpty(t, translations)
+
+	for locale, messages := range translations {
+		for id := range messages {
+			_, ok := defaultMessages[id]
+			assert.True(t, ok, "%s: unknown message %q", locale, id)
+		}
+		for id, message := range defaultMessages {
+			translated, ok := messages[id]
+			if assert.True(t, ok, "%s: message %q is not translated", locale, id) {
+				assert.Equal(t, formatVerbs(message), formatVerbs(translated), "%s: verbs of message %q", locale, id)
+			}
+		}
+	}
+}
+
+func TestTranslateFunc(t *testing.T) {
+	p := New()
+	p.translations = map[string]map[string]string{
+		"pt":    {"autolink.command.list.empty": "Nenhum link encontrado."},
+		"pt-br": {"autolink.command.ref.not_found": "%q não encontrado"},
+	}
+
+	tr := p.translateFunc("pt_BR")
+	assert.Equal(t, "\"x\" não encontrado", tr("autolink.command.ref.not_found", "x"))
+	assert.Equal(t, "Nenhum link encontrado.", tr("autolink.command.list.empty"))
+	assert.Equal(t, "%v is not a valid link number", tr("autolink.command.ref.invalid_number"))
+	assert.Equal(t, "unknown.id", tr("unknown.id"))
+
+	tr = p.translateFunc("fr")
+	assert.Equal(t, "No links found.", tr("autolink.command.list.empty"))
+}
+
+func TestUserLocale(t *testing.T) {
+	api := &plugintest.API{}
+	api.On("GetUser", "withlocale").Return(&model.User{Locale: "es"}, nil)
+	api.On("GetUser", "nolocale").Return(&model.User{}, nil)
+	serverLocale := "pt-BR"
+	api.On("GetConfig").Return(&model.Config{
+		LocalizationSettings: model.LocalizationSettings{DefaultServerLocale: &serverLocale},
+	})
+
+	p := New()
+	p.SetAPI(api)
+	assert.Equal(t, "en", p.userLocale("withlocale"), "no translations loaded")
+
+	p.translations = map[string]map[string]string{"es": {}}
+	assert.Equal(t, "es", p.userLocale("withlocale"))
+	assert.Equal(t, "pt-BR", p.userLocale("nolocale"))
+}
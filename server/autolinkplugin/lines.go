@@ -0,0 +1,74 @@
+package autolinkplugin
+
+import (
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v6/shared/markdown"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+// paragraphLines returns the consecutive lines of text of a paragraph the
+// links with AcrossLines apply to together, as the end of the lines by the
+// position of the first one. Only the lines of plain text separated by line
+// breaks are joined, the lines of a block quote, or with markup at their
+// ends, are left on their own.
+func paragraphLines(message string, inlines []markdown.Inline) map[int]int {
+	lines := map[int]int{}
+	var first, last *markdown.Text
+	count := 0
+	flush := func() {
+		if count > 1 {
+			lines[first.Range.Position] = last.Range.End
+		}
+		first, last, count = nil, nil, 0
+	}
+	for _, inline := range inlines {
+		switch inline := inline.(type) {
+		case *markdown.SoftLineBreak:
+			continue
+		case *markdown.Text:
+			if inline.Text != message[inline.Range.Position:inline.Range.End] {
+				flush()
+				continue
+			}
+			if last != nil {
+				between := message[last.Range.End:inline.Range.Position]
+				if strings.Count(between, "\n") != 1 || strings.TrimSpace(between) != "" {
+					flush()
+				}
+			}
+			if first == nil {
+				first = inline
+			}
+			last = inline
+			count++
+		default:
+			flush()
+		}
+	}
+	flush()
+	return lines
+}
+
+// splitLines splits the spans to replace at the line breaks, for the links
+// without AcrossLines to apply to each line on its own.
+func splitLines(spans []autolink.Span) []autolink.Span {
+	out := make([]autolink.Span, 0, len(spans))
+	for _, span := range spans {
+		if span.Replaced || !strings.Contains(span.Text, "\n") {
+			out = append(out, span)
+			continue
+		}
+		lines := strings.Split(span.Text, "\n")
+		for i, line := range lines {
+			if i > 0 {
+				out = append(out, autolink.Span{Text: "\n"})
+			}
+			if line != "" {
+				out = append(out, autolink.Span{Text: line})
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,219 @@
+package autolinkplugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+// linkEntryDelete is the field of the link entries deleting the link with
+// their Name, e.g. `Delete: true`.
+const linkEntryDelete = "Delete"
+
+// linkEntriesErrorPrefix prefixes the comments reporting the errors of the
+// link entries at the top of the setting, for the System Console to show them.
+const linkEntriesErrorPrefix = "# ERROR: "
+
+// linkFieldTypes are the types of the fields of the links, by lowercase JSON
+// name.
+var linkFieldTypes = func() map[string]reflect.StructField {
+	fields := map[string]reflect.StructField{}
+	t := reflect.TypeOf(autolink.Autolink{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if field.PkgPath != "" || name == "" || name == "-" {
+			continue
+		}
+		fields[strings.ToLower(name)] = field
+	}
+	return fields
+}()
+
+// parseLinkEntries parses the links of the link entries setting, edited in the
+// System Console one link at a time. Each link is a block of `Field: value`
+// lines, blocks being separated by empty lines, e.g.
+//
+//	Name: jira
+//	Pattern: (?P<key>MM-\d+)
+//	Template: [$key](https://jira.example.com/browse/$key)
+//	WordMatch: true
+//
+// The values of the lists, e.g. Scope or Tags, are whitespace-separated, and
+// the values of the other structured fields, e.g. Cases, are JSON. A block
+// with `Delete: true` deletes the link with its Name. Lines starting with `#`
+// are ignored. It returns the links to add or update, and the names of the
+// links to delete.
+func parseLinkEntries(s string) ([]autolink.Autolink, []string, error) {
+	var links []autolink.Autolink
+	var deleted []string
+	names := map[string]bool{}
+
+	var entry map[string]json.RawMessage
+	var entryLine int
+	del := false
+	flush := func() error {
+		if entry == nil {
+			return nil
+		}
+		defer func() { entry, del = nil, false }()
+
+		var name string
+		if raw, ok := entry["Name"]; ok {
+			_ = json.Unmarshal(raw, &name)
+		}
+		if name == "" {
+			return errors.Errorf("line %d: the link has no Name", entryLine)
+		}
+		if names[name] {
+			return errors.Errorf("line %d: link %q is listed more than once", entryLine, name)
+		}
+		names[name] = true
+		if del {
+			deleted = append(deleted, name)
+			return nil
+		}
+
+		data, _ := json.Marshal(entry)
+		var link autolink.Autolink
+		if err := json.Unmarshal(data, &link); err != nil {
+			return errors.Wrapf(err, "line %d: invalid link %q", entryLine, name)
+		}
+		links = append(links, link)
+		return nil
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(s))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			if err := flush(); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		i := strings.Index(line, ":")
+		if i <= 0 {
+			return nil, nil, errors.Errorf("line %d: %q is not a `Field: value` line", lineNumber, line)
+		}
+		key, value := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+		if entry == nil {
+			entry = map[string]json.RawMessage{}
+			entryLine = lineNumber
+		}
+		if strings.EqualFold(key, linkEntryDelete) {
+			d, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, nil, errors.Errorf("line %d: invalid %s %q, must be true or false", lineNumber, linkEntryDelete, value)
+			}
+			del = d
+			continue
+		}
+		field, ok := linkFieldTypes[strings.ToLower(key)]
+		if !ok {
+			return nil, nil, errors.Errorf("line %d: unknown field %q", lineNumber, key)
+		}
+		if _, ok := entry[field.Name]; ok {
+			return nil, nil, errors.Errorf("line %d: field %q is set more than once", lineNumber, field.Name)
+		}
+		raw, err := linkEntryValue(field.Type, value)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "line %d: invalid %s", lineNumber, field.Name)
+		}
+		entry[field.Name] = raw
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, nil, err
+	}
+	return links, deleted, nil
+}
+
+// linkEntryValue converts the value of a field of a link entry to JSON.
+func linkEntryValue(t reflect.Type, value string) (json.RawMessage, error) {
+	var v interface{}
+	switch {
+	case t.Kind() == reflect.String:
+		v = value
+	case t.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, errors.Errorf("%q, must be true or false", value)
+		}
+		v = b
+	case t.Kind() == reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, errors.Errorf("%q, must be a number", value)
+		}
+		v = n
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.String:
+		v = strings.Fields(value)
+	default:
+		if value == "" {
+			return json.RawMessage("null"), nil
+		}
+		if !json.Valid([]byte(value)) {
+			return nil, errors.Errorf("%q, must be JSON", value)
+		}
+		return json.RawMessage(value), nil
+	}
+	data, _ := json.Marshal(v)
+	return data, nil
+}
+
+// withLinkEntriesError returns the link entries with the error reported in
+// comments at their top, replacing the errors reported before, or without
+// them if err is nil.
+func withLinkEntriesError(entries string, err error) string {
+	lines := strings.Split(entries, "\n")
+	for len(lines) > 0 && strings.HasPrefix(lines[0], linkEntriesErrorPrefix) {
+		lines = lines[1:]
+	}
+	if err != nil {
+		var reported []string
+		for _, line := range strings.Split(err.Error(), "\n") {
+			if strings.TrimSpace(line) != "" {
+				reported = append(reported, linkEntriesErrorPrefix+line)
+			}
+		}
+		lines = append(reported, lines...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// reportLinkEntriesError saves the link entries of the configuration with the
+// error reported at their top, or without the errors reported before if err
+// is nil, unless they are already so.
+func (p *Plugin) reportLinkEntriesError(c *Config, err error) {
+	entries := withLinkEntriesError(c.LinkEntries, err)
+	if entries == c.LinkEntries {
+		return
+	}
+	withError := *c
+	withError.Links = nil
+	withError.LinkEntries = entries
+	configMap, mapErr := withError.ToMap()
+	if mapErr == nil {
+		if appErr := p.API.SavePluginConfig(configMap); appErr != nil {
+			mapErr = appErr
+		}
+	}
+	if mapErr != nil {
+		p.API.LogError("Failed to report the error of the link entries", "error", mapErr.Error())
+		return
+	}
+	c.LinkEntries = entries
+}
@@ -0,0 +1,369 @@
+package autolinkplugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin"
+	"github.com/pkg/errors"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+// autolinkPluginID is the ID of the plugin, in the URLs of the actions of its
+// interactive messages and dialogs.
+const autolinkPluginID = "mattermost-autolink"
+
+// Actions of the buttons of the management panel posted by `/autolink manage`
+const (
+	manageActionEnable  = "enable"
+	manageActionDisable = "disable"
+	manageActionDelete  = "delete"
+	manageActionEdit    = "edit"
+	manageActionPage    = "page"
+)
+
+// manageDialogEdit is the dialog editing a link from the management panel.
+const manageDialogEdit = "edit"
+
+// Colors of the links in the management panel
+const (
+	manageColorEnabled  = "#3db887"
+	manageColorDisabled = "#8b8b8b"
+)
+
+// manageState identifies the link a button or dialog of the management panel
+// acts on, and the page of the panel it was shown on. The link is identified
+// by its index, and its name to detect the links that changed meanwhile.
+type manageState struct {
+	Index int    `json:"index"`
+	Name  string `json:"name"`
+	Page  int    `json:"page"`
+}
+
+func (s manageState) context() map[string]interface{} {
+	return map[string]interface{}{"index": s.Index, "name": s.Name, "page": s.Page}
+}
+
+func manageStateFromContext(ctx map[string]interface{}) manageState {
+	state := manageState{}
+	state.Index = contextInt(ctx, "index")
+	state.Name, _ = ctx["name"].(string)
+	state.Page = contextInt(ctx, "page")
+	return state
+}
+
+// contextInt returns a number of the context of an action, decoded from JSON
+// as a float64.
+func contextInt(ctx map[string]interface{}, key string) int {
+	switch n := ctx[key].(type) {
+	case float64:
+		return int(n)
+	case int:
+		return n
+	}
+	return 0
+}
+
+func manageActionURL(action string) string {
+	return fmt.Sprintf("/plugins/%s/api/v1/actions/%s", autolinkPluginID, action)
+}
+
+func manageDialogURL(dialog string) string {
+	return fmt.Sprintf("/plugins/%s/api/v1/dialogs/%s", autolinkPluginID, dialog)
+}
+
+func manageButton(name, action, style string, state manageState) *model.PostAction {
+	return &model.PostAction{
+		Type:  model.PostActionTypeButton,
+		Name:  name,
+		Style: style,
+		Integration: &model.PostActionIntegration{
+			URL:     manageActionURL(action),
+			Context: state.context(),
+		},
+	}
+}
+
+func executeManage(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	rest, opts, err := parseListOptions(header, args)
+	if err != nil {
+		return responsef("%v", err)
+	}
+	if len(rest) > 0 {
+		return responsef(header.T("autolink.command.help"))
+	}
+
+	attachments, err := p.managePanel(header, opts.page)
+	if err != nil {
+		return responsef("%v", err)
+	}
+	resp := responsef(header.T("autolink.command.manage.title"))
+	resp.Attachments = attachments
+	return resp
+}
+
+// managePanel returns a page of the links the user may manage, each with the
+// buttons changing it, and the buttons showing the other pages.
+func (p *Plugin) managePanel(header *model.CommandArgs, page int) ([]*model.SlackAttachment, error) {
+	links, refs, err := searchLinkRef(p, header, false)
+	if err != nil {
+		return nil, err
+	}
+	if refs == nil {
+		refs = make([]int, len(links))
+		for i := range links {
+			refs[i] = i
+		}
+	}
+	if len(refs) == 0 {
+		return nil, errors.New(header.T("autolink.command.list.empty"))
+	}
+
+	// The page may no longer exist once links were deleted
+	pages := (len(refs) + listPageSize - 1) / listPageSize
+	if page > pages {
+		page = pages
+	}
+	if page < 1 {
+		page = 1
+	}
+	end := page * listPageSize
+	if end > len(refs) {
+		end = len(refs)
+	}
+
+	attachments := []*model.SlackAttachment{}
+	for _, i := range refs[(page-1)*listPageSize : end] {
+		l := links[i]
+		state := manageState{Index: i, Name: l.Name, Page: page}
+		color := manageColorEnabled
+		toggle := manageButton(header.T("autolink.command.manage.disable"), manageActionDisable, "default", state)
+		if l.Disabled {
+			color = manageColorDisabled
+			toggle = manageButton(header.T("autolink.command.manage.enable"), manageActionEnable, "primary", state)
+		}
+		attachments = append(attachments, &model.SlackAttachment{
+			Text:  l.ToMarkdown(i + 1),
+			Color: color,
+			Actions: []*model.PostAction{
+				toggle,
+				manageButton(header.T("autolink.command.manage.edit"), manageActionEdit, "default", state),
+				manageButton(header.T("autolink.command.manage.delete"), manageActionDelete, "danger", state),
+			},
+		})
+	}
+
+	if pages > 1 {
+		pager := &model.SlackAttachment{
+			Text: header.T("autolink.command.manage.page", page, pages, len(refs)),
+		}
+		if page > 1 {
+			pager.Actions = append(pager.Actions,
+				manageButton(header.T("autolink.command.manage.previous"), manageActionPage, "default", manageState{Page: page - 1}))
+		}
+		if page < pages {
+			pager.Actions = append(pager.Actions,
+				manageButton(header.T("autolink.command.manage.next"), manageActionPage, "default", manageState{Page: page + 1}))
+		}
+		attachments = append(attachments, pager)
+	}
+	return attachments, nil
+}
+
+// actionHeader returns the arguments of a command run by the user in the
+// channel, for the actions to be authorized and translated like the commands.
+func (p *Plugin) actionHeader(userID, teamID, channelID string) *model.CommandArgs {
+	return &model.CommandArgs{
+		UserId:    userID,
+		TeamId:    teamID,
+		ChannelId: channelID,
+		T:         p.translateFunc(p.userLocale(userID)),
+	}
+}
+
+// managedLinks returns a copy of the links, and checks that the link of the
+// state is unchanged and that the user may manage it.
+func (p *Plugin) managedLinks(header *model.CommandArgs, state manageState) ([]autolink.Autolink, error) {
+	links, refs, err := searchLinkRef(p, header, false)
+	if err != nil {
+		return nil, err
+	}
+	if state.Index < 0 || state.Index >= len(links) || links[state.Index].Name != state.Name {
+		return nil, errors.New(header.T("autolink.command.manage.changed"))
+	}
+	if refs != nil {
+		allowed := false
+		for _, i := range refs {
+			allowed = allowed || i == state.Index
+		}
+		if !allowed {
+			return nil, errors.New(header.T("autolink.command.not_authorized"))
+		}
+	}
+	return append([]autolink.Autolink{}, links...), nil
+}
+
+// HandleAction handles the buttons of the management panel and of the
+// confirmations. The panel is updated with the changed links, and a
+// confirmation with the outcome of the command.
+func (p *Plugin) HandleAction(userID, action string, request *model.PostActionIntegrationRequest) *model.PostActionIntegrationResponse {
+	header := p.actionHeader(userID, request.TeamId, request.ChannelId)
+	switch action {
+	case confirmActionDelete, confirmActionBulkSet, confirmActionCancel:
+		return &model.PostActionIntegrationResponse{
+			Update: &model.Post{Message: p.handleConfirm(header, action, request.Context)},
+		}
+	case setupActionOpen:
+		return p.handleSetupAction(header, request)
+	}
+	state := manageStateFromContext(request.Context)
+
+	if action != manageActionPage {
+		links, err := p.managedLinks(header, state)
+		if err != nil {
+			return &model.PostActionIntegrationResponse{EphemeralText: err.Error()}
+		}
+
+		switch action {
+		case manageActionEnable, manageActionDisable:
+			links[state.Index].Disabled = action == manageActionDisable
+		case manageActionDelete:
+			confirm := confirmDeleteResponse(header, links[state.Index], state.Index)
+			post := &model.Post{Message: confirm.Text}
+			model.ParseSlackAttachment(post, confirm.Attachments)
+			return &model.PostActionIntegrationResponse{Update: post}
+		case manageActionEdit:
+			if err = p.openEditDialog(header, request.TriggerId, links[state.Index], state); err != nil {
+				p.API.LogWarn("Failed to open the link dialog", "error", err.Error())
+				return &model.PostActionIntegrationResponse{EphemeralText: err.Error()}
+			}
+			return &model.PostActionIntegrationResponse{}
+		default:
+			return &model.PostActionIntegrationResponse{}
+		}
+
+		if err = p.SaveLinks(links); err != nil {
+			return &model.PostActionIntegrationResponse{EphemeralText: err.Error()}
+		}
+	}
+
+	// Once the last link is deleted, the panel only shows the error
+	post := &model.Post{Message: header.T("autolink.command.manage.title")}
+	attachments, err := p.managePanel(header, state.Page)
+	if err != nil {
+		post.Message = err.Error()
+	}
+	model.ParseSlackAttachment(post, attachments)
+	return &model.PostActionIntegrationResponse{Update: post}
+}
+
+func (p *Plugin) openEditDialog(header *model.CommandArgs, triggerID string, l autolink.Autolink, state manageState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode the dialog state")
+	}
+
+	appErr := p.API.OpenInteractiveDialog(model.OpenDialogRequest{
+		TriggerId: triggerID,
+		URL:       manageDialogURL(manageDialogEdit),
+		Dialog: model.Dialog{
+			Title:       header.T("autolink.command.manage.edit_title", l.DisplayName()),
+			SubmitLabel: header.T("autolink.command.manage.save"),
+			State:       string(data),
+			Elements: []model.DialogElement{{
+				DisplayName: optName,
+				Name:        optName,
+				Type:        "text",
+				Default:     l.Name,
+				Optional:    true,
+			}, {
+				DisplayName: optPattern,
+				Name:        optPattern,
+				Type:        "textarea",
+				Default:     l.Pattern,
+			}, {
+				DisplayName: optTemplate,
+				Name:        optTemplate,
+				Type:        "textarea",
+				Default:     l.Template,
+			}, {
+				DisplayName: optScope,
+				Name:        optScope,
+				Type:        "text",
+				Default:     strings.Join(l.Scope, " "),
+				HelpText:    header.T("autolink.command.manage.scope_help"),
+				Optional:    true,
+			}},
+		},
+	})
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to open the dialog")
+	}
+	return nil
+}
+
+// HandleDialog handles the dialogs of the management panel and of the setup.
+func (p *Plugin) HandleDialog(userID, dialog string, request *model.SubmitDialogRequest) *model.SubmitDialogResponse {
+	if request.Cancelled {
+		return nil
+	}
+	header := p.actionHeader(userID, request.TeamId, request.ChannelId)
+	switch dialog {
+	case manageDialogEdit:
+		return p.submitEditDialog(header, request)
+	case setupDialogKind, setupDialogPattern, setupDialogScope:
+		return p.handleSetupDialog(header, dialog, request)
+	}
+	return nil
+}
+
+// submitEditDialog saves the link edited in the dialog of the management
+// panel.
+func (p *Plugin) submitEditDialog(header *model.CommandArgs, request *model.SubmitDialogRequest) *model.SubmitDialogResponse {
+	userID := header.UserId
+
+	var state manageState
+	if err := json.Unmarshal([]byte(request.State), &state); err != nil {
+		return &model.SubmitDialogResponse{Error: "invalid dialog state"}
+	}
+	links, err := p.managedLinks(header, state)
+	if err != nil {
+		return &model.SubmitDialogResponse{Error: err.Error()}
+	}
+
+	submitted := func(name string) string {
+		value, _ := request.Submission[name].(string)
+		return strings.TrimSpace(value)
+	}
+	l := links[state.Index]
+	l.Name = submitted(optName)
+	l.Pattern = submitted(optPattern)
+	l.Template = submitted(optTemplate)
+	l.Scope = strings.Fields(submitted(optScope))
+
+	isAdmin, err := p.IsAuthorizedAdmin(userID)
+	if err != nil {
+		return &model.SubmitDialogResponse{Error: err.Error()}
+	}
+	if !isAdmin {
+		if ok, _ := p.IsAuthorizedTeamAdmin(userID, l.ScopeTeams()); !ok {
+			return &model.SubmitDialogResponse{Errors: map[string]string{
+				optScope: header.T("autolink.command.set.team_admin_scope"),
+			}}
+		}
+	}
+
+	links[state.Index] = l
+	if err = p.SaveLinks(links); err != nil {
+		return &model.SubmitDialogResponse{Error: err.Error()}
+	}
+
+	p.sendBotEphemeral(userID, &model.Post{
+		ChannelId: request.ChannelId,
+		Message:   header.T("autolink.command.manage.updated", l.ToMarkdown(0)),
+	})
+	return nil
+}
@@ -0,0 +1,211 @@
+package autolinkplugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolinkclient"
+)
+
+// middlewaresKey is the KV store key of the paths of the match middlewares of
+// other plugins, by plugin ID.
+const middlewaresKey = "match_middlewares"
+
+// middlewareAttempts is the number of attempts to save the middlewares when
+// another server changes them meanwhile.
+const middlewareAttempts = 3
+
+// middlewares are the match middlewares registered by other plugins, loaded
+// from the KV store.
+type middlewares struct {
+	lock  sync.RWMutex
+	paths map[string]string
+}
+
+// RegisterMatchMiddleware registers the match middleware of a plugin, the path
+// of its HTTP handler, replacing its previous one.
+func (p *Plugin) RegisterMatchMiddleware(pluginID, path string) error {
+	return p.updateMiddlewares(func(paths map[string]string) {
+		paths[pluginID] = path
+	})
+}
+
+// UnregisterMatchMiddleware unregisters the match middleware of a plugin.
+func (p *Plugin) UnregisterMatchMiddleware(pluginID string) error {
+	return p.updateMiddlewares(func(paths map[string]string) {
+		delete(paths, pluginID)
+	})
+}
+
+// updateMiddlewares changes the middlewares saved in the KV store, and applies
+// them.
+func (p *Plugin) updateMiddlewares(update func(map[string]string)) error {
+	for attempt := 0; attempt < middlewareAttempts; attempt++ {
+		oldValue, appErr := p.API.KVGet(middlewaresKey)
+		if appErr != nil {
+			return errors.Wrap(appErr, "failed to load the match middlewares")
+		}
+		paths := map[string]string{}
+		if oldValue != nil {
+			if err := json.Unmarshal(oldValue, &paths); err != nil {
+				return errors.Wrap(err, "failed to decode the match middlewares")
+			}
+		}
+		update(paths)
+
+		value, err := json.Marshal(paths)
+		if err != nil {
+			return errors.Wrap(err, "failed to encode the match middlewares")
+		}
+		saved, appErr := p.API.KVSetWithOptions(middlewaresKey, value, model.PluginKVSetOptions{
+			Atomic:   true,
+			OldValue: oldValue,
+		})
+		if appErr != nil {
+			return errors.Wrap(appErr, "failed to save the match middlewares")
+		}
+		if !saved {
+			continue
+		}
+
+		p.setMiddlewares(paths)
+		p.publishClusterEvent(clusterEventMiddlewaresChanged, nil, model.PluginClusterEventSendTypeReliable)
+		return nil
+	}
+	return errors.New("the match middlewares were changed by someone else, please try again")
+}
+
+// loadMiddlewares loads the middlewares from the KV store.
+func (p *Plugin) loadMiddlewares() {
+	data, appErr := p.API.KVGet(middlewaresKey)
+	if appErr != nil {
+		p.API.LogError("Failed to load the match middlewares", "error", appErr.Error())
+		return
+	}
+	paths := map[string]string{}
+	if data != nil {
+		if err := json.Unmarshal(data, &paths); err != nil {
+			p.API.LogError("Failed to decode the match middlewares", "error", err.Error())
+			return
+		}
+	}
+	p.setMiddlewares(paths)
+}
+
+func (p *Plugin) setMiddlewares(paths map[string]string) {
+	p.middlewares.lock.Lock()
+	defer p.middlewares.lock.Unlock()
+
+	p.middlewares.paths = paths
+}
+
+// removeOrphanedMiddlewares unregisters the middlewares of the plugins which
+// are no longer installed.
+func (p *Plugin) removeOrphanedMiddlewares() {
+	p.middlewares.lock.RLock()
+	var orphaned []string
+	for pluginID := range p.middlewares.paths {
+		if !p.isPluginInstalled(pluginID) {
+			orphaned = append(orphaned, pluginID)
+		}
+	}
+	p.middlewares.lock.RUnlock()
+
+	for _, pluginID := range orphaned {
+		p.API.LogInfo("Removing the match middleware of an uninstalled plugin", "plugin_id", pluginID)
+		if err := p.UnregisterMatchMiddleware(pluginID); err != nil {
+			p.API.LogError("Failed to remove the match middleware of an uninstalled plugin", "plugin_id", pluginID, "error", err.Error())
+		}
+	}
+}
+
+// matchFilter returns the filter calling the middlewares for each match of
+// the links in the post, in the order of the IDs of their plugins, or nil if
+// there are none. A middleware that fails is skipped, the match being
+// replaced as if it allowed it.
+func (p *Plugin) matchFilter(post *model.Post, channelName, teamName string) autolink.MatchFilter {
+	p.middlewares.lock.RLock()
+	pluginIDs := make([]string, 0, len(p.middlewares.paths))
+	paths := make(map[string]string, len(p.middlewares.paths))
+	for pluginID, path := range p.middlewares.paths {
+		pluginIDs = append(pluginIDs, pluginID)
+		paths[pluginID] = path
+	}
+	p.middlewares.lock.RUnlock()
+	if len(pluginIDs) == 0 {
+		return nil
+	}
+	sort.Strings(pluginIDs)
+
+	return func(l autolink.Autolink, match, replacement string) (string, bool) {
+		for _, pluginID := range pluginIDs {
+			resp, err := p.callMiddleware(pluginID, paths[pluginID], autolinkclient.MatchRequest{
+				Link:        l,
+				Match:       match,
+				Replacement: replacement,
+				PostID:      post.Id,
+				RootID:      post.RootId,
+				UserID:      post.UserId,
+				ChannelID:   post.ChannelId,
+				ChannelName: channelName,
+				TeamName:    teamName,
+			})
+			if err != nil {
+				p.API.LogWarn("Match middleware failed", "plugin_id", pluginID, "link", l.DisplayName(), "error", err.Error())
+				continue
+			}
+			switch resp.Action {
+			case autolinkclient.MatchVeto:
+				return match, false
+			case autolinkclient.MatchReplace:
+				replacement = resp.Replacement
+			}
+		}
+		return replacement, true
+	}
+}
+
+// callMiddleware sends the match to the middleware of a plugin.
+func (p *Plugin) callMiddleware(pluginID, path string, request autolinkclient.MatchRequest) (*autolinkclient.MatchResponse, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, "/"+pluginID+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp := p.API.PluginHTTP(req)
+	if resp == nil {
+		return nil, errors.New("the plugin did not respond")
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("the plugin responded %v: %s", resp.StatusCode, respBody)
+	}
+
+	var response autolinkclient.MatchResponse
+	if err = json.Unmarshal(respBody, &response); err != nil {
+		return nil, errors.Wrap(err, "failed to decode the response")
+	}
+	switch response.Action {
+	case autolinkclient.MatchAllow, autolinkclient.MatchReplace, autolinkclient.MatchVeto:
+	default:
+		return nil, errors.Errorf("unknown action %q", response.Action)
+	}
+	return &response, nil
+}
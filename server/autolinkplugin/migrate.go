@@ -0,0 +1,173 @@
+package autolinkplugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+// migrations upgrade the links from each schema version to the next, the
+// first one from version 0 to 1. New migrations are appended.
+//
+// Links are migrated as generic JSON objects, for the fields that were renamed
+// or whose type changed to be converted. A migration returns whether it
+// changed the link, and must leave the links of the new version as is, since
+// the version is saved separately from the links.
+var migrations = []func(link map[string]interface{}) bool{
+	// 0 to 1
+	migrateScopes,
+}
+
+// currentSchemaVersion is the schema version of the links saved by this
+// version of the plugin.
+var currentSchemaVersion = len(migrations)
+
+// saveSchemaVersion saves the current schema version in the configuration,
+// once links were saved. There is nothing to migrate until then.
+func (p *Plugin) saveSchemaVersion(c *Config) {
+	if c.SchemaVersion >= currentSchemaVersion || c.linksData == nil {
+		return
+	}
+	c.SchemaVersion = currentSchemaVersion
+	configMap, err := c.ToMap()
+	if err != nil {
+		p.API.LogError("Failed to save the schema version of the links", "error", err.Error())
+		return
+	}
+	if appErr := p.API.SavePluginConfig(configMap); appErr != nil {
+		p.API.LogError("Failed to save the schema version of the links", "error", appErr.Error())
+	}
+}
+
+// migrateConfigLinks upgrades the links of the configuration. The fields that
+// no longer exist were dropped when the configuration was loaded, unlike those
+// of the links saved in the KV store.
+func migrateConfigLinks(c *Config) error {
+	if len(c.Links) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(c.Links)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode the links of the configuration")
+	}
+	migrated, changed, err := migrateLinks(data, c.SchemaVersion)
+	if err != nil || !changed {
+		return err
+	}
+	links := []autolink.Autolink{}
+	if err := json.Unmarshal(migrated, &links); err != nil {
+		return errors.Wrap(err, "failed to decode the migrated links of the configuration")
+	}
+	c.Links = links
+	return nil
+}
+
+// migrateLinks upgrades the JSON list of links from the schema version, and
+// reports whether any link changed.
+func migrateLinks(data []byte, version int) ([]byte, bool, error) {
+	if data == nil || version >= len(migrations) {
+		return data, false, nil
+	}
+
+	var links []map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	// Numbers are kept as they are written, not converted to float64
+	decoder.UseNumber()
+	if err := decoder.Decode(&links); err != nil {
+		return nil, false, errors.Wrap(err, "failed to decode the links to migrate")
+	}
+
+	changed := false
+	for _, migrate := range migrations[version:] {
+		for _, link := range links {
+			if link != nil && migrate(link) {
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return data, false, nil
+	}
+
+	migrated, err := json.Marshal(links)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "failed to encode the migrated links")
+	}
+	return migrated, true, nil
+}
+
+// linkField returns the key of the field of the link, whose case may differ
+// from the field name since the links are decoded case-insensitively.
+func linkField(link map[string]interface{}, name string) (string, bool) {
+	if _, ok := link[name]; ok {
+		return name, true
+	}
+	for key := range link {
+		if strings.EqualFold(key, name) {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+var scopeSlashRegexp = regexp.MustCompile(`\s*/\s*`)
+
+// migrateScopes converts the scopes written as a single string to a list,
+// splits the entries holding several comma or whitespace separated scopes,
+// and removes the `~` prefix of channel names.
+func migrateScopes(link map[string]interface{}) bool {
+	key, ok := linkField(link, "Scope")
+	if !ok {
+		return false
+	}
+
+	var entries []string
+	alreadyList := false
+	switch scope := link[key].(type) {
+	case string:
+		entries = []string{scope}
+	case []interface{}:
+		alreadyList = true
+		for _, entry := range scope {
+			s, ok := entry.(string)
+			if !ok {
+				return false
+			}
+			entries = append(entries, s)
+		}
+	default:
+		return false
+	}
+
+	scopes := []string{}
+	for _, entry := range entries {
+		entry = scopeSlashRegexp.ReplaceAllString(entry, "/")
+		for _, scope := range strings.FieldsFunc(entry, func(r rune) bool { return r == ',' || unicode.IsSpace(r) }) {
+			if i := strings.Index(scope, "/"); i >= 0 {
+				scope = scope[:i+1] + strings.TrimPrefix(scope[i+1:], "~")
+			}
+			scopes = append(scopes, scope)
+		}
+	}
+
+	if alreadyList && len(scopes) == len(entries) {
+		same := true
+		for i := range scopes {
+			if scopes[i] != entries[i] {
+				same = false
+				break
+			}
+		}
+		if same {
+			return false
+		}
+	}
+	link[key] = scopes
+	return true
+}
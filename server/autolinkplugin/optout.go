@@ -0,0 +1,101 @@
+package autolinkplugin
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+)
+
+// userOptOutKeyPrefix prefixes the KV store keys of the users who opted out of
+// having their posts autolinked.
+const userOptOutKeyPrefix = "optout_user_"
+
+// channelOptOutKeyPrefix prefixes the KV store keys of the channels in which
+// autolinking was disabled by a channel admin.
+const channelOptOutKeyPrefix = "optout_channel_"
+
+// optOutCacheTTL is how long opt-out preferences are cached. Changes made on
+// another server of a cluster are sent to this one, and would otherwise take
+// up to that long to apply.
+const optOutCacheTTL = time.Minute
+
+// IsUserOptedOut reports whether the user opted out of having their posts
+// autolinked.
+func (p *Plugin) IsUserOptedOut(userID string) (bool, error) {
+	return p.getOptOut(userOptOutKeyPrefix + userID)
+}
+
+// SetUserOptedOut saves whether the user opted out of having their posts
+// autolinked.
+func (p *Plugin) SetUserOptedOut(userID string, optOut bool) error {
+	return p.setOptOut(userOptOutKeyPrefix+userID, optOut)
+}
+
+// IsChannelOptedOut reports whether autolinking is disabled in the channel.
+func (p *Plugin) IsChannelOptedOut(channelID string) (bool, error) {
+	return p.getOptOut(channelOptOutKeyPrefix + channelID)
+}
+
+// SetChannelOptedOut saves whether autolinking is disabled in the channel.
+func (p *Plugin) SetChannelOptedOut(channelID string, optOut bool) error {
+	return p.setOptOut(channelOptOutKeyPrefix+channelID, optOut)
+}
+
+func (p *Plugin) getOptOut(key string) (bool, error) {
+	if value, ok, found := p.optOutCache.Get(key); found && ok {
+		return value == "true", nil
+	}
+
+	data, appErr := p.API.KVGet(key)
+	if appErr != nil {
+		return false, errors.Wrap(appErr, "failed to get the opt-out preference")
+	}
+	optedOut := data != nil
+	p.optOutCache.Set(key, strconv.FormatBool(optedOut), true)
+	return optedOut, nil
+}
+
+func (p *Plugin) setOptOut(key string, optOut bool) error {
+	var appErr *model.AppError
+	if optOut {
+		appErr = p.API.KVSet(key, []byte("true"))
+	} else {
+		appErr = p.API.KVDelete(key)
+	}
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to save the opt-out preference")
+	}
+
+	p.optOutCache.Set(key, strconv.FormatBool(optOut), true)
+	p.publishClusterEvent(clusterEventOptOutChanged, []byte(key), model.PluginClusterEventSendTypeReliable)
+	return nil
+}
+
+// isPostOptedOut reports whether the author of the post opted out, or
+// autolinking is disabled in the channel of the post. Errors are logged, and the
+// post is then processed as usual.
+func (p *Plugin) isPostOptedOut(post *model.Post) bool {
+	if post.UserId != "" {
+		optedOut, err := p.IsUserOptedOut(post.UserId)
+		if err != nil {
+			p.API.LogWarn("Failed to check if the user opted out of autolinking", "user_id", post.UserId, "error", err.Error())
+		}
+		if optedOut {
+			return true
+		}
+	}
+
+	if post.ChannelId != "" {
+		optedOut, err := p.IsChannelOptedOut(post.ChannelId)
+		if err != nil {
+			p.API.LogWarn("Failed to check if autolinking is disabled in the channel", "channel_id", post.ChannelId, "error", err.Error())
+		}
+		if optedOut {
+			return true
+		}
+	}
+
+	return false
+}
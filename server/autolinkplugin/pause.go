@@ -0,0 +1,153 @@
+package autolinkplugin
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin"
+	"github.com/pkg/errors"
+)
+
+// pauseKey is the KV store key of the time until which autolinking is paused,
+// for all the servers of a cluster. It expires at that time.
+const pauseKey = "paused_until"
+
+// defaultPauseDuration is how long `/autolink pause` pauses autolinking
+// without a duration, and maxPauseDuration the longest pause, for autolinking
+// not to stay paused by mistake.
+const (
+	defaultPauseDuration = time.Hour
+	maxPauseDuration     = 7 * 24 * time.Hour
+)
+
+// pauseCheckInterval is how often the pause is read from the KV store, for
+// a pause made on another server of a cluster to apply if its cluster event
+// was lost.
+const pauseCheckInterval = time.Minute
+
+// pauseState is the time until which autolinking is paused, kept in memory
+// for posts to be processed without reading the KV store.
+type pauseState struct {
+	lock  sync.RWMutex
+	until time.Time
+}
+
+// PausedUntil returns the time until which autolinking is paused, or the zero
+// time if it is not.
+func (p *Plugin) PausedUntil() time.Time {
+	p.pause.lock.RLock()
+	defer p.pause.lock.RUnlock()
+
+	if !p.pause.until.After(time.Now()) {
+		return time.Time{}
+	}
+	return p.pause.until
+}
+
+// Pause pauses autolinking until the given time, or resumes it if the time is
+// zero.
+func (p *Plugin) Pause(until time.Time) error {
+	var appErr *model.AppError
+	if until.IsZero() {
+		appErr = p.API.KVDelete(pauseKey)
+	} else {
+		_, appErr = p.API.KVSetWithOptions(pauseKey, []byte(until.UTC().Format(time.RFC3339)), model.PluginKVSetOptions{
+			ExpireInSeconds: int64(time.Until(until)/time.Second) + 1,
+		})
+	}
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to save the pause")
+	}
+
+	p.pause.lock.Lock()
+	p.pause.until = until
+	p.pause.lock.Unlock()
+
+	var data []byte
+	if !until.IsZero() {
+		data = []byte(until.UTC().Format(time.RFC3339))
+	}
+	p.publishClusterEvent(clusterEventPauseChanged, data, model.PluginClusterEventSendTypeReliable)
+	return nil
+}
+
+// refreshPause reads the pause from the KV store.
+func (p *Plugin) refreshPause() {
+	data, appErr := p.API.KVGet(pauseKey)
+	if appErr != nil {
+		p.API.LogWarn("Failed to check if autolinking is paused", "error", appErr.Error())
+		return
+	}
+	var until time.Time
+	if len(data) > 0 {
+		var err error
+		if until, err = time.Parse(time.RFC3339, string(data)); err != nil {
+			p.API.LogWarn("Invalid pause", "value", string(data), "error", err.Error())
+			return
+		}
+	}
+
+	p.pause.lock.Lock()
+	p.pause.until = until
+	p.pause.lock.Unlock()
+}
+
+// isPaused reports whether autolinking is paused.
+func (p *Plugin) isPaused() bool {
+	return !p.PausedUntil().IsZero()
+}
+
+func executePause(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) > 1 {
+		return responsef(header.T("autolink.command.help"))
+	}
+	if resp := checkPauseAuthorized(p, header); resp != nil {
+		return resp
+	}
+
+	duration := defaultPauseDuration
+	if len(args) == 1 {
+		d, err := time.ParseDuration(args[0])
+		if err != nil || d <= 0 || d > maxPauseDuration {
+			return responsef(header.T("autolink.command.pause.invalid_duration"), args[0], maxPauseDuration)
+		}
+		duration = d
+	}
+
+	until := time.Now().Add(duration).Truncate(time.Second)
+	if err := p.Pause(until); err != nil {
+		return responsef(header.T("autolink.command.pause.failed"), err)
+	}
+	p.API.LogInfo("Autolinking paused", "user_id", header.UserId, "until", until.UTC().Format(time.RFC3339))
+	return responsef(header.T("autolink.command.pause.paused"), until.UTC().Format(time.RFC3339), duration)
+}
+
+func executeResume(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) != 0 {
+		return responsef(header.T("autolink.command.help"))
+	}
+	if resp := checkPauseAuthorized(p, header); resp != nil {
+		return resp
+	}
+
+	if err := p.Pause(time.Time{}); err != nil {
+		return responsef(header.T("autolink.command.pause.failed"), err)
+	}
+	p.API.LogInfo("Autolinking resumed", "user_id", header.UserId)
+	return responsef(header.T("autolink.command.resume.resumed"))
+}
+
+// checkPauseAuthorized returns the response rejecting the team admins, whose
+// commands are limited to the links of their teams, from pausing autolinking
+// for everyone, or nil.
+func checkPauseAuthorized(p *Plugin, header *model.CommandArgs) *model.CommandResponse {
+	filter, err := linkFilter(p, header)
+	if err != nil {
+		return responsef("%v", err)
+	}
+	if filter != nil {
+		return responsef(header.T("autolink.command.pause.not_authorized"))
+	}
+	return nil
+}
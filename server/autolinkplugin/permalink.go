@@ -0,0 +1,61 @@
+package autolinkplugin
+
+import (
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+// permalinkSnippetLength is the maximum number of characters of the message
+// of a linked post quoted by the permalink links.
+const permalinkSnippetLength = 80
+
+// postLookup returns the lookup of the posts linked by the permalink links in
+// the post. A linked post is only quoted if the author of the post may read
+// it, and if it is in the same channel or in a public channel, for the quote
+// not to disclose it to the members of the channel who may not read it.
+func (p *Plugin) postLookup(post *model.Post) autolink.PostLookup {
+	return func(postID string) (autolink.LinkedPost, bool) {
+		if !model.IsValidId(postID) {
+			return autolink.LinkedPost{}, false
+		}
+		linked, appErr := p.API.GetPost(postID)
+		if appErr != nil || linked.DeleteAt != 0 {
+			return autolink.LinkedPost{}, false
+		}
+		channel, appErr := p.API.GetChannel(linked.ChannelId)
+		if appErr != nil || channel.TeamId == "" {
+			return autolink.LinkedPost{}, false
+		}
+		if linked.ChannelId != post.ChannelId && channel.Type != model.ChannelTypeOpen {
+			return autolink.LinkedPost{}, false
+		}
+		if !p.API.HasPermissionToChannel(post.UserId, linked.ChannelId, model.PermissionReadChannel) {
+			return autolink.LinkedPost{}, false
+		}
+
+		siteURL := p.API.GetConfig().ServiceSettings.SiteURL
+		teamName, appErr := p.resolveTeamName(channel.TeamId)
+		if siteURL == nil || *siteURL == "" || appErr != nil {
+			return autolink.LinkedPost{}, false
+		}
+		return autolink.LinkedPost{
+			Snippet:   postSnippet(linked.Message),
+			Permalink: strings.TrimSuffix(*siteURL, "/") + "/" + teamName + "/pl/" + postID,
+		}, true
+	}
+}
+
+// postSnippet returns the beginning of the first line of a message.
+func postSnippet(message string) string {
+	message = strings.TrimSpace(message)
+	if i := strings.IndexAny(message, "\r\n"); i >= 0 {
+		message = strings.TrimSpace(message[:i])
+	}
+	if runes := []rune(message); len(runes) > permalinkSnippetLength {
+		return strings.TrimSpace(string(runes[:permalinkSnippetLength])) + "…"
+	}
+	return message
+}
@@ -3,8 +3,13 @@ package autolinkplugin
 import (
 	"fmt"
 	"net/http"
+	"path"
+	"sort"
 	"strings"
 	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/mattermost/mattermost-server/v6/model"
 	"github.com/mattermost/mattermost-server/v6/plugin"
@@ -12,8 +17,53 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/mattermost/mattermost-plugin-autolink/server/api"
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+	"github.com/mattermost/mattermost-plugin-autolink/server/enrich"
 )
 
+// optOutMarker at the start of a message disables autolinking for the post,
+// and is removed from the message.
+const optOutMarker = "!nolink"
+
+// optOutPostProp is the post prop disabling autolinking for the post. It is set
+// when the opt-out marker is removed, so that later edits are not processed
+// either.
+const optOutPostProp = "autolink_disabled"
+
+// originalMessagePostProp is the post prop keeping the message of a post before
+// it was autolinked, for its author to revert the rewrite.
+const originalMessagePostProp = "autolink_original_message"
+
+// rewrittenMessagePostProp is the post prop keeping the message the plugin
+// rewrote the post to, for reverting to be refused once the post was edited.
+const rewrittenMessagePostProp = "autolink_rewritten_message"
+
+// generatedPostProp is the post prop keeping the text the links generated in
+// the message, for the edits reprocessing the post to leave it as is.
+const generatedPostProp = "autolink_generated"
+
+// rewritePassesPostProp is the post prop counting the times the plugin
+// rewrote the post, to detect loops with other plugins rewriting it.
+const rewritePassesPostProp = "autolink_passes"
+
+// integrationPostProps are the post props marking the posts made by incoming
+// webhooks and OAuth apps.
+var integrationPostProps = []string{"from_webhook", "from_oauth_app"}
+
+// pluginPostProp is the post prop marking the posts made by plugins.
+const pluginPostProp = "from_plugin"
+
+// backgroundJobsInterval is how often links registered by other plugins are
+// checked for owners that are no longer installed, the plugin admins are
+// checked for deactivated users, expired links are reported to the plugin
+// admins, and the admin digest and the telemetry are sent when they are due.
+const backgroundJobsInterval = time.Hour
+
+// maxEnrichTime is how long the lookups of the enriched links may delay a
+// post. The matches whose lookups are not done by then are left unenriched,
+// and enriched in the next posts once the lookups are done.
+const maxEnrichTime = 2 * time.Second
+
 // Plugin the main struct for everything
 type Plugin struct {
 	plugin.MattermostPlugin
@@ -23,20 +73,211 @@ type Plugin struct {
 	// configuration and a mutex to control concurrent access
 	conf     *Config
 	confLock sync.RWMutex
+
+	// saveLock serializes the saves of the links, e.g. by concurrent
+	// commands
+	saveLock sync.Mutex
+
+	// translations of the command responses, by locale
+	translations map[string]map[string]string
+
+	// stopBackground is closed on deactivation to stop background jobs
+	stopBackground chan struct{}
+
+	// optOutCache caches the opt-out preferences of users and channels, by
+	// KV store key
+	optOutCache *enrich.Cache
+
+	// scopeCache caches the names of the channels and teams posts are made
+	// in, for scoped links
+	scopeCache *enrich.Cache
+
+	// enrichCaches are the caches of the enrichments of the links with an
+	// EnrichTTL, see linkEnrichCaches
+	enrichCaches     map[string]*enrich.Cache
+	enrichCachesLock sync.Mutex
+
+	// botUserID is the user ID of the plugin bot, once ensured
+	botUserID string
+	botLock   sync.Mutex
+
+	// diagnostics are reported by the status endpoint
+	diagnostics diagnostics
+
+	// webhooks are the events queued for the webhooks
+	webhooks webhooks
+
+	// suggestions counts the URLs posted, to suggest links generating them
+	suggestions suggestions
+
+	// usage counts the posts changed by the links, for the stats endpoint
+	usage usage
+
+	// pause is the pause of autolinking
+	pause pauseState
+
+	// pulls is when the links were last pulled on schedule
+	pulls pullState
+
+	// middlewares are the match middlewares of other plugins
+	middlewares middlewares
+
+	// throttle counts the posts processed in each channel, for
+	// MaxRewritesPerChannel
+	throttle channelThrottle
 }
 
 func New() *Plugin {
 	return &Plugin{
-		conf: new(Config),
+		conf:        new(Config),
+		optOutCache: enrich.NewCache(optOutCacheTTL, 0),
+		scopeCache:  enrich.NewCache(scopeCacheTTL, 0),
 	}
 }
 
 func (p *Plugin) OnActivate() error {
-	p.handler = api.NewHandler(p, p)
+	p.handler = api.NewHandler(p, p, p)
 
+	bundlePath, err := p.API.GetBundlePath()
+	if err != nil {
+		return errors.Wrap(err, "failed to get bundle path")
+	}
+	p.translations, err = loadTranslations(bundlePath)
+	if err != nil {
+		p.API.LogWarn("Failed to load translations", "error", err.Error())
+	}
+	// Register the command again, now with the translated autocomplete data
+	conf := p.getConfig()
+	go p.registerCommand(conf.EnableAdminCommand, conf.commandTrigger(), "")
+
+	// Bots may be disabled, the notifications are then not sent
+	if _, err = p.ensureBot(); err != nil {
+		p.API.LogWarn("Failed to ensure the bot", "error", err.Error())
+	}
+
+	p.stopBackground = make(chan struct{})
+	go p.runBackgroundJobs(p.stopBackground)
+
+	return nil
+}
+
+func (p *Plugin) OnDeactivate() error {
+	if p.stopBackground != nil {
+		close(p.stopBackground)
+		p.stopBackground = nil
+	}
 	return nil
 }
 
+func (p *Plugin) runBackgroundJobs(stop <-chan struct{}) {
+	ticker := time.NewTicker(backgroundJobsInterval)
+	defer ticker.Stop()
+	failuresTicker := time.NewTicker(failureCheckInterval)
+	defer failuresTicker.Stop()
+	webhooksTicker := time.NewTicker(webhookFlushInterval)
+	defer webhooksTicker.Stop()
+	suggestionsTicker := time.NewTicker(suggestionCheckInterval)
+	defer suggestionsTicker.Stop()
+	pauseTicker := time.NewTicker(pauseCheckInterval)
+	defer pauseTicker.Stop()
+	syncTicker := time.NewTicker(syncCheckInterval)
+	defer syncTicker.Stop()
+	statsTicker := time.NewTicker(statsShareInterval)
+	defer statsTicker.Stop()
+	throttleTicker := time.NewTicker(throttleWindow)
+	defer throttleTicker.Stop()
+
+	p.removeOrphanedPluginLinks()
+	p.notifyExpiredLinks(time.Now())
+	p.notifyFailures()
+	p.refreshPause()
+	p.loadMiddlewares()
+	for {
+		select {
+		case <-ticker.C:
+			p.removeOrphanedPluginLinks()
+			p.removeOrphanedMiddlewares()
+			p.refreshPluginAdmins()
+			p.notifyExpiredLinks(time.Now())
+			p.sendDigest(time.Now())
+			p.sendTelemetry(time.Now())
+		case <-failuresTicker.C:
+			p.notifyFailures()
+		case <-webhooksTicker.C:
+			p.sendWebhooks()
+		case <-suggestionsTicker.C:
+			p.suggestLinks()
+		case <-pauseTicker.C:
+			p.refreshPause()
+		case now := <-syncTicker.C:
+			p.pullScheduled(now)
+		case <-statsTicker.C:
+			p.shareStats()
+			p.saveUsage()
+		case now := <-throttleTicker.C:
+			p.reportThrottled(now)
+		case <-stop:
+			p.sendWebhooks()
+			p.saveUsage()
+			return
+		}
+	}
+}
+
+// removeOrphanedPluginLinks deletes the links that were registered by plugins
+// which are no longer installed.
+func (p *Plugin) removeOrphanedPluginLinks() {
+	links := p.GetLinks()
+	installed := map[string]bool{}
+	kept := make([]autolink.Autolink, 0, len(links))
+	for _, link := range links {
+		if link.PluginID == "" {
+			kept = append(kept, link)
+			continue
+		}
+
+		ok, checked := installed[link.PluginID]
+		if !checked {
+			ok = p.isPluginInstalled(link.PluginID)
+			installed[link.PluginID] = ok
+		}
+		if ok {
+			kept = append(kept, link)
+			continue
+		}
+		p.API.LogInfo("Removing link registered by an uninstalled plugin", "link", link.DisplayName(), "plugin_id", link.PluginID)
+	}
+
+	if len(kept) == len(links) {
+		return
+	}
+	if err := p.SaveLinks(kept); err != nil {
+		p.API.LogError("Failed to remove links registered by uninstalled plugins", "error", err.Error())
+	}
+}
+
+// isPluginInstalled errs on the side of keeping the links, only a plugin that
+// the server explicitly reports as not installed is considered removed.
+func (p *Plugin) isPluginInstalled(pluginID string) bool {
+	_, appErr := p.API.GetPluginStatus(pluginID)
+	if appErr == nil {
+		return true
+	}
+	if appErr.StatusCode == http.StatusNotFound {
+		return false
+	}
+
+	p.API.LogWarn("Failed to get plugin status", "plugin_id", pluginID, "error", appErr.Error())
+	return true
+}
+
+// IsAuthorizedViewer reports whether the user is one of the plugin viewers,
+// who may see all the links but not change them.
+func (p *Plugin) IsAuthorizedViewer(userID string) (bool, error) {
+	_, ok := p.getConfig().ViewerUserIds[userID]
+	return ok, nil
+}
+
 func (p *Plugin) IsAuthorizedAdmin(userID string) (bool, error) {
 	user, err := p.API.GetUser(userID)
 	if err != nil {
@@ -58,22 +299,88 @@ func (p *Plugin) IsAuthorizedAdmin(userID string) (bool, error) {
 	return false, nil
 }
 
+// IsAuthorizedTeamAdmin reports whether a user may manage links scoped to the
+// given teams, which requires team admin delegation to be enabled and the user
+// to be an admin of every one of the teams.
+func (p *Plugin) IsAuthorizedTeamAdmin(userID string, teamNames []string) (bool, error) {
+	if !p.getConfig().EnableTeamAdminDelegation || len(teamNames) == 0 {
+		return false, nil
+	}
+
+	for _, teamName := range teamNames {
+		team, appErr := p.API.GetTeamByName(teamName)
+		if appErr != nil && appErr.StatusCode == http.StatusNotFound && model.IsValidId(teamName) {
+			team, appErr = p.API.GetTeam(teamName)
+		}
+		if appErr != nil {
+			if appErr.StatusCode == http.StatusNotFound {
+				return false, nil
+			}
+			return false, errors.Wrapf(appErr, "failed to obtain information about team `%s`", teamName)
+		}
+		if !p.API.HasPermissionToTeam(userID, team.Id, model.PermissionManageTeam) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// scopeCacheTTL is how long the names of channels and teams are cached. A
+// renamed team is matched against scopes by its old name for up to that long.
+const scopeCacheTTL = 5 * time.Minute
+
 func (p *Plugin) resolveScope(channelID string) (string, string, *model.AppError) {
-	channel, cErr := p.API.GetChannel(channelID)
-	if cErr != nil {
-		return "", "", cErr
+	// The channel is cached as "teamID channelName", teams by their ID
+	var channelName, teamID string
+	if value, _, found := p.scopeCache.Get("channel_" + channelID); found {
+		split := strings.SplitN(value, " ", 2)
+		teamID, channelName = split[0], split[1]
+	} else {
+		channel, cErr := p.API.GetChannel(channelID)
+		if cErr != nil {
+			return "", "", cErr
+		}
+		channelName, teamID = channel.Name, channel.TeamId
+		p.scopeCache.Set("channel_"+channelID, teamID+" "+channelName, true)
 	}
 
-	if channel.TeamId == "" {
-		return channel.Name, "", nil
+	if teamID == "" {
+		return channelName, "", nil
 	}
 
-	team, tErr := p.API.GetTeam(channel.TeamId)
+	teamName, tErr := p.resolveTeamName(teamID)
 	if tErr != nil {
 		return "", "", tErr
 	}
+	return channelName, teamName, nil
+}
+
+// resolveTeamName returns the name of the team, cached by its ID.
+func (p *Plugin) resolveTeamName(teamID string) (string, *model.AppError) {
+	if teamName, _, found := p.scopeCache.Get("team_" + teamID); found {
+		return teamName, nil
+	}
+	team, appErr := p.API.GetTeam(teamID)
+	if appErr != nil {
+		return "", appErr
+	}
+	p.scopeCache.Set("team_"+teamID, team.Name, true)
+	return team.Name, nil
+}
 
-	return channel.Name, team.Name, nil
+// invalidateScope forgets the cached names of the channel of the post, if the
+// post reports that the channel was renamed or moved to another team, and
+// updates the scopes naming the channel by its former name.
+func (p *Plugin) invalidateScope(post *model.Post) {
+	switch post.Type {
+	case model.PostTypeDisplaynameChange, model.PostTypeMoveChannel:
+		previous, _, found := p.scopeCache.Get("channel_" + post.ChannelId)
+		p.scopeCache.Delete("channel_" + post.ChannelId)
+		if found {
+			p.renameChannelScopes(post.ChannelId, previous)
+		}
+	}
 }
 
 func (p *Plugin) inScope(scope []string, channelName string, teamName string) bool {
@@ -94,11 +401,11 @@ func (p *Plugin) inScope(scope []string, channelName string, teamName string) bo
 			return false
 		}
 
-		if splitLength == 1 && strings.EqualFold(split[0], teamName) {
+		if splitLength == 1 && p.matchScopeTeam(split[0], teamName) {
 			return true
 		}
 
-		scopeMatch := strings.EqualFold(split[0], teamName) && strings.EqualFold(split[1], channelName)
+		scopeMatch := p.matchScopeTeam(split[0], teamName) && p.matchScopeChannel(split[1], channelName, teamName)
 		if splitLength == 2 && scopeMatch {
 			return true
 		}
@@ -107,50 +414,772 @@ func (p *Plugin) inScope(scope []string, channelName string, teamName string) bo
 	return false
 }
 
+// matchScopeName reports whether a team or channel name matches the
+// corresponding part of a scope, which may be a glob pattern such as
+// `incident-*`. Names are matched case-insensitively.
+func matchScopeName(pattern, name string) bool {
+	matched, err := path.Match(strings.ToLower(pattern), strings.ToLower(name))
+	return err == nil && matched
+}
+
+// matchScopeTeam reports whether the team part of a scope matches the team,
+// by name or by ID.
+func (p *Plugin) matchScopeTeam(part, teamName string) bool {
+	if matchScopeName(part, teamName) {
+		return true
+	}
+	if !model.IsValidId(part) {
+		return false
+	}
+	name, appErr := p.resolveTeamName(part)
+	return appErr == nil && strings.EqualFold(name, teamName)
+}
+
+// matchScopeChannel reports whether the channel part of a scope matches the
+// channel of the team, by name or by ID.
+func (p *Plugin) matchScopeChannel(part, channelName, teamName string) bool {
+	if matchScopeName(part, channelName) {
+		return true
+	}
+	if !model.IsValidId(part) {
+		return false
+	}
+	name, team, appErr := p.resolveScope(part)
+	return appErr == nil && strings.EqualFold(name, channelName) && strings.EqualFold(team, teamName)
+}
+
+// optOut removes the opt-out marker from the post, and reports whether the
+// post should be left as is.
+func optOut(post *model.Post) bool {
+	trimmed := strings.TrimLeft(post.Message, " \t")
+	if trimmed == optOutMarker || strings.HasPrefix(trimmed, optOutMarker+" ") || strings.HasPrefix(trimmed, optOutMarker+"\n") {
+		post.Message = strings.TrimLeft(strings.TrimPrefix(trimmed, optOutMarker), " \t\r\n")
+		post.AddProp(optOutPostProp, true)
+		return true
+	}
+
+	disabled, _ := post.GetProp(optOutPostProp).(bool)
+	return disabled
+}
+
+// isIntegrationPost reports whether the post was made by an incoming webhook or
+// an OAuth app.
+func isIntegrationPost(post *model.Post) bool {
+	for _, prop := range integrationPostProps {
+		if value, _ := post.GetProp(prop).(string); value == "true" {
+			return true
+		}
+	}
+	return false
+}
+
+// isPluginPost reports whether the post was made by a plugin through the
+// plugin API.
+func isPluginPost(post *model.Post) bool {
+	value, _ := post.GetProp(pluginPostProp).(string)
+	return value == "true"
+}
+
 func (p *Plugin) ProcessPost(c *plugin.Context, post *model.Post) (*model.Post, string) {
+	return p.processPost(post, p.linkFired(post))
+}
+
+// linkFired returns the function recording the links that changed the post,
+// for the status endpoint and the webhooks.
+func (p *Plugin) linkFired(post *model.Post) func(autolink.Autolink, []string) {
+	return func(link autolink.Autolink, matches []string) {
+		p.diagnostics.linkFired(link)
+		p.usage.record(link.DisplayName(), post.ChannelId, time.Now())
+		if link.ShadowMode {
+			p.API.LogInfo("Shadow link matched a post", "link", link.DisplayName(), "post_id", post.Id,
+				"user_id", post.UserId, "channel_id", post.ChannelId)
+			return
+		}
+		if link.Kind == autolink.KindRedact {
+			// The audit trail of the redactions, without the text redacted
+			p.API.LogInfo("Redacted a post", "link", link.DisplayName(), "post_id", post.Id,
+				"user_id", post.UserId, "channel_id", post.ChannelId)
+		}
+		if link.Kind == autolink.KindReject {
+			p.API.LogInfo("Rejected a post", "link", link.DisplayName(),
+				"user_id", post.UserId, "channel_id", post.ChannelId)
+		}
+		p.queueWebhookEvent(post, link, matches)
+	}
+}
+
+// processPost rewrites the post, calling onMatch once with every link that
+// changed the message, and the text it matched if the link has a webhook. If
+// a reject link matches the post, it returns nil and the explanation of the
+// rejection instead.
+func (p *Plugin) processPost(post *model.Post, onMatch func(autolink.Autolink, []string)) (*model.Post, string) {
+	return p.processEditedPost(post, nil, onMatch, false)
+}
+
+// previewPost is like processPost, for a post that is not posted, e.g. to
+// test the links: it is not counted against the limit of posts per channel,
+// and the failures to resolve its channel are not recorded.
+func (p *Plugin) previewPost(post *model.Post, onMatch func(autolink.Autolink, []string)) (*model.Post, string) {
+	return p.processEditedPost(post, nil, onMatch, true)
+}
+
+// processEditedPost is like processPost, but only rewrites the text inserted
+// by the edit, if not nil, and only previews the post if preview is true.
+func (p *Plugin) processEditedPost(post *model.Post, edit *messageEdit, onMatch func(autolink.Autolink, []string), preview bool) (*model.Post, string) {
+	// The opt-out marker is removed from every post, including those skipped
+	// for other reasons
+	optedOut := optOut(post)
+
+	// The messages of the plugin bot are left as they are
+	if isPluginPost(post) && p.isBotPost(post) {
+		return post, ""
+	}
+
 	conf := p.getConfig()
+	if conf.MaxMessageSize > 0 && len(post.Message) > conf.MaxMessageSize*1024 {
+		p.API.LogDebug("Message too large to be autolinked", "post_id", post.Id, "size", len(post.Message), "max_size", conf.MaxMessageSize*1024)
+		return post, ""
+	}
 
-	message := post.Message
-	changed := false
-	offset := 0
+	// The reject links still apply to the posts that are not autolinked, for
+	// users not to get around them
+	links := conf.Links
+	if edit != nil {
+		links = linksOnUpdate(conf, links)
+	}
+	skipped := (edit != nil && edit.skipped) || (conf.SkipFileComments && len(post.FileIds) > 0) || optedOut || isExcludedPost(post, conf) || p.isPostOptedOut(post) || p.isPaused() || p.tooManyPasses(post, conf) || (!preview && p.throttled(post, conf))
+	if skipped {
+		links = rejectLinks(links)
+		if len(links) == 0 {
+			return post, ""
+		}
+	}
 
-	hasOneOrMoreScopes := false
+	// The channel and team are needed by scoped links and by post variables
+	needsChannel := false
 	for _, link := range conf.Links {
-		if len(link.Scope) > 0 {
-			hasOneOrMoreScopes = true
+		if len(link.Scope) > 0 || link.UsesPostContext() {
+			needsChannel = true
 			break
 		}
 	}
 
 	channelName := ""
 	teamName := ""
-	if hasOneOrMoreScopes {
+	if needsChannel {
 		cn, tn, rsErr := p.resolveScope(post.ChannelId)
 		channelName = cn
 		teamName = tn
 
-		if rsErr != nil {
+		if rsErr != nil && !preview {
 			p.API.LogError("Failed to resolve scope", "error", rsErr.Error())
+			p.diagnostics.scopeFailed(rsErr)
 		}
 	}
 
 	var author *model.User
 	var authorErr *model.AppError
+	getAuthor := func() *model.User {
+		if author == nil && authorErr == nil {
+			author, authorErr = p.API.GetUser(post.UserId)
+			if authorErr != nil {
+				// NOTE: Not sure how we want to handle errors here, we can either:
+				// * assume that occasional rewrites of Bot messges are ok
+				// * assume that occasional not rewriting of all messages is ok
+				// Let's assume for now that former is a lesser evil and carry on.
+				p.API.LogError("failed to check if message for rewriting was send by a bot", "error", authorErr)
+			}
+		}
+		return author
+	}
+
+	var root *model.Post
+	rootFetched := false
+	getRootMessage := func() (string, bool) {
+		if !rootFetched && post.RootId != "" {
+			rootFetched = true
+			var appErr *model.AppError
+			root, appErr = p.API.GetPost(post.RootId)
+			if appErr != nil {
+				p.API.LogError("Failed to get the root post of the thread", "root_id", post.RootId, "error", appErr.Error())
+			}
+		}
+		if root == nil {
+			return "", false
+		}
+		// The links are matched against the root post as it was written
+		if original, ok := root.GetProp(originalMessagePostProp).(string); ok {
+			return original, true
+		}
+		return root.Message, true
+	}
+
+	// Only the links applying to the channel go through the message
+	links = p.linksInScope(conf, channelName, teamName)
+	if edit != nil {
+		links = linksOnUpdate(conf, links)
+	}
+	if skipped {
+		links = rejectLinks(links)
+	}
+
+	// Links matching after a link with TerminalPost, in an earlier part of the
+	// message, are undone by rewriting it without them
+	links = p.mergeTeamLinks(links, channelName, teamName)
+	var result rewriteResult
+	for {
+		result = p.rewriteMessage(post, conf, links, channelName, teamName, getAuthor, getRootMessage, edit)
+		if result.terminalAt < 0 || result.terminalAt == len(links)-1 {
+			break
+		}
+		links = links[:result.terminalAt+1]
+	}
+
+	if onMatch != nil {
+		// A link matching several parts of the message is reported once
+		names := []string{}
+		links := map[string]autolink.Autolink{}
+		matches := map[string][]string{}
+		for i, link := range result.matched {
+			name := link.DisplayName()
+			if _, ok := links[name]; !ok {
+				names = append(names, name)
+				links[name] = link
+			}
+			matches[name] = append(matches[name], result.matches[i]...)
+		}
+		for _, name := range names {
+			onMatch(links[name], matches[name])
+		}
+	}
+
+	if len(result.truncated) != 0 {
+		names := []string{}
+		for name := range result.truncated {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		p.API.LogWarn("Maximum number of replacements reached, remaining matches were not linked",
+			"post_id", post.Id, "links", strings.Join(names, ", "))
+	}
+
+	if result.rejection != "" {
+		return nil, result.rejection
+	}
+	if skipped {
+		return post, ""
+	}
+
+	// The message of a redacted post is not kept for reverting, which would
+	// restore the text redacted
+	redacted := false
+	for _, link := range result.matched {
+		redacted = redacted || (link.Kind == autolink.KindRedact && !link.ShadowMode)
+	}
+	if result.changed {
+		if redacted {
+			clearRevertPostProps(post)
+		} else {
+			post.AddProp(originalMessagePostProp, post.Message)
+			post.AddProp(rewrittenMessagePostProp, result.message)
+		}
+		post.Message = result.message
+		post.Hashtags, _ = model.ParseHashtags(result.message)
+		post.AddProp(rewritePassesPostProp, rewritePasses(post)+1)
+		if !preview {
+			p.countRewrite(post, conf)
+		}
+	} else {
+		// The post was edited to a message that is not rewritten, which
+		// reverting must not replace.
+		clearRevertPostProps(post)
+	}
+	if len(linksOnUpdate(conf, conf.Links)) > 0 {
+		recordGenerated(post, result.generated)
+	}
+	addAttachments(post, result.attachments)
+	return post, ""
+}
+
+// maxDebugSnippet is the maximum number of characters of the text logged by
+// the links with Debug.
+const maxDebugSnippet = 100
+
+// debugSnippet returns the beginning of the text, for the logs of the links
+// with Debug not to repeat whole messages.
+func debugSnippet(text string) string {
+	if utf8.RuneCountInString(text) <= maxDebugSnippet {
+		return text
+	}
+	return string([]rune(text)[:maxDebugSnippet]) + "…"
+}
+
+// recordedGenerated returns the text the links generated in the message of
+// the post, as recorded by recordGenerated.
+func recordedGenerated(post *model.Post) []string {
+	// The texts are decoded as []interface{} once the post was saved
+	var texts []string
+	switch recorded := post.GetProp(generatedPostProp).(type) {
+	case []string:
+		texts = recorded
+	case []interface{}:
+		for _, text := range recorded {
+			if text, ok := text.(string); ok {
+				texts = append(texts, text)
+			}
+		}
+	}
+	return texts
+}
+
+// recordGenerated records the text the links generated in the message of the
+// post, along with the text recorded before still found in it.
+func recordGenerated(post *model.Post, generated []string) {
+	texts := []string{}
+	seen := map[string]bool{}
+	for _, text := range append(recordedGenerated(post), generated...) {
+		if text == "" || seen[text] || !strings.Contains(post.Message, text) {
+			continue
+		}
+		seen[text] = true
+		texts = append(texts, text)
+	}
+	if len(texts) == 0 {
+		post.DelProp(generatedPostProp)
+		return
+	}
+	post.AddProp(generatedPostProp, texts)
+}
+
+// rewritePasses returns the number of times the plugin rewrote the post.
+func rewritePasses(post *model.Post) int {
+	// Numbers are decoded as float64 once the post was saved
+	switch passes := post.GetProp(rewritePassesPostProp).(type) {
+	case int:
+		return passes
+	case float64:
+		return int(passes)
+	}
+	return 0
+}
+
+// tooManyPasses reports whether the post was rewritten the maximum number of
+// times, which happens when another plugin, or an edit with EnableOnUpdate,
+// keeps triggering rewrites, e.g. making the text of templates grow each time.
+func (p *Plugin) tooManyPasses(post *model.Post, conf *Config) bool {
+	passes := rewritePasses(post)
+	if conf.MaxRewritePasses <= 0 || passes < conf.MaxRewritePasses {
+		return false
+	}
+	p.API.LogWarn("Post rewritten too many times, it is no longer autolinked", "post_id", post.Id, "passes", passes)
+	return true
+}
+
+// maxAttachmentsPerPost is the maximum number of attachments the links add to
+// a single post.
+const maxAttachmentsPerPost = 10
+
+// addAttachments adds the attachments generated by the links to the post,
+// except those it already has, e.g. when it is edited.
+func addAttachments(post *model.Post, attachments []autolink.Attachment) {
+	if len(attachments) == 0 {
+		return
+	}
+
+	existing := post.Attachments()
+	all := append([]*model.SlackAttachment{}, existing...)
+	added := 0
+	for _, a := range attachments {
+		attachment := &model.SlackAttachment{
+			Fallback:  a.Title,
+			Title:     a.Title,
+			TitleLink: a.TitleLink,
+			Text:      a.Text,
+			Color:     a.Color,
+		}
+		if attachment.Fallback == "" {
+			attachment.Fallback = a.Text
+		}
+		for _, f := range a.Fields {
+			attachment.Fields = append(attachment.Fields, &model.SlackAttachmentField{
+				Title: f.Title,
+				Value: f.Value,
+				Short: model.SlackCompatibleBool(f.Short),
+			})
+		}
+
+		duplicate := false
+		for _, other := range all {
+			if other.Title == attachment.Title && other.TitleLink == attachment.TitleLink && other.Text == attachment.Text {
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			continue
+		}
+		if added == maxAttachmentsPerPost {
+			break
+		}
+		all = append(all, attachment)
+		added++
+	}
+	if added > 0 {
+		model.ParseSlackAttachment(post, all)
+	}
+}
+
+// rewriteResult is the message rewritten by rewriteMessage.
+type rewriteResult struct {
+	message string
+	changed bool
+	// matched are the links that changed the message, and matches the text
+	// they matched in each part of it, for the links with a webhook
+	matched []autolink.Autolink
+	matches [][]string
+	// truncated are the names of the links that reached their replacement
+	// limit
+	truncated map[string]bool
+	// attachments are the attachments generated by the links
+	attachments []autolink.Attachment
+	// terminalAt is the index of the first link with TerminalPost that
+	// changed the message, -1 if there is none
+	terminalAt int
+	// rejection is the explanation of the first reject link matching the
+	// message, if any
+	rejection string
+	// generated is the text generated for each match
+	generated []string
+}
+
+// rewriteMessage applies the links to the text of the message of the post.
+func (p *Plugin) rewriteMessage(post *model.Post, conf *Config, links []autolink.Autolink, channelName, teamName string, getAuthor func() *model.User, getRootMessage func() (string, bool), edit *messageEdit) rewriteResult {
+	result := rewriteResult{
+		message:    post.Message,
+		truncated:  map[string]bool{},
+		terminalAt: -1,
+	}
+	offset := 0
+	fromIntegration := isIntegrationPost(post)
+	fromPlugin := isPluginPost(post)
+	now := time.Now()
+	enrichDeadline := now.Add(maxEnrichTime)
+
+	// Replacements made by each link, for the replacement limits
+	replacements := make([]int, len(links))
+	totalReplacements := 0
+	// Matches replaced by each FirstMatchOnly link, shared by all the parts
+	// of the message
+	replaced := make([]map[string]bool, len(links))
+	// Time each link took to process the message, if slow links are
+	// detected, and whether it ran at all
+	timeLinks := conf.SlowLinkThreshold > 0
+	durations := make([]time.Duration, len(links))
+	ran := make([]bool, len(links))
+
+	var postContext *autolink.PostContext
+	getPostContext := func() *autolink.PostContext {
+		if postContext == nil {
+			postContext = &autolink.PostContext{
+				ChannelName: channelName,
+				TeamName:    teamName,
+				CreateAt:    now,
+			}
+			if post.CreateAt != 0 {
+				postContext.CreateAt = model.GetTimeForMillis(post.CreateAt)
+			}
+			if author := getAuthor(); author != nil {
+				postContext.Username = author.Username
+				postContext.Locale = author.Locale
+			}
+		}
+		return postContext
+	}
+
+	// The match middlewares of other plugins, if any, check each match
+	filter := p.matchFilter(post, channelName, teamName)
+
+	// skipReason returns why the link is not applied to the text of the kind,
+	// or "" if it is
+	skipReason := func(link autolink.Autolink, kind textKind) string {
+		if !link.IsActive(now) {
+			return "inactive"
+		}
+		if !appliesToText(link, kind) {
+			return "text kind"
+		}
+		// The links are those in the scope of the channel, as given by
+		// linksInScope, but for the links with Debug
+		if link.Debug && !p.inScope(link.Scope, channelName, teamName) {
+			return "out of scope"
+		}
+		if fromIntegration && conf.SkipIntegrationPosts && !link.ProcessIntegrationPosts {
+			return "integration post"
+		}
+		if fromPlugin && !conf.ProcessPluginPosts && !link.ProcessPluginPosts {
+			return "plugin post"
+		}
+		if !link.AppliesToThread(post.RootId != "", getRootMessage) {
+			return "thread"
+		}
+		return ""
+	}
+
+	// The label text of markdown links is only processed by the links with
+	// ProcessLinkLabels, if any. labels are its nodes.
+	processesLabels, processesCode := false, false
+	for _, link := range links {
+		processesLabels = processesLabels || link.ProcessLinkLabels
+		processesCode = processesCode || link.CodeBlocks || link.CodeSpans
+	}
+	labels := map[markdown.Inline]bool{}
+	// The lines of the paragraphs are processed together when links apply
+	// across them. acrossLines are the ends of the lines processed together,
+	// by the position of the first line, and linesEnd the end of the lines
+	// being processed.
+	var referenceDefinitions []*markdown.ReferenceDefinition
+	processesAcrossLines := false
+	for _, link := range links {
+		processesAcrossLines = processesAcrossLines || link.AcrossLines
+	}
+	if processesAcrossLines {
+		_, referenceDefinitions = markdown.Parse(post.Message)
+	}
+	acrossLines := map[int]int{}
+	linesEnd := 0
+	// codeFrom is where the next code span of the paragraph is looked for,
+	// the code spans not knowing their position
+	codeFrom := 0
+
+	// process applies the links to the text found at position in the
+	// message. It returns the text rewritten, or for code, which is left as
+	// is, the text generated for the matches.
+	process := func(toProcess string, position int, kind textKind) (string, []string) {
+		// The text generated by Terminal links, and the text not inserted
+		// by an edit, are kept out of the reach of the next links
+		spans := edit.spans(toProcess, position)
+		processed := toProcess
+		var generated []string
+		for i, link := range links {
+			if result.terminalAt >= 0 && i > result.terminalAt {
+				break
+			}
+			if reason := skipReason(link, kind); reason != "" {
+				if link.Debug {
+					p.API.LogDebug("Link skipped", "link", link.DisplayName(), "post_id", post.Id,
+						"input", debugSnippet(toProcess), "reason", reason)
+				}
+				continue
+			}
+			// Plugin posts are usually made by a bot, whose posts the plugin
+			// option allows unless the link denies that bot
+			processesPlugin := fromPlugin && (conf.ProcessPluginPosts || link.ProcessPluginPosts)
+
+			if link.UsesPostContext() {
+				link.SetPostContext(getPostContext())
+			}
+			if filter != nil {
+				link.SetMatchFilter(filter)
+			}
+			if link.Kind == autolink.KindPermalink {
+				link.SetPostLookup(p.postLookup(post))
+			}
+			if link.Enrich != "" {
+				link.SetEnrichDeadline(enrichDeadline)
+			}
+			if link.FirstMatchOnly {
+				if replaced[i] == nil {
+					replaced[i] = map[string]bool{}
+				}
+				link.SetReplaced(replaced[i])
+			}
+			var started time.Time
+			var elapsed time.Duration
+			if timeLinks || link.Debug {
+				started = time.Now()
+			}
+			inserted := edit.insertedText(processed, spans)
+			rejection, rejected := link.Rejection(inserted)
+			attachments := link.Attachments(inserted)
+			outSpans, out, count := spans, processed, 0
+			var linkGenerated []string
+			if link.ReplacesMatches() {
+				limit := replacementLimit(conf, link, replacements[i], totalReplacements)
+				var linkTruncated bool
+				if kind.isCode() {
+					linkGenerated, count, linkTruncated = generatedTexts(link, spans, limit)
+				} else {
+					outSpans, linkGenerated, count, linkTruncated = replaceSpans(link, spans, limit)
+					out = joinSpans(outSpans)
+				}
+				if linkTruncated && !link.ShadowMode {
+					result.truncated[link.DisplayName()] = true
+				}
+			}
+			if timeLinks || link.Debug {
+				elapsed = time.Since(started)
+			}
+			if timeLinks {
+				durations[i] += elapsed
+				ran[i] = true
+			}
+			matched := out != processed || len(linkGenerated) > 0 || len(attachments) > 0 || rejected
+			if link.Debug {
+				p.API.LogDebug("Link evaluated", "link", link.DisplayName(), "post_id", post.Id,
+					"input", debugSnippet(inserted), "matched", matched, "matches", len(link.Matches(inserted)),
+					"duration", elapsed.String())
+			}
+			if !matched {
+				continue
+			}
+
+			if link.ChecksBots() {
+				if author := getAuthor(); author != nil && author.IsBot && !link.ProcessesBot(author.Username) &&
+					(!processesPlugin || link.DeniesBot(author.Username)) {
+					if link.Debug {
+						p.API.LogDebug("Link skipped", "link", link.DisplayName(), "post_id", post.Id,
+							"input", debugSnippet(inserted), "reason", "bot post")
+					}
+					continue
+				}
+			}
+
+			// The text redacted is not sent to the webhooks
+			var matches []string
+			if webhookURL(conf, link) != "" && link.Kind != autolink.KindRedact {
+				matches = link.Matches(inserted)
+			}
+
+			// Shadow links are only recorded, the post is left as is
+			if link.ShadowMode {
+				result.matched = append(result.matched, link)
+				result.matches = append(result.matches, matches)
+				continue
+			}
+
+			if rejected && result.rejection == "" {
+				result.rejection = rejection
+			}
+			spans = outSpans
+			processed = out
+			generated = append(generated, linkGenerated...)
+			result.generated = append(result.generated, linkGenerated...)
+			replacements[i] += count
+			totalReplacements += count
+			result.matched = append(result.matched, link)
+			result.matches = append(result.matches, matches)
+			result.attachments = append(result.attachments, attachments...)
+			if link.TerminalPost {
+				result.terminalAt = i
+				break
+			}
+		}
+		return processed, generated
+	}
+
+	// insert inserts text at position in the message, before the text
+	// processed next.
+	insert := func(position int, text string) {
+		result.message = result.message[:position+offset] + text + result.message[position+offset:]
+		offset += len(text)
+		result.changed = true
+	}
 
 	markdown.Inspect(post.Message, func(node interface{}) bool {
 		if node == nil {
 			return false
 		}
 
-		toProcess, start, end := "", 0, 0
+		toProcess, start, end, position := "", 0, 0, 0
+		kind := textPlain
 		switch node := node.(type) {
-		// never descend into the text content of a link/image
-		case *markdown.InlineLink, *markdown.InlineImage, *markdown.ReferenceLink, *markdown.ReferenceImage:
+		case *markdown.Paragraph:
+			if len(node.Text) > 0 {
+				codeFrom = node.Text[0].Position
+			}
+			if processesAcrossLines {
+				inlines := markdown.MergeInlineText(node.ParseInlines(referenceDefinitions))
+				for first, end := range paragraphLines(post.Message, inlines) {
+					acrossLines[first] = end
+				}
+			}
+			return true
+
+		// never descend into the text content of an image
+		case *markdown.InlineImage:
+			codeFrom = node.RawDestination.End
+			return false
+		case *markdown.ReferenceImage:
 			return false
 
+		case *markdown.InlineLink, *markdown.ReferenceLink:
+			if link, ok := node.(*markdown.InlineLink); ok {
+				codeFrom = link.RawDestination.End
+			}
+			if !processesLabels {
+				return false
+			}
+			var children []markdown.Inline
+			if link, ok := node.(*markdown.InlineLink); ok {
+				children = link.Children
+			} else {
+				children = node.(*markdown.ReferenceLink).Children
+			}
+			for _, child := range children {
+				markdown.InspectInline(child, func(inline markdown.Inline) bool {
+					if inline != nil {
+						labels[inline] = true
+					}
+					return true
+				})
+			}
+			return true
+
+		case *markdown.CodeSpan:
+			// The code spans of labels are left as is, for the generated
+			// text not to end up in the label
+			if !processesCode || labels[node] {
+				return true
+			}
+			codeStart, codeEnd, spanEnd, ok := findCodeSpan(post.Message, codeFrom, node.Code)
+			if !ok {
+				return true
+			}
+			codeFrom = spanEnd
+			if _, generated := process(post.Message[codeStart:codeEnd], codeStart, textCodeSpan); len(generated) > 0 {
+				insert(spanEnd, " ("+strings.Join(generated, ", ")+")")
+			}
+			return true
+
+		case *markdown.FencedCode, *markdown.IndentedCode:
+			if !processesCode {
+				return true
+			}
+			lines, blockEnd, prefix := codeBlockLines(post.Message, node)
+			var generated []string
+			for _, line := range lines {
+				_, lineGenerated := process(post.Message[line.Position:line.End], line.Position, textCodeBlock)
+				generated = append(generated, lineGenerated...)
+			}
+			if len(generated) > 0 {
+				text := "\n" + prefix + "\n" + prefix + strings.Join(generated, ", ")
+				if blockEnd < len(post.Message) {
+					text += "\n" + prefix
+				}
+				insert(blockEnd, text)
+			}
+			return true
+
 		case *markdown.Autolink:
-			start, end = node.RawDestination.Position+offset, node.RawDestination.End+offset
-			toProcess = message[start:end]
+			// URLs in labels are left as is, like the URL of the link
+			if labels[node] {
+				return false
+			}
+
+			position = node.RawDestination.Position
+			start, end = position+offset, node.RawDestination.End+offset
+			codeFrom = node.RawDestination.End
+			toProcess = result.message[start:end]
 			// Do not process escaped links. Not exactly sure why but preserving the previous behavior.
 			// https://mattermost.atlassian.net/browse/MM-42669
 			if markdown.Unescape(toProcess) != toProcess {
@@ -159,8 +1188,24 @@ func (p *Plugin) ProcessPost(c *plugin.Context, post *model.Post) (*model.Post,
 			}
 
 		case *markdown.Text:
-			start, end = node.Range.Position+offset, node.Range.End+offset
-			toProcess = message[start:end]
+			if labels[node] {
+				kind = textLabel
+			}
+			// The line was processed with the lines before it
+			if node.Range.Position < linesEnd {
+				return true
+			}
+			position = node.Range.Position
+			if lastEnd, ok := acrossLines[position]; ok {
+				linesEnd = lastEnd
+				start, end = position+offset, lastEnd+offset
+				codeFrom = linesEnd
+				toProcess = result.message[start:end]
+				break
+			}
+			start, end = position+offset, node.Range.End+offset
+			codeFrom = node.Range.End
+			toProcess = result.message[start:end]
 			if node.Text != toProcess {
 				p.API.LogDebug("skipping text: parsed markdown did not match original", "parsed", node.Text, "original", toProcess, "post_id", post.Id)
 				return true
@@ -171,70 +1216,320 @@ func (p *Plugin) ProcessPost(c *plugin.Context, post *model.Post) (*model.Post,
 			return true
 		}
 
-		processed := toProcess
-		for _, link := range conf.Links {
-			if !p.inScope(link.Scope, channelName, teamName) {
-				continue
-			}
-
-			out := link.Replace(processed)
-			if out == processed {
-				continue
-			}
+		processed, _ := process(toProcess, position, kind)
+		if toProcess != processed {
+			result.message = result.message[:start] + processed + result.message[end:]
+			offset += len(processed) - len(toProcess)
+			result.changed = true
+		}
 
-			if !link.ProcessBotPosts {
-				if author == nil && authorErr == nil {
-					author, authorErr = p.API.GetUser(post.UserId)
-					if authorErr != nil {
-						// NOTE: Not sure how we want to handle errors here, we can either:
-						// * assume that occasional rewrites of Bot messges are ok
-						// * assume that occasional not rewriting of all messages is ok
-						// Let's assume for now that former is a lesser evil and carry on.
-						p.API.LogError("failed to check if message for rewriting was send by a bot", "error", authorErr)
-					}
-				}
+		return true
+	})
 
-				if author != nil && author.IsBot {
-					continue
-				}
-			}
+	for i, link := range links {
+		if ran[i] {
+			p.diagnostics.linkTimed(link.DisplayName(), durations[i])
+		}
+	}
+	return result
+}
 
-			processed = out
+// replaceSpans applies the link to the spans that were not generated by a
+// Terminal link, substituting at most limit matches if it is not negative. The
+// text generated by the link is kept in its own spans if it is Terminal. The
+// text generated for each match is returned too.
+func replaceSpans(link autolink.Autolink, spans []autolink.Span, limit int) ([]autolink.Span, []string, int, bool) {
+	out := make([]autolink.Span, 0, len(spans))
+	var generated []string
+	total := 0
+	truncated := false
+	if !link.AcrossLines {
+		spans = splitLines(spans)
+	}
+	for _, span := range spans {
+		if span.Replaced {
+			out = append(out, span)
+			continue
 		}
 
-		if toProcess != processed {
-			message = message[:start] + processed + message[end:]
-			offset += len(processed) - len(toProcess)
-			changed = true
+		n := limit
+		if limit >= 0 {
+			n = limit - total
+		}
+		replaced, count, spanTruncated := link.ReplaceSpans(span.Text, n)
+		for _, s := range replaced {
+			if s.Replaced {
+				generated = append(generated, s.Text)
+			}
 		}
+		total += count
+		truncated = truncated || spanTruncated
+		if link.IsTerminal() {
+			out = append(out, replaced...)
+			continue
+		}
+		out = append(out, autolink.Span{Text: joinSpans(replaced)})
+	}
+	return out, generated, total, truncated
+}
 
-		return true
-	})
+func joinSpans(spans []autolink.Span) string {
+	text := ""
+	for _, span := range spans {
+		text += span.Text
+	}
+	return text
+}
 
-	if changed {
-		post.Message = message
-		post.Hashtags, _ = model.ParseHashtags(message)
+// replacementLimit returns how many more matches of the link can be replaced
+// in the post, or -1 if there is no limit.
+func replacementLimit(conf *Config, link autolink.Autolink, linkReplacements, totalReplacements int) int {
+	limit := -1
+	if link.MaxReplacements > 0 {
+		limit = link.MaxReplacements - linkReplacements
 	}
-	return post, ""
+	if conf.MaxReplacementsPerPost > 0 {
+		rest := conf.MaxReplacementsPerPost - totalReplacements
+		if limit < 0 || rest < limit {
+			limit = rest
+		}
+	}
+	return limit
 }
 
 func (p *Plugin) ServeHTTP(c *plugin.Context, w http.ResponseWriter, r *http.Request) {
 	p.handler.ServeHTTP(w, r)
 }
 
+// RateLimits returns the configured rate limits of the HTTP API.
+func (p *Plugin) RateLimits() (perUser, perIP int) {
+	conf := p.getConfig()
+	return conf.APIRateLimitPerUser, conf.APIRateLimitPerIP
+}
+
+// TrustedProxies returns the configured reverse proxies of the HTTP API.
+func (p *Plugin) TrustedProxies() []string {
+	return strings.FieldsFunc(p.getConfig().APITrustedProxies, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+}
+
+// RateLimited logs the callers exceeding the rate limits of the HTTP API.
+func (p *Plugin) RateLimited(caller string) {
+	p.API.LogWarn("Rate limit of the API exceeded", "caller", caller)
+}
+
 // MessageWillBePosted is invoked when a message is posted by a user before it is committed
 // to the database.
 func (p *Plugin) MessageWillBePosted(c *plugin.Context, post *model.Post) (*model.Post, string) {
+	clearSentLaterPostProps(post)
+	p.invalidateScope(post)
+	if p.getConfig().EnableSuggestions {
+		p.suggestions.record(post)
+	}
 	return p.ProcessPost(c, post)
 }
 
+// sentLaterPostProps are the props describing how the plugin rewrote a post,
+// which a post created without an ID only has if they were copied from
+// another message.
+var sentLaterPostProps = []string{originalMessagePostProp, rewrittenMessagePostProp, generatedPostProp, rewritePassesPostProp}
+
+// clearSentLaterPostProps removes the props of the plugin from a new post.
+// Posts sent later, as scheduled posts or from drafts, are created with the
+// props of the draft when they land in the channel, which may come from a
+// message rewritten before, e.g. a draft restored from an autolinked post.
+// They would otherwise keep the post from being autolinked, or reverted to
+// another message. The posts created again with their ID, e.g. by plugins
+// rewriting them, keep their props for the loops to be detected.
+func clearSentLaterPostProps(post *model.Post) {
+	if post.Id != "" {
+		return
+	}
+	for _, prop := range sentLaterPostProps {
+		if post.GetProp(prop) != nil {
+			post.DelProp(prop)
+		}
+	}
+}
+
 // MessageWillBeUpdated is invoked when a message is updated by a user before it is committed
 // to the database.
-func (p *Plugin) MessageWillBeUpdated(c *plugin.Context, post *model.Post, _ *model.Post) (*model.Post, string) {
-	conf := p.getConfig()
-	if !conf.EnableOnUpdate {
+//
+// Only the text inserted by the edit is autolinked, so that the changes users
+// made to the rest of the message, e.g. to a generated link, are kept.
+func (p *Plugin) MessageWillBeUpdated(c *plugin.Context, post *model.Post, oldPost *model.Post) (*model.Post, string) {
+	if conf := p.getConfig(); len(linksOnUpdate(conf, conf.Links)) == 0 {
+		// The edit is not autolinked, so the message kept for reverting is
+		// stale once the edit changes the message.
+		if oldPost == nil || post.Message != oldPost.Message {
+			clearRevertPostProps(post)
+		}
+		optOut(post)
 		return post, ""
 	}
 
-	return p.ProcessPost(c, post)
+	// The post is processed on behalf of its author, whoever edits it
+	preserveEditedPostProps(post, oldPost)
+
+	edit := wholeMessageEdit(post.Message)
+	if oldPost != nil {
+		edit = newMessageEdit(oldPost.Message, post.Message)
+	}
+	edit.skipped = p.getConfig().SkipAPIEdits && p.isAPIEdit(c)
+	// The text the links generated before is not linked again, even when the
+	// edit touches it or the previous message is unknown
+	edit.retain(post.Message, recordedGenerated(post))
+	return p.processEditedPost(post, edit, p.linkFired(post), false)
+}
+
+// clearRevertPostProps removes the props keeping the message of the post
+// before it was autolinked, for the post not to be reverted.
+func clearRevertPostProps(post *model.Post) {
+	for _, prop := range []string{originalMessagePostProp, rewrittenMessagePostProp} {
+		if post.GetProp(prop) != nil {
+			post.DelProp(prop)
+		}
+	}
+}
+
+// rejectLinks returns the reject links.
+func rejectLinks(links []autolink.Autolink) []autolink.Autolink {
+	rejecting := []autolink.Autolink{}
+	for _, link := range links {
+		if link.Kind == autolink.KindReject {
+			rejecting = append(rejecting, link)
+		}
+	}
+	return rejecting
+}
+
+// linksOnUpdate returns the links applied to edited posts among the links of
+// the configuration.
+func linksOnUpdate(conf *Config, links []autolink.Autolink) []autolink.Autolink {
+	onUpdate := []autolink.Autolink{}
+	for _, link := range links {
+		if link.AppliesOnUpdate(conf.EnableOnUpdate) {
+			onUpdate = append(onUpdate, link)
+		}
+	}
+	return onUpdate
+}
+
+// TestText applies the links to the text as if the user posted it in the
+// channel, without posting it.
+func (p *Plugin) TestText(userID, channelID, text string) api.TestResult {
+	result := api.TestResult{Text: text, Links: []api.LinkMatch{}}
+	post, rejection := p.previewPost(&model.Post{
+		UserId:    userID,
+		ChannelId: channelID,
+		Message:   text,
+	}, func(l autolink.Autolink, matches []string) {
+		// The matches are only kept for the links with a webhook
+		if matches == nil {
+			matches = l.Matches(text)
+		}
+		result.Links = append(result.Links, api.LinkMatch{Link: l, Name: l.DisplayName(), Matches: matches})
+	})
+	if rejection != "" {
+		result.Rejection = rejection
+		return result
+	}
+	result.Text = post.Message
+	return result
+}
+
+// CanReadChannel reports whether the user may read the channel, for the links
+// to only be tested in the channels the user can read.
+func (p *Plugin) CanReadChannel(userID, channelID string) bool {
+	return p.API.HasPermissionToChannel(userID, channelID, model.PermissionReadChannel)
+}
+
+// LintLinks checks the links for likely configuration mistakes, including
+// scopes naming teams or channels that do not exist, and templates and
+// patterns referencing undefined variables and pattern fragments.
+func (p *Plugin) LintLinks(links []autolink.Autolink) []autolink.LintIssue {
+	issues := autolink.Lint(links)
+	conf := p.getConfig()
+
+	teamIDs := map[string]string{}
+	teamID := func(name string) string {
+		id, ok := teamIDs[name]
+		if !ok {
+			if team, appErr := p.API.GetTeamByName(name); appErr == nil {
+				id = team.Id
+			}
+			teamIDs[name] = id
+		}
+		return id
+	}
+
+	for _, l := range links {
+		if l.Disabled {
+			continue
+		}
+		for _, scope := range l.Scope {
+			if strings.ContainsAny(scope, "*?[") {
+				continue
+			}
+			parts := strings.SplitN(strings.ToLower(scope), "/", 2)
+			if parts[0] == "" {
+				continue
+			}
+			id := teamID(parts[0])
+			if id == "" {
+				issues = append(issues, autolink.LintIssue{
+					Link:    l.DisplayName(),
+					Kind:    autolink.LintScope,
+					Message: fmt.Sprintf("team %q of scope %q does not exist", parts[0], scope),
+				})
+				continue
+			}
+			if len(parts) == 2 && parts[1] != "" && !strings.Contains(parts[1], "/") {
+				if _, appErr := p.API.GetChannelByName(id, parts[1], false); appErr != nil {
+					issues = append(issues, autolink.LintIssue{
+						Link:    l.DisplayName(),
+						Kind:    autolink.LintScope,
+						Message: fmt.Sprintf("channel %q of scope %q does not exist", parts[1], scope),
+					})
+				}
+			}
+		}
+
+		for _, name := range l.UndefinedVariables(conf.variables) {
+			issues = append(issues, autolink.LintIssue{
+				Link:    l.DisplayName(),
+				Kind:    autolink.LintVariable,
+				Message: fmt.Sprintf("template references {{%s}}, which is not a defined variable", name),
+			})
+		}
+		for _, name := range l.UndefinedPatternFragments(conf.fragments) {
+			issues = append(issues, autolink.LintIssue{
+				Link:    l.DisplayName(),
+				Kind:    autolink.LintVariable,
+				Message: fmt.Sprintf("pattern references {{%s}}, which is not a defined pattern fragment", name),
+			})
+		}
+
+		values := make([]string, 0, len(l.Mentions))
+		for value := range l.Mentions {
+			values = append(values, value)
+		}
+		sort.Strings(values)
+		for _, value := range values {
+			mention := l.Mentions[value]
+			if !strings.HasPrefix(mention, "@") {
+				continue
+			}
+			if _, appErr := p.API.GetUserByUsername(strings.TrimPrefix(mention, "@")); appErr != nil {
+				issues = append(issues, autolink.LintIssue{
+					Link:    l.DisplayName(),
+					Kind:    autolink.LintMention,
+					Message: fmt.Sprintf("user %q mentioned for %q does not exist", mention, value),
+				})
+			}
+		}
+	}
+
+	return issues
 }
@@ -4,19 +4,27 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/mattermost/mattermost-server/v6/model"
 	"github.com/mattermost/mattermost-server/v6/plugin"
 	"github.com/mattermost/mattermost-server/v6/plugin/plugintest"
 	"github.com/mattermost/mattermost-server/v6/plugin/plugintest/mock"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 
+	"github.com/mattermost/mattermost-plugin-autolink/server/api"
 	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolinkclient"
 )
 
 func TestPlugin(t *testing.T) {
@@ -36,6 +44,7 @@ func TestPlugin(t *testing.T) {
 	}
 
 	api := &plugintest.API{}
+	mockLinksStore(api)
 
 	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
 		*dest.(*Config) = conf
@@ -76,6 +85,7 @@ func (suite *SuiteAuthorization) SetupTest() {
 	suite.userInfo = make(map[string]*model.User)
 
 	suite.api = &plugintest.API{}
+	mockLinksStore(suite.api)
 	suite.api.On(
 		"LoadPluginConfiguration",
 		mock.AnythingOfType("*autolinkplugin.Config"),
@@ -104,6 +114,29 @@ func (suite *SuiteAuthorization) SetupTest() {
 			return nil
 		},
 	)
+	suite.api.On(
+		"GetUserByUsername",
+		mock.AnythingOfType("string"),
+	).Return(
+		func(username string) *model.User {
+			for _, user := range suite.userInfo {
+				if user.Username == username {
+					return user
+				}
+			}
+			return nil
+		},
+		func(username string) *model.AppError {
+			for _, user := range suite.userInfo {
+				if user.Username == username {
+					return nil
+				}
+			}
+			return &model.AppError{
+				Message: fmt.Sprintf("user %s not found", username),
+			}
+		},
+	)
 	suite.api.On(
 		"UnregisterCommand",
 		mock.AnythingOfType("string"),
@@ -259,7 +292,7 @@ func (suite *SuiteAuthorization) TestNonExistantUsersAreIgnored() {
 	suite.adminUsernames = "marynaId,karynaId"
 
 	suite.api.On("LogWarn", mock.AnythingOfType("string"),
-		"userID",
+		"entry",
 		"karynaId",
 		"error",
 		mock.AnythingOfType("*model.AppError"),
@@ -279,6 +312,43 @@ func (suite *SuiteAuthorization) TestNonExistantUsersAreIgnored() {
 	allowed, err = p.IsAuthorizedAdmin("karynaId")
 	require.Error(suite.T(), err)
 	require.False(suite.T(), allowed)
+	assert.Equal(suite.T(), []string{"karynaId"}, p.Status().UnresolvedAdmins)
+}
+
+func (suite *SuiteAuthorization) TestUsernamesAndDeactivatedUsers() {
+	suite.userInfo["marynaId"] = &model.User{
+		Username: "maryna",
+		Id:       "marynaId",
+		Roles:    "smurf",
+	}
+	suite.userInfo["karynaId"] = &model.User{
+		Username: "karyna",
+		Id:       "karynaId",
+		Roles:    "smurf",
+	}
+	suite.adminUsernames = "@maryna, karyna"
+
+	suite.api.On("LogWarn", mock.AnythingOfType("string"), "entry", "karyna").Return(nil)
+	suite.api.On("LogInfo", mock.AnythingOfType("string")).Return(nil)
+
+	p := New()
+	p.SetAPI(suite.api)
+	require.NoError(suite.T(), p.OnConfigurationChange())
+
+	allowed, err := p.IsAuthorizedAdmin("marynaId")
+	require.NoError(suite.T(), err)
+	assert.True(suite.T(), allowed, "usernames are resolved to IDs")
+	allowed, err = p.IsAuthorizedAdmin("karynaId")
+	require.NoError(suite.T(), err)
+	assert.True(suite.T(), allowed)
+	assert.Empty(suite.T(), p.Status().UnresolvedAdmins)
+
+	suite.userInfo["karynaId"].DeleteAt = 1
+	p.refreshPluginAdmins()
+	allowed, err = p.IsAuthorizedAdmin("karynaId")
+	require.NoError(suite.T(), err)
+	assert.False(suite.T(), allowed, "deactivated users are no longer admins")
+	assert.Equal(suite.T(), []string{"karyna"}, p.Status().UnresolvedAdmins)
 }
 
 func TestSuiteAuthorization(t *testing.T) {
@@ -326,6 +396,7 @@ func TestSpecialCases(t *testing.T) {
 	}
 
 	api := &plugintest.API{}
+	mockLinksStore(api)
 
 	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
 		*dest.(*Config) = validConfig
@@ -515,6 +586,358 @@ func TestSpecialCases(t *testing.T) {
 	}
 }
 
+func TestEditedMessages(t *testing.T) {
+	conf := Config{
+		EnableOnUpdate: true,
+		Links: []autolink.Autolink{{
+			Pattern:  "MM-(?P<jira_id>\\d+)",
+			Template: "[MM-$jira_id](https://mattermost.atlassian.net/browse/MM-$jira_id)",
+		}},
+	}
+
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", mock.AnythingOfType("string")).Return(&model.User{}, nil)
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	for _, tc := range []struct {
+		name            string
+		oldMessage      string
+		newMessage      string
+		expectedMessage string
+	}{
+		{
+			name:            "link removed",
+			oldMessage:      "See [MM-1](https://mattermost.atlassian.net/browse/MM-1) now",
+			newMessage:      "See MM-1 now",
+			expectedMessage: "See MM-1 now",
+		},
+		{
+			name:            "link text fixed",
+			oldMessage:      "See [MM-1](https://mattermost.atlassian.net/browse/MM-1)",
+			newMessage:      "See [MM-1 the crash](https://mattermost.atlassian.net/browse/MM-1)",
+			expectedMessage: "See [MM-1 the crash](https://mattermost.atlassian.net/browse/MM-1)",
+		},
+		{
+			name:            "text added",
+			oldMessage:      "See MM-1",
+			newMessage:      "See MM-1 and MM-2",
+			expectedMessage: "See MM-1 and [MM-2](https://mattermost.atlassian.net/browse/MM-2)",
+		},
+		{
+			name:            "match changed",
+			oldMessage:      "See MM-1 and MM-3",
+			newMessage:      "See MM-1 and MM-34",
+			expectedMessage: "See MM-1 and [MM-34](https://mattermost.atlassian.net/browse/MM-34)",
+		},
+		{
+			name:            "text rewritten",
+			oldMessage:      "Hello",
+			newMessage:      "See MM-1",
+			expectedMessage: "See [MM-1](https://mattermost.atlassian.net/browse/MM-1)",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rpost, _ := p.MessageWillBeUpdated(&plugin.Context{}, &model.Post{Message: tc.newMessage}, &model.Post{Message: tc.oldMessage})
+			assert.Equal(t, tc.expectedMessage, rpost.Message)
+		})
+	}
+}
+
+func TestEditsKeepGeneratedText(t *testing.T) {
+	conf := Config{
+		EnableOnUpdate: true,
+		Links: []autolink.Autolink{{
+			Pattern:  "MM-(?P<jira_id>\\d+)",
+			Template: "MM-$jira_id (ticket MM-$jira_id)",
+		}},
+	}
+
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", mock.AnythingOfType("string")).Return(&model.User{}, nil)
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	post, _ := p.MessageWillBePosted(&plugin.Context{}, &model.Post{Message: "See MM-1"})
+	require.Equal(t, "See MM-1 (ticket MM-1)", post.Message)
+	assert.Equal(t, []string{"MM-1 (ticket MM-1)"}, post.GetProp(generatedPostProp))
+
+	t.Run("previous message unknown", func(t *testing.T) {
+		edited := post.Clone()
+		edited.Message = "See MM-1 (ticket MM-1) and MM-2"
+		rpost, _ := p.MessageWillBeUpdated(&plugin.Context{}, edited, nil)
+		assert.Equal(t, "See MM-1 (ticket MM-1) and MM-2 (ticket MM-2)", rpost.Message)
+		assert.Equal(t, []string{"MM-1 (ticket MM-1)", "MM-2 (ticket MM-2)"}, rpost.GetProp(generatedPostProp))
+	})
+
+	t.Run("text added next to the generated text", func(t *testing.T) {
+		edited := post.Clone()
+		edited.Message = "See MM-1 (ticket MM-1)!"
+		rpost, _ := p.MessageWillBeUpdated(&plugin.Context{}, edited, post)
+		assert.Equal(t, "See MM-1 (ticket MM-1)!", rpost.Message)
+	})
+
+	t.Run("saved post", func(t *testing.T) {
+		edited := post.Clone()
+		edited.AddProp(generatedPostProp, []interface{}{"MM-1 (ticket MM-1)"})
+		edited.Message = "Now MM-1 (ticket MM-1)"
+		rpost, _ := p.MessageWillBeUpdated(&plugin.Context{}, edited, nil)
+		assert.Equal(t, "Now MM-1 (ticket MM-1)", rpost.Message)
+	})
+
+	t.Run("generated text removed", func(t *testing.T) {
+		edited := post.Clone()
+		edited.Message = "See nothing"
+		rpost, _ := p.MessageWillBeUpdated(&plugin.Context{}, edited, post)
+		assert.Nil(t, rpost.GetProp(generatedPostProp))
+	})
+}
+
+func TestAPIEdits(t *testing.T) {
+	conf := Config{
+		EnableOnUpdate: true,
+		Links: []autolink.Autolink{{
+			Pattern:  "MM-(?P<jira_id>\\d+)",
+			Template: "MM-$jira_id (ticket MM-$jira_id)",
+		}},
+	}
+
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", mock.AnythingOfType("string")).Return(&model.User{}, nil)
+	api.On("KVGet", userOptOutKeyPrefix+"user1").Return(nil, nil)
+	api.On("GetSession", "client").Return(&model.Session{UserId: "user1"}, nil)
+	api.On("GetSession", "token").Return(&model.Session{UserId: "bot1", Props: model.StringMap{
+		model.SessionPropType:  model.SessionTypeUserAccessToken,
+		model.SessionPropIsBot: model.SessionPropIsBotValue,
+	}}, nil)
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	post, _ := p.MessageWillBePosted(&plugin.Context{}, &model.Post{UserId: "user1", Message: "See MM-1"})
+	require.Equal(t, "See MM-1 (ticket MM-1)", post.Message)
+
+	t.Run("props dropped by the edit", func(t *testing.T) {
+		edited := &model.Post{UserId: "user1", Message: "See MM-1 (ticket MM-1) and MM-2"}
+		rpost, _ := p.MessageWillBeUpdated(&plugin.Context{SessionId: "token"}, edited, post)
+		assert.Equal(t, "See MM-1 (ticket MM-1) and MM-2 (ticket MM-2)", rpost.Message, "the generated text is not linked again")
+		assert.Equal(t, []string{"MM-1 (ticket MM-1)", "MM-2 (ticket MM-2)"}, rpost.GetProp(generatedPostProp))
+
+		optedOut := post.Clone()
+		optedOut.AddProp(optOutPostProp, true)
+		edited = &model.Post{UserId: "user1", Message: "See MM-1 (ticket MM-1) and MM-2"}
+		rpost, _ = p.MessageWillBeUpdated(&plugin.Context{SessionId: "token"}, edited, optedOut)
+		assert.Equal(t, "See MM-1 (ticket MM-1) and MM-2", rpost.Message, "the author opted the post out")
+	})
+
+	t.Run("SkipAPIEdits", func(t *testing.T) {
+		p.UpdateConfig(func(c *Config) { c.SkipAPIEdits = true })
+		defer p.UpdateConfig(func(c *Config) { c.SkipAPIEdits = false })
+
+		for sessionID, expected := range map[string]string{
+			"":       "See MM-1 (ticket MM-1) and MM-2",
+			"token":  "See MM-1 (ticket MM-1) and MM-2",
+			"client": "See MM-1 (ticket MM-1) and MM-2 (ticket MM-2)",
+		} {
+			edited := &model.Post{UserId: "user1", Message: "See MM-1 (ticket MM-1) and MM-2"}
+			rpost, _ := p.MessageWillBeUpdated(&plugin.Context{SessionId: sessionID}, edited, post)
+			assert.Equal(t, expected, rpost.Message, "session: %q", sessionID)
+		}
+	})
+}
+
+func TestFileComments(t *testing.T) {
+	conf := Config{
+		EnableOnUpdate: true,
+		Links: []autolink.Autolink{{
+			Pattern:  "MM-(?P<jira_id>\\d+)",
+			Template: "[MM-$jira_id](https://jira/MM-$jira_id)",
+		}, {
+			Kind:     autolink.KindReject,
+			Pattern:  "secret",
+			Template: "No secrets",
+		}},
+	}
+
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", mock.AnythingOfType("string")).Return(&model.User{}, nil)
+	api.On("LogInfo", "Rejected a post", "link", mock.AnythingOfType("string"), "user_id", "", "channel_id", "")
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	upload := &model.Post{Message: "Screenshot of MM-1", FileIds: []string{"file1"}}
+	rpost, _ := p.MessageWillBePosted(&plugin.Context{}, upload.Clone())
+	assert.Equal(t, "Screenshot of [MM-1](https://jira/MM-1)", rpost.Message)
+	assert.Equal(t, model.StringArray{"file1"}, rpost.FileIds)
+
+	edited := upload.Clone()
+	edited.Message = "Screenshot of MM-2"
+	rpost, _ = p.MessageWillBeUpdated(&plugin.Context{}, edited, upload)
+	assert.Equal(t, "Screenshot of [MM-2](https://jira/MM-2)", rpost.Message)
+
+	t.Run("SkipFileComments", func(t *testing.T) {
+		p.UpdateConfig(func(c *Config) { c.SkipFileComments = true })
+		defer p.UpdateConfig(func(c *Config) { c.SkipFileComments = false })
+
+		rpost, _ := p.MessageWillBePosted(&plugin.Context{}, upload.Clone())
+		assert.Equal(t, "Screenshot of MM-1", rpost.Message)
+
+		rpost, _ = p.MessageWillBePosted(&plugin.Context{}, &model.Post{Message: "See MM-1"})
+		assert.Equal(t, "See [MM-1](https://jira/MM-1)", rpost.Message, "the posts without files are autolinked")
+
+		rpost, _ = p.MessageWillBePosted(&plugin.Context{}, &model.Post{Message: "!nolink Screenshot of MM-1", FileIds: []string{"file1"}})
+		assert.Equal(t, "Screenshot of MM-1", rpost.Message, "the opt-out marker is removed")
+		assert.Equal(t, true, rpost.GetProp(optOutPostProp))
+
+		rpost, reason := p.MessageWillBePosted(&plugin.Context{}, &model.Post{Message: "a secret", FileIds: []string{"file1"}})
+		assert.Nil(t, rpost)
+		assert.Equal(t, "No secrets", reason, "reject links still apply")
+	})
+}
+
+func TestSentLaterPosts(t *testing.T) {
+	conf := Config{
+		MaxRewritePasses: 2,
+		Links: []autolink.Autolink{{
+			Pattern:  "MM-(?P<jira_id>\\d+)",
+			Template: "[MM-$jira_id](https://jira/MM-$jira_id)",
+		}},
+	}
+
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", mock.AnythingOfType("string")).Return(&model.User{}, nil)
+	api.On("KVGet", userOptOutKeyPrefix+"user1").Return(nil, nil)
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	// A scheduled post lands without a session, with the props of its draft
+	draft := &model.Post{UserId: "user1", Message: "See MM-1"}
+	draft.AddProp(rewritePassesPostProp, float64(2))
+	draft.AddProp(originalMessagePostProp, "Something else")
+	draft.AddProp(generatedPostProp, []interface{}{"[MM-1](https://jira/MM-1)"})
+	draft.AddProp("custom", "kept")
+
+	post, _ := p.MessageWillBePosted(&plugin.Context{}, draft)
+	assert.Equal(t, "See [MM-1](https://jira/MM-1)", post.Message)
+	assert.Equal(t, "See MM-1", post.GetProp(originalMessagePostProp))
+	assert.Equal(t, 1, post.GetProp(rewritePassesPostProp))
+	assert.Equal(t, "kept", post.GetProp("custom"))
+
+	draft = &model.Post{UserId: "user1", Message: "No ticket"}
+	draft.AddProp(originalMessagePostProp, "Something else")
+	post, _ = p.MessageWillBePosted(&plugin.Context{}, draft)
+	assert.Nil(t, post.GetProp(originalMessagePostProp), "the post can not be reverted to the message of another")
+}
+
+func TestProcessOnUpdate(t *testing.T) {
+	yes, no := true, false
+	for _, tc := range []struct {
+		name            string
+		enableOnUpdate  bool
+		processOnUpdate []*bool
+		expectedMessage string
+	}{
+		{
+			name:            "global setting",
+			enableOnUpdate:  true,
+			processOnUpdate: []*bool{nil, nil},
+			expectedMessage: "See [MM-1](https://mattermost.atlassian.net/browse/MM-1) and [ABC-2](https://example.com/ABC-2)",
+		},
+		{
+			name:            "link not applied on update",
+			enableOnUpdate:  true,
+			processOnUpdate: []*bool{nil, &no},
+			expectedMessage: "See [MM-1](https://mattermost.atlassian.net/browse/MM-1) and ABC-2",
+		},
+		{
+			name:            "link applied on update",
+			enableOnUpdate:  false,
+			processOnUpdate: []*bool{nil, &yes},
+			expectedMessage: "See MM-1 and [ABC-2](https://example.com/ABC-2)",
+		},
+		{
+			name:            "no link applied on update",
+			enableOnUpdate:  false,
+			processOnUpdate: []*bool{nil, nil},
+			expectedMessage: "See MM-1 and ABC-2",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := Config{
+				EnableOnUpdate: tc.enableOnUpdate,
+				Links: []autolink.Autolink{{
+					Pattern:         "MM-(?P<jira_id>\\d+)",
+					Template:        "[MM-$jira_id](https://mattermost.atlassian.net/browse/MM-$jira_id)",
+					ProcessOnUpdate: tc.processOnUpdate[0],
+				}, {
+					Pattern:         "ABC-(?P<id>\\d+)",
+					Template:        "[ABC-$id](https://example.com/ABC-$id)",
+					ProcessOnUpdate: tc.processOnUpdate[1],
+				}},
+			}
+
+			api := &plugintest.API{}
+			mockLinksStore(api)
+			api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+				*dest.(*Config) = conf
+				return nil
+			})
+			api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+			api.On("GetUser", mock.AnythingOfType("string")).Return(&model.User{}, nil)
+
+			p := New()
+			p.SetAPI(api)
+			require.NoError(t, p.OnConfigurationChange())
+
+			rpost, _ := p.MessageWillBeUpdated(&plugin.Context{}, &model.Post{Message: "See MM-1 and ABC-2"}, &model.Post{Message: "Hello"})
+			assert.Equal(t, tc.expectedMessage, rpost.Message)
+
+			// New posts are processed by all the links
+			rpost, _ = p.MessageWillBePosted(&plugin.Context{}, &model.Post{Message: "See MM-1 and ABC-2"})
+			assert.Equal(t, "See [MM-1](https://mattermost.atlassian.net/browse/MM-1) and [ABC-2](https://example.com/ABC-2)", rpost.Message)
+		})
+	}
+}
+
 func TestBotMessagesAreRewritenWhenGetUserFails(t *testing.T) {
 	conf := Config{
 		Links: []autolink.Autolink{{
@@ -532,6 +955,7 @@ func TestBotMessagesAreRewritenWhenGetUserFails(t *testing.T) {
 	}
 
 	api := &plugintest.API{}
+	mockLinksStore(api)
 
 	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
 		*dest.(*Config) = conf
@@ -575,6 +999,7 @@ func TestGetUserApiCallIsNotExecutedWhenThereAreNoChanges(t *testing.T) {
 	}
 
 	api := &plugintest.API{}
+	mockLinksStore(api)
 
 	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
 		*dest.(*Config) = conf
@@ -614,6 +1039,7 @@ func TestBotMessagesAreNotRewriten(t *testing.T) {
 	}
 
 	api := &plugintest.API{}
+	mockLinksStore(api)
 
 	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
 		*dest.(*Config) = conf
@@ -658,6 +1084,7 @@ func TestBotMessagesAreRewritenWhenConfigAllows(t *testing.T) {
 	}
 
 	api := &plugintest.API{}
+	mockLinksStore(api)
 
 	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
 		*dest.(*Config) = conf
@@ -686,351 +1113,4325 @@ func TestBotMessagesAreRewritenWhenConfigAllows(t *testing.T) {
 	assert.Equal(t, "Welcome to [Mattermost](https://mattermost.com)!", rpost.Message)
 }
 
-func TestHashtags(t *testing.T) {
-	conf := Config{
-		Links: []autolink.Autolink{{
-			Pattern:  "foo",
-			Template: "#bar",
-		}, {
-			Pattern:  "hash tags",
-			Template: "#hash #tags",
-		}},
+func TestBotAllowAndDenylists(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		link            autolink.Autolink
+		username        string
+		expectRewritten bool
+	}{
+		{
+			name:            "allowlisted bot",
+			link:            autolink.Autolink{BotAllowlist: []string{"@deploybot"}},
+			username:        "deploybot",
+			expectRewritten: true,
+		},
+		{
+			name:     "bot not in allowlist",
+			link:     autolink.Autolink{BotAllowlist: []string{"deploybot"}, ProcessBotPosts: true},
+			username: "jira",
+		},
+		{
+			name:     "denylisted bot",
+			link:     autolink.Autolink{BotDenylist: []string{"jira"}, ProcessBotPosts: true},
+			username: "Jira",
+		},
+		{
+			name:            "bot not in denylist",
+			link:            autolink.Autolink{BotDenylist: []string{"jira"}, ProcessBotPosts: true},
+			username:        "deploybot",
+			expectRewritten: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			link := tc.link
+			link.Pattern = "(Mattermost)"
+			link.Template = "[Mattermost](https://mattermost.com)"
+			conf := Config{
+				Links: []autolink.Autolink{link},
+			}
+
+			api := &plugintest.API{}
+			mockLinksStore(api)
+			api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+				*dest.(*Config) = conf
+				return nil
+			})
+			api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+			api.On("GetUser", mock.AnythingOfType("string")).Return(&model.User{IsBot: true, Username: tc.username}, nil)
+
+			p := New()
+			p.SetAPI(api)
+			err := p.OnConfigurationChange()
+			require.NoError(t, err)
+
+			rpost, _ := p.MessageWillBePosted(&plugin.Context{}, &model.Post{Message: "Welcome to Mattermost!"})
+			if tc.expectRewritten {
+				assert.Equal(t, "Welcome to [Mattermost](https://mattermost.com)!", rpost.Message)
+			} else {
+				assert.Equal(t, "Welcome to Mattermost!", rpost.Message)
+			}
+		})
+	}
+}
+
+func TestIntegrationPosts(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		conf            Config
+		link            autolink.Autolink
+		props           model.StringInterface
+		author          *model.User
+		userID          string
+		expectRewritten bool
+	}{
+		{
+			name:            "user post",
+			expectRewritten: true,
+		},
+		{
+			name:            "webhook post",
+			props:           model.StringInterface{"from_webhook": "true"},
+			expectRewritten: true,
+		},
+		{
+			name:  "plugin post",
+			props: model.StringInterface{"from_plugin": "true"},
+		},
+		{
+			name:  "webhook post skipped by the plugin",
+			conf:  Config{SkipIntegrationPosts: true},
+			props: model.StringInterface{"from_webhook": "true"},
+		},
+		{
+			name:            "webhook post processed by the link",
+			conf:            Config{SkipIntegrationPosts: true},
+			link:            autolink.Autolink{ProcessIntegrationPosts: true},
+			props:           model.StringInterface{"from_webhook": "true"},
+			expectRewritten: true,
+		},
+		{
+			name:            "plugin post processed by the plugin",
+			conf:            Config{ProcessPluginPosts: true},
+			props:           model.StringInterface{"from_plugin": "true"},
+			expectRewritten: true,
+		},
+		{
+			name:            "plugin post processed by the link",
+			link:            autolink.Autolink{ProcessPluginPosts: true},
+			props:           model.StringInterface{"from_plugin": "true"},
+			expectRewritten: true,
+		},
+		{
+			name:            "plugin bot post",
+			conf:            Config{ProcessPluginPosts: true},
+			author:          &model.User{IsBot: true, Username: "jira"},
+			props:           model.StringInterface{"from_plugin": "true"},
+			expectRewritten: true,
+		},
+		{
+			name:   "denied plugin bot post",
+			conf:   Config{ProcessPluginPosts: true},
+			link:   autolink.Autolink{BotDenylist: []string{"jira"}},
+			author: &model.User{IsBot: true, Username: "jira"},
+			props:  model.StringInterface{"from_plugin": "true"},
+		},
+		{
+			name:   "own bot post",
+			conf:   Config{ProcessPluginPosts: true},
+			userID: "botid",
+			props:  model.StringInterface{"from_plugin": "true"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			link := tc.link
+			link.Pattern = "(Mattermost)"
+			link.Template = "[Mattermost](https://mattermost.com)"
+			conf := tc.conf
+			conf.Links = []autolink.Autolink{link}
+
+			api := &plugintest.API{}
+			mockLinksStore(api)
+			api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+				*dest.(*Config) = conf
+				return nil
+			})
+			api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+			author := tc.author
+			if author == nil {
+				author = &model.User{}
+			}
+			api.On("GetUser", mock.AnythingOfType("string")).Return(author, nil)
+
+			p := New()
+			p.SetAPI(api)
+			p.botUserID = "botid"
+			err := p.OnConfigurationChange()
+			require.NoError(t, err)
+
+			rpost, _ := p.MessageWillBePosted(&plugin.Context{}, &model.Post{UserId: tc.userID, Message: "Welcome to Mattermost!", Props: tc.props})
+			if tc.expectRewritten {
+				assert.Equal(t, "Welcome to [Mattermost](https://mattermost.com)!", rpost.Message)
+			} else {
+				assert.Equal(t, "Welcome to Mattermost!", rpost.Message)
+			}
+		})
 	}
+}
 
-	testChannel := model.Channel{
-		Name: "TestChanel",
+func TestMaxReplacements(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		conf            Config
+		expectedMessage string
+	}{
+		{
+			name: "no limit",
+			conf: Config{
+				Links: []autolink.Autolink{
+					{Pattern: `(?P<id>MM-\d)`, Template: "[$id](mm)"},
+					{Pattern: `(?P<id>OPS-\d)`, Template: "[$id](ops)"},
+				},
+			},
+			expectedMessage: "[MM-1](mm) [MM-2](mm) [OPS-1](ops) [OPS-2](ops)",
+		},
+		{
+			name: "per link",
+			conf: Config{
+				Links: []autolink.Autolink{
+					{Pattern: `(?P<id>MM-\d)`, Template: "[$id](mm)", MaxReplacements: 1},
+					{Pattern: `(?P<id>OPS-\d)`, Template: "[$id](ops)"},
+				},
+			},
+			expectedMessage: "[MM-1](mm) MM-2 [OPS-1](ops) [OPS-2](ops)",
+		},
+		{
+			name: "per post",
+			conf: Config{
+				MaxReplacementsPerPost: 3,
+				Links: []autolink.Autolink{
+					{Pattern: `(?P<id>MM-\d)`, Template: "[$id](mm)"},
+					{Pattern: `(?P<id>OPS-\d)`, Template: "[$id](ops)"},
+				},
+			},
+			expectedMessage: "[MM-1](mm) [MM-2](mm) [OPS-1](ops) OPS-2",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := tc.conf
+			api := &plugintest.API{}
+			mockLinksStore(api)
+			api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+				*dest.(*Config) = conf
+				return nil
+			})
+			api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+			api.On("GetUser", mock.AnythingOfType("string")).Return(&model.User{}, nil)
+			api.On("LogWarn", mock.AnythingOfType("string"), "post_id", "", "links", mock.AnythingOfType("string"))
+
+			p := New()
+			p.SetAPI(api)
+			err := p.OnConfigurationChange()
+			require.NoError(t, err)
+
+			rpost, _ := p.MessageWillBePosted(&plugin.Context{}, &model.Post{Message: "MM-1 MM-2 OPS-1 OPS-2"})
+			assert.Equal(t, tc.expectedMessage, rpost.Message)
+		})
 	}
+}
 
-	testTeam := model.Team{
-		Name: "TestTeam",
+func TestMaxMessageSize(t *testing.T) {
+	conf := Config{
+		MaxMessageSize: 1,
+		Links: []autolink.Autolink{
+			{Pattern: `(?P<id>MM-\d)`, Template: "[$id](mm)"},
+		},
 	}
 
 	api := &plugintest.API{}
-
+	mockLinksStore(api)
 	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
 		*dest.(*Config) = conf
 		return nil
 	})
 	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
-
-	api.On("GetChannel", mock.AnythingOfType("string")).Return(&testChannel, nil)
-	api.On("GetTeam", mock.AnythingOfType("string")).Return(&testTeam, nil)
-
-	testUser := model.User{
-		IsBot: false,
-	}
-	api.On("GetUser", mock.AnythingOfType("string")).Return(&testUser, nil)
+	api.On("GetUser", mock.AnythingOfType("string")).Return(&model.User{}, nil)
+	api.On("LogDebug", "Message too large to be autolinked", "post_id", "", "size", 1029, "max_size", 1024)
 
 	p := New()
 	p.SetAPI(api)
-	err := p.OnConfigurationChange()
-	require.NoError(t, err)
+	require.NoError(t, p.OnConfigurationChange())
 
-	post := &model.Post{Message: "foo"}
-	rpost, _ := p.MessageWillBePosted(&plugin.Context{}, post)
+	message := "MM-1 " + strings.Repeat("x", 1019)
+	rpost, _ := p.MessageWillBePosted(&plugin.Context{}, &model.Post{Message: message})
+	assert.Equal(t, "[MM-1](mm) "+strings.Repeat("x", 1019), rpost.Message)
 
-	assert.Equal(t, "#bar", rpost.Hashtags)
+	message += "MM-2 "
+	rpost, _ = p.MessageWillBePosted(&plugin.Context{}, &model.Post{Message: message})
+	assert.Equal(t, message, rpost.Message)
+	api.AssertCalled(t, "LogDebug", "Message too large to be autolinked", "post_id", "", "size", 1029, "max_size", 1024)
+}
 
-	post.Message = "hash tags"
-	rpost, _ = p.MessageWillBePosted(&plugin.Context{}, post)
+func TestMaxRewritePasses(t *testing.T) {
+	conf := Config{
+		MaxRewritePasses: 2,
+		Links: []autolink.Autolink{
+			{Pattern: `(?P<id>MM-\d)`, Template: "[$id](mm)"},
+		},
+	}
 
-	assert.Equal(t, "#hash #tags", rpost.Hashtags)
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", mock.AnythingOfType("string")).Return(&model.User{}, nil)
+	api.On("LogWarn", "Post rewritten too many times, it is no longer autolinked", "post_id", "post1", "passes", 2)
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	post := &model.Post{Id: "post1", Message: "MM-1"}
+	post, _ = p.MessageWillBePosted(&plugin.Context{}, post)
+	assert.Equal(t, "[MM-1](mm)", post.Message)
+	assert.Equal(t, 1, post.GetProp(rewritePassesPostProp))
+
+	// Another plugin rewrites the post, which is saved with its props
+	post.Message = "MM-2"
+	post.AddProp(rewritePassesPostProp, float64(1))
+	post, _ = p.MessageWillBePosted(&plugin.Context{}, post)
+	assert.Equal(t, "[MM-2](mm)", post.Message)
+	assert.Equal(t, 2, post.GetProp(rewritePassesPostProp))
+
+	post.Message = "MM-3"
+	post, _ = p.MessageWillBePosted(&plugin.Context{}, post)
+	assert.Equal(t, "MM-3", post.Message)
+	api.AssertCalled(t, "LogWarn", "Post rewritten too many times, it is no longer autolinked", "post_id", "post1", "passes", 2)
 }
 
-func TestAPI(t *testing.T) {
+func TestMaxRewritesPerChannel(t *testing.T) {
 	conf := Config{
-		Links: []autolink.Autolink{{
-			Name:     "existing",
-			Pattern:  "thing",
-			Template: "otherthing",
-		}},
+		MaxRewritesPerChannel: 2,
+		Links: []autolink.Autolink{
+			{Pattern: `(?P<id>MM-\d)`, Template: "[$id](mm)"},
+		},
 	}
 
-	testChannel := model.Channel{
-		Name: "TestChanel",
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", mock.AnythingOfType("string")).Return(&model.User{}, nil)
+	api.On("KVGet", mock.AnythingOfType("string")).Return(nil, nil)
+	api.On("LogWarn", "Posts not autolinked, too many posts in their channels", "skipped", 3,
+		"limit_per_minute", 2, "channels", "channel1:2,channel2:1")
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	post := func(channelID string) string {
+		rpost, _ := p.MessageWillBePosted(&plugin.Context{}, &model.Post{ChannelId: channelID, Message: "MM-1"})
+		return rpost.Message
 	}
+	assert.Equal(t, "[MM-1](mm)", post("channel1"))
+	assert.Equal(t, "[MM-1](mm)", post("channel1"))
+	assert.Equal(t, "MM-1", post("channel1"))
+	assert.Equal(t, "MM-1", post("channel1"))
+	assert.Equal(t, "[MM-1](mm)", post("channel2"), "the other channels are autolinked")
+	assert.Equal(t, "[MM-1](mm)", post("channel2"))
+	assert.Equal(t, "MM-1", post("channel2"))
+	rpost, _ := p.MessageWillBePosted(&plugin.Context{}, &model.Post{ChannelId: "channel3", Message: "Hello"})
+	assert.Equal(t, "Hello", rpost.Message)
+	rpost, _ = p.MessageWillBePosted(&plugin.Context{}, &model.Post{ChannelId: "channel3", Message: "Hello"})
+	assert.Equal(t, "Hello", rpost.Message)
+	assert.Equal(t, "[MM-1](mm)", post("channel3"), "the posts left as they are are not counted")
+	api.AssertNotCalled(t, "LogWarn", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	// A single warning is logged once the minute ended
+	p.reportThrottled(time.Now().Add(throttleWindow))
+	api.AssertNumberOfCalls(t, "LogWarn", 1)
+	p.reportThrottled(time.Now().Add(2 * throttleWindow))
+	api.AssertNumberOfCalls(t, "LogWarn", 1)
+}
 
-	testTeam := model.Team{
-		Name: "TestTeam",
+func TestChannelThrottle(t *testing.T) {
+	var throttle channelThrottle
+	start := time.Date(2026, 10, 15, 10, 0, 0, 0, time.UTC)
+
+	allowed, ended := throttle.allow("channel1", 1, start)
+	assert.True(t, allowed)
+	assert.Nil(t, ended)
+	allowed, _ = throttle.allow("channel1", 1, start.Add(10*time.Second))
+	assert.True(t, allowed, "the posts not rewritten are not counted")
+	assert.Nil(t, throttle.count("channel1", start.Add(20*time.Second)))
+	allowed, _ = throttle.allow("channel1", 1, start.Add(30*time.Second))
+	assert.False(t, allowed)
+
+	allowed, ended = throttle.allow("channel1", 1, start.Add(throttleWindow))
+	assert.True(t, allowed, "the next window starts over")
+	assert.Equal(t, map[string]int{"channel1": 1}, ended)
+}
+
+func TestTemplateVariables(t *testing.T) {
+	conf := Config{
+		Variables: "JIRA_BASE=https://jira.example.com",
+		Links: []autolink.Autolink{
+			{Name: "jira", Pattern: `(?P<key>MM-\d+)`, Template: "[$key]({{JIRA_BASE}}/browse/$key)"},
+			{Name: "wiki", Pattern: `(?P<page>wiki:\w+)`, Template: "[$page]({{WIKI_BASE}}/$page)"},
+		},
 	}
 
 	api := &plugintest.API{}
+	mockLinksStore(api)
 	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
 		*dest.(*Config) = conf
 		return nil
 	})
 	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
-	api.On("GetChannel", mock.AnythingOfType("string")).Return(&testChannel, nil)
-	api.On("GetTeam", mock.AnythingOfType("string")).Return(&testTeam, nil)
-	api.On("SavePluginConfig", mock.AnythingOfType("map[string]interface {}")).Return(nil)
+	api.On("GetUser", mock.AnythingOfType("string")).Return(&model.User{}, nil)
+	api.On("LogError", "Invalid template variables", "error", mock.AnythingOfType("string"))
 
 	p := New()
 	p.SetAPI(api)
-	err := p.OnConfigurationChange()
-	require.NoError(t, err)
-	err = p.OnActivate()
-	require.NoError(t, err)
-
-	jbyte, err := json.Marshal(&autolink.Autolink{Name: "new", Pattern: "newpat", Template: "newtemp"})
-	require.NoError(t, err)
-	recorder := httptest.NewRecorder()
-	req, err := http.NewRequest("POST", "/api/v1/link", bytes.NewReader(jbyte))
-	require.NoError(t, err)
-	req.Header.Set("Mattermost-Plugin-ID", "somthing")
-	p.ServeHTTP(&plugin.Context{}, recorder, req)
-	resp := recorder.Result()
-	require.NotNil(t, resp)
-	assert.Equal(t, http.StatusOK, resp.StatusCode)
-	assert.Len(t, p.conf.Links, 2)
-	assert.Equal(t, "new", p.conf.Links[1].Name)
+	require.NoError(t, p.OnConfigurationChange())
+
+	post, _ := p.MessageWillBePosted(&plugin.Context{}, &model.Post{Message: "See MM-1"})
+	assert.Equal(t, "See [MM-1](https://jira.example.com/browse/MM-1)", post.Message)
+	assert.Equal(t, []autolink.LintIssue{{
+		Link:    "wiki",
+		Kind:    autolink.LintVariable,
+		Message: "template references {{WIKI_BASE}}, which is not a defined variable",
+	}}, p.LintLinks(p.GetLinks()))
+
+	// The links are compiled again with the new values
+	conf.Variables = "JIRA_BASE=https://jira.example.org\nWIKI_BASE=https://wiki.example.org\n"
+	require.NoError(t, p.OnConfigurationChange())
+	post, _ = p.MessageWillBePosted(&plugin.Context{}, &model.Post{Message: "See MM-1 and wiki:Home"})
+	assert.Equal(t, "See [MM-1](https://jira.example.org/browse/MM-1) and [wiki:Home](https://wiki.example.org/wiki:Home)", post.Message)
+	assert.Empty(t, p.LintLinks(p.GetLinks()))
+
+	conf.Variables = "JIRA BASE=https://jira.example.org"
+	require.NoError(t, p.OnConfigurationChange())
+	api.AssertCalled(t, "LogError", "Invalid template variables", "error", mock.AnythingOfType("string"))
+	assert.Contains(t, p.Status().ConfigError, "invalid template variables")
 }
 
-func TestResolveScope(t *testing.T) {
-	t.Run("resolve channel name and team name", func(t *testing.T) {
-		testChannel := model.Channel{
-			Name:   "TestChannel",
-			TeamId: "TestId",
-		}
+func TestPatternFragments(t *testing.T) {
+	conf := Config{
+		PatternFragments: "PROJECT=OPS|SRE",
+		Links: []autolink.Autolink{
+			{Name: "jira", Pattern: `(?P<key>{{PROJECT}}-\d+)`, Template: "[$key](https://jira.example.com/browse/$key)"},
+			{Name: "wiki", Pattern: `wiki:{{PAGE}}`, Template: "wiki"},
+		},
+	}
 
-		testTeam := model.Team{
-			Name: "TestTeam",
-		}
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", mock.AnythingOfType("string")).Return(&model.User{}, nil)
+	api.On("LogError", "Invalid pattern fragments", "error", mock.AnythingOfType("string"))
 
-		api := &plugintest.API{}
-		api.On("GetChannel", mock.AnythingOfType("string")).Return(&testChannel, nil)
-		api.On("GetTeam", mock.AnythingOfType("string")).Return(&testTeam, nil)
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	post, _ := p.MessageWillBePosted(&plugin.Context{}, &model.Post{Message: "See OPS-1 and NET-2"})
+	assert.Equal(t, "See [OPS-1](https://jira.example.com/browse/OPS-1) and NET-2", post.Message)
+	assert.Equal(t, []autolink.LintIssue{{
+		Link:    "wiki",
+		Kind:    autolink.LintVariable,
+		Message: "pattern references {{PAGE}}, which is not a defined pattern fragment",
+	}}, p.LintLinks(p.GetLinks()))
+
+	// The links are compiled again with the new fragments
+	conf.PatternFragments = "PROJECT=OPS|SRE|NET"
+	require.NoError(t, p.OnConfigurationChange())
+	post, _ = p.MessageWillBePosted(&plugin.Context{}, &model.Post{Message: "See NET-2"})
+	assert.Equal(t, "See [NET-2](https://jira.example.com/browse/NET-2)", post.Message)
+
+	conf.PatternFragments = "PROJECT=(OPS|SRE)"
+	require.NoError(t, p.OnConfigurationChange())
+	api.AssertCalled(t, "LogError", "Invalid pattern fragments", "error", mock.AnythingOfType("string"))
+	assert.Contains(t, p.Status().ConfigError, "invalid pattern fragments")
+}
 
-		p := Plugin{}
-		p.SetAPI(api)
-		channelName, teamName, _ := p.resolveScope("TestId")
-		assert.Equal(t, "TestChannel", channelName)
-		assert.Equal(t, "TestTeam", teamName)
+func TestRedact(t *testing.T) {
+	conf := Config{
+		Links: []autolink.Autolink{{
+			Name:      "card",
+			Pattern:   `(?:\d{4}[ -]?){3}(?P<last>\d{4})`,
+			Template:  "XXXX-XXXX-XXXX-$last",
+			WordMatch: true,
+			Kind:      autolink.KindRedact,
+		}, {
+			Name:     "digits",
+			Pattern:  `(?P<code>\d{4})`,
+			Template: "[$code](https://example.com/$code)",
+		}},
+	}
+
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
 	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", mock.AnythingOfType("string")).Return(&model.User{}, nil)
+	api.On("LogInfo", "Redacted a post", "link", "card", "post_id", "post", "user_id", "user", "channel_id", "channel")
+	api.On("KVGet", mock.AnythingOfType("string")).Return(nil, nil)
 
-	t.Run("resolve channel name and returns empty team name", func(t *testing.T) {
-		testChannel := model.Channel{
-			Name: "TestChannel",
-		}
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
 
-		api := &plugintest.API{}
-		api.On("GetChannel", mock.AnythingOfType("string")).Return(&testChannel, nil)
+	rpost, _ := p.MessageWillBePosted(&plugin.Context{}, &model.Post{
+		Id:        "post",
+		UserId:    "user",
+		ChannelId: "channel",
+		Message:   "My card is 4111 1111 1111 1234",
+	})
+	assert.Equal(t, "My card is XXXX-XXXX-XXXX-1234", rpost.Message, "the mask is not linked")
+	assert.Nil(t, rpost.GetProp(originalMessagePostProp), "the text redacted is not kept")
+	api.AssertCalled(t, "LogInfo", "Redacted a post", "link", "card", "post_id", "post", "user_id", "user", "channel_id", "channel")
 
-		p := Plugin{}
-		p.SetAPI(api)
+	rpost, _ = p.MessageWillBePosted(&plugin.Context{}, &model.Post{Message: "Code 1234"})
+	assert.Equal(t, "Code [1234](https://example.com/1234)", rpost.Message)
+	assert.NotNil(t, rpost.GetProp(originalMessagePostProp))
+}
 
-		channelName, teamName, _ := p.resolveScope("TestId")
-		assert.Equal(t, "TestChannel", channelName)
-		assert.Equal(t, "", teamName)
+func TestReject(t *testing.T) {
+	conf := Config{
+		Links: []autolink.Autolink{{
+			Name:      "tracker",
+			Pattern:   `https://tracker\.example\.com/\S+`,
+			Template:  "Use Jira instead of the old tracker.",
+			WordMatch: true,
+			Kind:      autolink.KindReject,
+		}, {
+			Name:     "jira",
+			Pattern:  `(?P<key>MM-\d+)`,
+			Template: "[$key](https://jira.example.com/$key)",
+		}},
+	}
+
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
 	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", mock.AnythingOfType("string")).Return(&model.User{}, nil)
+	api.On("LogInfo", "Rejected a post", "link", "tracker", "user_id", mock.AnythingOfType("string"), "channel_id", mock.AnythingOfType("string"))
+	api.On("KVGet", userOptOutKeyPrefix+"optedout").Return([]byte("true"), nil)
+	api.On("KVGet", mock.AnythingOfType("string")).Return(nil, nil)
 
-	t.Run("error when api fails to get channel", func(t *testing.T) {
-		api := &plugintest.API{}
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
 
-		api.On("GetChannel",
-			mock.AnythingOfType("string")).Return(nil, &model.AppError{})
+	rpost, rejection := p.MessageWillBePosted(&plugin.Context{}, &model.Post{
+		UserId:    "user",
+		ChannelId: "channel",
+		Message:   "MM-1 is https://tracker.example.com/issues/1",
+	})
+	assert.Nil(t, rpost)
+	assert.Equal(t, "Use Jira instead of the old tracker.", rejection)
+	api.AssertCalled(t, "LogInfo", "Rejected a post", "link", "tracker", "user_id", "user", "channel_id", "channel")
+
+	rpost, rejection = p.MessageWillBePosted(&plugin.Context{}, &model.Post{Message: "MM-1"})
+	assert.Empty(t, rejection)
+	assert.Equal(t, "[MM-1](https://jira.example.com/MM-1)", rpost.Message)
+
+	// Opting out does not get around the reject links
+	rpost, rejection = p.MessageWillBePosted(&plugin.Context{}, &model.Post{Message: optOutMarker + " https://tracker.example.com/issues/1"})
+	assert.Nil(t, rpost)
+	assert.Equal(t, "Use Jira instead of the old tracker.", rejection)
+	rpost, rejection = p.MessageWillBePosted(&plugin.Context{}, &model.Post{UserId: "optedout", Message: "https://tracker.example.com/issues/1"})
+	assert.Nil(t, rpost)
+	assert.NotEmpty(t, rejection)
+	rpost, rejection = p.MessageWillBePosted(&plugin.Context{}, &model.Post{UserId: "optedout", Message: "MM-1"})
+	assert.Empty(t, rejection)
+	assert.Equal(t, "MM-1", rpost.Message)
+}
 
-		p := Plugin{}
-		p.SetAPI(api)
+func TestFirstMatchOnly(t *testing.T) {
+	conf := Config{
+		Links: []autolink.Autolink{
+			{Pattern: `(?P<id>MM-\d)`, Template: "[$id](mm)", FirstMatchOnly: true},
+			{Pattern: `(?P<id>OPS-\d)`, Template: "[$id](ops)"},
+		},
+	}
 
-		channelName, teamName, err := p.resolveScope("TestId")
-		assert.Error(t, err)
-		assert.Equal(t, teamName, "")
-		assert.Equal(t, channelName, "")
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
 	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", mock.AnythingOfType("string")).Return(&model.User{}, nil)
 
-	t.Run("error when api fails to get team", func(t *testing.T) {
-		testChannel := model.Channel{
-			Name:   "TestChannel",
-			TeamId: "TestId",
-		}
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
 
-		api := &plugintest.API{}
+	// The repeated matches are left as is across the parts of the message
+	rpost, _ := p.MessageWillBePosted(&plugin.Context{}, &model.Post{Message: "MM-1 OPS-1 **MM-1** MM-2 OPS-1\n\n- MM-2"})
+	assert.Equal(t, "[MM-1](mm) [OPS-1](ops) **MM-1** [MM-2](mm) [OPS-1](ops)\n\n- MM-2", rpost.Message)
 
-		api.On("GetChannel", mock.AnythingOfType("string")).Return(&testChannel, nil)
-		api.On("GetTeam", mock.AnythingOfType("string")).Return(nil, &model.AppError{})
+	// and replaced again in the next posts
+	rpost, _ = p.MessageWillBePosted(&plugin.Context{}, &model.Post{Message: "MM-1 MM-1"})
+	assert.Equal(t, "[MM-1](mm) MM-1", rpost.Message)
+}
 
-		p := Plugin{}
-		p.SetAPI(api)
+func TestAcrossLines(t *testing.T) {
+	trace := autolink.Autolink{
+		Name:        "trace",
+		Pattern:     `Exception in thread "(?P<thread>[^"]+)"\s+(?P<class>[\w.]+Exception)`,
+		Template:    "[$class in $thread](https://kb.example.com/$class)",
+		AcrossLines: true,
+	}
+	line := autolink.Autolink{Name: "line", Pattern: `^(?P<id>MM-\d+)`, Template: "[$id](mm)", DisableNonWordPrefix: true}
 
-		channelName, teamName, err := p.resolveScope("TestId")
-		assert.Error(t, err)
-		assert.Equal(t, channelName, "")
-		assert.Equal(t, teamName, "")
-	})
+	for _, tc := range []struct {
+		name            string
+		links           []autolink.Autolink
+		message         string
+		expectedMessage string
+	}{
+		{
+			name:            "across lines",
+			links:           []autolink.Autolink{trace},
+			message:         "See this:\nException in thread \"main\"\njava.lang.NullPointerException\n\nException in thread \"main\"",
+			expectedMessage: "See this:\n[java.lang.NullPointerException in main](https://kb.example.com/java.lang.NullPointerException)\n\nException in thread \"main\"",
+		},
+		{
+			name:            "line by line",
+			links:           []autolink.Autolink{{Name: "trace", Pattern: trace.Pattern, Template: trace.Template}},
+			message:         "Exception in thread \"main\"\njava.lang.NullPointerException",
+			expectedMessage: "Exception in thread \"main\"\njava.lang.NullPointerException",
+		},
+		{
+			name:            "other links apply to each line",
+			links:           []autolink.Autolink{trace, line},
+			message:         "MM-1 or MM-2\nMM-3 and *MM-4*\nMM-5",
+			expectedMessage: "[MM-1](mm) or MM-2\n[MM-3](mm) and *MM-4*\n[MM-5](mm)",
+		},
+		{
+			name:            "markup between lines",
+			links:           []autolink.Autolink{trace},
+			message:         "Exception in thread \"main\" **now**\njava.lang.NullPointerException",
+			expectedMessage: "Exception in thread \"main\" **now**\njava.lang.NullPointerException",
+		},
+		{
+			name:            "block quote",
+			links:           []autolink.Autolink{trace},
+			message:         "> Exception in thread \"main\"\n> java.lang.NullPointerException",
+			expectedMessage: "> Exception in thread \"main\"\n> java.lang.NullPointerException",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := Config{Links: tc.links}
+			api := &plugintest.API{}
+			mockLinksStore(api)
+			api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+				*dest.(*Config) = conf
+				return nil
+			})
+			api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+			api.On("GetUser", mock.AnythingOfType("string")).Return(&model.User{}, nil)
+
+			p := New()
+			p.SetAPI(api)
+			require.NoError(t, p.OnConfigurationChange())
+
+			rpost, _ := p.MessageWillBePosted(&plugin.Context{}, &model.Post{Message: tc.message})
+			assert.Equal(t, tc.expectedMessage, rpost.Message)
+		})
+	}
 }
 
-func TestProcessPost(t *testing.T) {
-	t.Run("cannot resolve scope", func(t *testing.T) {
-		conf := Config{
-			Links: []autolink.Autolink{
-				{
-					Pattern:  "(Mattermost)",
-					Template: "[Mattermost](https://mattermost.com)",
-					Scope:    []string{"TestTeam/TestChannel"},
-				},
-			},
-		}
-
-		api := &plugintest.API{}
+func TestCodeLinks(t *testing.T) {
+	errorLink := autolink.Autolink{Name: "error", Pattern: `(?P<code>ERR-\d+)`, Template: "[$code](https://kb.example.com/$code)"}
+	ticket := autolink.Autolink{Name: "ticket", Pattern: `(?P<id>MM-\d+)`, Template: "[$id](https://jira.example.com/$id)"}
 
-		api.On("LoadPluginConfiguration",
-			mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
-			*dest.(*Config) = conf
-			return nil
+	for _, tc := range []struct {
+		name            string
+		link            func(l *autolink.Autolink)
+		message         string
+		expectedMessage string
+	}{
+		{
+			name:            "code is skipped by default",
+			link:            func(l *autolink.Autolink) {},
+			message:         "ERR-1 `ERR-2`\n```\nERR-3\n```",
+			expectedMessage: "[ERR-1](https://kb.example.com/ERR-1) `ERR-2`\n```\nERR-3\n```",
+		},
+		{
+			name:            "code spans",
+			link:            func(l *autolink.Autolink) { l.CodeSpans = true },
+			message:         "ERR-1 `failed: ERR-2` and ``ERR-3 ` ERR-4``, MM-1 `x`",
+			expectedMessage: "[ERR-1](https://kb.example.com/ERR-1) `failed: ERR-2` ([ERR-2](https://kb.example.com/ERR-2)) and ``ERR-3 ` ERR-4`` ([ERR-3](https://kb.example.com/ERR-3), [ERR-4](https://kb.example.com/ERR-4)), [MM-1](https://jira.example.com/MM-1) `x`",
+		},
+		{
+			name:            "code blocks only",
+			link:            func(l *autolink.Autolink) { l.CodeBlocks, l.CodeOnly = true, true },
+			message:         "ERR-1 `ERR-2`\n```log\nfailed: ERR-3\nretry: ERR-4\n```\nMM-1",
+			expectedMessage: "ERR-1 `ERR-2`\n```log\nfailed: ERR-3\nretry: ERR-4\n```\n\n[ERR-3](https://kb.example.com/ERR-3), [ERR-4](https://kb.example.com/ERR-4)\n\n[MM-1](https://jira.example.com/MM-1)",
+		},
+		{
+			name:            "code blocks in containers",
+			link:            func(l *autolink.Autolink) { l.CodeBlocks = true },
+			message:         "- step\n  ```\n  ERR-1\n  ```\n\n> ```\n> ERR-2",
+			expectedMessage: "- step\n  ```\n  ERR-1\n  ```\n  \n  [ERR-1](https://kb.example.com/ERR-1)\n  \n\n> ```\n> ERR-2\n> \n> [ERR-2](https://kb.example.com/ERR-2)",
+		},
+		{
+			name:            "indented code",
+			link:            func(l *autolink.Autolink) { l.CodeBlocks = true },
+			message:         "log:\n\n    ERR-1\n\nMM-1",
+			expectedMessage: "log:\n\n    ERR-1\n\n[ERR-1](https://kb.example.com/ERR-1)\n\n\n[MM-1](https://jira.example.com/MM-1)",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			link := errorLink
+			tc.link(&link)
+			conf := Config{Links: []autolink.Autolink{link, ticket}}
+			api := &plugintest.API{}
+			mockLinksStore(api)
+			api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+				*dest.(*Config) = conf
+				return nil
+			})
+			api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+			api.On("GetUser", mock.AnythingOfType("string")).Return(&model.User{}, nil)
+
+			p := New()
+			p.SetAPI(api)
+			require.NoError(t, p.OnConfigurationChange())
+
+			rpost, _ := p.MessageWillBePosted(&plugin.Context{}, &model.Post{Message: tc.message})
+			assert.Equal(t, tc.expectedMessage, rpost.Message)
 		})
-		api.On("UnregisterCommand", mock.AnythingOfType("string"),
-			mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	}
 
-		api.On("GetChannel", mock.AnythingOfType("string")).Return(nil, &model.AppError{})
+	link := autolink.Autolink{Pattern: "a", Template: "b", CodeOnly: true}
+	assert.Error(t, link.Compile())
+}
 
-		api.On("LogError",
-			mock.AnythingOfType("string"),
-			mock.AnythingOfType("string"),
-			mock.AnythingOfType("string")).Return(nil)
+func TestProcessLinkLabels(t *testing.T) {
+	conf := Config{
+		Links: []autolink.Autolink{
+			{Pattern: `(?P<id>MM-\d)`, Template: "$id (open)", ProcessLinkLabels: true},
+			{Pattern: `(?P<id>OPS-\d)`, Template: "[$id](ops)"},
+		},
+	}
 
-		testUser := model.User{
-			IsBot: false,
-		}
-		api.On("GetUser", mock.AnythingOfType("string")).Return(&testUser, nil)
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", mock.AnythingOfType("string")).Return(&model.User{}, nil)
 
-		p := New()
-		p.SetAPI(api)
-		_ = p.OnConfigurationChange()
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
 
-		post := &model.Post{Message: "Welcome to Mattermost!"}
-		rpost, _ := p.ProcessPost(&plugin.Context{}, post)
+	for _, tc := range []struct {
+		message, expected string
+	}{
+		{
+			"[see MM-1 and OPS-1 for details](https://example.com/MM-1) MM-2",
+			"[see MM-1 (open) and OPS-1 for details](https://example.com/MM-1) MM-2 (open)",
+		},
+		{
+			"[MM-1][ref]\n\n[ref]: https://example.com",
+			"[MM-1 (open)][ref]\n\n[ref]: https://example.com",
+		},
+		{
+			"[https://example.com/MM-1](https://example.com) ![MM-1](https://example.com/MM-1.png)",
+			"[https://example.com/MM-1](https://example.com) ![MM-1](https://example.com/MM-1.png)",
+		},
+	} {
+		rpost, _ := p.MessageWillBePosted(&plugin.Context{}, &model.Post{Message: tc.message})
+		assert.Equal(t, tc.expected, rpost.Message, tc.message)
+	}
+}
 
-		assert.Equal(t, "Welcome to Mattermost!", rpost.Message)
-	})
+func TestTerminalLinks(t *testing.T) {
+	expand := autolink.Autolink{Name: "expand", Pattern: `\bk8s\b`, Template: "kubernetes"}
+	link := autolink.Autolink{Name: "link", Pattern: `\bkubernetes\b`, Template: "[kubernetes](https://kubernetes.io)"}
+	ticket := autolink.Autolink{Name: "ticket", Pattern: `(?P<id>MM-\d+)`, Template: "[$id](https://jira.example.com/$id)"}
 
-	t.Run("team name is empty", func(t *testing.T) {
-		conf := Config{
-			Links: []autolink.Autolink{
-				{
-					Pattern:  "(Mattermost)",
-					Template: "[Mattermost](https://mattermost.com)",
-					Scope:    []string{"TestTeam/TestChannel"},
-				},
-			},
+	for _, tc := range []struct {
+		name            string
+		links           []autolink.Autolink
+		message         string
+		expectedMessage string
+	}{
+		{
+			name:            "cascading",
+			links:           []autolink.Autolink{expand, link},
+			message:         "k8s and kubernetes",
+			expectedMessage: "[kubernetes](https://kubernetes.io) and [kubernetes](https://kubernetes.io)",
+		},
+		{
+			name: "terminal",
+			links: []autolink.Autolink{
+				{Name: "expand", Pattern: expand.Pattern, Template: expand.Template, Terminal: true},
+				link,
+			},
+			message:         "k8s and kubernetes",
+			expectedMessage: "kubernetes and [kubernetes](https://kubernetes.io)",
+		},
+		{
+			name: "terminal post",
+			links: []autolink.Autolink{
+				link,
+				{Name: "expand", Pattern: expand.Pattern, Template: expand.Template, TerminalPost: true},
+				ticket,
+			},
+			message:         "MM-1 kubernetes\n\n* k8s",
+			expectedMessage: "MM-1 [kubernetes](https://kubernetes.io)\n\n* kubernetes",
+		},
+		{
+			name: "terminal post without match",
+			links: []autolink.Autolink{
+				{Name: "expand", Pattern: expand.Pattern, Template: expand.Template, TerminalPost: true},
+				ticket,
+			},
+			message:         "MM-1",
+			expectedMessage: "[MM-1](https://jira.example.com/MM-1)",
+		},
+		{
+			name: "shorten",
+			links: []autolink.Autolink{
+				{Name: "shorten", Pattern: `https://jira\.example\.com/(?P<id>MM-\d+)`, Template: "${id}", Kind: autolink.KindShorten},
+				{Name: "ticket", Pattern: ticket.Pattern, Template: ticket.Template, WordMatch: true},
+			},
+			message:         "See https://jira.example.com/MM-1 and MM-2",
+			expectedMessage: "See [MM-1](https://jira.example.com/MM-1) and [MM-2](https://jira.example.com/MM-2)",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := Config{Links: tc.links}
+			api := &plugintest.API{}
+			mockLinksStore(api)
+			api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+				*dest.(*Config) = conf
+				return nil
+			})
+			api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+			api.On("GetUser", mock.AnythingOfType("string")).Return(&model.User{}, nil)
+
+			p := New()
+			p.SetAPI(api)
+			require.NoError(t, p.OnConfigurationChange())
+
+			rpost, _ := p.MessageWillBePosted(&plugin.Context{}, &model.Post{Message: tc.message})
+			assert.Equal(t, tc.expectedMessage, rpost.Message)
+		})
+	}
+}
+
+func TestThreads(t *testing.T) {
+	link := func(threads string) autolink.Autolink {
+		return autolink.Autolink{
+			Pattern:  `(?P<id>INC-\d+)`,
+			Template: "[$id](https://incidents.example.com/$id)",
+			Threads:  threads,
+		}
+	}
+
+	for _, tc := range []struct {
+		name            string
+		threads         string
+		rootID          string
+		expectedMessage string
+	}{
+		{
+			name:            "all posts",
+			rootID:          "root1",
+			expectedMessage: "see [INC-1](https://incidents.example.com/INC-1)",
+		},
+		{
+			name:            "root post",
+			threads:         autolink.ThreadsRoot,
+			expectedMessage: "see [INC-1](https://incidents.example.com/INC-1)",
+		},
+		{
+			name:            "root only, reply",
+			threads:         autolink.ThreadsRoot,
+			rootID:          "root1",
+			expectedMessage: "see INC-1",
+		},
+		{
+			name:            "replies only, root post",
+			threads:         autolink.ThreadsReplies,
+			expectedMessage: "see INC-1",
+		},
+		{
+			name:            "replies only, reply",
+			threads:         autolink.ThreadsReplies,
+			rootID:          "root1",
+			expectedMessage: "see [INC-1](https://incidents.example.com/INC-1)",
+		},
+		{
+			name:            "matching root",
+			threads:         autolink.ThreadsMatchingRoot,
+			rootID:          "root1",
+			expectedMessage: "see [INC-1](https://incidents.example.com/INC-1)",
+		},
+		{
+			name:            "root not matching",
+			threads:         autolink.ThreadsMatchingRoot,
+			rootID:          "root2",
+			expectedMessage: "see INC-1",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := Config{Links: []autolink.Autolink{link(tc.threads)}}
+			api := &plugintest.API{}
+			mockLinksStore(api)
+			api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+				*dest.(*Config) = conf
+				return nil
+			})
+			api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+			api.On("GetUser", mock.AnythingOfType("string")).Return(&model.User{}, nil)
+			root1 := &model.Post{Id: "root1", Message: "[INC-1](https://incidents.example.com/INC-1) is down"}
+			root1.AddProp(originalMessagePostProp, "INC-1 is down")
+			api.On("GetPost", "root1").Return(root1, nil)
+			api.On("GetPost", "root2").Return(&model.Post{Id: "root2", Message: "Hello"}, nil)
+
+			p := New()
+			p.SetAPI(api)
+			require.NoError(t, p.OnConfigurationChange())
+
+			rpost, _ := p.MessageWillBePosted(&plugin.Context{}, &model.Post{RootId: tc.rootID, Message: "see INC-1"})
+			assert.Equal(t, tc.expectedMessage, rpost.Message)
+		})
+	}
+}
+
+func TestPostVariables(t *testing.T) {
+	conf := Config{
+		Links: []autolink.Autolink{{
+			Pattern:  `(?P<key>MM-\d+)`,
+			Template: "[$key](https://jira.example.com/browse/$key?channel=${post.team}/${post.channel}&user=${post.user})",
+		}},
+	}
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", "user1").Return(&model.User{Id: "user1", Username: "alice"}, nil)
+	api.On("GetChannel", "channel1").Return(&model.Channel{Id: "channel1", Name: "town-square", TeamId: "team1"}, nil)
+	api.On("GetTeam", "team1").Return(&model.Team{Id: "team1", Name: "dev"}, nil)
+	api.On("KVGet", userOptOutKeyPrefix+"user1").Return(nil, nil)
+	api.On("KVGet", channelOptOutKeyPrefix+"channel1").Return(nil, nil)
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	rpost, _ := p.MessageWillBePosted(&plugin.Context{}, &model.Post{ChannelId: "channel1", UserId: "user1", Message: "See MM-1"})
+	assert.Equal(t, "See [MM-1](https://jira.example.com/browse/MM-1?channel=dev/town-square&user=alice)", rpost.Message)
+}
+
+func TestLocaleTemplatesOfAuthor(t *testing.T) {
+	conf := Config{
+		Links: []autolink.Autolink{{
+			Pattern:         `(?P<key>MM-\d+)`,
+			Template:        "[$key](https://jira.example.com/browse/$key) (see ticket)",
+			LocaleTemplates: map[string]string{"es": "[$key](https://jira.example.com/browse/$key) (ver ticket)"},
+		}},
+	}
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", "user1").Return(&model.User{Id: "user1", Username: "alice", Locale: "es"}, nil)
+	api.On("GetUser", "user2").Return(&model.User{Id: "user2", Username: "bob", Locale: "en"}, nil)
+	api.On("GetChannel", "channel1").Return(&model.Channel{Id: "channel1", Name: "town-square", TeamId: "team1"}, nil)
+	api.On("GetTeam", "team1").Return(&model.Team{Id: "team1", Name: "dev"}, nil)
+	api.On("KVGet", mock.AnythingOfType("string")).Return(nil, nil)
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	rpost, _ := p.MessageWillBePosted(&plugin.Context{}, &model.Post{ChannelId: "channel1", UserId: "user1", Message: "See MM-1"})
+	assert.Equal(t, "See [MM-1](https://jira.example.com/browse/MM-1) (ver ticket)", rpost.Message)
+	rpost, _ = p.MessageWillBePosted(&plugin.Context{}, &model.Post{ChannelId: "channel1", UserId: "user2", Message: "See MM-1"})
+	assert.Equal(t, "See [MM-1](https://jira.example.com/browse/MM-1) (see ticket)", rpost.Message)
+}
+
+func TestWebhooks(t *testing.T) {
+	var lock sync.Mutex
+	received := map[string][]webhookEvent{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload webhookPayload
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		lock.Lock()
+		received[r.URL.Path] = append(received[r.URL.Path], payload.Events...)
+		lock.Unlock()
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	conf := Config{
+		WebhookURL:          ts.URL + "/global",
+		WebhookAllowedHosts: strings.TrimPrefix(ts.URL, "http://"),
+		Links: []autolink.Autolink{{
+			Name:     "jira",
+			Pattern:  `(?P<key>MM-\d+)`,
+			Template: "[$key](https://jira.example.com/browse/$key)",
+		}, {
+			Name:       "incident",
+			Pattern:    `(?P<id>INC-\d+)`,
+			Template:   "[$id](https://incidents.example.com/$id)",
+			WebhookURL: ts.URL + "/incidents",
+		}},
+	}
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", mock.AnythingOfType("string")).Return(&model.User{}, nil)
+	api.On("GetChannel", "channel1").Return(&model.Channel{Id: "channel1", Name: "town-square", TeamId: "team1"}, nil)
+	api.On("GetTeam", "team1").Return(&model.Team{Id: "team1", Name: "dev"}, nil)
+	api.On("KVGet", userOptOutKeyPrefix+"user1").Return(nil, nil)
+	api.On("KVGet", channelOptOutKeyPrefix+"channel1").Return(nil, nil)
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	rpost, _ := p.MessageWillBePosted(&plugin.Context{}, &model.Post{
+		ChannelId: "channel1",
+		UserId:    "user1",
+		Message:   "MM-1 and MM-2 caused INC-3.\n\nMM-1 again",
+	})
+	require.Contains(t, rpost.Message, "[INC-3]")
+	p.MessageWillBePosted(&plugin.Context{}, &model.Post{ChannelId: "channel1", UserId: "user1", Message: "nothing to link"})
+	p.sendWebhooks()
+
+	require.Len(t, received["/global"], 1)
+	event := received["/global"][0]
+	assert.Equal(t, "jira", event.Link)
+	assert.Equal(t, []string{"MM-1", "MM-2", "MM-1"}, event.Matches)
+	assert.Equal(t, "channel1", event.ChannelID)
+	assert.Equal(t, "town-square", event.ChannelName)
+	assert.Equal(t, "dev", event.TeamName)
+	assert.Equal(t, "user1", event.UserID)
+	assert.NotZero(t, event.Timestamp)
+
+	require.Len(t, received["/incidents"], 1)
+	assert.Equal(t, "incident", received["/incidents"][0].Link)
+	assert.Equal(t, []string{"INC-3"}, received["/incidents"][0].Matches)
+
+	t.Run("failing webhook", func(t *testing.T) {
+		api.On("LogWarn", "Failed to send the events to the webhook", "host", strings.TrimPrefix(ts.URL, "http://"),
+			"events", 1, "error", mock.AnythingOfType("string")).Return()
+		p.webhooks.queue(ts.URL+"/down", webhookEvent{Link: "jira"})
+		p.sendWebhooks()
+		assert.Len(t, received["/down"], 1)
+		api.AssertNumberOfCalls(t, "LogWarn", 1)
+
+		// The events are not sent again
+		p.sendWebhooks()
+		assert.Len(t, received["/down"], 1)
+	})
+
+	t.Run("full batch", func(t *testing.T) {
+		for i := 0; i < webhookBatchSize-1; i++ {
+			assert.False(t, p.webhooks.queue(ts.URL+"/batch", webhookEvent{Link: "jira"}))
+		}
+		assert.True(t, p.webhooks.queue(ts.URL+"/batch", webhookEvent{Link: "jira"}))
+		p.sendWebhooks()
+		assert.Len(t, received["/batch"], webhookBatchSize)
+	})
+}
+
+func TestWebhookAllowed(t *testing.T) {
+	conf := &Config{
+		WebhookURL:          "https://global.example.com/autolink",
+		WebhookAllowedHosts: "hooks.example.com, internal.example.com:8443",
+	}
+	for webhook, allowed := range map[string]bool{
+		"https://global.example.com/autolink":     true,
+		"https://global.example.com/other":        false,
+		"https://hooks.example.com/incidents":     true,
+		"https://HOOKS.example.com:9000/x":        true,
+		"https://internal.example.com:8443/x":     true,
+		"https://internal.example.com/x":          false,
+		"https://attacker.example.net/collect":    false,
+		"http://169.254.169.254/latest/meta-data": false,
+	} {
+		assert.Equal(t, allowed, conf.webhookAllowed(webhook), webhook)
+	}
+
+	link := autolink.Autolink{WebhookURL: "https://attacker.example.net/collect"}
+	assert.Equal(t, conf.WebhookURL, webhookURL(conf, link))
+	link.WebhookURL = "https://hooks.example.com/incidents"
+	assert.Equal(t, link.WebhookURL, webhookURL(conf, link))
+}
+
+func TestTeamAdminSetRejected(t *testing.T) {
+	conf := Config{
+		EnableTeamAdminDelegation: true,
+		Links: []autolink.Autolink{{
+			Name:     "zeta",
+			Pattern:  "zeta",
+			Template: "z",
+			Scope:    []string{"team1"},
+		}, {
+			Name:     "alpha",
+			Pattern:  "alpha",
+			Template: "a",
+			Scope:    []string{"team1"},
+		}},
+	}
+
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", "teamadmin").Return(&model.User{Roles: "system_user"}, nil)
+	api.On("GetTeamByName", "team1").Return(&model.Team{Id: "team1id"}, nil)
+	api.On("GetTeamByName", "team2").Return(&model.Team{Id: "team2id"}, nil)
+	api.On("HasPermissionToTeam", "teamadmin", "team1id", model.PermissionManageTeam).Return(true)
+	api.On("HasPermissionToTeam", "teamadmin", "team2id", model.PermissionManageTeam).Return(false)
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+	live := p.GetLinks()
+
+	resp, appErr := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{
+		UserId:  "teamadmin",
+		TeamId:  "team1id",
+		Command: "/autolink set zeta Scope team2",
+	})
+	require.Nil(t, appErr)
+	assert.Equal(t, "Team admins can only scope links to the teams they administer.", resp.Text)
+	assert.Equal(t, []string{"team1"}, p.GetLinks()[0].Scope, "the rejected change is not applied")
+	assert.Equal(t, "zeta", live[0].Name, "the links are sorted on a copy")
+}
+
+func TestWebhookCommands(t *testing.T) {
+	conf := Config{
+		EnableTeamAdminDelegation: true,
+		WebhookAllowedHosts:       "hooks.example.com",
+		Links: []autolink.Autolink{{
+			Name:       "team1",
+			Pattern:    "team1",
+			Template:   "t1",
+			Scope:      []string{"team1"},
+			WebhookURL: "https://hooks.example.com/secret",
+		}},
+	}
+
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", "adminid").Return(&model.User{Roles: "system_admin system_user"}, nil)
+	api.On("GetUser", "teamadmin").Return(&model.User{Roles: "system_user"}, nil)
+	api.On("GetTeamByName", "team1").Return(&model.Team{Id: "team1id"}, nil)
+	api.On("HasPermissionToTeam", "teamadmin", mock.AnythingOfType("string"), model.PermissionManageTeam).Return(true)
+	api.On("LogInfo", mock.AnythingOfType("string")).Return()
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	run := func(userID, command string) string {
+		resp, appErr := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{
+			UserId:  userID,
+			TeamId:  "team1id",
+			Command: command,
+		})
+		require.Nil(t, appErr)
+		return resp.Text
+	}
+
+	assert.NotContains(t, run("teamadmin", "/autolink list"), "secret")
+	assert.Contains(t, run("adminid", "/autolink list"), "secret")
+
+	assert.Equal(t, "Only system administrators and `autolink` plugin admins can set the WebhookURL of a link.",
+		run("teamadmin", "/autolink set team1 WebhookURL https://attacker.example.net/collect"))
+	assert.Equal(t, `The webhook "https://attacker.example.net/collect" is neither the Webhook URL of the plugin settings nor on one of the allowed webhook hosts.`,
+		run("adminid", "/autolink set team1 WebhookURL https://attacker.example.net/collect"))
+	assert.Equal(t, "https://hooks.example.com/secret", p.GetLinks()[0].WebhookURL)
+
+	run("adminid", "/autolink set team1 WebhookURL https://hooks.example.com/other")
+	assert.Equal(t, "https://hooks.example.com/other", p.GetLinks()[0].WebhookURL)
+}
+
+func TestAttachments(t *testing.T) {
+	conf := Config{
+		Links: []autolink.Autolink{{
+			Name:    "incident",
+			Pattern: `(?P<id>INC-\d+)`,
+			Attachment: &autolink.AttachmentTemplate{
+				Title:     "Incident $id",
+				TitleLink: "https://incidents.example.com/$id",
+				Fields:    []autolink.AttachmentFieldTemplate{{Title: "ID", Value: "$id", Short: true}},
+			},
+		}, {
+			Name:     "ticket",
+			Pattern:  `(?P<id>MM-\d+)`,
+			Template: "[$id](https://jira.example.com/$id)",
+		}},
+	}
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", mock.AnythingOfType("string")).Return(&model.User{}, nil)
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	rpost, _ := p.MessageWillBePosted(&plugin.Context{}, &model.Post{Message: "INC-1 caused MM-2, see INC-1 and `INC-3`"})
+	assert.Equal(t, "INC-1 caused [MM-2](https://jira.example.com/MM-2), see INC-1 and `INC-3`", rpost.Message)
+	attachments := rpost.Attachments()
+	require.Len(t, attachments, 1)
+	assert.Equal(t, "Incident INC-1", attachments[0].Title)
+	assert.Equal(t, "https://incidents.example.com/INC-1", attachments[0].TitleLink)
+	require.Len(t, attachments[0].Fields, 1)
+	assert.Equal(t, "INC-1", attachments[0].Fields[0].Value)
+	assert.Equal(t, model.PostTypeSlackAttachment, rpost.Type)
+
+	rpost.Message += " INC-4"
+	rpost, _ = p.MessageWillBePosted(&plugin.Context{}, rpost)
+	require.Len(t, rpost.Attachments(), 2, "attachments are not added twice")
+	assert.Equal(t, "Incident INC-4", rpost.Attachments()[1].Title)
+}
+
+func TestStatus(t *testing.T) {
+	conf := Config{}
+	api := &plugintest.API{}
+	// The invalid link was saved before links were validated
+	data := mockLinksStore(api)
+	*data, _ = json.Marshal([]autolink.Autolink{
+		{Name: "mm", Pattern: `(?P<id>MM-\d)`, Template: "[$id](mm)"},
+		{Name: "invalid", Pattern: `(`, Template: "x"},
+		{Name: "scoped", Pattern: `OPS-\d`, Template: "ops", Scope: []string{"team"}},
+	})
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("LogError", "Error creating autolinker", "link", mock.Anything, "error", mock.AnythingOfType("string"))
+	api.On("LogError", "Failed to resolve scope", "error", mock.AnythingOfType("string"))
+	api.On("KVGet", mock.AnythingOfType("string")).Return(nil, nil)
+	api.On("GetChannel", "channelid").Return(nil, &model.AppError{Message: "channel not found"})
+	api.On("GetUser", mock.AnythingOfType("string")).Return(&model.User{}, nil)
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	rpost, _ := p.MessageWillBePosted(&plugin.Context{}, &model.Post{ChannelId: "channelid", Message: "MM-1 OPS-1"})
+	assert.Equal(t, "[MM-1](mm) OPS-1", rpost.Message)
+
+	status := p.Status()
+	assert.Empty(t, status.ConfigError)
+	assert.Equal(t, 1, status.ScopeFailures)
+	assert.Contains(t, status.LastScopeFailure, "channel not found")
+	assert.NotNil(t, status.LastScopeFailureAt)
+	require.Len(t, status.Links, 3)
+	assert.NotNil(t, status.Links[0].LastFiredAt)
+	assert.Empty(t, status.Links[0].CompileError)
+	assert.Contains(t, status.Links[1].CompileError, "missing closing )")
+	assert.Nil(t, status.Links[2].LastFiredAt)
+}
+
+func TestHashtags(t *testing.T) {
+	conf := Config{
+		Links: []autolink.Autolink{{
+			Pattern:  "foo",
+			Template: "#bar",
+		}, {
+			Pattern:  "hash tags",
+			Template: "#hash #tags",
+		}},
+	}
+
+	testChannel := model.Channel{
+		Name: "TestChanel",
+	}
+
+	testTeam := model.Team{
+		Name: "TestTeam",
+	}
+
+	api := &plugintest.API{}
+	mockLinksStore(api)
+
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+
+	api.On("GetChannel", mock.AnythingOfType("string")).Return(&testChannel, nil)
+	api.On("GetTeam", mock.AnythingOfType("string")).Return(&testTeam, nil)
+
+	testUser := model.User{
+		IsBot: false,
+	}
+	api.On("GetUser", mock.AnythingOfType("string")).Return(&testUser, nil)
+
+	p := New()
+	p.SetAPI(api)
+	err := p.OnConfigurationChange()
+	require.NoError(t, err)
+
+	post := &model.Post{Message: "foo"}
+	rpost, _ := p.MessageWillBePosted(&plugin.Context{}, post)
+
+	assert.Equal(t, "#bar", rpost.Hashtags)
+
+	post.Message = "hash tags"
+	rpost, _ = p.MessageWillBePosted(&plugin.Context{}, post)
+
+	assert.Equal(t, "#hash #tags", rpost.Hashtags)
+}
+
+func TestAPI(t *testing.T) {
+	conf := Config{
+		Links: []autolink.Autolink{{
+			Name:     "existing",
+			Pattern:  "thing",
+			Template: "otherthing",
+		}},
+	}
+
+	testChannel := model.Channel{
+		Name: "TestChanel",
+	}
+
+	testTeam := model.Team{
+		Name: "TestTeam",
+	}
+
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetChannel", mock.AnythingOfType("string")).Return(&testChannel, nil)
+	api.On("GetTeam", mock.AnythingOfType("string")).Return(&testTeam, nil)
+	api.On("SavePluginConfig", mock.AnythingOfType("map[string]interface {}")).Return(nil)
+	api.On("GetBundlePath").Return(".", nil)
+	api.On("GetUserByUsername", "autolink").Return(&model.User{Id: "botid", IsBot: true}, nil)
+	// Called by the background jobs
+	api.On("GetPluginStatus", mock.AnythingOfType("string")).Return(&model.PluginStatus{}, nil)
+	api.On("KVGet", failuresKey).Return(nil, nil)
+	api.On("KVGet", pauseKey).Return(nil, nil)
+	api.On("KVGet", middlewaresKey).Return(nil, nil)
+
+	p := New()
+	p.SetAPI(api)
+	err := p.OnConfigurationChange()
+	require.NoError(t, err)
+	err = p.OnActivate()
+	require.NoError(t, err)
+	defer func() { _ = p.OnDeactivate() }()
+	assert.True(t, p.isBotPost(&model.Post{UserId: "botid"}), "the bot is ensured on activation")
+
+	jbyte, err := json.Marshal(&autolink.Autolink{Name: "new", Pattern: "newpat", Template: "newtemp"})
+	require.NoError(t, err)
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest("POST", "/api/v1/link", bytes.NewReader(jbyte))
+	require.NoError(t, err)
+	req.Header.Set("Mattermost-Plugin-ID", "somthing")
+	p.ServeHTTP(&plugin.Context{}, recorder, req)
+	resp := recorder.Result()
+	require.NotNil(t, resp)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, p.conf.Links, 2)
+	assert.Equal(t, "new", p.conf.Links[1].Name)
+}
+
+func TestResolveScope(t *testing.T) {
+	t.Run("resolve channel name and team name", func(t *testing.T) {
+		testChannel := model.Channel{
+			Name:   "TestChannel",
+			TeamId: "TestId",
+		}
+
+		testTeam := model.Team{
+			Name: "TestTeam",
+		}
+
+		api := &plugintest.API{}
+		api.On("GetChannel", mock.AnythingOfType("string")).Return(&testChannel, nil)
+		api.On("GetTeam", mock.AnythingOfType("string")).Return(&testTeam, nil)
+
+		p := New()
+		p.SetAPI(api)
+		channelName, teamName, _ := p.resolveScope("TestId")
+		assert.Equal(t, "TestChannel", channelName)
+		assert.Equal(t, "TestTeam", teamName)
+	})
+
+	t.Run("resolve channel name and returns empty team name", func(t *testing.T) {
+		testChannel := model.Channel{
+			Name: "TestChannel",
+		}
+
+		api := &plugintest.API{}
+		api.On("GetChannel", mock.AnythingOfType("string")).Return(&testChannel, nil)
+
+		p := New()
+		p.SetAPI(api)
+
+		channelName, teamName, _ := p.resolveScope("TestId")
+		assert.Equal(t, "TestChannel", channelName)
+		assert.Equal(t, "", teamName)
+	})
+
+	t.Run("error when api fails to get channel", func(t *testing.T) {
+		api := &plugintest.API{}
+
+		api.On("GetChannel",
+			mock.AnythingOfType("string")).Return(nil, &model.AppError{})
+
+		p := New()
+		p.SetAPI(api)
+
+		channelName, teamName, err := p.resolveScope("TestId")
+		assert.Error(t, err)
+		assert.Equal(t, teamName, "")
+		assert.Equal(t, channelName, "")
+	})
+
+	t.Run("error when api fails to get team", func(t *testing.T) {
+		testChannel := model.Channel{
+			Name:   "TestChannel",
+			TeamId: "TestId",
+		}
+
+		api := &plugintest.API{}
+
+		api.On("GetChannel", mock.AnythingOfType("string")).Return(&testChannel, nil)
+		api.On("GetTeam", mock.AnythingOfType("string")).Return(nil, &model.AppError{})
+
+		p := New()
+		p.SetAPI(api)
+
+		channelName, teamName, err := p.resolveScope("TestId")
+		assert.Error(t, err)
+		assert.Equal(t, channelName, "")
+		assert.Equal(t, teamName, "")
+	})
+
+	t.Run("cache channel name and team name", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("GetChannel", "channel1").Return(&model.Channel{Name: "town-square", TeamId: "team1"}, nil).Once()
+		api.On("GetTeam", "team1").Return(&model.Team{Name: "TestTeam"}, nil).Once()
+
+		p := New()
+		p.SetAPI(api)
+
+		for i := 0; i < 2; i++ {
+			channelName, teamName, err := p.resolveScope("channel1")
+			require.Nil(t, err)
+			assert.Equal(t, "town-square", channelName)
+			assert.Equal(t, "TestTeam", teamName)
+		}
+		api.AssertNumberOfCalls(t, "GetChannel", 1)
+		api.AssertNumberOfCalls(t, "GetTeam", 1)
+
+		// The channel is looked up again once renamed
+		api.On("GetChannel", "channel1").Return(&model.Channel{Name: "lobby", TeamId: "team1"}, nil).Once()
+		p.invalidateScope(&model.Post{ChannelId: "channel1", Type: model.PostTypeDisplaynameChange})
+		channelName, teamName, err := p.resolveScope("channel1")
+		require.Nil(t, err)
+		assert.Equal(t, "lobby", channelName)
+		assert.Equal(t, "TestTeam", teamName)
+		api.AssertNumberOfCalls(t, "GetChannel", 2)
+		api.AssertNumberOfCalls(t, "GetTeam", 1)
+	})
+}
+
+func TestProcessPost(t *testing.T) {
+	t.Run("cannot resolve scope", func(t *testing.T) {
+		conf := Config{
+			Links: []autolink.Autolink{
+				{
+					Pattern:  "(Mattermost)",
+					Template: "[Mattermost](https://mattermost.com)",
+					Scope:    []string{"TestTeam/TestChannel"},
+				},
+			},
+		}
+
+		api := &plugintest.API{}
+		mockLinksStore(api)
+
+		api.On("LoadPluginConfiguration",
+			mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+			*dest.(*Config) = conf
+			return nil
+		})
+		api.On("UnregisterCommand", mock.AnythingOfType("string"),
+			mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+
+		api.On("GetChannel", mock.AnythingOfType("string")).Return(nil, &model.AppError{})
+
+		api.On("LogError",
+			mock.AnythingOfType("string"),
+			mock.AnythingOfType("string"),
+			mock.AnythingOfType("string")).Return(nil)
+
+		testUser := model.User{
+			IsBot: false,
+		}
+		api.On("GetUser", mock.AnythingOfType("string")).Return(&testUser, nil)
+
+		p := New()
+		p.SetAPI(api)
+		_ = p.OnConfigurationChange()
+
+		post := &model.Post{Message: "Welcome to Mattermost!"}
+		rpost, _ := p.ProcessPost(&plugin.Context{}, post)
+
+		assert.Equal(t, "Welcome to Mattermost!", rpost.Message)
+	})
+
+	t.Run("team name is empty", func(t *testing.T) {
+		conf := Config{
+			Links: []autolink.Autolink{
+				{
+					Pattern:  "(Mattermost)",
+					Template: "[Mattermost](https://mattermost.com)",
+					Scope:    []string{"TestTeam/TestChannel"},
+				},
+			},
+		}
+
+		testChannel := model.Channel{
+			Name: "TestChannel",
+		}
+
+		api := &plugintest.API{}
+		mockLinksStore(api)
+
+		api.On("LoadPluginConfiguration",
+			mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+			*dest.(*Config) = conf
+			return nil
+		})
+		api.On("UnregisterCommand", mock.AnythingOfType("string"),
+			mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+		api.On("GetChannel", mock.AnythingOfType("string")).Return(&testChannel, nil)
+		api.On("LogError",
+			mock.AnythingOfType("string"),
+			mock.AnythingOfType("string"),
+			mock.AnythingOfType("string")).Return(nil)
+
+		testUser := model.User{
+			IsBot: false,
+		}
+		api.On("GetUser", mock.AnythingOfType("string")).Return(&testUser, nil)
+
+		p := New()
+		p.SetAPI(api)
+		_ = p.OnConfigurationChange()
+
+		post := &model.Post{Message: "Welcome to Mattermost!"}
+		rpost, _ := p.ProcessPost(&plugin.Context{}, post)
+
+		assert.Equal(t, "Welcome to Mattermost!", rpost.Message)
+	})
+
+	t.Run("valid scope replaces text", func(t *testing.T) {
+		conf := Config{
+			Links: []autolink.Autolink{
+				{
+					Pattern:  "(Mattermost)",
+					Template: "[Mattermost](https://mattermost.com)",
+					Scope:    []string{"TestTeam/TestChannel"},
+				},
+			},
+		}
+
+		testChannel := model.Channel{
+			Name:   "TestChannel",
+			TeamId: "TestId",
+		}
+
+		testTeam := model.Team{
+			Name: "TestTeam",
+		}
+
+		api := &plugintest.API{}
+		mockLinksStore(api)
+
+		api.On("LoadPluginConfiguration",
+			mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+			*dest.(*Config) = conf
+			return nil
+		})
+		api.On("UnregisterCommand", mock.AnythingOfType("string"),
+			mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+
+		api.On("GetChannel", mock.AnythingOfType("string")).Return(&testChannel, nil)
+		api.On("GetTeam", mock.AnythingOfType("string")).Return(&testTeam, nil)
+
+		testUser := model.User{
+			IsBot: false,
+		}
+		api.On("GetUser", mock.AnythingOfType("string")).Return(&testUser, nil)
+
+		p := New()
+		p.SetAPI(api)
+		_ = p.OnConfigurationChange()
+
+		post := &model.Post{Message: "Welcome to Mattermost!"}
+		rpost, _ := p.ProcessPost(&plugin.Context{}, post)
+
+		assert.Equal(t, "Welcome to [Mattermost](https://mattermost.com)!", rpost.Message)
+	})
+}
+
+func TestInScope(t *testing.T) {
+	t.Run("returns true if scope array is empty", func(t *testing.T) {
+		p := &Plugin{}
+		result := p.inScope([]string{}, "TestChannel", "TestTeam")
+		assert.Equal(t, true, result)
+	})
+
+	t.Run("returns true when team and channels are valid", func(t *testing.T) {
+		p := &Plugin{}
+		result := p.inScope([]string{"TestTeam/TestChannel"}, "TestChannel", "TestTeam")
+		assert.Equal(t, true, result)
+	})
+
+	t.Run("returns false when channel is empty", func(t *testing.T) {
+		p := &Plugin{}
+		result := p.inScope([]string{"TestTeam/"}, "TestChannel", "TestTeam")
+		assert.Equal(t, false, result)
+	})
+
+	t.Run("returns false when team is empty", func(t *testing.T) {
+		p := &Plugin{}
+		result := p.inScope([]string{"TestTeam/TestChannel"}, "TestChannel", "")
+		assert.Equal(t, false, result)
+	})
+
+	t.Run("returns false on empty scope", func(t *testing.T) {
+		p := &Plugin{}
+		result := p.inScope([]string{""}, "TestChannel", "TestTeam")
+		assert.Equal(t, false, result)
+	})
+
+	t.Run("returns true on team scope only", func(t *testing.T) {
+		p := &Plugin{}
+		result := p.inScope([]string{"TestTeam"}, "TestChannel", "TestTeam")
+		assert.Equal(t, true, result)
+	})
+
+	t.Run("wildcard scopes", func(t *testing.T) {
+		p := &Plugin{}
+		for _, tc := range []struct {
+			scope    string
+			expected bool
+		}{
+			{scope: "testteam/*", expected: true},
+			{scope: "otherteam/*", expected: false},
+			{scope: "*/incident-*", expected: true},
+			{scope: "*/incident-*-old", expected: false},
+			{scope: "test*", expected: true},
+			{scope: "*", expected: true},
+			{scope: "*/town-square", expected: false},
+			{scope: "TestTeam/incident-?", expected: true},
+			{scope: "TestTeam/[", expected: false},
+		} {
+			result := p.inScope([]string{tc.scope}, "incident-1", "TestTeam")
+			assert.Equal(t, tc.expected, result, "scope: %s", tc.scope)
+		}
+
+		assert.False(t, p.inScope([]string{"*"}, "dm-channel", ""), "DMs are never in scope")
+	})
+
+	t.Run("scopes by ID", func(t *testing.T) {
+		teamID, channelID, otherID := model.NewId(), model.NewId(), model.NewId()
+		api := &plugintest.API{}
+		api.On("GetTeam", teamID).Return(&model.Team{Name: "testteam"}, nil)
+		api.On("GetChannel", channelID).Return(&model.Channel{Name: "incident-1", TeamId: teamID}, nil)
+		api.On("GetTeam", otherID).Return(nil, &model.AppError{StatusCode: http.StatusNotFound})
+		api.On("GetChannel", otherID).Return(nil, &model.AppError{StatusCode: http.StatusNotFound})
+		p := New()
+		p.SetAPI(api)
+
+		for _, tc := range []struct {
+			scope    string
+			expected bool
+		}{
+			{scope: teamID, expected: true},
+			{scope: teamID + "/" + channelID, expected: true},
+			{scope: "TestTeam/" + channelID, expected: true},
+			{scope: teamID + "/incident-1", expected: true},
+			{scope: otherID, expected: false},
+			{scope: teamID + "/" + otherID, expected: false},
+			{scope: "otherteam/" + channelID, expected: false},
+		} {
+			result := p.inScope([]string{tc.scope}, "incident-1", "TestTeam")
+			assert.Equal(t, tc.expected, result, "scope: %s", tc.scope)
+		}
+	})
+}
+
+func TestRenameChannelScopes(t *testing.T) {
+	api := &plugintest.API{}
+	data := mockLinksStore(api)
+	*data, _ = json.Marshal([]autolink.Autolink{
+		{Name: "renamed", Pattern: "a", Template: "b", Scope: []string{"TestTeam/Town-Square", "other/town-square"}},
+		{Name: "wildcard", Pattern: "c", Template: "d", Scope: []string{"TestTeam/town-*"}},
+	})
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(nil)
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetChannel", "channel1").Return(&model.Channel{Name: "town-square", TeamId: "team1"}, nil).Once()
+	api.On("GetTeam", "team1").Return(&model.Team{Name: "testteam"}, nil).Once()
+	api.On("LogInfo", "Updated the scopes of the renamed channel", "from", "testteam/town-square", "to", "testteam/lobby", "count", 1)
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+	_, _, appErr := p.resolveScope("channel1")
+	require.Nil(t, appErr)
+
+	api.On("GetChannel", "channel1").Return(&model.Channel{Name: "lobby", TeamId: "team1"}, nil).Once()
+	p.invalidateScope(&model.Post{ChannelId: "channel1", Type: model.PostTypeDisplaynameChange})
+
+	links := savedLinks(t, *data)
+	assert.Equal(t, []string{"testteam/lobby", "other/town-square"}, links[0].Scope)
+	assert.Equal(t, []string{"TestTeam/town-*"}, links[1].Scope, "wildcard scopes are left as they are")
+	assert.True(t, p.inScope(p.GetLinks()[0].Scope, "lobby", "testteam"))
+}
+
+func TestLinksInScope(t *testing.T) {
+	p := &Plugin{}
+	conf := &Config{
+		Links: []autolink.Autolink{
+			{Name: "global"},
+			{Name: "team", Scope: []string{"TestTeam"}},
+			{Name: "channel", Scope: []string{"TestTeam/incident-*"}},
+			{Name: "other", Scope: []string{"OtherTeam"}},
+			{Name: "debug", Scope: []string{"OtherTeam"}, Debug: true},
+		},
+		scopeIndex: newScopeIndex(),
+	}
+	names := func(links []autolink.Autolink) []string {
+		names := []string{}
+		for _, link := range links {
+			names = append(names, link.Name)
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"global", "team", "channel", "debug"}, names(p.linksInScope(conf, "incident-1", "TestTeam")))
+	assert.Equal(t, []string{"global", "team", "debug"}, names(p.linksInScope(conf, "town-square", "TestTeam")))
+	assert.Equal(t, []string{"global", "debug"}, names(p.linksInScope(conf, "dm-channel", "")))
+	assert.Len(t, conf.scopeIndex.links, 3)
+
+	// The links are taken from the index once the channel is indexed
+	conf.Links = conf.Links[:1]
+	assert.Equal(t, []string{"global", "team", "channel", "debug"}, names(p.linksInScope(conf, "Incident-1", "testteam")))
+	conf.scopeIndex = nil
+	assert.Equal(t, []string{"global"}, names(p.linksInScope(conf, "incident-1", "TestTeam")))
+}
+
+func TestRemoveOrphanedPluginLinks(t *testing.T) {
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("GetPluginStatus", "installed").Return(&model.PluginStatus{PluginId: "installed"}, nil)
+	api.On("GetPluginStatus", "removed").Return(nil, &model.AppError{StatusCode: http.StatusNotFound})
+	api.On("LogInfo", mock.AnythingOfType("string"), "link", "removed-link", "plugin_id", "removed").Return()
+	api.On("SavePluginConfig", mock.AnythingOfType("map[string]interface {}")).Return(nil)
+
+	p := New()
+	p.SetAPI(api)
+	p.UpdateConfig(func(conf *Config) {
+		conf.Links = []autolink.Autolink{
+			{Name: "admin-link"},
+			{Name: "installed-link", PluginID: "installed"},
+			{Name: "removed-link", PluginID: "removed"},
+		}
+	})
+
+	p.removeOrphanedPluginLinks()
+
+	require.Len(t, p.GetLinks(), 2)
+	assert.Equal(t, "admin-link", p.GetLinks()[0].Name)
+	assert.Equal(t, "installed-link", p.GetLinks()[1].Name)
+	api.AssertNumberOfCalls(t, "KVSetWithOptions", 1)
+}
+
+func TestActivateWithoutBot(t *testing.T) {
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(nil)
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetBundlePath").Return(".", nil)
+	api.On("GetUserByUsername", "autolink").Return(nil, &model.AppError{StatusCode: http.StatusNotFound})
+	api.On("CreateBot", mock.AnythingOfType("*model.Bot")).Return(nil, &model.AppError{Message: "bots are disabled"})
+	api.On("LogWarn", "Failed to ensure the bot", "error", mock.AnythingOfType("string"))
+	api.On("SendEphemeralPost", "user1", mock.AnythingOfType("*model.Post")).Return(nil)
+	// Called by the background jobs
+	api.On("GetPluginStatus", mock.AnythingOfType("string")).Return(&model.PluginStatus{}, nil)
+	api.On("KVGet", failuresKey).Return(nil, nil)
+	api.On("KVGet", pauseKey).Return(nil, nil)
+	api.On("KVGet", middlewaresKey).Return(nil, nil)
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+	require.NoError(t, p.OnActivate())
+	defer func() { _ = p.OnDeactivate() }()
+
+	api.AssertCalled(t, "LogWarn", "Failed to ensure the bot", "error", mock.AnythingOfType("string"))
+	p.sendBotEphemeral("user1", &model.Post{Message: "hello"})
+	api.AssertCalled(t, "SendEphemeralPost", "user1", mock.MatchedBy(func(post *model.Post) bool {
+		return post.UserId == "" && post.Message == "hello"
+	}))
+}
+
+func TestNotifyExpiredLinks(t *testing.T) {
+	now := time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC)
+
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("GetUserByUsername", "autolink").Return(nil, &model.AppError{StatusCode: http.StatusNotFound})
+	api.On("CreateBot", mock.AnythingOfType("*model.Bot")).Return(&model.Bot{UserId: "botid"}, nil)
+	api.On("GetDirectChannel", "botid", "adminid").Return(&model.Channel{Id: "dmid"}, nil)
+	api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+		return post.ChannelId == "dmid" && post.UserId == "botid" &&
+			strings.Contains(post.Message, "`expired`") && !strings.Contains(post.Message, "`current`")
+	})).Return(&model.Post{}, nil)
+	api.On("SavePluginConfig", mock.AnythingOfType("map[string]interface {}")).Return(nil)
+
+	links := []autolink.Autolink{
+		{Name: "expired", Pattern: "a", Template: "b", ExpiresAt: "2024-01-01T00:00:00Z"},
+		{Name: "current", Pattern: "a", Template: "b", ExpiresAt: "2024-02-01T00:00:00Z"},
+		{Name: "forever", Pattern: "a", Template: "b"},
+	}
+	for i := range links {
+		require.NoError(t, links[i].Compile())
+	}
+
+	p := New()
+	p.SetAPI(api)
+	p.UpdateConfig(func(conf *Config) {
+		conf.Links = links
+		conf.AdminUserIds = map[string]struct{}{"adminid": {}}
+	})
+
+	p.notifyExpiredLinks(now)
+	assert.Equal(t, "2024-01-01T00:00:00Z", p.GetLinks()[0].ExpiryNotified)
+	assert.Empty(t, p.GetLinks()[1].ExpiryNotified)
+
+	p.notifyExpiredLinks(now)
+	api.AssertNumberOfCalls(t, "CreateBot", 1)
+	api.AssertNumberOfCalls(t, "CreatePost", 1)
+	api.AssertNumberOfCalls(t, "KVSetWithOptions", 1)
+}
+
+func TestNotifyFailures(t *testing.T) {
+	api := &plugintest.API{}
+	var notified []byte
+	api.On("KVGet", failuresKey).Return(func(string) []byte {
+		return notified
+	}, nil)
+	api.On("KVSetWithOptions", failuresKey, mock.Anything, mock.AnythingOfType("model.PluginKVSetOptions")).Return(
+		func(_ string, value []byte, options model.PluginKVSetOptions) bool {
+			if !bytes.Equal(options.OldValue, notified) {
+				return false
+			}
+			notified = value
+			return true
+		}, nil)
+	api.On("GetUserByUsername", "autolink").Return(&model.User{Id: "botid", IsBot: true}, nil)
+	api.On("GetDirectChannel", "botid", "adminid").Return(&model.Channel{Id: "dmid"}, nil)
+	var messages []string
+	api.On("CreatePost", mock.AnythingOfType("*model.Post")).Return(func(post *model.Post) *model.Post {
+		messages = append(messages, post.Message)
+		return post
+	}, nil)
+
+	p := New()
+	p.SetAPI(api)
+	p.UpdateConfig(func(conf *Config) {
+		conf.Links = []autolink.Autolink{{Name: "broken", Pattern: "(", Template: "a"}, {Name: "fine", Pattern: "a", Template: "b"}}
+		conf.compileErrors = []error{errors.New("missing closing )"), nil}
+		conf.AdminUserIds = map[string]struct{}{"adminid": {}}
+	})
+
+	p.notifyFailures()
+	require.Len(t, messages, 1)
+	assert.Contains(t, messages[0], "Link `broken` does not compile: missing closing )")
+	assert.NotContains(t, messages[0], "fine")
+
+	p.notifyFailures()
+	assert.Len(t, messages, 1, "failures are only reported once")
+
+	for i := 0; i < scopeFailureThreshold; i++ {
+		p.diagnostics.scopeFailed(errors.New("channel not found"))
+	}
+	p.diagnostics.setConfigError(errors.New("bad config"))
+	p.notifyFailures()
+	require.Len(t, messages, 2)
+	assert.NotContains(t, messages[1], "broken")
+	assert.Contains(t, messages[1], "The configuration could not be loaded: bad config")
+	assert.Contains(t, messages[1], "10 times, last: channel not found")
+
+	p.diagnostics.setConfigError(nil)
+	p.UpdateConfig(func(conf *Config) {
+		conf.compileErrors = nil
+	})
+	p.notifyFailures()
+	assert.Equal(t, "{}", string(notified), "fixed failures are forgotten")
+	assert.Len(t, messages, 2)
+}
+
+func TestTelemetry(t *testing.T) {
+	now := time.Date(2024, time.January, 10, 12, 0, 0, 0, time.UTC)
+
+	var bodies []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/track", r.URL.Path)
+		key, _, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "write-key", key)
+		var body map[string]interface{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		bodies = append(bodies, body)
+	}))
+	defer server.Close()
+	defer func(key, url string) { rudderWriteKey, rudderDataplaneURL = key, url }(rudderWriteKey, rudderDataplaneURL)
+	rudderWriteKey, rudderDataplaneURL = "write-key", server.URL
+
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	kv := map[string][]byte{
+		usageKeyPrefix + "2024-01-09": []byte(`{"jira":{"channel1":150}}`),
+	}
+	api.On("KVGet", mock.MatchedBy(func(key string) bool { return strings.HasPrefix(key, usageKeyPrefix) })).Return(
+		func(key string) []byte { return kv[key] }, nil)
+	api.On("KVSetWithOptions", telemetryKey, mock.Anything, mock.AnythingOfType("model.PluginKVSetOptions")).Return(
+		func(key string, value []byte, options model.PluginKVSetOptions) bool {
+			if kv[key] != nil {
+				return false
+			}
+			kv[key] = value
+			return true
+		}, nil)
+	api.On("GetChannel", "channel1").Return(&model.Channel{Id: "channel1", Name: "town-square", TeamId: "team1"}, nil)
+	api.On("GetTeam", "team1").Return(&model.Team{Name: "secret-team"}, nil)
+	api.On("GetDiagnosticId").Return("installation")
+	api.On("GetServerVersion").Return("6.0.3")
+	serverConfig := &model.Config{}
+	serverConfig.SetDefaults()
+	api.On("GetConfig").Return(serverConfig)
+
+	p := New()
+	p.SetAPI(api)
+	p.UpdateConfig(func(conf *Config) {
+		conf.Links = []autolink.Autolink{
+			{Name: "jira", Pattern: "secret-pattern", Template: "secret-template", Scope: []string{"secret-team"}, CaseInsensitive: true},
+			{Name: "redact", Pattern: "a", Template: "b", Kind: autolink.KindRedact, Disabled: true},
+		}
+		conf.EnableOnUpdate = true
+	})
+
+	p.sendTelemetry(now)
+	assert.Empty(t, bodies, "the admins did not opt in")
+
+	p.UpdateConfig(func(conf *Config) { conf.EnableTelemetry = true })
+	*serverConfig.LogSettings.EnableDiagnostics = false
+	p.sendTelemetry(now)
+	assert.Empty(t, bodies, "the telemetry of the server is disabled")
+
+	*serverConfig.LogSettings.EnableDiagnostics = true
+	p.sendTelemetry(now)
+	require.Len(t, bodies, 1)
+	assert.Equal(t, "installation", bodies[0]["userId"])
+	assert.Equal(t, telemetryEvent, bodies[0]["event"])
+	assert.Equal(t, map[string]interface{}{
+		"links":          float64(2),
+		"disabled_links": float64(1),
+		"kinds":          map[string]interface{}{"default": float64(1), "redact": float64(1)},
+		"features":       map[string]interface{}{"scope": float64(1), "case_insensitive": float64(1)},
+		"settings":       []interface{}{"on_update"},
+		"weekly_posts":   "100-999",
+		"server_version": "6.0.3",
+	}, bodies[0]["properties"])
+	data, err := json.Marshal(bodies[0])
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "secret")
+	assert.NotContains(t, string(data), "jira")
+
+	p.sendTelemetry(now.Add(time.Hour))
+	assert.Len(t, bodies, 1, "the telemetry is sent once a day")
+}
+
+func TestTelemetryBucket(t *testing.T) {
+	for n, expected := range map[int]string{0: "0", 1: "1-99", 99: "1-99", 100: "100-999", 12345: "10000-99999", 100000: "100000+"} {
+		assert.Equal(t, expected, telemetryBucket(n), "%d", n)
+	}
+}
+
+func TestAdminDigest(t *testing.T) {
+	now := time.Date(2024, time.January, 10, 12, 0, 0, 0, time.UTC)
+
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	kv := map[string][]byte{
+		usageKeyPrefix + "2024-01-10": []byte(`{"jira":{"channel1":3},"old":{"channel1":1}}`),
+		usageKeyPrefix + "2024-01-02": []byte(`{"old":{"channel1":5}}`),
+	}
+	kvKey := mock.MatchedBy(func(key string) bool {
+		return key == digestKey || key == failuresKey || strings.HasPrefix(key, usageKeyPrefix)
+	})
+	api.On("KVGet", kvKey).Return(func(key string) []byte { return kv[key] }, nil)
+	api.On("KVSetWithOptions", kvKey, mock.Anything, mock.AnythingOfType("model.PluginKVSetOptions")).Return(
+		func(key string, value []byte, options model.PluginKVSetOptions) bool {
+			if !bytes.Equal(options.OldValue, kv[key]) {
+				return false
+			}
+			kv[key] = value
+			return true
+		}, nil)
+	api.On("GetChannel", "channel1").Return(&model.Channel{Id: "channel1", Name: "town-square"}, nil)
+	api.On("GetUserByUsername", "autolink").Return(&model.User{Id: "botid", IsBot: true}, nil)
+	api.On("GetDirectChannel", "botid", "adminid").Return(&model.Channel{Id: "dmid"}, nil)
+	var messages []string
+	api.On("CreatePost", mock.AnythingOfType("*model.Post")).Return(func(post *model.Post) *model.Post {
+		messages = append(messages, post.Message)
+		return post
+	}, nil)
+
+	links := []autolink.Autolink{
+		{Name: "jira", Pattern: "a", Template: "b"},
+		{Name: "old", Pattern: "a", Template: "b", ExpiresAt: "2024-01-10T00:00:00Z"},
+		{Name: "soon", Pattern: "a", Template: "b", ExpiresAt: "2024-01-12T00:00:00Z"},
+		{Name: "broken", Pattern: "(", Template: "a"},
+	}
+	for i := range links[:3] {
+		require.NoError(t, links[i].Compile())
+	}
+	p := New()
+	p.SetAPI(api)
+	p.UpdateConfig(func(conf *Config) {
+		conf.Links = links
+		conf.compileErrors = []error{nil, nil, nil, errors.New("missing closing )")}
+		conf.AdminUserIds = map[string]struct{}{"adminid": {}}
+		conf.AdminDigest = adminDigestDaily
+	})
+
+	p.sendDigest(now)
+	p.notifyFailures()
+	p.notifyExpiredLinks(now)
+	assert.Empty(t, messages, "the events wait for the digest")
+	assert.Equal(t, "2024-01-10T00:00:00Z", p.GetLinks()[1].ExpiryNotified)
+
+	p.sendDigest(now.Add(23 * time.Hour))
+	assert.Empty(t, messages, "the first digest is sent a day after it was enabled")
+
+	p.sendDigest(now.Add(24 * time.Hour))
+	require.Len(t, messages, 1)
+	assert.Contains(t, messages[0], "daily digest")
+	assert.Contains(t, messages[0], "Link `broken` does not compile: missing closing )")
+	assert.Contains(t, messages[0], "- `old` (expired at 2024-01-10T00:00:00Z)")
+	assert.Contains(t, messages[0], "- `soon` expires at 2024-01-12T00:00:00Z")
+	assert.Contains(t, messages[0], "changed 4 post(s), 2 enabled link(s) changed none")
+	assert.Contains(t, messages[0], "  - `jira`: 3 post(s)\n  - `old`: 1 post(s)\n")
+
+	p.sendDigest(now.Add(36 * time.Hour))
+	assert.Len(t, messages, 1, "the digest is sent once a day")
+
+	p.UpdateConfig(func(conf *Config) {
+		conf.AdminDigest = ""
+	})
+	p.sendDigest(now.Add(72 * time.Hour))
+	assert.Len(t, messages, 1)
+	p.notifyExpiredLinks(now.Add(72 * time.Hour))
+	require.Len(t, messages, 2, "the admins are notified of each event without a digest")
+	assert.Contains(t, messages[1], "`soon`")
+}
+
+func TestSlowLinks(t *testing.T) {
+	d := &diagnostics{}
+	for i := 0; i < slowLinkMinSamples-1; i++ {
+		d.linkTimed("slow", 50*time.Millisecond)
+	}
+	assert.Empty(t, d.slowLinks(10*time.Millisecond), "too few samples")
+
+	d.linkTimed("slow", 50*time.Millisecond)
+	for i := 0; i < slowLinkSamples; i++ {
+		d.linkTimed("fast", time.Millisecond)
+	}
+	// One slow message in 20 is under the 95th percentile
+	for i := 0; i < slowLinkMinSamples; i++ {
+		duration := time.Millisecond
+		if i == 0 {
+			duration = time.Second
+		}
+		d.linkTimed("spiky", duration)
+	}
+	assert.Equal(t, map[string]time.Duration{"slow": 50 * time.Millisecond}, d.slowLinks(10*time.Millisecond))
+
+	for i := 0; i < slowLinkSamples; i++ {
+		d.linkTimed("slow", time.Millisecond)
+	}
+	assert.Empty(t, d.slowLinks(10*time.Millisecond), "old samples are dropped")
+
+	d.linkTimed("fast", time.Second)
+	d.forgetDurations("fast")
+	assert.NotContains(t, d.slowLinks(0), "fast")
+}
+
+func TestNotifySlowLinks(t *testing.T) {
+	api := &plugintest.API{}
+	data := mockLinksStore(api)
+	var notified []byte
+	api.On("KVGet", failuresKey).Return(func(string) []byte {
+		return notified
+	}, nil)
+	api.On("KVSetWithOptions", failuresKey, mock.Anything, mock.AnythingOfType("model.PluginKVSetOptions")).Return(
+		func(_ string, value []byte, options model.PluginKVSetOptions) bool {
+			notified = value
+			return true
+		}, nil)
+	api.On("GetUserByUsername", "autolink").Return(&model.User{Id: "botid", IsBot: true}, nil)
+	api.On("GetDirectChannel", "botid", "adminid").Return(&model.Channel{Id: "dmid"}, nil)
+	var messages []string
+	api.On("CreatePost", mock.AnythingOfType("*model.Post")).Return(func(post *model.Post) *model.Post {
+		messages = append(messages, post.Message)
+		return post
+	}, nil)
+	api.On("LogWarn", "Slow link", "link", "slow", "p95_ms", float64(50), "threshold_ms", 10, "disabled", true).Once()
+
+	p := New()
+	p.SetAPI(api)
+	p.UpdateConfig(func(conf *Config) {
+		conf.AdminUserIds = map[string]struct{}{"adminid": {}}
+		conf.SlowLinkThreshold = 10
+		conf.DisableSlowLinks = true
+	})
+	require.NoError(t, p.SaveLinks([]autolink.Autolink{
+		{Name: "slow", Pattern: "a", Template: "b"},
+		{Name: "fast", Pattern: "c", Template: "d"},
+	}))
+	for i := 0; i < slowLinkMinSamples; i++ {
+		p.diagnostics.linkTimed("slow", 50*time.Millisecond)
+		p.diagnostics.linkTimed("fast", time.Millisecond)
+	}
+
+	p.notifyFailures()
+	require.Len(t, messages, 1)
+	assert.Contains(t, messages[0], "Link `slow` took 50ms to process a message, at the 95th percentile, and was disabled")
+	assert.NotContains(t, messages[0], "fast")
+	links := savedLinks(t, *data)
+	require.Len(t, links, 2)
+	assert.True(t, links[0].Disabled)
+	assert.False(t, links[1].Disabled)
+
+	p.notifyFailures()
+	assert.Len(t, messages, 1, "the changed link is measured again")
+	api.AssertNumberOfCalls(t, "LogWarn", 1)
+}
+
+func TestIsAuthorizedTeamAdmin(t *testing.T) {
+	api := &plugintest.API{}
+	api.On("GetTeamByName", "team1").Return(&model.Team{Id: "team1id", Name: "team1"}, nil)
+	api.On("GetTeamByName", "team2").Return(&model.Team{Id: "team2id", Name: "team2"}, nil)
+	api.On("GetTeamByName", "missing").Return(nil, &model.AppError{StatusCode: http.StatusNotFound})
+	api.On("HasPermissionToTeam", "userid", "team1id", model.PermissionManageTeam).Return(true)
+	api.On("HasPermissionToTeam", "userid", "team2id", model.PermissionManageTeam).Return(false)
+
+	p := New()
+	p.SetAPI(api)
+
+	allowed, err := p.IsAuthorizedTeamAdmin("userid", []string{"team1"})
+	require.NoError(t, err)
+	assert.False(t, allowed, "delegation is disabled")
+
+	p.UpdateConfig(func(conf *Config) {
+		conf.EnableTeamAdminDelegation = true
+	})
+
+	for _, tc := range []struct {
+		teams    []string
+		expected bool
+	}{
+		{teams: []string{"team1"}, expected: true},
+		{teams: []string{"team1", "team2"}, expected: false},
+		{teams: []string{"missing"}, expected: false},
+		{teams: nil, expected: false},
+	} {
+		allowed, err = p.IsAuthorizedTeamAdmin("userid", tc.teams)
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, allowed, "teams: %v", tc.teams)
+	}
+}
+
+func TestOptOut(t *testing.T) {
+	conf := Config{
+		Links: []autolink.Autolink{{
+			Pattern:  "(Mattermost)",
+			Template: "[Mattermost](https://mattermost.com)",
+		}},
+	}
+
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", mock.AnythingOfType("string")).Return(&model.User{}, nil)
+
+	p := New()
+	p.SetAPI(api)
+	err := p.OnConfigurationChange()
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name            string
+		post            *model.Post
+		expectedMessage string
+		expectedProp    bool
+	}{
+		{
+			name:            "marker is removed",
+			post:            &model.Post{Message: "!nolink Welcome to Mattermost!"},
+			expectedMessage: "Welcome to Mattermost!",
+			expectedProp:    true,
+		},
+		{
+			name:            "marker on its own line",
+			post:            &model.Post{Message: "!nolink\nWelcome to Mattermost!"},
+			expectedMessage: "Welcome to Mattermost!",
+			expectedProp:    true,
+		},
+		{
+			name:            "marker must be a separate word",
+			post:            &model.Post{Message: "!nolinks to Mattermost"},
+			expectedMessage: "!nolinks to [Mattermost](https://mattermost.com)",
+		},
+		{
+			name:            "marker only at the start",
+			post:            &model.Post{Message: "Welcome to Mattermost! !nolink"},
+			expectedMessage: "Welcome to [Mattermost](https://mattermost.com)! !nolink",
+		},
+		{
+			name: "post prop",
+			post: &model.Post{
+				Message: "Welcome to Mattermost!",
+				Props:   model.StringInterface{optOutPostProp: true},
+			},
+			expectedMessage: "Welcome to Mattermost!",
+			expectedProp:    true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rpost, _ := p.MessageWillBePosted(&plugin.Context{}, tc.post)
+			assert.Equal(t, tc.expectedMessage, rpost.Message)
+			assert.Equal(t, tc.expectedProp, rpost.GetProp(optOutPostProp) == true)
+		})
+	}
+}
+
+func TestUserOptOut(t *testing.T) {
+	conf := Config{
+		Links: []autolink.Autolink{{
+			Pattern:  "(Mattermost)",
+			Template: "[Mattermost](https://mattermost.com)",
+		}},
+	}
+
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", mock.AnythingOfType("string")).Return(&model.User{}, nil)
+	api.On("KVGet", userOptOutKeyPrefix+"optedout").Return([]byte("true"), nil).Once()
+	api.On("KVGet", userOptOutKeyPrefix+"other").Return(nil, nil).Once()
+	api.On("KVDelete", userOptOutKeyPrefix+"optedout").Return(nil).Once()
+
+	p := New()
+	p.SetAPI(api)
+	err := p.OnConfigurationChange()
+	require.NoError(t, err)
+
+	rpost, _ := p.MessageWillBePosted(&plugin.Context{}, &model.Post{UserId: "optedout", Message: "Welcome to Mattermost!"})
+	assert.Equal(t, "Welcome to Mattermost!", rpost.Message)
+
+	// Cached
+	rpost, _ = p.MessageWillBePosted(&plugin.Context{}, &model.Post{UserId: "optedout", Message: "Welcome to Mattermost!"})
+	assert.Equal(t, "Welcome to Mattermost!", rpost.Message)
+
+	rpost, _ = p.MessageWillBePosted(&plugin.Context{}, &model.Post{UserId: "other", Message: "Welcome to Mattermost!"})
+	assert.Equal(t, "Welcome to [Mattermost](https://mattermost.com)!", rpost.Message)
+
+	require.NoError(t, p.SetUserOptedOut("optedout", false))
+	rpost, _ = p.MessageWillBePosted(&plugin.Context{}, &model.Post{UserId: "optedout", Message: "Welcome to Mattermost!"})
+	assert.Equal(t, "Welcome to [Mattermost](https://mattermost.com)!", rpost.Message)
+	// The links, and each user once
+	api.AssertNumberOfCalls(t, "KVGet", 3)
+}
+
+func TestChannelOptOut(t *testing.T) {
+	conf := Config{
+		Links: []autolink.Autolink{{
+			Pattern:  "(Mattermost)",
+			Template: "[Mattermost](https://mattermost.com)",
+		}},
+	}
+
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", mock.AnythingOfType("string")).Return(&model.User{}, nil)
+	api.On("KVGet", userOptOutKeyPrefix+"user1").Return(nil, nil)
+	api.On("KVGet", channelOptOutKeyPrefix+"disabled").Return([]byte("true"), nil)
+	api.On("KVGet", channelOptOutKeyPrefix+"enabled").Return(nil, nil)
+
+	p := New()
+	p.SetAPI(api)
+	err := p.OnConfigurationChange()
+	require.NoError(t, err)
+
+	rpost, _ := p.MessageWillBePosted(&plugin.Context{}, &model.Post{UserId: "user1", ChannelId: "disabled", Message: "Welcome to Mattermost!"})
+	assert.Equal(t, "Welcome to Mattermost!", rpost.Message)
+
+	rpost, _ = p.MessageWillBePosted(&plugin.Context{}, &model.Post{UserId: "user1", ChannelId: "enabled", Message: "Welcome to Mattermost!"})
+	assert.Equal(t, "Welcome to [Mattermost](https://mattermost.com)!", rpost.Message)
+}
+
+func TestCommandReaders(t *testing.T) {
+	conf := Config{
+		CommandReaderRoles: "system_user, system_guest_reader",
+		Links: []autolink.Autolink{{
+			Name:     "mm",
+			Pattern:  "(Mattermost)",
+			Template: "[Mattermost](https://mattermost.com)",
+			Scope:    []string{"otherteam"},
+		}},
+	}
+
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", "reader").Return(&model.User{Roles: "system_user"}, nil)
+	api.On("GetUser", "guest").Return(&model.User{Roles: "system_guest"}, nil)
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	run := func(userID, command string) string {
+		resp, appErr := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{
+			UserId:  userID,
+			TeamId:  "team1",
+			Command: command,
+		})
+		require.Nil(t, appErr)
+		return resp.Text
+	}
+
+	assert.Contains(t, run("reader", "/autolink list"), "mm")
+	assert.Contains(t, run("reader", "/autolink test mm Welcome to Mattermost"), "[Mattermost](https://mattermost.com)")
+	assert.Contains(t, run("reader", "/autolink search matter"), "mm")
+
+	notAuthorized := "`/autolink` commands can only be executed by a system administrator or `autolink` plugin admins."
+	assert.Equal(t, notAuthorized, run("reader", "/autolink delete mm"))
+	assert.Equal(t, notAuthorized, run("reader", "/autolink set mm Template x"))
+	assert.Equal(t, notAuthorized, run("guest", "/autolink list"))
+	assert.Len(t, p.GetLinks(), 1)
+	assert.Equal(t, "[Mattermost](https://mattermost.com)", p.GetLinks()[0].Template)
+}
+
+func TestPluginViewers(t *testing.T) {
+	conf := Config{
+		PluginViewers: "viewer, gone",
+		Links: []autolink.Autolink{{
+			Name:     "mm",
+			Pattern:  "(Mattermost)",
+			Template: "[Mattermost](https://mattermost.com)",
+			Scope:    []string{"otherteam"},
+		}},
+	}
+
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", "viewer").Return(&model.User{Id: "viewer", Roles: "system_user"}, nil)
+	api.On("GetUser", "gone").Return(&model.User{Id: "gone", Roles: "system_user", DeleteAt: 1}, nil)
+	api.On("LogWarn", "Plugin viewer is deactivated", "entry", "gone").Return(nil)
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+	assert.Equal(t, []string{"gone"}, p.Status().UnresolvedViewers)
+
+	run := func(userID, command string) string {
+		resp, appErr := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{
+			UserId:  userID,
+			TeamId:  "team1",
+			Command: command,
+		})
+		require.Nil(t, appErr)
+		return resp.Text
+	}
+
+	assert.Contains(t, run("viewer", "/autolink list"), "mm")
+	assert.Contains(t, run("viewer", "/autolink test mm Welcome to Mattermost"), "[Mattermost](https://mattermost.com)")
+
+	notAuthorized := "`/autolink` commands can only be executed by a system administrator or `autolink` plugin admins."
+	assert.Equal(t, notAuthorized, run("viewer", "/autolink delete mm"))
+	assert.Equal(t, notAuthorized, run("viewer", "/autolink set mm Template x"))
+	assert.Equal(t, notAuthorized, run("gone", "/autolink list"))
+	assert.Len(t, p.GetLinks(), 1)
+}
+
+func TestExportCommand(t *testing.T) {
+	conf := Config{
+		Links: []autolink.Autolink{{
+			Name:     "team1",
+			Pattern:  "team1",
+			Template: "t1",
+			Scope:    []string{"team1/town-square"},
+			Debug:    true,
+		}, {
+			Name:     "jira",
+			Pattern:  "jira",
+			Template: "j",
+			Scope:    []string{"team1"},
+			Group:    "jira",
+			PluginID: "jira-plugin",
+		}, {
+			Name:     "team2",
+			Pattern:  "team2",
+			Template: "t2",
+			Scope:    []string{"team2"},
+		}},
+	}
+
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", "adminid").Return(&model.User{Roles: "system_admin system_user"}, nil)
+	api.On("GetUserByUsername", "autolink").Return(&model.User{Id: "botid", IsBot: true}, nil)
+	api.On("GetDirectChannel", "botid", "adminid").Return(&model.Channel{Id: "dmid"}, nil)
+	api.On("LogInfo", mock.AnythingOfType("string")).Return()
+	api.On("LogInfo", "Links exported", "links", 1, "scope", "team1", "group", "", "tag", "", "user_id", "adminid").Return()
+	var exported []byte
+	api.On("UploadFile", mock.Anything, "dmid", "autolink-links.json").Return(func(data []byte, channelID, name string) *model.FileInfo {
+		exported = data
+		return &model.FileInfo{Id: "fileid"}
+	}, nil)
+	api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+		return post.UserId == "botid" && post.ChannelId == "dmid" && len(post.FileIds) == 1 && post.FileIds[0] == "fileid"
+	})).Return(&model.Post{}, nil)
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	run := func(command string) string {
+		resp, appErr := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{
+			UserId:  "adminid",
+			Command: command,
+		})
+		require.Nil(t, appErr)
+		return resp.Text
+	}
+
+	assert.Equal(t, "Sent 1 link(s) as a file in your direct messages with the `autolink` bot.", run("/autolink export --scope team1"))
+	var links []autolink.Autolink
+	require.NoError(t, json.Unmarshal(exported, &links))
+	assert.Equal(t, []autolink.Autolink{{
+		Name:     "team1",
+		Pattern:  "team1",
+		Template: "t1",
+		Scope:    []string{"team1/town-square"},
+	}}, links)
+	assert.NotContains(t, string(exported), "Debug")
+
+	assert.Equal(t, "No links found.", run("/autolink export --group jira"))
+	assert.Equal(t, "No links found.", run("/autolink export --scope team3"))
+	api.AssertNumberOfCalls(t, "UploadFile", 1)
+}
+
+func TestCommandTrigger(t *testing.T) {
+	conf := Config{
+		CommandTrigger: "/Links",
+		Links: []autolink.Autolink{{
+			Name:     "mm",
+			Pattern:  "(Mattermost)",
+			Template: "[Mattermost](https://mattermost.com)",
+		}},
+	}
+
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", "admin").Return(&model.User{Roles: "system_admin system_user"}, nil)
+	api.On("GetUser", mock.AnythingOfType("string")).Return(&model.User{}, nil)
+	api.On("LogInfo", mock.AnythingOfType("string"))
+	api.On("KVGet", mock.AnythingOfType("string")).Return(nil, nil)
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+	assert.Equal(t, "links", p.getConfig().commandTrigger())
+
+	resp, appErr := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{
+		UserId:  "user1",
+		Command: "/links preview Welcome to Mattermost!",
+	})
+	require.Nil(t, appErr)
+	assert.Contains(t, resp.Text, "Welcome to [Mattermost](https://mattermost.com)!")
+
+	resp, appErr = p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{
+		UserId:  "admin",
+		Command: "/links set mm Template   [MM](https://mattermost.com)",
+	})
+	require.Nil(t, appErr)
+	assert.Equal(t, "[MM](https://mattermost.com)", p.GetLinks()[0].Template)
+
+	resp, appErr = p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{
+		UserId:  "admin",
+		Command: "/autolink list",
+	})
+	require.Nil(t, appErr)
+	assert.Contains(t, resp.Text, "`/links list`", "the help names the configured trigger")
+	assert.NotContains(t, resp.Text, "`/autolink")
+
+	t.Run("register", func(t *testing.T) {
+		api.On("RegisterCommand", mock.MatchedBy(func(command *model.Command) bool {
+			return command.Trigger == "links" && command.AutocompleteData.Trigger == "links"
+		})).Return(nil)
+		p.registerCommand(true, "links", "autolink")
+		api.AssertCalled(t, "UnregisterCommand", "", "autolink")
+		api.AssertNumberOfCalls(t, "RegisterCommand", 1)
+	})
+
+	t.Run("invalid trigger", func(t *testing.T) {
+		for _, trigger := range []string{"", "/", "two words", "a/b"} {
+			assert.Equal(t, defaultCommandTrigger, (&Config{CommandTrigger: trigger}).commandTrigger(), trigger)
+		}
+	})
+}
+
+func TestPreviewCommand(t *testing.T) {
+	conf := Config{
+		Links: []autolink.Autolink{{
+			Name:     "mm",
+			Pattern:  "(Mattermost)",
+			Template: "[Mattermost](https://mattermost.com)",
+		}},
+	}
+
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", mock.AnythingOfType("string")).Return(&model.User{}, nil)
+	api.On("KVGet", mock.AnythingOfType("string")).Return(nil, nil)
+
+	p := New()
+	p.SetAPI(api)
+	err := p.OnConfigurationChange()
+	require.NoError(t, err)
+
+	resp, appErr := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{
+		UserId:    "user1",
+		ChannelId: "channel1",
+		Command:   "/autolink preview Welcome to  Mattermost!",
+	})
+	require.Nil(t, appErr)
+	assert.Contains(t, resp.Text, "Welcome to  [Mattermost](https://mattermost.com)!")
+	assert.Contains(t, resp.Text, "Matched links: mm")
+
+	resp, appErr = p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{
+		UserId:    "user1",
+		ChannelId: "channel1",
+		Command:   "/autolink preview Welcome!",
+	})
+	require.Nil(t, appErr)
+	assert.Equal(t, "No links match, the message would be posted as is.", resp.Text)
+}
+
+func TestRevertCommand(t *testing.T) {
+	conf := Config{
+		Links: []autolink.Autolink{{
+			Name:     "mm",
+			Pattern:  "(Mattermost)",
+			Template: "[Mattermost](https://mattermost.com)",
+		}},
+	}
+
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", mock.AnythingOfType("string")).Return(&model.User{}, nil)
+	api.On("KVGet", mock.AnythingOfType("string")).Return(nil, nil)
+
+	p := New()
+	p.SetAPI(api)
+	err := p.OnConfigurationChange()
+	require.NoError(t, err)
+
+	post, _ := p.MessageWillBePosted(nil, &model.Post{
+		Id:        "post1",
+		UserId:    "user1",
+		ChannelId: "channel1",
+		Message:   "Welcome to Mattermost!",
+	})
+	require.Equal(t, "Welcome to [Mattermost](https://mattermost.com)!", post.Message)
+	require.Equal(t, "Welcome to Mattermost!", post.GetProp(originalMessagePostProp))
+
+	api.On("GetPostsForChannel", "channel1", 0, revertSearchDepth).Return(&model.PostList{
+		Order: []string{"post2", "post1"},
+		Posts: map[string]*model.Post{
+			"post2": {Id: "post2", UserId: "user2", Message: "Hello"},
+			"post1": post,
+		},
+	}, nil)
+	var reverted *model.Post
+	api.On("UpdatePost", mock.AnythingOfType("*model.Post")).Return(func(post *model.Post) *model.Post {
+		reverted = post
+		return post
+	}, nil)
+
+	resp, appErr := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{
+		UserId:    "user1",
+		ChannelId: "channel1",
+		Command:   "/autolink revert",
+	})
+	require.Nil(t, appErr)
+	assert.Equal(t, "The post was restored as it was before being autolinked, and will not be autolinked when edited.", resp.Text)
+	require.NotNil(t, reverted)
+	assert.Equal(t, "Welcome to Mattermost!", reverted.Message)
+	assert.Nil(t, reverted.GetProp(originalMessagePostProp))
+	assert.Equal(t, true, reverted.GetProp(optOutPostProp))
+
+	resp, appErr = p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{
+		UserId:    "user2",
+		ChannelId: "channel1",
+		Command:   "/autolink revert",
+	})
+	require.Nil(t, appErr)
+	assert.Equal(t, "None of your recent posts in this channel was autolinked.", resp.Text)
+
+	postID := model.NewId()
+	api.On("GetPost", postID).Return(&model.Post{Id: postID, UserId: "user1", Message: "Hello"}, nil)
+	resp, appErr = p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{
+		UserId:    "user2",
+		ChannelId: "channel1",
+		Command:   "/autolink revert https://example.com/team/pl/" + postID,
+	})
+	require.Nil(t, appErr)
+	assert.Equal(t, "Only the author of a post can revert it.", resp.Text)
+
+	editedID := model.NewId()
+	edited := &model.Post{Id: editedID, UserId: "user1", Message: "Welcome to [Mattermost](https://mattermost.com)! Edited"}
+	edited.AddProp(originalMessagePostProp, "Welcome to Mattermost!")
+	edited.AddProp(rewrittenMessagePostProp, "Welcome to [Mattermost](https://mattermost.com)!")
+	api.On("GetPost", editedID).Return(edited, nil)
+	resp, appErr = p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{
+		UserId:    "user1",
+		ChannelId: "channel1",
+		Command:   "/autolink revert " + editedID,
+	})
+	require.Nil(t, appErr)
+	assert.Equal(t, "The post was edited since it was autolinked, and can not be reverted.", resp.Text)
+	api.AssertNumberOfCalls(t, "UpdatePost", 1)
+
+	// The edits are not autolinked, and drop the message kept for reverting
+	update := post.Clone()
+	update.Message = "Welcome to [Mattermost](https://mattermost.com)! Edited"
+	updated, _ := p.MessageWillBeUpdated(&plugin.Context{}, update, post)
+	assert.Nil(t, updated.GetProp(originalMessagePostProp))
+	assert.Nil(t, updated.GetProp(rewrittenMessagePostProp))
+
+	update = post.Clone()
+	update.IsPinned = true
+	updated, _ = p.MessageWillBeUpdated(&plugin.Context{}, update, post)
+	assert.Equal(t, "Welcome to Mattermost!", updated.GetProp(originalMessagePostProp))
+}
+
+func TestBenchmarkCommand(t *testing.T) {
+	conf := Config{
+		Links: []autolink.Autolink{{
+			Name:     "mm",
+			Pattern:  "(Mattermost)",
+			Template: "[Mattermost](https://mattermost.com)",
+		}, {
+			Name:     "jira",
+			Pattern:  `(?P<key>MM-\d+)`,
+			Template: "[$key](https://mattermost.atlassian.net/browse/$key)",
+		}},
+	}
+
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", "admin").Return(&model.User{Roles: "system_admin system_user"}, nil)
+	api.On("LogInfo", mock.AnythingOfType("string"))
+	api.On("GetPostsForChannel", "channel1", 0, maxTestLastPosts).Return(&model.PostList{
+		Order: []string{"post1"},
+		Posts: map[string]*model.Post{
+			"post1": {Message: "Welcome to Mattermost!"},
+		},
+	}, nil)
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	resp, appErr := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{
+		UserId:    "admin",
+		ChannelId: "channel1",
+		Command:   "/autolink benchmark",
+	})
+	require.Nil(t, appErr)
+	assert.Contains(t, resp.Text, fmt.Sprintf("Ran 2 link(s) against %d messages", len(benchmarkCorpus)+1))
+	assert.Contains(t, resp.Text, "| mm |")
+	assert.Contains(t, resp.Text, "| jira |")
+
+	resp, appErr = p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{
+		UserId:    "admin",
+		ChannelId: "channel1",
+		Command:   "/autolink benchmark jira",
+	})
+	require.Nil(t, appErr)
+	assert.Contains(t, resp.Text, "Ran 1 link(s)")
+	assert.NotContains(t, resp.Text, "| mm |")
+}
+
+func TestSimulateCommand(t *testing.T) {
+	conf := Config{
+		Links: []autolink.Autolink{{
+			Name:     "jira",
+			Pattern:  `(?P<key>MM-\d+)`,
+			Template: "[$key](https://mattermost.atlassian.net/browse/$key)",
+		}, {
+			Name:     "docs",
+			Disabled: true,
+			Pattern:  "docs",
+			Template: "[docs](https://docs.example.com)",
+		}},
+	}
+
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", "admin").Return(&model.User{Roles: "system_admin system_user"}, nil)
+	api.On("LogInfo", mock.AnythingOfType("string"))
+	api.On("GetPostsForChannel", "channel1", 0, maxTestLastPosts).Return(&model.PostList{
+		Order: []string{"post2", "post1"},
+		Posts: map[string]*model.Post{
+			"post1": {UserId: "admin", FileIds: []string{"export"}},
+			"post2": {UserId: "other", FileIds: []string{"other"}},
+		},
+	}, nil)
+	api.On("GetFileInfo", "export").Return(&model.FileInfo{Id: "export", Name: "export.csv", CreatorId: "admin"}, nil)
+	api.On("GetFileInfo", "other").Return(&model.FileInfo{Id: "other", Name: "other.csv", CreatorId: "other"}, nil)
+	api.On("GetFile", "export").Return([]byte("Message\nSee MM-1 and MM-2\nRead the docs\nNothing\n"), nil)
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	resp, appErr := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{
+		UserId:    "admin",
+		ChannelId: "channel1",
+		Command:   "/autolink simulate --include-disabled",
+	})
+	require.Nil(t, appErr)
+	assert.Contains(t, resp.Text, "`export.csv`: 3 post(s), 2 of which would have been rewritten")
+	assert.Contains(t, resp.Text, "| jira | 1 (33.3%) | 2 |")
+	assert.Contains(t, resp.Text, "| docs (disabled) | 1 (33.3%) | 1 |")
+
+	resp, appErr = p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{
+		UserId:    "admin",
+		ChannelId: "channel1",
+		Command:   "/autolink simulate other",
+	})
+	require.Nil(t, appErr)
+	assert.Contains(t, resp.Text, "Only the files you uploaded")
+	api.AssertNotCalled(t, "GetFile", "other")
+}
+
+func TestBenchmarkLinks(t *testing.T) {
+	links := []autolink.Autolink{
+		{Name: "fast", Pattern: "x", Template: "y"},
+		{Name: "slow", Pattern: `(?i)(?:a|b|c)+\w*z`, Template: "y"},
+	}
+	for i := range links {
+		require.NoError(t, links[i].Compile())
+	}
+
+	timings, rounds := benchmarkLinks(links, []string{"abc", strings.Repeat("abc ", 1000)}, 3, time.Hour)
+	assert.Equal(t, 3, rounds)
+	require.Len(t, timings, 2)
+	assert.Len(t, timings[0].samples, 6)
+	assert.True(t, timings[0].average >= timings[1].average, "slowest first")
+	assert.True(t, timings[0].percentile(50) <= timings[0].percentile(100))
+
+	_, rounds = benchmarkLinks(links, []string{"abc"}, 3, 0)
+	assert.Equal(t, 1, rounds, "at least one round is run")
+}
+
+func TestTestCommandLastPosts(t *testing.T) {
+	conf := Config{
+		Links: []autolink.Autolink{{
+			Name:     "mm",
+			Pattern:  "(Mattermost)",
+			Template: "[Mattermost](https://mattermost.com)",
+		}},
+	}
+
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", "admin").Return(&model.User{Roles: "system_admin system_user"}, nil)
+	api.On("LogInfo", mock.AnythingOfType("string"))
+	api.On("GetPostsForChannel", "channel1", 0, 3).Return(&model.PostList{
+		Order: []string{"post1", "post2", "post3"},
+		Posts: map[string]*model.Post{
+			"post1": {Message: "Welcome to Mattermost!"},
+			"post2": {Message: "Hello"},
+			"post3": {Message: "Mattermost\nrocks"},
+		},
+	}, nil)
+
+	p := New()
+	p.SetAPI(api)
+	err := p.OnConfigurationChange()
+	require.NoError(t, err)
+
+	resp, appErr := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{
+		UserId:    "admin",
+		ChannelId: "channel1",
+		Command:   "/autolink test mm --last 3",
+	})
+	require.Nil(t, appErr)
+	assert.Equal(t, "2 of the last 3 posts would be changed:\n"+
+		"- `Welcome to Mattermost!`\n  - changed to `Welcome to [Mattermost](https://mattermost.com)!` by mm\n"+
+		"- `Mattermost rocks`\n  - changed to `[Mattermost](https://mattermost.com) rocks` by mm\n", resp.Text)
+
+	resp, appErr = p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{
+		UserId:    "admin",
+		ChannelId: "channel1",
+		Command:   "/autolink test mm --last 1000",
+	})
+	require.Nil(t, appErr)
+	assert.Equal(t, `"1000" is not a valid number of posts, must be between 1 and 100`, resp.Text)
+}
+
+func TestTestAllCommand(t *testing.T) {
+	links := []autolink.Autolink{{
+		Name:     "jira",
+		Pattern:  `(?P<key>MM-\d+)`,
+		Template: "[$key](https://jira.example.com/$key)",
+	}, {
+		Name:     "disabled",
+		Pattern:  `MM`,
+		Template: "disabled",
+		Disabled: true,
+	}, {
+		Name:     "other team",
+		Pattern:  `MM`,
+		Template: "other team",
+		Scope:    []string{"other"},
+	}, {
+		Name:                 "domain",
+		Pattern:              `jira\.example\.com`,
+		Template:             "jira.team1.example.com",
+		DisableNonWordPrefix: true,
+		DisableNonWordSuffix: true,
+	}, {
+		Name:     "docs",
+		Pattern:  `docs`,
+		Template: "[docs](https://docs.example.com)",
+	}}
+
+	api := &plugintest.API{}
+	data := mockLinksStore(api)
+	var err error
+	*data, err = json.Marshal(links)
+	require.NoError(t, err)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = Config{SchemaVersion: currentSchemaVersion}
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", "admin").Return(&model.User{Roles: "system_admin system_user"}, nil)
+	api.On("GetChannel", "channel1").Return(&model.Channel{Name: "town-square", TeamId: "team1"}, nil)
+	api.On("GetTeam", "team1").Return(&model.Team{Name: "team1"}, nil)
+	api.On("LogInfo", mock.AnythingOfType("string"))
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	run := func(command string) string {
+		resp, appErr := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{
+			UserId:    "admin",
+			ChannelId: "channel1",
+			Command:   command,
+		})
+		require.Nil(t, appErr)
+		return resp.Text
+	}
+
+	assert.Equal(t, "- Original: `See MM-1`\n"+
+		"1. Link jira: changed to `See [MM-1](https://jira.example.com/MM-1)`\n"+
+		"2. Link domain: changed to `See [MM-1](https://jira.team1.example.com/MM-1)`\n"+
+		"\n2 of the 3 links applying to this channel matched.", run("/autolink test-all See MM-1"))
+	assert.Equal(t, "None of the 3 links applying to this channel matches the text.", run("/autolink test-all Hello"))
+}
+
+func TestManage(t *testing.T) {
+	conf := Config{
+		Links: []autolink.Autolink{{
+			Name:     "a",
+			Pattern:  "(Mattermost)",
+			Template: "[Mattermost](https://mattermost.com)",
+		}, {
+			Name:     "b",
+			Pattern:  "(Autolink)",
+			Template: "[Autolink](https://github.com/mattermost/mattermost-plugin-autolink)",
+		}},
+	}
+
+	api := &plugintest.API{}
+	data := mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", "admin").Return(&model.User{Roles: "system_admin system_user"}, nil)
+	api.On("LogInfo", mock.AnythingOfType("string"))
+	api.On("SendEphemeralPost", "admin", mock.AnythingOfType("*model.Post")).Return(nil)
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	resp, appErr := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{
+		UserId:  "admin",
+		Command: "/autolink manage",
+	})
+	require.Nil(t, appErr)
+	require.Len(t, resp.Attachments, 2)
+	assert.Contains(t, resp.Attachments[0].Text, "(Mattermost)")
+	buttons := resp.Attachments[0].Actions
+	require.Len(t, buttons, 3)
+	assert.Equal(t, []string{"Disable", "Edit", "Delete"}, []string{buttons[0].Name, buttons[1].Name, buttons[2].Name})
+	assert.Equal(t, "/plugins/mattermost-autolink/api/v1/actions/disable", buttons[0].Integration.URL)
+
+	action := func(name string, context map[string]interface{}) *model.PostActionIntegrationResponse {
+		return p.HandleAction("admin", name, &model.PostActionIntegrationRequest{UserId: "admin", Context: context})
+	}
+
+	// The context is decoded from JSON, with numbers as float64
+	update := action(manageActionDisable, map[string]interface{}{"index": float64(0), "name": "a", "page": float64(1)})
+	require.NotNil(t, update.Update)
+	assert.True(t, savedLinks(t, *data)[0].Disabled)
+	attachments := update.Update.Attachments()
+	require.Len(t, attachments, 2)
+	assert.Equal(t, "Enable", attachments[0].Actions[0].Name)
+
+	stale := action(manageActionDelete, map[string]interface{}{"index": float64(1), "name": "renamed", "page": float64(1)})
+	assert.Nil(t, stale.Update)
+	assert.Contains(t, stale.EphemeralText, "The links changed")
+	assert.Len(t, p.GetLinks(), 2)
+
+	update = action(manageActionDelete, map[string]interface{}{"index": float64(1), "name": "b", "page": float64(1)})
+	require.NotNil(t, update.Update)
+	assert.Contains(t, update.Update.Message, "Delete this link?")
+	assert.Len(t, savedLinks(t, *data), 2, "deleting is confirmed first")
+	confirm := update.Update.Attachments()[0].Actions[0]
+	assert.Equal(t, "/plugins/mattermost-autolink/api/v1/actions/confirm-delete", confirm.Integration.URL)
+
+	update = action(confirmActionDelete, confirm.Integration.Context)
+	require.NotNil(t, update.Update)
+	assert.Contains(t, update.Update.Message, "removed")
+	assert.Len(t, savedLinks(t, *data), 1)
+
+	assert.Nil(t, p.HandleDialog("admin", manageDialogEdit, &model.SubmitDialogRequest{
+		UserId: "admin",
+		State:  `{"index":0,"name":"a","page":1}`,
+		Submission: map[string]interface{}{
+			optName:     "mm",
+			optPattern:  "(Mattermost)",
+			optTemplate: "[Mattermost](https://mattermost.com/)",
+			optScope:    "team1 team2/town-square",
+		},
+	}))
+	links := savedLinks(t, *data)
+	require.Len(t, links, 1)
+	assert.Equal(t, "mm", links[0].Name)
+	assert.Equal(t, "[Mattermost](https://mattermost.com/)", links[0].Template)
+	assert.Equal(t, []string{"team1", "team2/town-square"}, links[0].Scope)
+	assert.True(t, links[0].Disabled)
+}
+
+func TestSetup(t *testing.T) {
+	conf := Config{
+		Links: []autolink.Autolink{{Name: "existing", Pattern: "a", Template: "b"}},
+	}
+
+	api := &plugintest.API{}
+	data := mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", "admin").Return(&model.User{Roles: "system_admin system_user"}, nil)
+	api.On("LogInfo", mock.AnythingOfType("string"))
+
+	var dialog model.OpenDialogRequest
+	api.On("OpenInteractiveDialog", mock.AnythingOfType("model.OpenDialogRequest")).Return(nil).Run(func(args mock.Arguments) {
+		dialog = args.Get(0).(model.OpenDialogRequest)
+	})
+	var posted *model.Post
+	api.On("SendEphemeralPost", "admin", mock.AnythingOfType("*model.Post")).Return(nil).Run(func(args mock.Arguments) {
+		posted = args.Get(1).(*model.Post)
+	})
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	resp, appErr := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{
+		UserId:    "admin",
+		TriggerId: "trigger",
+		Command:   "/autolink setup",
+	})
+	require.Nil(t, appErr)
+	assert.Empty(t, resp.Text)
+	assert.Equal(t, "trigger", dialog.TriggerId)
+	assert.Equal(t, "/plugins/mattermost-autolink/api/v1/dialogs/setup-kind", dialog.URL)
+
+	submit := func(submission map[string]interface{}) *model.SubmitDialogResponse {
+		name := dialog.URL[strings.LastIndex(dialog.URL, "/")+1:]
+		return p.HandleDialog("admin", name, &model.SubmitDialogRequest{
+			UserId:     "admin",
+			State:      dialog.Dialog.State,
+			Submission: submission,
+		})
+	}
+	// Continue opens the dialog of the next step
+	next := func() {
+		require.NotNil(t, posted)
+		context := posted.Attachments()[0].Actions[0].Integration.Context
+		posted = nil
+		resp := p.HandleAction("admin", setupActionOpen, &model.PostActionIntegrationRequest{UserId: "admin", TriggerId: "next", Context: context})
+		assert.Empty(t, resp.EphemeralText)
+	}
+
+	result := submit(map[string]interface{}{"Name": "existing", "kind": "custom"})
+	require.NotNil(t, result)
+	assert.Contains(t, result.Errors["Name"], "already exists")
+	assert.Nil(t, submit(map[string]interface{}{"Name": "mm", "kind": "custom"}))
+	next()
+	assert.Equal(t, "/plugins/mattermost-autolink/api/v1/dialogs/setup-pattern", dialog.URL)
+
+	result = submit(map[string]interface{}{"Pattern": "(", "Template": "x"})
+	require.NotNil(t, result)
+	assert.Contains(t, result.Errors, "Pattern")
+	result = submit(map[string]interface{}{"Pattern": "(Mattermost)", "Template": "[Mattermost](https://mattermost.com)", "sample": "Welcome"})
+	require.NotNil(t, result)
+	assert.Contains(t, result.Errors, "sample")
+	assert.Nil(t, submit(map[string]interface{}{"Pattern": "(Mattermost)", "Template": "[Mattermost](https://mattermost.com)", "sample": "Welcome to Mattermost"}))
+	assert.Contains(t, posted.Message, "Welcome to [Mattermost](https://mattermost.com)")
+	next()
+	assert.Equal(t, "/plugins/mattermost-autolink/api/v1/dialogs/setup-scope", dialog.URL)
+	assert.Len(t, savedLinks(t, *data), 1, "nothing is saved before the last step")
+
+	assert.Nil(t, submit(map[string]interface{}{"Scope": ""}))
+	assert.Contains(t, posted.Message, "Created the link")
+	links := savedLinks(t, *data)
+	require.Len(t, links, 2)
+	assert.Equal(t, "mm", links[1].Name)
+	assert.Equal(t, "(Mattermost)", links[1].Pattern)
+	assert.Equal(t, "[Mattermost](https://mattermost.com)", links[1].Template)
+}
+
+func TestSplitIDURL(t *testing.T) {
+	for _, tc := range []struct {
+		url, prefix, keyword, key string
+	}{
+		{"https://jira.example.com/browse/MM-123", "https://jira.example.com/browse/", "", "MM"},
+		{"https://github.com/mattermost/mattermost-server/issues/42.", "https://github.com/mattermost/mattermost-server/issues/", "mattermost-server", ""},
+		{"https://status.example.com/incident/42", "https://status.example.com/incident/", "incident", ""},
+		{"https://example.com/issues/42", "", "", ""},
+		{"https://example.com/docs/intro", "", "", ""},
+		{"https://example.com/incident/42?tab=log", "", "", ""},
+		{"https://example.com/42", "", "", ""},
+	} {
+		t.Run(tc.url, func(t *testing.T) {
+			prefix, keyword, key, ok := splitIDURL(tc.url)
+			assert.Equal(t, tc.prefix != "", ok)
+			assert.Equal(t, tc.prefix, prefix)
+			assert.Equal(t, tc.keyword, keyword)
+			assert.Equal(t, tc.key, key)
+		})
+	}
+}
+
+func TestSuggestLinks(t *testing.T) {
+	conf := Config{
+		EnableSuggestions: true,
+		PluginAdmins:      "adminid",
+		Links: []autolink.Autolink{{
+			Name:     "incident",
+			Pattern:  `(?P<id>\d+)`,
+			Template: "[${id}](https://status.example.com/incident/${id})",
+		}},
+	}
+
+	api := &plugintest.API{}
+	data := mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", "adminid").Return(&model.User{Roles: "system_admin system_user"}, nil)
+	api.On("LogInfo", mock.AnythingOfType("string"))
+	var suggested []byte
+	api.On("KVGet", suggestionsKey).Return(func(string) []byte {
+		return suggested
+	}, nil)
+	api.On("KVSetWithOptions", suggestionsKey, mock.Anything, mock.AnythingOfType("model.PluginKVSetOptions")).Return(
+		func(_ string, value []byte, options model.PluginKVSetOptions) bool {
+			if !bytes.Equal(options.OldValue, suggested) {
+				return false
+			}
+			suggested = value
+			return true
+		}, nil)
+	api.On("GetUserByUsername", "autolink").Return(&model.User{Id: "botid", IsBot: true}, nil)
+	api.On("GetDirectChannel", "botid", "adminid").Return(&model.Channel{Id: "dmid"}, nil)
+	var messages []string
+	api.On("CreatePost", mock.AnythingOfType("*model.Post")).Return(func(post *model.Post) *model.Post {
+		messages = append(messages, post.Message)
+		return post
+	}, nil)
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	post := func() {
+		for i := 0; i < suggestionMinPosts; i++ {
+			channel := fmt.Sprintf("channel%d", i%suggestionMinChannels)
+			p.suggestions.record(&model.Post{ChannelId: channel, Message: fmt.Sprintf(
+				"See https://jira.example.com/browse/MM-%d and https://jira.example.com/browse/OPS-%d", i, i)})
+			p.suggestions.record(&model.Post{ChannelId: channel, Message: fmt.Sprintf("Down: https://status.example.com/incident/%d", i)})
+			p.suggestions.record(&model.Post{ChannelId: "channel0", Message: fmt.Sprintf("https://gitlab.example.com/app/-/issues/%d", i)})
+		}
+	}
+	post()
+	p.suggestLinks()
+	require.Len(t, messages, 1)
+	id := suggestionID("https://jira.example.com/browse/")
+	assert.Contains(t, messages[0], "`jira`: pattern `(?P<key>(?:MM|OPS)-\\d+)`, template `[${key}](https://jira.example.com/browse/${key})`, posted 10 times in 3 channels")
+	assert.Contains(t, messages[0], "/autolink accept-suggestion "+id)
+	assert.NotContains(t, messages[0], "status.example.com", "already linked")
+	assert.NotContains(t, messages[0], "gitlab.example.com", "posted in a single channel")
+
+	post()
+	p.suggestLinks()
+	assert.Len(t, messages, 1, "links are only suggested once")
+
+	resp, appErr := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{
+		UserId:  "adminid",
+		Command: "/autolink accept-suggestion " + id,
+	})
+	require.Nil(t, appErr)
+	assert.Contains(t, resp.Text, "Added the suggested link")
+	links := savedLinks(t, *data)
+	require.Len(t, links, 2)
+	assert.Equal(t, "jira", links[1].Name)
+	require.NoError(t, links[1].Compile())
+	assert.Equal(t, "See [MM-1](https://jira.example.com/browse/MM-1).", links[1].Replace("See MM-1."))
+
+	resp, appErr = p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{
+		UserId:  "adminid",
+		Command: "/autolink accept-suggestion unknown",
+	})
+	require.Nil(t, appErr)
+	assert.Equal(t, `No suggested link "unknown".`, resp.Text)
+}
+
+func TestPauseCommand(t *testing.T) {
+	conf := Config{
+		Links: []autolink.Autolink{{
+			Name:     "jira",
+			Pattern:  `(?P<key>MM-\d+)`,
+			Template: "[$key](https://jira.example.com/$key)",
+		}},
+	}
+
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", "admin").Return(&model.User{Roles: "system_admin system_user"}, nil)
+	api.On("GetUser", mock.AnythingOfType("string")).Return(&model.User{}, nil)
+	api.On("LogInfo", mock.AnythingOfType("string"), mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	api.On("LogInfo", mock.AnythingOfType("string"), mock.Anything, mock.Anything)
+	var paused []byte
+	api.On("KVSetWithOptions", pauseKey, mock.Anything, mock.AnythingOfType("model.PluginKVSetOptions")).Return(
+		func(_ string, value []byte, options model.PluginKVSetOptions) bool {
+			paused = value
+			return true
+		}, nil)
+	api.On("KVDelete", pauseKey).Return(func(string) *model.AppError {
+		paused = nil
+		return nil
+	})
+	api.On("KVGet", pauseKey).Return(func(string) []byte {
+		return paused
+	}, nil)
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	command := func(command string) string {
+		resp, appErr := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{UserId: "admin", Command: command})
+		require.Nil(t, appErr)
+		return resp.Text
+	}
+	post := func() string {
+		rpost, _ := p.MessageWillBePosted(&plugin.Context{}, &model.Post{Message: "MM-1"})
+		return rpost.Message
+	}
+
+	assert.Contains(t, command("/autolink pause 1y"), `"1y" is not a valid duration`)
+	assert.Contains(t, command("/autolink pause 200h"), `"200h" is not a valid duration`)
+	assert.Equal(t, "[MM-1](https://jira.example.com/MM-1)", post())
+
+	assert.Contains(t, command("/autolink pause 2h"), "Autolinking is paused for all posts until")
+	assert.Equal(t, "MM-1", post())
+	until := p.Status().PausedUntil
+	require.NotNil(t, until)
+	assert.WithinDuration(t, time.Now().Add(2*time.Hour), *until, time.Minute)
+	assert.Equal(t, until.UTC().Format(time.RFC3339), string(paused))
+
+	assert.Equal(t, "Autolinking is resumed.", command("/autolink resume"))
+	assert.Equal(t, "[MM-1](https://jira.example.com/MM-1)", post())
+	assert.Nil(t, p.Status().PausedUntil)
+
+	// A pause made on another server applies once read
+	paused = []byte(time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	p.refreshPause()
+	assert.Equal(t, "MM-1", post())
+
+	// and an expired one is ignored
+	paused = []byte(time.Now().Add(-time.Minute).UTC().Format(time.RFC3339))
+	p.refreshPause()
+	assert.Equal(t, "[MM-1](https://jira.example.com/MM-1)", post())
+}
+
+func TestProfileCommand(t *testing.T) {
+	conf := Config{
+		Links: []autolink.Autolink{
+			{Name: "jira", Pattern: "a", Template: "b"},
+			{Name: "github", Pattern: "c", Template: "d"},
+			{Name: "legacy", Pattern: "e", Template: "f", Disabled: true},
+		},
+	}
+
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", "admin").Return(&model.User{Roles: "system_admin system_user"}, nil)
+	api.On("LogInfo", mock.AnythingOfType("string"), mock.Anything, mock.Anything)
+	api.On("LogInfo", mock.AnythingOfType("string"), mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	var profiles []byte
+	api.On("KVSet", profilesKey, mock.Anything).Return(func(_ string, value []byte) *model.AppError {
+		profiles = value
+		return nil
+	})
+	api.On("KVGet", profilesKey).Return(func(string) []byte {
+		return profiles
+	}, nil)
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	command := func(command string) string {
+		resp, appErr := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{UserId: "admin", Command: command})
+		require.Nil(t, appErr)
+		return resp.Text
+	}
+	enabled := func() []string {
+		return enabledLinkNames(p.GetLinks())
+	}
+
+	assert.Equal(t, `Saved the profile "normal", enabling 2 link(s). Run `+"`/autolink profile apply`"+` with its name to switch back to it.`,
+		command("/autolink profile save normal"))
+	assert.Equal(t, "Disabled 2 link(s).", command("/autolink disable --all"))
+	assert.Empty(t, enabled())
+
+	assert.Equal(t, `Applied the profile "normal", 2 of the 3 link(s) are enabled.`, command("/autolink profile apply normal"))
+	assert.Equal(t, []string{"github", "jira"}, enabled())
+
+	assert.Equal(t, "Enabled 1 link(s).", command("/autolink enable --all"))
+	command("/autolink profile save incident")
+	assert.Equal(t, `Applied the profile "off", 0 of the 3 link(s) are enabled.`, command("/autolink profile apply off"))
+	assert.Empty(t, enabled())
+
+	assert.Equal(t, "Profiles:\n- `off`: all the links disabled\n- `incident`: github, jira, legacy\n- `normal`: github, jira\n",
+		command("/autolink profile list"))
+	assert.Contains(t, command("/autolink profile save off"), "built-in profile")
+	assert.Equal(t, `Deleted the profile "incident".`, command("/autolink profile delete incident"))
+	assert.Contains(t, command("/autolink profile apply incident"), `No profile "incident"`)
+}
+
+func TestTeamLinks(t *testing.T) {
+	// The links are saved by the commands, the links of the configuration
+	// with the same name being merged when imported
+	links := []autolink.Autolink{{
+		Name:     "jira",
+		Pattern:  `(?P<key>MM-\d+)`,
+		Template: "[$key](https://jira.example.com/$key)",
+	}, {
+		Name:      "docs",
+		Pattern:   `docs`,
+		Template:  "[docs](https://docs.example.com)",
+		WordMatch: true,
+	}, {
+		Name:     "JIRA",
+		Pattern:  `(?P<key>MM-\d+)`,
+		Template: "[$key](https://jira.team-a.example.com/$key)",
+		Scope:    []string{"team-a"},
+	}, {
+		Name:     "docs",
+		Pattern:  `docs`,
+		Template: "disabled",
+		Scope:    []string{"team-a"},
+		Disabled: true,
+	}, {
+		Name:     "jira",
+		Pattern:  `(?P<key>MM-\d+)`,
+		Template: "[$key](https://jira.support.example.com/$key)",
+		Scope:    []string{"team-b/support"},
+	}, {
+		Name:     "wiki",
+		Pattern:  `wiki`,
+		Template: "[wiki](https://wiki.team-a.example.com)",
+		Scope:    []string{"team-a"},
+	}}
+	conf := Config{SchemaVersion: currentSchemaVersion}
+
+	api := &plugintest.API{}
+	data := mockLinksStore(api)
+	var err error
+	*data, err = json.Marshal(links)
+	require.NoError(t, err)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetChannel", "a").Return(&model.Channel{Name: "town-square", TeamId: "team-a"}, nil)
+	api.On("GetChannel", "b").Return(&model.Channel{Name: "town-square", TeamId: "team-b"}, nil)
+	api.On("GetChannel", "support").Return(&model.Channel{Name: "support", TeamId: "team-b"}, nil)
+	api.On("GetTeam", "team-a").Return(&model.Team{Name: "team-a"}, nil)
+	api.On("GetTeam", "team-b").Return(&model.Team{Name: "team-b"}, nil)
+	api.On("GetUser", mock.AnythingOfType("string")).Return(&model.User{}, nil)
+	api.On("KVGet", mock.AnythingOfType("string")).Return(nil, nil)
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	for _, tc := range []struct {
+		channelID string
+		expected  string
+	}{
+		{"a", "[MM-1](https://jira.team-a.example.com/MM-1) [docs](https://docs.example.com) [wiki](https://wiki.team-a.example.com)"},
+		{"b", "[MM-1](https://jira.example.com/MM-1) [docs](https://docs.example.com) wiki"},
+		{"support", "[MM-1](https://jira.support.example.com/MM-1) [docs](https://docs.example.com) wiki"},
+	} {
+		t.Run(tc.channelID, func(t *testing.T) {
+			rpost, _ := p.MessageWillBePosted(&plugin.Context{}, &model.Post{ChannelId: tc.channelID, Message: "MM-1 docs wiki"})
+			assert.Equal(t, tc.expected, rpost.Message)
+		})
+	}
+
+	t.Run("test", func(t *testing.T) {
+		result := p.TestText("user", "a", "MM-1 MM-2 wiki")
+		assert.Equal(t, "[MM-1](https://jira.team-a.example.com/MM-1) [MM-2](https://jira.team-a.example.com/MM-2) [wiki](https://wiki.team-a.example.com)", result.Text)
+		require.Len(t, result.Links, 2)
+		assert.Equal(t, "JIRA", result.Links[0].Name)
+		assert.Equal(t, []string{"MM-1", "MM-2"}, result.Links[0].Matches)
+		assert.Equal(t, "wiki", result.Links[1].Name)
+
+		result = p.TestText("user", "b", "wiki")
+		assert.Equal(t, "wiki", result.Text)
+		assert.Empty(t, result.Links)
+	})
+
+	t.Run("test is not throttled", func(t *testing.T) {
+		p.UpdateConfig(func(conf *Config) {
+			conf.MaxRewritesPerChannel = 1
+		})
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, "[wiki](https://wiki.team-a.example.com)", p.TestText("user", "a", "wiki").Text)
+		}
+		rpost, _ := p.MessageWillBePosted(&plugin.Context{}, &model.Post{ChannelId: "a", Message: "wiki"})
+		assert.Equal(t, "[wiki](https://wiki.team-a.example.com)", rpost.Message, "the tests did not use up the limit of the channel")
+	})
+}
+
+func TestSyncCommand(t *testing.T) {
+	remote := []autolink.Autolink{
+		{Name: "jira", Pattern: `MM-\d+`, Template: "jira"},
+		{Name: "docs", Pattern: `docs`, Template: "docs"},
+	}
+	var pushed []autolink.Autolink
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/plugins/mattermost-autolink/api/v1/links", r.URL.Path)
+		require.Equal(t, "Bearer token1", r.Header.Get("Authorization"))
+		if r.Method == http.MethodPut {
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&pushed))
+			_, _ = w.Write([]byte(`{"added": [], "updated": ["jira"], "removed": ["docs"]}`))
+			return
 		}
+		_ = json.NewEncoder(w).Encode(remote)
+	}))
+	defer server.Close()
+
+	links := []autolink.Autolink{
+		{Name: "jira", Pattern: `MM-\d+`, Template: "local"},
+		{Name: "owned", Pattern: `owned`, Template: "owned", PluginID: "com.example.plugin"},
+		{Name: "local", Pattern: `local`, Template: "local"},
+	}
+	conf := Config{
+		SchemaVersion:    currentSchemaVersion,
+		SyncSiteURL:      server.URL,
+		SyncToken:        "token1",
+		SyncPullInterval: 60,
+	}
+
+	api := &plugintest.API{}
+	data := mockLinksStore(api)
+	var err error
+	*data, err = json.Marshal(links)
+	require.NoError(t, err)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", "admin").Return(&model.User{Roles: "system_admin system_user"}, nil)
+	api.On("LogInfo", mock.AnythingOfType("string"), mock.Anything, mock.Anything, mock.Anything, mock.Anything,
+		mock.Anything, mock.Anything, mock.Anything, mock.Anything)
 
-		testChannel := model.Channel{
-			Name: "TestChannel",
-		}
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
 
-		api := &plugintest.API{}
+	command := func(command string) string {
+		resp, appErr := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{UserId: "admin", Command: command})
+		require.Nil(t, appErr)
+		return resp.Text
+	}
 
-		api.On("LoadPluginConfiguration",
-			mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
-			*dest.(*Config) = conf
-			return nil
-		})
-		api.On("UnregisterCommand", mock.AnythingOfType("string"),
-			mock.AnythingOfType("string")).Return((*model.AppError)(nil))
-		api.On("GetChannel", mock.AnythingOfType("string")).Return(&testChannel, nil)
-		api.On("LogError",
-			mock.AnythingOfType("string"),
-			mock.AnythingOfType("string"),
-			mock.AnythingOfType("string")).Return(nil)
+	assert.Contains(t, command("/autolink sync pull --dry-run"), "would make these changes, nothing was changed:\n- Added docs\n- Updated jira\n- Removed local\n")
+	assert.Equal(t, links, savedLinks(t, *data))
+
+	assert.Contains(t, command("/autolink sync push"), "Pushed the links to "+server.URL+":\n- Updated jira\n- Removed docs\n")
+	assert.Equal(t, []autolink.Autolink{links[0], links[2]}, pushed)
+
+	assert.Contains(t, command("/autolink sync pull"), "Pulled the links from "+server.URL)
+	assert.Equal(t, []autolink.Autolink{remote[0], remote[1], links[1]}, savedLinks(t, *data))
+	assert.Equal(t, "The links are already in sync with "+server.URL+".", command("/autolink sync pull"))
+
+	// The links are pulled on schedule once the interval elapsed
+	remote = append(remote, autolink.Autolink{Name: "wiki", Pattern: `wiki`, Template: "wiki"})
+	now := time.Now()
+	p.pullScheduled(now)
+	require.Len(t, savedLinks(t, *data), 4)
+	remote = remote[:2]
+	p.pullScheduled(now.Add(59 * time.Minute))
+	require.Len(t, savedLinks(t, *data), 4)
+	p.pullScheduled(now.Add(time.Hour))
+	require.Len(t, savedLinks(t, *data), 3)
+}
 
-		testUser := model.User{
-			IsBot: false,
+func TestClusterEvents(t *testing.T) {
+	conf := Config{SchemaVersion: currentSchemaVersion}
+
+	// The two servers of the cluster share the KV store
+	api := &plugintest.API{}
+	var events []model.PluginClusterEvent
+	api.On("PublishPluginClusterEvent", mock.AnythingOfType("model.PluginClusterEvent"),
+		mock.AnythingOfType("model.PluginClusterEventSendOptions")).Return(nil).Run(func(args mock.Arguments) {
+		events = append(events, args.Get(0).(model.PluginClusterEvent))
+	})
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("KVSetWithOptions", pauseKey, mock.Anything, mock.AnythingOfType("model.PluginKVSetOptions")).Return(true, nil)
+	api.On("KVSet", mock.AnythingOfType("string"), mock.Anything).Return(nil)
+	api.On("KVGet", mock.AnythingOfType("string")).Return(nil, nil)
+	api.On("GetUser", mock.AnythingOfType("string")).Return(&model.User{}, nil)
+
+	p1, p2 := New(), New()
+	p1.SetAPI(api)
+	p2.SetAPI(api)
+	require.NoError(t, p1.OnConfigurationChange())
+	require.NoError(t, p2.OnConfigurationChange())
+	forward := func() {
+		for _, ev := range events {
+			p2.OnPluginClusterEvent(&plugin.Context{}, ev)
 		}
-		api.On("GetUser", mock.AnythingOfType("string")).Return(&testUser, nil)
+		events = nil
+	}
 
-		p := New()
-		p.SetAPI(api)
-		_ = p.OnConfigurationChange()
+	t.Run("links", func(t *testing.T) {
+		require.NoError(t, p1.SaveLinks([]autolink.Autolink{{Name: "jira", Pattern: `MM-\d+`, Template: "jira"}}))
+		assert.Empty(t, p2.GetLinks())
+		forward()
+		require.Len(t, p2.GetLinks(), 1)
+		assert.Equal(t, "jira", p2.GetLinks()[0].Name)
+		rpost, _ := p2.MessageWillBePosted(&plugin.Context{}, &model.Post{Message: "MM-1"})
+		assert.Equal(t, "jira", rpost.Message)
+
+		// The other server saves its links on top of them
+		require.NoError(t, p2.SaveLinks(append(p2.GetLinks(), autolink.Autolink{Name: "docs", Pattern: "docs", Template: "docs"})))
+	})
 
-		post := &model.Post{Message: "Welcome to Mattermost!"}
-		rpost, _ := p.ProcessPost(&plugin.Context{}, post)
+	t.Run("pause", func(t *testing.T) {
+		until := time.Now().Add(time.Hour).Truncate(time.Second)
+		require.NoError(t, p1.Pause(until))
+		assert.False(t, p2.isPaused())
+		forward()
+		assert.True(t, p2.PausedUntil().Equal(until))
+	})
 
-		assert.Equal(t, "Welcome to Mattermost!", rpost.Message)
+	t.Run("opt-out", func(t *testing.T) {
+		optedOut, err := p2.IsUserOptedOut("user")
+		require.NoError(t, err)
+		require.False(t, optedOut)
+		require.NoError(t, p1.SetUserOptedOut("user", true))
+		forward()
+		_, _, found := p2.optOutCache.Get(userOptOutKeyPrefix + "user")
+		assert.False(t, found)
 	})
 
-	t.Run("valid scope replaces text", func(t *testing.T) {
-		conf := Config{
-			Links: []autolink.Autolink{
-				{
-					Pattern:  "(Mattermost)",
-					Template: "[Mattermost](https://mattermost.com)",
-					Scope:    []string{"TestTeam/TestChannel"},
-				},
-			},
+	t.Run("stats", func(t *testing.T) {
+		p1.diagnostics.linkFired(autolink.Autolink{Name: "jira"})
+		for i := 0; i < slowLinkMinSamples; i++ {
+			p1.diagnostics.linkTimed("jira", 50*time.Millisecond)
 		}
+		p1.shareStats()
+		require.Len(t, events, 1)
+		p1.shareStats()
+		require.Len(t, events, 1, "the stats are only sent once")
+		forward()
+
+		status := p2.Status()
+		require.NotEmpty(t, status.Links)
+		assert.NotNil(t, status.Links[0].LastFiredAt)
+		assert.Equal(t, map[string]time.Duration{"jira": 50 * time.Millisecond}, p2.diagnostics.slowLinks(10*time.Millisecond))
+	})
+}
 
-		testChannel := model.Channel{
-			Name:   "TestChannel",
-			TeamId: "TestId",
+func TestMatchMiddleware(t *testing.T) {
+	api := &plugintest.API{}
+	data := mockLinksStore(api)
+	var err error
+	*data, err = json.Marshal([]autolink.Autolink{{
+		Name:     "jira",
+		Pattern:  `(?P<key>MM-\d+)`,
+		Template: "[${key}](https://mattermost.atlassian.net/browse/${key})",
+	}})
+	require.NoError(t, err)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = Config{SchemaVersion: currentSchemaVersion}
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	var middlewares []byte
+	api.On("KVGet", middlewaresKey).Return(func(string) []byte {
+		return middlewares
+	}, nil)
+	api.On("KVSetWithOptions", middlewaresKey, mock.Anything, mock.AnythingOfType("model.PluginKVSetOptions")).Return(
+		func(_ string, value []byte, _ model.PluginKVSetOptions) bool {
+			middlewares = value
+			return true
+		}, nil)
+	api.On("KVGet", mock.AnythingOfType("string")).Return(nil, nil)
+	api.On("GetUser", mock.AnythingOfType("string")).Return(&model.User{}, nil)
+	api.On("LogWarn", mock.AnythingOfType("string"), mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	// The security plugin vetoes MM-1, the other one rewrites MM-2 and fails
+	// on MM-3
+	var requests []autolinkclient.MatchRequest
+	api.On("PluginHTTP", mock.AnythingOfType("*http.Request")).Return(func(r *http.Request) *http.Response {
+		var request autolinkclient.MatchRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		requests = append(requests, request)
+
+		response := autolinkclient.MatchResponse{Action: autolinkclient.MatchAllow}
+		status := http.StatusOK
+		switch {
+		case r.URL.Path == "/security/match" && request.Match == "MM-1":
+			response.Action = autolinkclient.MatchVeto
+		case r.URL.Path == "/tracker/match" && request.Match == "MM-2":
+			response = autolinkclient.MatchResponse{Action: autolinkclient.MatchReplace, Replacement: "[MM-2 (done)](https://mattermost.atlassian.net/browse/MM-2)"}
+		case r.URL.Path == "/tracker/match" && request.Match == "MM-3":
+			status = http.StatusInternalServerError
 		}
+		body, _ := json.Marshal(response)
+		return &http.Response{StatusCode: status, Body: ioutil.NopCloser(bytes.NewReader(body))}
+	})
 
-		testTeam := model.Team{
-			Name: "TestTeam",
-		}
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	// Without middlewares, the plugins are not called
+	rpost, _ := p.MessageWillBePosted(&plugin.Context{}, &model.Post{Message: "MM-1"})
+	assert.Equal(t, "[MM-1](https://mattermost.atlassian.net/browse/MM-1)", rpost.Message)
+	assert.Empty(t, requests)
+
+	require.NoError(t, p.RegisterMatchMiddleware("tracker", "/match"))
+	require.NoError(t, p.RegisterMatchMiddleware("security", "/match"))
+
+	rpost, _ = p.MessageWillBePosted(&plugin.Context{}, &model.Post{Id: "post", ChannelId: "channel", Message: "MM-1 MM-2 MM-3"})
+	assert.Equal(t, "MM-1 [MM-2 (done)](https://mattermost.atlassian.net/browse/MM-2) [MM-3](https://mattermost.atlassian.net/browse/MM-3)", rpost.Message)
+
+	// The middlewares are called in the order of their plugins, until one
+	// vetoes the match
+	require.Len(t, requests, 5)
+	assert.Equal(t, "MM-1", requests[0].Match)
+	assert.Equal(t, "jira", requests[0].Link.Name)
+	assert.Equal(t, "[MM-1](https://mattermost.atlassian.net/browse/MM-1)", requests[0].Replacement)
+	assert.Equal(t, "post", requests[0].PostID)
+	assert.Equal(t, "channel", requests[0].ChannelID)
+	assert.Equal(t, "MM-2", requests[1].Match)
+	assert.Equal(t, "MM-2", requests[2].Match)
+
+	require.NoError(t, p.UnregisterMatchMiddleware("security"))
+	require.NoError(t, p.UnregisterMatchMiddleware("tracker"))
+	requests = nil
+	rpost, _ = p.MessageWillBePosted(&plugin.Context{}, &model.Post{Message: "MM-1"})
+	assert.Equal(t, "[MM-1](https://mattermost.atlassian.net/browse/MM-1)", rpost.Message)
+	assert.Empty(t, requests)
+}
 
-		api := &plugintest.API{}
+func TestDebugLink(t *testing.T) {
+	links := []autolink.Autolink{{
+		Name:     "jira",
+		Pattern:  `(?P<key>MM-\d+)`,
+		Template: "[$key](https://jira.example.com/$key)",
+	}, {
+		Name:     "docs",
+		Pattern:  `docs`,
+		Template: "[docs](https://docs.example.com)",
+		Scope:    []string{"other"},
+	}}
 
-		api.On("LoadPluginConfiguration",
-			mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
-			*dest.(*Config) = conf
-			return nil
+	api := &plugintest.API{}
+	data := mockLinksStore(api)
+	var err error
+	*data, err = json.Marshal(links)
+	require.NoError(t, err)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = Config{SchemaVersion: currentSchemaVersion}
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", "admin").Return(&model.User{Roles: "system_admin system_user"}, nil)
+	api.On("GetUser", "user1").Return(&model.User{}, nil)
+	api.On("GetChannel", "channel1").Return(&model.Channel{Name: "town-square", TeamId: "team1"}, nil)
+	api.On("GetTeam", "team1").Return(&model.Team{Name: "team1"}, nil)
+	api.On("KVGet", mock.AnythingOfType("string")).Return(nil, nil)
+	api.On("LogInfo", mock.AnythingOfType("string"))
+	api.On("LogDebug", "Link evaluated", "link", mock.Anything, "post_id", "post1", "input", mock.Anything,
+		"matched", mock.Anything, "matches", mock.Anything, "duration", mock.AnythingOfType("string"))
+	api.On("LogDebug", "Link skipped", "link", mock.Anything, "post_id", "post1", "input", mock.Anything,
+		"reason", mock.Anything)
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	run := func(command string) string {
+		resp, appErr := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{
+			UserId:    "admin",
+			ChannelId: "channel1",
+			Command:   command,
 		})
-		api.On("UnregisterCommand", mock.AnythingOfType("string"),
-			mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+		require.Nil(t, appErr)
+		return resp.Text
+	}
 
-		api.On("GetChannel", mock.AnythingOfType("string")).Return(&testChannel, nil)
-		api.On("GetTeam", mock.AnythingOfType("string")).Return(&testTeam, nil)
+	post := &model.Post{Id: "post1", UserId: "user1", ChannelId: "channel1", Message: "See MM-1"}
+	_, _ = p.MessageWillBePosted(&plugin.Context{}, post.Clone())
+	api.AssertNotCalled(t, "LogDebug", "Link evaluated", "link", "jira", "post_id", "post1", "input", "See MM-1",
+		"matched", true, "matches", 1, "duration", mock.AnythingOfType("string"))
+
+	assert.Contains(t, run("/autolink debug jira on"), "Debug: `true`")
+	assert.Contains(t, run("/autolink debug docs on"), "Debug: `true`")
+	_, _ = p.MessageWillBePosted(&plugin.Context{}, post.Clone())
+	api.AssertCalled(t, "LogDebug", "Link evaluated", "link", "jira", "post_id", "post1", "input", "See MM-1",
+		"matched", true, "matches", 1, "duration", mock.AnythingOfType("string"))
+	api.AssertCalled(t, "LogDebug", "Link skipped", "link", "docs", "post_id", "post1", "input", "See MM-1",
+		"reason", "out of scope")
+
+	assert.NotContains(t, run("/autolink debug jira off"), "Debug:")
+	assert.Contains(t, run("/autolink debug jira maybe"), "Mattermost Autolink Plugin Administration")
+}
 
-		testUser := model.User{
-			IsBot: false,
-		}
-		api.On("GetUser", mock.AnythingOfType("string")).Return(&testUser, nil)
+func TestSelfTestCommand(t *testing.T) {
+	links := []autolink.Autolink{{
+		Name:     "jira",
+		Pattern:  `(?P<key>MM-\d+)`,
+		Template: "[$key](https://jira.example.com/$key)",
+	}}
 
-		p := New()
-		p.SetAPI(api)
-		_ = p.OnConfigurationChange()
+	api := &plugintest.API{}
+	data := mockLinksStore(api)
+	var err error
+	*data, err = json.Marshal(links)
+	require.NoError(t, err)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = Config{SchemaVersion: currentSchemaVersion}
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", "admin").Return(&model.User{Roles: "system_admin system_user"}, nil)
+	api.On("GetChannel", "channel1").Return(&model.Channel{Name: "town-square", TeamId: "team1"}, nil)
+	api.On("GetChannel", "missing").Return(nil, model.NewAppError("GetChannel", "not_found", nil, "", http.StatusNotFound))
+	api.On("GetTeam", "team1").Return(&model.Team{Name: "team1"}, nil)
+	api.On("LogInfo", mock.AnythingOfType("string"))
+	var value []byte
+	api.On("KVSetWithOptions", selfTestKey, mock.Anything, model.PluginKVSetOptions{ExpireInSeconds: 60}).Return(
+		func(_ string, v []byte, _ model.PluginKVSetOptions) bool {
+			value = v
+			return true
+		}, nil)
+	api.On("KVGet", selfTestKey).Return(func(string) []byte { return value }, nil)
+	api.On("KVDelete", selfTestKey).Return(nil)
 
-		post := &model.Post{Message: "Welcome to Mattermost!"}
-		rpost, _ := p.ProcessPost(&plugin.Context{}, post)
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
 
-		assert.Equal(t, "Welcome to [Mattermost](https://mattermost.com)!", rpost.Message)
+	run := func(channelID string) string {
+		resp, appErr := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{
+			UserId:    "admin",
+			ChannelId: channelID,
+			Command:   "/autolink selftest",
+		})
+		require.Nil(t, appErr)
+		return resp.Text
+	}
+
+	assert.Equal(t, "- :white_check_mark: Configuration: loaded, 1 link(s)\n"+
+		"- :white_check_mark: Links: the 1 enabled link(s) compile\n"+
+		"- :white_check_mark: Scope resolution: this channel is `team1/town-square`\n"+
+		"- :white_check_mark: Post rewrite: a test link rewrote a test post\n"+
+		"- :white_check_mark: KV store: wrote, read and deleted a test value\n"+
+		"\nAll the stages passed.", run("channel1"))
+	api.AssertCalled(t, "KVDelete", selfTestKey)
+
+	out := run("missing")
+	assert.Contains(t, out, "- :x: Scope resolution: GetChannel: not_found")
+	assert.Contains(t, out, "\n1 of the 5 stages failed.")
+}
+
+func TestUsageStats(t *testing.T) {
+	pluginAPI := &plugintest.API{}
+	usageKey := mock.MatchedBy(func(key string) bool { return strings.HasPrefix(key, usageKeyPrefix) })
+	kv := map[string][]byte{}
+	pluginAPI.On("KVGet", usageKey).Return(func(key string) []byte {
+		return kv[key]
+	}, nil)
+	// Another server saves its usage of the day between the first read and
+	// write
+	concurrent := true
+	todayKey := usageKeyPrefix + time.Now().UTC().Format(api.StatsDateLayout)
+	pluginAPI.On("KVSetWithOptions", usageKey, mock.Anything, mock.AnythingOfType("model.PluginKVSetOptions")).Return(
+		func(key string, value []byte, options model.PluginKVSetOptions) bool {
+			if concurrent && key == todayKey {
+				concurrent = false
+				kv[key] = []byte(`{"jira":{"channel1":5}}`)
+				return false
+			}
+			if !options.Atomic || !bytes.Equal(options.OldValue, kv[key]) || options.ExpireInSeconds <= 0 {
+				return false
+			}
+			kv[key] = value
+			return true
+		}, nil)
+	pluginAPI.On("GetChannel", "channel1").Return(&model.Channel{Name: "town-square", TeamId: "team1"}, nil)
+	pluginAPI.On("GetChannel", "channel2").Return(nil, &model.AppError{Message: "deleted"})
+	pluginAPI.On("GetTeam", "team1").Return(&model.Team{Name: "dev"}, nil)
+
+	p := New()
+	p.SetAPI(pluginAPI)
+
+	jira := autolink.Autolink{Name: "jira"}
+	p.linkFired(&model.Post{Id: "post1", ChannelId: "channel1"})(jira, nil)
+	p.linkFired(&model.Post{Id: "post2", ChannelId: "channel1"})(jira, nil)
+	p.linkFired(&model.Post{Id: "post3", ChannelId: "channel2"})(autolink.Autolink{Name: "docs"}, nil)
+	yesterday := time.Now().UTC().AddDate(0, 0, -1)
+	p.usage.record("jira", "channel2", yesterday)
+	p.usage.record("docs", "channel1", yesterday.AddDate(0, 0, -10))
+
+	p.saveUsage()
+	assert.False(t, concurrent)
+	assert.Nil(t, p.usage.take(), "all the usage is saved")
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	stats, err := p.UsageStats(today.AddDate(0, 0, -2), today)
+	require.NoError(t, err)
+	assert.Equal(t, []api.UsageStat{
+		{Date: yesterday.Format(api.StatsDateLayout), Link: "jira", ChannelID: "channel2", Posts: 1},
+		{Date: today.Format(api.StatsDateLayout), Link: "docs", ChannelID: "channel2", Posts: 1},
+		{Date: today.Format(api.StatsDateLayout), Link: "jira", ChannelID: "channel1", ChannelName: "town-square", TeamName: "dev", Posts: 7},
+	}, stats)
+
+	activity, err := p.LinkActivity([]autolink.Autolink{jira, {Name: "docs"}, {Name: "unused"}})
+	require.NoError(t, err)
+	require.Len(t, activity, 3)
+	assert.Equal(t, []int{8, 8}, []int{activity[0].Posts7Days, activity[0].Posts30Days})
+	assert.NotNil(t, activity[0].LastFiredAt)
+	assert.Equal(t, []int{1, 2}, []int{activity[1].Posts7Days, activity[1].Posts30Days})
+	assert.Equal(t, api.LinkActivity{}, activity[2])
+
+	header := &model.CommandArgs{T: p.translateFunc("en")}
+	assert.Equal(t, "  - Matches: **none** in the last 30 days\n", formatLinkActivity(header, activity[2]))
+	activity[1].LastFiredAt = &today
+	assert.Equal(t, "  - Matches: 1 post(s) in the last 7 days, 2 in the last 30 days, last at "+today.Format(time.RFC3339)+"\n",
+		formatLinkActivity(header, activity[1]))
+}
+
+func TestPermalinkLinks(t *testing.T) {
+	conf := Config{Links: []autolink.Autolink{{
+		Name:    "permalink",
+		Pattern: `https://chat\.example\.com/[\w-]+/pl/(?P<post_id>[a-z0-9]{26})`,
+		Kind:    autolink.KindPermalink,
+	}}}
+
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
 	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", mock.AnythingOfType("string")).Return(&model.User{}, nil)
+	api.On("KVGet", userOptOutKeyPrefix+"user1").Return(nil, nil)
+	api.On("KVGet", channelOptOutKeyPrefix+"current").Return(nil, nil)
+	siteURL := "https://chat.example.com/"
+	api.On("GetConfig").Return(&model.Config{ServiceSettings: model.ServiceSettings{SiteURL: &siteURL}})
+	api.On("GetTeam", "team1").Return(&model.Team{Name: "dev"}, nil)
+
+	posts := map[string]*model.Post{}
+	addPost := func(channelID string, channelType model.ChannelType, message string, readable bool) string {
+		id := model.NewId()
+		posts[id] = &model.Post{Id: id, ChannelId: channelID, Message: message}
+		api.On("GetPost", id).Return(posts[id], nil)
+		api.On("GetChannel", channelID).Return(&model.Channel{Id: channelID, TeamId: "team1", Type: channelType}, nil)
+		api.On("HasPermissionToChannel", "user1", channelID, model.PermissionReadChannel).Return(readable)
+		return id
+	}
+	public := addPost("public", model.ChannelTypeOpen, "The build is broken\nDetails follow", true)
+	private := addPost("private", model.ChannelTypePrivate, "Secret plans", true)
+	same := addPost("current", model.ChannelTypePrivate, strings.Repeat("long ", 20), true)
+	unreadable := addPost("archived", model.ChannelTypeOpen, "Not for you", false)
+	missing := model.NewId()
+	api.On("GetPost", missing).Return(nil, &model.AppError{Message: "not found"})
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	url := func(id string) string { return "https://chat.example.com/dev/pl/" + id }
+	for name, tc := range map[string]struct {
+		id, expected string
+	}{
+		"public channel":     {public, "See [“The build is broken”](" + url(public) + ")."},
+		"private channel":    {private, "See " + url(private) + "."},
+		"same channel":       {same, "See [“" + strings.TrimSpace(strings.Repeat("long ", 16)) + "…”](" + url(same) + ")."},
+		"no read permission": {unreadable, "See " + url(unreadable) + "."},
+		"missing post":       {missing, "See " + url(missing) + "."},
+	} {
+		t.Run(name, func(t *testing.T) {
+			post, _ := p.MessageWillBePosted(&plugin.Context{}, &model.Post{UserId: "user1", ChannelId: "current", Message: "See " + url(tc.id) + "."})
+			assert.Equal(t, tc.expected, post.Message)
+		})
+	}
 }
 
-func TestInScope(t *testing.T) {
-	t.Run("returns true if scope array is empty", func(t *testing.T) {
-		p := &Plugin{}
-		result := p.inScope([]string{}, "TestChannel", "TestTeam")
-		assert.Equal(t, true, result)
+func TestShadowMode(t *testing.T) {
+	conf := Config{
+		Links: []autolink.Autolink{{
+			Name:       "jira",
+			Pattern:    `(?P<key>MM-\d+)`,
+			Template:   "[$key](https://jira.example.com/$key)",
+			ShadowMode: true,
+		}, {
+			Name:       "secrets",
+			Pattern:    `secret`,
+			Kind:       autolink.KindReject,
+			ShadowMode: true,
+		}, {
+			Name:     "docs",
+			Pattern:  `docs`,
+			Template: "[docs](https://docs.example.com)",
+		}},
+	}
+
+	pluginAPI := &plugintest.API{}
+	mockLinksStore(pluginAPI)
+	pluginAPI.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
 	})
+	pluginAPI.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	pluginAPI.On("GetUser", mock.AnythingOfType("string")).Return(&model.User{}, nil)
+	pluginAPI.On("KVGet", mock.AnythingOfType("string")).Return(nil, nil)
+	pluginAPI.On("LogInfo", "Shadow link matched a post", "link", mock.Anything, "post_id", "post1",
+		"user_id", "user1", "channel_id", "channel1")
 
-	t.Run("returns true when team and channels are valid", func(t *testing.T) {
-		p := &Plugin{}
-		result := p.inScope([]string{"TestTeam/TestChannel"}, "TestChannel", "TestTeam")
-		assert.Equal(t, true, result)
+	p := New()
+	p.SetAPI(pluginAPI)
+	require.NoError(t, p.OnConfigurationChange())
+
+	post := &model.Post{Id: "post1", UserId: "user1", ChannelId: "channel1", Message: "See MM-1 secret docs"}
+	rpost, rejection := p.MessageWillBePosted(&plugin.Context{}, post)
+	require.Empty(t, rejection)
+	assert.Equal(t, "See MM-1 secret [docs](https://docs.example.com)", rpost.Message)
+	pluginAPI.AssertCalled(t, "LogInfo", "Shadow link matched a post", "link", "jira", "post_id", "post1",
+		"user_id", "user1", "channel_id", "channel1")
+	pluginAPI.AssertCalled(t, "LogInfo", "Shadow link matched a post", "link", "secrets", "post_id", "post1",
+		"user_id", "user1", "channel_id", "channel1")
+
+	today := time.Now().UTC().Format(api.StatsDateLayout)
+	assert.Equal(t, map[string]dailyUsage{today: {
+		"jira":    {"channel1": 1},
+		"secrets": {"channel1": 1},
+		"docs":    {"channel1": 1},
+	}}, p.usage.take())
+}
+
+func TestExcludedPosts(t *testing.T) {
+	conf := Config{
+		ExcludedPosts: "# Deployments\ntype:custom_deploy\nfrom_bridge\noverride_username=deploybot\n",
+		Links: []autolink.Autolink{{
+			Pattern:  `(?P<key>MM-\d+)`,
+			Template: "[$key](https://jira.example.com/$key)",
+		}, {
+			Pattern: `secret`,
+			Kind:    autolink.KindReject,
+		}},
+	}
+
+	pluginAPI := &plugintest.API{}
+	mockLinksStore(pluginAPI)
+	pluginAPI.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
 	})
+	pluginAPI.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	pluginAPI.On("GetUser", mock.AnythingOfType("string")).Return(&model.User{}, nil)
+	pluginAPI.On("LogInfo", mock.AnythingOfType("string"), mock.Anything, mock.Anything, mock.Anything, mock.Anything,
+		mock.Anything, mock.Anything)
 
-	t.Run("returns false when channel is empty", func(t *testing.T) {
-		p := &Plugin{}
-		result := p.inScope([]string{"TestTeam/"}, "TestChannel", "TestTeam")
-		assert.Equal(t, false, result)
+	p := New()
+	p.SetAPI(pluginAPI)
+	require.NoError(t, p.OnConfigurationChange())
+
+	for _, tc := range []struct {
+		name     string
+		postType string
+		props    model.StringInterface
+		excluded bool
+	}{
+		{
+			name: "no exclusion",
+		},
+		{
+			name:     "post type",
+			postType: "custom_deploy",
+			excluded: true,
+		},
+		{
+			name:     "other post type",
+			postType: "custom_other",
+		},
+		{
+			name:     "prop set",
+			props:    model.StringInterface{"from_bridge": true},
+			excluded: true,
+		},
+		{
+			name:  "prop not set",
+			props: model.StringInterface{"from_bridge": "false"},
+		},
+		{
+			name:     "prop value",
+			props:    model.StringInterface{"override_username": "deploybot"},
+			excluded: true,
+		},
+		{
+			name:  "other prop value",
+			props: model.StringInterface{"override_username": "someone"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			post := &model.Post{Message: "See MM-1", Type: tc.postType}
+			post.SetProps(tc.props)
+			rpost, _ := p.MessageWillBePosted(&plugin.Context{}, post)
+			if tc.excluded {
+				assert.Equal(t, "See MM-1", rpost.Message)
+			} else {
+				assert.Equal(t, "See [MM-1](https://jira.example.com/MM-1)", rpost.Message)
+			}
+
+			// Reject links still apply to the posts excluded
+			post = &model.Post{Message: "A secret", Type: tc.postType}
+			post.SetProps(tc.props)
+			rpost, rejection := p.MessageWillBePosted(&plugin.Context{}, post)
+			assert.Nil(t, rpost)
+			assert.NotEmpty(t, rejection)
+		})
+	}
+
+	_, err := parsePostExclusions("type:")
+	assert.Error(t, err)
+	_, err = parsePostExclusions("=value")
+	assert.Error(t, err)
+}
+
+func TestLinkRefMatching(t *testing.T) {
+	links := []autolink.Autolink{
+		{Name: "jira", Pattern: `MM-\d+`, Template: "jira"},
+		{Name: "jira-old", Pattern: `OLD-\d+`, Template: "jira-old"},
+		{Name: "confluence-pages", Pattern: `page`, Template: "page"},
+		{Name: "confluence-spaces", Pattern: `space`, Template: "space"},
+		{Name: "documentation", Pattern: `docs`, Template: "docs"},
+	}
+
+	api := &plugintest.API{}
+	data := mockLinksStore(api)
+	var err error
+	*data, err = json.Marshal(links)
+	require.NoError(t, err)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = Config{SchemaVersion: currentSchemaVersion}
+		return nil
 	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", "admin").Return(&model.User{Roles: "system_admin system_user"}, nil)
+	api.On("LogInfo", mock.AnythingOfType("string"))
 
-	t.Run("returns false when team is empty", func(t *testing.T) {
-		p := &Plugin{}
-		result := p.inScope([]string{"TestTeam/TestChannel"}, "TestChannel", "")
-		assert.Equal(t, false, result)
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	run := func(command string) string {
+		resp, appErr := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{
+			UserId:  "admin",
+			Command: command,
+		})
+		require.Nil(t, appErr)
+		return resp.Text
+	}
+
+	// The link named exactly is not ambiguous with the links containing its
+	// name
+	out := run("/autolink disable jira")
+	assert.Contains(t, out, "~~jira~~ **Disabled**")
+	assert.Contains(t, out, ": jira-old\n")
+	// Neither is the only link whose name starts with the reference
+	assert.Contains(t, run("/autolink disable doc"), "~~documentation~~ **Disabled**")
+	assert.Contains(t, run("/autolink disable confluence"), `"confluence" matched more than one link: ["confluence-pages" "confluence-spaces"]`)
+
+	assert.Equal(t, `"jria" not found, did you mean: jira?`, run("/autolink enable jria"))
+	assert.Equal(t, `"documantation" not found, did you mean: documentation?`, run("/autolink delete documantation"))
+	assert.Equal(t, `"zzz" not found`, run("/autolink set zzz Template x"))
+
+	assert.Equal(t, 0, editDistance("jira", "jira"))
+	assert.Equal(t, 1, editDistance("jria", "jira"))
+	assert.Equal(t, 3, editDistance("kitten", "sitting"))
+}
+
+func TestReloadCommand(t *testing.T) {
+	links := []autolink.Autolink{{
+		Name:     "jira",
+		Pattern:  `(?P<key>MM-\d+)`,
+		Template: "[$key](https://jira.example.com/$key)",
+	}}
+
+	pluginAPI := &plugintest.API{}
+	data := mockLinksStore(pluginAPI)
+	var err error
+	*data, err = json.Marshal(links)
+	require.NoError(t, err)
+	pluginAPI.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = Config{SchemaVersion: currentSchemaVersion}
+		return nil
 	})
+	pluginAPI.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	pluginAPI.On("GetUser", "admin").Return(&model.User{Roles: "system_admin system_user"}, nil)
+	pluginAPI.On("LogInfo", mock.AnythingOfType("string"))
+	pluginAPI.On("LogInfo", "Configuration reloaded", "user_id", "admin")
+	pluginAPI.On("LogError", "Error creating autolinker", "link", mock.Anything, "error", mock.AnythingOfType("string"))
 
-	t.Run("returns false on empty scope", func(t *testing.T) {
-		p := &Plugin{}
-		result := p.inScope([]string{""}, "TestChannel", "TestTeam")
-		assert.Equal(t, false, result)
+	p := New()
+	p.SetAPI(pluginAPI)
+	require.NoError(t, p.OnConfigurationChange())
+
+	// The links fixed directly in the KV store are loaded and compiled again
+	links = append(links, autolink.Autolink{Name: "broken", Pattern: "(", Template: "x"})
+	*data, err = json.Marshal(links)
+	require.NoError(t, err)
+
+	resp, appErr := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{UserId: "admin", Command: "/autolink reload"})
+	require.Nil(t, appErr)
+	assert.Equal(t, "Reloaded the configuration, 1 of the 2 link(s) compile.\n- `broken`: error parsing regexp: missing closing ): `(`", resp.Text)
+	assert.Len(t, p.GetLinks(), 2)
+	pluginAPI.AssertCalled(t, "PublishPluginClusterEvent", model.PluginClusterEvent{Id: clusterEventReload},
+		mock.AnythingOfType("model.PluginClusterEventSendOptions"))
+}
+
+func TestSampleCommand(t *testing.T) {
+	conf := Config{
+		Links: []autolink.Autolink{
+			{Name: "jira", Pattern: `MM-(?P<id>\d+)`, Template: "[MM-$id](https://jira/MM-$id)"},
+			{Pattern: "c", Template: "d"},
+		},
+	}
+
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", "admin").Return(&model.User{Roles: "system_admin system_user"}, nil)
+	api.On("LogInfo", mock.AnythingOfType("string"), mock.Anything, mock.Anything)
+	api.On("LogInfo", mock.AnythingOfType("string"), mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	var samples []byte
+	api.On("KVSet", samplesKey, mock.Anything).Return(func(_ string, value []byte) *model.AppError {
+		samples = value
+		return nil
 	})
+	api.On("KVGet", samplesKey).Return(func(string) []byte {
+		return samples
+	}, nil)
 
-	t.Run("returns true on team scope only", func(t *testing.T) {
-		p := &Plugin{}
-		result := p.inScope([]string{"TestTeam"}, "TestChannel", "TestTeam")
-		assert.Equal(t, true, result)
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	command := func(command string) string {
+		resp, appErr := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{UserId: "admin", Command: command})
+		require.Nil(t, appErr)
+		return resp.Text
+	}
+
+	assert.Contains(t, command("/autolink verify"), "No samples to verify")
+	assert.Equal(t, "Added the sample \"basic\" to the link \"jira\", which generates:\n```\nSee [MM-12](https://jira/MM-12) now\n```",
+		command("/autolink sample add jira basic See MM-12 now"))
+	command("/autolink sample add jira none No issue here")
+	assert.Contains(t, command("/autolink sample add jira basic again"), "already has a sample")
+	assert.Contains(t, command("/autolink sample add 1 any c"), "Only named links")
+	assert.Equal(t, "All 2 sample(s) of 1 link(s) passed.", command("/autolink verify"))
+
+	command("/autolink set jira Template [MM-$id](https://issues/MM-$id)")
+	assert.Equal(t, "1 of the 2 sample(s) of 1 link(s) failed:\n"+
+		"- **jira** `basic`: `See MM-12 now`\n"+
+		"  - expected: `See [MM-12](https://jira/MM-12) now`\n"+
+		"  - actual: `See [MM-12](https://issues/MM-12) now`\n",
+		command("/autolink verify jira"))
+
+	assert.Equal(t, `Updated 1 sample(s) of the link "jira".`, command("/autolink sample update jira basic"))
+	assert.Equal(t, "All 2 sample(s) of 1 link(s) passed.", command("/autolink verify"))
+	assert.Equal(t, "Samples of the link \"jira\":\n"+
+		"- `basic`: `See MM-12 now` → `See [MM-12](https://issues/MM-12) now`\n"+
+		"- `none`: `No issue here` → `No issue here`\n",
+		command("/autolink sample list jira"))
+	assert.Equal(t, `Deleted the sample "none" of the link "jira".`, command("/autolink sample delete jira none"))
+	assert.Contains(t, command("/autolink sample delete jira none"), `has no sample "none"`)
+}
+
+func TestAPIKeyCommand(t *testing.T) {
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(nil)
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", "admin").Return(&model.User{Roles: "system_admin system_user"}, nil)
+	api.On("LogInfo", mock.AnythingOfType("string"), mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	api.On("LogInfo", mock.AnythingOfType("string"), mock.Anything, mock.Anything, mock.Anything, mock.Anything,
+		mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	var keys []byte
+	api.On("KVSet", apiKeysKey, mock.Anything).Return(func(_ string, value []byte) *model.AppError {
+		keys = value
+		return nil
 	})
+	api.On("KVGet", apiKeysKey).Return(func(string) []byte {
+		return keys
+	}, nil)
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	command := func(command string) string {
+		resp, appErr := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{UserId: "admin", Command: command})
+		require.Nil(t, appErr)
+		return resp.Text
+	}
+
+	assert.Contains(t, command("/autolink apikey list"), "There are no API keys")
+	assert.Contains(t, command("/autolink apikey create bad --scope admin"), `"admin" is not a valid scope`)
+
+	created := command("/autolink apikey create jira-sync --scope write --group jira")
+	key := regexp.MustCompile(apiKeyPrefix + `[a-z0-9]{52}`).FindString(created)
+	require.NotEmpty(t, key, created)
+	assert.NotContains(t, string(keys), key, "only the hash of the key is kept")
+	assert.Contains(t, command("/autolink apikey create jira-sync"), "already exists")
+	command("/autolink apikey create reader")
+
+	scope, ok := p.APIKey(key)
+	assert.True(t, ok)
+	assert.Equal(t, "jira-sync", scope.Name)
+	assert.True(t, scope.Write)
+	assert.Equal(t, "jira", scope.Group)
+	_, ok = p.APIKey(key + "x")
+	assert.False(t, ok)
+
+	list := command("/autolink apikey list")
+	assert.Contains(t, list, "- `jira-sync`: write, group `jira`")
+	assert.Contains(t, list, "- `reader`: read, group `*`")
+
+	assert.Equal(t, `Revoked the API key "jira-sync".`, command("/autolink apikey revoke jira-sync"))
+	_, ok = p.APIKey(key)
+	assert.False(t, ok)
+	assert.Contains(t, command("/autolink apikey revoke jira-sync"), "does not exist")
 }
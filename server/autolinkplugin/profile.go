@@ -0,0 +1,229 @@
+package autolinkplugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin"
+	"github.com/pkg/errors"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+// profilesKey is the KV store key of the link profiles, a JSON object of the
+// names of the links enabled by each profile.
+const profilesKey = "profiles"
+
+// profileOff is the built-in profile disabling all the links.
+const profileOff = "off"
+
+// optAll is the argument of `/autolink disable` and `/autolink enable`
+// applying to all the links.
+const optAll = "--all"
+
+// getProfiles returns the saved link profiles, by name.
+func (p *Plugin) getProfiles() (map[string][]string, error) {
+	data, appErr := p.API.KVGet(profilesKey)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to get the profiles")
+	}
+	profiles := map[string][]string{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &profiles); err != nil {
+			return nil, errors.Wrap(err, "failed to decode the profiles")
+		}
+	}
+	return profiles, nil
+}
+
+// saveProfiles saves the link profiles.
+func (p *Plugin) saveProfiles(profiles map[string][]string) error {
+	data, err := json.Marshal(profiles)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode the profiles")
+	}
+	if appErr := p.API.KVSet(profilesKey, data); appErr != nil {
+		return errors.Wrap(appErr, "failed to save the profiles")
+	}
+	return nil
+}
+
+// enabledLinkNames returns the names of the enabled links, sorted.
+func enabledLinkNames(links []autolink.Autolink) []string {
+	names := []string{}
+	for _, l := range links {
+		if !l.Disabled {
+			names = append(names, l.DisplayName())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyProfile enables the links named by the profile, and disables the
+// others. It returns the links and the number of links changed.
+func applyProfile(links []autolink.Autolink, enabled []string) ([]autolink.Autolink, int) {
+	names := map[string]bool{}
+	for _, name := range enabled {
+		names[name] = true
+	}
+	applied := append([]autolink.Autolink{}, links...)
+	changed := 0
+	for i := range applied {
+		disabled := !names[applied[i].DisplayName()]
+		if applied[i].Disabled != disabled {
+			applied[i].Disabled = disabled
+			changed++
+		}
+	}
+	return applied, changed
+}
+
+// checkProfileAuthorized returns the response rejecting the team admins, whose
+// commands are limited to the links of their teams, from switching the links
+// of everyone, or nil.
+func checkProfileAuthorized(p *Plugin, header *model.CommandArgs) *model.CommandResponse {
+	filter, err := linkFilter(p, header)
+	if err != nil {
+		return responsef("%v", err)
+	}
+	if filter != nil {
+		return responsef(header.T("autolink.command.profile.not_authorized"))
+	}
+	return nil
+}
+
+func executeProfileList(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) != 0 {
+		return responsef(header.T("autolink.command.help"))
+	}
+	if resp := checkProfileAuthorized(p, header); resp != nil {
+		return resp
+	}
+	profiles, err := p.getProfiles()
+	if err != nil {
+		return responsef(header.T("autolink.command.profile.failed"), err)
+	}
+
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := header.T("autolink.command.profile.list")
+	out += fmt.Sprintf(header.T("autolink.command.profile.off"), profileOff)
+	for _, name := range names {
+		out += fmt.Sprintf("- `%s`: %s\n", name, strings.Join(profiles[name], ", "))
+	}
+	return responsef("%s", out)
+}
+
+func executeProfileSave(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) != 1 {
+		return responsef(header.T("autolink.command.help"))
+	}
+	if resp := checkProfileAuthorized(p, header); resp != nil {
+		return resp
+	}
+	name := args[0]
+	if name == profileOff {
+		return responsef(header.T("autolink.command.profile.built_in"), name)
+	}
+	profiles, err := p.getProfiles()
+	if err != nil {
+		return responsef(header.T("autolink.command.profile.failed"), err)
+	}
+
+	enabled := enabledLinkNames(p.GetLinks())
+	profiles[name] = enabled
+	if err = p.saveProfiles(profiles); err != nil {
+		return responsef(header.T("autolink.command.profile.failed"), err)
+	}
+	p.API.LogInfo("Saved a link profile", "user_id", header.UserId, "profile", name, "enabled", len(enabled))
+	return responsef(header.T("autolink.command.profile.saved"), name, len(enabled))
+}
+
+func executeProfileApply(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) != 1 {
+		return responsef(header.T("autolink.command.help"))
+	}
+	if resp := checkProfileAuthorized(p, header); resp != nil {
+		return resp
+	}
+	name := args[0]
+	var enabled []string
+	if name != profileOff {
+		profiles, err := p.getProfiles()
+		if err != nil {
+			return responsef(header.T("autolink.command.profile.failed"), err)
+		}
+		var ok bool
+		if enabled, ok = profiles[name]; !ok {
+			return responsef(header.T("autolink.command.profile.not_found"), name)
+		}
+	}
+
+	links, changed := applyProfile(p.GetLinks(), enabled)
+	if changed > 0 {
+		if err := p.SaveLinks(links); err != nil {
+			return responsef(err.Error())
+		}
+	}
+	p.API.LogInfo("Applied a link profile", "user_id", header.UserId, "profile", name, "changed", changed)
+	return responsef(header.T("autolink.command.profile.applied"), name, len(enabledLinkNames(links)), len(links))
+}
+
+func executeProfileDelete(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) != 1 {
+		return responsef(header.T("autolink.command.help"))
+	}
+	if resp := checkProfileAuthorized(p, header); resp != nil {
+		return resp
+	}
+	name := args[0]
+	if name == profileOff {
+		return responsef(header.T("autolink.command.profile.built_in"), name)
+	}
+	profiles, err := p.getProfiles()
+	if err != nil {
+		return responsef(header.T("autolink.command.profile.failed"), err)
+	}
+	if _, ok := profiles[name]; !ok {
+		return responsef(header.T("autolink.command.profile.not_found"), name)
+	}
+	delete(profiles, name)
+	if err = p.saveProfiles(profiles); err != nil {
+		return responsef(header.T("autolink.command.profile.failed"), err)
+	}
+	return responsef(header.T("autolink.command.profile.deleted"), name)
+}
+
+// executeEnableAll enables or disables all the links the user running the
+// command may manage.
+func executeEnableAll(p *Plugin, header *model.CommandArgs, enabled bool) *model.CommandResponse {
+	filter, err := linkFilter(p, header)
+	if err != nil {
+		return responsef("%v", err)
+	}
+	links := append([]autolink.Autolink{}, p.GetLinks()...)
+	changed := 0
+	for i := range links {
+		if (filter != nil && !filter(links[i])) || links[i].Disabled == !enabled {
+			continue
+		}
+		links[i].Disabled = !enabled
+		changed++
+	}
+	if changed > 0 {
+		if err = p.SaveLinks(links); err != nil {
+			return responsef(err.Error())
+		}
+	}
+	if enabled {
+		return responsef(header.T("autolink.command.enable.all"), changed)
+	}
+	return responsef(header.T("autolink.command.disable.all"), changed)
+}
@@ -0,0 +1,52 @@
+package autolinkplugin
+
+import (
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/api"
+)
+
+// Reload reads the configuration and the links again and compiles all the
+// links, on this server and on the others of the cluster, e.g. after the
+// links were fixed directly in the database. It returns the status of the
+// links on this server.
+func (p *Plugin) Reload() (api.Status, error) {
+	if err := p.loadConfiguration(true); err != nil {
+		return api.Status{}, err
+	}
+	p.publishClusterEvent(clusterEventReload, nil, model.PluginClusterEventSendTypeReliable)
+	return p.Status(), nil
+}
+
+func executeReload(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) != 0 {
+		return responsef(header.T("autolink.command.help"))
+	}
+	// Team admins, whose commands are limited to the links of their teams,
+	// may not reload the configuration of everyone
+	filter, err := linkFilter(p, header)
+	if err != nil {
+		return responsef("%v", err)
+	}
+	if filter != nil {
+		return responsef(header.T("autolink.command.reload.not_authorized"))
+	}
+
+	status, err := p.Reload()
+	if err != nil {
+		return responsef(header.T("autolink.command.reload.failed"), err)
+	}
+	p.API.LogInfo("Configuration reloaded", "user_id", header.UserId)
+
+	compiled := 0
+	out := ""
+	for _, link := range status.Links {
+		if link.CompileError != "" {
+			out += header.T("autolink.command.reload.compile_error", link.Name, link.CompileError)
+			continue
+		}
+		compiled++
+	}
+	return responsef("%s", header.T("autolink.command.reload.reloaded", compiled, len(status.Links))+out)
+}
@@ -0,0 +1,264 @@
+package autolinkplugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin"
+	"github.com/pkg/errors"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+// samplesKey is the KV store key of the sample texts of the links, a JSON
+// object of the samples of each link, by link name.
+const samplesKey = "samples"
+
+// linkSample is a named sample text of a link, with the text the link
+// generated from it when the sample was recorded, which `/autolink verify`
+// expects it to still generate.
+type linkSample struct {
+	Name     string `json:"name"`
+	Text     string `json:"text"`
+	Expected string `json:"expected"`
+}
+
+// getSamples returns the samples of the links, by link name.
+func (p *Plugin) getSamples() (map[string][]linkSample, error) {
+	data, appErr := p.API.KVGet(samplesKey)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to get the samples")
+	}
+	samples := map[string][]linkSample{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &samples); err != nil {
+			return nil, errors.Wrap(err, "failed to decode the samples")
+		}
+	}
+	return samples, nil
+}
+
+// saveSamples saves the samples of the links.
+func (p *Plugin) saveSamples(samples map[string][]linkSample) error {
+	data, err := json.Marshal(samples)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode the samples")
+	}
+	if appErr := p.API.KVSet(samplesKey, data); appErr != nil {
+		return errors.Wrap(appErr, "failed to save the samples")
+	}
+	return nil
+}
+
+// applySample returns the text the link generates from the sample text, as
+// `/autolink test` does.
+func applySample(l autolink.Autolink, text string) (string, error) {
+	l.Disabled = false
+	if err := l.Compile(); err != nil {
+		return "", err
+	}
+	return l.Replace(text), nil
+}
+
+// textAfter returns the command line after the given words, trimmed.
+func textAfter(command string, words ...string) string {
+	rest := commandRest(command)
+	for _, word := range words {
+		i := strings.Index(rest, word)
+		if i < 0 {
+			return ""
+		}
+		rest = rest[i+len(word):]
+	}
+	return strings.TrimSpace(rest)
+}
+
+// sampleLink returns the link with the reference, which must be named for its
+// samples to be found again.
+func sampleLink(p *Plugin, header *model.CommandArgs, ref string) (autolink.Autolink, error) {
+	links, refs, err := searchLinkRef(p, header, true, ref)
+	if err != nil {
+		return autolink.Autolink{}, err
+	}
+	l := links[refs[0]]
+	if l.Name == "" {
+		return autolink.Autolink{}, errors.New(header.T("autolink.command.sample.unnamed"))
+	}
+	return l, nil
+}
+
+func executeSampleAdd(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) < 3 {
+		return responsef(header.T("autolink.command.help"))
+	}
+	l, err := sampleLink(p, header, args[0])
+	if err != nil {
+		return responsef("%v", err)
+	}
+	name := args[1]
+	text := textAfter(header.Command, "sample", "add", args[0], name)
+
+	expected, err := applySample(l, text)
+	if err != nil {
+		return responsef(header.T("autolink.command.test.compile_failed"), l.DisplayName(), err)
+	}
+	samples, err := p.getSamples()
+	if err != nil {
+		return responsef(header.T("autolink.command.sample.failed"), err)
+	}
+	for _, s := range samples[l.Name] {
+		if s.Name == name {
+			return responsef(header.T("autolink.command.sample.exists"), name, l.Name)
+		}
+	}
+	samples[l.Name] = append(samples[l.Name], linkSample{Name: name, Text: text, Expected: expected})
+	if err = p.saveSamples(samples); err != nil {
+		return responsef(header.T("autolink.command.sample.failed"), err)
+	}
+	return responsef(header.T("autolink.command.sample.added"), name, l.Name, expected)
+}
+
+func executeSampleList(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) != 1 {
+		return responsef(header.T("autolink.command.help"))
+	}
+	l, err := sampleLink(p, header, args[0])
+	if err != nil {
+		return responsef("%v", err)
+	}
+	samples, err := p.getSamples()
+	if err != nil {
+		return responsef(header.T("autolink.command.sample.failed"), err)
+	}
+	if len(samples[l.Name]) == 0 {
+		return responsef(header.T("autolink.command.sample.none"), l.Name)
+	}
+
+	out := fmt.Sprintf(header.T("autolink.command.sample.list"), l.Name)
+	for _, s := range samples[l.Name] {
+		out += fmt.Sprintf("- `%s`: `%s` → `%s`\n", s.Name, s.Text, s.Expected)
+	}
+	return responsef("%s", out)
+}
+
+// executeSampleUpdate records what the link generates now as the expected
+// text of its samples, or of one of them, once a change is intended.
+func executeSampleUpdate(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) < 1 || len(args) > 2 {
+		return responsef(header.T("autolink.command.help"))
+	}
+	l, err := sampleLink(p, header, args[0])
+	if err != nil {
+		return responsef("%v", err)
+	}
+	samples, err := p.getSamples()
+	if err != nil {
+		return responsef(header.T("autolink.command.sample.failed"), err)
+	}
+
+	updated := 0
+	for i, s := range samples[l.Name] {
+		if len(args) == 2 && s.Name != args[1] {
+			continue
+		}
+		expected, compileErr := applySample(l, s.Text)
+		if compileErr != nil {
+			return responsef(header.T("autolink.command.test.compile_failed"), l.DisplayName(), compileErr)
+		}
+		samples[l.Name][i].Expected = expected
+		updated++
+	}
+	if updated == 0 {
+		return responsef(header.T("autolink.command.sample.none"), l.Name)
+	}
+	if err = p.saveSamples(samples); err != nil {
+		return responsef(header.T("autolink.command.sample.failed"), err)
+	}
+	return responsef(header.T("autolink.command.sample.updated"), updated, l.Name)
+}
+
+func executeSampleDelete(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) != 2 {
+		return responsef(header.T("autolink.command.help"))
+	}
+	l, err := sampleLink(p, header, args[0])
+	if err != nil {
+		return responsef("%v", err)
+	}
+	samples, err := p.getSamples()
+	if err != nil {
+		return responsef(header.T("autolink.command.sample.failed"), err)
+	}
+
+	kept := []linkSample{}
+	for _, s := range samples[l.Name] {
+		if s.Name != args[1] {
+			kept = append(kept, s)
+		}
+	}
+	if len(kept) == len(samples[l.Name]) {
+		return responsef(header.T("autolink.command.sample.not_found"), args[1], l.Name)
+	}
+	if len(kept) == 0 {
+		delete(samples, l.Name)
+	} else {
+		samples[l.Name] = kept
+	}
+	if err = p.saveSamples(samples); err != nil {
+		return responsef(header.T("autolink.command.sample.failed"), err)
+	}
+	return responsef(header.T("autolink.command.sample.deleted"), args[1], l.Name)
+}
+
+// executeVerify runs the links against their samples, and reports the samples
+// whose generated text changed since they were recorded.
+func executeVerify(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) > 1 {
+		return responsef(header.T("autolink.command.help"))
+	}
+	links, refs, err := searchLinkRef(p, header, false, args...)
+	if err != nil {
+		return responsef("%v", err)
+	}
+	if len(args) == 0 && refs == nil {
+		for i := range links {
+			refs = append(refs, i)
+		}
+	}
+	samples, err := p.getSamples()
+	if err != nil {
+		return responsef(header.T("autolink.command.sample.failed"), err)
+	}
+
+	out := ""
+	verified, failed, verifiedLinks := 0, 0, 0
+	for _, ref := range refs {
+		l := links[ref]
+		if l.Name == "" || len(samples[l.Name]) == 0 {
+			continue
+		}
+		verifiedLinks++
+		for _, s := range samples[l.Name] {
+			verified++
+			actual, compileErr := applySample(l, s.Text)
+			if compileErr != nil {
+				failed++
+				out += fmt.Sprintf(header.T("autolink.command.verify.compile_failed"), l.Name, s.Name, compileErr)
+				continue
+			}
+			if actual != s.Expected {
+				failed++
+				out += fmt.Sprintf(header.T("autolink.command.verify.regression"), l.Name, s.Name, s.Text, s.Expected, actual)
+			}
+		}
+	}
+	if verified == 0 {
+		return responsef(header.T("autolink.command.verify.no_samples"))
+	}
+	if failed == 0 {
+		return responsef(header.T("autolink.command.verify.passed"), verified, verifiedLinks)
+	}
+	return responsef("%s", fmt.Sprintf(header.T("autolink.command.verify.failed"), failed, verified, verifiedLinks)+out)
+}
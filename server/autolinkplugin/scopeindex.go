@@ -0,0 +1,58 @@
+package autolinkplugin
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+// maxScopeIndexChannels is the number of channels whose links are kept in a
+// scopeIndex, which is emptied when it is reached.
+const maxScopeIndexChannels = 10000
+
+// scopeIndex caches the links applying to each channel, by team and channel
+// name, for the posts to only go through the links scoped to their channel
+// instead of evaluating the scope of every link. It is built anew with the
+// links of each configuration.
+type scopeIndex struct {
+	lock  sync.RWMutex
+	links map[string][]autolink.Autolink
+}
+
+func newScopeIndex() *scopeIndex {
+	return &scopeIndex{links: map[string][]autolink.Autolink{}}
+}
+
+// linksInScope returns the links of the configuration applying to the channel:
+// the links without a Scope, those whose Scope includes the channel, and the
+// links with Debug, which log that they were skipped.
+func (p *Plugin) linksInScope(conf *Config, channelName, teamName string) []autolink.Autolink {
+	index := conf.scopeIndex
+	key := strings.ToLower(teamName + "/" + channelName)
+	if index != nil {
+		index.lock.RLock()
+		links, ok := index.links[key]
+		index.lock.RUnlock()
+		if ok {
+			return links
+		}
+	}
+
+	links := make([]autolink.Autolink, 0, len(conf.Links))
+	for _, link := range conf.Links {
+		if len(link.Scope) == 0 || link.Debug || p.inScope(link.Scope, channelName, teamName) {
+			links = append(links, link)
+		}
+	}
+
+	if index != nil {
+		index.lock.Lock()
+		if len(index.links) >= maxScopeIndexChannels {
+			index.links = map[string][]autolink.Autolink{}
+		}
+		index.links[key] = links
+		index.lock.Unlock()
+	}
+	return links
+}
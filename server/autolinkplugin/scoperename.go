@@ -0,0 +1,74 @@
+package autolinkplugin
+
+import (
+	"strings"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+// renameChannelScopes updates the scopes naming the channel by its former
+// names, cached as "teamID channelName", after it was renamed or moved to
+// another team. Scopes naming the channel by ID and wildcard scopes are left
+// as they are.
+func (p *Plugin) renameChannelScopes(channelID, previous string) {
+	split := strings.SplitN(previous, " ", 2)
+	if len(split) != 2 || split[0] == "" {
+		return
+	}
+	previousTeamID, previousChannel := split[0], split[1]
+
+	conf := p.getConfig()
+	if conf == nil || !scopesChannel(conf.Links, previousChannel) {
+		return
+	}
+	previousTeam, appErr := p.resolveTeamName(previousTeamID)
+	if appErr != nil {
+		p.API.LogWarn("Failed to update the scopes of the renamed channel", "channel_id", channelID, "error", appErr.Error())
+		return
+	}
+	channelName, teamName, appErr := p.resolveScope(channelID)
+	if appErr != nil {
+		p.API.LogWarn("Failed to update the scopes of the renamed channel", "channel_id", channelID, "error", appErr.Error())
+		return
+	}
+
+	from, to := previousTeam+"/"+previousChannel, teamName+"/"+channelName
+	if strings.EqualFold(from, to) {
+		return
+	}
+	links := append([]autolink.Autolink{}, conf.Links...)
+	renamed := 0
+	for i := range links {
+		var scope []string
+		for _, s := range links[i].Scope {
+			if strings.EqualFold(s, from) {
+				s = to
+				renamed++
+			}
+			scope = append(scope, s)
+		}
+		links[i].Scope = scope
+	}
+	if renamed == 0 {
+		return
+	}
+	if err := p.SaveLinks(links); err != nil {
+		p.API.LogError("Failed to update the scopes of the renamed channel", "from", from, "to", to, "error", err.Error())
+		return
+	}
+	p.API.LogInfo("Updated the scopes of the renamed channel", "from", from, "to", to, "count", renamed)
+}
+
+// scopesChannel reports whether a link is scoped to a channel of the name in
+// any team.
+func scopesChannel(links []autolink.Autolink, channelName string) bool {
+	for _, link := range links {
+		for _, scope := range link.Scope {
+			split := strings.Split(scope, "/")
+			if len(split) == 2 && strings.EqualFold(split[1], channelName) {
+				return true
+			}
+		}
+	}
+	return false
+}
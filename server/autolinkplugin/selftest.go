@@ -0,0 +1,177 @@
+package autolinkplugin
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin"
+	"github.com/pkg/errors"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+// selfTestKey is the KV store key written, read back and deleted by
+// `/autolink selftest`. It expires after selfTestKeyLifetime in case it could
+// not be deleted.
+const (
+	selfTestKey         = "selftest"
+	selfTestKeyLifetime = time.Minute
+)
+
+// selfTestLink is the link rewriting the synthetic post of `/autolink
+// selftest`, whose text no other link should match.
+var selfTestLink = autolink.Autolink{
+	Name:     "selftest",
+	Pattern:  `(?P<id>AUTOLINK-SELFTEST-\d+)`,
+	Template: "[$id](https://example.com/$id)",
+}
+
+// selfTestStage is the outcome of a stage of `/autolink selftest`: a detail
+// of what was checked if it passed, or the error if it failed.
+type selfTestStage struct {
+	name   string
+	detail string
+	err    error
+}
+
+// selfTest checks each part of the plugin the links depend on, from loading
+// the configuration to rewriting a post in the channel, and returns the
+// outcome of each stage. The stages all run, for a single report to show
+// everything that is broken.
+func (p *Plugin) selfTest(header *model.CommandArgs) []selfTestStage {
+	conf := p.getConfig()
+	stages := []selfTestStage{}
+
+	config := selfTestStage{name: header.T("autolink.command.selftest.config")}
+	var loaded Config
+	if err := p.API.LoadPluginConfiguration(&loaded); err != nil {
+		config.err = err
+	} else if p.diagnostics.configErr() != "" {
+		config.err = errors.New(p.diagnostics.configErr())
+	} else {
+		config.detail = header.T("autolink.command.selftest.config_loaded", len(conf.Links))
+	}
+	stages = append(stages, config)
+
+	links := selfTestStage{name: header.T("autolink.command.selftest.links")}
+	enabled := 0
+	failed := []string{}
+	for i, l := range conf.Links {
+		if l.Disabled {
+			continue
+		}
+		enabled++
+		if i < len(conf.compileErrors) && conf.compileErrors[i] != nil {
+			failed = append(failed, l.DisplayName())
+		}
+	}
+	if len(failed) > 0 {
+		links.err = errors.Errorf(header.T("autolink.command.selftest.links_failed"), strings.Join(failed, ", "))
+	} else {
+		links.detail = header.T("autolink.command.selftest.links_compiled", enabled)
+	}
+	stages = append(stages, links)
+
+	// The channel and team are fetched, not taken from the cache, to check
+	// the access to them
+	scope := selfTestStage{name: header.T("autolink.command.selftest.scope")}
+	channelName, teamName := "", ""
+	channel, appErr := p.API.GetChannel(header.ChannelId)
+	if appErr == nil {
+		channelName = channel.Name
+		if channel.TeamId != "" {
+			var team *model.Team
+			if team, appErr = p.API.GetTeam(channel.TeamId); appErr == nil {
+				teamName = team.Name
+			}
+		}
+	}
+	if appErr != nil {
+		scope.err = appErr
+	} else {
+		scope.detail = header.T("autolink.command.selftest.scope_resolved", teamName, channelName)
+	}
+	stages = append(stages, scope)
+
+	rewrite := selfTestStage{name: header.T("autolink.command.selftest.rewrite")}
+	link := selfTestLink
+	if err := link.Compile(); err != nil {
+		rewrite.err = err
+	} else {
+		// The synthetic link is not timed, for it not to be reported as slow
+		rewriteConf := *conf
+		rewriteConf.SlowLinkThreshold = 0
+		post := &model.Post{
+			UserId:    header.UserId,
+			ChannelId: header.ChannelId,
+			Message:   "Self-test of AUTOLINK-SELFTEST-1",
+		}
+		result := p.rewriteMessage(post, &rewriteConf, []autolink.Autolink{link}, channelName, teamName,
+			func() *model.User { return nil }, func() (string, bool) { return "", false }, nil)
+		expected := "Self-test of [AUTOLINK-SELFTEST-1](https://example.com/AUTOLINK-SELFTEST-1)"
+		if result.message != expected {
+			rewrite.err = errors.Errorf(header.T("autolink.command.selftest.rewrite_failed"), expected, result.message)
+		} else {
+			rewrite.detail = header.T("autolink.command.selftest.rewrite_done")
+		}
+	}
+	stages = append(stages, rewrite)
+
+	kv := selfTestStage{name: header.T("autolink.command.selftest.kv")}
+	if err := p.selfTestKV(); err != nil {
+		kv.err = err
+	} else {
+		kv.detail = header.T("autolink.command.selftest.kv_done")
+	}
+	stages = append(stages, kv)
+
+	return stages
+}
+
+// selfTestKV writes a value to the KV store, reads it back and deletes it.
+func (p *Plugin) selfTestKV() error {
+	value := []byte(model.NewId())
+	if _, appErr := p.API.KVSetWithOptions(selfTestKey, value, model.PluginKVSetOptions{
+		ExpireInSeconds: int64(selfTestKeyLifetime / time.Second),
+	}); appErr != nil {
+		return errors.Wrap(appErr, "failed to write")
+	}
+	read, appErr := p.API.KVGet(selfTestKey)
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to read")
+	}
+	if !bytes.Equal(read, value) {
+		return errors.Errorf("read %q instead of %q", read, value)
+	}
+	if appErr = p.API.KVDelete(selfTestKey); appErr != nil {
+		return errors.Wrap(appErr, "failed to delete")
+	}
+	return nil
+}
+
+func executeSelfTest(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) != 0 {
+		return responsef(header.T("autolink.command.help"))
+	}
+
+	stages := p.selfTest(header)
+	out := ""
+	failed := 0
+	for _, stage := range stages {
+		if stage.err != nil {
+			failed++
+			out += fmt.Sprintf(header.T("autolink.command.selftest.failed"), stage.name, stage.err)
+			continue
+		}
+		out += fmt.Sprintf(header.T("autolink.command.selftest.passed"), stage.name, stage.detail)
+	}
+	if failed == 0 {
+		out += header.T("autolink.command.selftest.all_passed")
+	} else {
+		out += header.T("autolink.command.selftest.summary", failed, len(stages))
+	}
+	return responsef("%s", out)
+}
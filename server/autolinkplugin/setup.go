@@ -0,0 +1,324 @@
+package autolinkplugin
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin"
+	"github.com/pkg/errors"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+// Dialogs of the steps of `/autolink setup`, in order. A dialog submission
+// cannot open another dialog, so each step posts an ephemeral message with a
+// button opening the dialog of the next step.
+const (
+	setupDialogKind    = "setup-kind"
+	setupDialogPattern = "setup-pattern"
+	setupDialogScope   = "setup-scope"
+)
+
+// setupActionOpen is the action of the buttons opening the dialog of a step.
+const setupActionOpen = "setup"
+
+// Elements of the setup dialogs, other than the link fields.
+const (
+	setupElementKind   = "kind"
+	setupElementSample = "sample"
+	setupKindCustom    = "custom"
+)
+
+// setupState is the link being set up, passed from step to step in the
+// dialogs and buttons. Nothing is saved before the last step.
+type setupState struct {
+	Name     string            `json:"name"`
+	Preset   string            `json:"preset,omitempty"`
+	Values   map[string]string `json:"values,omitempty"`
+	Pattern  string            `json:"pattern,omitempty"`
+	Template string            `json:"template,omitempty"`
+	Sample   string            `json:"sample,omitempty"`
+}
+
+func (s setupState) link() autolink.Autolink {
+	return autolink.Autolink{Name: s.Name, Pattern: s.Pattern, Template: s.Template}
+}
+
+func executeSetup(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) != 0 {
+		return responsef(header.T("autolink.command.help"))
+	}
+	if err := p.openSetupDialog(header, header.TriggerId, setupDialogKind, setupState{}); err != nil {
+		return responsef(header.T("autolink.command.setup.failed"), err)
+	}
+	return &model.CommandResponse{}
+}
+
+// openSetupDialog opens the dialog of a step, filled with the state.
+func (p *Plugin) openSetupDialog(header *model.CommandArgs, triggerID, dialog string, state setupState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode the dialog state")
+	}
+
+	d := model.Dialog{
+		Title:       header.T("autolink.command.setup.title"),
+		SubmitLabel: header.T("autolink.command.setup.next"),
+		State:       string(data),
+	}
+	switch dialog {
+	case setupDialogKind:
+		options := []*model.PostActionOptions{{
+			Text:  header.T("autolink.command.setup.custom"),
+			Value: setupKindCustom,
+		}}
+		for _, preset := range autolink.Presets() {
+			options = append(options, &model.PostActionOptions{
+				Text:  preset.Name + " - " + preset.Description,
+				Value: preset.Name,
+			})
+		}
+		d.IntroductionText = header.T("autolink.command.setup.kind_intro")
+		d.Elements = []model.DialogElement{{
+			DisplayName: optName,
+			Name:        optName,
+			Type:        "text",
+			Default:     state.Name,
+		}, {
+			DisplayName: header.T("autolink.command.setup.kind"),
+			Name:        setupElementKind,
+			Type:        "select",
+			Default:     setupKindCustom,
+			Options:     options,
+		}}
+
+	case setupDialogPattern:
+		d.IntroductionText = header.T("autolink.command.setup.pattern_intro")
+		if preset, ok := autolink.GetPreset(state.Preset); ok {
+			for _, param := range preset.Params {
+				value := state.Values[param.Name]
+				if value == "" {
+					value = param.Default
+				}
+				d.Elements = append(d.Elements, model.DialogElement{
+					DisplayName: param.Name,
+					Name:        param.Name,
+					Type:        "text",
+					Default:     value,
+				})
+			}
+		} else {
+			d.Elements = []model.DialogElement{{
+				DisplayName: optPattern,
+				Name:        optPattern,
+				Type:        "textarea",
+				Default:     state.Pattern,
+				HelpText:    header.T("autolink.command.setup.pattern_help"),
+			}, {
+				DisplayName: optTemplate,
+				Name:        optTemplate,
+				Type:        "textarea",
+				Default:     state.Template,
+				HelpText:    header.T("autolink.command.setup.template_help"),
+			}}
+		}
+		d.Elements = append(d.Elements, model.DialogElement{
+			DisplayName: header.T("autolink.command.setup.sample"),
+			Name:        setupElementSample,
+			Type:        "textarea",
+			Default:     state.Sample,
+			HelpText:    header.T("autolink.command.setup.sample_help"),
+			Optional:    true,
+		})
+
+	case setupDialogScope:
+		d.IntroductionText = header.T("autolink.command.setup.scope_intro")
+		d.SubmitLabel = header.T("autolink.command.setup.create")
+		d.Elements = []model.DialogElement{{
+			DisplayName: optScope,
+			Name:        optScope,
+			Type:        "text",
+			HelpText:    header.T("autolink.command.manage.scope_help"),
+			Optional:    true,
+		}}
+
+	default:
+		return errors.Errorf("unknown dialog %q", dialog)
+	}
+
+	appErr := p.API.OpenInteractiveDialog(model.OpenDialogRequest{
+		TriggerId: triggerID,
+		URL:       manageDialogURL(dialog),
+		Dialog:    d,
+	})
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to open the dialog")
+	}
+	return nil
+}
+
+// sendSetupStep posts the outcome of a step, with the buttons opening the
+// dialogs of the next step, or of the previous one to change it.
+func (p *Plugin) sendSetupStep(header *model.CommandArgs, message, next, back string, state setupState) *model.SubmitDialogResponse {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return &model.SubmitDialogResponse{Error: err.Error()}
+	}
+	button := func(name, dialog string) *model.PostAction {
+		return &model.PostAction{
+			Type: model.PostActionTypeButton,
+			Name: name,
+			Integration: &model.PostActionIntegration{
+				URL:     manageActionURL(setupActionOpen),
+				Context: map[string]interface{}{"dialog": dialog, "state": string(data)},
+			},
+		}
+	}
+
+	post := &model.Post{ChannelId: header.ChannelId, Message: message}
+	model.ParseSlackAttachment(post, []*model.SlackAttachment{{
+		Actions: []*model.PostAction{
+			button(header.T("autolink.command.setup.continue"), next),
+			button(header.T("autolink.command.setup.back"), back),
+		},
+	}})
+	p.sendBotEphemeral(header.UserId, post)
+	return nil
+}
+
+// handleSetupAction opens the dialog of the step of the button.
+func (p *Plugin) handleSetupAction(header *model.CommandArgs, request *model.PostActionIntegrationRequest) *model.PostActionIntegrationResponse {
+	dialog, _ := request.Context["dialog"].(string)
+	data, _ := request.Context["state"].(string)
+	var state setupState
+	if err := json.Unmarshal([]byte(data), &state); err != nil {
+		return &model.PostActionIntegrationResponse{EphemeralText: "invalid setup state"}
+	}
+	if err := p.openSetupDialog(header, request.TriggerId, dialog, state); err != nil {
+		p.API.LogWarn("Failed to open the setup dialog", "error", err.Error())
+		return &model.PostActionIntegrationResponse{EphemeralText: err.Error()}
+	}
+	return &model.PostActionIntegrationResponse{}
+}
+
+// handleSetupDialog validates the step submitted, and posts the button
+// opening the next one. The link is saved by the last step.
+func (p *Plugin) handleSetupDialog(header *model.CommandArgs, dialog string, request *model.SubmitDialogRequest) *model.SubmitDialogResponse {
+	var state setupState
+	if err := json.Unmarshal([]byte(request.State), &state); err != nil {
+		return &model.SubmitDialogResponse{Error: "invalid dialog state"}
+	}
+	submitted := func(name string) string {
+		value, _ := request.Submission[name].(string)
+		return strings.TrimSpace(value)
+	}
+	exists := func(name string) bool {
+		for _, l := range p.GetLinks() {
+			if l.Name == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch dialog {
+	case setupDialogKind:
+		state.Name = submitted(optName)
+		if state.Name == "" {
+			return &model.SubmitDialogResponse{Errors: map[string]string{optName: header.T("autolink.command.setup.required")}}
+		}
+		if exists(state.Name) {
+			return &model.SubmitDialogResponse{Errors: map[string]string{optName: header.T("autolink.command.add_preset.exists", state.Name)}}
+		}
+		state.Preset = ""
+		if kind := submitted(setupElementKind); kind != setupKindCustom {
+			if _, ok := autolink.GetPreset(kind); !ok {
+				return &model.SubmitDialogResponse{Errors: map[string]string{setupElementKind: header.T("autolink.command.add_preset.not_found", kind)}}
+			}
+			state.Preset = kind
+		}
+		return p.sendSetupStep(header, header.T("autolink.command.setup.kind_done", state.Name),
+			setupDialogPattern, setupDialogKind, state)
+
+	case setupDialogPattern:
+		if preset, ok := autolink.GetPreset(state.Preset); ok {
+			state.Values = map[string]string{}
+			for _, param := range preset.Params {
+				if value := submitted(param.Name); value != "" {
+					state.Values[param.Name] = value
+				}
+			}
+			l, err := preset.Link(state.Values)
+			if err != nil {
+				return &model.SubmitDialogResponse{Error: err.Error()}
+			}
+			state.Pattern, state.Template = l.Pattern, l.Template
+		} else {
+			state.Pattern, state.Template = submitted(optPattern), submitted(optTemplate)
+			errs := map[string]string{}
+			if state.Pattern == "" {
+				errs[optPattern] = header.T("autolink.command.setup.required")
+			}
+			if state.Template == "" {
+				errs[optTemplate] = header.T("autolink.command.setup.required")
+			}
+			if len(errs) > 0 {
+				return &model.SubmitDialogResponse{Errors: errs}
+			}
+		}
+
+		l := state.link()
+		if err := l.Compile(); err != nil {
+			if state.Preset != "" {
+				return &model.SubmitDialogResponse{Error: err.Error()}
+			}
+			return &model.SubmitDialogResponse{Errors: map[string]string{optPattern: err.Error()}}
+		}
+		message := header.T("autolink.command.setup.pattern_done", l.ToMarkdown(0))
+		state.Sample = submitted(setupElementSample)
+		if state.Sample != "" {
+			replaced := l.Replace(state.Sample)
+			if replaced == state.Sample {
+				return &model.SubmitDialogResponse{Errors: map[string]string{setupElementSample: header.T("autolink.command.setup.no_match")}}
+			}
+			message += header.T("autolink.command.setup.sample_done", replaced)
+		}
+		return p.sendSetupStep(header, message, setupDialogScope, setupDialogPattern, state)
+
+	case setupDialogScope:
+		l := state.link()
+		l.Scope = strings.Fields(submitted(optScope))
+		isAdmin, err := p.IsAuthorizedAdmin(header.UserId)
+		if err != nil {
+			return &model.SubmitDialogResponse{Error: err.Error()}
+		}
+		if !isAdmin {
+			if ok, _ := p.IsAuthorizedTeamAdmin(header.UserId, l.ScopeTeams()); !ok {
+				return &model.SubmitDialogResponse{Errors: map[string]string{optScope: header.T("autolink.command.set.team_admin_scope")}}
+			}
+		}
+		scopeIssues := []string{}
+		for _, issue := range p.LintLinks([]autolink.Autolink{l}) {
+			if issue.Kind == autolink.LintScope {
+				scopeIssues = append(scopeIssues, issue.Message)
+			}
+		}
+		if len(scopeIssues) > 0 {
+			return &model.SubmitDialogResponse{Errors: map[string]string{optScope: strings.Join(scopeIssues, ", ")}}
+		}
+		if exists(l.Name) {
+			return &model.SubmitDialogResponse{Error: header.T("autolink.command.add_preset.exists", l.Name)}
+		}
+
+		if err = p.SaveLinks(append(append([]autolink.Autolink{}, p.GetLinks()...), l)); err != nil {
+			return &model.SubmitDialogResponse{Error: err.Error()}
+		}
+		p.sendBotEphemeral(header.UserId, &model.Post{
+			ChannelId: header.ChannelId,
+			Message:   header.T("autolink.command.setup.created", l.ToMarkdown(0)),
+		})
+		return nil
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package autolinkplugin
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin"
+	"github.com/pkg/errors"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/api"
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+	"github.com/mattermost/mattermost-plugin-autolink/server/importer"
+)
+
+// optIncludeDisabled simulates the disabled links too.
+const optIncludeDisabled = "--include-disabled"
+
+// maxSimulationFileSize is the maximum size in bytes of the channel export
+// `/autolink simulate` reads.
+const maxSimulationFileSize = 50 * 1024 * 1024
+
+// simulationFile returns the file to simulate the links against: the given
+// one, or the last file the user posted in the channel.
+func simulationFile(p *Plugin, header *model.CommandArgs, fileID string) (*model.FileInfo, error) {
+	if fileID == "" {
+		postList, appErr := p.API.GetPostsForChannel(header.ChannelId, 0, maxTestLastPosts)
+		if appErr != nil {
+			return nil, errors.Wrap(appErr, "failed to get the posts of the channel")
+		}
+		for _, id := range postList.Order {
+			if post := postList.Posts[id]; post != nil && post.UserId == header.UserId && len(post.FileIds) > 0 {
+				fileID = post.FileIds[len(post.FileIds)-1]
+				break
+			}
+		}
+		if fileID == "" {
+			return nil, errors.New(header.T("autolink.command.simulate.no_file"))
+		}
+	}
+
+	info, appErr := p.API.GetFileInfo(fileID)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to get the file")
+	}
+	// Only the files the user uploaded, for the command not to read the
+	// files of the channels they can not see
+	if info.CreatorId != header.UserId {
+		return nil, errors.New(header.T("autolink.command.simulate.not_yours"))
+	}
+	if info.Size > maxSimulationFileSize {
+		return nil, errors.New(header.T("autolink.command.simulate.too_large", maxSimulationFileSize/1024/1024))
+	}
+	return info, nil
+}
+
+// executeSimulate runs the links against the posts of a channel export, and
+// reports how many posts each link would have rewritten.
+func executeSimulate(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	includeDisabled := false
+	fileID := ""
+	for _, arg := range args {
+		switch {
+		case arg == optIncludeDisabled:
+			includeDisabled = true
+		case fileID == "" && !strings.HasPrefix(arg, "--"):
+			fileID = arg
+		default:
+			return responsef(header.T("autolink.command.help"))
+		}
+	}
+
+	info, err := simulationFile(p, header, fileID)
+	if err != nil {
+		return responsef(header.T("autolink.command.simulate.failed"), err)
+	}
+	data, appErr := p.API.GetFile(info.Id)
+	if appErr != nil {
+		return responsef(header.T("autolink.command.simulate.failed"), appErr)
+	}
+	messages, err := importer.ParseChannelExport(data)
+	if err != nil {
+		return responsef(header.T("autolink.command.simulate.failed"), err)
+	}
+
+	filter, err := linkFilter(p, header)
+	if err != nil {
+		return responsef("%v", err)
+	}
+	links := []autolink.Autolink{}
+	for _, link := range p.GetLinks() {
+		if filter == nil || filter(link) {
+			links = append(links, link)
+		}
+	}
+	simulation := api.SimulateLinks(links, messages, includeDisabled)
+	return responsef("%s", formatSimulation(header, info.Name, simulation))
+}
+
+// formatSimulation formats the report of a simulation as a table of the links,
+// those rewriting the most posts first.
+func formatSimulation(header *model.CommandArgs, fileName string, simulation api.Simulation) string {
+	out := header.T("autolink.command.simulate.summary", fileName, simulation.Posts, simulation.Rewritten)
+	linkSimulations := append([]api.LinkSimulation{}, simulation.Links...)
+	sort.SliceStable(linkSimulations, func(i, j int) bool {
+		return linkSimulations[i].Posts > linkSimulations[j].Posts
+	})
+	out += "| Link | Posts | Matches |\n|---|---|---|\n"
+	for _, ls := range linkSimulations {
+		name := escapeTableCell(ls.Name)
+		if ls.Disabled {
+			name += header.T("autolink.command.simulate.disabled")
+		}
+		percent := 0.0
+		if simulation.Posts > 0 {
+			percent = 100 * float64(ls.Posts) / float64(simulation.Posts)
+		}
+		out += fmt.Sprintf("| %s | %d (%.1f%%) | %d |\n", name, ls.Posts, percent, ls.Matches)
+	}
+	if len(simulation.Failed) > 0 {
+		out += header.T("autolink.command.benchmark.failed", strings.Join(simulation.Failed, ", "))
+	}
+	return out
+}
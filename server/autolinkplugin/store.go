@@ -0,0 +1,409 @@
+package autolinkplugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+	"github.com/mattermost/mattermost-plugin-autolink/server/enrich"
+)
+
+// linksKey is the KV store key holding the links, as a JSON list.
+const linksKey = "links"
+
+// importAttempts is how many times importing the links of the configuration
+// is retried when another server of the cluster changes the links meanwhile.
+const importAttempts = 3
+
+// storeAttempts is how many times saving the links in the KV store is
+// attempted when the KV store fails, waiting storeRetryDelay before the second
+// attempt and twice as long before each next one.
+const storeAttempts = 3
+
+var storeRetryDelay = 100 * time.Millisecond
+
+// errLinksChanged is returned when saving links that were changed by someone
+// else since they were loaded.
+var errLinksChanged = errors.New("the links were changed by someone else, please try again")
+
+// loadLinks returns the links saved in the KV store. The links saved by older
+// versions of the plugin are migrated, and the links of the configuration are
+// imported, replacing the saved links with the same name, and then removed
+// from the configuration. If new or changed links of the configuration are
+// invalid, none are imported, and the saved links are returned along with the
+// autolink.ValidationErrors, the links being kept in the configuration for
+// the admin to fix them. The link entries of the configuration are imported
+// along with its links.
+func (p *Plugin) loadLinks(c *Config) ([]autolink.Autolink, error) {
+	fromVersion := c.SchemaVersion
+	if fromVersion > currentSchemaVersion {
+		p.API.LogWarn("The links were saved by a newer version of the plugin", "schema_version", fromVersion)
+	}
+	if err := migrateConfigLinks(c); err != nil {
+		return nil, err
+	}
+	imported := append(append([]autolink.Autolink{}, c.Links...), c.entryLinks...)
+
+	for attempt := 0; ; attempt++ {
+		links, migrated, err := p.readLinks(c)
+		if err != nil {
+			return nil, err
+		}
+		if len(imported) == 0 && len(c.deletedLinks) == 0 && !migrated {
+			p.saveSchemaVersion(c)
+			return links, nil
+		}
+		if errs := validateChanged(links, imported); len(errs) > 0 {
+			return links, errors.Wrap(errs, "the links of the configuration were not imported")
+		}
+		remaining, err := deleteEntryLinks(links, c.deletedLinks)
+		if err != nil {
+			return links, errors.Wrap(err, "the links of the configuration were not imported")
+		}
+
+		links = mergeLinks(remaining, imported)
+		err = p.storeLinks(c, links)
+		if err == errLinksChanged && attempt+1 < importAttempts {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to save the migrated and imported links")
+		}
+
+		if migrated {
+			p.API.LogInfo("Migrated the links", "from", fromVersion, "to", currentSchemaVersion)
+		}
+		if len(imported) == 0 && len(c.deletedLinks) == 0 {
+			p.saveSchemaVersion(c)
+			return links, nil
+		}
+
+		p.API.LogInfo("Imported the links of the configuration", "count", len(imported))
+		if c.SchemaVersion < currentSchemaVersion {
+			c.SchemaVersion = currentSchemaVersion
+		}
+		if err = p.removeConfigLinks(c); err != nil {
+			p.API.LogError("Failed to remove the imported links from the configuration", "error", err.Error())
+		}
+		return links, nil
+	}
+}
+
+// readLinks returns the links saved in the KV store, migrated from the schema
+// version of c, and whether they were migrated.
+func (p *Plugin) readLinks(c *Config) ([]autolink.Autolink, bool, error) {
+	data, appErr := p.API.KVGet(linksKey)
+	if appErr != nil {
+		return nil, false, errors.Wrap(appErr, "failed to get the links")
+	}
+	migratedData, migrated, err := migrateLinks(data, c.SchemaVersion)
+	if err != nil {
+		return nil, false, err
+	}
+	links := []autolink.Autolink{}
+	if migratedData != nil {
+		if err := json.Unmarshal(migratedData, &links); err != nil {
+			return nil, false, errors.Wrap(err, "failed to decode the links")
+		}
+	}
+	c.linksData = data
+	return links, migrated, nil
+}
+
+// mergeLinks replaces the links with the same name as an imported link, and
+// appends the other imported links.
+func mergeLinks(links, imported []autolink.Autolink) []autolink.Autolink {
+	merged := append([]autolink.Autolink{}, links...)
+	for _, link := range imported {
+		replaced := false
+		for i := range merged {
+			if link.Name != "" && merged[i].Name == link.Name {
+				merged[i] = link
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged = append(merged, link)
+		}
+	}
+	return merged
+}
+
+// deleteEntryLinks returns the links without the links with the deleted names.
+// It fails if a deleted link does not exist or is owned by a plugin.
+func deleteEntryLinks(links []autolink.Autolink, deleted []string) ([]autolink.Autolink, error) {
+	if len(deleted) == 0 {
+		return links, nil
+	}
+	remaining := make([]autolink.Autolink, 0, len(links))
+	found := map[string]bool{}
+	for _, link := range links {
+		del := false
+		for _, name := range deleted {
+			if link.Name == name {
+				del = true
+				break
+			}
+		}
+		if !del {
+			remaining = append(remaining, link)
+			continue
+		}
+		if link.PluginID != "" {
+			return nil, errors.Errorf("link %q is owned by plugin %q and can not be deleted", link.Name, link.PluginID)
+		}
+		found[link.Name] = true
+	}
+	for _, name := range deleted {
+		if !found[name] {
+			return nil, errors.Errorf("link %q to delete does not exist", name)
+		}
+	}
+	return remaining, nil
+}
+
+// storeLinks saves the links in the KV store, unless they were changed since
+// c was loaded. Failures of the KV store are retried with a backoff.
+func (p *Plugin) storeLinks(c *Config, links []autolink.Autolink) error {
+	data, err := json.Marshal(links)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode the links")
+	}
+
+	delay := storeRetryDelay
+	for attempt := 1; ; attempt++ {
+		saved, appErr := p.API.KVSetWithOptions(linksKey, data, model.PluginKVSetOptions{
+			Atomic:   true,
+			OldValue: c.linksData,
+		})
+		if appErr == nil && !saved && attempt > 1 {
+			// The failed attempt may have saved the links anyway
+			current, getErr := p.API.KVGet(linksKey)
+			saved = getErr == nil && bytes.Equal(current, data)
+		}
+		if appErr == nil {
+			if !saved {
+				return errLinksChanged
+			}
+			c.linksData = data
+			return nil
+		}
+		if attempt == storeAttempts {
+			return errors.Wrap(appErr, "failed to save the links")
+		}
+		p.API.LogWarn("Failed to save the links, retrying", "attempt", attempt, "error", appErr.Error())
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// removeConfigLinks saves the plugin configuration without its links and link
+// entries.
+func (p *Plugin) removeConfigLinks(c *Config) error {
+	withoutLinks := *c
+	withoutLinks.Links = nil
+	withoutLinks.LinkEntries = ""
+	configMap, err := withoutLinks.ToMap()
+	if err != nil {
+		return errors.Wrap(err, "unable to convert config to map")
+	}
+	if appErr := p.API.SavePluginConfig(configMap); appErr != nil {
+		return errors.Wrap(appErr, "unable to save the configuration")
+	}
+	c.LinkEntries = ""
+	return nil
+}
+
+// setLinks compiles the links and sets them as the links of c. The links that
+// did not change since the previous configuration are not compiled again,
+// unless the variables or the pattern fragments changed.
+func (p *Plugin) setLinks(c *Config, links []autolink.Autolink, previous *Config) {
+	if previous != nil && (!equalVariables(previous.variables, c.variables) || !equalVariables(previous.fragments, c.fragments)) {
+		previous = nil
+	}
+	compiled := newCompiledLinks(previous)
+	enrichCaches := p.newLinkEnrichCaches()
+	c.Links = append([]autolink.Autolink{}, links...)
+	c.scopeIndex = newScopeIndex()
+	c.compileErrors = make([]error, len(links))
+	for i := range c.Links {
+		if j := compiled.find(c.Links[i], i); j >= 0 {
+			c.Links[i] = previous.Links[j]
+			if j < len(previous.compileErrors) {
+				c.compileErrors[i] = previous.compileErrors[j]
+			}
+		} else {
+			// A changed link may no longer be slow
+			p.diagnostics.forgetDurations(c.Links[i].DisplayName())
+			c.Links[i].SetVariables(c.variables)
+			c.Links[i].SetPatternFragments(c.fragments)
+			if err := c.Links[i].Compile(); err != nil {
+				p.API.LogError("Error creating autolinker", "link", c.Links[i], "error", err.Error())
+				c.compileErrors[i] = err
+			}
+		}
+
+		// The enrichment configuration may have changed
+		c.Links[i].SetEnricher(nil)
+		var enricher enrich.Enricher
+		switch c.Links[i].Enrich {
+		case "":
+			continue
+		case enrichJira:
+			if c.jira == nil {
+				p.API.LogWarn("Jira enrichment is not configured", "link", c.Links[i].DisplayName())
+				continue
+			}
+			enricher = c.jira
+		case enrichCVE:
+			if c.cve == nil {
+				p.API.LogWarn("CVE enrichment is not configured", "link", c.Links[i].DisplayName())
+				continue
+			}
+			enricher = c.cve
+		default:
+			p.API.LogWarn("Unknown enrichment", "link", c.Links[i].DisplayName(), "enrich", c.Links[i].Enrich)
+			continue
+		}
+		if cache := enrichCaches.get(c.Links[i]); cache != nil {
+			enricher = enrich.NewCached(enricher, cache)
+		}
+		c.Links[i].SetEnricher(enricher)
+	}
+	p.setEnrichCaches(enrichCaches.kept)
+}
+
+// equalVariables reports whether both sets of variables, or of pattern
+// fragments, have the same values.
+func equalVariables(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, value := range a {
+		if v, ok := b[name]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// compiledLinks are the compiled links of a configuration, by pattern.
+type compiledLinks struct {
+	conf      *Config
+	byPattern map[string][]int
+}
+
+func newCompiledLinks(conf *Config) compiledLinks {
+	compiled := compiledLinks{conf: conf, byPattern: map[string][]int{}}
+	if conf == nil {
+		return compiled
+	}
+	for i, link := range conf.Links {
+		compiled.byPattern[link.Pattern] = append(compiled.byPattern[link.Pattern], i)
+	}
+	return compiled
+}
+
+// find returns the index of the compiled link equal to link, or -1 if there
+// is none. It looks first at the same index i, where the link is unless links
+// were added or removed before it.
+func (cl compiledLinks) find(link autolink.Autolink, i int) int {
+	if cl.conf == nil {
+		return -1
+	}
+	if i < len(cl.conf.Links) && cl.conf.Links[i].Equals(link) {
+		return i
+	}
+	for _, j := range cl.byPattern[link.Pattern] {
+		if cl.conf.Links[j].Equals(link) {
+			return j
+		}
+	}
+	return -1
+}
+
+func (p *Plugin) GetLinks() []autolink.Autolink {
+	p.confLock.RLock()
+	defer p.confLock.RUnlock()
+
+	return p.conf.Links
+}
+
+// SaveLinks saves the links in the KV store and applies them. It fails if the
+// links were changed by someone else since they were loaded, the current links
+// are then loaded for the next attempt. It also fails with
+// autolink.ValidationErrors if new or changed links are invalid, links that
+// were already saved are kept as they are.
+//
+// The links are only applied once they are saved, so that the links in
+// memory are left as they were when saving them fails. Concurrent saves are
+// made one after the other, and the links keep being processed with the
+// current links while they are saved.
+func (p *Plugin) SaveLinks(links []autolink.Autolink) error {
+	p.saveLock.Lock()
+	defer p.saveLock.Unlock()
+
+	c := *p.getConfig()
+	loaded := c.linksData
+	if errs := validateChanged(c.Links, links); len(errs) > 0 {
+		return errs
+	}
+	err := p.storeLinks(&c, links)
+	if err == errLinksChanged {
+		current, _, readErr := p.readLinks(&c)
+		if readErr != nil {
+			return readErr
+		}
+		p.applyLinks(loaded, c.linksData, current)
+		return err
+	}
+	if err != nil {
+		return errors.Wrap(err, "unable to save links")
+	}
+	p.applyLinks(loaded, c.linksData, links)
+	p.publishClusterEvent(clusterEventLinksChanged, nil, model.PluginClusterEventSendTypeReliable)
+	return nil
+}
+
+// applyLinks sets the links saved as data in the KV store as the links of the
+// configuration, unless the configuration was meanwhile reloaded with other
+// links than those loaded before saving them, which are then more recent.
+func (p *Plugin) applyLinks(loaded, data []byte, links []autolink.Autolink) {
+	p.confLock.Lock()
+	defer p.confLock.Unlock()
+
+	if !bytes.Equal(p.conf.linksData, loaded) && !bytes.Equal(p.conf.linksData, data) {
+		return
+	}
+	c := *p.conf
+	c.linksData = data
+	p.setLinks(&c, links, p.conf)
+	p.conf = &c
+}
+
+// validateChanged validates the links that are not in current.
+func validateChanged(current, links []autolink.Autolink) autolink.ValidationErrors {
+	var errs autolink.ValidationErrors
+	for i, link := range links {
+		unchanged := false
+		for _, c := range current {
+			if c.Equals(link) {
+				unchanged = true
+				break
+			}
+		}
+		if unchanged {
+			continue
+		}
+		for _, e := range autolink.Validate([]autolink.Autolink{link}) {
+			e.Index = i
+			errs = append(errs, e)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,773 @@
+package autolinkplugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin"
+	"github.com/mattermost/mattermost-server/v6/plugin/plugintest"
+	"github.com/mattermost/mattermost-server/v6/plugin/plugintest/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+// mockLinksStore keeps the links saved to the KV store of api in memory, and
+// accepts the configuration being saved without them once imported, and its
+// changes being logged. It must be called before mocking other KV store
+// calls.
+func mockLinksStore(api *plugintest.API) *[]byte {
+	var data []byte
+	api.On("KVGet", linksKey).Return(func(string) []byte {
+		return data
+	}, nil)
+	api.On("KVSetWithOptions", linksKey, mock.Anything, mock.AnythingOfType("model.PluginKVSetOptions")).Return(
+		func(_ string, value []byte, options model.PluginKVSetOptions) bool {
+			if !bytes.Equal(options.OldValue, data) {
+				return false
+			}
+			data = value
+			return true
+		}, nil)
+	api.On("LogInfo", "Imported the links of the configuration", "count", mock.AnythingOfType("int"))
+	api.On("LogInfo", "Configuration changed", "links_added", mock.AnythingOfType("string"),
+		"links_removed", mock.AnythingOfType("string"), "links_changed", mock.AnythingOfType("string"),
+		"settings_changed", mock.AnythingOfType("string"))
+	api.On("SavePluginConfig", mock.AnythingOfType("map[string]interface {}")).Return(nil)
+	api.On("PublishPluginClusterEvent", mock.AnythingOfType("model.PluginClusterEvent"),
+		mock.AnythingOfType("model.PluginClusterEventSendOptions")).Return(nil)
+	return &data
+}
+
+func savedLinks(t *testing.T, data []byte) []autolink.Autolink {
+	var links []autolink.Autolink
+	require.NoError(t, json.Unmarshal(data, &links))
+	return links
+}
+
+func TestImportConfigLinks(t *testing.T) {
+	conf := Config{
+		Links: []autolink.Autolink{
+			{Name: "updated", Pattern: "new", Template: "new"},
+			{Name: "added", Pattern: "added", Template: "added"},
+		},
+	}
+	api := &plugintest.API{}
+	data := mockLinksStore(api)
+	*data, _ = json.Marshal([]autolink.Autolink{
+		{Name: "kept", Pattern: "kept", Template: "kept"},
+		{Name: "updated", Pattern: "old", Template: "old"},
+	})
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	expected := []autolink.Autolink{
+		{Name: "kept", Pattern: "kept", Template: "kept"},
+		{Name: "updated", Pattern: "new", Template: "new"},
+		{Name: "added", Pattern: "added", Template: "added"},
+	}
+	assert.Equal(t, expected, savedLinks(t, *data))
+	require.Len(t, p.GetLinks(), 3)
+	for i, link := range p.GetLinks() {
+		assert.True(t, link.Equals(expected[i]))
+	}
+
+	api.AssertCalled(t, "SavePluginConfig", mock.MatchedBy(func(configMap map[string]interface{}) bool {
+		return configMap["links"] == nil
+	}))
+}
+
+func TestImportInvalidConfigLinks(t *testing.T) {
+	conf := Config{
+		Links: []autolink.Autolink{
+			{Name: "kept", Pattern: "kept", Template: "kept"},
+			{Name: "invalid", Pattern: "(a", Template: "a"},
+			{Name: "group", Pattern: "(?P<id>\\d+)", Template: "${key}"},
+		},
+	}
+	api := &plugintest.API{}
+	data := mockLinksStore(api)
+	*data, _ = json.Marshal([]autolink.Autolink{
+		{Name: "kept", Pattern: "kept", Template: "kept"},
+	})
+	stored := string(*data)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("LogError", "Failed to load the links", "error", mock.AnythingOfType("string"))
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	assert.Equal(t, stored, string(*data), "invalid links are not imported")
+	api.AssertNotCalled(t, "SavePluginConfig", mock.Anything)
+	require.Len(t, p.GetLinks(), 1)
+	assert.Equal(t, "kept", p.GetLinks()[0].Name)
+
+	configError := p.Status().ConfigError
+	assert.Contains(t, configError, `link "invalid"`)
+	assert.Contains(t, configError, `link "group"`)
+	assert.NotContains(t, configError, `link "kept"`)
+}
+
+func TestImportLinkEntries(t *testing.T) {
+	for name, tc := range map[string]struct {
+		entries       string
+		expected      []string
+		expectedError string
+	}{
+		"added, updated and deleted": {
+			entries: "# Jira\nName: updated\nPattern: (?P<key>MM-\\d+)\nTemplate: $key\nWordMatch: true\nScope: team1 team2/town-square\n\n" +
+				"Name: added\nPattern: added\nTemplate: added\nMaxReplacements: 2\n\nName: deleted\nDelete: true\n",
+			expected: []string{"kept", "updated", "added"},
+		},
+		"errors replaced": {
+			entries:  "# ERROR: invalid link entries: line 1: unknown field\nName: added\nPattern: added\nTemplate: added",
+			expected: []string{"kept", "updated", "deleted", "added"},
+		},
+		"unknown field": {
+			entries:       "Name: added\nPatern: added",
+			expectedError: `line 2: unknown field "Patern"`,
+		},
+		"invalid value": {
+			entries:       "Name: added\nWordMatch: maybe",
+			expectedError: `line 2: invalid WordMatch: "maybe", must be true or false`,
+		},
+		"no name": {
+			entries:       "Name: added\nPattern: added\n\n\nPattern: other",
+			expectedError: "line 5: the link has no Name",
+		},
+		"duplicate name": {
+			entries:       "Name: added\n\nName: added",
+			expectedError: `line 3: link "added" is listed more than once`,
+		},
+		"invalid link": {
+			entries:       "Name: added\nPattern: (a\nTemplate: a",
+			expectedError: `link "added"`,
+		},
+		"unknown deleted link": {
+			entries:       "Name: unknown\nDelete: true",
+			expectedError: `link "unknown" to delete does not exist`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			conf := Config{LinkEntries: tc.entries}
+			api := &plugintest.API{}
+			data := mockLinksStore(api)
+			*data, _ = json.Marshal([]autolink.Autolink{
+				{Name: "kept", Pattern: "kept", Template: "kept"},
+				{Name: "updated", Pattern: "old", Template: "old"},
+				{Name: "deleted", Pattern: "deleted", Template: "deleted"},
+			})
+			stored := string(*data)
+			api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+				*dest.(*Config) = conf
+				return nil
+			})
+			api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+			api.On("LogError", mock.AnythingOfType("string"), "error", mock.AnythingOfType("string"))
+
+			p := New()
+			p.SetAPI(api)
+			require.NoError(t, p.OnConfigurationChange())
+
+			if tc.expectedError != "" {
+				assert.Equal(t, stored, string(*data), "no link is imported")
+				assert.Contains(t, p.Status().ConfigError, tc.expectedError)
+				api.AssertCalled(t, "SavePluginConfig", mock.MatchedBy(func(configMap map[string]interface{}) bool {
+					entries, _ := configMap["linkentries"].(string)
+					return strings.HasPrefix(entries, "# ERROR: ") && strings.Contains(entries, tc.expectedError) &&
+						strings.HasSuffix(entries, tc.entries)
+				}))
+				return
+			}
+
+			var names []string
+			for _, link := range savedLinks(t, *data) {
+				names = append(names, link.Name)
+			}
+			assert.Equal(t, tc.expected, names)
+			assert.Empty(t, p.Status().ConfigError)
+			api.AssertCalled(t, "SavePluginConfig", mock.MatchedBy(func(configMap map[string]interface{}) bool {
+				return configMap["linkentries"] == ""
+			}))
+		})
+	}
+
+	links, _, err := parseLinkEntries("Name: updated\nPattern: (?P<key>MM-\\d+)\nTemplate: $key\nWordMatch: true\nScope: team1 team2/town-square\nCases: [{\"Match\": \"MM-1\", \"Template\": \"first\"}]")
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, `(?P<key>MM-\d+)`, links[0].Pattern)
+	assert.True(t, links[0].WordMatch)
+	assert.Equal(t, []string{"team1", "team2/town-square"}, links[0].Scope)
+	require.Len(t, links[0].Cases, 1)
+	assert.Equal(t, "first", links[0].Cases[0].Template)
+}
+
+func TestMigrateLinks(t *testing.T) {
+	conf := Config{
+		Links: []autolink.Autolink{
+			{Name: "imported", Pattern: "c", Template: "d", Scope: []string{"team/~town-square"}},
+		},
+	}
+	api := &plugintest.API{}
+	data := mockLinksStore(api)
+	*data = []byte(`[
+		{"Name": "string scope", "Pattern": "a", "Template": "b", "Scope": "team/~town-square, other", "MaxReplacements": 10000000},
+		{"Name": "lowercase", "Pattern": "a", "Template": "b", "scope": ["team / chan"]},
+		{"Name": "current", "Pattern": "a", "Template": "b", "Scope": ["team/chan", "other"]}
+	]`)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("LogInfo", "Migrated the links", "from", 0, "to", currentSchemaVersion)
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	links := savedLinks(t, *data)
+	require.Len(t, links, 4)
+	assert.Equal(t, []string{"team/town-square", "other"}, links[0].Scope)
+	assert.Equal(t, 10000000, links[0].MaxReplacements)
+	assert.Equal(t, []string{"team/chan"}, links[1].Scope)
+	assert.Equal(t, []string{"team/chan", "other"}, links[2].Scope)
+	assert.Equal(t, []string{"team/town-square"}, links[3].Scope)
+	api.AssertCalled(t, "SavePluginConfig", mock.MatchedBy(func(configMap map[string]interface{}) bool {
+		return configMap["schemaversion"] == float64(currentSchemaVersion) && configMap["links"] == nil
+	}))
+
+	t.Run("current version", func(t *testing.T) {
+		conf = Config{SchemaVersion: currentSchemaVersion}
+		*data = []byte(`[{"Name": "kept", "Pattern": "a", "Template": "b", "Scope": ["team/~chan"]}]`)
+		require.NoError(t, p.OnConfigurationChange())
+		assert.Equal(t, `[{"Name": "kept", "Pattern": "a", "Template": "b", "Scope": ["team/~chan"]}]`, string(*data))
+		api.AssertNumberOfCalls(t, "SavePluginConfig", 1)
+	})
+}
+
+func TestSaveLinks(t *testing.T) {
+	api := &plugintest.API{}
+	data := mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(nil)
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+	assert.Empty(t, p.GetLinks())
+
+	links := []autolink.Autolink{{Name: "first", Pattern: "a", Template: "b"}}
+	require.NoError(t, p.SaveLinks(links))
+	assert.Equal(t, links, savedLinks(t, *data))
+	require.Len(t, p.GetLinks(), 1)
+	assert.Equal(t, "b", p.GetLinks()[0].Replace("a"), "saved links are compiled")
+	api.AssertNotCalled(t, "SavePluginConfig", mock.Anything)
+
+	t.Run("concurrent change", func(t *testing.T) {
+		*data, _ = json.Marshal([]autolink.Autolink{{Name: "other", Pattern: "c", Template: "d"}})
+
+		err := p.SaveLinks([]autolink.Autolink{{Name: "second", Pattern: "e", Template: "f"}})
+		assert.Equal(t, errLinksChanged, err)
+		require.Len(t, p.GetLinks(), 1)
+		assert.Equal(t, "other", p.GetLinks()[0].Name, "the current links are loaded")
+
+		require.NoError(t, p.SaveLinks(append(p.GetLinks(), autolink.Autolink{Name: "second", Pattern: "e", Template: "f"})))
+		assert.Len(t, savedLinks(t, *data), 2)
+	})
+
+	t.Run("invalid links", func(t *testing.T) {
+		api.On("LogError", "Error creating autolinker", "link", mock.Anything, "error", mock.AnythingOfType("string"))
+		*data, _ = json.Marshal([]autolink.Autolink{{Name: "legacy", Pattern: "(", Template: "x"}})
+		require.Equal(t, errLinksChanged, p.SaveLinks(nil))
+
+		err := p.SaveLinks(append(p.GetLinks(), autolink.Autolink{Name: "broken", Pattern: "g", Template: "$key"}))
+		require.IsType(t, autolink.ValidationErrors{}, err)
+		assert.Equal(t, 1, err.(autolink.ValidationErrors)[0].Index)
+		assert.Len(t, savedLinks(t, *data), 1)
+
+		require.NoError(t, p.SaveLinks(append(p.GetLinks(), autolink.Autolink{Name: "third", Pattern: "g", Template: "h"})),
+			"links that were already saved are not validated")
+	})
+}
+
+// failBeforeLinksStore moves the call just mocked, the last one, first, for it
+// to be matched before the links store of mockLinksStore.
+func failBeforeLinksStore(api *plugintest.API, call *mock.Call) {
+	api.ExpectedCalls = append([]*mock.Call{call}, api.ExpectedCalls[:len(api.ExpectedCalls)-1]...)
+}
+
+func TestSaveLinksFailures(t *testing.T) {
+	defer func(delay time.Duration) { storeRetryDelay = delay }(storeRetryDelay)
+	storeRetryDelay = 0
+
+	api := &plugintest.API{}
+	kvErr := &model.AppError{Message: "database unavailable"}
+	// The first save fails twice before succeeding, the second one fails
+	// every attempt
+	api.On("KVSetWithOptions", linksKey, mock.Anything, mock.AnythingOfType("model.PluginKVSetOptions")).Return(false, kvErr).Twice()
+	data := mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(nil)
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("LogWarn", "Failed to save the links, retrying", "attempt", mock.AnythingOfType("int"), "error", mock.AnythingOfType("string"))
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	links := []autolink.Autolink{{Name: "first", Pattern: "a", Template: "b"}}
+	require.NoError(t, p.SaveLinks(links))
+	assert.Equal(t, links, savedLinks(t, *data))
+	require.Len(t, p.GetLinks(), 1)
+	api.AssertNumberOfCalls(t, "LogWarn", 2)
+
+	t.Run("failed attempt saved the links", func(t *testing.T) {
+		saved := append(p.GetLinks(), autolink.Autolink{Name: "second", Pattern: "c", Template: "d"})
+		failBeforeLinksStore(api, api.On("KVSetWithOptions", linksKey, mock.Anything, mock.AnythingOfType("model.PluginKVSetOptions")).Return(
+			func(_ string, value []byte, _ model.PluginKVSetOptions) bool {
+				*data = value
+				return false
+			}, kvErr).Once())
+
+		require.NoError(t, p.SaveLinks(saved))
+		assert.Len(t, p.GetLinks(), 2)
+	})
+
+	t.Run("failed save", func(t *testing.T) {
+		failBeforeLinksStore(api, api.On("KVSetWithOptions", linksKey, mock.Anything, mock.AnythingOfType("model.PluginKVSetOptions")).Return(
+			false, kvErr).Times(storeAttempts))
+		before := *data
+
+		err := p.SaveLinks(nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "database unavailable")
+		assert.Len(t, p.GetLinks(), 2, "the links in memory are kept")
+		assert.Equal(t, before, *data)
+
+		require.NoError(t, p.SaveLinks(nil), "the next save starts from the links in memory")
+		assert.Empty(t, p.GetLinks())
+	})
+}
+
+func TestIncrementalCompile(t *testing.T) {
+	api := &plugintest.API{}
+	data := mockLinksStore(api)
+	*data, _ = json.Marshal([]autolink.Autolink{
+		{Name: "broken", Pattern: "(", Template: "x"},
+		{Name: "ok", Pattern: "a", Template: "b"},
+	})
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(nil)
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("LogError", "Error creating autolinker", "link", mock.Anything, "error", mock.AnythingOfType("string"))
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+	require.NoError(t, p.OnConfigurationChange())
+	api.AssertNumberOfCalls(t, "LogError", 1)
+
+	links := p.GetLinks()
+	require.Len(t, links, 2)
+	assert.Error(t, p.getConfig().compileErrors[0], "compile errors are kept")
+	assert.Equal(t, "b", links[1].Replace("a"), "unchanged links stay compiled")
+
+	// Links moved by an insertion are reused too
+	require.NoError(t, p.SaveLinks(append([]autolink.Autolink{{Name: "new", Pattern: "c", Template: "d"}}, links...)))
+	api.AssertNumberOfCalls(t, "LogError", 1)
+	links = p.GetLinks()
+	require.Len(t, links, 3)
+	assert.Error(t, p.getConfig().compileErrors[1])
+	assert.Equal(t, "d b", links[0].Replace(links[2].Replace("c a")))
+}
+
+func TestListPages(t *testing.T) {
+	conf := Config{}
+	for i := 0; i < 25; i++ {
+		conf.Links = append(conf.Links, autolink.Autolink{
+			Name:     fmt.Sprintf("link%02d", i),
+			Pattern:  "a",
+			Template: "b",
+		})
+	}
+
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", "admin").Return(&model.User{Roles: "system_admin system_user"}, nil)
+	api.On("LogInfo", mock.AnythingOfType("string"))
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	list := func(command string) string {
+		resp, appErr := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{
+			UserId:  "admin",
+			Command: command,
+		})
+		require.Nil(t, appErr)
+		return resp.Text
+	}
+
+	text := list("/autolink list")
+	assert.Contains(t, text, "link19")
+	assert.NotContains(t, text, "link20")
+	assert.Contains(t, text, "Page 1 of 2, 25 links.")
+
+	text = list("/autolink list --page 2")
+	assert.NotContains(t, text, "link19")
+	assert.Contains(t, text, "- 21: link20")
+	assert.Contains(t, text, "Page 2 of 2, 25 links.")
+
+	text = list("/autolink list link0 --page 1")
+	assert.Contains(t, text, "link09")
+	assert.NotContains(t, text, "Page")
+
+	assert.Equal(t, `"3" is not a valid page number`, list("/autolink list --page 3"))
+
+	text = list("/autolink search LINK1")
+	assert.Contains(t, text, "- 11: link10")
+	assert.NotContains(t, text, "link09")
+	assert.Contains(t, list("/autolink search --regex ^link2[34]$"), "- 24: link23\n")
+	assert.Equal(t, "No links found.", list("/autolink search --regex ^link2$"))
+}
+
+func TestListFilters(t *testing.T) {
+	conf := Config{}
+	for i := 0; i < 30; i++ {
+		l := autolink.Autolink{
+			Name:     fmt.Sprintf("link%02d", i),
+			Pattern:  "a",
+			Template: "b",
+			Disabled: i%2 == 1,
+		}
+		if i == 2 {
+			l.Tags = []string{"jira", "deprecated"}
+		}
+		switch i % 3 {
+		case 0:
+			l.Scope = []string{"Team1/town-square"}
+			l.Group = "jira"
+		case 1:
+			l.Scope = []string{"team2"}
+		}
+		conf.Links = append(conf.Links, l)
+	}
+
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", "admin").Return(&model.User{Roles: "system_admin system_user"}, nil)
+	api.On("LogInfo", mock.AnythingOfType("string"))
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	list := func(command string) string {
+		resp, appErr := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{
+			UserId:  "admin",
+			Command: command,
+		})
+		require.Nil(t, appErr)
+		return resp.Text
+	}
+
+	text := list("/autolink list --scope team1")
+	assert.Contains(t, text, "- 1: link00")
+	assert.Contains(t, text, "- 28: ~~link27~~")
+	assert.NotContains(t, text, "link01")
+	assert.NotContains(t, text, "Page", "the 10 links fit in a page")
+	assert.Equal(t, text, list("/autolink list --scope team1/Town-Square"))
+	assert.Equal(t, "No links found.", list("/autolink list --scope team1/off-topic"))
+
+	text = list("/autolink list --group jira --disabled")
+	assert.Contains(t, text, "link03")
+	assert.NotContains(t, text, "link00")
+	assert.NotContains(t, text, "link01")
+
+	text = list("/autolink list --tag Deprecated")
+	assert.Contains(t, text, "link02")
+	assert.NotContains(t, text, "link03")
+	assert.Equal(t, text, list("/autolink search --tag deprecated link"))
+
+	text = list("/autolink list --enabled")
+	assert.Contains(t, text, "link28")
+	assert.NotContains(t, text, "Disabled")
+	text = list("/autolink list --disabled --page 1")
+	assert.Contains(t, text, "- 2: ~~link01~~")
+	assert.NotContains(t, text, "link00")
+
+	text = list("/autolink search link1 --scope team2")
+	assert.Contains(t, text, "link10")
+	assert.Contains(t, text, "link13")
+	assert.NotContains(t, text, "link11")
+}
+
+func TestListFormats(t *testing.T) {
+	conf := Config{
+		Links: []autolink.Autolink{
+			{Name: "jira", Pattern: "MM-(?P<id>\\d+)", Template: "[MM-${id}](https://jira.example.com/MM-${id})", Scope: []string{"dev"}},
+			{Name: "pipes", Pattern: "a|b", Template: "c", Disabled: true},
+		},
+	}
+
+	api := &plugintest.API{}
+	mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", "admin").Return(&model.User{Roles: "system_admin system_user"}, nil)
+	api.On("LogInfo", mock.AnythingOfType("string"))
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	list := func(command string) *model.CommandResponse {
+		resp, appErr := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{
+			UserId:  "admin",
+			Command: command,
+		})
+		require.Nil(t, appErr)
+		return resp
+	}
+
+	resp := list("/autolink list --format markdown --post")
+	assert.Equal(t, model.CommandResponseTypeInChannel, resp.ResponseType)
+	assert.Equal(t, autolink.MarkdownTableHeader+
+		"| 1 | jira | `MM-(?P<id>\\d+)` | `[MM-${id}](https://jira.example.com/MM-${id})` | dev | Enabled |\n"+
+		"| 2 | pipes | `a\\|b` | `c` |  | Disabled |\n", resp.Text)
+
+	resp = list("/autolink search jira --format json")
+	assert.Equal(t, model.CommandResponseTypeEphemeral, resp.ResponseType)
+	require.True(t, strings.HasPrefix(resp.Text, "```json\n"))
+	var links []autolink.Autolink
+	require.NoError(t, json.Unmarshal([]byte(strings.Trim(resp.Text, "`json\n")), &links))
+	assert.Equal(t, conf.Links[:1], links)
+
+	assert.Equal(t, `"yaml" is not a valid format, must be default, markdown or json`, list("/autolink list --format yaml").Text)
+}
+
+func TestBulkSet(t *testing.T) {
+	conf := Config{
+		Links: []autolink.Autolink{
+			{Name: "first", Pattern: "a", Template: "b", Scope: []string{"oldteam/town", "other"}},
+			{Name: "second", Pattern: "c", Template: "d", Scope: []string{"OldTeam"}},
+			{Name: "third", Pattern: "e", Template: "f", Tags: []string{"jira", "deprecated"}},
+		},
+	}
+
+	api := &plugintest.API{}
+	data := mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", "admin").Return(&model.User{Roles: "system_admin system_user"}, nil)
+	api.On("LogInfo", mock.AnythingOfType("string"))
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	run := func(command string) string {
+		resp, appErr := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{
+			UserId:  "admin",
+			Command: command,
+		})
+		require.Nil(t, appErr)
+		return resp.Text
+	}
+
+	stored := string(*data)
+	text := run("/autolink set --filter scope=oldteam* Scope=newteam* --dry-run")
+	assert.Contains(t, text, "Would update 2 link(s)")
+	assert.Equal(t, stored, string(*data), "a dry run saves nothing")
+
+	text = run("/autolink set --filter scope=oldteam* Scope=newteam* --confirm")
+	assert.Contains(t, text, "Updated 2 link(s)")
+	links := savedLinks(t, *data)
+	assert.Equal(t, []string{"newteam/town", "other"}, links[0].Scope)
+	assert.Equal(t, []string{"newteam"}, links[1].Scope)
+	assert.Nil(t, links[2].Scope)
+
+	run("/autolink set --filter name=*d WordMatch true --confirm")
+	links = savedLinks(t, *data)
+	assert.False(t, links[0].WordMatch)
+	assert.True(t, links[1].WordMatch)
+	assert.True(t, links[2].WordMatch)
+
+	run("/autolink set --filter tag=Deprecated Disabled true --confirm")
+	links = savedLinks(t, *data)
+	assert.False(t, links[0].Disabled)
+	assert.False(t, links[1].Disabled)
+	assert.True(t, links[2].Disabled)
+
+	assert.Equal(t, "No links found.", run("/autolink set --filter template=x Template y"))
+	assert.Contains(t, run("/autolink set --filter color=red Template y"), "Invalid filter")
+}
+
+func TestSetSchedule(t *testing.T) {
+	conf := Config{
+		Links: []autolink.Autolink{
+			{Name: "first", Pattern: "a", Template: "b", ActiveFrom: "2024-01-01T00:00:00Z"},
+		},
+	}
+
+	api := &plugintest.API{}
+	data := mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", "admin").Return(&model.User{Roles: "system_admin system_user"}, nil)
+	api.On("LogInfo", mock.AnythingOfType("string"))
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	run := func(command string) string {
+		resp, appErr := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{
+			UserId:  "admin",
+			Command: command,
+		})
+		require.Nil(t, appErr)
+		return resp.Text
+	}
+
+	stored := string(*data)
+	assert.Contains(t, run("/autolink set first Schedule 61 * * * *"), "invalid Schedule")
+	assert.Contains(t, run("/autolink set first ActiveUntil tomorrow"), "invalid ActiveUntil")
+	assert.Equal(t, stored, string(*data), "the invalid values are not saved")
+	assert.Equal(t, "2024-01-01T00:00:00Z", p.GetLinks()[0].ActiveFrom)
+
+	run("/autolink set first Schedule 5/15 9-17 * * 1-5")
+	links := savedLinks(t, *data)
+	assert.Equal(t, "5/15 9-17 * * 1-5", links[0].Schedule)
+	assert.Equal(t, "2024-01-01T00:00:00Z", links[0].ActiveFrom)
+}
+
+func TestConfirm(t *testing.T) {
+	conf := Config{
+		Links: []autolink.Autolink{
+			{Name: "first", Pattern: "a", Template: "b"},
+			{Name: "second", Pattern: "c", Template: "d"},
+			{Name: "third", Pattern: "e", Template: "f"},
+		},
+	}
+
+	api := &plugintest.API{}
+	data := mockLinksStore(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*autolinkplugin.Config")).Return(func(dest interface{}) error {
+		*dest.(*Config) = conf
+		return nil
+	})
+	api.On("UnregisterCommand", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return((*model.AppError)(nil))
+	api.On("GetUser", "admin").Return(&model.User{Roles: "system_admin system_user"}, nil)
+	api.On("LogInfo", mock.AnythingOfType("string"))
+
+	p := New()
+	p.SetAPI(api)
+	require.NoError(t, p.OnConfigurationChange())
+
+	run := func(command string) *model.CommandResponse {
+		resp, appErr := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{
+			UserId:  "admin",
+			Command: command,
+		})
+		require.Nil(t, appErr)
+		return resp
+	}
+	press := func(resp *model.CommandResponse, button int) string {
+		require.Len(t, resp.Attachments, 1)
+		integration := resp.Attachments[0].Actions[button].Integration
+		action := integration.URL[strings.LastIndex(integration.URL, "/")+1:]
+		update := p.HandleAction("admin", action, &model.PostActionIntegrationRequest{UserId: "admin", Context: integration.Context})
+		require.NotNil(t, update.Update)
+		return update.Update.Message
+	}
+	names := func() []string {
+		names := []string{}
+		for _, l := range savedLinks(t, *data) {
+			names = append(names, l.Name)
+		}
+		return names
+	}
+	stored := string(*data)
+
+	resp := run("/autolink delete sec")
+	assert.Contains(t, resp.Text, "- second")
+	assert.Equal(t, stored, string(*data))
+	assert.Equal(t, "Cancelled, nothing was changed.", press(resp, 1))
+	assert.Equal(t, stored, string(*data))
+	assert.Contains(t, press(resp, 0), "removed")
+	assert.Equal(t, []string{"first", "third"}, names())
+	assert.Contains(t, press(resp, 0), "The links changed", "the link was already deleted")
+
+	assert.Contains(t, run("/autolink delete third --confirm").Text, "removed")
+	assert.Equal(t, []string{"first"}, names())
+
+	resp = run("/autolink set --filter name=* WordMatch true")
+	assert.Contains(t, resp.Text, "Update 1 link(s)?")
+	require.NoError(t, p.SaveLinks(append(p.GetLinks(), autolink.Autolink{Name: "added", Pattern: "g", Template: "h"})))
+	assert.Contains(t, press(resp, 0), "The links changed")
+	assert.False(t, savedLinks(t, *data)[0].WordMatch)
+
+	resp = run("/autolink set --filter name=* WordMatch true")
+	assert.Contains(t, press(resp, 0), "Updated 2 link(s)")
+	assert.True(t, savedLinks(t, *data)[1].WordMatch)
+}
+
+func TestLinkEnrichCaches(t *testing.T) {
+	p := New()
+	jira := autolink.Autolink{Name: "jira", Enrich: enrichJira, EnrichTTL: "1h"}
+
+	caches := p.newLinkEnrichCaches()
+	cache := caches.get(jira)
+	require.NotNil(t, cache)
+	assert.Same(t, cache, caches.get(jira))
+	assert.Nil(t, caches.get(autolink.Autolink{Name: "cve", Enrich: enrichCVE}))
+	p.setEnrichCaches(caches.kept)
+
+	caches = p.newLinkEnrichCaches()
+	assert.Same(t, cache, caches.get(jira), "the cache is kept across configuration changes")
+	p.setEnrichCaches(caches.kept)
+
+	caches = p.newLinkEnrichCaches()
+	jira.EnrichTTL = "2h"
+	assert.NotSame(t, cache, caches.get(jira), "the TTL changed")
+	p.setEnrichCaches(caches.kept)
+	assert.Len(t, p.enrichCaches, 1, "the cache of the previous TTL is dropped")
+}
@@ -0,0 +1,321 @@
+package autolinkplugin
+
+import (
+	"crypto/sha1" //nolint:gosec // Only used to derive short IDs
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+const (
+	// suggestionsKey is the KV store key of the links suggested to the
+	// admins, by ID, for every server of a cluster to suggest them once, and
+	// for them to be accepted later.
+	suggestionsKey = "suggested_links"
+
+	// suggestionCheckInterval is how often the URLs posted are checked for
+	// links to suggest.
+	suggestionCheckInterval = 24 * time.Hour
+
+	// A URL prefix is suggested once it was posted suggestionMinPosts times
+	// in suggestionMinChannels channels between two checks.
+	suggestionMinPosts    = 10
+	suggestionMinChannels = 3
+
+	// maxSuggestionPrefixes is the maximum number of URL prefixes counted
+	// between two checks, to bound the memory used.
+	maxSuggestionPrefixes = 1000
+
+	// maxSuggestionKeys is the maximum number of issue key projects kept for
+	// a URL prefix.
+	maxSuggestionKeys = 10
+)
+
+var (
+	postedURLRegexp  = regexp.MustCompile("https?://[^\\s<>()\\[\\]\"'`]+")
+	issueKeyRegexp   = regexp.MustCompile(`^([A-Z][A-Z0-9_]+)-[0-9]+$`)
+	numericIDRegexp  = regexp.MustCompile(`^[0-9]+$`)
+	linkKeywordRegex = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.-]*$`)
+)
+
+// genericPathSegments are the path segments that do not tell what a numeric
+// ID refers to, e.g. the `issues` of GitHub issue URLs.
+var genericPathSegments = map[string]bool{
+	"-": true, "browse": true, "issue": true, "issues": true, "pull": true, "pulls": true,
+	"merge_requests": true, "ticket": true, "tickets": true, "item": true, "items": true,
+	"view": true, "show": true, "detail": true, "details": true, "id": true,
+}
+
+// suggestions counts the URLs of the posts that could be generated by a link,
+// when suggestions are enabled. They are kept in memory, and each server of a
+// cluster counts its own posts.
+type suggestions struct {
+	lock     sync.Mutex
+	prefixes map[string]*prefixUsage
+}
+
+// prefixUsage is the usage of the URLs made of a prefix followed by an ID.
+type prefixUsage struct {
+	// keyword is the path segment telling what numeric IDs refer to, or ""
+	// for issue keys, whose projects are keys
+	keyword  string
+	keys     map[string]bool
+	posts    int
+	channels map[string]bool
+	example  string
+}
+
+// record counts the URLs of a post.
+func (s *suggestions) record(post *model.Post) {
+	if post.IsSystemMessage() {
+		return
+	}
+	found := map[string]bool{}
+	for _, rawURL := range postedURLRegexp.FindAllString(post.Message, -1) {
+		prefix, keyword, key, ok := splitIDURL(rawURL)
+		if !ok {
+			continue
+		}
+
+		s.lock.Lock()
+		if s.prefixes == nil {
+			s.prefixes = map[string]*prefixUsage{}
+		}
+		usage := s.prefixes[prefix]
+		if usage == nil && len(s.prefixes) < maxSuggestionPrefixes {
+			usage = &prefixUsage{keyword: keyword, keys: map[string]bool{}, channels: map[string]bool{}, example: rawURL}
+			s.prefixes[prefix] = usage
+		}
+		if usage != nil {
+			if !found[prefix] {
+				usage.posts++
+			}
+			usage.channels[post.ChannelId] = true
+			if key != "" && len(usage.keys) < maxSuggestionKeys {
+				usage.keys[key] = true
+			}
+		}
+		s.lock.Unlock()
+		found[prefix] = true
+	}
+}
+
+// take returns the usages counted since the last call, and starts counting
+// again.
+func (s *suggestions) take() map[string]*prefixUsage {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	prefixes := s.prefixes
+	s.prefixes = nil
+	return prefixes
+}
+
+// splitIDURL splits a URL ending with an ID into its prefix and the path
+// segment telling what numeric IDs refer to, or the project of an issue key.
+func splitIDURL(rawURL string) (prefix, keyword, key string, ok bool) {
+	u, err := url.Parse(strings.TrimRight(rawURL, ".,;:!?"))
+	if err != nil || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+		return "", "", "", false
+	}
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(segments) < 2 {
+		return "", "", "", false
+	}
+	last := segments[len(segments)-1]
+	prefix = u.Scheme + "://" + u.Host + "/" + strings.Join(segments[:len(segments)-1], "/") + "/"
+
+	if match := issueKeyRegexp.FindStringSubmatch(last); match != nil {
+		return prefix, "", match[1], true
+	}
+	if !numericIDRegexp.MatchString(last) {
+		return "", "", "", false
+	}
+	for i := len(segments) - 2; i >= 0; i-- {
+		if !genericPathSegments[strings.ToLower(segments[i])] && linkKeywordRegex.MatchString(segments[i]) {
+			return prefix, segments[i], "", true
+		}
+	}
+	// Bare numbers would match too much text
+	return "", "", "", false
+}
+
+// link returns the link generating the URLs of the prefix from their IDs, as
+// they are written in messages: `KEY-123` for issue keys, `keyword#123` for
+// numeric IDs.
+func (u *prefixUsage) link(prefix string) autolink.Autolink {
+	if u.keyword != "" {
+		return autolink.Autolink{
+			Name:      u.keyword,
+			Pattern:   regexp.QuoteMeta(u.keyword) + `#(?P<id>\d+)`,
+			Template:  "[" + u.keyword + "#${id}](" + prefix + "${id})",
+			WordMatch: true,
+		}
+	}
+	keys := make([]string, 0, len(u.keys))
+	for key := range u.keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	name := prefix
+	if parsed, err := url.Parse(prefix); err == nil {
+		name = strings.SplitN(parsed.Host, ".", 2)[0]
+	}
+	return autolink.Autolink{
+		Name:      name,
+		Pattern:   `(?P<key>(?:` + strings.Join(keys, "|") + `)-\d+)`,
+		Template:  "[${key}](" + prefix + "${key})",
+		WordMatch: true,
+	}
+}
+
+// suggestionID is the ID of the suggestion of a URL prefix, the same on every
+// server.
+func suggestionID(prefix string) string {
+	sum := sha1.Sum([]byte(prefix)) //nolint:gosec // Only used to derive short IDs
+	return hex.EncodeToString(sum[:])[:8]
+}
+
+// suggestLinks sends the plugin admins a direct message suggesting the links
+// that would generate the URLs posted often in several channels since the
+// last check. Each link is only suggested once.
+func (p *Plugin) suggestLinks() {
+	usages := p.suggestions.take()
+	if !p.getConfig().EnableSuggestions {
+		return
+	}
+
+	links := p.GetLinks()
+	linked := func(prefix string) bool {
+		for _, l := range links {
+			if strings.Contains(l.Template, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+	candidates := map[string]autolink.Autolink{}
+	details := map[string]string{}
+	for prefix, usage := range usages {
+		if usage.posts < suggestionMinPosts || len(usage.channels) < suggestionMinChannels || linked(prefix) {
+			continue
+		}
+		id := suggestionID(prefix)
+		candidates[id] = usage.link(prefix)
+		details[id] = fmt.Sprintf("posted %d times in %d channels, e.g. %s", usage.posts, len(usage.channels), usage.example)
+	}
+	if len(candidates) == 0 {
+		return
+	}
+
+	suggested := map[string]autolink.Autolink{}
+	oldValue, appErr := p.API.KVGet(suggestionsKey)
+	if appErr != nil {
+		p.API.LogError("Failed to load the suggested links", "error", appErr.Error())
+		return
+	}
+	if oldValue != nil {
+		if err := json.Unmarshal(oldValue, &suggested); err != nil {
+			p.API.LogWarn("Failed to decode the suggested links", "error", err.Error())
+		}
+	}
+	var ids []string
+	for id, l := range candidates {
+		if _, ok := suggested[id]; !ok {
+			suggested[id] = l
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	sort.Strings(ids)
+
+	value, err := json.Marshal(suggested)
+	if err != nil {
+		p.API.LogError("Failed to encode the suggested links", "error", err.Error())
+		return
+	}
+	saved, appErr := p.API.KVSetWithOptions(suggestionsKey, value, model.PluginKVSetOptions{
+		Atomic:   true,
+		OldValue: oldValue,
+	})
+	if appErr != nil {
+		p.API.LogError("Failed to save the suggested links", "error", appErr.Error())
+		return
+	}
+	if !saved {
+		// Another server suggested links meanwhile, these are suggested
+		// again at the next check if they are still posted
+		return
+	}
+
+	list := ""
+	for _, id := range ids {
+		l := candidates[id]
+		list += fmt.Sprintf("- `%s`: pattern `%s`, template `%s`, %s. Accept it with `/autolink accept-suggestion %s`\n",
+			l.Name, l.Pattern, l.Template, details[id], id)
+	}
+	p.notifyAdmins("autolink.suggestions.notification", list)
+}
+
+func executeAcceptSuggestion(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) != 1 {
+		return responsef(header.T("autolink.command.help"))
+	}
+
+	filter, err := linkFilter(p, header)
+	if err != nil {
+		return responsef("%v", err)
+	}
+	if filter != nil {
+		return responsef(header.T("autolink.command.accept_suggestion.not_authorized"))
+	}
+
+	data, appErr := p.API.KVGet(suggestionsKey)
+	if appErr != nil {
+		return responsef(header.T("autolink.command.accept_suggestion.failed"), appErr)
+	}
+	suggested := map[string]autolink.Autolink{}
+	if data != nil {
+		if err = json.Unmarshal(data, &suggested); err != nil {
+			return responsef(header.T("autolink.command.accept_suggestion.failed"), err)
+		}
+	}
+	l, ok := suggested[args[0]]
+	if !ok {
+		return responsef(header.T("autolink.command.accept_suggestion.not_found"), args[0])
+	}
+
+	links := p.GetLinks()
+	name := l.Name
+	for i := 2; ; i++ {
+		exists := false
+		for _, existing := range links {
+			if existing.Name == l.Name {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			break
+		}
+		l.Name = fmt.Sprintf("%s-%d", name, i)
+	}
+
+	if err = p.SaveLinks(append(append([]autolink.Autolink{}, links...), l)); err != nil {
+		return responsef(err.Error())
+	}
+	return responsef(header.T("autolink.command.accept_suggestion.accepted"), l.ToMarkdown(0))
+}
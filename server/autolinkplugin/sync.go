@@ -0,0 +1,178 @@
+package autolinkplugin
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin"
+	"github.com/pkg/errors"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolinkclient"
+	"github.com/mattermost/mattermost-plugin-autolink/server/importer"
+)
+
+// syncCheckInterval is how often the links are checked for being due to be
+// pulled from the server configured to sync with.
+const syncCheckInterval = time.Minute
+
+// pullState is when this server last pulled the links on schedule.
+type pullState struct {
+	lock sync.Mutex
+	last time.Time
+}
+
+// syncChanges are the names of the links added, updated and removed by a
+// sync.
+type syncChanges struct {
+	added   []string
+	updated []string
+	removed []string
+}
+
+func (c syncChanges) empty() bool {
+	return len(c.added) == 0 && len(c.updated) == 0 && len(c.removed) == 0
+}
+
+// syncClient returns the client of the plugin on the server configured to
+// sync with.
+func (p *Plugin) syncClient() (*autolinkclient.Client, error) {
+	conf := p.getConfig()
+	if conf.SyncSiteURL == "" || conf.SyncToken == "" {
+		return nil, errors.New("the site URL and the token of the server to sync with are not configured")
+	}
+	return autolinkclient.NewClientToken(conf.SyncSiteURL, conf.SyncToken), nil
+}
+
+// pullLinks replaces the links that are not owned by a plugin with the links
+// of the server configured to sync with, unless dryRun is set, and returns
+// the changes.
+func (p *Plugin) pullLinks(dryRun bool) (syncChanges, error) {
+	client, err := p.syncClient()
+	if err != nil {
+		return syncChanges{}, err
+	}
+	remote, err := client.List()
+	if err != nil {
+		return syncChanges{}, errors.Wrap(err, "failed to get the links to pull")
+	}
+
+	links := p.GetLinks()
+	replaced, added, updated, removed := importer.Replace(links, remote)
+	changes := syncChanges{added: added, updated: updated, removed: removed}
+	if dryRun || importer.Equal(links, replaced) {
+		return changes, nil
+	}
+	return changes, p.SaveLinks(replaced)
+}
+
+// pushLinks replaces the links that are not owned by a plugin on the server
+// configured to sync with, unless dryRun is set, and returns the changes.
+func (p *Plugin) pushLinks(dryRun bool) (syncChanges, error) {
+	client, err := p.syncClient()
+	if err != nil {
+		return syncChanges{}, err
+	}
+	links := []autolink.Autolink{}
+	for _, l := range p.GetLinks() {
+		if l.PluginID == "" {
+			links = append(links, l)
+		}
+	}
+
+	if dryRun {
+		remote, err := client.List()
+		if err != nil {
+			return syncChanges{}, errors.Wrap(err, "failed to get the links to replace")
+		}
+		_, added, updated, removed := importer.Replace(remote, links)
+		return syncChanges{added: added, updated: updated, removed: removed}, nil
+	}
+
+	result, err := client.Replace(links)
+	if err != nil {
+		return syncChanges{}, errors.Wrap(err, "failed to push the links")
+	}
+	return syncChanges{added: result.Added, updated: result.Updated, removed: result.Removed}, nil
+}
+
+// pullScheduled pulls the links when SyncPullInterval elapsed since this
+// server last pulled them. Each server of a cluster pulls them, the links
+// only being saved when they changed.
+func (p *Plugin) pullScheduled(now time.Time) {
+	conf := p.getConfig()
+	if conf.SyncPullInterval <= 0 || conf.SyncSiteURL == "" || conf.SyncToken == "" {
+		return
+	}
+
+	p.pulls.lock.Lock()
+	due := now.Sub(p.pulls.last) >= time.Duration(conf.SyncPullInterval)*time.Minute
+	if due {
+		p.pulls.last = now
+	}
+	p.pulls.lock.Unlock()
+	if !due {
+		return
+	}
+
+	changes, err := p.pullLinks(false)
+	if err != nil {
+		p.API.LogWarn("Failed to pull the links", "site_url", conf.SyncSiteURL, "error", err.Error())
+		return
+	}
+	if !changes.empty() {
+		p.API.LogInfo("Pulled the links", "site_url", conf.SyncSiteURL,
+			"added", len(changes.added), "updated", len(changes.updated), "removed", len(changes.removed))
+	}
+}
+
+func executeSync(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	dryRun := len(args) == 2 && args[1] == "--dry-run"
+	if len(args) == 0 || (len(args) == 2 && !dryRun) || len(args) > 2 {
+		return responsef(header.T("autolink.command.help"))
+	}
+
+	filter, err := linkFilter(p, header)
+	if err != nil {
+		return responsef("%v", err)
+	}
+	if filter != nil {
+		return responsef(header.T("autolink.command.sync.not_authorized"))
+	}
+
+	var changes syncChanges
+	var done string
+	switch args[0] {
+	case "pull":
+		changes, err = p.pullLinks(dryRun)
+		done = "autolink.command.sync.pulled"
+	case "push":
+		changes, err = p.pushLinks(dryRun)
+		done = "autolink.command.sync.pushed"
+	default:
+		return responsef(header.T("autolink.command.help"))
+	}
+	siteURL := p.getConfig().SyncSiteURL
+	if err != nil {
+		return responsef(header.T("autolink.command.sync.failed"), siteURL, err)
+	}
+	if changes.empty() {
+		return responsef(header.T("autolink.command.sync.in_sync"), siteURL)
+	}
+
+	text := ""
+	for _, name := range changes.added {
+		text += header.T("autolink.command.import_github.added", name)
+	}
+	for _, name := range changes.updated {
+		text += header.T("autolink.command.import_github.updated", name)
+	}
+	for _, name := range changes.removed {
+		text += header.T("autolink.command.sync.removed", name)
+	}
+	if dryRun {
+		return responsef(header.T("autolink.command.sync.dry_run"), siteURL, text)
+	}
+	return responsef(header.T(done), siteURL, text)
+}
@@ -0,0 +1,61 @@
+package autolinkplugin
+
+import (
+	"strings"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+// mergeTeamLinks returns the links applying to the posts of the channel, in
+// the order they are applied. The global links, without a Scope, are shared
+// by all the teams, and a team overrides one of them with a link of the same
+// Name, ignoring case, scoped to the team or the channel: the scoped link
+// takes the place of the global link, which is not applied. Other links keep
+// their order, and the first enabled scoped link wins when several apply.
+func (p *Plugin) mergeTeamLinks(links []autolink.Autolink, channelName, teamName string) []autolink.Autolink {
+	if teamName == "" {
+		return links
+	}
+
+	global := map[string]bool{}
+	for _, l := range links {
+		if len(l.Scope) == 0 && l.Name != "" {
+			global[strings.ToLower(l.Name)] = true
+		}
+	}
+	overrides := map[string]int{}
+	for i, l := range links {
+		name := strings.ToLower(l.Name)
+		if len(l.Scope) == 0 || l.Disabled || !global[name] {
+			continue
+		}
+		if _, ok := overrides[name]; ok {
+			continue
+		}
+		if p.inScope(l.Scope, channelName, teamName) {
+			overrides[name] = i
+		}
+	}
+	if len(overrides) == 0 {
+		return links
+	}
+
+	merged := make([]autolink.Autolink, 0, len(links))
+	placed := map[string]bool{}
+	for _, l := range links {
+		name := strings.ToLower(l.Name)
+		i, ok := overrides[name]
+		if !ok {
+			merged = append(merged, l)
+			continue
+		}
+		// The override is placed at the first of the global link and
+		// itself, and the others of the name are left out
+		if placed[name] || (len(l.Scope) != 0 && !p.inScope(l.Scope, channelName, teamName)) {
+			continue
+		}
+		merged = append(merged, links[i])
+		placed[name] = true
+	}
+	return merged
+}
@@ -0,0 +1,235 @@
+package autolinkplugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+// The Rudder write key and data plane of the Mattermost telemetry pipeline,
+// set at build time with -ldflags, see build/custom.mk. Without a write key,
+// no telemetry is sent.
+var (
+	rudderWriteKey     string
+	rudderDataplaneURL = "https://pdat.matterlytics.com"
+)
+
+const (
+	// telemetryKey is the KV store key marking that the telemetry was sent
+	// in the last telemetryInterval, for a single server of a cluster to
+	// send it.
+	telemetryKey = "telemetry_sent"
+
+	// telemetryInterval is how often the telemetry is sent.
+	telemetryInterval = 24 * time.Hour
+
+	// telemetryEvent is the name of the event reporting the usage of the
+	// plugin.
+	telemetryEvent = "autolink_usage"
+
+	telemetryRequestTimeout = 10 * time.Second
+)
+
+var telemetryClient = &http.Client{Timeout: telemetryRequestTimeout}
+
+// telemetryFeatures report whether a link uses a feature, counted in the
+// telemetry by feature name.
+var telemetryFeatures = map[string]func(autolink.Autolink) bool{
+	"scope":      func(l autolink.Autolink) bool { return len(l.Scope) > 0 },
+	"word_match": func(l autolink.Autolink) bool { return l.WordMatch || l.UnicodeWordMatch },
+	"boundaries": func(l autolink.Autolink) bool {
+		return l.BoundaryClass != "" || l.PrefixChars != "" || l.SuffixChars != ""
+	},
+	"case_insensitive":  func(l autolink.Autolink) bool { return l.CaseInsensitive },
+	"line_modes":        func(l autolink.Autolink) bool { return l.MultiLine || l.DotAll || l.AcrossLines },
+	"backtracking":      func(l autolink.Autolink) bool { return l.Engine == autolink.EngineBacktracking },
+	"max_replacements":  func(l autolink.Autolink) bool { return l.MaxReplacements > 0 || l.FirstMatchOnly },
+	"code":              func(l autolink.Autolink) bool { return l.CodeBlocks || l.CodeSpans },
+	"link_labels":       func(l autolink.Autolink) bool { return l.ProcessLinkLabels },
+	"cases":             func(l autolink.Autolink) bool { return len(l.Cases) > 0 },
+	"locale_templates":  func(l autolink.Autolink) bool { return len(l.LocaleTemplates) > 0 },
+	"scope_templates":   func(l autolink.Autolink) bool { return len(l.ScopeTemplates) > 0 },
+	"fallback_template": func(l autolink.Autolink) bool { return l.FallbackTemplate != "" },
+	"enrich":            func(l autolink.Autolink) bool { return l.Enrich != "" },
+	"attachment":        func(l autolink.Autolink) bool { return l.Attachment != nil },
+	"schedule":          func(l autolink.Autolink) bool { return l.Schedule != "" || l.ActiveFrom != "" || l.ActiveUntil != "" },
+	"expires":           func(l autolink.Autolink) bool { return l.ExpiresAt != "" },
+	"terminal":          func(l autolink.Autolink) bool { return l.Terminal || l.TerminalPost },
+	"shadow_mode":       func(l autolink.Autolink) bool { return l.ShadowMode },
+	"threads":           func(l autolink.Autolink) bool { return l.Threads != "" },
+	"webhook":           func(l autolink.Autolink) bool { return l.WebhookURL != "" },
+	"style":             func(l autolink.Autolink) bool { return l.Style != "" || l.TextPrefix != "" || l.TextSuffix != "" },
+	"plugin_owned":      func(l autolink.Autolink) bool { return l.PluginID != "" },
+}
+
+// telemetryBuckets are the lower bounds of the buckets the number of posts
+// changed in the last week is reported in, rather than the exact number.
+var telemetryBuckets = []int{0, 1, 100, 1000, 10000, 100000}
+
+// telemetryReport are the aggregate metrics reported in the telemetry. They
+// never include the names, patterns or templates of the links, nor the names
+// of the teams, channels or users.
+type telemetryReport struct {
+	Links         int            `json:"links"`
+	DisabledLinks int            `json:"disabled_links"`
+	Kinds         map[string]int `json:"kinds"`
+	Features      map[string]int `json:"features"`
+	Settings      []string       `json:"settings"`
+	WeeklyPosts   string         `json:"weekly_posts"`
+	ServerVersion string         `json:"server_version"`
+}
+
+// telemetryEnabled reports whether the telemetry is sent: the admins opted in
+// with Config.EnableTelemetry, the telemetry of the server is enabled, and
+// the plugin was built with a write key.
+func (p *Plugin) telemetryEnabled() bool {
+	if rudderWriteKey == "" || !p.getConfig().EnableTelemetry {
+		return false
+	}
+	serverConfig := p.API.GetConfig()
+	return serverConfig != nil && serverConfig.LogSettings.EnableDiagnostics != nil && *serverConfig.LogSettings.EnableDiagnostics
+}
+
+// sendTelemetry sends the telemetry once a day, from a single server of the
+// cluster.
+func (p *Plugin) sendTelemetry(now time.Time) {
+	if !p.telemetryEnabled() {
+		return
+	}
+	due, appErr := p.API.KVSetWithOptions(telemetryKey, []byte(now.UTC().Format(time.RFC3339)), model.PluginKVSetOptions{
+		Atomic:          true,
+		OldValue:        nil,
+		ExpireInSeconds: int64(telemetryInterval / time.Second),
+	})
+	if appErr != nil {
+		p.API.LogWarn("Failed to check when the telemetry was last sent", "error", appErr.Error())
+		return
+	}
+	if !due {
+		return
+	}
+
+	if err := postTelemetry(p.API.GetDiagnosticId(), p.telemetryReport(now), now); err != nil {
+		p.API.LogWarn("Failed to send the telemetry", "error", err.Error())
+	}
+}
+
+// telemetryReport collects the metrics of the telemetry.
+func (p *Plugin) telemetryReport(now time.Time) telemetryReport {
+	conf := p.getConfig()
+	report := telemetryReport{
+		Kinds:         map[string]int{},
+		Features:      map[string]int{},
+		Settings:      []string{},
+		ServerVersion: p.API.GetServerVersion(),
+	}
+	for _, link := range conf.Links {
+		report.Links++
+		if link.Disabled {
+			report.DisabledLinks++
+		}
+		kind := link.Kind
+		if kind == "" {
+			kind = "default"
+		}
+		report.Kinds[kind]++
+		for feature, uses := range telemetryFeatures {
+			if uses(link) {
+				report.Features[feature]++
+			}
+		}
+	}
+
+	for setting, enabled := range map[string]bool{
+		"on_update":              conf.EnableOnUpdate,
+		"skip_api_edits":         conf.SkipAPIEdits,
+		"skip_file_comments":     conf.SkipFileComments,
+		"skip_integration_posts": conf.SkipIntegrationPosts,
+		"plugin_posts":           conf.ProcessPluginPosts,
+		"suggestions":            conf.EnableSuggestions,
+		"admin_digest":           conf.AdminDigest != "",
+		"team_admin_delegation":  conf.EnableTeamAdminDelegation,
+		"jira":                   conf.jira != nil,
+		"cve":                    conf.cve != nil,
+		"webhook":                conf.WebhookURL != "",
+	} {
+		if enabled {
+			report.Settings = append(report.Settings, setting)
+		}
+	}
+	sort.Strings(report.Settings)
+
+	report.WeeklyPosts = "unknown"
+	stats, err := p.UsageStats(now.AddDate(0, 0, -7).UTC().Truncate(24*time.Hour), now.UTC().Truncate(24*time.Hour))
+	if err != nil {
+		p.API.LogWarn("Failed to load the usage of the links for the telemetry", "error", err.Error())
+		return report
+	}
+	posts := 0
+	for _, stat := range stats {
+		posts += stat.Posts
+	}
+	report.WeeklyPosts = telemetryBucket(posts)
+	return report
+}
+
+// telemetryBucket returns the bucket of the number, e.g. `100-999`.
+func telemetryBucket(n int) string {
+	for i := len(telemetryBuckets) - 1; i > 0; i-- {
+		if n < telemetryBuckets[i] {
+			continue
+		}
+		if i == len(telemetryBuckets)-1 {
+			return fmt.Sprintf("%d+", telemetryBuckets[i])
+		}
+		return fmt.Sprintf("%d-%d", telemetryBuckets[i], telemetryBuckets[i+1]-1)
+	}
+	return "0"
+}
+
+// postTelemetry sends the report to the data plane of the telemetry
+// pipeline, as a track event of the installation.
+func postTelemetry(installationID string, report telemetryReport, now time.Time) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"userId":     installationID,
+		"event":      telemetryEvent,
+		"properties": report,
+		"timestamp":  now.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the telemetry")
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(rudderDataplaneURL, "/")+"/v1/track", bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to create the request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(rudderWriteKey, "")
+
+	resp, err := telemetryClient.Do(req)
+	if err != nil {
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		return errors.Wrap(err, "failed to send the request")
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("unexpected status %v", resp.StatusCode)
+	}
+	return nil
+}
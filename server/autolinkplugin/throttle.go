@@ -0,0 +1,123 @@
+package autolinkplugin
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+// throttleWindow is the window over which the posts rewritten in a channel
+// are counted against MaxRewritesPerChannel.
+const throttleWindow = time.Minute
+
+// channelThrottle counts the posts rewritten in each channel in the current
+// window, and the posts skipped because there were too many of them, for a
+// single warning to be logged per window.
+type channelThrottle struct {
+	lock    sync.Mutex
+	window  time.Time
+	counts  map[string]int
+	skipped map[string]int
+}
+
+// allow reports whether the posts rewritten in the channel at the given time
+// are within the limit, counting the post as skipped otherwise. When the
+// previous window ended, the posts skipped in it are returned by channel.
+func (t *channelThrottle) allow(channelID string, limit int, now time.Time) (bool, map[string]int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	ended := t.rollover(now)
+	if t.counts[channelID] >= limit {
+		if t.skipped == nil {
+			t.skipped = map[string]int{}
+		}
+		t.skipped[channelID]++
+		return false, ended
+	}
+	return true, ended
+}
+
+// count counts a post rewritten in the channel at the given time, returning
+// the posts skipped by channel like allow.
+func (t *channelThrottle) count(channelID string, now time.Time) map[string]int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	ended := t.rollover(now)
+	if t.counts == nil {
+		t.counts = map[string]int{}
+	}
+	t.counts[channelID]++
+	return ended
+}
+
+// rollover starts a new window if the current one ended at the given time,
+// returning the posts skipped in the one that ended, if any.
+func (t *channelThrottle) rollover(now time.Time) map[string]int {
+	window := now.Truncate(throttleWindow)
+	if window.Equal(t.window) {
+		return nil
+	}
+	skipped := t.skipped
+	t.window = window
+	t.counts = nil
+	t.skipped = nil
+	if len(skipped) == 0 {
+		return nil
+	}
+	return skipped
+}
+
+// throttled reports whether the post is skipped because too many posts were
+// rewritten in its channel in the current window.
+func (p *Plugin) throttled(post *model.Post, conf *Config) bool {
+	if conf.MaxRewritesPerChannel <= 0 || post.ChannelId == "" {
+		return false
+	}
+	allowed, ended := p.throttle.allow(post.ChannelId, conf.MaxRewritesPerChannel, time.Now())
+	p.logThrottled(ended, conf.MaxRewritesPerChannel)
+	return !allowed
+}
+
+// countRewrite counts the post rewritten against the limit of its channel.
+func (p *Plugin) countRewrite(post *model.Post, conf *Config) {
+	if conf.MaxRewritesPerChannel <= 0 || post.ChannelId == "" {
+		return
+	}
+	ended := p.throttle.count(post.ChannelId, time.Now())
+	p.logThrottled(ended, conf.MaxRewritesPerChannel)
+}
+
+// reportThrottled logs the posts skipped in the window that ended, if any, for
+// the warning not to wait for the next post.
+func (p *Plugin) reportThrottled(now time.Time) {
+	p.throttle.lock.Lock()
+	ended := p.throttle.rollover(now)
+	p.throttle.lock.Unlock()
+	p.logThrottled(ended, p.getConfig().MaxRewritesPerChannel)
+}
+
+// logThrottled logs a single warning with the posts skipped in each channel.
+func (p *Plugin) logThrottled(skipped map[string]int, limit int) {
+	if len(skipped) == 0 {
+		return
+	}
+	channelIDs := make([]string, 0, len(skipped))
+	total := 0
+	for channelID, posts := range skipped {
+		channelIDs = append(channelIDs, channelID)
+		total += posts
+	}
+	sort.Strings(channelIDs)
+	channels := make([]string, len(channelIDs))
+	for i, channelID := range channelIDs {
+		channels[i] = fmt.Sprintf("%s:%d", channelID, skipped[channelID])
+	}
+	p.API.LogWarn("Posts not autolinked, too many posts in their channels", "skipped", total,
+		"limit_per_minute", limit, "channels", strings.Join(channels, ","))
+}
@@ -0,0 +1,218 @@
+package autolinkplugin
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/api"
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+const (
+	// usageKeyPrefix prefixes the KV store keys of the usage of the links on
+	// a day, in UTC, e.g. `usage_2026-10-15`. They expire after
+	// usageRetention.
+	usageKeyPrefix = "usage_"
+	usageRetention = 90 * 24 * time.Hour
+
+	// usageSaveAttempts is the number of times the usage of a day is saved
+	// before giving up until the next save, when other servers of a cluster
+	// save theirs at the same time.
+	usageSaveAttempts = 5
+)
+
+// dailyUsage is the number of posts the links changed on a day, by link name
+// and channel ID.
+type dailyUsage map[string]map[string]int
+
+// add adds the posts changed by a link in a channel.
+func (d dailyUsage) add(link, channelID string, posts int) {
+	if d[link] == nil {
+		d[link] = map[string]int{}
+	}
+	d[link][channelID] += posts
+}
+
+// usage counts the posts changed by the links by day. Each server of a
+// cluster counts its own posts in memory, and adds them to the KV store with
+// the activity of the links.
+type usage struct {
+	lock    sync.Mutex
+	pending map[string]dailyUsage
+}
+
+// record counts a post changed by the link in the channel.
+func (u *usage) record(link, channelID string, at time.Time) {
+	u.merge(at.UTC().Format(api.StatsDateLayout), dailyUsage{link: {channelID: 1}})
+}
+
+// merge adds the counts of a day to the posts counted.
+func (u *usage) merge(date string, counts dailyUsage) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if u.pending == nil {
+		u.pending = map[string]dailyUsage{}
+	}
+	if u.pending[date] == nil {
+		u.pending[date] = dailyUsage{}
+	}
+	for link, channels := range counts {
+		for channelID, posts := range channels {
+			u.pending[date].add(link, channelID, posts)
+		}
+	}
+}
+
+// take returns the posts counted since the last call, by date.
+func (u *usage) take() map[string]dailyUsage {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	pending := u.pending
+	u.pending = nil
+	return pending
+}
+
+// saveUsage adds the posts counted since the last save to the KV store. The
+// posts of a day that could not be saved are saved with the next ones.
+func (p *Plugin) saveUsage() {
+	for date, counts := range p.usage.take() {
+		if err := p.addUsage(date, counts); err != nil {
+			p.API.LogWarn("Failed to save the usage of the links", "date", date, "error", err.Error())
+			p.usage.merge(date, counts)
+		}
+	}
+}
+
+// addUsage adds the counts to the usage of the day in the KV store, retrying
+// when another server changed it meanwhile.
+func (p *Plugin) addUsage(date string, counts dailyUsage) error {
+	key := usageKeyPrefix + date
+	for i := 0; i < usageSaveAttempts; i++ {
+		oldValue, appErr := p.API.KVGet(key)
+		if appErr != nil {
+			return errors.Wrap(appErr, "failed to load the usage")
+		}
+		saved := dailyUsage{}
+		if oldValue != nil {
+			if err := json.Unmarshal(oldValue, &saved); err != nil {
+				return errors.Wrap(err, "failed to decode the usage")
+			}
+		}
+		for link, channels := range counts {
+			for channelID, posts := range channels {
+				saved.add(link, channelID, posts)
+			}
+		}
+		value, err := json.Marshal(saved)
+		if err != nil {
+			return errors.Wrap(err, "failed to encode the usage")
+		}
+
+		day, _ := time.Parse(api.StatsDateLayout, date)
+		ok, appErr := p.API.KVSetWithOptions(key, value, model.PluginKVSetOptions{
+			Atomic:          true,
+			OldValue:        oldValue,
+			ExpireInSeconds: int64(time.Until(day.Add(usageRetention)) / time.Second),
+		})
+		if appErr != nil {
+			return errors.Wrap(appErr, "failed to save the usage")
+		}
+		if ok {
+			return nil
+		}
+	}
+	return errors.New("the usage kept changing")
+}
+
+// UsageStats returns the number of posts each link changed in each channel,
+// by day from the from to the to date included, sorted by date, link and
+// channel. The posts counted by this server and not saved yet are saved
+// first.
+func (p *Plugin) UsageStats(from, to time.Time) ([]api.UsageStat, error) {
+	p.saveUsage()
+
+	stats := []api.UsageStat{}
+	for day := from.UTC(); !day.After(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format(api.StatsDateLayout)
+		value, appErr := p.API.KVGet(usageKeyPrefix + date)
+		if appErr != nil {
+			return nil, errors.Wrapf(appErr, "failed to load the usage of %s", date)
+		}
+		if value == nil {
+			continue
+		}
+		counts := dailyUsage{}
+		if err := json.Unmarshal(value, &counts); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode the usage of %s", date)
+		}
+
+		links := make([]string, 0, len(counts))
+		for link := range counts {
+			links = append(links, link)
+		}
+		sort.Strings(links)
+		for _, link := range links {
+			channelIDs := make([]string, 0, len(counts[link]))
+			for channelID := range counts[link] {
+				channelIDs = append(channelIDs, channelID)
+			}
+			sort.Strings(channelIDs)
+			for _, channelID := range channelIDs {
+				// The channels deleted since keep their ID only
+				channelName, teamName, _ := p.resolveScope(channelID)
+				stats = append(stats, api.UsageStat{
+					Date:        date,
+					Link:        link,
+					ChannelID:   channelID,
+					ChannelName: channelName,
+					TeamName:    teamName,
+					Posts:       counts[link][channelID],
+				})
+			}
+		}
+	}
+	return stats, nil
+}
+
+// LinkActivity returns when each link last changed a post, and the number of
+// posts it changed over the last 7 and 30 days, in the order of the links.
+func (p *Plugin) LinkActivity(links []autolink.Autolink) ([]api.LinkActivity, error) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	stats, err := p.UsageStats(today.AddDate(0, 0, -29), today)
+	if err != nil {
+		return nil, err
+	}
+	weekStart := today.AddDate(0, 0, -6).Format(api.StatsDateLayout)
+	posts7Days, posts30Days := map[string]int{}, map[string]int{}
+	for _, stat := range stats {
+		posts30Days[stat.Link] += stat.Posts
+		// The dates sort like the days they are
+		if stat.Date >= weekStart {
+			posts7Days[stat.Link] += stat.Posts
+		}
+	}
+
+	d := &p.diagnostics
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	activity := make([]api.LinkActivity, 0, len(links))
+	for _, link := range links {
+		linkActivity := api.LinkActivity{
+			Posts7Days:  posts7Days[link.DisplayName()],
+			Posts30Days: posts30Days[link.DisplayName()],
+		}
+		if at, ok := d.lastFired[link.DisplayName()]; ok {
+			linkActivity.LastFiredAt = &at
+		}
+		activity = append(activity, linkActivity)
+	}
+	return activity, nil
+}
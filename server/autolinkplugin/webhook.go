@@ -0,0 +1,225 @@
+package autolinkplugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+const (
+	// webhookFlushInterval is how often the queued events are sent to the
+	// webhooks, unless a full batch is queued earlier.
+	webhookFlushInterval = 10 * time.Second
+
+	// webhookBatchSize is the maximum number of events sent to a webhook in
+	// a single request.
+	webhookBatchSize = 100
+
+	// webhookMaxPending is the maximum number of events queued for a single
+	// webhook, e.g. while it is down. Newer events are dropped.
+	webhookMaxPending = 10000
+
+	webhookRequestTimeout = 10 * time.Second
+)
+
+// webhookEvent is sent to the webhooks when a link changes a post.
+type webhookEvent struct {
+	Link        string   `json:"link"`
+	PostID      string   `json:"post_id,omitempty"`
+	ChannelID   string   `json:"channel_id"`
+	ChannelName string   `json:"channel_name,omitempty"`
+	TeamName    string   `json:"team_name,omitempty"`
+	UserID      string   `json:"user_id"`
+	Matches     []string `json:"matches"`
+	Timestamp   int64    `json:"timestamp"`
+}
+
+// webhookPayload is the body of the requests to the webhooks.
+type webhookPayload struct {
+	Events []webhookEvent `json:"events"`
+}
+
+// webhooks queues the events of the links changing posts, and sends them in
+// batches to the webhooks. The events are kept in memory, and those queued
+// when the plugin stops are lost.
+type webhooks struct {
+	lock    sync.Mutex
+	pending map[string][]webhookEvent
+	dropped map[string]int
+	sending bool
+}
+
+// webhookURL returns the URL the events of the link are sent to, the link's
+// own webhook if it is allowed or else the global one, empty if there is
+// none.
+func webhookURL(conf *Config, link autolink.Autolink) string {
+	if link.WebhookURL != "" && conf.webhookAllowed(link.WebhookURL) {
+		return link.WebhookURL
+	}
+	return conf.WebhookURL
+}
+
+// webhookAllowed reports whether a link may send its events to the webhook:
+// the WebhookURL of the settings, or a URL on one of WebhookAllowedHosts.
+// The links are changed by team admins and API keys too, and would otherwise
+// send the text of the posts anywhere.
+func (c *Config) webhookAllowed(webhook string) bool {
+	if webhook == c.WebhookURL {
+		return true
+	}
+	u, err := url.Parse(webhook)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	for _, host := range strings.FieldsFunc(c.WebhookAllowedHosts, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	}) {
+		if strings.EqualFold(host, u.Host) || strings.EqualFold(host, u.Hostname()) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkWebhookField returns an error response unless the user may set the
+// WebhookURL of a link to the value: only the plugin admins may, to a webhook
+// that is allowed.
+func checkWebhookField(p *Plugin, header *model.CommandArgs, value string) *model.CommandResponse {
+	isAdmin, err := p.IsAuthorizedAdmin(header.UserId)
+	if err != nil {
+		return responsef("%v", err)
+	}
+	if !isAdmin {
+		return responsef(header.T("autolink.command.set.webhook_not_authorized"))
+	}
+	if value != "" && !p.getConfig().webhookAllowed(value) {
+		return responsef(header.T("autolink.command.set.webhook_not_allowed"), value)
+	}
+	return nil
+}
+
+// queue adds an event for the webhook, and reports whether a full batch is
+// ready to be sent.
+func (wh *webhooks) queue(webhook string, event webhookEvent) bool {
+	wh.lock.Lock()
+	defer wh.lock.Unlock()
+
+	if wh.pending == nil {
+		wh.pending = map[string][]webhookEvent{}
+		wh.dropped = map[string]int{}
+	}
+	if len(wh.pending[webhook]) >= webhookMaxPending {
+		wh.dropped[webhook]++
+		return false
+	}
+	wh.pending[webhook] = append(wh.pending[webhook], event)
+	return len(wh.pending[webhook]) >= webhookBatchSize && !wh.sending
+}
+
+// queueWebhookEvent queues the event of the link changing the post, if the
+// link has a webhook, and sends the events right away when a batch is full.
+func (p *Plugin) queueWebhookEvent(post *model.Post, link autolink.Autolink, matches []string) {
+	webhook := webhookURL(p.getConfig(), link)
+	if webhook == "" {
+		return
+	}
+
+	event := webhookEvent{
+		Link:      link.DisplayName(),
+		PostID:    post.Id,
+		ChannelID: post.ChannelId,
+		UserID:    post.UserId,
+		Matches:   matches,
+		Timestamp: model.GetMillis(),
+	}
+	if channelName, teamName, appErr := p.resolveScope(post.ChannelId); appErr == nil {
+		event.ChannelName, event.TeamName = channelName, teamName
+	}
+	if event.Matches == nil {
+		event.Matches = []string{}
+	}
+
+	if p.webhooks.queue(webhook, event) {
+		go p.sendWebhooks()
+	}
+}
+
+// sendWebhooks sends the queued events to their webhooks. The events of a
+// webhook that failed are dropped, for a webhook that is down not to hold up
+// the others.
+func (p *Plugin) sendWebhooks() {
+	wh := &p.webhooks
+	wh.lock.Lock()
+	if wh.sending {
+		wh.lock.Unlock()
+		return
+	}
+	wh.sending = true
+	pending, dropped := wh.pending, wh.dropped
+	wh.pending, wh.dropped = nil, nil
+	wh.lock.Unlock()
+
+	defer func() {
+		wh.lock.Lock()
+		wh.sending = false
+		wh.lock.Unlock()
+	}()
+
+	for webhook, events := range pending {
+		// Webhook URLs often embed a secret, only their host is logged
+		host := webhook
+		if u, err := url.Parse(webhook); err == nil {
+			host = u.Host
+		}
+		if dropped[webhook] > 0 {
+			p.API.LogWarn("Too many webhook events queued, the newest were dropped", "host", host, "dropped", dropped[webhook])
+		}
+		for len(events) > 0 {
+			n := webhookBatchSize
+			if n > len(events) {
+				n = len(events)
+			}
+			if err := postWebhook(webhook, events[:n]); err != nil {
+				p.API.LogWarn("Failed to send the events to the webhook", "host", host, "events", len(events), "error", err.Error())
+				break
+			}
+			events = events[n:]
+		}
+	}
+}
+
+var webhookClient = &http.Client{Timeout: webhookRequestTimeout}
+
+func postWebhook(webhook string, events []webhookEvent) error {
+	body, err := json.Marshal(webhookPayload{Events: events})
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the events")
+	}
+	resp, err := webhookClient.Post(webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// The error would include the URL
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		return errors.Wrap(err, "failed to send the request")
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("unexpected status %v", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package enrich
+
+import (
+	"sync"
+	"time"
+)
+
+// maxCacheEntries is the maximum number of lookups a cache keeps. The entries
+// expiring first are dropped when it is reached.
+const maxCacheEntries = 10000
+
+type cacheEntry struct {
+	value   string
+	ok      bool
+	expires time.Time
+}
+
+// Cache is a concurrency-safe map of lookup results with per-entry expiry,
+// holding up to maxCacheEntries. Failed lookups are cached too, so that an
+// unavailable upstream is not queried for every post.
+type Cache struct {
+	ttl        time.Duration
+	failureTTL time.Duration
+	now        func() time.Time
+
+	lock    sync.Mutex
+	entries map[string]cacheEntry
+}
+
+// NewCache creates a cache keeping successful lookups for ttl and failed ones
+// for failureTTL.
+func NewCache(ttl, failureTTL time.Duration) *Cache {
+	return &Cache{
+		ttl:        ttl,
+		failureTTL: failureTTL,
+		now:        time.Now,
+		entries:    map[string]cacheEntry{},
+	}
+}
+
+// Get returns the cached value for key, whether the lookup succeeded, and
+// whether the key was found in the cache at all.
+func (c *Cache) Get(key string) (value string, ok bool, found bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry, found := c.entries[key]
+	if !found {
+		return "", false, false
+	}
+	if c.now().After(entry.expires) {
+		delete(c.entries, key)
+		return "", false, false
+	}
+	return entry.value, entry.ok, true
+}
+
+// Set stores the result of a lookup.
+func (c *Cache) Set(key, value string, ok bool) {
+	ttl := c.ttl
+	if !ok {
+		ttl = c.failureTTL
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, found := c.entries[key]; !found && len(c.entries) >= maxCacheEntries {
+		c.evict()
+	}
+	c.entries[key] = cacheEntry{
+		value:   value,
+		ok:      ok,
+		expires: c.now().Add(ttl),
+	}
+}
+
+// evict drops the expired entries, or the entry expiring first if none is.
+func (c *Cache) evict() {
+	now := c.now()
+	first := ""
+	var firstExpires time.Time
+	for key, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, key)
+			continue
+		}
+		if first == "" || entry.expires.Before(firstExpires) {
+			first, firstExpires = key, entry.expires
+		}
+	}
+	if len(c.entries) >= maxCacheEntries {
+		delete(c.entries, first)
+	}
+}
+
+// Delete removes the result of a lookup, for the next one to be made again.
+func (c *Cache) Delete(key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.entries, key)
+}
@@ -0,0 +1,56 @@
+package enrich
+
+import "time"
+
+// Enricher adds details looked up from an external system to the text
+// generated for a match, like Jira and CVE.
+type Enricher interface {
+	Enrich(replacement string) string
+}
+
+// deadlineEnricher is an Enricher whose lookups can be cut short, like
+// autolink.DeadlineEnricher.
+type deadlineEnricher interface {
+	Enricher
+	EnrichBefore(replacement string, deadline time.Time) string
+}
+
+// Cached is an enricher keeping the text another enricher generated for each
+// replacement in a cache of its own, e.g. for a link referencing the same
+// tickets over and over to look them up less often than the enricher caches
+// them. The replacements the enricher left as is, e.g. because the lookup
+// failed, are not cached, the enricher caching its failures itself.
+type Cached struct {
+	enricher Enricher
+	cache    *Cache
+}
+
+// NewCached creates an enricher caching the results of enricher in cache,
+// which may be shared by the successive enrichers of a link, e.g. across
+// configuration changes.
+func NewCached(enricher Enricher, cache *Cache) *Cached {
+	return &Cached{enricher: enricher, cache: cache}
+}
+
+// Enrich implements autolink.Enricher.
+func (c *Cached) Enrich(replacement string) string {
+	return c.EnrichBefore(replacement, time.Time{})
+}
+
+// EnrichBefore implements autolink.DeadlineEnricher, the deadline applying to
+// the enricher if it supports deadlines.
+func (c *Cached) EnrichBefore(replacement string, deadline time.Time) string {
+	if enriched, _, found := c.cache.Get(replacement); found {
+		return enriched
+	}
+	var enriched string
+	if e, ok := c.enricher.(deadlineEnricher); ok && !deadline.IsZero() {
+		enriched = e.EnrichBefore(replacement, deadline)
+	} else {
+		enriched = c.enricher.Enrich(replacement)
+	}
+	if enriched != replacement {
+		c.cache.Set(replacement, enriched, true)
+	}
+	return enriched
+}
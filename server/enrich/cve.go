@@ -0,0 +1,203 @@
+package enrich
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// CVEs rarely change once published, and the NVD API is rate limited
+	cveCacheTTL        = 24 * time.Hour
+	cveFailureCacheTTL = 10 * time.Minute
+	cveRequestTimeout  = 5 * time.Second
+
+	// cveSummaryLength is the maximum number of characters of the
+	// description of a CVE appended to links.
+	cveSummaryLength = 80
+
+	// NVDURL is the base URL of the National Vulnerability Database API.
+	NVDURL = "https://services.nvd.nist.gov"
+)
+
+var cveIDRegexp = regexp.MustCompile(`^CVE-[0-9]{4}-[0-9]{4,}$`)
+
+type nvdResponse struct {
+	Vulnerabilities []struct {
+		CVE nvdCVE `json:"cve"`
+	} `json:"vulnerabilities"`
+}
+
+type nvdCVE struct {
+	ID           string `json:"id"`
+	Descriptions []struct {
+		Lang  string `json:"lang"`
+		Value string `json:"value"`
+	} `json:"descriptions"`
+	Metrics struct {
+		CVSSMetricV31 []nvdMetric `json:"cvssMetricV31"`
+		CVSSMetricV30 []nvdMetric `json:"cvssMetricV30"`
+		CVSSMetricV2  []nvdMetric `json:"cvssMetricV2"`
+	} `json:"metrics"`
+}
+
+// nvdMetric is a CVSS score. The severity of CVSS v2 scores is outside of
+// their data.
+type nvdMetric struct {
+	CVSSData struct {
+		BaseScore    float64 `json:"baseScore"`
+		BaseSeverity string  `json:"baseSeverity"`
+	} `json:"cvssData"`
+	BaseSeverity string `json:"baseSeverity"`
+}
+
+// CVE appends the severity and summary of a CVE, looked up in the National
+// Vulnerability Database, to generated links whose text is a CVE ID, e.g.
+// `[CVE-2021-44228](...)` becomes
+// `[CVE-2021-44228: Apache Log4j2 JNDI features do not protect… (Critical 10.0)](...)`.
+type CVE struct {
+	BaseURL string
+	APIKey  string
+	Client  *http.Client
+
+	cache   *Cache
+	lookups *lookups
+}
+
+// NewCVE creates a CVE enricher. The API key is optional, and raises the rate
+// limit of the NVD API.
+func NewCVE(baseURL, apiKey string) *CVE {
+	if baseURL == "" {
+		baseURL = NVDURL
+	}
+	c := &CVE{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		APIKey:  apiKey,
+		Client:  &http.Client{Timeout: cveRequestTimeout},
+		cache:   NewCache(cveCacheTTL, cveFailureCacheTTL),
+	}
+	c.lookups = newLookups(c.cache, func(id string) (string, error) {
+		cve, err := c.fetchCVE(id)
+		if err != nil {
+			return "", err
+		}
+		return formatCVEDetails(cve), nil
+	})
+	return c
+}
+
+// Enrich implements autolink.Enricher. The replacement is returned unchanged
+// if it doesn't contain a link labeled with a CVE ID or the CVE can not be
+// fetched.
+func (c *CVE) Enrich(replacement string) string {
+	return c.EnrichBefore(replacement, time.Now().Add(cveRequestTimeout))
+}
+
+// EnrichBefore implements autolink.DeadlineEnricher. The replacement is also
+// returned unchanged if the CVE is not fetched by the deadline.
+func (c *CVE) EnrichBefore(replacement string, deadline time.Time) string {
+	loc := markdownLinkRegexp.FindStringSubmatchIndex(replacement)
+	if loc == nil {
+		return replacement
+	}
+	id := strings.ToUpper(replacement[loc[2]:loc[3]])
+	if !cveIDRegexp.MatchString(id) {
+		return replacement
+	}
+
+	details, ok := c.lookups.get(id, deadline)
+	if !ok {
+		return replacement
+	}
+
+	return replacement[:loc[3]] + details + replacement[loc[3]:]
+}
+
+func (c *CVE) fetchCVE(id string) (*nvdCVE, error) {
+	req, err := http.NewRequest(http.MethodGet,
+		fmt.Sprintf("%s/rest/json/cves/2.0?cveId=%s", c.BaseURL, url.QueryEscape(id)), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.APIKey != "" {
+		req.Header.Set("apiKey", c.APIKey)
+	}
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch %s", id)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("the NVD returned %v for %s", resp.StatusCode, id)
+	}
+
+	var found nvdResponse
+	if err = json.NewDecoder(resp.Body).Decode(&found); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode %s", id)
+	}
+	if len(found.Vulnerabilities) == 0 {
+		return nil, errors.Errorf("%s was not found", id)
+	}
+	return &found.Vulnerabilities[0].CVE, nil
+}
+
+func formatCVEDetails(cve *nvdCVE) string {
+	details := ""
+	for _, description := range cve.Descriptions {
+		if description.Lang == "en" {
+			details = ": " + escapeLinkText(truncateText(description.Value, cveSummaryLength))
+			break
+		}
+	}
+	if severity := cveSeverity(cve); severity != "" {
+		details += " (" + severity + ")"
+	}
+	return details
+}
+
+// cveSeverity returns the severity and score of the most recent version of
+// CVSS the CVE was scored with, e.g. "Critical 10.0".
+func cveSeverity(cve *nvdCVE) string {
+	for _, metrics := range [][]nvdMetric{cve.Metrics.CVSSMetricV31, cve.Metrics.CVSSMetricV30, cve.Metrics.CVSSMetricV2} {
+		if len(metrics) == 0 {
+			continue
+		}
+		m := metrics[0]
+		severity := m.CVSSData.BaseSeverity
+		if severity == "" {
+			severity = m.BaseSeverity
+		}
+		if severity == "" {
+			return fmt.Sprintf("%.1f", m.CVSSData.BaseScore)
+		}
+		return fmt.Sprintf("%s %.1f", strings.Title(strings.ToLower(severity)), m.CVSSData.BaseScore)
+	}
+	return ""
+}
+
+// truncateText shortens text to at most n characters, ending it with an
+// ellipsis if it was truncated.
+func truncateText(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= n {
+		return text
+	}
+	i := 0
+	for j := range text {
+		if i == n-1 {
+			return strings.TrimSpace(text[:j]) + "…"
+		}
+		i++
+	}
+	return text
+}
@@ -0,0 +1,79 @@
+package enrich
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+func TestCVEEnrich(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "/rest/json/cves/2.0", r.URL.Path)
+		assert.Equal(t, "key", r.Header.Get("apiKey"))
+
+		switch r.URL.Query().Get("cveId") {
+		case "CVE-2021-44228":
+			fmt.Fprint(w, `{"vulnerabilities": [{"cve": {"id": "CVE-2021-44228",
+				"descriptions": [{"lang": "es", "value": "Log4j"}, {"lang": "en", "value": "Apache Log4j2 JNDI [features] do not protect against attacker controlled LDAP and other JNDI related endpoints."}],
+				"metrics": {"cvssMetricV31": [{"cvssData": {"baseScore": 10.0, "baseSeverity": "CRITICAL"}}],
+					"cvssMetricV2": [{"cvssData": {"baseScore": 9.3}, "baseSeverity": "HIGH"}]}}}]}`)
+		case "CVE-1999-0001":
+			fmt.Fprint(w, `{"vulnerabilities": [{"cve": {"id": "CVE-1999-0001",
+				"descriptions": [{"lang": "en", "value": "Old  bug."}],
+				"metrics": {"cvssMetricV2": [{"cvssData": {"baseScore": 5.0}, "baseSeverity": "MEDIUM"}]}}}]}`)
+		case "CVE-2099-0001":
+			fmt.Fprint(w, `{"vulnerabilities": []}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	c := NewCVE(server.URL+"/", "key")
+
+	enriched := "[CVE-2021-44228: Apache Log4j2 JNDI \\[features\\] do not protect against attacker controlled LDAP a… (Critical 10.0)](https://nvd/CVE-2021-44228)"
+	assert.Equal(t, enriched, c.Enrich("[CVE-2021-44228](https://nvd/CVE-2021-44228)"))
+	assert.Equal(t, 1, requests)
+
+	// cached
+	assert.Equal(t, enriched, c.Enrich("[CVE-2021-44228](https://nvd/CVE-2021-44228)"))
+	assert.Equal(t, 1, requests)
+
+	assert.Equal(t, "[CVE-1999-0001: Old bug. (Medium 5.0)](https://nvd/CVE-1999-0001)", c.Enrich("[CVE-1999-0001](https://nvd/CVE-1999-0001)"))
+
+	// failed lookups leave the link untouched and are cached
+	assert.Equal(t, "[CVE-2099-0001](https://nvd/CVE-2099-0001)", c.Enrich("[CVE-2099-0001](https://nvd/CVE-2099-0001)"))
+	assert.Equal(t, "[CVE-2099-0001](https://nvd/CVE-2099-0001)", c.Enrich("[CVE-2099-0001](https://nvd/CVE-2099-0001)"))
+	assert.Equal(t, 3, requests)
+
+	// not a CVE ID
+	assert.Equal(t, "[advisory](https://nvd/CVE-2021-44228)", c.Enrich("[advisory](https://nvd/CVE-2021-44228)"))
+	assert.Equal(t, 3, requests)
+}
+
+func TestCVEEnrichPreset(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"vulnerabilities": [{"cve": {"descriptions": [{"lang": "en", "value": "Summary of %s"}]}}]}`, r.URL.Query().Get("cveId"))
+	}))
+	defer server.Close()
+
+	preset, ok := autolink.GetPreset("cve")
+	require.True(t, ok)
+	l, err := preset.Link(nil)
+	require.NoError(t, err)
+	l.Enrich = "cve"
+	require.NoError(t, l.Compile())
+	l.SetEnricher(NewCVE(server.URL, ""))
+
+	assert.Equal(t,
+		"Patch [CVE-2021-44228: Summary of CVE-2021-44228](https://nvd.nist.gov/vuln/detail/CVE-2021-44228).",
+		l.Replace("Patch CVE-2021-44228."))
+}
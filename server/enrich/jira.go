@@ -0,0 +1,144 @@
+package enrich
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	jiraCacheTTL        = 10 * time.Minute
+	jiraFailureCacheTTL = time.Minute
+	jiraRequestTimeout  = 2 * time.Second
+)
+
+var (
+	// markdownLinkRegexp matches the first markdown link of a replacement,
+	// capturing its label and destination.
+	markdownLinkRegexp = regexp.MustCompile(`\[([^\[\]]+)\]\(([^()\s]+)\)`)
+	jiraKeyRegexp      = regexp.MustCompile(`^[A-Z][A-Z0-9_]+-[0-9]+$`)
+)
+
+type jiraIssue struct {
+	Key    string `json:"key"`
+	Fields struct {
+		Summary string `json:"summary"`
+		Status  struct {
+			Name string `json:"name"`
+		} `json:"status"`
+	} `json:"fields"`
+}
+
+// Jira appends the summary and status of a Jira issue to generated links
+// whose text is an issue key, e.g. `[ABC-123](...)` becomes
+// `[ABC-123: Fix login crash (In Progress)](...)`.
+type Jira struct {
+	BaseURL  string
+	Username string
+	Token    string
+	Client   *http.Client
+
+	cache   *Cache
+	lookups *lookups
+}
+
+// NewJira creates a Jira enricher. When username is empty the token is sent as
+// a bearer token (Jira Server/Data Center personal access token), otherwise
+// basic authentication is used (Jira Cloud API token).
+func NewJira(baseURL, username, token string) *Jira {
+	j := &Jira{
+		BaseURL:  strings.TrimSuffix(baseURL, "/"),
+		Username: username,
+		Token:    token,
+		Client:   &http.Client{Timeout: jiraRequestTimeout},
+		cache:    NewCache(jiraCacheTTL, jiraFailureCacheTTL),
+	}
+	j.lookups = newLookups(j.cache, func(key string) (string, error) {
+		issue, err := j.fetchIssue(key)
+		if err != nil {
+			return "", err
+		}
+		return formatIssueDetails(issue), nil
+	})
+	return j
+}
+
+// Enrich implements autolink.Enricher. The replacement is returned unchanged
+// if it doesn't contain a link labeled with an issue key or the issue can not
+// be fetched.
+func (j *Jira) Enrich(replacement string) string {
+	return j.EnrichBefore(replacement, time.Now().Add(jiraRequestTimeout))
+}
+
+// EnrichBefore implements autolink.DeadlineEnricher. The replacement is also
+// returned unchanged if the issue is not fetched by the deadline.
+func (j *Jira) EnrichBefore(replacement string, deadline time.Time) string {
+	loc := markdownLinkRegexp.FindStringSubmatchIndex(replacement)
+	if loc == nil {
+		return replacement
+	}
+	key := replacement[loc[2]:loc[3]]
+	if !jiraKeyRegexp.MatchString(key) {
+		return replacement
+	}
+
+	details, ok := j.lookups.get(key, deadline)
+	if !ok {
+		return replacement
+	}
+
+	return replacement[:loc[3]] + details + replacement[loc[3]:]
+}
+
+func (j *Jira) fetchIssue(key string) (*jiraIssue, error) {
+	req, err := http.NewRequest(http.MethodGet,
+		fmt.Sprintf("%s/rest/api/2/issue/%s?fields=summary,status", j.BaseURL, url.PathEscape(key)), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	switch {
+	case j.Username != "":
+		req.SetBasicAuth(j.Username, j.Token)
+	case j.Token != "":
+		req.Header.Set("Authorization", "Bearer "+j.Token)
+	}
+
+	resp, err := j.Client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch Jira issue %s", key)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("Jira returned %v for issue %s", resp.StatusCode, key)
+	}
+
+	var issue jiraIssue
+	if err = json.NewDecoder(resp.Body).Decode(&issue); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode Jira issue %s", key)
+	}
+	return &issue, nil
+}
+
+func formatIssueDetails(issue *jiraIssue) string {
+	details := ": " + escapeLinkText(issue.Fields.Summary)
+	if issue.Fields.Status.Name != "" {
+		details += " (" + escapeLinkText(issue.Fields.Status.Name) + ")"
+	}
+	return details
+}
+
+var linkTextEscaper = strings.NewReplacer(`\`, `\\`, `[`, `\[`, `]`, `\]`)
+
+// escapeLinkText prevents text looked up from an external system from breaking
+// the markdown link it is inserted into.
+func escapeLinkText(text string) string {
+	return linkTextEscaper.Replace(strings.TrimSpace(text))
+}
@@ -0,0 +1,150 @@
+package enrich
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+func TestJiraEnrich(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		username, password, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "user", username)
+		assert.Equal(t, "token", password)
+
+		switch r.URL.Path {
+		case "/rest/api/2/issue/MM-123":
+			fmt.Fprint(w, `{"key": "MM-123", "fields": {"summary": "Fix [login] crash", "status": {"name": "In Progress"}}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	j := NewJira(server.URL+"/", "user", "token")
+
+	assert.Equal(t, "[MM-123: Fix \\[login\\] crash (In Progress)](https://jira/browse/MM-123)",
+		j.Enrich("[MM-123](https://jira/browse/MM-123)"))
+	assert.Equal(t, 1, requests)
+
+	// cached
+	assert.Equal(t, " [MM-123: Fix \\[login\\] crash (In Progress)](https://jira/browse/MM-123)",
+		j.Enrich(" [MM-123](https://jira/browse/MM-123)"))
+	assert.Equal(t, 1, requests)
+
+	// failed lookups leave the link untouched and are cached
+	assert.Equal(t, "[MM-404](https://jira/browse/MM-404)", j.Enrich("[MM-404](https://jira/browse/MM-404)"))
+	assert.Equal(t, "[MM-404](https://jira/browse/MM-404)", j.Enrich("[MM-404](https://jira/browse/MM-404)"))
+	assert.Equal(t, 2, requests)
+
+	// not an issue key
+	assert.Equal(t, "[see ticket](https://jira/browse/MM-123)", j.Enrich("[see ticket](https://jira/browse/MM-123)"))
+	assert.Equal(t, 2, requests)
+}
+
+func TestJiraEnrichLink(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"fields": {"summary": "Summary of %s", "status": {"name": "Done"}}}`, r.URL.Path[len("/rest/api/2/issue/"):])
+	}))
+	defer server.Close()
+
+	l := autolink.Autolink{
+		Pattern:  "(MM)(-)(?P<jira_id>\\d+)",
+		Template: "[MM-$jira_id](https://jira/browse/MM-$jira_id)",
+		Enrich:   "jira",
+	}
+	require.NoError(t, l.Compile())
+	l.SetEnricher(NewJira(server.URL, "", "token"))
+
+	assert.Equal(t,
+		"See [MM-1: Summary of MM-1 (Done)](https://jira/browse/MM-1) and [MM-2: Summary of MM-2 (Done)](https://jira/browse/MM-2).",
+		l.Replace("See MM-1 and MM-2."))
+}
+
+type countingEnricher struct {
+	calls int
+}
+
+func (e *countingEnricher) Enrich(replacement string) string {
+	e.calls++
+	if replacement == "[MM-404](https://jira/browse/MM-404)" {
+		return replacement
+	}
+	return replacement + fmt.Sprintf(" (lookup %d)", e.calls)
+}
+
+func TestCachedEnrich(t *testing.T) {
+	now := time.Now()
+	cache := NewCache(time.Hour, 0)
+	cache.now = func() time.Time { return now }
+	inner := &countingEnricher{}
+	cached := NewCached(inner, cache)
+
+	assert.Equal(t, "[MM-1](https://jira/browse/MM-1) (lookup 1)", cached.Enrich("[MM-1](https://jira/browse/MM-1)"))
+	assert.Equal(t, "[MM-1](https://jira/browse/MM-1) (lookup 1)", cached.Enrich("[MM-1](https://jira/browse/MM-1)"))
+	assert.Equal(t, 1, inner.calls)
+
+	// failed lookups are left to the enricher
+	cached.Enrich("[MM-404](https://jira/browse/MM-404)")
+	cached.Enrich("[MM-404](https://jira/browse/MM-404)")
+	assert.Equal(t, 3, inner.calls)
+
+	// the cache is shared by the next enrichers of the link
+	cached = NewCached(inner, cache)
+	assert.Equal(t, "[MM-1](https://jira/browse/MM-1) (lookup 1)", cached.Enrich("[MM-1](https://jira/browse/MM-1)"))
+
+	now = now.Add(time.Hour + time.Second)
+	assert.Equal(t, "[MM-1](https://jira/browse/MM-1) (lookup 4)", cached.Enrich("[MM-1](https://jira/browse/MM-1)"))
+}
+
+func TestJiraEnrichDeadline(t *testing.T) {
+	release := make(chan struct{})
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		<-release
+		fmt.Fprint(w, `{"key": "MM-1", "fields": {"summary": "Slow", "status": {"name": "Done"}}}`)
+	}))
+	defer server.Close()
+
+	j := NewJira(server.URL, "", "token")
+	started := time.Now()
+	assert.Equal(t, "[MM-1](https://jira/browse/MM-1)",
+		j.EnrichBefore("[MM-1](https://jira/browse/MM-1)", started.Add(50*time.Millisecond)))
+	assert.Less(t, int64(time.Since(started)), int64(time.Second), "the post does not wait past the deadline")
+
+	// The lookup goes on in the background, for the next posts
+	close(release)
+	assert.Equal(t, "[MM-1: Slow (Done)](https://jira/browse/MM-1)", j.Enrich("[MM-1](https://jira/browse/MM-1)"))
+	assert.Equal(t, "[MM-1: Slow (Done)](https://jira/browse/MM-1)",
+		j.EnrichBefore("[MM-1](https://jira/browse/MM-1)", time.Now()))
+	assert.Equal(t, 1, requests)
+}
+
+func TestCacheLimit(t *testing.T) {
+	now := time.Now()
+	cache := NewCache(time.Hour, time.Minute)
+	cache.now = func() time.Time { return now }
+
+	cache.Set("failed", "", false)
+	for i := 0; i < maxCacheEntries; i++ {
+		now = now.Add(time.Millisecond)
+		cache.Set(fmt.Sprintf("key%d", i), "value", true)
+	}
+	assert.Len(t, cache.entries, maxCacheEntries)
+	_, _, found := cache.Get("failed")
+	assert.False(t, found, "the entry expiring first is dropped")
+	value, _, found := cache.Get("key0")
+	assert.True(t, found)
+	assert.Equal(t, "value", value)
+}
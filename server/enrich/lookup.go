@@ -0,0 +1,85 @@
+package enrich
+
+import (
+	"sync"
+	"time"
+)
+
+// maxRunningLookups is the maximum number of lookups an enricher runs at once.
+// The matches found while it is reached are left as they are.
+const maxRunningLookups = 10
+
+// lookups runs the lookups of an enricher in the background, for the posts
+// not to wait for them past their deadline. A lookup still running at the
+// deadline is cached when it is done, for the next posts.
+type lookups struct {
+	cache *Cache
+	fetch func(key string) (string, error)
+
+	lock    sync.Mutex
+	running map[string]*lookup
+}
+
+// lookup is a lookup running in the background, whose result is set before
+// done is closed.
+type lookup struct {
+	done    chan struct{}
+	details string
+	ok      bool
+}
+
+func newLookups(cache *Cache, fetch func(key string) (string, error)) *lookups {
+	return &lookups{
+		cache:   cache,
+		fetch:   fetch,
+		running: map[string]*lookup{},
+	}
+}
+
+// get returns the details looked up for the key, and whether the lookup
+// succeeded by the deadline.
+func (l *lookups) get(key string, deadline time.Time) (string, bool) {
+	if details, ok, found := l.cache.Get(key); found {
+		return details, ok
+	}
+
+	running := l.start(key)
+	if running == nil {
+		return "", false
+	}
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case <-running.done:
+		return running.details, running.ok
+	case <-timer.C:
+		return "", false
+	}
+}
+
+// start starts the lookup of the key unless it is already running, returning
+// nil if too many lookups are running.
+func (l *lookups) start(key string) *lookup {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if running, ok := l.running[key]; ok {
+		return running
+	}
+	if len(l.running) >= maxRunningLookups {
+		return nil
+	}
+	running := &lookup{done: make(chan struct{})}
+	l.running[key] = running
+	go func() {
+		details, err := l.fetch(key)
+		running.details, running.ok = details, err == nil
+		l.cache.Set(key, details, running.ok)
+
+		l.lock.Lock()
+		delete(l.running, key)
+		l.lock.Unlock()
+		close(running.done)
+	}()
+	return running
+}
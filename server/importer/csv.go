@@ -0,0 +1,146 @@
+package importer
+
+import (
+	"encoding/csv"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+// CSV columns of a link set. A CSV without a header naming its columns is
+// read as a list of term and URL pairs.
+const (
+	csvName     = "name"
+	csvPattern  = "pattern"
+	csvTemplate = "template"
+	csvScope    = "scope"
+	csvTerm     = "term"
+	csvURL      = "url"
+)
+
+// ParseCSV reads links from CSV. The first row may name the columns, either
+// name, pattern, template and scope, with the scope being a whitespace-separated
+// list, or term and url. Without such a header every row is a term and a URL,
+// like a glossary, and each term links to its URL wherever it appears as a
+// whole word. The links are compiled to check them.
+func ParseCSV(r io.Reader) ([]autolink.Autolink, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the CSV")
+	}
+
+	columns := map[string]int{}
+	if len(rows) > 0 {
+		for i, title := range rows[0] {
+			title = strings.ToLower(strings.TrimSpace(title))
+			switch title {
+			case csvName, csvPattern, csvTemplate, csvScope, csvTerm, csvURL:
+				columns[title] = i
+			}
+		}
+	}
+	firstRow := 0
+	if len(columns) > 0 {
+		firstRow = 1
+	} else {
+		columns = map[string]int{csvTerm: 0, csvURL: 1}
+	}
+	_, hasPattern := columns[csvPattern]
+	_, hasTemplate := columns[csvTemplate]
+	_, hasTerm := columns[csvTerm]
+	_, hasURL := columns[csvURL]
+	isDictionary := hasTerm && hasURL
+	if !isDictionary && !(hasPattern && hasTemplate) {
+		return nil, errors.New("the CSV must have either pattern and template columns, or term and url columns")
+	}
+
+	links := []autolink.Autolink{}
+	for n, row := range rows[firstRow:] {
+		value := func(column string) string {
+			i, ok := columns[column]
+			if !ok || i >= len(row) {
+				return ""
+			}
+			return strings.TrimSpace(row[i])
+		}
+		if strings.TrimSpace(strings.Join(row, "")) == "" {
+			continue
+		}
+
+		var link autolink.Autolink
+		if isDictionary {
+			term, url := value(csvTerm), value(csvURL)
+			if term == "" || url == "" {
+				return nil, errors.Errorf("row %d: a term and a URL are required", firstRow+n+1)
+			}
+			link = TermToLink(term, url)
+		} else {
+			link = autolink.Autolink{
+				Name:     value(csvName),
+				Pattern:  value(csvPattern),
+				Template: value(csvTemplate),
+			}
+			if link.Pattern == "" || link.Template == "" {
+				return nil, errors.Errorf("row %d: a pattern and a template are required", firstRow+n+1)
+			}
+		}
+		if _, ok := columns[csvScope]; ok {
+			link.Scope = strings.Fields(value(csvScope))
+		}
+
+		compiled := link
+		if err := compiled.Compile(); err != nil {
+			return nil, errors.Wrapf(err, "row %d", firstRow+n+1)
+		}
+		links = append(links, link)
+	}
+	return links, nil
+}
+
+// TermToLink returns a link replacing the term with a link to url, when it is
+// not part of a longer word. Unlike WordMatch, this works for terms starting or
+// ending with punctuation, like `C++`.
+func TermToLink(term, url string) autolink.Autolink {
+	return autolink.Autolink{
+		Name:             term,
+		Pattern:          regexp.QuoteMeta(term),
+		Template:         "[" + strings.ReplaceAll(term, "$", "$$") + "](" + strings.ReplaceAll(url, "$", "$$") + ")",
+		UnicodeWordMatch: true,
+	}
+}
+
+// Merge adds the imported links to links, updating the pattern, template and,
+// if set, the scope of the links with the same name instead. It returns the
+// names of the added and updated links.
+func Merge(links, imported []autolink.Autolink) (merged []autolink.Autolink, added, updated []string) {
+	merged = append([]autolink.Autolink{}, links...)
+	for _, link := range imported {
+		replaced := false
+		for i := range merged {
+			if link.Name == "" || merged[i].Name != link.Name {
+				continue
+			}
+			merged[i].Pattern = link.Pattern
+			merged[i].Template = link.Template
+			if link.Scope != nil {
+				merged[i].Scope = link.Scope
+			}
+			replaced = true
+			break
+		}
+		if replaced {
+			updated = append(updated, link.Name)
+		} else {
+			merged = append(merged, link)
+			added = append(added, link.DisplayName())
+		}
+	}
+	return merged, added, updated
+}
@@ -0,0 +1,73 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+func TestParseCSV(t *testing.T) {
+	t.Run("columns", func(t *testing.T) {
+		links, err := ParseCSV(strings.NewReader(
+			"Name,Pattern,Template,Scope\n" +
+				"jira,MM-(?P<id>\\d+),[MM-${id}](https://jira.example.com/browse/MM-${id}),\"team/town-square other\"\n" +
+				"\n" +
+				",TODO,**TODO**,\n"))
+		require.NoError(t, err)
+		assert.Equal(t, []autolink.Autolink{{
+			Name:     "jira",
+			Pattern:  `MM-(?P<id>\d+)`,
+			Template: "[MM-${id}](https://jira.example.com/browse/MM-${id})",
+			Scope:    []string{"team/town-square", "other"},
+		}, {
+			Pattern:  "TODO",
+			Template: "**TODO**",
+			Scope:    []string{},
+		}}, links)
+	})
+
+	t.Run("terms", func(t *testing.T) {
+		links, err := ParseCSV(strings.NewReader("SLA, https://kb.example.com/sla\nC++,https://kb.example.com/c$$\n"))
+		require.NoError(t, err)
+		require.Len(t, links, 2)
+		assert.Equal(t, TermToLink("SLA", "https://kb.example.com/sla"), links[0])
+
+		require.NoError(t, links[1].Compile())
+		assert.Equal(t, "see [C++](https://kb.example.com/c$$)", links[1].Replace("see C++"))
+	})
+
+	for name, csv := range map[string]string{
+		"no template":     "name,pattern\na,b\n",
+		"missing url":     "term,url\nSLA\n",
+		"invalid pattern": "pattern,template\n(,x\n",
+		"invalid csv":     "a,\"b\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseCSV(strings.NewReader(csv))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	links := []autolink.Autolink{
+		{Name: "kept", Pattern: "a", Template: "b"},
+		{Name: "updated", Pattern: "c", Template: "d", Scope: []string{"team"}, Disabled: true},
+	}
+	merged, added, updated := Merge(links, []autolink.Autolink{
+		{Name: "updated", Pattern: "e", Template: "f"},
+		{Name: "added", Pattern: "g", Template: "h"},
+	})
+	assert.Equal(t, []autolink.Autolink{
+		{Name: "kept", Pattern: "a", Template: "b"},
+		{Name: "updated", Pattern: "e", Template: "f", Scope: []string{"team"}, Disabled: true},
+		{Name: "added", Pattern: "g", Template: "h"},
+	}, merged)
+	assert.Equal(t, []string{"added"}, added)
+	assert.Equal(t, []string{"updated"}, updated)
+	assert.Equal(t, "c", links[1].Pattern, "the links are not modified")
+}
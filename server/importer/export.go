@@ -0,0 +1,116 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// exportMessageColumns are the CSV columns holding the messages of the posts,
+// e.g. `Post Message` of the CSV of the channel export plugin.
+var exportMessageColumns = map[string]bool{
+	"message":      true,
+	"post message": true,
+	"post_message": true,
+}
+
+// exportedPost is a post of a JSON export, either a post of the channel
+// export plugin, or a line of a Mattermost bulk export whose type is post or
+// direct_post.
+type exportedPost struct {
+	Message     string         `json:"message"`
+	PostMessage string         `json:"post_message"`
+	Post        *exportedPost  `json:"post"`
+	DirectPost  *exportedPost  `json:"direct_post"`
+	Replies     []exportedPost `json:"replies"`
+}
+
+// messages returns the message of the post and of its replies.
+func (p exportedPost) messages() []string {
+	var messages []string
+	switch {
+	case p.Post != nil:
+		messages = p.Post.messages()
+	case p.DirectPost != nil:
+		messages = p.DirectPost.messages()
+	case p.Message != "":
+		messages = append(messages, p.Message)
+	case p.PostMessage != "":
+		messages = append(messages, p.PostMessage)
+	}
+	for _, reply := range p.Replies {
+		messages = append(messages, reply.messages()...)
+	}
+	return messages
+}
+
+// ParseChannelExport reads the messages of the posts of exported channels: a
+// JSON list of posts, JSON lines such as a Mattermost bulk export, or a CSV
+// with a message column, like the exports of the channel export plugin.
+func ParseChannelExport(data []byte) ([]string, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, errors.New("the export is empty")
+	}
+
+	switch trimmed[0] {
+	case '[':
+		var posts []exportedPost
+		if err := json.Unmarshal(trimmed, &posts); err != nil {
+			return nil, errors.Wrap(err, "failed to read the JSON export")
+		}
+		var messages []string
+		for _, post := range posts {
+			messages = append(messages, post.messages()...)
+		}
+		return messages, nil
+
+	case '{':
+		var messages []string
+		scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+		scanner.Buffer(make([]byte, 64*1024), len(trimmed))
+		for line := 1; scanner.Scan(); line++ {
+			if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+				continue
+			}
+			var post exportedPost
+			if err := json.Unmarshal(scanner.Bytes(), &post); err != nil {
+				return nil, errors.Wrapf(err, "failed to read line %d of the JSON export", line)
+			}
+			messages = append(messages, post.messages()...)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, errors.Wrap(err, "failed to read the JSON export")
+		}
+		return messages, nil
+	}
+
+	reader := csv.NewReader(bytes.NewReader(trimmed))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the CSV export")
+	}
+	column := -1
+	for i, title := range rows[0] {
+		if exportMessageColumns[strings.ToLower(strings.TrimSpace(title))] {
+			column = i
+			break
+		}
+	}
+	if column < 0 {
+		return nil, errors.New("the CSV export has no message column")
+	}
+	var messages []string
+	for _, row := range rows[1:] {
+		if column < len(row) && row[column] != "" {
+			messages = append(messages, row[column])
+		}
+	}
+	return messages, nil
+}
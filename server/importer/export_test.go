@@ -0,0 +1,49 @@
+package importer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseChannelExport(t *testing.T) {
+	for name, tc := range map[string]struct {
+		data     string
+		expected []string
+	}{
+		"json": {
+			data:     `[{"message": "MM-1"}, {"post_message": "MM-2", "replies": [{"message": "reply"}]}]`,
+			expected: []string{"MM-1", "MM-2", "reply"},
+		},
+		"bulk export": {
+			data: "{\"type\": \"version\", \"version\": 1}\n" +
+				"{\"type\": \"post\", \"post\": {\"message\": \"MM-1\", \"replies\": [{\"message\": \"reply\"}]}}\n" +
+				"\n" +
+				"{\"type\": \"direct_post\", \"direct_post\": {\"message\": \"MM-2\"}}\n",
+			expected: []string{"MM-1", "reply", "MM-2"},
+		},
+		"csv": {
+			data:     "Post Creation Time,User Id,Post Message\n2026-10-01,user,MM-1\n2026-10-02,user,\"MM-2, MM-3\"\n2026-10-03,user,\n",
+			expected: []string{"MM-1", "MM-2, MM-3"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			messages, err := ParseChannelExport([]byte(tc.data))
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, messages)
+		})
+	}
+
+	for name, data := range map[string]string{
+		"empty":             " \n",
+		"invalid json":      `[{"message": 1}]`,
+		"invalid json line": "{\"post\": {}}\n{",
+		"no message column": "a,b\n1,2\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseChannelExport([]byte(data))
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+// DefaultGitHubAPIURL is the base URL of the public GitHub REST API.
+const DefaultGitHubAPIURL = "https://api.github.com"
+
+const githubReposPerPage = 100
+
+// GitHubAutolink is an autolink reference as returned by the GitHub REST API.
+type GitHubAutolink struct {
+	ID             int    `json:"id"`
+	KeyPrefix      string `json:"key_prefix"`
+	URLTemplate    string `json:"url_template"`
+	IsAlphanumeric bool   `json:"is_alphanumeric"`
+}
+
+type githubRepository struct {
+	Name     string `json:"name"`
+	FullName string `json:"full_name"`
+}
+
+// GitHub imports autolink references configured on GitHub repositories.
+type GitHub struct {
+	BaseURL string
+	Token   string
+	Client  *http.Client
+}
+
+// NewGitHub creates a GitHub importer authenticated with the given token. An
+// empty baseURL selects the public GitHub API.
+func NewGitHub(baseURL, token string) *GitHub {
+	if baseURL == "" {
+		baseURL = DefaultGitHubAPIURL
+	}
+	return &GitHub{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		Token:   token,
+		Client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Import fetches the autolink references of a single repository
+// (`owner/repo`), or of every repository of an owner (`owner`), and converts
+// them into links. The repositories of an owner whose references can not be
+// fetched are skipped, and returned with their error.
+func (g *GitHub) Import(target string) ([]autolink.Autolink, map[string]error, error) {
+	target = strings.Trim(target, "/")
+	if target == "" {
+		return nil, nil, errors.New("a GitHub organization or repository is required")
+	}
+
+	if strings.Contains(target, "/") {
+		refs, err := g.listAutolinks(target)
+		if err != nil {
+			return nil, nil, err
+		}
+		links := []autolink.Autolink{}
+		for _, ref := range refs {
+			links = append(links, GitHubAutolinkToLink(target, ref))
+		}
+		return links, nil, nil
+	}
+
+	repos, err := g.listRepositories(target)
+	if err != nil {
+		return nil, nil, err
+	}
+	links := []autolink.Autolink{}
+	failed := map[string]error{}
+	for _, repo := range repos {
+		refs, err := g.listAutolinks(repo)
+		if err != nil {
+			failed[repo] = err
+			continue
+		}
+		for _, ref := range refs {
+			links = append(links, GitHubAutolinkToLink(repo, ref))
+		}
+	}
+	return links, failed, nil
+}
+
+func (g *GitHub) listRepositories(owner string) ([]string, error) {
+	repos := []string{}
+	for page := 1; ; page++ {
+		var batch []githubRepository
+		path := fmt.Sprintf("/orgs/%s/repos?per_page=%d&page=%d", url.PathEscape(owner), githubReposPerPage, page)
+		status, err := g.get(path, &batch)
+		if status == http.StatusNotFound && page == 1 {
+			// Not an organization, try a user account instead
+			path = fmt.Sprintf("/users/%s/repos?per_page=%d&page=%d", url.PathEscape(owner), githubReposPerPage, page)
+			_, err = g.get(path, &batch)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range batch {
+			repos = append(repos, r.FullName)
+		}
+		if len(batch) < githubReposPerPage {
+			return repos, nil
+		}
+	}
+}
+
+func (g *GitHub) listAutolinks(repo string) ([]GitHubAutolink, error) {
+	var refs []GitHubAutolink
+	// The owner and the name are escaped separately, a name with a slash
+	// being escaped as a whole
+	segments := strings.SplitN(repo, "/", 2)
+	for i := range segments {
+		segments[i] = url.PathEscape(segments[i])
+	}
+	if _, err := g.get("/repos/"+strings.Join(segments, "/")+"/autolinks", &refs); err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+func (g *GitHub) get(path string, out interface{}) (int, error) {
+	req, err := http.NewRequest(http.MethodGet, g.BaseURL+path, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if g.Token != "" {
+		req.Header.Set("Authorization", "token "+g.Token)
+	}
+
+	resp, err := g.Client.Do(req)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to request %s", path)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, errors.Wrapf(err, "failed to read response for %s", path)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, errors.Errorf("GitHub API returned %v for %s: %s", resp.StatusCode, path, string(body))
+	}
+
+	if err = json.Unmarshal(body, out); err != nil {
+		return resp.StatusCode, errors.Wrapf(err, "failed to decode response for %s", path)
+	}
+	return resp.StatusCode, nil
+}
+
+// GitHubAutolinkToLink converts a GitHub autolink reference into a link. The
+// `<num>` placeholder of the URL template becomes the `${num}` capture.
+func GitHubAutolinkToLink(repo string, ref GitHubAutolink) autolink.Autolink {
+	reference := `[0-9]+`
+	if ref.IsAlphanumeric {
+		reference = `[a-zA-Z0-9]+`
+	}
+
+	url := strings.ReplaceAll(ref.URLTemplate, "$", "$$")
+	url = strings.ReplaceAll(url, "<num>", "${num}")
+	prefix := strings.ReplaceAll(ref.KeyPrefix, "$", "$$")
+
+	return autolink.Autolink{
+		Name:     fmt.Sprintf("GitHub %s %s", repo, ref.KeyPrefix),
+		Pattern:  regexp.QuoteMeta(ref.KeyPrefix) + `(?P<num>` + reference + `)`,
+		Template: "[" + prefix + "${num}](" + url + ")",
+	}
+}
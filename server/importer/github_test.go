@@ -0,0 +1,115 @@
+package importer
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+func TestGitHubAutolinkToLink(t *testing.T) {
+	link := GitHubAutolinkToLink("org/repo", GitHubAutolink{
+		KeyPrefix:   "TICKET-",
+		URLTemplate: "https://example.com/TICKET?query=<num>",
+	})
+	assert.Equal(t, "GitHub org/repo TICKET-", link.Name)
+	assert.Equal(t, `TICKET-(?P<num>[0-9]+)`, link.Pattern)
+	assert.Equal(t, "[TICKET-${num}](https://example.com/TICKET?query=${num})", link.Template)
+
+	require.NoError(t, link.Compile())
+	assert.Equal(t, "see [TICKET-123](https://example.com/TICKET?query=123).", link.Replace("see TICKET-123."))
+	assert.Equal(t, "see TICKET-abc.", link.Replace("see TICKET-abc."))
+
+	link = GitHubAutolinkToLink("org/repo", GitHubAutolink{
+		KeyPrefix:      "DOC.",
+		URLTemplate:    "https://example.com/docs/<num>",
+		IsAlphanumeric: true,
+	})
+	require.NoError(t, link.Compile())
+	assert.Equal(t, "see [DOC.abc1](https://example.com/docs/abc1)", link.Replace("see DOC.abc1"))
+}
+
+func TestGitHubImport(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/orgs/org/repos", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "token thetoken", r.Header.Get("Authorization"))
+		fmt.Fprint(w, `[{"name": "one", "full_name": "org/one"}, {"name": "two", "full_name": "org/two"}]`)
+	})
+	mux.HandleFunc("/orgs/someuser/repos", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/users/someuser/repos", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"name": "two", "full_name": "someuser/two"}]`)
+	})
+	mux.HandleFunc("/repos/org/one/autolinks", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id": 1, "key_prefix": "ONE-", "url_template": "https://one/<num>", "is_alphanumeric": false}]`)
+	})
+	mux.HandleFunc("/repos/org/two/autolinks", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	})
+	mux.HandleFunc("/repos/someuser/two/autolinks", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id": 2, "key_prefix": "TWO-", "url_template": "https://two/<num>", "is_alphanumeric": true}]`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	g := NewGitHub(server.URL, "thetoken")
+
+	t.Run("organization", func(t *testing.T) {
+		links, failed, err := g.Import("org")
+		require.NoError(t, err)
+		assert.Empty(t, failed)
+		assert.Equal(t, []autolink.Autolink{{
+			Name:     "GitHub org/one ONE-",
+			Pattern:  `ONE-(?P<num>[0-9]+)`,
+			Template: "[ONE-${num}](https://one/${num})",
+		}}, links)
+	})
+
+	t.Run("user", func(t *testing.T) {
+		links, _, err := g.Import("someuser")
+		require.NoError(t, err)
+		require.Len(t, links, 1)
+		assert.Equal(t, "GitHub someuser/two TWO-", links[0].Name)
+	})
+
+	t.Run("repository", func(t *testing.T) {
+		links, _, err := g.Import("org/one")
+		require.NoError(t, err)
+		require.Len(t, links, 1)
+		assert.Equal(t, "GitHub org/one ONE-", links[0].Name)
+	})
+
+	t.Run("missing repository", func(t *testing.T) {
+		_, _, err := g.Import("org/missing")
+		require.Error(t, err)
+	})
+
+	t.Run("repositories failing", func(t *testing.T) {
+		mux.HandleFunc("/orgs/partial/repos", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `[{"name": "broken", "full_name": "partial/broken"}, {"name": "one", "full_name": "org/one"}]`)
+		})
+		links, failed, err := g.Import("partial")
+		require.NoError(t, err)
+		require.Len(t, links, 1, "the other repositories are imported")
+		assert.Equal(t, "GitHub org/one ONE-", links[0].Name)
+		require.Contains(t, failed, "partial/broken")
+		assert.Contains(t, failed["partial/broken"].Error(), "404")
+	})
+
+	t.Run("escaped paths", func(t *testing.T) {
+		var requested string
+		mux.HandleFunc("/repos/we ird/re?po/autolinks", func(w http.ResponseWriter, r *http.Request) {
+			requested = r.URL.EscapedPath()
+			fmt.Fprint(w, `[]`)
+		})
+		_, _, err := g.Import("we ird/re?po")
+		require.NoError(t, err)
+		assert.Equal(t, "/repos/we%20ird/re%3Fpo/autolinks", requested)
+	})
+}
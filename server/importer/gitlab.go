@@ -0,0 +1,155 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+// DefaultGitLabAPIURL is the base URL of the GitLab.com REST API.
+const DefaultGitLabAPIURL = "https://gitlab.com/api/v4"
+
+const gitlabProjectsPerPage = 100
+
+// GitLabProject is a project as returned by the GitLab REST API.
+type GitLabProject struct {
+	PathWithNamespace    string `json:"path_with_namespace"`
+	WebURL               string `json:"web_url"`
+	IssuesEnabled        bool   `json:"issues_enabled"`
+	MergeRequestsEnabled bool   `json:"merge_requests_enabled"`
+}
+
+// GitLab imports the references to the issues and merge requests of GitLab
+// projects.
+type GitLab struct {
+	BaseURL string
+	Token   string
+	Client  *http.Client
+}
+
+// NewGitLab creates a GitLab importer authenticated with the given token. An
+// empty baseURL selects the GitLab.com API.
+func NewGitLab(baseURL, token string) *GitLab {
+	if baseURL == "" {
+		baseURL = DefaultGitLabAPIURL
+	}
+	return &GitLab{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		Token:   token,
+		Client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Import converts the issue and merge request references of a single project
+// (`group/project`), or of every project of a group and its subgroups
+// (`group` or `group/subgroup`), into links. A target is looked up as a
+// project first, then as a group, since both may have nested paths.
+func (g *GitLab) Import(target string) ([]autolink.Autolink, error) {
+	target = strings.Trim(target, "/")
+	if target == "" {
+		return nil, errors.New("a GitLab group or project is required")
+	}
+
+	var projects []GitLabProject
+	var project GitLabProject
+	status, err := g.get("/projects/"+url.PathEscape(target), &project)
+	switch {
+	case err == nil:
+		projects = []GitLabProject{project}
+	case status == http.StatusNotFound:
+		if projects, err = g.listProjects(target); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	links := []autolink.Autolink{}
+	for _, project := range projects {
+		links = append(links, GitLabProjectToLinks(project)...)
+	}
+	return links, nil
+}
+
+func (g *GitLab) listProjects(group string) ([]GitLabProject, error) {
+	projects := []GitLabProject{}
+	for page := 1; ; page++ {
+		var batch []GitLabProject
+		path := fmt.Sprintf("/groups/%s/projects?include_subgroups=true&archived=false&per_page=%d&page=%d",
+			url.PathEscape(group), gitlabProjectsPerPage, page)
+		if _, err := g.get(path, &batch); err != nil {
+			return nil, err
+		}
+
+		projects = append(projects, batch...)
+		if len(batch) < gitlabProjectsPerPage {
+			return projects, nil
+		}
+	}
+}
+
+func (g *GitLab) get(path string, out interface{}) (int, error) {
+	req, err := http.NewRequest(http.MethodGet, g.BaseURL+path, nil)
+	if err != nil {
+		return 0, err
+	}
+	if g.Token != "" {
+		req.Header.Set("PRIVATE-TOKEN", g.Token)
+	}
+
+	resp, err := g.Client.Do(req)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to request %s", path)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, errors.Wrapf(err, "failed to read response for %s", path)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, errors.Errorf("GitLab API returned %v for %s: %s", resp.StatusCode, path, string(body))
+	}
+
+	if err = json.Unmarshal(body, out); err != nil {
+		return resp.StatusCode, errors.Wrapf(err, "failed to decode response for %s", path)
+	}
+	return resp.StatusCode, nil
+}
+
+// GitLabProjectToLinks converts the references GitLab recognizes across
+// projects, `group/project#123` for issues and `group/project!123` for merge
+// requests, into links to the issues and merge requests of the project. The
+// short references, `#123` and `!123`, are not converted, as they depend on
+// the project they are written in.
+func GitLabProjectToLinks(project GitLabProject) []autolink.Autolink {
+	path := project.PathWithNamespace
+	webURL := strings.ReplaceAll(strings.TrimSuffix(project.WebURL, "/"), "$", "$$")
+	text := strings.ReplaceAll(path, "$", "$$")
+
+	links := []autolink.Autolink{}
+	if project.IssuesEnabled {
+		links = append(links, autolink.Autolink{
+			Name:     fmt.Sprintf("GitLab %s issues", path),
+			Pattern:  regexp.QuoteMeta(path) + `#(?P<num>[0-9]+)`,
+			Template: "[" + text + "#${num}](" + webURL + "/-/issues/${num})",
+		})
+	}
+	if project.MergeRequestsEnabled {
+		links = append(links, autolink.Autolink{
+			Name:     fmt.Sprintf("GitLab %s merge requests", path),
+			Pattern:  regexp.QuoteMeta(path) + `!(?P<num>[0-9]+)`,
+			Template: "[" + text + "!${num}](" + webURL + "/-/merge_requests/${num})",
+		})
+	}
+	return links
+}
@@ -0,0 +1,91 @@
+package importer
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+func TestGitLabProjectToLinks(t *testing.T) {
+	links := GitLabProjectToLinks(GitLabProject{
+		PathWithNamespace:    "org/sub/app",
+		WebURL:               "https://gitlab.example.com/org/sub/app",
+		IssuesEnabled:        true,
+		MergeRequestsEnabled: true,
+	})
+	require.Len(t, links, 2)
+	assert.Equal(t, "GitLab org/sub/app issues", links[0].Name)
+	assert.Equal(t, "GitLab org/sub/app merge requests", links[1].Name)
+
+	for i := range links {
+		require.NoError(t, links[i].Compile())
+	}
+	assert.Equal(t, "see [org/sub/app#12](https://gitlab.example.com/org/sub/app/-/issues/12).",
+		links[0].Replace("see org/sub/app#12."))
+	assert.Equal(t, "see [org/sub/app!3](https://gitlab.example.com/org/sub/app/-/merge_requests/3)",
+		links[1].Replace("see org/sub/app!3"))
+	assert.Equal(t, "see #12 and org/sub/apps#12", links[0].Replace("see #12 and org/sub/apps#12"))
+
+	links = GitLabProjectToLinks(GitLabProject{
+		PathWithNamespace:    "org/app",
+		WebURL:               "https://gitlab.example.com/org/app",
+		MergeRequestsEnabled: true,
+	})
+	require.Len(t, links, 1)
+	assert.Equal(t, "GitLab org/app merge requests", links[0].Name)
+}
+
+func TestGitLabImport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "thetoken", r.Header.Get("PRIVATE-TOKEN"))
+		switch r.URL.EscapedPath() {
+		case "/projects/org%2Fapp":
+			fmt.Fprint(w, `{"path_with_namespace": "org/app", "web_url": "https://gitlab.example.com/org/app", "issues_enabled": true}`)
+		case "/groups/org/projects":
+			assert.Equal(t, "true", r.URL.Query().Get("include_subgroups"))
+			fmt.Fprint(w, `[{"path_with_namespace": "org/app", "web_url": "https://gitlab.example.com/org/app", "issues_enabled": true},
+				{"path_with_namespace": "org/sub/lib", "web_url": "https://gitlab.example.com/org/sub/lib", "merge_requests_enabled": true}]`)
+		case "/projects/broken":
+			http.Error(w, "oops", http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	g := NewGitLab(server.URL, "thetoken")
+
+	t.Run("project", func(t *testing.T) {
+		links, err := g.Import("org/app")
+		require.NoError(t, err)
+		assert.Equal(t, []autolink.Autolink{{
+			Name:     "GitLab org/app issues",
+			Pattern:  `org/app#(?P<num>[0-9]+)`,
+			Template: "[org/app#${num}](https://gitlab.example.com/org/app/-/issues/${num})",
+		}}, links)
+	})
+
+	t.Run("group", func(t *testing.T) {
+		links, err := g.Import("org")
+		require.NoError(t, err)
+		require.Len(t, links, 2)
+		assert.Equal(t, "GitLab org/app issues", links[0].Name)
+		assert.Equal(t, "GitLab org/sub/lib merge requests", links[1].Name)
+	})
+
+	t.Run("missing group", func(t *testing.T) {
+		_, err := g.Import("missing")
+		require.Error(t, err)
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		_, err := g.Import("broken")
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,72 @@
+package importer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+// Replace replaces the links that are not owned by a plugin with the synced
+// links, e.g. the links of another server, in their order. The links owned
+// by plugins are kept after them, and the synced links owned by plugins are
+// left out, since these plugins manage their links on each server. It returns
+// the names of the links added, updated and removed, a link being identified
+// by its name and scope.
+func Replace(links, synced []autolink.Autolink) (replaced []autolink.Autolink, added, updated, removed []string) {
+	old := map[string][]autolink.Autolink{}
+	var owned []autolink.Autolink
+	for _, link := range links {
+		if link.PluginID != "" {
+			owned = append(owned, link)
+			continue
+		}
+		key := syncKey(link)
+		old[key] = append(old[key], link)
+	}
+
+	replaced = []autolink.Autolink{}
+	for _, link := range synced {
+		if link.PluginID != "" {
+			continue
+		}
+		replaced = append(replaced, link)
+
+		key := syncKey(link)
+		if len(old[key]) == 0 {
+			added = append(added, link.DisplayName())
+			continue
+		}
+		if !old[key][0].Equals(link) {
+			updated = append(updated, link.DisplayName())
+		}
+		old[key] = old[key][1:]
+	}
+	for _, link := range links {
+		key := syncKey(link)
+		if link.PluginID == "" && len(old[key]) > 0 {
+			removed = append(removed, link.DisplayName())
+			old[key] = old[key][1:]
+		}
+	}
+	return append(replaced, owned...), added, updated, removed
+}
+
+// syncKey identifies a link across servers. Links of the same name may have
+// different scopes, e.g. when a team overrides a global link.
+func syncKey(link autolink.Autolink) string {
+	return fmt.Sprintf("%s\x00%s", link.DisplayName(), strings.ToLower(strings.Join(link.Scope, " ")))
+}
+
+// Equal reports whether the links are the same, in the same order.
+func Equal(a, b []autolink.Autolink) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equals(b[i]) {
+			return false
+		}
+	}
+	return true
+}
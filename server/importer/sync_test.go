@@ -0,0 +1,46 @@
+package importer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mattermost/mattermost-plugin-autolink/server/autolink"
+)
+
+func TestReplace(t *testing.T) {
+	links := []autolink.Autolink{
+		{Name: "jira", Pattern: "MM-1", Template: "old"},
+		{Name: "owned", Pattern: "owned", Template: "owned", PluginID: "com.example.plugin"},
+		{Name: "jira", Pattern: "MM-1", Template: "team", Scope: []string{"team"}},
+		{Name: "stale", Pattern: "stale", Template: "stale"},
+		{Pattern: "TODO", Template: "**TODO**"},
+	}
+	synced := []autolink.Autolink{
+		{Pattern: "TODO", Template: "**TODO**"},
+		{Name: "jira", Pattern: "MM-1", Template: "new"},
+		{Name: "jira", Pattern: "MM-1", Template: "team", Scope: []string{"team"}},
+		{Name: "docs", Pattern: "docs", Template: "docs"},
+		{Name: "remote", Pattern: "remote", Template: "remote", PluginID: "com.example.other"},
+	}
+
+	replaced, added, updated, removed := Replace(links, synced)
+	assert.Equal(t, []autolink.Autolink{
+		{Pattern: "TODO", Template: "**TODO**"},
+		{Name: "jira", Pattern: "MM-1", Template: "new"},
+		{Name: "jira", Pattern: "MM-1", Template: "team", Scope: []string{"team"}},
+		{Name: "docs", Pattern: "docs", Template: "docs"},
+		{Name: "owned", Pattern: "owned", Template: "owned", PluginID: "com.example.plugin"},
+	}, replaced)
+	assert.Equal(t, []string{"docs"}, added)
+	assert.Equal(t, []string{"jira"}, updated)
+	assert.Equal(t, []string{"stale"}, removed)
+
+	assert.False(t, Equal(links, replaced))
+
+	again, added, updated, removed := Replace(replaced, synced)
+	assert.Empty(t, added)
+	assert.Empty(t, updated)
+	assert.Empty(t, removed)
+	assert.True(t, Equal(replaced, again))
+}